@@ -11,6 +11,10 @@ import (
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"chatty/cmd/chatty/appdir"
+	"chatty/cmd/chatty/atomicfile"
+	"chatty/cmd/chatty/theme"
 )
 
 // Common directives that apply to all agents
@@ -28,8 +32,8 @@ const (
 	builtinDir = "builtin"
 	// User agents directory name
 	userAgentsDir = "agents"
-	// History directory name
-	historyDir = ".chatty"
+	// How often agent files are checked for changes, so lookups in a row don't each stat every file
+	updateCheckInterval = 2 * time.Second
 )
 
 // Config holds the current configuration
@@ -38,10 +42,46 @@ type Config struct {
 	LanguageCode     string `json:"language_code,omitempty"`     // Optional: Override default language
 	CommonDirectives string `json:"common_directives,omitempty"` // Optional: Override default directives template
 	Model            string `json:"model,omitempty"`             // Optional: Override default model
+	ContextWindow    int    `json:"context_window,omitempty"`    // Optional: Tokens of context to run the model with (default: the model's num_ctx or Ollama's default)
 	BaseGuidelines string `json:"base_guidelines,omitempty"` // Optional: Override base guidelines that apply to all modes
 	InteractiveGuidelines string `json:"interactive_guidelines,omitempty"` // Optional: Override guidelines specific to interactive mode
 	AutonomousGuidelines  string `json:"autonomous_guidelines,omitempty"`  // Optional: Override guidelines specific to autonomous mode
 	AutoMode           bool   `json:"auto_mode,omitempty"`            // Optional: Override default auto mode
+	UserLabelTemplate  string `json:"user_label_template,omitempty"`  // Optional: Label before user messages, e.g. "{emoji} {name} [{time}]: "
+	AgentLabelTemplate string `json:"agent_label_template,omitempty"` // Optional: Label before agent messages
+	Theme              string `json:"theme,omitempty"`                // Optional: Color theme (dark, light, solarized, mono)
+	DurationFormat     string `json:"duration_format,omitempty"`      // Optional: How elapsed times are shown: long (default, "1 hour, 23 minutes"), compact ("1h 23m") or clock ("1:23:05")
+	NoEmoji            bool   `json:"no_emoji,omitempty"`             // Optional: Show short codes like [ADA] instead of emojis
+	TTSEngine          string `json:"tts_engine,omitempty"`           // Optional: Text-to-speech engine for --speak (espeak, say, piper)
+	TTSVoice           string `json:"tts_voice,omitempty"`            // Optional: Default voice for agents without their own
+	STTCommand         string `json:"stt_command,omitempty"`          // Optional: Transcription command for --listen, with a {file} placeholder
+	STTModel           string `json:"stt_model,omitempty"`            // Optional: whisper.cpp model path for --listen
+	DisableNotifications bool `json:"disable_notifications,omitempty"` // Optional: No desktop notification when --auto --turns runs finish
+	DisableStatusBar   bool   `json:"disable_status_bar,omitempty"`   // Optional: No line with the elapsed time, tokens and tokens/sec under streaming responses
+	Animation          string `json:"animation,omitempty"`            // Optional: Animation while waiting for responses: dots (default), spinner or none
+	AnimationDelay     int    `json:"animation_delay,omitempty"`      // Optional: Milliseconds between frames of the animation (default: 200)
+	Keybindings        map[string][]string `json:"keybindings,omitempty"` // Optional: Keys of menus, chats and the TUI by action, e.g. {"cancel": ["ctrl+q"]}
+	OCRModel           string `json:"ocr_model,omitempty"`            // Optional: Ollama vision model used by --ocr instead of tesseract
+	DisplayLanguage    string `json:"display_language,omitempty"`     // Optional: Show a translation of each response in this language
+	KnowledgeBase      string `json:"knowledge_base,omitempty"`       // Optional: Knowledge base searched for context in every chat
+	EmbeddingModel     string `json:"embedding_model,omitempty"`      // Optional: Ollama model that embeds documents and queries (default nomic-embed-text)
+	DisableMemory      bool   `json:"disable_memory,omitempty"`       // Optional: Don't remember facts about the user or summaries of earlier sessions
+	DisableTools       bool   `json:"disable_tools,omitempty"`        // Optional: Don't let agents call tools such as time, read_file and http_get
+	ShellAllowlist     []string `json:"shell_allowlist,omitempty"`    // Optional: Commands run_shell may run without asking, e.g. "ls" or "git status"
+	ToolsRoot          string `json:"tools_root,omitempty"`           // Optional: Directory read_file and write_file are confined to (default: the working directory)
+	ToolPermissions    map[string]string `json:"tool_permissions,omitempty"` // Optional: allow, deny or ask for each tool, set with chatty --tools
+	AgentToolPermissions map[string]map[string]string `json:"agent_tool_permissions,omitempty"` // Optional: Per-agent overrides of tool_permissions
+	SearchEngine       string `json:"search_engine,omitempty"`        // Optional: Backend of the web_search tool: duckduckgo (default) or searxng
+	SearxNGURL         string `json:"searxng_url,omitempty"`          // Optional: SearxNG instance used when search_engine is searxng
+	CodeInterpreter    string `json:"code_interpreter,omitempty"`     // Optional: Enable the run_code tool: auto, container or local (default: off)
+	SlackChannels      map[string][]string `json:"slack_channels,omitempty"` // Optional: Agents answering in Slack channels, by channel name or ID, for chatty bridge slack
+	DiscordChannels    map[string][]string `json:"discord_channels,omitempty"` // Optional: Agents answering in Discord channels, by channel name or ID, for chatty bridge discord
+	DiscordAutoChannels map[string][]string `json:"discord_auto_channels,omitempty"` // Optional: Agents conversing among themselves in Discord channels, by channel name or ID
+	MatrixRooms        map[string][]string `json:"matrix_rooms,omitempty"` // Optional: Agents answering in Matrix rooms, by room ID or alias, for chatty bridge matrix
+	AgentGroups        map[string][]string `json:"agent_groups,omitempty"` // Optional: Named lists of agents, used as chatty --with @name
+	DisabledAgents     []string `json:"disabled_agents,omitempty"`    // Optional: Agents hidden from --list, --with-random and selection, set with chatty --disable
+	OllamaURL          string `json:"ollama_url,omitempty"`           // Optional: Address of the Ollama server (default: http://localhost:11434)
+	ConfigVersion      int    `json:"config_version,omitempty"`       // Version of the schema of this file, for migrations when chatty changes it
 }
 
 
@@ -55,6 +95,12 @@ type AgentConfig struct {
 	Description   string   `yaml:"description"`
 	IsDefault     bool     `yaml:"is_default"`
 	Tags          []string `yaml:"tags,omitempty"`
+	Voice         string   `yaml:"voice,omitempty"` // Optional: Text-to-speech voice (e.g. "en-us+m3" for espeak, "Daniel" for say, a model path for piper)
+	Knowledge     string   `yaml:"knowledge,omitempty"` // Optional: Directory of documents searched for context only in this agent's chats
+	Tools         []string `yaml:"tools,omitempty"` // Optional: The only tools this agent may use (default: all of them)
+	LanguageCode  string   `yaml:"language_code,omitempty"` // Optional: Language the agent always replies in, e.g. "fr-FR", over language_code in config.json
+	AutoSave      bool     `yaml:"auto_save,omitempty"` // Optional: Save a transcript of every chat with this agent, without --save
+	SaveDir       string   `yaml:"save_dir,omitempty"` // Optional: Directory auto-saved transcripts go to (default: ~/.chatty/transcripts)
 	Source        string   `yaml:"-"` // Indicates if agent is built-in or user-defined
 }
 
@@ -64,36 +110,74 @@ type agentCache struct {
 	// Keep track of the original order
 	builtinOrder []string
 	userOrder    []string
-	lastUpdate   map[string]time.Time
+	lastUpdate   map[string]time.Time // Modification times of every agent file read, by path
+	lastCheck    time.Time
+	loaded       bool
 	mutex        sync.RWMutex
 }
 
 var (
-	// Global cache instance
+	// Global cache instance, filled the first time agents are needed
 	cache = &agentCache{
 		agents:   make(map[string]AgentConfig),
 		builtinOrder: make([]string, 0),
 		userOrder:    make([]string, 0),
 		lastUpdate:   make(map[string]time.Time),
 	}
-	// DefaultAgent is set during initialization
-	DefaultAgent AgentConfig
+	// defaultAgent is set when agents are loaded
+	defaultAgent AgentConfig
 )
 
-// GetCurrentConfig reads and returns the current configuration
+// GetDefaultAgent returns the agent used when none is selected, loading agents if needed
+func GetDefaultAgent() AgentConfig {
+	refreshIfNeeded()
+
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+	return defaultAgent
+}
+
+// GetCurrentConfig reads and returns the current configuration: config.json, with the settings
+// overridden by the project's .chatty.yaml, then by environment variables and then by --style
+// and --lang
 func GetCurrentConfig() (*Config, error) {
-	homeDir, err := os.UserHomeDir()
+	config, err := readConfigFile()
+	if err != nil {
+		return nil, err
+	}
+	project, err := GetProjectConfig()
+	if err != nil {
+		return nil, err
+	}
+	if project != nil {
+		applyProject(config, project)
+	}
+	if err := applyEnv(config); err != nil {
+		return nil, err
+	}
+	// A --style wins over every source of base guidelines, and --lang over language_code, being
+	// chosen for the run
+	applyStyle(config, project)
+	if runLanguage != "" {
+		config.LanguageCode = runLanguage
+	}
+	return config, nil
+}
+
+// readConfigFile reads config.json alone, which is what changes to the settings are saved over
+func readConfigFile() (*Config, error) {
+	configDir, err := appdir.ConfigDir()
 	if err != nil {
 		return nil, err
 	}
 
-	configPath := filepath.Join(homeDir, ".chatty", "config.json")
+	configPath := filepath.Join(configDir, "config.json")
 	data, err := os.ReadFile(configPath)
 	if err != nil {
 		if os.IsNotExist(err) {
 			// Return default config if file doesn't exist
 			return &Config{
-				CurrentAgent: DefaultAgent.Name,
+				CurrentAgent: GetDefaultAgent().Name,
 				LanguageCode: defaultLanguageCode,
 				Model: defaultModel,
 				BaseGuidelines: baseGuidelines,
@@ -105,6 +189,16 @@ func GetCurrentConfig() (*Config, error) {
 
 	var config Config
 	if err := json.Unmarshal(data, &config); err != nil {
+		// Point at the settings to fix, rather than at a byte offset
+		var problems []ConfigProblem
+		for _, problem := range CheckConfig(data) {
+			if !problem.Warning {
+				problems = append(problems, problem)
+			}
+		}
+		if len(problems) > 0 {
+			return nil, &ConfigError{Problems: problems}
+		}
 		return nil, err
 	}
 
@@ -122,17 +216,49 @@ func GetCurrentConfig() (*Config, error) {
 	return &config, nil
 }
 
+// writeConfigFile saves config to config.json, replacing the file atomically so a crash
+// can't leave it half written
+func writeConfigFile(config *Config) error {
+	// The default guidelines filled in on load stay out of the file, so they keep up with new versions
+	if config.BaseGuidelines == baseGuidelines {
+		config.BaseGuidelines = ""
+	}
+
+	configDir, err := appdir.ConfigDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(configDir, 0755); err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "    ")
+	if err != nil {
+		return err
+	}
+	return atomicfile.WriteFile(filepath.Join(configDir, "config.json"), data, 0644)
+}
+
 // Get complete system message including directives
 func (a *AgentConfig) GetFullSystemMessage(isAuto bool, participants string) string {
 	// Get current config for language code
 	config, err := GetCurrentConfig()
 	if err != nil || config == nil {
-		// If we can't get config, use default language code
-		return GetSystemMessageWithContext(a.SystemMessage, a.Name, isAuto, defaultLanguageCode, "", "", "", false, participants)
+		// If we can't get config, use the run's, the agent's or the default language code
+		languageCode := runLanguage
+		if languageCode == "" {
+			languageCode = a.LanguageCode
+		}
+		if languageCode == "" {
+			languageCode = defaultLanguageCode
+		}
+		return GetSystemMessageWithContext(a.SystemMessage, a.Name, isAuto, languageCode, "", "", "", false, participants)
 	}
 
-	// Get language code
+	// Get language code, the agent's own taking precedence unless --lang chose one for the run
 	languageCode := config.LanguageCode
+	if a.LanguageCode != "" && runLanguage == "" {
+		languageCode = a.LanguageCode
+	}
 	if languageCode == "" {
 		languageCode = defaultLanguageCode
 	}
@@ -169,11 +295,11 @@ func (a *AgentConfig) GetFullSystemMessage(isAuto bool, participants string) str
 
 // getUserAgentsDir returns the path to user's agents directory
 func getUserAgentsDir() (string, error) {
-	homeDir, err := os.UserHomeDir()
+	configDir, err := appdir.ConfigDir()
 	if err != nil {
 		return "", err
 	}
-	return filepath.Join(homeDir, ".chatty", userAgentsDir), nil
+	return filepath.Join(configDir, userAgentsDir), nil
 }
 
 // loadAgentFile loads a single agent from a YAML file
@@ -207,6 +333,9 @@ func LoadAgents() error {
 	cache.builtinOrder = make([]string, 0)
 	cache.userOrder = make([]string, 0)
 	cache.lastUpdate = make(map[string]time.Time)
+	cache.lastCheck = time.Now()
+	cache.loaded = true
+	defaultAgent = AgentConfig{}
 
 	// First, ensure user directory exists
 	userDir, err := getUserAgentsDir()
@@ -219,6 +348,11 @@ func LoadAgents() error {
 		return fmt.Errorf("failed to create user agents directory: %v", err)
 	}
 
+	// Files that haven't changed since an earlier run are taken from the index
+	index := readAgentIndex()
+	next := agentIndex{Format: index.Format, Files: make(map[string]indexedAgent)}
+	parsed := false
+
 	// Load user-defined agents first (so they can override built-ins)
 	userFiles, err := os.ReadDir(userDir)
 	if err != nil {
@@ -229,7 +363,14 @@ func LoadAgents() error {
 	for _, file := range userFiles {
 		if !file.IsDir() && (strings.HasSuffix(file.Name(), ".yaml") || strings.HasSuffix(file.Name(), ".yml")) {
 			path := filepath.Join(userDir, file.Name())
-			agent, err := loadAgentFile(path, false)
+			info, err := file.Info()
+			if err != nil {
+				continue
+			}
+			// Tracked even when it fails to load, so it is only read again once fixed
+			cache.lastUpdate[path] = info.ModTime()
+			agent, fromFile, err := loadIndexed(index, next, path, info, false)
+			parsed = parsed || fromFile
 			if err != nil {
 				fmt.Printf("Warning: Failed to load user agent %s: %v\n", file.Name(), err)
 				continue
@@ -239,7 +380,6 @@ func LoadAgents() error {
 			name := strings.ToLower(agent.Name)
 			cache.agents[name] = agent
 			cache.userOrder = append(cache.userOrder, name)
-			cache.lastUpdate[path] = time.Now()
 		}
 	}
 
@@ -256,7 +396,12 @@ func LoadAgents() error {
 	for _, file := range builtinFiles {
 		if !file.IsDir() && (strings.HasSuffix(file.Name(), ".yaml") || strings.HasSuffix(file.Name(), ".yml")) {
 			path := filepath.Join(builtinPath, file.Name())
-			agent, err := loadAgentFile(path, true)
+			info, err := file.Info()
+			if err != nil {
+				return fmt.Errorf("failed to load built-in agent %s: %v", file.Name(), err)
+			}
+			agent, fromFile, err := loadIndexed(index, next, path, info, true)
+			parsed = parsed || fromFile
 			if err != nil {
 				return fmt.Errorf("failed to load built-in agent %s: %v", file.Name(), err)
 			}
@@ -266,24 +411,30 @@ func LoadAgents() error {
 			if _, exists := cache.agents[name]; !exists {
 				cache.agents[name] = agent
 				cache.builtinOrder = append(cache.builtinOrder, name)
-				cache.lastUpdate[path] = time.Now()
 			}
+			// Tracked even when overridden, so it isn't taken for a new file
+			cache.lastUpdate[path] = info.ModTime()
 
-			if agent.IsDefault && DefaultAgent.Name == "" {
-				DefaultAgent = agent
+			if agent.IsDefault && defaultAgent.Name == "" {
+				defaultAgent = agent
 			}
 		}
 	}
 
+	// Save the index when files were parsed or removed
+	if parsed || len(next.Files) != len(index.Files) {
+		next.save()
+	}
+
 	// Set default agent if none was specified
-	if DefaultAgent.Name == "" && len(cache.agents) > 0 {
+	if defaultAgent.Name == "" && len(cache.agents) > 0 {
 		// Try to use Ghost as default if available
 		if agent, ok := cache.agents[defaultAgentName]; ok {
-			DefaultAgent = agent
+			defaultAgent = agent
 		} else {
 			// Otherwise use the first available agent
 			for _, agent := range cache.agents {
-				DefaultAgent = agent
+				defaultAgent = agent
 				break
 			}
 		}
@@ -292,67 +443,65 @@ func LoadAgents() error {
 	return nil
 }
 
-// checkForUpdates checks if any agent files have been modified
+// modTime returns when a directory entry was last modified, the zero time when it can't be read
+func modTime(file os.DirEntry) time.Time {
+	info, err := file.Info()
+	if err != nil {
+		return time.Time{}
+	}
+	return info.ModTime()
+}
+
+// checkForUpdates checks if any agent files have been added, modified or removed since they were loaded
 func checkForUpdates() bool {
 	cache.mutex.RLock()
 	defer cache.mutex.RUnlock()
 
-	updated := false
-	
-	// Check built-in agents
 	_, filename, _, _ := runtime.Caller(0)
 	builtinPath := filepath.Join(filepath.Dir(filename), builtinDir)
-	
-	if err := filepath.Walk(builtinPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		
-		if !info.IsDir() && (strings.HasSuffix(info.Name(), ".yaml") || strings.HasSuffix(info.Name(), ".yml")) {
-			lastMod := info.ModTime()
-			if lastUpdate, ok := cache.lastUpdate[path]; !ok || lastMod.After(lastUpdate) {
-				updated = true
-				return filepath.SkipAll
-			}
-		}
-		return nil
-	}); err != nil {
-		fmt.Printf("Warning: Failed to check built-in agents for updates: %v\n", err)
-	}
-
-	// Check user-defined agents
 	userDir, err := getUserAgentsDir()
 	if err != nil {
 		fmt.Printf("Warning: Failed to get user agents directory: %v\n", err)
-		return updated
+		return false
 	}
 
-	if err := filepath.Walk(userDir, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	seen := 0
+	for _, dir := range []string{builtinPath, userDir} {
+		files, err := os.ReadDir(dir)
+		if err != nil && !os.IsNotExist(err) {
+			fmt.Printf("Warning: Failed to check agents in %s for updates: %v\n", dir, err)
+			continue
 		}
-		
-		if !info.IsDir() && (strings.HasSuffix(info.Name(), ".yaml") || strings.HasSuffix(info.Name(), ".yml")) {
-			lastMod := info.ModTime()
-			if lastUpdate, ok := cache.lastUpdate[path]; !ok || lastMod.After(lastUpdate) {
-				updated = true
-				return filepath.SkipAll
+		for _, file := range files {
+			if file.IsDir() || !(strings.HasSuffix(file.Name(), ".yaml") || strings.HasSuffix(file.Name(), ".yml")) {
+				continue
+			}
+			seen++
+			if lastUpdate, ok := cache.lastUpdate[filepath.Join(dir, file.Name())]; !ok || !modTime(file).Equal(lastUpdate) {
+				return true
 			}
 		}
-		return nil
-	}); err != nil {
-		fmt.Printf("Warning: Failed to check user agents for updates: %v\n", err)
 	}
 
-	return updated
+	// Fewer files than were loaded means some were removed
+	return seen != len(cache.lastUpdate)
 }
 
-// refreshIfNeeded reloads agents if any files have been modified
+// refreshIfNeeded loads agents the first time they are needed, then reloads them when their
+// files have changed, checking at most once per updateCheckInterval
 func refreshIfNeeded() {
-	if checkForUpdates() {
-		if err := LoadAgents(); err != nil {
-			fmt.Printf("Warning: Failed to reload agents: %v\n", err)
-		}
+	cache.mutex.Lock()
+	loaded, due := cache.loaded, time.Since(cache.lastCheck) >= updateCheckInterval
+	if due {
+		cache.lastCheck = time.Now()
+	}
+	cache.mutex.Unlock()
+
+	if loaded && (!due || !checkForUpdates()) {
+		return
+	}
+	if err := LoadAgents(); err != nil {
+		fmt.Printf("Warning: Failed to reload agents: %v\n", err)
 	}
 }
 
@@ -366,27 +515,33 @@ func GetAgentConfig(name string) AgentConfig {
 	if agent, ok := cache.agents[strings.ToLower(name)]; ok {
 		return agent
 	}
-	return DefaultAgent
+	return defaultAgent
 }
 
 // getCurrentAgent returns the currently active agent from config
 func getCurrentAgent() string {
-	homeDir, err := os.UserHomeDir()
+	if _, name, ok := envSetting("current_agent"); ok {
+		return name
+	}
+	if project, _ := GetProjectConfig(); project != nil && project.Agent != "" {
+		return project.Agent
+	}
+	configDir, err := appdir.ConfigDir()
 	if err != nil {
-		return DefaultAgent.Name
+		return GetDefaultAgent().Name
 	}
 
-	configPath := filepath.Join(homeDir, ".chatty", "config.json")
+	configPath := filepath.Join(configDir, "config.json")
 	data, err := os.ReadFile(configPath)
 	if err != nil {
-		return DefaultAgent.Name
+		return GetDefaultAgent().Name
 	}
 
 	var config struct {
 		CurrentAgent string `json:"current_agent"`
 	}
 	if err := json.Unmarshal(data, &config); err != nil {
-		return DefaultAgent.Name
+		return GetDefaultAgent().Name
 	}
 
 	return config.CurrentAgent
@@ -401,36 +556,54 @@ func ListAgents() string {
 
 	var sb strings.Builder
 
-	// Define colors
-	colorMagenta := "\u001b[1;35m"
-	colorCyan := "\u001b[1;36m"
-	colorGreen := "\u001b[38;5;82m"
-	colorPurple := "\u001b[1;95m"
-	colorBlue := "\u001b[1;34m"
-	colorReset := "\u001b[0m"
+	// Theme colors
+	palette := theme.Current()
+	colorHeading := palette.Heading
+	colorSection := palette.Section
+	colorHighlight := palette.Highlight
+	colorLabel := palette.Label
+	colorValue := palette.Value
+	colorReset := palette.Reset
 
 	// Header
-	sb.WriteString(fmt.Sprintf("\n%s🤖 Available Agents%s\n", colorMagenta, colorReset))
+	sb.WriteString(fmt.Sprintf("\n%s🤖 Available Agents%s\n", colorHeading, colorReset))
 
 	currentAgent := getCurrentAgent()
 
+	// Disabled agents are only named at the end
+	disabled := disabledAgents()
+	var disabledNames []string
+	enabled := func(order []string) []string {
+		kept := make([]string, 0, len(order))
+		for _, name := range order {
+			if disabled[name] {
+				disabledNames = append(disabledNames, cache.agents[name].Name)
+			} else {
+				kept = append(kept, name)
+			}
+		}
+		return kept
+	}
+	userOrder := enabled(cache.userOrder)
+	builtinOrder := enabled(cache.builtinOrder)
+
 	// List custom & community agents first if any exist
-	if len(cache.userOrder) > 0 {
-		sb.WriteString(fmt.Sprintf("%sCustom & Community Agents%s\n", colorCyan, colorReset))
-		for _, name := range cache.userOrder {
+	if len(userOrder) > 0 {
+		sb.WriteString(fmt.Sprintf("%sCustom & Community Agents%s\n", colorSection, colorReset))
+		for _, name := range userOrder {
 			agent := cache.agents[name]
 			if strings.EqualFold(agent.Name, currentAgent) {
 				sb.WriteString(fmt.Sprintf("%s●%s %s [%s%s%s] %s\n",
-					colorGreen, colorReset,
-					agent.Emoji,
-					agent.LabelColor,
+					colorHighlight, colorReset,
+					theme.AgentEmoji(agent.Emoji, agent.Name),
+					palette.AgentColor(agent.LabelColor),
 					agent.Name,
 					colorReset,
 					agent.Description))
 			} else {
 				sb.WriteString(fmt.Sprintf("○ %s [%s%s%s] %s\n",
-					agent.Emoji,
-					agent.LabelColor,
+					theme.AgentEmoji(agent.Emoji, agent.Name),
+					palette.AgentColor(agent.LabelColor),
 					agent.Name,
 					colorReset,
 					agent.Description))
@@ -439,26 +612,26 @@ func ListAgents() string {
 	}
 
 	// List built-in agents if any exist
-	if len(cache.builtinOrder) > 0 {
+	if len(builtinOrder) > 0 {
 		// Add a newline before built-in agents if we listed custom agents
-		if len(cache.userOrder) > 0 {
+		if len(userOrder) > 0 {
 			sb.WriteString("\n")
 		}
-		sb.WriteString(fmt.Sprintf("%sBuilt-in Agents%s\n", colorCyan, colorReset))
-		for _, name := range cache.builtinOrder {
+		sb.WriteString(fmt.Sprintf("%sBuilt-in Agents%s\n", colorSection, colorReset))
+		for _, name := range builtinOrder {
 			agent := cache.agents[name]
 			if strings.EqualFold(agent.Name, currentAgent) {
 				sb.WriteString(fmt.Sprintf("%s●%s %s [%s%s%s] %s\n",
-					colorGreen, colorReset,
-					agent.Emoji,
-					agent.LabelColor,
+					colorHighlight, colorReset,
+					theme.AgentEmoji(agent.Emoji, agent.Name),
+					palette.AgentColor(agent.LabelColor),
 					agent.Name,
 					colorReset,
 					agent.Description))
 			} else {
 				sb.WriteString(fmt.Sprintf("○ %s [%s%s%s] %s\n",
-					agent.Emoji,
-					agent.LabelColor,
+					theme.AgentEmoji(agent.Emoji, agent.Name),
+					palette.AgentColor(agent.LabelColor),
 					agent.Name,
 					colorReset,
 					agent.Description))
@@ -466,21 +639,36 @@ func ListAgents() string {
 		}
 	}
 
+	if len(disabledNames) > 0 {
+		sb.WriteString(fmt.Sprintf("\n%sDisabled Agents%s\n", colorSection, colorReset))
+		sb.WriteString(fmt.Sprintf("   %s\n", strings.Join(disabledNames, ", ")))
+		sb.WriteString(fmt.Sprintf("   %sEnable one:%s chatty --enable %s\"Agent Name\"%s\n",
+			colorLabel, colorReset, colorValue, colorReset))
+	}
+
+	if config, err := GetCurrentConfig(); err == nil && len(config.AgentGroups) > 0 {
+		sb.WriteString(fmt.Sprintf("\n%sAgent Groups%s\n", colorSection, colorReset))
+		for _, name := range GroupNames() {
+			members, _ := lookupGroup(config.AgentGroups, name)
+			sb.WriteString(fmt.Sprintf("   %s%s%s%s %s\n", colorLabel, GroupPrefix, name, colorReset, strings.Join(members, ", ")))
+		}
+	}
+
 	// Commands
-	sb.WriteString(fmt.Sprintf("\n%s💡 Commands%s\n", colorCyan, colorReset))
+	sb.WriteString(fmt.Sprintf("\n%s💡 Commands%s\n", colorSection, colorReset))
 	sb.WriteString(fmt.Sprintf("   %sSelect an agent:%s chatty --select %s\"Agent Name\"%s\n", 
-		colorPurple, colorReset, colorBlue, colorReset))
+		colorLabel, colorReset, colorValue, colorReset))
 
 	// Additional Agents Section
-	sb.WriteString(fmt.Sprintf("\n%s✨ Want More Agents?%s\n", colorCyan, colorReset))
+	sb.WriteString(fmt.Sprintf("\n%s✨ Want More Agents?%s\n", colorSection, colorReset))
 	sb.WriteString(fmt.Sprintf("   1. %sBrowse store:%s chatty --store\n", 
-		colorPurple, colorReset))
+		colorLabel, colorReset))
 	sb.WriteString(fmt.Sprintf("   2. %sInstall agent:%s chatty --install %s\"Agent Name\"%s\n", 
-		colorPurple, colorReset, colorBlue, colorReset))
+		colorLabel, colorReset, colorValue, colorReset))
 
 	// Legend
 	sb.WriteString(fmt.Sprintf("\n%s●%s Current agent  %s○%s Available agent\n", 
-		colorGreen, colorReset, colorReset, colorReset))
+		colorHighlight, colorReset, colorReset, colorReset))
 
 	return sb.String()
 }
@@ -502,18 +690,25 @@ func GetHistoryFileName(agentName string) string {
 	agent := GetAgentConfig(agentName)
 	// Convert spaces to underscores and make lowercase
 	safeAgentName := strings.ReplaceAll(strings.ToLower(agent.Name), " ", "_")
-	// Return the full path relative to the history directory
-	return filepath.Join(historyDir, fmt.Sprintf("chat_history_%s.json", safeAgentName))
+	// Return the name of the file in the chatty directory
+	return fmt.Sprintf("chat_history_%s.jsonl", safeAgentName)
+}
+
+// GetSummaryFileName returns the memory summary filename for a given agent, next to its history
+func GetSummaryFileName(agentName string) string {
+	agent := GetAgentConfig(agentName)
+	safeAgentName := strings.ReplaceAll(strings.ToLower(agent.Name), " ", "_")
+	return fmt.Sprintf("chat_summary_%s.json", safeAgentName)
 }
 
 // CreateDefaultConfig creates a config.json with default values if it doesn't exist
 func CreateDefaultConfig() error {
-	homeDir, err := os.UserHomeDir()
+	configDir, err := appdir.ConfigDir()
 	if err != nil {
 		return err
 	}
 
-	configPath := filepath.Join(homeDir, ".chatty", "config.json")
+	configPath := filepath.Join(configDir, "config.json")
 	
 	// Check if config already exists
 	if _, err := os.Stat(configPath); err == nil {
@@ -521,54 +716,80 @@ func CreateDefaultConfig() error {
 	}
 
 	// Create default config with only required fields
-	config := Config{
+	return writeConfigFile(&Config{
 		CurrentAgent: defaultAgentName,
 		LanguageCode: defaultLanguageCode,
 		Model:        defaultModel,
 		AutoMode: false,
-	}
+		ConfigVersion: ConfigVersion,
+	})
+}
 
-	data, err := json.MarshalIndent(config, "", "    ")
+// UpdateCurrentAgent updates only the current_agent field in config
+func UpdateCurrentAgent(name string) error {
+	config, err := readConfigFile()
 	if err != nil {
 		return err
 	}
+	config.CurrentAgent = name
+	return writeConfigFile(config)
+}
 
-	// Ensure directory exists
-	configDir := filepath.Dir(configPath)
-	if err := os.MkdirAll(configDir, 0755); err != nil {
+// UpdateModel updates only the model field in config
+func UpdateModel(model string) error {
+	config, err := readConfigFile()
+	if err != nil {
 		return err
 	}
-
-	return os.WriteFile(configPath, data, 0644)
+	config.Model = model
+	return writeConfigFile(config)
 }
 
-// UpdateCurrentAgent updates only the current_agent field in config
-func UpdateCurrentAgent(name string) error {
-	config, err := GetCurrentConfig()
-	if err != nil {
-		// If config doesn't exist, create it with only required fields
-		config = &Config{
-			CurrentAgent: name,
-			LanguageCode: defaultLanguageCode,
-			Model:        defaultModel,
-			AutoMode: false,
-		}
-	} else {
-		config.CurrentAgent = name
+// ModelOverride returns what sets the model over config.json: the variable, like CHATTY_MODEL,
+// or the path of the project's .chatty.yaml. It is empty when the model of config.json is used
+func ModelOverride() string {
+	if name, _, ok := envSetting("model"); ok {
+		return name
 	}
+	if project, _ := GetProjectConfig(); project != nil && project.Model != "" {
+		return project.Path
+	}
+	return ""
+}
 
-	homeDir, err := os.UserHomeDir()
+// SetToolPermission saves a tool's permission (allow, deny or ask) for all agents, or only
+// for agentName when it is not empty. An empty permission removes the setting
+func SetToolPermission(agentName, tool, permission string) error {
+	config, err := readConfigFile()
 	if err != nil {
 		return err
 	}
 
-	configPath := filepath.Join(homeDir, ".chatty", "config.json")
-	data, err := json.MarshalIndent(config, "", "    ")
-	if err != nil {
-		return err
+	permissions := config.ToolPermissions
+	if agentName != "" {
+		agentName = GetAgentConfig(agentName).Name
+		if config.AgentToolPermissions == nil {
+			config.AgentToolPermissions = make(map[string]map[string]string)
+		}
+		permissions = config.AgentToolPermissions[agentName]
+	}
+	if permissions == nil {
+		permissions = make(map[string]string)
+	}
+	if permission == "" {
+		delete(permissions, tool)
+	} else {
+		permissions[tool] = permission
 	}
 
-	return os.WriteFile(configPath, data, 0644)
+	if agentName == "" {
+		config.ToolPermissions = permissions
+	} else if len(permissions) == 0 {
+		delete(config.AgentToolPermissions, agentName)
+	} else {
+		config.AgentToolPermissions[agentName] = permissions
+	}
+	return writeConfigFile(config)
 }
 
 // GetAllAgentNames returns all available agent names
@@ -588,59 +809,6 @@ func GetAllAgentNames() []string {
 	return allAgents
 }
 
-// Initialize agents on package load
-func init() {
-	// Only initialize the cache
-	cache = &agentCache{
-		agents:   make(map[string]AgentConfig),
-		builtinOrder: make([]string, 0),
-		userOrder:    make([]string, 0),
-		lastUpdate:   make(map[string]time.Time),
-	}
-
-	// Load built-in agents only (no file system operations)
-	_, filename, _, _ := runtime.Caller(0)
-	builtinPath := filepath.Join(filepath.Dir(filename), builtinDir)
-	
-	builtinFiles, err := os.ReadDir(builtinPath)
-	if err != nil {
-		panic(fmt.Sprintf("Failed to read builtin agents directory: %v", err))
-	}
-
-	for _, file := range builtinFiles {
-		if !file.IsDir() && (strings.HasSuffix(file.Name(), ".yaml") || strings.HasSuffix(file.Name(), ".yml")) {
-			path := filepath.Join(builtinPath, file.Name())
-			agent, err := loadAgentFile(path, true)
-			if err != nil {
-				panic(fmt.Sprintf("Failed to load built-in agent %s: %v", file.Name(), err))
-			}
-			
-			name := strings.ToLower(agent.Name)
-			cache.agents[name] = agent
-			cache.builtinOrder = append(cache.builtinOrder, name)
-			cache.lastUpdate[path] = time.Now()
-
-			if agent.IsDefault && DefaultAgent.Name == "" {
-				DefaultAgent = agent
-			}
-		}
-	}
-
-	// Set default agent if none was specified
-	if DefaultAgent.Name == "" && len(cache.agents) > 0 {
-		// Try to use the default agent if available
-		if agent, ok := cache.agents[defaultAgentName]; ok {
-			DefaultAgent = agent
-		} else {
-			// Otherwise use the first available agent
-			for _, agent := range cache.agents {
-				DefaultAgent = agent
-				break
-			}
-		}
-	}
-}
-
 // GetFormattedLabelColor returns the properly formatted ANSI color code
 func (a *AgentConfig) GetFormattedLabelColor() string {
 	return a.LabelColor
@@ -733,7 +901,7 @@ func UninstallAgent(name string) error {
 	// If this was the current agent, switch to the default agent
 	config, err := GetCurrentConfig()
 	if err == nil && strings.EqualFold(config.CurrentAgent, name) {
-		if err := UpdateCurrentAgent(DefaultAgent.Name); err != nil {
+		if err := UpdateCurrentAgent(defaultAgent.Name); err != nil {
 			return fmt.Errorf("failed to update current agent: %v", err)
 		}
 	}
@@ -0,0 +1,153 @@
+package agents
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// AgentFilePath returns the YAML file an agent is loaded from, a user-defined one before a
+// built-in one with the same name
+func AgentFilePath(name string) (string, error) {
+	userDir, err := getUserAgentsDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user agents directory: %v", err)
+	}
+	_, filename, _, _ := runtime.Caller(0)
+	builtinPath := filepath.Join(filepath.Dir(filename), builtinDir)
+
+	for _, dir := range []string{userDir, builtinPath} {
+		files, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, file := range files {
+			if file.IsDir() || !(strings.HasSuffix(file.Name(), ".yaml") || strings.HasSuffix(file.Name(), ".yml")) {
+				continue
+			}
+			path := filepath.Join(dir, file.Name())
+			data, err := os.ReadFile(path)
+			if err != nil {
+				continue
+			}
+			var fileAgent AgentConfig
+			if err := yaml.Unmarshal(data, &fileAgent); err != nil {
+				continue
+			}
+			if strings.EqualFold(fileAgent.Name, name) {
+				return path, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("agent file for '%s' not found", name)
+}
+
+// UserAgentPath returns the file an agent with the name is saved to in the user's agents directory
+func UserAgentPath(name string) (string, error) {
+	userDir, err := getUserAgentsDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get user agents directory: %v", err)
+	}
+	filename := strings.ToLower(strings.ReplaceAll(name, " ", "_")) + ".yaml"
+	return filepath.Join(userDir, filename), nil
+}
+
+// CloneAgent copies an agent's YAML to a new user-defined agent with another name, keeping
+// everything else in it, comments included. It returns the path of the new file
+func CloneAgent(name, newName string) (string, error) {
+	newName = strings.TrimSpace(newName)
+	if err := checkAgentName(newName); err != nil {
+		return "", err
+	}
+	if IsValidAgent(newName) {
+		return "", fmt.Errorf("an agent named '%s' already exists", GetAgentConfig(newName).Name)
+	}
+
+	sourcePath, err := AgentFilePath(name)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read agent file: %v", err)
+	}
+	out, err := renameAgentYAML(data, newName, true)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse agent file %s: %v", sourcePath, err)
+	}
+
+	outputPath, err := UserAgentPath(newName)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(outputPath); err == nil {
+		return "", fmt.Errorf("an agent file already exists at %s", outputPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return "", fmt.Errorf("failed to create user agents directory: %v", err)
+	}
+	if err := os.WriteFile(outputPath, out, 0644); err != nil {
+		return "", fmt.Errorf("failed to write agent configuration: %v", err)
+	}
+
+	if err := LoadAgents(); err != nil {
+		return "", fmt.Errorf("failed to reload agents: %v", err)
+	}
+	return outputPath, nil
+}
+
+// checkAgentName reports what keeps a name from being used for an agent
+func checkAgentName(name string) error {
+	if name == "" {
+		return fmt.Errorf("the new agent needs a name")
+	}
+	if strings.ContainsAny(name, `/\`) {
+		return fmt.Errorf("agent names can't contain / or \\")
+	}
+	return nil
+}
+
+// renameAgentYAML returns agent YAML with its name line replaced and, for copies, its is_default
+// line removed, as only one agent is the default. The other lines are kept as they are, so the
+// result reads like the original
+func renameAgentYAML(data []byte, newName string, dropDefault bool) ([]byte, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("it is not a YAML mapping")
+	}
+
+	lines := strings.Split(string(data), "\n")
+	nameLine := fmt.Sprintf("name: %q", newName)
+	named := false
+	fields := doc.Content[0].Content
+	for i := len(fields) - 2; i >= 0; i -= 2 { // Backwards, so removing lines keeps earlier ones in place
+		key, value := fields[i], fields[i+1]
+		if value.Line != key.Line || (value.Kind == yaml.ScalarNode && (value.Style&(yaml.LiteralStyle|yaml.FoldedStyle)) != 0) {
+			if key.Value == "name" || key.Value == "is_default" {
+				return nil, fmt.Errorf("%s must be on a single line", key.Value)
+			}
+			continue
+		}
+		switch key.Value {
+		case "name":
+			lines[key.Line-1] = nameLine
+			named = true
+		case "is_default":
+			if !dropDefault {
+				continue
+			}
+			lines = append(lines[:key.Line-1], lines[key.Line:]...)
+		}
+	}
+	if !named {
+		lines = append([]string{nameLine}, lines...)
+	}
+	return []byte(strings.Join(lines, "\n")), nil
+}
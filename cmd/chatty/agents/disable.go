@@ -0,0 +1,68 @@
+package agents
+
+import (
+	"fmt"
+	"strings"
+)
+
+// disabledAgents returns the agents disabled in config.json, by lowercase name
+func disabledAgents() map[string]bool {
+	disabled := make(map[string]bool)
+	config, err := GetCurrentConfig()
+	if err != nil {
+		return disabled
+	}
+	for _, name := range config.DisabledAgents {
+		disabled[strings.ToLower(name)] = true
+	}
+	return disabled
+}
+
+// IsDisabled reports whether an agent is disabled, hidden from --list, --with-random and
+// selection while its file and history stay in place
+func IsDisabled(name string) bool {
+	return disabledAgents()[strings.ToLower(name)]
+}
+
+// GetEnabledAgentNames returns the names of the agents that aren't disabled
+func GetEnabledAgentNames() []string {
+	disabled := disabledAgents()
+	var names []string
+	for _, name := range GetAllAgentNames() {
+		if !disabled[name] {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// SetDisabled disables or enables an agent. Disabling the current agent selects the default
+// agent instead, which can't be disabled itself
+func SetDisabled(name string, disabled bool) error {
+	if !IsValidAgent(name) {
+		return fmt.Errorf("agent '%s' not found", name)
+	}
+	name = GetAgentConfig(name).Name
+	if disabled && strings.EqualFold(name, GetDefaultAgent().Name) {
+		return fmt.Errorf("%s is the default agent, which can't be disabled", name)
+	}
+
+	config, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	var kept []string
+	for _, other := range config.DisabledAgents {
+		if !strings.EqualFold(other, name) {
+			kept = append(kept, other)
+		}
+	}
+	if disabled {
+		kept = append(kept, name)
+		if strings.EqualFold(config.CurrentAgent, name) {
+			config.CurrentAgent = GetDefaultAgent().Name
+		}
+	}
+	config.DisabledAgents = kept
+	return writeConfigFile(config)
+}
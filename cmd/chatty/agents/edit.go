@@ -0,0 +1,33 @@
+package agents
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ParseAgentYAML parses the contents of an agent file, rejecting fields agents don't have, so
+// a misspelled one isn't silently ignored
+func ParseAgentYAML(data []byte) (AgentConfig, error) {
+	var agent AgentConfig
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&agent); err != nil {
+		if errors.Is(err, io.EOF) {
+			return AgentConfig{}, fmt.Errorf("the file is empty")
+		}
+		// Name fields as they are written in the file, rather than after the Go type
+		message := strings.ReplaceAll(err.Error(), " in type agents.AgentConfig", "")
+		message = strings.TrimPrefix(message, "yaml: ")
+		message = strings.ReplaceAll(message, "unmarshal errors:\n  ", "")
+		return AgentConfig{}, errors.New(message)
+	}
+	if agent.LanguageCode != "" && !languageCodePattern.MatchString(agent.LanguageCode) {
+		return AgentConfig{}, fmt.Errorf("language_code %q is not a language code: use one like \"fr-FR\"", agent.LanguageCode)
+	}
+	return agent, nil
+}
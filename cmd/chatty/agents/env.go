@@ -0,0 +1,158 @@
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Settings are overridden by variables named CHATTY_ and the setting in capitals, like
+	// CHATTY_MODEL or CHATTY_CONTEXT_WINDOW
+	envPrefix = "CHATTY_"
+
+	defaultOllamaURL = "http://localhost:11434"
+)
+
+// envAliases are shorter names for the variables of some settings
+var envAliases = map[string]string{
+	"current_agent": "CHATTY_AGENT",
+	"language_code": "CHATTY_LANGUAGE",
+}
+
+// EnvError is a variable overriding a setting with a value of the wrong type
+type EnvError struct {
+	Variable string
+	Message  string
+}
+
+func (e *EnvError) Error() string {
+	return e.Message
+}
+
+// envSetting returns the variable set for a setting and its value. The alias of a setting is
+// looked up first, then the full name. The version of config.json has no variable
+func envSetting(key string) (string, string, bool) {
+	if key == "" || key == configVersionKey {
+		return "", "", false
+	}
+	names := []string{envPrefix + strings.ToUpper(key)}
+	if alias, ok := envAliases[key]; ok {
+		names = append([]string{alias}, names...)
+	}
+	for _, name := range names {
+		if value := strings.TrimSpace(os.Getenv(name)); value != "" {
+			return name, value, true
+		}
+	}
+	return "", "", false
+}
+
+// applyEnv overrides the settings of config with the variables set for them
+func applyEnv(config *Config) error {
+	v := reflect.ValueOf(config).Elem()
+	for i := 0; i < v.NumField(); i++ {
+		key := settingKey(v.Type().Field(i))
+		name, value, ok := envSetting(key)
+		if !ok {
+			continue
+		}
+		parsed, err := parseEnvValue(v.Field(i).Type(), value)
+		if err != nil {
+			return &EnvError{Variable: name, Message: fmt.Sprintf("%s must be %s, not %q", name, describeEnvType(v.Field(i).Type()), value)}
+		}
+		v.Field(i).Set(parsed)
+	}
+	return nil
+}
+
+// parseEnvValue reads the value of a variable as a setting of type t. Lists are separated by
+// commas, and lists and objects can be written in JSON as well
+func parseEnvValue(t reflect.Type, value string) (reflect.Value, error) {
+	parsed := reflect.New(t)
+	switch t.Kind() {
+	case reflect.String:
+		parsed.Elem().SetString(value)
+	case reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return reflect.Value{}, err
+		}
+		parsed.Elem().SetInt(int64(n))
+	case reflect.Bool:
+		switch strings.ToLower(value) {
+		case "1", "true", "yes", "y", "on":
+			parsed.Elem().SetBool(true)
+		case "0", "false", "no", "n", "off":
+			parsed.Elem().SetBool(false)
+		default:
+			return reflect.Value{}, fmt.Errorf("not a boolean: %s", value)
+		}
+	case reflect.Slice:
+		if strings.HasPrefix(value, "[") {
+			if err := json.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+				return reflect.Value{}, err
+			}
+			break
+		}
+		items := reflect.MakeSlice(t, 0, 0)
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = reflect.Append(items, reflect.ValueOf(item))
+			}
+		}
+		parsed.Elem().Set(items)
+	default:
+		if err := json.Unmarshal([]byte(value), parsed.Interface()); err != nil {
+			return reflect.Value{}, err
+		}
+	}
+	return parsed.Elem(), nil
+}
+
+// describeEnvType names the kind of value a variable takes
+func describeEnvType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.Bool:
+		return "true or false (or 1 and 0, yes and no, on and off)"
+	case reflect.Map:
+		return "a JSON object whose values are " + describeType(t.Elem())
+	}
+	return describeType(t)
+}
+
+// CheckEnv reports the variables overriding settings with values chatty can't use, like an
+// unknown theme, the way CheckConfig does for config.json
+func CheckEnv() []string {
+	var problems []string
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		key := settingKey(t.Field(i))
+		name, value, ok := envSetting(key)
+		if !ok {
+			continue
+		}
+		// Values of the wrong type keep the config from loading, so they are reported then
+		parsed, err := parseEnvValue(t.Field(i).Type, value)
+		if err != nil {
+			continue
+		}
+		if message := checkValue(key, parsed.Interface()); message != "" {
+			problems = append(problems, fmt.Sprintf("%s: %s", name, message))
+		}
+	}
+	return problems
+}
+
+// OllamaURL returns the address of the Ollama server, from CHATTY_OLLAMA_URL or ollama_url in
+// config.json, or the local one
+func OllamaURL() string {
+	config, err := GetCurrentConfig()
+	if err != nil || config.OllamaURL == "" {
+		return defaultOllamaURL
+	}
+	return strings.TrimRight(config.OllamaURL, "/")
+}
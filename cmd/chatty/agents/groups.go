@@ -0,0 +1,80 @@
+package agents
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// GroupPrefix marks a group name among agent names, as in chatty --with @scientists
+const GroupPrefix = "@"
+
+// ExpandGroups replaces the @group names among agent names with the agents of the groups in
+// config.json, keeping the order given. Agents already named, in the list or an earlier group,
+// aren't added again
+func ExpandGroups(names []string) ([]string, error) {
+	var groups map[string][]string
+	var expanded []string
+	seen := make(map[string]bool)
+	for _, name := range names {
+		if !strings.HasPrefix(name, GroupPrefix) {
+			seen[strings.ToLower(name)] = true
+		}
+	}
+
+	for _, name := range names {
+		if !strings.HasPrefix(name, GroupPrefix) {
+			expanded = append(expanded, name)
+			continue
+		}
+		if groups == nil {
+			config, err := GetCurrentConfig()
+			if err != nil {
+				return nil, err
+			}
+			groups = config.AgentGroups
+		}
+		members, ok := lookupGroup(groups, strings.TrimPrefix(name, GroupPrefix))
+		if !ok {
+			return nil, fmt.Errorf("no agent group named '%s' in config.json", strings.TrimPrefix(name, GroupPrefix))
+		}
+		if len(members) == 0 {
+			return nil, fmt.Errorf("agent group '%s' has no agents", strings.TrimPrefix(name, GroupPrefix))
+		}
+		for _, member := range members {
+			member = strings.TrimSpace(member)
+			if key := strings.ToLower(member); member != "" && !seen[key] {
+				seen[key] = true
+				expanded = append(expanded, member)
+			}
+		}
+	}
+	return expanded, nil
+}
+
+// GroupNames returns the names of the agent groups in config.json, sorted
+func GroupNames() []string {
+	config, err := GetCurrentConfig()
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(config.AgentGroups))
+	for name := range config.AgentGroups {
+		names = append(names, strings.TrimPrefix(name, GroupPrefix))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupGroup finds a group by name, ignoring case and an @ the group is named with in config.json
+func lookupGroup(groups map[string][]string, name string) ([]string, bool) {
+	if members, ok := groups[name]; ok {
+		return members, true
+	}
+	for groupName, members := range groups {
+		if strings.EqualFold(strings.TrimPrefix(groupName, GroupPrefix), name) {
+			return members, true
+		}
+	}
+	return nil, false
+}
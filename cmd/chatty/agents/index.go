@@ -0,0 +1,109 @@
+package agents
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"chatty/cmd/chatty/appdir"
+	"chatty/cmd/chatty/atomicfile"
+)
+
+// Index of parsed agent files, kept in the history directory
+const indexFileName = "agent_index.json"
+
+// agentIndex caches agent files as parsed, so agents load without parsing every YAML file on
+// each run. An entry is used while its file keeps the same modification time and size
+type agentIndex struct {
+	Format string                  `json:"format"`
+	Files  map[string]indexedAgent `json:"files"` // By path
+}
+
+// indexedAgent is an agent file as it was when parsed
+type indexedAgent struct {
+	ModTime time.Time   `json:"mod_time"`
+	Size    int64       `json:"size"`
+	Agent   AgentConfig `json:"agent"`
+}
+
+// indexFormat describes the fields of AgentConfig, so an index written before they changed isn't used
+func indexFormat() string {
+	var fields []string
+	t := reflect.TypeOf(AgentConfig{})
+	for i := 0; i < t.NumField(); i++ {
+		fields = append(fields, fmt.Sprintf("%s:%s", t.Field(i).Name, t.Field(i).Type))
+	}
+	return strings.Join(fields, ",")
+}
+
+// getIndexPath returns where the agent index is kept
+func getIndexPath() (string, error) {
+	dataDir, err := appdir.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, indexFileName), nil
+}
+
+// readAgentIndex returns the saved agent index, an empty one when there is none or it can't be used
+func readAgentIndex() agentIndex {
+	empty := agentIndex{Format: indexFormat(), Files: make(map[string]indexedAgent)}
+	path, err := getIndexPath()
+	if err != nil {
+		return empty
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return empty
+	}
+	var index agentIndex
+	if err := json.Unmarshal(data, &index); err != nil || index.Format != empty.Format || index.Files == nil {
+		return empty
+	}
+	return index
+}
+
+// lookup returns the agent parsed from a file, when it hasn't changed since
+func (i agentIndex) lookup(path string, info os.FileInfo) (AgentConfig, bool) {
+	entry, ok := i.Files[path]
+	if !ok || !entry.ModTime.Equal(info.ModTime()) || entry.Size != info.Size() {
+		return AgentConfig{}, false
+	}
+	return entry.Agent, true
+}
+
+// save writes the index, whole, so runs reading it at the same time never see part of it. The
+// index is only a cache, so failing to save it isn't an error
+func (i agentIndex) save() {
+	path, err := getIndexPath()
+	if err != nil {
+		return
+	}
+	data, err := json.Marshal(i)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return
+	}
+	atomicfile.WriteFile(path, data, 0644)
+}
+
+// loadIndexed returns the agent of a file, from index when the file hasn't changed since it was
+// parsed, and adds it to next. It reports whether the file was parsed into a new entry
+func loadIndexed(index, next agentIndex, path string, info os.FileInfo, isBuiltin bool) (AgentConfig, bool, error) {
+	if agent, ok := index.lookup(path, info); ok {
+		next.Files[path] = index.Files[path]
+		return agent, false, nil
+	}
+	agent, err := loadAgentFile(path, isBuiltin)
+	if err != nil {
+		return AgentConfig{}, false, err
+	}
+	next.Files[path] = indexedAgent{ModTime: info.ModTime(), Size: info.Size(), Agent: agent}
+	return agent, true, nil
+}
@@ -0,0 +1,16 @@
+package agents
+
+import "fmt"
+
+// runLanguage is the language chosen for this run with --lang, over language_code in config.json
+// and in the agents' files
+var runLanguage string
+
+// UseLanguage makes every agent reply in a language for this run
+func UseLanguage(code string) error {
+	if !languageCodePattern.MatchString(code) {
+		return fmt.Errorf("'%s' is not a language code: use one like en-US or pt-BR", code)
+	}
+	runLanguage = code
+	return nil
+}
@@ -0,0 +1,114 @@
+package agents
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"chatty/cmd/chatty/appdir"
+	"chatty/cmd/chatty/atomicfile"
+)
+
+const configVersionKey = "config_version"
+
+// configMigration brings the settings of config.json from one version of the schema to the next
+type configMigration struct {
+	Description string
+	Apply       func(settings map[string]json.RawMessage)
+}
+
+// configMigrations are the changes to the schema of config.json, in order. A file's
+// config_version is how many of them it has been through. Each must change nothing when applied
+// to settings that don't need it
+var configMigrations = []configMigration{
+	{"current_assistant is now current_agent", renameSetting("current_assistant", "current_agent")},
+}
+
+// ConfigVersion is the version of the schema of config.json this chatty writes
+var ConfigVersion = len(configMigrations)
+
+// renameSetting returns a migration moving a setting to a new name. A value already under the
+// new name wins
+func renameSetting(from, to string) func(map[string]json.RawMessage) {
+	return func(settings map[string]json.RawMessage) {
+		value, ok := settings[from]
+		if !ok {
+			return
+		}
+		delete(settings, from)
+		if _, exists := settings[to]; !exists {
+			settings[to] = value
+		}
+	}
+}
+
+// ConfigMigration is what MigrateConfigFile did to config.json
+type ConfigMigration struct {
+	From, To int      // Versions of the schema before and after
+	Changes  []string // Descriptions of the migrations applied
+	Backup   string   // Copy of the file as it was
+}
+
+// MigrateConfigFile brings config.json up to date with the current schema, backing up the file
+// first. It returns nil when there was nothing to do
+func MigrateConfigFile() (*ConfigMigration, error) {
+	configDir, err := appdir.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(configDir, "config.json")
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var settings map[string]json.RawMessage
+	if err := json.Unmarshal(data, &settings); err != nil || settings == nil {
+		// Not loadable at all, which loading the config reports with the lines to fix
+		return nil, nil
+	}
+	version := 0
+	if raw, ok := settings[configVersionKey]; ok {
+		if err := json.Unmarshal(raw, &version); err != nil || version < 0 {
+			return nil, fmt.Errorf("config_version in config.json must be a whole number, not %s", raw)
+		}
+	}
+	if version > ConfigVersion {
+		return nil, fmt.Errorf("config.json was written by a newer version of chatty (config_version %d, this one knows up to %d): upgrade chatty, or restore a backup of config.json", version, ConfigVersion)
+	}
+	if version == ConfigVersion {
+		return nil, nil
+	}
+
+	migration := &ConfigMigration{From: version, To: ConfigVersion, Backup: fmt.Sprintf("%s.v%d.bak", path, version)}
+	for _, step := range configMigrations[version:] {
+		before, _ := json.Marshal(settings)
+		step.Apply(settings)
+		if after, _ := json.Marshal(settings); !bytes.Equal(before, after) {
+			migration.Changes = append(migration.Changes, step.Description)
+		}
+	}
+	// A file the migrations don't change is left as it is. They change nothing the second time,
+	// so it is fine to run them again
+	if len(migration.Changes) == 0 {
+		return nil, nil
+	}
+	settings[configVersionKey] = json.RawMessage(fmt.Sprint(ConfigVersion))
+
+	if err := atomicfile.WriteFile(migration.Backup, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to back up config.json: %v", err)
+	}
+	data, err = json.MarshalIndent(settings, "", "    ")
+	if err != nil {
+		return nil, err
+	}
+	if err := atomicfile.WriteFile(path, data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to update config.json: %v", err)
+	}
+	return migration, nil
+}
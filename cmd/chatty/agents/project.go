@@ -0,0 +1,104 @@
+package agents
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectFileName is the project configuration, found in the working directory or a parent
+const ProjectFileName = ".chatty.yaml"
+
+// ProjectConfig tailors chatty to a project: the settings it gives win over config.json, and
+// environment variables over them
+type ProjectConfig struct {
+	Agent         string `yaml:"agent,omitempty"`          // Agent chatted with when none is named
+	Model         string `yaml:"model,omitempty"`          // Model every agent uses
+	KnowledgeBase string `yaml:"knowledge_base,omitempty"` // Knowledge base searched in every chat
+	Guidelines    string `yaml:"guidelines,omitempty"`     // Added to the base guidelines of all agents
+
+	Path string `yaml:"-"` // Where the file was found
+}
+
+var (
+	projectOnce   sync.Once
+	projectConfig *ProjectConfig
+	projectErr    error
+)
+
+// GetProjectConfig returns the .chatty.yaml closest to the working directory, or nil when there
+// is none. It is read once, since the working directory doesn't change
+func GetProjectConfig() (*ProjectConfig, error) {
+	projectOnce.Do(func() {
+		dir, err := os.Getwd()
+		if err != nil {
+			return
+		}
+		path := findProjectFile(dir)
+		if path == "" {
+			return
+		}
+		projectConfig, projectErr = LoadProjectConfig(path)
+	})
+	return projectConfig, projectErr
+}
+
+// findProjectFile returns the .chatty.yaml in dir or the closest parent, or empty
+func findProjectFile(dir string) string {
+	for {
+		path := filepath.Join(dir, ProjectFileName)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ""
+		}
+		dir = parent
+	}
+}
+
+// LoadProjectConfig reads a project configuration, rejecting settings it doesn't know
+func LoadProjectConfig(path string) (*ProjectConfig, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	project := &ProjectConfig{Path: path}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(project); err != nil && !errors.Is(err, io.EOF) {
+		message := strings.ReplaceAll(err.Error(), " in type agents.ProjectConfig", "")
+		message = strings.TrimPrefix(message, "yaml: ")
+		message = strings.ReplaceAll(message, "unmarshal errors:\n  ", "")
+		return nil, fmt.Errorf("failed to parse %s: %s (settings: agent, model, knowledge_base, guidelines)", path, message)
+	}
+	project.Agent = strings.TrimSpace(project.Agent)
+	project.Model = strings.TrimSpace(project.Model)
+	project.KnowledgeBase = strings.TrimSpace(project.KnowledgeBase)
+	project.Guidelines = strings.TrimSpace(project.Guidelines)
+	return project, nil
+}
+
+// applyProject overrides the settings of config with the ones the project gives
+func applyProject(config *Config, project *ProjectConfig) {
+	if project.Agent != "" {
+		config.CurrentAgent = project.Agent
+	}
+	if project.Model != "" {
+		config.Model = project.Model
+	}
+	if project.KnowledgeBase != "" {
+		config.KnowledgeBase = project.KnowledgeBase
+	}
+	if project.Guidelines != "" {
+		config.BaseGuidelines = strings.TrimSpace(config.BaseGuidelines + "\n\n" + project.Guidelines)
+	}
+}
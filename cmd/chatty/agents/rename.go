@@ -0,0 +1,118 @@
+package agents
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"chatty/cmd/chatty/atomicfile"
+)
+
+// RenameAgent gives a user-defined agent a new name. Its YAML is saved under the new name and
+// the settings in config.json naming it, like current_agent, follow. When the settings can't be
+// saved the YAML is put back. It returns the path of the renamed file
+func RenameAgent(name, newName string) (string, error) {
+	newName = strings.TrimSpace(newName)
+	if err := CheckRename(name, newName); err != nil {
+		return "", err
+	}
+	agent := GetAgentConfig(name)
+
+	sourcePath, err := AgentFilePath(agent.Name)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read agent file: %v", err)
+	}
+	out, err := renameAgentYAML(data, newName, false)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse agent file %s: %v", sourcePath, err)
+	}
+
+	outputPath, err := UserAgentPath(newName)
+	if err != nil {
+		return "", err
+	}
+	if outputPath != sourcePath {
+		if _, err := os.Stat(outputPath); err == nil {
+			return "", fmt.Errorf("an agent file already exists at %s", outputPath)
+		}
+	}
+	if err := atomicfile.WriteFile(outputPath, out, 0644); err != nil {
+		return "", fmt.Errorf("failed to write agent configuration: %v", err)
+	}
+
+	if err := renameInConfig(agent.Name, newName); err != nil {
+		if outputPath != sourcePath {
+			os.Remove(outputPath)
+		} else {
+			atomicfile.WriteFile(sourcePath, data, 0644)
+		}
+		return "", fmt.Errorf("failed to update config.json: %v", err)
+	}
+	if outputPath != sourcePath {
+		os.Remove(sourcePath)
+	}
+
+	if err := LoadAgents(); err != nil {
+		return "", fmt.Errorf("failed to reload agents: %v", err)
+	}
+	return outputPath, nil
+}
+
+// CheckRename reports what keeps an agent from being renamed
+func CheckRename(name, newName string) error {
+	if err := checkAgentName(strings.TrimSpace(newName)); err != nil {
+		return err
+	}
+	if !IsValidAgent(name) {
+		return fmt.Errorf("agent '%s' not found", name)
+	}
+	agent := GetAgentConfig(name)
+	if agent.Source == "built-in" {
+		return fmt.Errorf("%s is a built-in agent, which can't be renamed: make a copy with chatty --clone instead", agent.Name)
+	}
+	if IsValidAgent(newName) && !strings.EqualFold(strings.TrimSpace(newName), agent.Name) {
+		return fmt.Errorf("an agent named '%s' already exists", GetAgentConfig(newName).Name)
+	}
+	return nil
+}
+
+// renameInConfig points the settings naming an agent to its new name, leaving config.json as
+// it is when none do
+func renameInConfig(name, newName string) error {
+	config, err := readConfigFile()
+	if err != nil {
+		return err
+	}
+	changed := false
+	rename := func(value *string) {
+		if strings.EqualFold(*value, name) {
+			*value = newName
+			changed = true
+		}
+	}
+
+	rename(&config.CurrentAgent)
+	for i := range config.DisabledAgents {
+		rename(&config.DisabledAgents[i])
+	}
+	for _, members := range config.AgentGroups {
+		for i := range members {
+			rename(&members[i])
+		}
+	}
+	for key, permissions := range config.AgentToolPermissions {
+		if strings.EqualFold(key, name) {
+			delete(config.AgentToolPermissions, key)
+			config.AgentToolPermissions[newName] = permissions
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return writeConfigFile(config)
+}
@@ -0,0 +1,111 @@
+package agents
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Style is a preset of base guidelines, chosen for a run with --style instead of editing
+// base_guidelines in config.json
+type Style struct {
+	Name        string
+	Description string
+	Guidelines  string // Numbered like the base guidelines, which the mode guidelines continue
+}
+
+// styles are the presets, by name
+var styles = map[string]Style{
+	"concise": {"concise", "Short, direct answers without small talk", `1. Always follow the specified language instruction above
+2. Answer in as few words as the question allows, usually one to three sentences
+3. Lead with the answer, then add only the detail that is needed
+4. Skip greetings, filler and restating the question
+5. Provide accurate information and say briefly when you are unsure
+6. Ask a question only when you can't answer without it
+7. Always stick to the topic proposed by the user and do not deviate from it
+8. Always speak in first person (use "I", "my", "me") - never refer to yourself in third person
+9. Address others by name when responding to them
+10. Stay in character according to your role and expertise
+11. Build upon previous messages and maintain conversation flow
+`},
+	"formal": {"formal", "Polite, professional language, as in business writing", `1. Always follow the specified language instruction above
+2. Use a formal, professional register: no slang, contractions or emojis
+3. Be courteous and measured, as in correspondence with a colleague you respect
+4. Structure longer answers clearly, with complete sentences
+5. Provide accurate information and state any uncertainty plainly
+6. Ask clarifying questions when a request is ambiguous
+7. Always stick to the topic proposed by the user and do not deviate from it
+8. Always speak in first person (use "I", "my", "me") - never refer to yourself in third person
+9. Address others by name when responding to them
+10. Stay in character according to your role and expertise
+11. Build upon previous messages and maintain conversation flow
+`},
+	"verbose": {"verbose", "Thorough answers with explanations and examples", `1. Always follow the specified language instruction above
+2. Give thorough, detailed answers that cover the reasoning behind them
+3. Explain concepts step by step and illustrate them with examples
+4. Mention related ideas, caveats and alternatives worth knowing
+5. Provide accurate information and acknowledge uncertainty
+6. Ask questions when needed
+7. Always stick to the topic proposed by the user and do not deviate from it
+8. Always speak in first person (use "I", "my", "me") - never refer to yourself in third person
+9. Address others by name when responding to them
+10. Stay in character according to your role and expertise
+11. Build upon previous messages and maintain conversation flow
+`},
+	"eli5": {"eli5", "Simple explanations anyone could follow, like to a five-year-old", `1. Always follow the specified language instruction above
+2. Explain things as you would to a curious five-year-old
+3. Use short sentences, everyday words and no jargon
+4. Compare ideas to familiar things, like toys, food or games
+5. Keep it accurate: simplify, but never say something that is wrong
+6. Check that the explanation made sense and offer to go further
+7. Always stick to the topic proposed by the user and do not deviate from it
+8. Always speak in first person (use "I", "my", "me") - never refer to yourself in third person
+9. Address others by name when responding to them
+10. Stay in character according to your role and expertise
+11. Build upon previous messages and maintain conversation flow
+`},
+}
+
+// activeStyle is the preset chosen for this run, empty for the configured guidelines
+var activeStyle string
+
+// UseStyle swaps the base guidelines for a preset for this run
+func UseStyle(name string) error {
+	style, ok := styles[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown style '%s' (styles: %s)", name, strings.Join(StyleNames(), ", "))
+	}
+	activeStyle = style.Name
+	return nil
+}
+
+// Styles returns the presets, sorted by name
+func Styles() []Style {
+	list := make([]Style, 0, len(styles))
+	for _, name := range StyleNames() {
+		list = append(list, styles[name])
+	}
+	return list
+}
+
+// StyleNames returns the names of the presets, sorted
+func StyleNames() []string {
+	names := make([]string, 0, len(styles))
+	for name := range styles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// applyStyle replaces the base guidelines with the preset chosen for this run, keeping the
+// project's own guidelines
+func applyStyle(config *Config, project *ProjectConfig) {
+	if activeStyle == "" {
+		return
+	}
+	config.BaseGuidelines = styles[activeStyle].Guidelines
+	if project != nil && project.Guidelines != "" {
+		config.BaseGuidelines = strings.TrimSpace(config.BaseGuidelines + "\n\n" + project.Guidelines)
+	}
+}
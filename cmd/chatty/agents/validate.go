@@ -0,0 +1,314 @@
+package agents
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"chatty/cmd/chatty/animation"
+	"chatty/cmd/chatty/appdir"
+	"chatty/cmd/chatty/elapsed"
+	"chatty/cmd/chatty/keys"
+	"chatty/cmd/chatty/secrets"
+	"chatty/cmd/chatty/speech"
+	"chatty/cmd/chatty/suggest"
+	"chatty/cmd/chatty/theme"
+	"chatty/cmd/chatty/tools"
+)
+
+// Language codes like "en", "en-US" or "zh-Hant-TW"
+var languageCodePattern = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// ConfigProblem is something wrong with a setting in config.json
+type ConfigProblem struct {
+	Line    int    // Where the setting is, counting from 1
+	Column  int    // Also counting from 1
+	Key     string // The setting, empty for problems with the file as a whole
+	Message string
+	Warning bool // The setting is ignored or has no effect, but the rest of the file can be used
+}
+
+func (p ConfigProblem) String() string {
+	return fmt.Sprintf("line %d, column %d: %s", p.Line, p.Column, p.Message)
+}
+
+// ConfigError is a config.json that can't be loaded, with the problems found in it
+type ConfigError struct {
+	Problems []ConfigProblem
+}
+
+func (e *ConfigError) Error() string {
+	var sb strings.Builder
+	sb.WriteString("config.json has errors:")
+	for _, problem := range e.Problems {
+		sb.WriteString("\n  " + problem.String())
+	}
+	return sb.String()
+}
+
+// CheckConfigFile checks ~/.chatty/config.json, which is fine when it doesn't exist
+func CheckConfigFile() ([]ConfigProblem, error) {
+	configDir, err := appdir.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(configDir, "config.json"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return CheckConfig(data), nil
+}
+
+// CheckConfig reports what is wrong in the contents of a config.json: syntax errors and values
+// of the wrong type, which keep it from loading, and unknown settings and invalid values, which
+// are warnings
+func CheckConfig(data []byte) []ConfigProblem {
+	fields := configFields()
+	var problems []ConfigProblem
+	at := func(offset int64, key, message string, warning bool) {
+		line, column := position(data, offset)
+		problems = append(problems, ConfigProblem{Line: line, Column: column, Key: key, Message: message, Warning: warning})
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		at(valueStart(data, 0), "", "the settings must be an object, starting with {", false)
+		return problems
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			at(syntaxOffset(err, decoder), "", syntaxMessage(err), false)
+			return problems
+		}
+		key := token.(string)
+		keyEnd := decoder.InputOffset()
+
+		var raw json.RawMessage
+		if err := decoder.Decode(&raw); err != nil {
+			at(syntaxOffset(err, decoder), key, syntaxMessage(err), false)
+			return problems
+		}
+		start := valueStart(data, keyEnd)
+
+		field, ok := fields[key]
+		if _, secret := secrets.Find(key); !ok && secret {
+			// Kept out of config.json, where anyone who can read the file would see it
+			at(keyEnd-int64(len(key))-2, key, fmt.Sprintf("%q is a secret, which is ignored here: store it in the system keyring with chatty config set-secret %s and remove it from config.json", key, key), true)
+			continue
+		}
+		if !ok {
+			message := fmt.Sprintf("unknown setting %q, which is ignored", key)
+			if suggestion := suggest.Closest(key, fieldNames(fields)); suggestion != "" {
+				message += fmt.Sprintf(" (did you mean %q?)", suggestion)
+			}
+			at(keyEnd-int64(len(key))-2, key, message, true)
+			continue
+		}
+
+		value := reflect.New(field)
+		if err := json.Unmarshal(raw, value.Interface()); err != nil {
+			at(start, key, fmt.Sprintf("%q must be %s, not %s", key, describeType(field), describeValue(raw)), false)
+			continue
+		}
+		if message := checkValue(key, value.Elem().Interface()); message != "" {
+			at(start, key, message, true)
+		}
+	}
+	if _, err := decoder.Token(); err != nil {
+		at(syntaxOffset(err, decoder), "", syntaxMessage(err), false)
+	} else if _, err := decoder.Token(); err != io.EOF {
+		at(syntaxOffset(err, decoder), "", "there is more after the closing }", false)
+	}
+	return problems
+}
+
+// checkValue returns what is wrong with the value of a setting, empty when it is valid
+func checkValue(key string, value any) string {
+	oneOf := func(value string, allowed []string) string {
+		for _, name := range allowed {
+			if value == name {
+				return ""
+			}
+		}
+		return fmt.Sprintf("%q is not valid for %s: use %s", value, key, strings.Join(allowed, ", "))
+	}
+
+	switch key {
+	case "language_code", "display_language":
+		if code := value.(string); code != "" && !languageCodePattern.MatchString(code) {
+			return fmt.Sprintf("%q is not a language code: use one like \"en-US\" or \"pt-BR\"", code)
+		}
+	case "theme":
+		if name := value.(string); name != "" {
+			return oneOf(strings.ToLower(name), theme.Names())
+		}
+	case "duration_format":
+		if name := value.(string); name != "" {
+			return oneOf(name, elapsed.Styles)
+		}
+	case "animation":
+		if name := value.(string); name != "" {
+			return oneOf(name, animation.Styles)
+		}
+	case "animation_delay":
+		if value.(int) < 0 {
+			return "animation_delay can't be negative"
+		}
+	case "keybindings":
+		if err := keys.Check(value.(map[string][]string)); err != nil {
+			return err.Error()
+		}
+	case "tts_engine":
+		if name := value.(string); name != "" {
+			return oneOf(name, speech.Engines)
+		}
+	case "search_engine":
+		if name := value.(string); name != "" {
+			return oneOf(name, []string{tools.SearchDuckDuckGo, tools.SearchSearxNG})
+		}
+	case "code_interpreter":
+		if name := value.(string); name != "" {
+			return oneOf(name, []string{tools.SandboxAuto, tools.SandboxContainer, tools.SandboxLocal})
+		}
+	case "ollama_url":
+		if url := value.(string); url != "" && !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+			return fmt.Sprintf("%q is not a URL: use one like \"http://localhost:11434\"", url)
+		}
+	case "context_window":
+		if value.(int) < 0 {
+			return "context_window can't be negative"
+		}
+	case "tool_permissions":
+		for tool, permission := range value.(map[string]string) {
+			if message := oneOf(permission, []string{tools.PermissionAllow, tools.PermissionDeny, tools.PermissionAsk}); message != "" {
+				return fmt.Sprintf("%s (for %s)", message, tool)
+			}
+		}
+	case "agent_tool_permissions":
+		for agent, permissions := range value.(map[string]map[string]string) {
+			for tool, permission := range permissions {
+				if message := oneOf(permission, []string{tools.PermissionAllow, tools.PermissionDeny, tools.PermissionAsk}); message != "" {
+					return fmt.Sprintf("%s (for %s of %s)", message, tool, agent)
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// configFields returns the types of the settings in Config, by key
+func configFields() map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	t := reflect.TypeOf(Config{})
+	for i := 0; i < t.NumField(); i++ {
+		if name := settingKey(t.Field(i)); name != "" {
+			fields[name] = t.Field(i).Type
+		}
+	}
+	return fields
+}
+
+// settingKey returns the key of a setting in config.json, empty for fields that aren't saved
+func settingKey(field reflect.StructField) string {
+	name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+	if name == "-" {
+		return ""
+	}
+	return name
+}
+
+// fieldNames returns the keys of the settings
+func fieldNames(fields map[string]reflect.Type) []string {
+	names := make([]string, 0, len(fields))
+	for name := range fields {
+		names = append(names, name)
+	}
+	return names
+}
+
+// describeType names the kind of value a setting takes
+func describeType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "text"
+	case reflect.Int:
+		return "a whole number"
+	case reflect.Bool:
+		return "true or false"
+	case reflect.Slice:
+		return "a list of " + strings.TrimPrefix(describeType(t.Elem()), "a ")
+	case reflect.Map:
+		return "an object whose values are " + describeType(t.Elem())
+	}
+	return t.String()
+}
+
+// describeValue names the kind of a JSON value
+func describeValue(raw json.RawMessage) string {
+	switch raw[0] {
+	case '"':
+		return "text"
+	case '{':
+		return "an object"
+	case '[':
+		return "a list"
+	case 't', 'f':
+		return "true or false"
+	case 'n':
+		return "null"
+	}
+	return "the number " + string(raw)
+}
+
+// valueStart returns the offset of the first value after offset, skipping spaces and a colon
+func valueStart(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) && strings.ContainsRune(" \t\r\n:", rune(data[offset])) {
+		offset++
+	}
+	return offset
+}
+
+// syntaxOffset returns where the decoder ran into a syntax error
+func syntaxOffset(err error, decoder *json.Decoder) int64 {
+	var syntaxErr *json.SyntaxError
+	if errors.As(err, &syntaxErr) {
+		return syntaxErr.Offset
+	}
+	return decoder.InputOffset()
+}
+
+// syntaxMessage describes a syntax error with what most likely causes it
+func syntaxMessage(err error) string {
+	message := err.Error()
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) || strings.Contains(message, "unexpected end"):
+		return "the file ends too early: check for a missing } or \""
+	case strings.Contains(message, "after object key:value pair"):
+		return "a comma is missing at the end of the setting before this one"
+	case strings.Contains(message, "after object key"):
+		return "a colon is missing between the setting and its value"
+	}
+	return message + " (check for a missing comma or quote)"
+}
+
+// position converts an offset into data to a line and a column
+func position(data []byte, offset int64) (int, int) {
+	if offset > int64(len(data)) {
+		offset = int64(len(data))
+	}
+	before := data[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
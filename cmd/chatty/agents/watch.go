@@ -0,0 +1,111 @@
+package agents
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"time"
+
+	"chatty/cmd/chatty/appdir"
+)
+
+// Changes is what was edited in config.json and the agents since a Watcher last checked
+type Changes struct {
+	Config  bool     // config.json was saved
+	Model   string   // Model now in use, when it changed
+	Err     error    // config.json can't be loaded as it is now, so the settings stay as they were
+	Added   []string // Names of new agents
+	Removed []string
+	Updated []string // Agents whose files were edited
+}
+
+// Empty reports whether nothing changed
+func (c Changes) Empty() bool {
+	return !c.Config && len(c.Added) == 0 && len(c.Removed) == 0 && len(c.Updated) == 0
+}
+
+// Watcher notices edits to config.json and the agents while chatty keeps running, so long chats
+// and servers can pick them up without a restart. It checks when asked, like agents are reloaded
+type Watcher struct {
+	config fileStamp
+	model  string
+	agents map[string]AgentConfig
+}
+
+// fileStamp tells versions of a file apart
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewWatcher starts watching from the current config.json and agents
+func NewWatcher() *Watcher {
+	refreshIfNeeded()
+	return &Watcher{config: configStamp(), model: GetCurrentModel(), agents: agentSnapshot()}
+}
+
+// Check reports what changed since the last check, reloading the agents if their files did
+func (w *Watcher) Check() Changes {
+	var changes Changes
+	if stamp := configStamp(); stamp != w.config {
+		w.config = stamp
+		changes.Config = true
+		if _, err := GetCurrentConfig(); err != nil {
+			changes.Err = err
+		} else if model := GetCurrentModel(); model != w.model {
+			w.model = model
+			changes.Model = model
+		}
+	}
+
+	if checkForUpdates() {
+		if err := LoadAgents(); err != nil {
+			// Agents stay as they were, as with any failed reload
+			return changes
+		}
+	}
+	current := agentSnapshot()
+	for key, agent := range current {
+		previous, ok := w.agents[key]
+		if !ok {
+			changes.Added = append(changes.Added, agent.Name)
+		} else if !reflect.DeepEqual(previous, agent) {
+			changes.Updated = append(changes.Updated, agent.Name)
+		}
+	}
+	for key, agent := range w.agents {
+		if _, ok := current[key]; !ok {
+			changes.Removed = append(changes.Removed, agent.Name)
+		}
+	}
+	w.agents = current
+	sort.Strings(changes.Added)
+	sort.Strings(changes.Removed)
+	sort.Strings(changes.Updated)
+	return changes
+}
+
+// configStamp returns the version of config.json there is now, the zero stamp when there is none
+func configStamp() fileStamp {
+	configDir, err := appdir.ConfigDir()
+	if err != nil {
+		return fileStamp{}
+	}
+	info, err := os.Stat(filepath.Join(configDir, "config.json"))
+	if err != nil {
+		return fileStamp{}
+	}
+	return fileStamp{modTime: info.ModTime(), size: info.Size()}
+}
+
+// agentSnapshot copies the loaded agents, by lowercase name
+func agentSnapshot() map[string]AgentConfig {
+	cache.mutex.RLock()
+	defer cache.mutex.RUnlock()
+	snapshot := make(map[string]AgentConfig, len(cache.agents))
+	for key, agent := range cache.agents {
+		snapshot[key] = agent
+	}
+	return snapshot
+}
@@ -0,0 +1,31 @@
+// Package animation has the styles of the animation shown after an agent's label while its
+// response is on the way
+package animation
+
+import "time"
+
+// Styles of animation
+const (
+	Dots    = "dots"    // Dots jumping after the label
+	Spinner = "spinner" // A spinning wheel after the label
+	None    = "none"    // The label alone, for screen readers and logs
+)
+
+// Styles lists the animation styles, for validating settings
+var Styles = []string{Dots, Spinner, None}
+
+// DefaultDelay is the time between frames when none is set
+const DefaultDelay = 200 * time.Millisecond
+
+// Frames returns the frames of an animation style, Dots when it isn't known, and none for None.
+// Frames are of the same width, so each covers the one before
+func Frames(style string) []string {
+	switch style {
+	case None:
+		return nil
+	case Spinner:
+		return []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+	default:
+		return []string{"   ", ".  ", ".. ", "..."}
+	}
+}
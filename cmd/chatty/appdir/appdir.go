@@ -0,0 +1,234 @@
+// Package appdir locates the directories chatty keeps its files in: the configuration under
+// $XDG_CONFIG_HOME/chatty and the data, like chat histories, under $XDG_DATA_HOME/chatty, or both
+// in ~/.chatty as before. Configuration profiles have their own directories in each
+package appdir
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"chatty/cmd/chatty/atomicfile"
+)
+
+const (
+	legacyDir   = ".chatty"        // Configuration and data together, as kept before XDG directories
+	appName     = "chatty"         // Name of the directories under the XDG base directories
+	profilesDir = "profiles"       // A directory per profile, in both the configuration and the data
+	activeFile  = "active_profile" // Name of the profile switched to, in the configuration
+
+	// DefaultProfile names the files right in the configuration and data directories
+	DefaultProfile = "default"
+)
+
+var (
+	selected    string // Profile chosen for this run with --config-profile, over the one switched to
+	profileName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,39}$`)
+)
+
+// Roots returns the directories of the configuration and the data of the default profile. An
+// existing ~/.chatty keeps being used for both until it is migrated, and so does Windows
+func Roots() (string, string, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", "", fmt.Errorf("failed to get home directory: %v", err)
+	}
+	legacy := filepath.Join(home, legacyDir)
+	if runtime.GOOS == "windows" {
+		return legacy, legacy, nil
+	}
+	config, data := xdgRoots(home)
+	if !isDir(config) && isDir(legacy) {
+		return legacy, legacy, nil
+	}
+	return config, data, nil
+}
+
+// xdgRoots returns chatty's directories under the XDG base directories, which are ignored when
+// they aren't absolute paths
+func xdgRoots(home string) (string, string) {
+	base := func(variable string, fallback ...string) string {
+		if dir := os.Getenv(variable); filepath.IsAbs(dir) {
+			return filepath.Join(dir, appName)
+		}
+		return filepath.Join(append([]string{home}, append(fallback, appName)...)...)
+	}
+	return base("XDG_CONFIG_HOME", ".config"), base("XDG_DATA_HOME", ".local", "share")
+}
+
+// Legacy returns ~/.chatty when it is still in use, or empty
+func Legacy() string {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return ""
+	}
+	legacy := filepath.Join(home, legacyDir)
+	if config, _, err := Roots(); err != nil || config != legacy {
+		return ""
+	}
+	return legacy
+}
+
+// ConfigDir returns the configuration directory of the profile in use: config.json, the
+// user's agents and tools
+func ConfigDir() (string, error) {
+	config, _, err := ProfileDirs(Current())
+	return config, err
+}
+
+// DataDir returns the data directory of the profile in use: chat histories, memory, knowledge
+// bases and everything else chatty saves as it is used
+func DataDir() (string, error) {
+	_, data, err := ProfileDirs(Current())
+	return data, err
+}
+
+// DataPath returns the path of a file in the data directory of the profile in use
+func DataPath(elem ...string) (string, error) {
+	dir, err := DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(append([]string{dir}, elem...)...), nil
+}
+
+// ProfileDirs returns the configuration and data directories of a profile
+func ProfileDirs(name string) (string, string, error) {
+	config, data, err := Roots()
+	if err != nil {
+		return "", "", err
+	}
+	if name == DefaultProfile {
+		return config, data, nil
+	}
+	return filepath.Join(config, profilesDir, name), filepath.Join(data, profilesDir, name), nil
+}
+
+// Current returns the name of the profile in use: the one chosen for this run, or else the one
+// switched to
+func Current() string {
+	if selected != "" {
+		return selected
+	}
+	return Active()
+}
+
+// Active returns the name of the profile switched to, the default when there's none or it is
+// gone
+func Active() string {
+	config, _, err := Roots()
+	if err != nil {
+		return DefaultProfile
+	}
+	data, err := os.ReadFile(filepath.Join(config, activeFile))
+	if err != nil {
+		return DefaultProfile
+	}
+	name := strings.TrimSpace(string(data))
+	if !Exists(name) {
+		return DefaultProfile
+	}
+	return name
+}
+
+// Use makes chatty use a profile for this run only
+func Use(name string) error {
+	if !Exists(name) {
+		return fmt.Errorf("no profile named '%s'", name)
+	}
+	selected = name
+	return nil
+}
+
+// Exists reports whether there's a profile with the name. The default always exists
+func Exists(name string) bool {
+	if name == DefaultProfile {
+		return true
+	}
+	if !ValidName(name) {
+		return false
+	}
+	config, _, err := ProfileDirs(name)
+	return err == nil && isDir(config)
+}
+
+// ValidName reports whether a profile can have the name
+func ValidName(name string) bool {
+	return profileName.MatchString(name)
+}
+
+// Profiles returns the names of the profiles, the default first and the others sorted
+func Profiles() ([]string, error) {
+	config, _, err := Roots()
+	if err != nil {
+		return nil, err
+	}
+	entries, err := os.ReadDir(filepath.Join(config, profilesDir))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read profiles: %v", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && ValidName(entry.Name()) && entry.Name() != DefaultProfile {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+	return append([]string{DefaultProfile}, names...), nil
+}
+
+// Create makes a new, empty profile and returns its configuration directory
+func Create(name string) (string, error) {
+	if !ValidName(name) {
+		return "", fmt.Errorf("invalid profile name '%s': use letters, digits, - and _, up to 40 characters", name)
+	}
+	if Exists(name) {
+		return "", fmt.Errorf("profile '%s' already exists", name)
+	}
+	config, data, err := ProfileDirs(name)
+	if err != nil {
+		return "", err
+	}
+	for _, dir := range []string{config, data} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return "", fmt.Errorf("failed to create profile: %v", err)
+		}
+	}
+	return config, nil
+}
+
+// Switch makes a profile the one used when --config-profile doesn't choose another
+func Switch(name string) error {
+	if !Exists(name) {
+		return fmt.Errorf("no profile named '%s'", name)
+	}
+	config, _, err := Roots()
+	if err != nil {
+		return err
+	}
+	path := filepath.Join(config, activeFile)
+	if name == DefaultProfile {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("failed to switch profile: %v", err)
+		}
+		return nil
+	}
+	if err := os.MkdirAll(config, 0755); err != nil {
+		return fmt.Errorf("failed to switch profile: %v", err)
+	}
+	if err := atomicfile.WriteFile(path, []byte(name+"\n"), 0644); err != nil {
+		return fmt.Errorf("failed to switch profile: %v", err)
+	}
+	return nil
+}
+
+// isDir reports whether path is an existing directory
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
@@ -0,0 +1,159 @@
+package appdir
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+// configEntries are the files and directories of ~/.chatty that go to the configuration
+// directory. Everything else is data
+var configEntries = []string{"config.json", "agents", "tools", "scenarios", activeFile}
+
+// isConfigEntry reports whether an entry of ~/.chatty, or of a profile in it, is configuration.
+// Backups of config.json go with it
+func isConfigEntry(name string) bool {
+	for _, entry := range configEntries {
+		if name == entry {
+			return true
+		}
+	}
+	return strings.HasPrefix(name, "config.json.")
+}
+
+// Migration is where MigrateLegacy moved ~/.chatty
+type Migration struct {
+	Legacy string
+	Config string
+	Data   string
+	Moved  int // Entries moved, counting those of each profile
+}
+
+// MigrateLegacy moves the files of ~/.chatty to the XDG base directories: the configuration to
+// $XDG_CONFIG_HOME/chatty and the rest to $XDG_DATA_HOME/chatty, profile by profile, removing
+// ~/.chatty once it is empty
+func MigrateLegacy() (*Migration, error) {
+	if runtime.GOOS == "windows" {
+		return nil, fmt.Errorf("chatty keeps its files in ~/.chatty on Windows")
+	}
+	legacy := Legacy()
+	if legacy == "" {
+		return nil, fmt.Errorf("there is no ~/.chatty to migrate")
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get home directory: %v", err)
+	}
+	config, data := xdgRoots(home)
+	for _, dir := range []string{config, data} {
+		if entries, err := os.ReadDir(dir); err == nil && len(entries) > 0 {
+			return nil, fmt.Errorf("%s already exists: move or remove it first", dir)
+		}
+	}
+
+	migration := &Migration{Legacy: legacy, Config: config, Data: data}
+	if err := migration.move(legacy, config, data); err != nil {
+		return nil, err
+	}
+	profiles, _ := os.ReadDir(filepath.Join(legacy, profilesDir))
+	for _, profile := range profiles {
+		if !profile.IsDir() {
+			continue
+		}
+		from := filepath.Join(legacy, profilesDir, profile.Name())
+		err := migration.move(from, filepath.Join(config, profilesDir, profile.Name()), filepath.Join(data, profilesDir, profile.Name()))
+		if err != nil {
+			return nil, err
+		}
+		os.Remove(from)
+	}
+	os.Remove(filepath.Join(legacy, profilesDir))
+	if err := os.Remove(legacy); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("moved everything chatty knows, but %s still has other files: %v", legacy, err)
+	}
+	return migration, nil
+}
+
+// move moves the entries of a directory laid out like ~/.chatty to the configuration or the data
+// directory, leaving the profiles to their own move
+func (m *Migration) move(from, config, data string) error {
+	entries, err := os.ReadDir(from)
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", from, err)
+	}
+	for _, dir := range []string{config, data} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("failed to create %s: %v", dir, err)
+		}
+	}
+	for _, entry := range entries {
+		if entry.Name() == profilesDir && from == m.Legacy {
+			continue
+		}
+		to := filepath.Join(data, entry.Name())
+		if isConfigEntry(entry.Name()) {
+			to = filepath.Join(config, entry.Name())
+		}
+		if err := moveEntry(filepath.Join(from, entry.Name()), to); err != nil {
+			return fmt.Errorf("failed to move %s: %v", filepath.Join(from, entry.Name()), err)
+		}
+		m.Moved++
+	}
+	return nil
+}
+
+// moveEntry renames a file or directory, copying it when it goes to another file system
+func moveEntry(from, to string) error {
+	if err := os.Rename(from, to); err == nil {
+		return nil
+	}
+	if err := copyEntry(from, to); err != nil {
+		os.RemoveAll(to)
+		return err
+	}
+	return os.RemoveAll(from)
+}
+
+// copyEntry copies a file, or a directory with everything in it, keeping permissions
+func copyEntry(from, to string) error {
+	info, err := os.Lstat(from)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		if err := os.MkdirAll(to, info.Mode().Perm()); err != nil {
+			return err
+		}
+		entries, err := os.ReadDir(from)
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			if err := copyEntry(filepath.Join(from, entry.Name()), filepath.Join(to, entry.Name())); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if !info.Mode().IsRegular() {
+		return nil // Lock files and the like are recreated when needed
+	}
+	source, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer source.Close()
+	target, err := os.OpenFile(to, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(target, source); err != nil {
+		target.Close()
+		return err
+	}
+	return target.Close()
+}
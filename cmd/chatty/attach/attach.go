@@ -0,0 +1,102 @@
+package attach
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	maxDownloadSize = 5 << 20 // Largest page that will be downloaded
+	maxTextLength   = 20000   // Characters of a document included in the prompt
+	fetchTimeout    = 30 * time.Second
+)
+
+// Document is external content attached to a conversation
+type Document struct {
+	Source string // URL or path the content came from
+	Title  string
+	Text   string
+}
+
+// FetchURL downloads a web page and reduces it to readable text
+func FetchURL(url string) (Document, error) {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return Document{}, fmt.Errorf("invalid URL '%s': only http and https are supported", url)
+	}
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return Document{}, fmt.Errorf("invalid URL '%s': %v", url, err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; chatty)")
+	req.Header.Set("Accept", "text/html, text/plain;q=0.9, */*;q=0.5")
+
+	client := &http.Client{Timeout: fetchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to fetch %s: %v", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return Document{}, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDownloadSize))
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to read %s: %v", url, err)
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	doc := Document{Source: url}
+	switch {
+	case mediaType == "" || mediaType == "text/html" || mediaType == "application/xhtml+xml":
+		doc.Title = htmlTitle(string(body))
+		doc.Text = htmlToText(string(body))
+	case strings.HasPrefix(mediaType, "text/") || mediaType == "application/json":
+		doc.Text = cleanText(string(body))
+	default:
+		return Document{}, fmt.Errorf("cannot read %s: unsupported content type '%s'", url, mediaType)
+	}
+
+	if doc.Text == "" {
+		return Document{}, fmt.Errorf("no readable text found at %s", url)
+	}
+	doc.Text = truncate(doc.Text)
+	return doc, nil
+}
+
+// truncate shortens text that would not fit comfortably in a model's context
+func truncate(text string) string {
+	runes := []rune(text)
+	if len(runes) <= maxTextLength {
+		return text
+	}
+	return string(runes[:maxTextLength]) + "\n\n[content truncated]"
+}
+
+// FormatContext renders documents as reference material for a prompt
+func FormatContext(docs []Document) string {
+	if len(docs) == 0 {
+		return ""
+	}
+
+	var sb strings.Builder
+	sb.WriteString("The following reference material was attached to this conversation. Use it when responding.\n")
+	for _, doc := range docs {
+		sb.WriteString("\n--- ")
+		sb.WriteString(doc.Source)
+		if doc.Title != "" {
+			sb.WriteString(" (" + doc.Title + ")")
+		}
+		sb.WriteString(" ---\n")
+		sb.WriteString(doc.Text)
+		sb.WriteString("\n")
+	}
+	sb.WriteString("\n--- end of reference material ---")
+	return sb.String()
+}
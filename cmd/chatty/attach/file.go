@@ -0,0 +1,107 @@
+package attach
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	ocrTimeout = 5 * time.Minute
+	ocrPrompt  = "Transcribe all of the text in this image exactly as written, preserving line breaks. Reply with the text only, without any comments. If there is no text, reply with an empty message."
+)
+
+// OllamaURL is the address of the Ollama server, whose generate API is used for vision OCR
+var OllamaURL = "http://localhost:11434"
+
+// ReadFile loads a local file as a document. Text files are included as they are;
+// images need ocr, which extracts their text with visionModel or, when it is empty, tesseract
+func ReadFile(path string, ocr bool, visionModel string) (Document, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Document{}, fmt.Errorf("failed to read file: %v", err)
+	}
+
+	doc := Document{Source: path, Title: filepath.Base(path)}
+	contentType := http.DetectContentType(data)
+	switch {
+	case strings.HasPrefix(contentType, "image/"):
+		if !ocr {
+			return Document{}, fmt.Errorf("%s is an image: add --ocr to extract its text, or use --image with a multimodal model", path)
+		}
+		if visionModel != "" {
+			doc.Text, err = visionOCR(data, visionModel)
+		} else {
+			doc.Text, err = tesseractOCR(path)
+		}
+		if err != nil {
+			return Document{}, err
+		}
+	case strings.HasPrefix(contentType, "text/") || utf8.Valid(data):
+		doc.Text = cleanText(string(data))
+	default:
+		return Document{}, fmt.Errorf("%s is not a text file or image (detected %s)", path, contentType)
+	}
+
+	if doc.Text == "" {
+		return Document{}, fmt.Errorf("no text found in %s", path)
+	}
+	doc.Text = truncate(doc.Text)
+	return doc, nil
+}
+
+// tesseractOCR extracts the text of an image with the tesseract command
+func tesseractOCR(path string) (string, error) {
+	if _, err := exec.LookPath("tesseract"); err != nil {
+		return "", fmt.Errorf("tesseract not found: install it or set 'ocr_model' in config.json to a vision model like llava")
+	}
+
+	var stderr bytes.Buffer
+	cmd := exec.Command("tesseract", path, "stdout")
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("tesseract failed: %v %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return cleanText(string(output)), nil
+}
+
+// visionOCR asks an Ollama vision model to transcribe the text of an image
+func visionOCR(image []byte, model string) (string, error) {
+	payload, err := json.Marshal(map[string]interface{}{
+		"model":  model,
+		"prompt": ocrPrompt,
+		"images": []string{base64.StdEncoding.EncodeToString(image)},
+		"stream": false,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request: %v", err)
+	}
+
+	client := &http.Client{Timeout: ocrTimeout}
+	resp, err := client.Post(OllamaURL+"/api/generate", "application/json", bytes.NewReader(payload))
+	if err != nil {
+		return "", fmt.Errorf("failed to reach Ollama for OCR: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Response string `json:"response"`
+		Error    string `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode OCR response: %v", err)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("OCR with %s failed: %s", model, result.Error)
+	}
+	return cleanText(result.Response), nil
+}
@@ -0,0 +1,123 @@
+package attach
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Elements whose content is never readable text
+	skippedElements = map[string]bool{
+		"script": true, "style": true, "noscript": true, "svg": true, "template": true,
+		"nav": true, "footer": true, "form": true, "iframe": true, "button": true, "select": true,
+	}
+
+	// Elements that start a new line
+	blockElements = map[string]bool{
+		"p": true, "div": true, "section": true, "article": true, "main": true, "header": true,
+		"ul": true, "ol": true, "table": true, "tr": true, "blockquote": true, "pre": true,
+		"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+		"dl": true, "dt": true, "dd": true, "figure": true, "figcaption": true, "hr": true,
+	}
+
+	titlePattern     = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+	mainPattern      = regexp.MustCompile(`(?is)<(article|main)[\s>].*</(article|main)>`)
+	spacePattern     = regexp.MustCompile(`[ \t\f\v\r]+`)
+	blankLinePattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlTitle returns the document title, if any
+func htmlTitle(doc string) string {
+	match := titlePattern.FindStringSubmatch(doc)
+	if match == nil {
+		return ""
+	}
+	return strings.TrimSpace(html.UnescapeString(spacePattern.ReplaceAllString(match[1], " ")))
+}
+
+// htmlToText reduces an HTML page to its readable text, preferring the <article> or <main> element
+func htmlToText(doc string) string {
+	if main := mainPattern.FindString(doc); main != "" {
+		doc = main
+	}
+
+	var sb strings.Builder
+	skipDepth := 0
+	skipping := ""
+	for i := 0; i < len(doc); {
+		if doc[i] != '<' {
+			next := strings.IndexByte(doc[i:], '<')
+			if next < 0 {
+				next = len(doc) - i
+			}
+			if skipDepth == 0 {
+				sb.WriteString(doc[i : i+next])
+			}
+			i += next
+			continue
+		}
+
+		// Comments
+		if strings.HasPrefix(doc[i:], "<!--") {
+			end := strings.Index(doc[i:], "-->")
+			if end < 0 {
+				break
+			}
+			i += end + 3
+			continue
+		}
+
+		end := strings.IndexByte(doc[i:], '>')
+		if end < 0 {
+			break
+		}
+		tag := doc[i+1 : i+end]
+		i += end + 1
+
+		closing := strings.HasPrefix(tag, "/")
+		name := strings.ToLower(strings.TrimLeft(tag, "/"))
+		if space := strings.IndexAny(name, " \t\n\r/"); space >= 0 {
+			name = name[:space]
+		}
+
+		// Skip the content of non-text elements, tracking nesting of the same element
+		if skippedElements[name] {
+			switch {
+			case strings.HasSuffix(tag, "/"):
+			case !closing && (skipDepth == 0 || skipping == name):
+				skipping = name
+				skipDepth++
+			case closing && skipping == name:
+				skipDepth--
+			}
+			continue
+		}
+		if skipDepth > 0 {
+			continue
+		}
+
+		switch {
+		case name == "br":
+			sb.WriteString("\n")
+		case name == "li" && !closing:
+			sb.WriteString("\n- ")
+		case (name == "td" || name == "th") && !closing:
+			sb.WriteString(" | ")
+		case blockElements[name]:
+			sb.WriteString("\n\n")
+		}
+	}
+
+	return cleanText(html.UnescapeString(sb.String()))
+}
+
+// cleanText collapses runs of whitespace and blank lines
+func cleanText(text string) string {
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(spacePattern.ReplaceAllString(line, " "))
+	}
+	text = strings.Join(lines, "\n")
+	return strings.TrimSpace(blankLinePattern.ReplaceAllString(text, "\n\n"))
+}
@@ -0,0 +1,259 @@
+// Package bridge relays messages between chat services and chatty's agents
+package bridge
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chatty/cmd/chatty/server"
+)
+
+const (
+	editInterval     = 1500 * time.Millisecond // How often a streaming response is edited into its message
+	maxTranscript    = 40                      // Messages of a channel's group chat kept for the next round
+	typingIndicator  = "…"
+	reconnectInitial = time.Second
+	reconnectMax     = time.Minute
+	maxMessageSize   = 16 << 20 // Largest message read from a service's WebSocket
+)
+
+// Engine is the part of chatty a bridge drives, the same chats as chatty serve. Bridges pass a
+// session per channel, so each channel keeps its own histories
+type Engine interface {
+	Agents() []server.Agent
+	// Chat sends a message to an agent, passing the response to onChunk as it streams
+	Chat(session, agent, message string, onChunk func(chunk string)) (string, string, error)
+	// Group has each agent answer a group chat in turn, reporting progress to onEvent
+	Group(session string, agents []string, messages []server.GroupMessage, onEvent func(event server.GroupEvent)) error
+}
+
+// liveMessage shows a response in a posted message as it streams, editing the message at most
+// once per interval so the service's rate limits aren't hit
+type liveMessage struct {
+	edit     func(text string) error
+	text     strings.Builder
+	last     time.Time
+	failed   bool
+	limit    int                     // Characters a message can hold, no limit when 0
+	overflow func(text string) error // Posts what doesn't fit in the message once the response is complete
+}
+
+// newLiveMessage returns a live message that is edited with edit
+func newLiveMessage(edit func(text string) error) *liveMessage {
+	return &liveMessage{edit: edit, last: time.Now()}
+}
+
+// add appends a chunk of the response, editing the message when the interval has passed
+func (m *liveMessage) add(chunk string) {
+	m.text.WriteString(chunk)
+	if m.failed || time.Since(m.last) < editInterval || strings.TrimSpace(m.text.String()) == "" {
+		return
+	}
+	m.last = time.Now()
+	text := m.text.String()
+	if m.limit > 0 && len([]rune(text)) > m.limit-2 {
+		text = string([]rune(text)[:m.limit-2])
+	}
+	if err := m.edit(text + " " + typingIndicator); err != nil {
+		m.failed = true // Keep streaming, the final edit tries again
+	}
+}
+
+// finish edits the message with the complete response, posting the rest in messages of their own
+// when it doesn't fit
+func (m *liveMessage) finish(text string) error {
+	if strings.TrimSpace(text) == "" {
+		text = "(no response)"
+	}
+	if m.limit == 0 || m.overflow == nil {
+		return m.edit(text)
+	}
+	parts := splitMessage(text, m.limit)
+	if err := m.edit(parts[0]); err != nil {
+		return err
+	}
+	for _, part := range parts[1:] {
+		if err := m.overflow(part); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// splitMessage cuts text into parts of at most limit characters, after a line break or space
+// when there is one in the second half of a part
+func splitMessage(text string, limit int) []string {
+	var parts []string
+	runes := []rune(text)
+	for len(runes) > limit {
+		cut := lastBreak(runes[:limit], '\n')
+		if cut == 0 {
+			cut = lastBreak(runes[:limit], ' ')
+		}
+		if cut == 0 {
+			cut = limit
+		}
+		parts = append(parts, strings.TrimRight(string(runes[:cut]), " \n"))
+		runes = runes[cut:]
+	}
+	return append(parts, string(runes))
+}
+
+// lastBreak returns the position after the last separator in the second half of runes, 0 when there is none
+func lastBreak(runes []rune, separator rune) int {
+	for i := len(runes) - 1; i >= len(runes)/2; i-- {
+		if runes[i] == separator {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// conversation is a message being answered in a channel
+type conversation struct {
+	engine  Engine
+	session string
+	agents  []string
+	state   *channelState
+	reply   func(agent string) *liveMessage // Posts an agent's reply, which is then edited as it streams
+	logf    func(format string, args ...any)
+}
+
+// answer has the channel's agents answer a message: a single agent streams its response into
+// one reply, several answer in turn for a number of rounds, each in a reply of its own. A new
+// round isn't started while another message of the channel waits to be answered
+func (c conversation) answer(text string, rounds int) {
+	if len(c.agents) == 1 {
+		live := c.reply(c.agents[0])
+		_, response, err := c.engine.Chat(c.session, c.agents[0], text, live.add)
+		if err != nil {
+			response = "⚠️ " + err.Error()
+			c.logf("Failed to answer: %v", err)
+		}
+		if err := live.finish(response); err != nil {
+			c.logf("Failed to reply: %v", err)
+		}
+		return
+	}
+
+	c.state.add(server.GroupMessage{Content: text})
+	for round := 0; round < rounds; round++ {
+		if round > 0 && c.state.waiting.Load() > 0 {
+			return // Someone spoke, their message is answered next
+		}
+		var live *liveMessage
+		err := c.engine.Group(c.session, c.agents, c.state.transcript, func(e server.GroupEvent) {
+			switch e.Type {
+			case server.EventTurnStart:
+				live = c.reply(e.Agent)
+			case server.EventChunk:
+				live.add(e.Content)
+			case server.EventTurnEnd:
+				c.state.add(server.GroupMessage{Speaker: e.Agent, Content: e.Content})
+				if err := live.finish(e.Content); err != nil {
+					c.logf("Failed to reply: %v", err)
+				}
+				live = nil
+			}
+		})
+		if err != nil {
+			c.logf("Failed to answer: %v", err)
+			if live == nil {
+				live = c.reply("")
+			}
+			live.finish("⚠️ " + err.Error()) // In the reply of the agent that was answering
+			return
+		}
+	}
+}
+
+// channelState is what a bridge keeps for a channel: a lock so messages are answered in order,
+// and the transcript of its group chat
+type channelState struct {
+	mu         sync.Mutex
+	waiting    atomic.Int32 // Messages waiting for the lock
+	transcript []server.GroupMessage
+}
+
+// channels holds the state of the channels a bridge has seen
+type channels struct {
+	mu    sync.Mutex
+	state map[string]*channelState
+}
+
+// get returns a channel's state, creating it the first time
+func (c *channels) get(id string) *channelState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.state == nil {
+		c.state = make(map[string]*channelState)
+	}
+	state, ok := c.state[id]
+	if !ok {
+		state = &channelState{}
+		c.state[id] = state
+	}
+	return state
+}
+
+// acquire waits until the channel's previous messages are answered. Call release when done
+func (s *channelState) acquire() {
+	s.waiting.Add(1)
+	s.mu.Lock()
+	s.waiting.Add(-1)
+}
+
+// release lets the channel's next message be answered
+func (s *channelState) release() {
+	s.mu.Unlock()
+}
+
+// add appends a message to the channel's group chat transcript, forgetting the oldest ones
+func (s *channelState) add(message server.GroupMessage) {
+	s.transcript = append(s.transcript, message)
+	if len(s.transcript) > maxTranscript {
+		s.transcript = s.transcript[len(s.transcript)-maxTranscript:]
+	}
+}
+
+// mappedAgents returns the agents mapped to a channel by ID or by name, nil when it has none.
+// name looks up the channel's name, only when the ID isn't mapped
+func mappedAgents(mappings map[string][]string, id string, name func() string) []string {
+	if agents, ok := mappings[id]; ok || len(mappings) == 0 {
+		return agents
+	}
+	channelName := name()
+	if channelName == "" {
+		return nil
+	}
+	for key, agents := range mappings {
+		if strings.EqualFold(strings.TrimPrefix(key, "#"), channelName) {
+			return agents
+		}
+	}
+	return nil
+}
+
+// agentDisplayName returns the name an agent posts under, with its emoji
+func agentDisplayName(engine Engine, name string) string {
+	for _, agent := range engine.Agents() {
+		if strings.EqualFold(agent.Name, name) {
+			if agent.Emoji != "" {
+				return agent.Emoji + " " + agent.Name
+			}
+			return agent.Name
+		}
+	}
+	return name
+}
+
+// nextDelay doubles a reconnection delay, up to reconnectMax
+func nextDelay(delay time.Duration) time.Duration {
+	delay *= 2
+	if delay > reconnectMax {
+		return reconnectMax
+	}
+	return delay
+}
@@ -0,0 +1,535 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"chatty/cmd/chatty/websocket"
+)
+
+const (
+	discordAPI        = "https://discord.com/api/v10/"
+	discordTimeout    = 30 * time.Second
+	discordMaxLength  = 2000                 // Characters a Discord message can hold
+	discordIntents    = 1<<9 | 1<<12 | 1<<15 // Guild messages, direct messages and message content
+	discordUserAgent  = "DiscordBot (https://github.com/lucianoayres/chatty-ai, 1.0)"
+	webhookName       = "Chatty" // Name of the webhooks agents post through
+	emojiAvatarFormat = "https://cdn.jsdelivr.net/gh/twitter/twemoji@14.0.2/assets/72x72/%s.png"
+)
+
+// DefaultAutoTurns is how many rounds the agents of an auto channel talk after each message
+const DefaultAutoTurns = 3
+
+// Gateway opcodes
+const (
+	gatewayDispatch       = 0
+	gatewayHeartbeat      = 1
+	gatewayIdentify       = 2
+	gatewayReconnect      = 7
+	gatewayInvalidSession = 9
+	gatewayHello          = 10
+	gatewayHeartbeatAck   = 11
+)
+
+// discordMentionPattern matches user mentions like <@123> and <@!123>
+var discordMentionPattern = regexp.MustCompile(`<@!?[0-9]+>`)
+
+// fatalCloseCodes are the gateway close codes that reconnecting won't fix
+var fatalCloseCodes = map[int]string{
+	4004: "the bot token was rejected",
+	4013: "invalid intents",
+	4014: "enable the Message Content intent of your bot in the Discord Developer Portal",
+}
+
+// Discord relays messages between Discord and the agents over the gateway. Agents post through
+// a webhook of each channel, so every agent has its own name and avatar. In mapped channels every
+// message is answered by the channel's agents, in auto channels they keep talking among themselves
+// for a few rounds after each message, and elsewhere the default agent answers direct messages
+// and mentions
+type Discord struct {
+	Token        string              // Bot token
+	Channels     map[string][]string // Agents answering in a channel, by channel ID or name
+	AutoChannels map[string][]string // Agents conversing in a channel, by channel ID or name
+	Turns        int                 // Rounds the agents of an auto channel talk after each message, 3 when 0
+	DefaultAgent string              // Answers direct messages and mentions, the current agent when empty
+	Engine       Engine
+	Logf         func(format string, args ...any)
+
+	client        *http.Client
+	botUserID     string
+	applicationID string
+	channels      channels
+	namesMu       sync.Mutex
+	names         map[string]string // Channel names by ID, looked up once
+	webhooksMu    sync.Mutex
+	webhooks      map[string]*discordHook // Webhooks by channel ID, nil for channels without one
+}
+
+// discordPayload is a message of the gateway
+type discordPayload struct {
+	Op   int             `json:"op"`
+	Data json.RawMessage `json:"d"`
+	Seq  *int64          `json:"s,omitempty"`
+	Type string          `json:"t,omitempty"`
+}
+
+// discordMessage is a message posted in a channel
+type discordMessage struct {
+	ID        string `json:"id"`
+	ChannelID string `json:"channel_id"`
+	GuildID   string `json:"guild_id"`
+	Type      int    `json:"type"`
+	Content   string `json:"content"`
+	WebhookID string `json:"webhook_id"`
+	Author    struct {
+		ID  string `json:"id"`
+		Bot bool   `json:"bot"`
+	} `json:"author"`
+	Mentions []struct {
+		ID string `json:"id"`
+	} `json:"mentions"`
+}
+
+// discordHook is a webhook agents post through
+type discordHook struct {
+	ID            string `json:"id"`
+	Token         string `json:"token"`
+	ApplicationID string `json:"application_id"`
+}
+
+// Run connects to Discord and relays messages until the connection can't be opened
+func (d *Discord) Run() error {
+	if d.Token == "" {
+		return fmt.Errorf("a bot token is required")
+	}
+	d.client = &http.Client{Timeout: discordTimeout}
+
+	var gateway struct {
+		URL string `json:"url"`
+	}
+	if err := d.call(http.MethodGet, "gateway/bot", nil, &gateway); err != nil {
+		return fmt.Errorf("failed to sign in with the bot token: %v", err)
+	}
+
+	delay := reconnectInitial
+	for {
+		connected, err := d.listen(gateway.URL)
+		if connected {
+			delay = reconnectInitial
+		}
+		var closed *websocket.CloseError
+		if errors.As(err, &closed) {
+			if reason, ok := fatalCloseCodes[closed.Code]; ok {
+				return fmt.Errorf("Discord closed the connection: %s", reason)
+			}
+		}
+		if err != nil && !connected {
+			d.logf("Connection failed: %v", err)
+		} else if err != nil {
+			d.logf("Connection lost: %v", err)
+		}
+		d.logf("Reconnecting in %s", delay)
+		time.Sleep(delay)
+		delay = nextDelay(delay)
+	}
+}
+
+// listen opens a gateway connection and handles its events until Discord asks to reconnect or
+// the connection drops. It reports whether the connection was opened
+func (d *Discord) listen(gateway string) (bool, error) {
+	conn, err := websocket.Dial(gateway+"/?v=10&encoding=json", maxMessageSize)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	data, err := conn.ReadMessage()
+	if err != nil {
+		return false, err
+	}
+	var hello struct {
+		Op   int `json:"op"`
+		Data struct {
+			HeartbeatInterval int `json:"heartbeat_interval"`
+		} `json:"d"`
+	}
+	if err := json.Unmarshal(data, &hello); err != nil || hello.Op != gatewayHello || hello.Data.HeartbeatInterval <= 0 {
+		return false, fmt.Errorf("unexpected first message from the gateway")
+	}
+	identify := map[string]any{
+		"token":   d.Token,
+		"intents": discordIntents,
+		"properties": map[string]string{
+			"os":      runtime.GOOS,
+			"browser": "chatty",
+			"device":  "chatty",
+		},
+	}
+	if err := d.send(conn, gatewayIdentify, identify); err != nil {
+		return false, err
+	}
+
+	// Heartbeats keep the connection open; one that isn't acknowledged means it's dead
+	var seq atomic.Int64
+	seq.Store(-1)
+	var acked atomic.Bool
+	acked.Store(true)
+	heartbeat := func() error {
+		if last := seq.Load(); last >= 0 {
+			return d.send(conn, gatewayHeartbeat, last)
+		}
+		return d.send(conn, gatewayHeartbeat, nil)
+	}
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		ticker := time.NewTicker(time.Duration(hello.Data.HeartbeatInterval) * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				if !acked.Swap(false) || heartbeat() != nil {
+					conn.Close() // Stops the read below
+					return
+				}
+			}
+		}
+	}()
+
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+		var payload discordPayload
+		if err := json.Unmarshal(data, &payload); err != nil {
+			continue
+		}
+		switch payload.Op {
+		case gatewayDispatch:
+			if payload.Seq != nil {
+				seq.Store(*payload.Seq)
+			}
+			d.dispatch(payload)
+		case gatewayHeartbeat:
+			if err := heartbeat(); err != nil {
+				return true, err
+			}
+		case gatewayHeartbeatAck:
+			acked.Store(true)
+		case gatewayReconnect:
+			return true, nil
+		case gatewayInvalidSession:
+			return true, fmt.Errorf("session invalidated")
+		}
+	}
+}
+
+// dispatch handles a gateway event
+func (d *Discord) dispatch(payload discordPayload) {
+	switch payload.Type {
+	case "READY":
+		var ready struct {
+			User struct {
+				ID       string `json:"id"`
+				Username string `json:"username"`
+			} `json:"user"`
+			Application struct {
+				ID string `json:"id"`
+			} `json:"application"`
+		}
+		if err := json.Unmarshal(payload.Data, &ready); err != nil {
+			return
+		}
+		d.botUserID = ready.User.ID
+		d.applicationID = ready.Application.ID
+		d.logf("Signed in as %s, listening for messages", ready.User.Username)
+	case "MESSAGE_CREATE":
+		var message discordMessage
+		if err := json.Unmarshal(payload.Data, &message); err != nil {
+			return
+		}
+		go d.handle(message)
+	}
+}
+
+// handle answers a message when it is meant for the agents
+func (d *Discord) handle(message discordMessage) {
+	// Only answer people's own messages and replies, not bots, agents or system messages
+	if message.Author.Bot || message.WebhookID != "" || message.Author.ID == d.botUserID || (message.Type != 0 && message.Type != 19) {
+		return
+	}
+	direct := message.GuildID == ""
+	agents, rounds := d.channelAgents(message.ChannelID, direct)
+	if agents == nil {
+		if !direct && !d.mentioned(message) {
+			return
+		}
+		agents = []string{d.DefaultAgent}
+	}
+	text := strings.TrimSpace(discordMentionPattern.ReplaceAllString(message.Content, ""))
+	if text == "" {
+		return
+	}
+
+	state := d.channels.get(message.ChannelID)
+	state.acquire()
+	defer state.release()
+
+	conversation{
+		engine:  d.Engine,
+		session: "discord:" + message.ChannelID,
+		agents:  agents,
+		state:   state,
+		reply: func(agent string) *liveMessage {
+			return d.reply(message.ChannelID, agent, direct)
+		},
+		logf: func(format string, args ...any) {
+			d.logf("%s: %s", message.ChannelID, fmt.Sprintf(format, args...))
+		},
+	}.answer(text, rounds)
+}
+
+// channelAgents returns the agents mapped to a channel and the rounds they talk for after each
+// message, nil agents when it has none. Direct messages are never mapped
+func (d *Discord) channelAgents(channel string, direct bool) ([]string, int) {
+	if direct {
+		return nil, 0
+	}
+	name := func() string { return d.channelName(channel) }
+	if agents := mappedAgents(d.AutoChannels, channel, name); agents != nil {
+		if d.Turns > 0 {
+			return agents, d.Turns
+		}
+		return agents, DefaultAutoTurns
+	}
+	return mappedAgents(d.Channels, channel, name), 1
+}
+
+// mentioned reports whether a message mentions the bot
+func (d *Discord) mentioned(message discordMessage) bool {
+	for _, user := range message.Mentions {
+		if user.ID == d.botUserID {
+			return true
+		}
+	}
+	return false
+}
+
+// channelName looks up a channel's name, empty when it can't be seen
+func (d *Discord) channelName(channel string) string {
+	d.namesMu.Lock()
+	defer d.namesMu.Unlock()
+	if name, ok := d.names[channel]; ok {
+		return name
+	}
+	var info struct {
+		Name string `json:"name"`
+	}
+	if err := d.call(http.MethodGet, "channels/"+channel, nil, &info); err != nil {
+		d.logf("Failed to look up channel %s: %v", channel, err)
+	}
+	if d.names == nil {
+		d.names = make(map[string]string)
+	}
+	d.names[channel] = info.Name
+	return info.Name
+}
+
+// reply posts an agent's reply in a channel, through the channel's webhook so it shows with the
+// agent's name and avatar. Without a webhook, in direct messages or when the bot can't manage
+// webhooks, the bot posts it, with the agent's name in front when it's in a server
+func (d *Discord) reply(channel, agent string, direct bool) *liveMessage {
+	var hook *discordHook
+	if !direct {
+		hook = d.webhook(channel)
+	}
+	name := agentDisplayName(d.Engine, agent)
+
+	post := func(text string) (func(text string) error, error) {
+		var posted struct {
+			ID string `json:"id"`
+		}
+		if hook != nil {
+			body := map[string]any{
+				"content":          text,
+				"username":         name,
+				"avatar_url":       emojiAvatar(d.Engine, agent),
+				"allowed_mentions": map[string]any{"parse": []string{}},
+			}
+			path := "webhooks/" + hook.ID + "/" + hook.Token
+			if err := d.call(http.MethodPost, path+"?wait=true", body, &posted); err != nil {
+				return nil, err
+			}
+			return func(text string) error {
+				return d.call(http.MethodPatch, path+"/messages/"+posted.ID, map[string]string{"content": text}, nil)
+			}, nil
+		}
+
+		prefix := ""
+		if !direct && agent != "" {
+			prefix = "**" + name + "**\n"
+		}
+		body := map[string]any{"content": prefix + text, "allowed_mentions": map[string]any{"parse": []string{}}}
+		if err := d.call(http.MethodPost, "channels/"+channel+"/messages", body, &posted); err != nil {
+			return nil, err
+		}
+		return func(text string) error {
+			return d.call(http.MethodPatch, "channels/"+channel+"/messages/"+posted.ID, map[string]string{"content": prefix + text}, nil)
+		}, nil
+	}
+
+	edit, err := post(typingIndicator)
+	if err != nil {
+		d.logf("%s: Failed to reply: %v", channel, err)
+		return newLiveMessage(func(string) error { return nil })
+	}
+	live := newLiveMessage(edit)
+	live.limit = discordMaxLength - len([]rune(name)) - 5 // Leaves room for the name when the bot posts
+	live.overflow = func(text string) error {
+		_, err := post(text)
+		return err
+	}
+	return live
+}
+
+// webhook returns the channel's webhook for agents, creating it the first time, or nil when the
+// bot isn't allowed to manage webhooks there
+func (d *Discord) webhook(channel string) *discordHook {
+	d.webhooksMu.Lock()
+	defer d.webhooksMu.Unlock()
+	if hook, ok := d.webhooks[channel]; ok {
+		return hook
+	}
+	if d.webhooks == nil {
+		d.webhooks = make(map[string]*discordHook)
+	}
+
+	var hooks []discordHook
+	if err := d.call(http.MethodGet, "channels/"+channel+"/webhooks", nil, &hooks); err != nil {
+		d.logf("%s: Agents post as the bot, it needs the Manage Webhooks permission to post under their names: %v", channel, err)
+		d.webhooks[channel] = nil
+		return nil
+	}
+	for i := range hooks {
+		if hooks[i].Token != "" && hooks[i].ApplicationID == d.applicationID {
+			d.webhooks[channel] = &hooks[i]
+			return &hooks[i]
+		}
+	}
+	var hook discordHook
+	if err := d.call(http.MethodPost, "channels/"+channel+"/webhooks", map[string]string{"name": webhookName}, &hook); err != nil {
+		d.logf("%s: Agents post as the bot, failed to create a webhook: %v", channel, err)
+		d.webhooks[channel] = nil
+		return nil
+	}
+	d.webhooks[channel] = &hook
+	return &hook
+}
+
+// emojiAvatar returns the address of an image of the agent's emoji, used as its avatar
+func emojiAvatar(engine Engine, name string) string {
+	emoji := ""
+	for _, agent := range engine.Agents() {
+		if strings.EqualFold(agent.Name, name) {
+			emoji = agent.Emoji
+		}
+	}
+	if emoji == "" {
+		return ""
+	}
+	// Twemoji names images after the emoji's code points, leaving out variation selectors
+	// unless the emoji joins several
+	var codes []string
+	for _, r := range emoji {
+		if r == 0xFE0F && !strings.ContainsRune(emoji, 0x200D) {
+			continue
+		}
+		codes = append(codes, fmt.Sprintf("%x", r))
+	}
+	return fmt.Sprintf(emojiAvatarFormat, strings.Join(codes, "-"))
+}
+
+// send writes a gateway message
+func (d *Discord) send(conn *websocket.Conn, op int, data any) error {
+	message, err := json.Marshal(map[string]any{"op": op, "d": data})
+	if err != nil {
+		return err
+	}
+	return conn.WriteText(message)
+}
+
+// call sends a request to the REST API, waiting and trying again when rate limited. Errors don't
+// include the path, which holds the webhook's token for webhook requests
+func (d *Discord) call(method, path string, body, result any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, discordAPI+path, bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("invalid request")
+		}
+		req.Header.Set("Authorization", "Bot "+d.Token)
+		req.Header.Set("User-Agent", discordUserAgent)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := d.client.Do(req)
+		if err != nil {
+			var urlErr *url.Error
+			if errors.As(err, &urlErr) {
+				err = urlErr.Err
+			}
+			return fmt.Errorf("failed to reach Discord: %v", err)
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			var limit struct {
+				RetryAfter float64 `json:"retry_after"`
+			}
+			json.NewDecoder(resp.Body).Decode(&limit)
+			resp.Body.Close()
+			time.Sleep(time.Duration((limit.RetryAfter + 0.1) * float64(time.Second)))
+			continue
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode >= 300 {
+			var apiErr struct {
+				Message string `json:"message"`
+			}
+			json.NewDecoder(resp.Body).Decode(&apiErr)
+			if apiErr.Message != "" {
+				return fmt.Errorf("%s (%s)", apiErr.Message, resp.Status)
+			}
+			return fmt.Errorf("%s", resp.Status)
+		}
+		if result != nil {
+			return json.NewDecoder(resp.Body).Decode(result)
+		}
+		return nil
+	}
+}
+
+// logf reports what the bridge is doing
+func (d *Discord) logf(format string, args ...any) {
+	if d.Logf != nil {
+		d.Logf(format, args...)
+	}
+}
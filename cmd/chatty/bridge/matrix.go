@@ -0,0 +1,407 @@
+package bridge
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	matrixAPI         = "/_matrix/client/v3/"
+	matrixSyncTimeout = 30 * time.Second // How long the homeserver holds a sync open waiting for events
+	matrixTimeout     = matrixSyncTimeout + 30*time.Second
+	// matrixFilter keeps syncs to the messages of rooms
+	matrixFilter = `{"presence":{"types":[]},"account_data":{"types":[]},"room":{"timeline":{"types":["m.room.message","m.room.encrypted"],"limit":50},"state":{"lazy_load_members":true},"ephemeral":{"types":[]}}}`
+)
+
+// Matrix relays messages between Matrix rooms and the agents, syncing with the homeserver as a
+// regular user. Invitations are accepted. In mapped rooms every message is answered by the room's
+// agents, in turn when there are several; elsewhere the default agent answers in rooms it shares
+// with one person and when mentioned.
+//
+// Messages of end-to-end encrypted rooms can only be read through an encryption-aware proxy
+// like pantalaimon, which the bridge connects to as if it were the homeserver
+type Matrix struct {
+	Homeserver   string              // Address of the homeserver, or of pantalaimon for encrypted rooms
+	AccessToken  string              // Access token of the bot's account
+	Rooms        map[string][]string // Agents answering in a room, by room ID or alias
+	DefaultAgent string              // Answers direct chats and mentions, the current agent when empty
+	Engine       Engine
+	Logf         func(format string, args ...any)
+
+	client      *http.Client
+	userID      string
+	displayName string
+	rooms       map[string][]string // Agents by room ID, with the aliases resolved
+	channels    channels
+	txn         atomic.Int64
+	roomsMu     sync.Mutex        // Guards members, names and encrypted
+	members     map[string]int    // Joined members by room ID
+	names       map[string]string // The agent the bot's name was last set to, by room ID
+	encrypted   map[string]bool   // Rooms already told their encrypted messages can't be read
+}
+
+// matrixSync is the response of /sync
+type matrixSync struct {
+	NextBatch string `json:"next_batch"`
+	Rooms     struct {
+		Join map[string]struct {
+			Summary struct {
+				JoinedMembers *int `json:"m.joined_member_count"`
+			} `json:"summary"`
+			Timeline struct {
+				Events []matrixEvent `json:"events"`
+			} `json:"timeline"`
+		} `json:"join"`
+		Invite map[string]json.RawMessage `json:"invite"`
+	} `json:"rooms"`
+}
+
+// matrixEvent is an event of a room's timeline
+type matrixEvent struct {
+	Type    string `json:"type"`
+	Sender  string `json:"sender"`
+	EventID string `json:"event_id"`
+	Content struct {
+		MsgType   string `json:"msgtype"`
+		Body      string `json:"body"`
+		RelatesTo *struct {
+			RelType string `json:"rel_type"`
+			EventID string `json:"event_id"`
+		} `json:"m.relates_to"`
+		Mentions *struct {
+			UserIDs []string `json:"user_ids"`
+		} `json:"m.mentions"`
+	} `json:"content"`
+}
+
+// matrixError is an error returned by the homeserver
+type matrixError struct {
+	Code    string `json:"errcode"`
+	Message string `json:"error"`
+	Retry   int    `json:"retry_after_ms"`
+}
+
+func (e *matrixError) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// Run signs in to the homeserver and relays messages until the access token stops working
+func (m *Matrix) Run() error {
+	if m.Homeserver == "" || m.AccessToken == "" {
+		return fmt.Errorf("a homeserver and an access token are required")
+	}
+	m.Homeserver = strings.TrimRight(m.Homeserver, "/")
+	if !strings.Contains(m.Homeserver, "://") {
+		m.Homeserver = "https://" + m.Homeserver
+	}
+	m.client = &http.Client{Timeout: matrixTimeout}
+	m.members = make(map[string]int)
+	m.names = make(map[string]string)
+	m.encrypted = make(map[string]bool)
+
+	var whoami struct {
+		UserID string `json:"user_id"`
+	}
+	if err := m.call(http.MethodGet, "account/whoami", nil, &whoami); err != nil {
+		return fmt.Errorf("failed to sign in with the access token: %v", err)
+	}
+	m.userID = whoami.UserID
+	var profile struct {
+		DisplayName string `json:"displayname"`
+	}
+	m.call(http.MethodGet, "profile/"+url.PathEscape(m.userID)+"/displayname", nil, &profile)
+	m.displayName = profile.DisplayName
+
+	m.rooms = make(map[string][]string)
+	for room, agents := range m.Rooms {
+		if !strings.HasPrefix(room, "#") {
+			m.rooms[room] = agents
+			continue
+		}
+		var directory struct {
+			RoomID string `json:"room_id"`
+		}
+		if err := m.call(http.MethodGet, "directory/room/"+url.PathEscape(room), nil, &directory); err != nil {
+			return fmt.Errorf("failed to find room %s: %v", room, err)
+		}
+		m.rooms[directory.RoomID] = agents
+	}
+	m.logf("Signed in as %s", m.userID)
+
+	// The first sync only catches up, so messages sent while the bridge was away aren't answered
+	since := ""
+	delay := reconnectInitial
+	for {
+		batch, err := m.sync(since)
+		if err != nil {
+			var matrixErr *matrixError
+			if errors.As(err, &matrixErr) && (matrixErr.Code == "M_UNKNOWN_TOKEN" || matrixErr.Code == "M_FORBIDDEN") {
+				return fmt.Errorf("the homeserver stopped accepting the access token: %v", err)
+			}
+			m.logf("Sync failed: %v", err)
+			m.logf("Retrying in %s", delay)
+			time.Sleep(delay)
+			delay = nextDelay(delay)
+			continue
+		}
+		delay = reconnectInitial
+		if since == "" {
+			m.logf("Listening for messages")
+		}
+		m.process(batch, since != "")
+		since = batch.NextBatch
+	}
+}
+
+// sync waits for new events, since the given batch
+func (m *Matrix) sync(since string) (*matrixSync, error) {
+	query := url.Values{"filter": {matrixFilter}}
+	if since != "" {
+		query.Set("since", since)
+		query.Set("timeout", fmt.Sprint(matrixSyncTimeout.Milliseconds()))
+	}
+	var result matrixSync
+	if err := m.call(http.MethodGet, "sync?"+query.Encode(), nil, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// process accepts invitations and handles the messages of a sync, answering them when asked
+func (m *Matrix) process(batch *matrixSync, answer bool) {
+	for room := range batch.Rooms.Invite {
+		if err := m.call(http.MethodPost, "join/"+url.PathEscape(room), map[string]any{}, nil); err != nil {
+			m.logf("%s: Failed to accept the invitation: %v", room, err)
+			continue
+		}
+		m.logf("%s: Joined", room)
+	}
+	for room, joined := range batch.Rooms.Join {
+		if joined.Summary.JoinedMembers != nil {
+			m.roomsMu.Lock()
+			m.members[room] = *joined.Summary.JoinedMembers
+			m.roomsMu.Unlock()
+		}
+		if !answer {
+			continue
+		}
+		// A room's messages are answered in the order they were sent
+		go func(room string, events []matrixEvent) {
+			for _, event := range events {
+				if event.Sender == m.userID {
+					continue
+				}
+				switch event.Type {
+				case "m.room.message":
+					m.handle(room, event)
+				case "m.room.encrypted":
+					m.warnEncrypted(room)
+				}
+			}
+		}(room, joined.Timeline.Events)
+	}
+}
+
+// handle answers a message when it is meant for the agents
+func (m *Matrix) handle(room string, event matrixEvent) {
+	// Notices are what bots send, and edits were answered as the original message
+	if event.Content.MsgType != "m.text" || (event.Content.RelatesTo != nil && event.Content.RelatesTo.RelType == "m.replace") {
+		return
+	}
+	agents := m.rooms[room]
+	if agents == nil {
+		m.roomsMu.Lock()
+		direct := m.members[room] == 2
+		m.roomsMu.Unlock()
+		if !direct && !m.mentioned(event) {
+			return
+		}
+		agents = []string{m.DefaultAgent}
+	}
+	text := m.stripMention(event.Content.Body)
+	if text == "" {
+		return
+	}
+
+	state := m.channels.get(room)
+	state.acquire()
+	defer state.release()
+
+	conversation{
+		engine:  m.Engine,
+		session: "matrix:" + room,
+		agents:  agents,
+		state:   state,
+		reply: func(agent string) *liveMessage {
+			return m.reply(room, agent, len(agents) > 1, event)
+		},
+		logf: func(format string, args ...any) {
+			m.logf("%s: %s", room, fmt.Sprintf(format, args...))
+		},
+	}.answer(text, 1)
+}
+
+// mentioned reports whether a message mentions the bot
+func (m *Matrix) mentioned(event matrixEvent) bool {
+	if event.Content.Mentions != nil {
+		for _, user := range event.Content.Mentions.UserIDs {
+			if user == m.userID {
+				return true
+			}
+		}
+	}
+	body := strings.ToLower(event.Content.Body)
+	return strings.Contains(body, strings.ToLower(m.userID)) ||
+		(m.displayName != "" && strings.Contains(body, strings.ToLower(m.displayName)))
+}
+
+// stripMention removes the bot's name from the start of a message, as clients insert it when
+// mentioning someone
+func (m *Matrix) stripMention(body string) string {
+	body = strings.TrimSpace(body)
+	for _, name := range []string{m.userID, m.displayName} {
+		if name != "" && len(body) >= len(name) && strings.EqualFold(body[:len(name)], name) {
+			body = strings.TrimSpace(strings.TrimLeft(body[len(name):], ":,"))
+		}
+	}
+	return body
+}
+
+// reply posts an agent's reply in a room, in the thread of the message when it was in one. The
+// bot's name in the room is set to the agent's, and when several agents answer in turn each
+// reply also starts with the agent's name
+func (m *Matrix) reply(room, agent string, several bool, event matrixEvent) *liveMessage {
+	name := agentDisplayName(m.Engine, agent)
+	prefix := ""
+	if several {
+		prefix = name + ": "
+	} else if agent != "" {
+		m.setName(room, name)
+	}
+
+	content := map[string]any{"msgtype": "m.notice", "body": prefix + typingIndicator}
+	if relation := event.Content.RelatesTo; relation != nil && relation.RelType == "m.thread" {
+		content["m.relates_to"] = map[string]any{
+			"rel_type":        "m.thread",
+			"event_id":        relation.EventID,
+			"is_falling_back": true,
+			"m.in_reply_to":   map[string]string{"event_id": event.EventID},
+		}
+	}
+	var sent struct {
+		EventID string `json:"event_id"`
+	}
+	if err := m.send(room, "m.room.message", content, &sent); err != nil {
+		m.logf("%s: Failed to reply: %v", room, err)
+		return newLiveMessage(func(string) error { return nil })
+	}
+
+	// Streaming edits replace the reply's content, clients show the latest
+	return newLiveMessage(func(text string) error {
+		edit := map[string]any{
+			"msgtype":       "m.notice",
+			"body":          "* " + prefix + text,
+			"m.new_content": map[string]string{"msgtype": "m.notice", "body": prefix + text},
+			"m.relates_to":  map[string]string{"rel_type": "m.replace", "event_id": sent.EventID},
+		}
+		return m.send(room, "m.room.message", edit, nil)
+	})
+}
+
+// setName changes the bot's display name in a room to an agent's, unless it already is
+func (m *Matrix) setName(room, name string) {
+	m.roomsMu.Lock()
+	if m.names[room] == name {
+		m.roomsMu.Unlock()
+		return
+	}
+	m.names[room] = name
+	m.roomsMu.Unlock()
+
+	member := map[string]string{"membership": "join", "displayname": name}
+	path := "rooms/" + url.PathEscape(room) + "/state/m.room.member/" + url.PathEscape(m.userID)
+	if err := m.call(http.MethodPut, path, member, nil); err != nil {
+		m.logf("%s: Failed to take %s's name: %v", room, name, err)
+	}
+}
+
+// warnEncrypted tells a room once that its encrypted messages can't be read
+func (m *Matrix) warnEncrypted(room string) {
+	m.roomsMu.Lock()
+	warned := m.encrypted[room]
+	m.encrypted[room] = true
+	m.roomsMu.Unlock()
+	if warned {
+		return
+	}
+	m.logf("%s: Can't read encrypted messages, connect through pantalaimon to chat in encrypted rooms", room)
+	notice := map[string]string{"msgtype": "m.notice", "body": "🔒 I can't read encrypted messages in this room yet."}
+	if err := m.send(room, "m.room.message", notice, nil); err != nil {
+		m.logf("%s: Failed to reply: %v", room, err)
+	}
+}
+
+// send sends an event to a room
+func (m *Matrix) send(room, eventType string, content, result any) error {
+	txn := fmt.Sprintf("chatty-%d-%d", time.Now().UnixNano(), m.txn.Add(1))
+	path := "rooms/" + url.PathEscape(room) + "/send/" + eventType + "/" + txn
+	return m.call(http.MethodPut, path, content, result)
+}
+
+// call sends a request to the client-server API, waiting and trying again when rate limited
+func (m *Matrix) call(method, path string, body, result any) error {
+	var data []byte
+	if body != nil {
+		var err error
+		if data, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(method, m.Homeserver+matrixAPI+path, bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+m.AccessToken)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := m.client.Do(req)
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode >= 300 {
+			matrixErr := &matrixError{}
+			json.NewDecoder(resp.Body).Decode(matrixErr)
+			resp.Body.Close()
+			if matrixErr.Code == "M_LIMIT_EXCEEDED" && attempt < 3 {
+				time.Sleep(time.Duration(matrixErr.Retry+100) * time.Millisecond)
+				continue
+			}
+			if matrixErr.Code == "" {
+				return fmt.Errorf("%s", resp.Status)
+			}
+			return matrixErr
+		}
+		defer resp.Body.Close()
+		if result != nil {
+			return json.NewDecoder(resp.Body).Decode(result)
+		}
+		return nil
+	}
+}
+
+// logf reports what the bridge is doing
+func (m *Matrix) logf(format string, args ...any) {
+	if m.Logf != nil {
+		m.Logf(format, args...)
+	}
+}
@@ -0,0 +1,294 @@
+package bridge
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"chatty/cmd/chatty/websocket"
+)
+
+const (
+	slackAPI     = "https://slack.com/api/"
+	slackTimeout = 30 * time.Second
+)
+
+// mentionPattern matches user mentions like <@U012ABC>
+var mentionPattern = regexp.MustCompile(`<@[A-Z0-9]+>`)
+
+// Slack relays messages between Slack and the agents over Socket Mode, so no public address is
+// needed. In mapped channels every message is answered by the channel's agents, in turn when
+// there are several; elsewhere the default agent answers direct messages and mentions
+type Slack struct {
+	AppToken     string              // App-level token (xapp-) with connections:write
+	BotToken     string              // Bot token (xoxb-)
+	Channels     map[string][]string // Agents answering in a channel, by channel ID or name
+	DefaultAgent string              // Answers direct messages and mentions, the current agent when empty
+	Engine       Engine
+	Logf         func(format string, args ...any)
+
+	client    *http.Client
+	botUserID string
+	channels  channels
+	namesMu   sync.Mutex
+	names     map[string]string // Channel names by ID, looked up once
+}
+
+// slackEnvelope is a message received over Socket Mode
+type slackEnvelope struct {
+	Type       string `json:"type"`
+	EnvelopeID string `json:"envelope_id"`
+	Payload    struct {
+		Event slackEvent `json:"event"`
+	} `json:"payload"`
+}
+
+// slackEvent is a message or mention event
+type slackEvent struct {
+	Type        string `json:"type"`
+	Subtype     string `json:"subtype"`
+	Channel     string `json:"channel"`
+	ChannelType string `json:"channel_type"`
+	User        string `json:"user"`
+	BotID       string `json:"bot_id"`
+	Text        string `json:"text"`
+	TS          string `json:"ts"`
+	ThreadTS    string `json:"thread_ts"`
+}
+
+// Run connects to Slack and relays messages until the connection can't be opened
+func (s *Slack) Run() error {
+	if s.AppToken == "" || s.BotToken == "" {
+		return fmt.Errorf("both an app-level token and a bot token are required")
+	}
+	s.client = &http.Client{Timeout: slackTimeout}
+
+	var auth struct {
+		UserID string `json:"user_id"`
+		Team   string `json:"team"`
+	}
+	if err := s.call("auth.test", s.BotToken, nil, &auth); err != nil {
+		return fmt.Errorf("failed to sign in with the bot token: %v", err)
+	}
+	s.botUserID = auth.UserID
+	s.logf("Signed in to %s", auth.Team)
+
+	delay := reconnectInitial
+	for {
+		connected, err := s.listen()
+		if connected {
+			delay = reconnectInitial
+		}
+		if err != nil && !connected {
+			if strings.Contains(err.Error(), "invalid_auth") || strings.Contains(err.Error(), "not_allowed_token_type") {
+				return fmt.Errorf("failed to open a Socket Mode connection: %v", err)
+			}
+			s.logf("Connection failed: %v", err)
+		} else if err != nil {
+			s.logf("Connection lost: %v", err)
+		}
+		s.logf("Reconnecting in %s", delay)
+		time.Sleep(delay)
+		delay = nextDelay(delay)
+	}
+}
+
+// listen opens a Socket Mode connection and handles its events until Slack asks to reconnect
+// or the connection drops. It reports whether the connection was opened
+func (s *Slack) listen() (bool, error) {
+	var open struct {
+		URL string `json:"url"`
+	}
+	if err := s.call("apps.connections.open", s.AppToken, nil, &open); err != nil {
+		return false, err
+	}
+	conn, err := websocket.Dial(open.URL, maxMessageSize)
+	if err != nil {
+		return false, err
+	}
+	defer conn.Close()
+
+	for {
+		data, err := conn.ReadMessage()
+		if err != nil {
+			return true, err
+		}
+		var envelope slackEnvelope
+		if err := json.Unmarshal(data, &envelope); err != nil {
+			continue
+		}
+		if envelope.EnvelopeID != "" {
+			ack, _ := json.Marshal(map[string]string{"envelope_id": envelope.EnvelopeID})
+			if err := conn.WriteText(ack); err != nil {
+				return true, err
+			}
+		}
+		switch envelope.Type {
+		case "hello":
+			s.logf("Connected, listening for messages")
+		case "disconnect":
+			return true, nil
+		case "events_api":
+			go s.handle(envelope.Payload.Event)
+		}
+	}
+}
+
+// handle answers a message when it is meant for the agents
+func (s *Slack) handle(event slackEvent) {
+	if event.BotID != "" || event.Subtype != "" || event.User == "" || event.User == s.botUserID {
+		return
+	}
+	agents := s.channelAgents(event.Channel)
+	switch event.Type {
+	case "message":
+		// Messages are answered in mapped channels and direct messages, mentions elsewhere
+		if agents == nil && event.ChannelType != "im" {
+			return
+		}
+	case "app_mention":
+		if agents != nil {
+			return // Already answered as a message of the channel
+		}
+	default:
+		return
+	}
+	if agents == nil {
+		agents = []string{s.DefaultAgent}
+	}
+	text := strings.TrimSpace(mentionPattern.ReplaceAllString(event.Text, ""))
+	if text == "" {
+		return
+	}
+
+	state := s.channels.get(event.Channel)
+	state.acquire()
+	defer state.release()
+
+	conversation{
+		engine:  s.Engine,
+		session: "slack:" + event.Channel,
+		agents:  agents,
+		state:   state,
+		reply: func(agent string) *liveMessage {
+			ts, err := s.post(event, agent, typingIndicator)
+			if err != nil {
+				s.logf("%s: Failed to reply: %v", event.Channel, err)
+				return newLiveMessage(func(string) error { return nil })
+			}
+			return newLiveMessage(func(text string) error { return s.update(event.Channel, ts, text) })
+		},
+		logf: func(format string, args ...any) {
+			s.logf("%s: %s", event.Channel, fmt.Sprintf(format, args...))
+		},
+	}.answer(text, 1)
+}
+
+// channelAgents returns the agents mapped to a channel by ID or name, nil when it has none
+func (s *Slack) channelAgents(channel string) []string {
+	return mappedAgents(s.Channels, channel, func() string { return s.channelName(channel) })
+}
+
+// channelName looks up a channel's name, empty for direct messages or without the channels:read scope
+func (s *Slack) channelName(channel string) string {
+	s.namesMu.Lock()
+	defer s.namesMu.Unlock()
+	if name, ok := s.names[channel]; ok {
+		return name
+	}
+	var info struct {
+		Channel struct {
+			Name string `json:"name"`
+		} `json:"channel"`
+	}
+	if err := s.call("conversations.info", s.BotToken, map[string]string{"channel": channel}, &info); err != nil {
+		s.logf("Failed to look up channel %s: %v", channel, err)
+	}
+	if s.names == nil {
+		s.names = make(map[string]string)
+	}
+	s.names[channel] = info.Channel.Name
+	return info.Channel.Name
+}
+
+// post replies to a message as an agent, in its thread when it was in one, and returns the reply's timestamp
+func (s *Slack) post(event slackEvent, agent, text string) (string, error) {
+	params := map[string]string{"channel": event.Channel, "text": text}
+	if event.ThreadTS != "" {
+		params["thread_ts"] = event.ThreadTS
+	}
+	if agent != "" {
+		params["username"] = agentDisplayName(s.Engine, agent)
+	}
+	var result struct {
+		TS string `json:"ts"`
+	}
+	if err := s.call("chat.postMessage", s.BotToken, params, &result); err != nil {
+		return "", err
+	}
+	return result.TS, nil
+}
+
+// update replaces the text of a posted message
+func (s *Slack) update(channel, ts, text string) error {
+	return s.call("chat.update", s.BotToken, map[string]string{"channel": channel, "ts": ts, "text": text}, nil)
+}
+
+// call invokes a Web API method with form-encoded arguments, which every method accepts,
+// waiting and trying again when rate limited
+func (s *Slack) call(method, token string, params map[string]string, result any) error {
+	form := url.Values{}
+	for key, value := range params {
+		form.Set(key, value)
+	}
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequest(http.MethodPost, slackAPI+method, strings.NewReader(form.Encode()))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		resp, err := s.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("%s failed: %v", method, err)
+		}
+		if resp.StatusCode == http.StatusTooManyRequests && attempt < 3 {
+			resp.Body.Close()
+			wait, _ := strconv.Atoi(resp.Header.Get("Retry-After"))
+			time.Sleep(time.Duration(wait+1) * time.Second)
+			continue
+		}
+
+		var raw json.RawMessage
+		err = json.NewDecoder(resp.Body).Decode(&raw)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("%s failed: %s", method, resp.Status)
+		}
+		var status struct {
+			OK    bool   `json:"ok"`
+			Error string `json:"error"`
+		}
+		json.Unmarshal(raw, &status)
+		if !status.OK {
+			return fmt.Errorf("%s failed: %s", method, status.Error)
+		}
+		if result != nil {
+			return json.Unmarshal(raw, result)
+		}
+		return nil
+	}
+}
+
+// logf reports what the bridge is doing
+func (s *Slack) logf(format string, args ...any) {
+	if s.Logf != nil {
+		s.Logf(format, args...)
+	}
+}
@@ -2,36 +2,60 @@ package builder
 
 import (
 	"bufio"
+	"bytes"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"chatty/cmd/chatty/agents"
+	"chatty/cmd/chatty/appdir"
+	"chatty/cmd/chatty/keys"
+	"chatty/cmd/chatty/term"
+	"chatty/cmd/chatty/theme"
 )
 
 const (
-	ollamaBaseURL = "http://localhost:11434/api/generate"  // Full URL for Ollama generate API
 	ollamaModel   = "llama3.2"  // Model to use for generating agent configurations
 
 	// Default ANSI color codes
 	defaultLabelColor = "\u001b[38;5;39m"  // Light blue
 	defaultTextColor  = "\u001b[38;5;251m" // Light gray
+)
 
-	// UI Colors
-	colorTitle = "\u001b[38;5;39m"    // Light blue for titles
-	colorSection = "\u001b[38;5;171m" // Purple for section headers
-	colorHighlight = "\u001b[38;5;82m" // Green for highlights
-	colorPrompt = "\u001b[38;5;251m"   // Light gray for prompts
-	colorValue = "\u001b[38;5;255m"    // White for values
-	colorAccent = "\u001b[38;5;208m"   // Orange for accents
-	colorReset = "\u001b[0m"           // Reset color
-	colorGreen = "\u001b[32m"          // Green for success marks
-	colorRed = "\u001b[31m"            // Red for error messages
+// UI Colors, taken from the active theme when a handler is created
+var (
+	colorTitle     string // Titles
+	colorSection   string // Section headers
+	colorHighlight string // Highlights
+	colorPrompt    string // Prompts
+	colorValue     string // Values
+	colorAccent    string // Accents
+	colorReset     string // Reset color
+	colorGreen     string // Success marks
+	colorRed       string // Error messages
 )
 
+// applyTheme loads the UI colors from the active theme
+func applyTheme() {
+	palette := theme.Current()
+	colorTitle = palette.Title
+	colorSection = palette.Subtitle
+	colorHighlight = palette.Highlight
+	colorPrompt = palette.Prompt
+	colorValue = palette.Bright
+	colorAccent = palette.Accent
+	colorReset = palette.Reset
+	colorGreen = palette.Success
+	colorRed = palette.Error
+}
+
 // Animation represents a loading animation
 type Animation struct {
 	stopChan chan bool
@@ -167,8 +191,10 @@ type Handler struct {
 
 // NewHandler creates a new builder handler
 func NewHandler(debug bool) *Handler {
+	applyTheme()
+
 	// Create the LLM client with the model specifically for building agents
-	llm := NewOllamaClient(ollamaBaseURL, ollamaModel)
+	llm := NewOllamaClient(agents.OllamaURL()+"/api/generate", ollamaModel)
 	llm.SetDebug(debug)  // Set debug mode on the LLM client
 
 	// Create the builder with default configuration
@@ -200,9 +226,10 @@ type menuOption struct {
 
 // readKey reads a single keystroke from stdin
 func readKey() ([]byte, error) {
-	// Put terminal in raw mode
-	exec.Command("stty", "-F", "/dev/tty", "raw").Run()
-	defer exec.Command("stty", "-F", "/dev/tty", "cooked").Run()
+	// Put terminal in raw mode. Input that isn't a terminal is read as it comes
+	if restore, err := term.MakeRaw(os.Stdin); err == nil {
+		defer restore()
+	}
 
 	buffer := make([]byte, 3)
 	n, err := os.Stdin.Read(buffer)
@@ -246,7 +273,7 @@ func showLightBarMenu(title string, options []menuOption, defaultIndex int) (int
 		}
 
 		// Show navigation help
-		fmt.Printf("\n%s↑/↓: Navigate • Enter: Select • Esc: Cancel%s\n", colorPrompt, colorReset)
+		fmt.Printf("\n%s↑/↓: Navigate • %s: Select • %s: Cancel%s\n", colorPrompt, keys.Label(keys.Send), keys.Label(keys.Cancel), colorReset)
 	}
 	
 	// Initial menu draw
@@ -260,29 +287,24 @@ func showLightBarMenu(title string, options []menuOption, defaultIndex int) (int
 		}
 
 		// Handle key press
-		if len(key) == 1 {
-			switch key[0] {
-			case 13: // Enter
-				// Clear just the menu area
-				fmt.Print("\033[u\033[J")
-				return currentIndex, nil
-			case 27: // Escape
-				// Clear just the menu area
-				fmt.Print("\033[u\033[J")
-				return -1, nil
+		switch name := keys.Name(key); {
+		case keys.Matches(keys.Send, name):
+			// Clear just the menu area
+			fmt.Print("\033[u\033[J")
+			return currentIndex, nil
+		case keys.Matches(keys.Cancel, name): // Ctrl+C arrives as a key in raw mode
+			// Clear just the menu area
+			fmt.Print("\033[u\033[J")
+			return -1, nil
+		case name == "up":
+			if currentIndex > 0 {
+				currentIndex--
+				drawMenu()
 			}
-		} else if len(key) == 3 {
-			switch key[2] {
-			case 65: // Up arrow
-				if currentIndex > 0 {
-					currentIndex--
-					drawMenu()
-				}
-			case 66: // Down arrow
-				if currentIndex < len(options)-1 {
-					currentIndex++
-					drawMenu()
-				}
+		case name == "down":
+			if currentIndex < len(options)-1 {
+				currentIndex++
+				drawMenu()
 			}
 		}
 	}
@@ -506,28 +528,7 @@ func (h *Handler) HandleBuildCommand(args []string) error {
 	}
 
 	// Generate the initial agent configuration
-	var agent *AgentSchema
-	var err error
-	maxRetries := 3
-	
-	for attempt := 1; attempt <= maxRetries; attempt++ {
-		if h.debug {
-			fmt.Printf("\n%s🔄 Debug Mode: Attempt %d of %d...%s\n", colorAccent, attempt, maxRetries, colorReset)
-		}
-		
-		agent, err = h.builder.BuildAgent(description)
-		if err == nil {
-			break // Success, exit retry loop
-		}
-		
-		if attempt < maxRetries {
-			if h.debug {
-				fmt.Printf("\n%s❌ Debug Mode: Attempt %d failed: %v%s\n", colorAccent, attempt, err, colorReset)
-				fmt.Printf("%s⏳ Debug Mode: Retrying in 2 seconds...%s\n", colorAccent, colorReset)
-			}
-			time.Sleep(2 * time.Second) // Wait before retrying
-		}
-	}
+	agent, err := h.Generate(description)
 	
 	// Stop the animation if it was started
 	if anim != nil {
@@ -563,7 +564,7 @@ func (h *Handler) HandleBuildCommand(args []string) error {
 			return nil
 		}
 		
-		return fmt.Errorf("failed to build agent after %d attempts: %v", maxRetries, err)
+		return err
 	}
 
 	if h.debug {
@@ -632,16 +633,11 @@ func (h *Handler) HandleBuildCommand(args []string) error {
 	fmt.Printf("%s═════════%s\n", colorSection, colorReset)
 	previewAgent(*agent)
 
-	// Get the user's agents directory
-	homeDir, err := os.UserHomeDir()
+	// Get the output file path in the user's agents directory
+	outputPath, err := agentPath(agent.Name)
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %v", err)
+		return err
 	}
-	agentsDir := filepath.Join(homeDir, ".chatty", "agents")
-
-	// Create the output file path
-	filename := strings.ToLower(strings.ReplaceAll(agent.Name, " ", "_")) + ".yaml"
-	outputPath := filepath.Join(agentsDir, filename)
 
 	// Show save options menu
 	fmt.Printf("\n%s💾 Next Steps%s\n", colorSection, colorReset)
@@ -736,6 +732,143 @@ func (h *Handler) HandleBuildCommand(args []string) error {
 	return nil
 }
 
+// maxBuildAttempts is how many times the model is asked for an agent before giving up
+const maxBuildAttempts = 3
+
+// Generate asks the model for an agent matching a description, retrying failed attempts
+func (h *Handler) Generate(description string) (*AgentSchema, error) {
+	var agent *AgentSchema
+	var err error
+	for attempt := 1; attempt <= maxBuildAttempts; attempt++ {
+		if h.debug {
+			fmt.Printf("\n%s🔄 Debug Mode: Attempt %d of %d...%s\n", colorAccent, attempt, maxBuildAttempts, colorReset)
+		}
+		
+		agent, err = h.builder.BuildAgent(description)
+		if err == nil {
+			return agent, nil
+		}
+		
+		if attempt < maxBuildAttempts {
+			if h.debug {
+				fmt.Printf("\n%s❌ Debug Mode: Attempt %d failed: %v%s\n", colorAccent, attempt, err, colorReset)
+				fmt.Printf("%s⏳ Debug Mode: Retrying in 2 seconds...%s\n", colorAccent, colorReset)
+			}
+			time.Sleep(2 * time.Second) // Wait before retrying
+		}
+	}
+	return nil, fmt.Errorf("failed to build agent after %d attempts: %v", maxBuildAttempts, err)
+}
+
+// ErrAgentExists is returned when saving an agent would replace another agent's file
+var ErrAgentExists = errors.New("an agent file already exists")
+
+// SaveToAgents saves an agent to the user's agents directory, with the default colors when it
+// has none, and returns the path of its file. An existing agent with the same file name is
+// left alone
+func (h *Handler) SaveToAgents(agent *AgentSchema) (string, error) {
+	if agent.LabelColor == "" {
+		agent.LabelColor = defaultLabelColor
+	}
+	if agent.TextColor == "" {
+		agent.TextColor = defaultTextColor
+	}
+	outputPath, err := agentPath(agent.Name)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(outputPath); err == nil {
+		return "", fmt.Errorf("%w at %s", ErrAgentExists, outputPath)
+	}
+	if err := h.builder.SaveAgent(agent, outputPath); err != nil {
+		return "", fmt.Errorf("failed to save agent: %v", err)
+	}
+	return outputPath, nil
+}
+
+// EditAgentFile opens the edit menu on the agent saved at path and writes back the fields
+// changed, leaving the rest of the file as it was. It returns the agent as saved, nil when the
+// edit was cancelled
+func (h *Handler) EditAgentFile(path string) (*AgentSchema, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read agent file: %v", err)
+	}
+	var agent AgentSchema
+	if err := yaml.Unmarshal(data, &agent); err != nil {
+		return nil, fmt.Errorf("failed to parse agent file: %v", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil || len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("agent file %s is not a YAML mapping", path)
+	}
+
+	original := agent
+	if !editAgentFields(&agent) {
+		return nil, nil
+	}
+
+	fields := doc.Content[0]
+	changes := []struct {
+		key           string
+		before, after any
+	}{
+		{"name", original.Name, agent.Name},
+		{"emoji", original.Emoji, agent.Emoji},
+		{"description", original.Description, agent.Description},
+		{"system_message", original.SystemMessage, agent.SystemMessage},
+		{"tags", original.Tags, agent.Tags},
+	}
+	for _, change := range changes {
+		if reflect.DeepEqual(change.before, change.after) {
+			continue
+		}
+		if err := setField(fields, change.key, change.after); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	encoder := yaml.NewEncoder(&out)
+	encoder.SetIndent(2) // Like the rest of the file
+	if err := encoder.Encode(&doc); err != nil {
+		return nil, fmt.Errorf("failed to marshal agent configuration: %v", err)
+	}
+	encoder.Close()
+	if err := os.WriteFile(path, out.Bytes(), 0644); err != nil {
+		return nil, fmt.Errorf("failed to write agent configuration: %v", err)
+	}
+	return &agent, nil
+}
+
+// setField sets a field of a YAML mapping to a value, adding it at the end when missing
+func setField(mapping *yaml.Node, key string, value any) error {
+	var valueNode yaml.Node
+	if err := valueNode.Encode(value); err != nil {
+		return fmt.Errorf("failed to encode %s: %v", key, err)
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			mapping.Content[i+1] = &valueNode
+			return nil
+		}
+	}
+	var keyNode yaml.Node
+	keyNode.SetString(key)
+	mapping.Content = append(mapping.Content, &keyNode, &valueNode)
+	return nil
+}
+
+// agentPath returns the file an agent is saved to in the user's agents directory
+func agentPath(name string) (string, error) {
+	configDir, err := appdir.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	filename := strings.ToLower(strings.ReplaceAll(name, " ", "_")) + ".yaml"
+	return filepath.Join(configDir, "agents", filename), nil
+}
+
 // readMultilineInput reads multiline input with a default value
 func readMultilineInput(prompt, defaultValue string) string {
 	fmt.Printf("\n%s (Press Ctrl+D or type ':wq' on a new line to finish):\n", prompt)
@@ -0,0 +1,253 @@
+// Package campaign keeps the state of tabletop role-playing games run by a game-master agent:
+// the current scene, the party's inventory and the facts worth remembering, saved after every
+// change so a campaign can go on in a later session
+package campaign
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+
+	"chatty/cmd/chatty/appdir"
+	"chatty/cmd/chatty/atomicfile"
+)
+
+const (
+	campaignsDir = "campaigns" // A JSON file per campaign
+	maxNotes     = 50          // Oldest notes are dropped past this
+)
+
+// Item is something the party carries
+type Item struct {
+	Name     string `json:"name"`
+	Quantity int    `json:"quantity"`
+}
+
+// State is where a campaign stands
+type State struct {
+	Name      string    `json:"name"`
+	Scene     string    `json:"scene,omitempty"` // Where the party is and what is going on
+	Inventory []Item    `json:"inventory,omitempty"`
+	Notes     []string  `json:"notes,omitempty"` // Quests, characters met, clues
+	Recap     string    `json:"recap,omitempty"` // The story so far, written when a session ends
+	Sessions  int       `json:"sessions"`        // Sessions played to the end
+	Updated   time.Time `json:"updated"`
+
+	path string
+}
+
+// Dir returns the directory campaigns are kept in
+func Dir() (string, error) {
+	dataDir, err := appdir.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, campaignsDir), nil
+}
+
+// fileName turns a campaign name into the name of its file, like the-lost-mine.json
+func fileName(name string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(name) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash && sb.Len() > 0 {
+			sb.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "-") + ".json"
+}
+
+// Load returns the state of a campaign, or a new one when it was never played
+func Load(name string) (*State, error) {
+	name = strings.TrimSpace(name)
+	if fileName(name) == ".json" {
+		return nil, fmt.Errorf("campaign name '%s' needs letters or digits", name)
+	}
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fileName(name))
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &State{Name: name, path: path}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read campaign: %v", err)
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("failed to parse campaign %s: %v", path, err)
+	}
+	state.path = path
+	return &state, nil
+}
+
+// List returns the names of the saved campaigns, the most recently played first
+func List() ([]string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var states []State
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var state State
+		if json.Unmarshal(data, &state) == nil && state.Name != "" {
+			states = append(states, state)
+		}
+	}
+	sort.Slice(states, func(i, j int) bool {
+		return states[i].Updated.After(states[j].Updated)
+	})
+	names := make([]string, len(states))
+	for i, state := range states {
+		names[i] = state.Name
+	}
+	return names, nil
+}
+
+// New reports whether the campaign is starting, with nothing saved yet
+func (s *State) New() bool {
+	return s.Updated.IsZero()
+}
+
+// Save writes the state to its file
+func (s *State) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create campaigns directory: %v", err)
+	}
+	s.Updated = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode campaign: %v", err)
+	}
+	if err := atomicfile.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save campaign: %v", err)
+	}
+	return nil
+}
+
+// SetScene replaces the description of the current scene
+func (s *State) SetScene(scene string) {
+	s.Scene = strings.TrimSpace(scene)
+}
+
+// AddNote remembers a fact, forgetting the oldest ones past maxNotes
+func (s *State) AddNote(note string) {
+	if note = strings.TrimSpace(note); note == "" {
+		return
+	}
+	s.Notes = append(s.Notes, note)
+	if len(s.Notes) > maxNotes {
+		s.Notes = s.Notes[len(s.Notes)-maxNotes:]
+	}
+}
+
+// AddItems adds items listed like "2 torches, a rope" to the inventory
+func (s *State) AddItems(list string) {
+	for _, item := range parseItems(list) {
+		if i := s.find(item.Name); i >= 0 {
+			s.Inventory[i].Quantity += item.Quantity
+		} else {
+			s.Inventory = append(s.Inventory, item)
+		}
+	}
+}
+
+// RemoveItems takes items listed like "1 torch, the rope" out of the inventory, returning the
+// ones the party doesn't have
+func (s *State) RemoveItems(list string) []string {
+	var missing []string
+	for _, item := range parseItems(list) {
+		i := s.find(item.Name)
+		if i < 0 {
+			missing = append(missing, item.Name)
+			continue
+		}
+		s.Inventory[i].Quantity -= item.Quantity
+		if s.Inventory[i].Quantity <= 0 {
+			s.Inventory = append(s.Inventory[:i], s.Inventory[i+1:]...)
+		}
+	}
+	return missing
+}
+
+// find returns the index of an item in the inventory, or -1. A torch is found among torches
+func (s *State) find(name string) int {
+	for i, item := range s.Inventory {
+		if sameItem(item.Name, name) || sameItem(name, item.Name) {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameItem reports whether two names are the same item, or the plural of b is a
+func sameItem(a, b string) bool {
+	return strings.EqualFold(a, b) || strings.EqualFold(a, b+"s") || strings.EqualFold(a, b+"es")
+}
+
+// parseItems reads a comma-separated list of items, each with an optional quantity
+func parseItems(list string) []Item {
+	var items []Item
+	for _, part := range strings.Split(list, ",") {
+		fields := strings.Fields(part)
+		if len(fields) == 0 {
+			continue
+		}
+		quantity := 1
+		if n, err := strconv.Atoi(fields[0]); err == nil && len(fields) > 1 {
+			quantity = n
+			fields = fields[1:]
+		} else if len(fields) > 1 && (strings.EqualFold(fields[0], "a") || strings.EqualFold(fields[0], "an") || strings.EqualFold(fields[0], "the")) {
+			fields = fields[1:]
+		}
+		if quantity > 0 {
+			items = append(items, Item{Name: strings.Join(fields, " "), Quantity: quantity})
+		}
+	}
+	return items
+}
+
+// Describe renders the state for the game master and for display
+func (s *State) Describe() string {
+	var sb strings.Builder
+	scene := s.Scene
+	if scene == "" {
+		scene = "(not set yet)"
+	}
+	fmt.Fprintf(&sb, "Scene: %s\n", scene)
+	sb.WriteString("Inventory:")
+	if len(s.Inventory) == 0 {
+		sb.WriteString(" (empty)")
+	}
+	for _, item := range s.Inventory {
+		fmt.Fprintf(&sb, "\n- %d × %s", item.Quantity, item.Name)
+	}
+	if len(s.Notes) > 0 {
+		sb.WriteString("\nNotes:")
+		for _, note := range s.Notes {
+			fmt.Fprintf(&sb, "\n- %s", note)
+		}
+	}
+	return sb.String()
+}
@@ -0,0 +1,75 @@
+package campaign
+
+import (
+	"fmt"
+	"math/rand"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+const (
+	maxDice  = 100  // Dice in a single roll
+	maxSides = 1000 // Sides of a die
+)
+
+var dicePattern = regexp.MustCompile(`^(\d*)d(\d+|%)([+-]\d+)?$`)
+
+// Roll is the outcome of rolling dice
+type Roll struct {
+	Notation string
+	Dice     []int // Each die, in the order rolled
+	Modifier int
+	Total    int
+}
+
+// RollDice rolls dice in tabletop notation: 1d20, d20+5, 4d6-1 or d% for 1d100
+func RollDice(notation string) (Roll, error) {
+	notation = strings.ToLower(strings.ReplaceAll(notation, " ", ""))
+	match := dicePattern.FindStringSubmatch(notation)
+	if match == nil {
+		return Roll{}, fmt.Errorf("'%s' is not dice notation like 1d20, 2d6+3 or d%%", notation)
+	}
+	count := 1
+	if match[1] != "" {
+		count, _ = strconv.Atoi(match[1])
+	}
+	sides := 100
+	if match[2] != "%" {
+		sides, _ = strconv.Atoi(match[2])
+	}
+	if count < 1 || count > maxDice {
+		return Roll{}, fmt.Errorf("roll between 1 and %d dice, not %d", maxDice, count)
+	}
+	if sides < 2 || sides > maxSides {
+		return Roll{}, fmt.Errorf("dice have between 2 and %d sides, not %d", maxSides, sides)
+	}
+
+	roll := Roll{Notation: notation}
+	if match[3] != "" {
+		roll.Modifier, _ = strconv.Atoi(match[3])
+	}
+	roll.Total = roll.Modifier
+	for i := 0; i < count; i++ {
+		die := rand.Intn(sides) + 1
+		roll.Dice = append(roll.Dice, die)
+		roll.Total += die
+	}
+	return roll, nil
+}
+
+// String shows the roll as 2d6+3: [4, 1] + 3 = 8
+func (r Roll) String() string {
+	dice := make([]string, len(r.Dice))
+	for i, die := range r.Dice {
+		dice[i] = strconv.Itoa(die)
+	}
+	text := fmt.Sprintf("%s: [%s]", r.Notation, strings.Join(dice, ", "))
+	switch {
+	case r.Modifier > 0:
+		text += fmt.Sprintf(" + %d", r.Modifier)
+	case r.Modifier < 0:
+		text += fmt.Sprintf(" - %d", -r.Modifier)
+	}
+	return fmt.Sprintf("%s = %d", text, r.Total)
+}
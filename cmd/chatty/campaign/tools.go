@@ -0,0 +1,66 @@
+package campaign
+
+import (
+	"fmt"
+	"strings"
+
+	"chatty/cmd/chatty/tools"
+)
+
+// Names of the tools the game master gets
+const (
+	RollTool   = "roll_dice"
+	UpdateTool = "update_game_state"
+)
+
+// Tools returns the tools the game master runs a campaign with: dice rolls, and changes to the
+// scene, inventory and notes, saved as soon as they are made
+func Tools(state *State) []tools.Tool {
+	return []tools.Tool{
+		{
+			Name:        RollTool,
+			Description: "Roll dice for checks, attacks, damage and chance: the result is random and must be respected",
+			Parameters: map[string]tools.Property{
+				"notation": {Type: "string", Description: "Dice in tabletop notation, such as 1d20+3, 2d6 or d%"},
+				"reason":   {Type: "string", Description: "What the roll decides, such as 'Stealth check'"},
+			},
+			Required: []string{"notation"},
+			Run: func(args tools.Arguments) (string, error) {
+				roll, err := RollDice(args.String("notation"))
+				if err != nil {
+					return "", err
+				}
+				if reason := strings.TrimSpace(args.String("reason")); reason != "" {
+					return reason + ": " + roll.String(), nil
+				}
+				return roll.String(), nil
+			},
+		},
+		{
+			Name:        UpdateTool,
+			Description: "Record changes to the game: a new scene, items the party gains or loses, and facts to remember in later sessions",
+			Parameters: map[string]tools.Property{
+				"scene":        {Type: "string", Description: "New description of where the party is and what is happening"},
+				"add_items":    {Type: "string", Description: "Comma-separated items the party gains, with quantities, such as '2 torches, rope'"},
+				"remove_items": {Type: "string", Description: "Comma-separated items the party uses up or loses, such as '1 torch'"},
+				"note":         {Type: "string", Description: "A fact to remember: a quest, a character met, a clue or a promise"},
+			},
+			Run: func(args tools.Arguments) (string, error) {
+				if scene := args.String("scene"); scene != "" {
+					state.SetScene(scene)
+				}
+				state.AddItems(args.String("add_items"))
+				missing := state.RemoveItems(args.String("remove_items"))
+				state.AddNote(args.String("note"))
+				if err := state.Save(); err != nil {
+					return "", err
+				}
+				result := "Saved. The game is now:\n" + state.Describe()
+				if len(missing) > 0 {
+					result = fmt.Sprintf("The party doesn't have: %s. ", strings.Join(missing, ", ")) + result
+				}
+				return result, nil
+			},
+		},
+	}
+}
@@ -0,0 +1,119 @@
+// Package elapsed describes how long something took, such as a conversation, breaking the time
+// into calendar years, months and days so long sessions read right across months of any length
+package elapsed
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Styles of formatting
+const (
+	Long    = "long"    // "1 hour, 23 minutes"
+	Compact = "compact" // "1h 23m"
+	Clock   = "clock"   // "1:23:05"
+)
+
+// Styles lists the formatting styles, for validating settings
+var Styles = []string{Long, Compact, Clock}
+
+// unit is one part of an elapsed time, with its long and compact names
+type unit struct {
+	count           int
+	singular, short string
+}
+
+// Format describes the time from start to end in the style, Long when it isn't known. Times
+// under a minute are given in seconds, longer ones down to the minute
+func Format(start, end time.Time, style string) string {
+	if end.Before(start) {
+		end = start
+	}
+	if style == Clock {
+		return clock(end.Sub(start))
+	}
+	years, months, days, rest := breakdown(start, end)
+
+	units := []unit{
+		{years, "year", "y"},
+		{months, "month", "mo"},
+		{days / 7, "week", "w"},
+		{days % 7, "day", "d"},
+		{int(rest / time.Hour), "hour", "h"},
+		{int(rest % time.Hour / time.Minute), "minute", "m"},
+	}
+	if end.Sub(start) < time.Minute {
+		units = []unit{{int(rest / time.Second), "second", "s"}}
+	}
+
+	var parts []string
+	for _, u := range units {
+		if u.count == 0 {
+			continue
+		}
+		if style == Compact {
+			parts = append(parts, fmt.Sprintf("%d%s", u.count, u.short))
+		} else {
+			parts = append(parts, plural(u.count, u.singular))
+		}
+	}
+	if len(parts) == 0 {
+		last := units[len(units)-1]
+		if style == Compact {
+			return "0" + last.short
+		}
+		return plural(0, last.singular)
+	}
+	if style == Compact {
+		return strings.Join(parts, " ")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// breakdown splits the time from start to end into whole calendar years, months and days, and
+// what is left under a day. A month from January 31st ends on the last day of February
+func breakdown(start, end time.Time) (years, months, days int, rest time.Duration) {
+	end = end.In(start.Location())
+	total := (end.Year()-start.Year())*12 + int(end.Month()-start.Month())
+	anchor := addMonths(start, total)
+	for total > 0 && anchor.After(end) {
+		total--
+		anchor = addMonths(start, total)
+	}
+
+	// Days aren't always 24 hours across daylight saving changes, so step by calendar day
+	days = int(end.Sub(anchor) / (24 * time.Hour))
+	for !anchor.AddDate(0, 0, days+1).After(end) {
+		days++
+	}
+	for days > 0 && anchor.AddDate(0, 0, days).After(end) {
+		days--
+	}
+	rest = end.Sub(anchor.AddDate(0, 0, days))
+	return total / 12, total % 12, days, rest
+}
+
+// addMonths moves t by months, staying on the last day of shorter months instead of spilling
+// into the next one
+func addMonths(t time.Time, months int) time.Time {
+	moved := t.AddDate(0, months, 0)
+	if moved.Day() != t.Day() {
+		moved = moved.AddDate(0, 0, -moved.Day())
+	}
+	return moved
+}
+
+// clock formats d as hours, minutes and seconds, like "1:23:05" or "0:00:42"
+func clock(d time.Duration) string {
+	seconds := int(d / time.Second)
+	return fmt.Sprintf("%d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// plural returns a count with its unit, like "1 hour" or "3 hours"
+func plural(count int, singular string) string {
+	if count == 1 {
+		return "1 " + singular
+	}
+	return fmt.Sprintf("%d %ss", count, singular)
+}
@@ -0,0 +1,36 @@
+package export
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"chatty/cmd/chatty/speech"
+)
+
+// pauseBetweenSpeakers is the silence inserted between messages
+const pauseBetweenSpeakers = 600 * time.Millisecond
+
+// WriteAudio renders each message with its speaker's voice and joins them into a single WAV file
+func WriteAudio(path string, t Transcript, speaker *speech.Speaker) error {
+	dir, err := os.MkdirTemp("", "chatty-export")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	var parts []string
+	for i, entry := range t.Entries {
+		fmt.Printf("\rRendering audio: message %d of %d", i+1, len(t.Entries))
+		part := filepath.Join(dir, fmt.Sprintf("%04d.wav", i))
+		if err := speaker.Synthesize(entry.Text, entry.Voice, part); err != nil {
+			fmt.Println()
+			return fmt.Errorf("failed to render message %d: %v", i+1, err)
+		}
+		parts = append(parts, part)
+	}
+	fmt.Println()
+
+	return speech.ConcatWAV(path, parts, pauseBetweenSpeakers)
+}
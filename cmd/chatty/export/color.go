@@ -0,0 +1,84 @@
+package export
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// rgb is a PDF color with components between 0 and 1
+type rgb struct {
+	r, g, b float64
+}
+
+var (
+	colorText     = rgb{0.13, 0.13, 0.13}
+	colorMuted    = rgb{0.45, 0.45, 0.45}
+	colorCode     = rgb{0.25, 0.25, 0.3}
+	colorSpeaker  = rgb{0.1, 0.35, 0.55} // Used when a speaker has no color
+	maxLuminance  = 0.55                 // Lighter colors are darkened to stay readable on paper
+	sgrPattern    = regexp.MustCompile(`\x1b\[([0-9;]*)m`)
+	basicPalette  = [8]rgb{{0, 0, 0}, {0.8, 0, 0}, {0, 0.6, 0}, {0.8, 0.6, 0}, {0, 0.3, 0.8}, {0.7, 0, 0.7}, {0, 0.6, 0.7}, {0.75, 0.75, 0.75}}
+	brightPalette = [8]rgb{{0.5, 0.5, 0.5}, {1, 0.3, 0.3}, {0.3, 0.9, 0.3}, {1, 1, 0.3}, {0.4, 0.5, 1}, {1, 0.4, 1}, {0.3, 1, 1}, {1, 1, 1}}
+)
+
+// ansiToRGB converts an ANSI SGR color sequence (basic or 256 colors) to a printable color
+func ansiToRGB(code string) rgb {
+	match := sgrPattern.FindStringSubmatch(code)
+	if match == nil {
+		return colorSpeaker
+	}
+
+	params := strings.Split(match[1], ";")
+	color, found := colorSpeaker, false
+	for i := 0; i < len(params); i++ {
+		n, err := strconv.Atoi(params[i])
+		if err != nil {
+			continue
+		}
+		switch {
+		case n == 38 && i+2 < len(params) && params[i+1] == "5":
+			index, err := strconv.Atoi(params[i+2])
+			if err == nil {
+				color, found = xterm256(index), true
+			}
+			i += 2
+		case n >= 30 && n <= 37:
+			color, found = basicPalette[n-30], true
+		case n >= 90 && n <= 97:
+			color, found = brightPalette[n-90], true
+		}
+	}
+	if !found {
+		return colorSpeaker
+	}
+	return readable(color)
+}
+
+// xterm256 returns the RGB value of an xterm 256 color index
+func xterm256(index int) rgb {
+	switch {
+	case index < 8:
+		return basicPalette[index]
+	case index < 16:
+		return brightPalette[index-8]
+	case index < 232:
+		levels := [6]float64{0, 95, 135, 175, 215, 255}
+		index -= 16
+		return rgb{levels[index/36] / 255, levels[(index/6)%6] / 255, levels[index%6] / 255}
+	case index < 256:
+		gray := float64(8+10*(index-232)) / 255
+		return rgb{gray, gray, gray}
+	}
+	return colorSpeaker
+}
+
+// readable darkens colors that would be too light to read on a white page
+func readable(c rgb) rgb {
+	luminance := 0.2126*c.r + 0.7152*c.g + 0.0722*c.b
+	if luminance <= maxLuminance {
+		return c
+	}
+	scale := maxLuminance / luminance
+	return rgb{c.r * scale, c.g * scale, c.b * scale}
+}
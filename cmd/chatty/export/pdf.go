@@ -0,0 +1,288 @@
+package export
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Page layout in PDF points (A4)
+const (
+	pageWidth    = 595.0
+	pageHeight   = 842.0
+	marginX      = 56.0
+	marginTop    = 64.0
+	marginBottom = 56.0
+	textWidth    = pageWidth - 2*marginX
+
+	titleSize   = 16.0
+	speakerSize = 11.0
+	bodySize    = 10.5
+	codeSize    = 9.0
+	footerSize  = 8.0
+)
+
+// Standard PDF fonts, which need no embedding
+const (
+	fontRegular = "F1" // Helvetica
+	fontBold    = "F2" // Helvetica-Bold
+	fontMono    = "F3" // Courier
+)
+
+// helveticaWidths holds the Helvetica glyph widths (per 1000 units) for ASCII 32-126
+var helveticaWidths = [95]int{
+	278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+	556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+	1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+	667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+	333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+	556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+}
+
+// winAnsi maps the non Latin-1 characters of WinAnsiEncoding to their byte values
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, 'ƒ': 0x83, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87, 'ˆ': 0x88,
+	'‰': 0x89, 'Š': 0x8a, '‹': 0x8b, 'Œ': 0x8c, 'Ž': 0x8e, '‘': 0x91, '’': 0x92, '“': 0x93,
+	'”': 0x94, '•': 0x95, '–': 0x96, '—': 0x97, '˜': 0x98, '™': 0x99, 'š': 0x9a, '›': 0x9b,
+	'œ': 0x9c, 'ž': 0x9e, 'Ÿ': 0x9f,
+}
+
+// pdfDocument lays out text onto pages and serializes them
+type pdfDocument struct {
+	pages [][]byte
+	page  *bytes.Buffer
+	y     float64
+}
+
+// WritePDF renders a transcript to a PDF file, using each speaker's color for their name
+func WritePDF(path string, t Transcript) error {
+	doc := &pdfDocument{}
+	doc.newPage()
+
+	// Title block
+	doc.text(fontBold, titleSize, colorText, marginX, t.Title)
+	doc.advance(titleSize * 1.2)
+	doc.text(fontRegular, footerSize, colorMuted, marginX, "Exported by Chatty on "+time.Now().Format("January 2, 2006 15:04"))
+	doc.advance(speakerSize * 2)
+
+	for _, entry := range t.Entries {
+		doc.writeEntry(entry)
+	}
+
+	data := doc.bytes()
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write PDF file: %v", err)
+	}
+	return nil
+}
+
+// writeEntry lays out a message: the speaker name followed by its paragraphs and code blocks
+func (d *pdfDocument) writeEntry(entry Entry) {
+	speakerColor := colorSpeaker
+	if entry.Color != "" {
+		speakerColor = ansiToRGB(entry.Color)
+	}
+
+	d.ensureSpace(speakerSize*1.4 + bodySize*1.4)
+	if entry.Speaker != "" {
+		d.text(fontBold, speakerSize, speakerColor, marginX, entry.Speaker)
+		d.advance(speakerSize * 1.5)
+	}
+
+	inCode := false
+	for _, line := range strings.Split(strings.TrimSpace(entry.Text), "\n") {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inCode = !inCode
+			d.advance(codeSize * 0.4)
+			continue
+		}
+		if inCode {
+			for _, part := range wrapMono(strings.ReplaceAll(line, "\t", "    "), codeSize) {
+				d.ensureSpace(codeSize * 1.35)
+				d.text(fontMono, codeSize, colorCode, marginX+12, part)
+				d.advance(codeSize * 1.35)
+			}
+			continue
+		}
+		if strings.TrimSpace(line) == "" {
+			d.advance(bodySize * 0.6)
+			continue
+		}
+		for _, part := range wrapText(line, fontRegular, bodySize, textWidth) {
+			d.ensureSpace(bodySize * 1.4)
+			d.text(fontRegular, bodySize, colorText, marginX, part)
+			d.advance(bodySize * 1.4)
+		}
+	}
+	d.advance(bodySize * 1.2)
+}
+
+// newPage finishes the current page and starts a new one
+func (d *pdfDocument) newPage() {
+	d.finishPage()
+	d.page = &bytes.Buffer{}
+	d.y = pageHeight - marginTop
+}
+
+// finishPage adds the page number and stores the page content
+func (d *pdfDocument) finishPage() {
+	if d.page == nil {
+		return
+	}
+	number := fmt.Sprintf("%d", len(d.pages)+1)
+	x := pageWidth/2 - textWidthOf(number, fontRegular, footerSize)/2
+	fmt.Fprintf(d.page, "BT /%s %.1f Tf %.3f %.3f %.3f rg %.2f %.2f Td (%s) Tj ET\n",
+		fontRegular, footerSize, colorMuted.r, colorMuted.g, colorMuted.b, x, marginBottom/2, number)
+	d.pages = append(d.pages, d.page.Bytes())
+	d.page = nil
+}
+
+// ensureSpace starts a new page if the next block does not fit
+func (d *pdfDocument) ensureSpace(height float64) {
+	if d.y-height < marginBottom {
+		d.newPage()
+	}
+}
+
+// advance moves the cursor down
+func (d *pdfDocument) advance(height float64) {
+	d.y -= height
+}
+
+// text draws a single line at the current vertical position
+func (d *pdfDocument) text(font string, size float64, c rgb, x float64, s string) {
+	fmt.Fprintf(d.page, "BT /%s %.1f Tf %.3f %.3f %.3f rg %.2f %.2f Td (%s) Tj ET\n",
+		font, size, c.r, c.g, c.b, x, d.y, escapeText(s))
+}
+
+// bytes serializes the document with its cross-reference table
+func (d *pdfDocument) bytes() []byte {
+	d.finishPage()
+
+	var out bytes.Buffer
+	var offsets []int
+	object := func(body string) {
+		offsets = append(offsets, out.Len())
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", len(offsets), body)
+	}
+
+	out.WriteString("%PDF-1.4\n%\xe2\xe3\xcf\xd3\n")
+
+	// Objects 1-5: catalog, page tree and fonts; then a page and a content stream per page
+	firstPage := 6
+	var kids []string
+	for i := range d.pages {
+		kids = append(kids, fmt.Sprintf("%d 0 R", firstPage+i*2))
+	}
+	object("<< /Type /Catalog /Pages 2 0 R >>")
+	object(fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", strings.Join(kids, " "), len(d.pages)))
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica-Bold /Encoding /WinAnsiEncoding >>")
+	object("<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>")
+
+	for i, content := range d.pages {
+		object(fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+			"/Resources << /Font << /F1 3 0 R /F2 4 0 R /F3 5 0 R >> >> /Contents %d 0 R >>",
+			pageWidth, pageHeight, firstPage+i*2+1))
+		object(fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", len(content), content))
+	}
+
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(offsets)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(offsets)+1, xref)
+	return out.Bytes()
+}
+
+// encodeText converts text to WinAnsiEncoding, dropping characters the standard fonts cannot show
+func encodeText(s string) []byte {
+	var out []byte
+	for _, r := range s {
+		switch {
+		case r == '\t':
+			out = append(out, ' ')
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			out = append(out, byte(r))
+		case winAnsi[r] != 0:
+			out = append(out, winAnsi[r])
+		case unicode.Is(unicode.So, r), unicode.Is(unicode.Mn, r), r == 0xfe0f, r == 0x200d:
+			// Emojis and their modifiers have no glyph in the standard fonts
+		default:
+			out = append(out, '?')
+		}
+	}
+	return out
+}
+
+// escapeText encodes and escapes a string for use in a PDF literal string
+func escapeText(s string) string {
+	var sb strings.Builder
+	for _, b := range encodeText(s) {
+		if b == '(' || b == ')' || b == '\\' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteByte(b)
+	}
+	return sb.String()
+}
+
+// textWidthOf measures a string in points
+func textWidthOf(s string, font string, size float64) float64 {
+	if font == fontMono {
+		return float64(len(encodeText(s))) * 600 * size / 1000
+	}
+	total := 0
+	for _, b := range encodeText(s) {
+		if b >= 32 && b <= 126 {
+			total += helveticaWidths[b-32]
+		} else {
+			total += 556
+		}
+	}
+	width := float64(total) * size / 1000
+	if font == fontBold {
+		width *= 1.06 // Bold glyphs are slightly wider
+	}
+	return width
+}
+
+// wrapText breaks a paragraph into lines that fit within maxWidth
+func wrapText(paragraph string, font string, size, maxWidth float64) []string {
+	var lines []string
+	var current string
+	for _, word := range strings.Fields(paragraph) {
+		candidate := word
+		if current != "" {
+			candidate = current + " " + word
+		}
+		if current != "" && textWidthOf(candidate, font, size) > maxWidth {
+			lines = append(lines, current)
+			candidate = word
+		}
+		current = candidate
+	}
+	if current != "" {
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// wrapMono hard-wraps a line of code to the page width
+func wrapMono(line string, size float64) []string {
+	maxChars := int((textWidth - 12) / (600 * size / 1000))
+	runes := []rune(line)
+	if len(runes) <= maxChars {
+		return []string{line}
+	}
+	var parts []string
+	for len(runes) > maxChars {
+		parts = append(parts, string(runes[:maxChars]))
+		runes = runes[maxChars:]
+	}
+	return append(parts, string(runes))
+}
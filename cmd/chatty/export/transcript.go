@@ -0,0 +1,50 @@
+package export
+
+import (
+	"fmt"
+	"strings"
+
+	"chatty/cmd/chatty/speech"
+)
+
+// Supported export formats
+const (
+	FormatPDF = "pdf"
+	FormatWAV = "wav"
+)
+
+// Formats lists the supported export formats
+var Formats = []string{FormatPDF, FormatWAV}
+
+// Entry is a single message of an exported conversation
+type Entry struct {
+	Speaker string // Name shown above the message
+	Color   string // ANSI label color of the speaker (empty for the default style)
+	Voice   string // Text-to-speech voice of the speaker (empty for the default voice)
+	Text    string
+}
+
+// Transcript is a conversation ready to be exported
+type Transcript struct {
+	Title   string
+	Entries []Entry
+}
+
+// Write exports a transcript to path in the given format. Audio formats need a speaker
+func Write(path, format string, t Transcript, speaker *speech.Speaker) error {
+	if len(t.Entries) == 0 {
+		return fmt.Errorf("nothing to export: the conversation is empty")
+	}
+
+	switch strings.ToLower(format) {
+	case FormatPDF:
+		return WritePDF(path, t)
+	case FormatWAV:
+		if speaker == nil {
+			return fmt.Errorf("audio export needs a text-to-speech engine")
+		}
+		return WriteAudio(path, t, speaker)
+	default:
+		return fmt.Errorf("unsupported export format '%s' (available: %s)", format, strings.Join(Formats, ", "))
+	}
+}
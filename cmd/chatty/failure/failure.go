@@ -0,0 +1,83 @@
+// Package failure sorts the errors chatty stops on into kinds with their own exit codes, so
+// scripts wrapping chatty can tell an Ollama that isn't running from a mistyped agent name
+package failure
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Kind is a category of error
+type Kind int
+
+const (
+	General           Kind = iota // Anything not sorted into another kind
+	OllamaUnreachable             // Ollama isn't running or can't be reached
+	ModelMissing                  // The configured model isn't installed in Ollama
+	InvalidAgent                  // No agent goes by the name given
+	ConfigError                   // config.json can't be read or holds invalid settings
+)
+
+// Exit codes by kind. 2 is left to usage errors, as shells use it
+var exitCodes = map[Kind]int{
+	General:           1,
+	OllamaUnreachable: 3,
+	ModelMissing:      4,
+	InvalidAgent:      5,
+	ConfigError:       6,
+}
+
+// Names of the kinds in JSON error output
+var names = map[Kind]string{
+	General:           "error",
+	OllamaUnreachable: "ollama_unreachable",
+	ModelMissing:      "model_missing",
+	InvalidAgent:      "invalid_agent",
+	ConfigError:       "config_error",
+}
+
+// ExitCode returns the code chatty exits with on errors of the kind
+func (k Kind) ExitCode() int {
+	return exitCodes[k]
+}
+
+// String returns the name of the kind, like "ollama_unreachable"
+func (k Kind) String() string {
+	return names[k]
+}
+
+// Error is an error sorted into a kind
+type Error struct {
+	Kind Kind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// New returns an error of the kind, formatted like fmt.Errorf
+func New(kind Kind, format string, args ...any) error {
+	return &Error{Kind: kind, Err: fmt.Errorf(format, args...)}
+}
+
+// Wrap sorts err into the kind, nil staying nil
+func Wrap(kind Kind, err error) error {
+	if err == nil {
+		return nil
+	}
+	return &Error{Kind: kind, Err: err}
+}
+
+// KindOf returns the kind of err, General for errors that weren't sorted
+func KindOf(err error) Kind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return General
+}
@@ -0,0 +1,105 @@
+// Package filelock keeps chatty processes from using the same file at once, such as two chats
+// with an agent saving to its history. A lock is an advisory lock the operating system holds on a
+// file next to the one it guards, so it is released when its process ends, even by a crash. The
+// lock file is left in place, naming the process that last held it
+package filelock
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const lockSuffix = ".lock"
+
+// errLocked is returned by lockFile when another process holds the lock
+var errLocked = errors.New("locked")
+
+// InUseError is returned when another process holds a lock
+type InUseError struct {
+	PID int // Process holding the lock, 0 when it can't be told
+}
+
+func (e *InUseError) Error() string {
+	if e.PID == 0 {
+		return "in use by another chatty"
+	}
+	return fmt.Sprintf("in use by another chatty (process %d)", e.PID)
+}
+
+// Lock is a lock held by this process
+type Lock struct {
+	file *os.File
+}
+
+var (
+	heldMu sync.Mutex
+	held   = make(map[*os.File]bool) // Lock files held, released by ReleaseAll
+)
+
+// Acquire locks the file at path, failing with an *InUseError when another process holds it
+func Acquire(path string) (*Lock, error) {
+	lockPath := path + lockSuffix
+	file, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+	}
+	if err := lockFile(file); err != nil {
+		file.Close()
+		if errors.Is(err, errLocked) {
+			return nil, &InUseError{PID: owner(lockPath)}
+		}
+		return nil, fmt.Errorf("failed to lock %s: %v", path, err)
+	}
+
+	// The process ID only tells who holds the lock, which the lock itself doesn't
+	if err := file.Truncate(0); err == nil {
+		file.WriteAt([]byte(strconv.Itoa(os.Getpid())), 0)
+	}
+	heldMu.Lock()
+	held[file] = true
+	heldMu.Unlock()
+	return &Lock{file: file}, nil
+}
+
+// Release unlocks the file
+func (l *Lock) Release() {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	release(l.file)
+}
+
+// ReleaseAll unlocks every file this process holds, for when it exits without unwinding
+func ReleaseAll() {
+	heldMu.Lock()
+	defer heldMu.Unlock()
+	for file := range held {
+		release(file)
+	}
+}
+
+// release unlocks and closes a lock file of this process. heldMu must be held
+func release(file *os.File) {
+	if !held[file] {
+		return
+	}
+	delete(held, file)
+	unlockFile(file)
+	file.Close()
+}
+
+// owner returns the process that last held a lock file, 0 when it can't be told
+func owner(lockPath string) int {
+	file, err := os.Open(lockPath)
+	if err != nil {
+		return 0
+	}
+	defer file.Close()
+	data, _ := io.ReadAll(io.LimitReader(file, 32))
+	pid, _ := strconv.Atoi(strings.TrimSpace(string(data)))
+	return pid
+}
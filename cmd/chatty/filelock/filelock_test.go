@@ -0,0 +1,90 @@
+package filelock
+
+import (
+	"bufio"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestAcquire(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chat_history_ada.jsonl")
+	lock, err := Acquire(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var inUse *InUseError
+	if _, err := Acquire(path); !errors.As(err, &inUse) {
+		t.Fatalf("Acquire of a held lock = %v, want an *InUseError", err)
+	}
+	if inUse.PID != os.Getpid() {
+		t.Errorf("the lock is reported held by process %d, want %d", inUse.PID, os.Getpid())
+	}
+
+	lock.Release()
+	lock.Release() // Releasing twice does nothing
+	again, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire after Release = %v", err)
+	}
+	again.Release()
+}
+
+func TestReleaseAll(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"a", "b"} {
+		if _, err := Acquire(filepath.Join(dir, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ReleaseAll()
+	for _, name := range []string{"a", "b"} {
+		lock, err := Acquire(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("Acquire after ReleaseAll = %v", err)
+		}
+		lock.Release()
+	}
+}
+
+func TestCrashReleases(t *testing.T) {
+	if path := os.Getenv("FILELOCK_HOLD"); path != "" {
+		// The helper process: hold the lock until killed
+		if _, err := Acquire(path); err != nil {
+			os.Exit(1)
+		}
+		os.Stdout.WriteString("locked\n")
+		select {}
+	}
+
+	path := filepath.Join(t.TempDir(), "chat_history_ada.jsonl")
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCrashReleases$")
+	cmd.Env = append(os.Environ(), "FILELOCK_HOLD="+path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	if line, _ := bufio.NewReader(stdout).ReadString('\n'); line != "locked\n" {
+		cmd.Process.Kill()
+		t.Fatalf("the helper process printed %q, want it to hold the lock", line)
+	}
+
+	var inUse *InUseError
+	if _, err := Acquire(path); !errors.As(err, &inUse) || inUse.PID != cmd.Process.Pid {
+		t.Errorf("Acquire while another process holds the lock = %v, want it in use by process %d", err, cmd.Process.Pid)
+	}
+
+	cmd.Process.Kill()
+	cmd.Wait()
+	lock, err := Acquire(path)
+	if err != nil {
+		t.Fatalf("Acquire after the holder was killed = %v", err)
+	}
+	lock.Release()
+}
@@ -0,0 +1,30 @@
+//go:build windows
+
+package filelock
+
+import (
+	"errors"
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// The byte locked, past the process ID written at the start of the file, which stays readable
+// to the processes told the file is in use. Windows allows locking bytes past the end of a file
+const lockOffset = 1 << 31
+
+// lockFile takes an exclusive lock on f without waiting, returning errLocked when another
+// process holds one
+func lockFile(f *os.File) error {
+	overlapped := windows.Overlapped{Offset: lockOffset}
+	err := windows.LockFileEx(windows.Handle(f.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &overlapped)
+	if errors.Is(err, windows.ERROR_LOCK_VIOLATION) {
+		return errLocked
+	}
+	return err
+}
+
+func unlockFile(f *os.File) error {
+	overlapped := windows.Overlapped{Offset: lockOffset}
+	return windows.UnlockFileEx(windows.Handle(f.Fd()), 0, 1, 0, &overlapped)
+}
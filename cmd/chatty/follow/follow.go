@@ -0,0 +1,97 @@
+// Package follow reads what is added to a file that keeps growing, like a build log, for
+// chatty --watch
+package follow
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode/utf8"
+)
+
+// MaxRead is the most a single Read returns. When more was added, the text added last is kept,
+// as it is the most recent
+const MaxRead = 64 << 10
+
+// File is a file being followed from where it was last read
+type File struct {
+	path   string
+	offset int64
+}
+
+// Open starts following a file from its end, so only text added from now on is read
+func Open(path string) (*File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't watch %s: %v", path, err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("can't watch %s: it is a directory", path)
+	}
+	return &File{path: path, offset: info.Size()}, nil
+}
+
+// Read returns the text added to the file since the last read, and whether earlier text was
+// left out for being over MaxRead. A file that got shorter, because it was truncated or
+// replaced, is read from the start. A file that is missing for now, as while it is rotated,
+// has nothing new
+func (f *File) Read() (string, bool, error) {
+	file, err := os.Open(f.path)
+	if os.IsNotExist(err) {
+		f.offset = 0
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return "", false, err
+	}
+	size := info.Size()
+	if size < f.offset {
+		f.offset = 0
+	}
+	if size == f.offset {
+		return "", false, nil
+	}
+	start, cut := f.offset, false
+	if size-start > MaxRead {
+		start, cut = size-MaxRead, true
+	}
+	data := make([]byte, size-start)
+	n, err := file.ReadAt(data, start)
+	if err != nil && err != io.EOF {
+		return "", false, err
+	}
+	f.offset = start + int64(n)
+	text := string(data[:n])
+	if cut {
+		text = lineStart(text)
+	}
+	return text, cut, nil
+}
+
+// Tail returns the end of text, at most max bytes of it, starting at a line when it was cut
+func Tail(text string, max int) string {
+	if len(text) <= max {
+		return text
+	}
+	return lineStart(text[len(text)-max:])
+}
+
+// lineStart drops the part of a line that text cut from its start begins with, or the part of
+// a character when it has no line break, so it doesn't start in the middle of one
+func lineStart(text string) string {
+	if i := strings.IndexByte(text, '\n'); i >= 0 {
+		return text[i+1:]
+	}
+	for i := 0; i < len(text) && i < utf8.UTFMax; i++ {
+		if utf8.RuneStart(text[i]) {
+			return text[i:]
+		}
+	}
+	return text
+}
@@ -0,0 +1,65 @@
+package kb
+
+import "strings"
+
+const maxChunkLength = 1200 // Characters per chunk, small enough to keep several in a prompt
+
+// Piece is a span of a document that is embedded as one chunk
+type Piece struct {
+	Text      string
+	StartLine int // 1-based, inclusive
+	EndLine   int
+}
+
+// SplitText breaks a document into chunks along paragraph boundaries, splitting
+// paragraphs that are too long on their own by line
+func SplitText(text string) []Piece {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var pieces []Piece
+	var current []string
+	start := 0
+	length := 0
+
+	flush := func(end int) {
+		body := strings.TrimSpace(strings.Join(current, "\n"))
+		if body != "" {
+			pieces = append(pieces, Piece{Text: body, StartLine: start + 1, EndLine: end})
+		}
+		current = nil
+		length = 0
+	}
+
+	for i, line := range lines {
+		// Close the chunk at a paragraph break once it is reasonably full,
+		// or at any line when adding it would overflow the chunk
+		paragraphBreak := strings.TrimSpace(line) == "" && length > maxChunkLength/2
+		if paragraphBreak || (length > 0 && length+len(line) > maxChunkLength) {
+			flush(i)
+		}
+		if len(current) == 0 {
+			if strings.TrimSpace(line) == "" {
+				continue
+			}
+			start = i
+		}
+
+		// Hard-wrap single lines longer than a chunk
+		for len(line) > maxChunkLength {
+			cut := strings.LastIndex(line[:maxChunkLength], " ")
+			if cut <= 0 {
+				cut = maxChunkLength
+			}
+			current = append(current, line[:cut])
+			flush(i + 1)
+			start = i
+			line = strings.TrimSpace(line[cut:])
+		}
+
+		current = append(current, line)
+		length += len(line) + 1
+	}
+	flush(len(lines))
+
+	return pieces
+}
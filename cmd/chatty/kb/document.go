@@ -0,0 +1,76 @@
+package kb
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+// Extensions of the documents that can be ingested
+var supportedExtensions = map[string]bool{
+	".md":       true,
+	".markdown": true,
+	".txt":      true,
+	".text":     true,
+	".rst":      true,
+	".pdf":      true,
+}
+
+// Supported reports whether a file can be ingested
+func Supported(path string) bool {
+	return supportedExtensions[strings.ToLower(filepath.Ext(path))]
+}
+
+// ReadDocument loads the text of a document
+func ReadDocument(path string) (string, error) {
+	if strings.EqualFold(filepath.Ext(path), ".pdf") {
+		return readPDF(path)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("%s is not a UTF-8 text file", path)
+	}
+	return string(data), nil
+}
+
+// FindDocuments lists the supported documents at path, walking directories recursively
+// and skipping hidden files and directories
+func FindDocuments(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to access %s: %v", path, err)
+	}
+	if !info.IsDir() {
+		if !Supported(path) {
+			return nil, fmt.Errorf("%s is not a supported document", path)
+		}
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(p string, d os.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p != path && strings.HasPrefix(d.Name(), ".") {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.IsDir() && Supported(p) {
+			files = append(files, p)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan %s: %v", path, err)
+	}
+	return files, nil
+}
@@ -0,0 +1,85 @@
+package kb
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ollamaEmbeddingsPath  = "/api/embeddings"  // Ollama embeddings API, relative to the server's base URL
+	DefaultEmbeddingModel = "nomic-embed-text" // Model used to embed documents and queries unless configured
+	embedTimeout          = 2 * time.Minute
+)
+
+// Embedder turns text into vectors for similarity search
+type Embedder interface {
+	Embed(text string) ([]float32, error)
+	Model() string
+}
+
+// OllamaEmbedder computes embeddings with a local Ollama model
+type OllamaEmbedder struct {
+	url    string
+	model  string
+	client *http.Client
+}
+
+// NewOllamaEmbedder creates an embedder for a model served by the Ollama server at baseURL,
+// using DefaultEmbeddingModel when model is empty
+func NewOllamaEmbedder(baseURL, model string) *OllamaEmbedder {
+	if model == "" {
+		model = DefaultEmbeddingModel
+	}
+	return &OllamaEmbedder{
+		url:    strings.TrimSuffix(baseURL, "/") + ollamaEmbeddingsPath,
+		model:  model,
+		client: &http.Client{Timeout: embedTimeout},
+	}
+}
+
+// Model returns the name of the embedding model
+func (e *OllamaEmbedder) Model() string {
+	return e.model
+}
+
+// Embed returns the embedding of text
+func (e *OllamaEmbedder) Embed(text string) ([]float32, error) {
+	payload, err := json.Marshal(map[string]string{
+		"model":  e.model,
+		"prompt": text,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embedding request: %v", err)
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(payload))
+	if err != nil {
+		if strings.Contains(err.Error(), "connection refused") {
+			return nil, fmt.Errorf("could not connect to Ollama - make sure 'ollama serve' is running")
+		}
+		return nil, fmt.Errorf("embedding request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		Embedding []float32 `json:"embedding"`
+		Error     string    `json:"error"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("failed to decode embedding response: %v", err)
+	}
+	if result.Error != "" {
+		if strings.Contains(result.Error, "not found") {
+			return nil, fmt.Errorf("embedding model '%s' not found - run 'ollama pull %s'", e.model, e.model)
+		}
+		return nil, fmt.Errorf("embedding failed: %s", result.Error)
+	}
+	if len(result.Embedding) == 0 {
+		return nil, fmt.Errorf("model '%s' returned an empty embedding", e.model)
+	}
+	return result.Embedding, nil
+}
@@ -0,0 +1,247 @@
+package kb
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"time"
+
+	"chatty/cmd/chatty/appdir"
+)
+
+const (
+	kbDir     = "kb"
+	indexFile = "index.json"
+
+	// DefaultName is the knowledge base used when none is given
+	DefaultName = "default"
+
+	// Results below this cosine similarity are not relevant enough to include
+	minScore = 0.3
+)
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// Chunk is an embedded span of a document
+type Chunk struct {
+	Source    string    `json:"source"` // Absolute path of the document
+	StartLine int       `json:"start_line"`
+	EndLine   int       `json:"end_line"`
+	Text      string    `json:"text"`
+	Embedding []float32 `json:"embedding"`
+}
+
+// FileState records an indexed document so unchanged files can be skipped
+type FileState struct {
+	Hash        string    `json:"hash"` // SHA-256 of the content
+	Size        int64     `json:"size"`
+	ModTime     time.Time `json:"mod_time"`
+	DuplicateOf string    `json:"duplicate_of,omitempty"` // Source with the same content, whose chunks are shared
+}
+
+// Index is a knowledge base stored in ~/.chatty/kb/<name>/index.json
+type Index struct {
+	Name   string               `json:"-"`
+	Model  string               `json:"model"` // Embedding model the chunks were indexed with
+	Files  map[string]FileState `json:"files,omitempty"`
+	Chunks []Chunk              `json:"chunks"`
+	Remote *Remote              `json:"remote,omitempty"` // Archive the documents are synced from, if any
+
+	path string
+}
+
+// Result is a chunk matching a query
+type Result struct {
+	Chunk
+	Score float64
+}
+
+// Dir returns the directory holding all knowledge bases
+func Dir() (string, error) {
+	dataDir, err := appdir.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, kbDir), nil
+}
+
+// Exists reports whether a knowledge base has been created
+func Exists(name string) bool {
+	dir, err := Dir()
+	if err != nil {
+		return false
+	}
+	_, err = os.Stat(filepath.Join(dir, name, indexFile))
+	return err == nil
+}
+
+// Open loads a knowledge base, returning an empty one if it does not exist yet
+func Open(name string) (*Index, error) {
+	if !namePattern.MatchString(name) {
+		return nil, fmt.Errorf("invalid knowledge base name '%s': use letters, numbers, dots, dashes and underscores", name)
+	}
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+
+	index := &Index{Name: name, path: filepath.Join(dir, name, indexFile)}
+	data, err := os.ReadFile(index.path)
+	if os.IsNotExist(err) {
+		return index, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read knowledge base '%s': %v", name, err)
+	}
+	if err := json.Unmarshal(data, index); err != nil {
+		return nil, fmt.Errorf("failed to parse knowledge base '%s': %v", name, err)
+	}
+	return index, nil
+}
+
+// Save writes the knowledge base to disk
+func (idx *Index) Save() error {
+	if err := os.MkdirAll(filepath.Dir(idx.path), 0755); err != nil {
+		return fmt.Errorf("failed to create knowledge base directory: %v", err)
+	}
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("failed to encode knowledge base: %v", err)
+	}
+	if err := os.WriteFile(idx.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write knowledge base: %v", err)
+	}
+	return nil
+}
+
+// checkModel makes sure vectors from embedder are comparable with the indexed ones
+func (idx *Index) checkModel(embedder Embedder) error {
+	if idx.Model != "" && len(idx.Chunks) > 0 && idx.Model != embedder.Model() {
+		return fmt.Errorf("knowledge base '%s' was indexed with '%s', not '%s': set embedding_model back or ingest its documents again to switch models", idx.Name, idx.Model, embedder.Model())
+	}
+	return nil
+}
+
+// AddDocument splits a document into chunks, embeds them, and replaces any
+// chunks previously indexed from the same source, like AddPieces
+func (idx *Index) AddDocument(source, text string, embedder Embedder, progress func(done, total int)) (int, error) {
+	return idx.AddPieces(source, SplitText(text), embedder, progress)
+}
+
+// AddPieces embeds the pieces of a document and replaces any chunks previously
+// indexed from the same source. Pieces already indexed from the source keep their
+// embedding, and repeated pieces, like boilerplate on every page, are only indexed
+// once. It returns the number of chunks added and reports each piece to progress,
+// which may be nil
+func (idx *Index) AddPieces(source string, pieces []Piece, embedder Embedder, progress func(done, total int)) (int, error) {
+	if err := idx.checkModel(embedder); err != nil {
+		return 0, err
+	}
+
+	previous := make(map[string][]float32)
+	for _, chunk := range idx.Chunks {
+		if chunk.Source == source {
+			previous[chunk.Text] = chunk.Embedding
+		}
+	}
+
+	known := make(map[string]bool)
+	var chunks []Chunk
+	for i, piece := range pieces {
+		if known[piece.Text] {
+			continue
+		}
+		known[piece.Text] = true
+
+		embedding, ok := previous[piece.Text]
+		if !ok {
+			var err error
+			embedding, err = embedder.Embed(piece.Text)
+			if err != nil {
+				return 0, err
+			}
+		}
+		if progress != nil {
+			progress(i+1, len(pieces))
+		}
+		chunks = append(chunks, Chunk{
+			Source:    source,
+			StartLine: piece.StartLine,
+			EndLine:   piece.EndLine,
+			Text:      piece.Text,
+			Embedding: embedding,
+		})
+	}
+
+	idx.Remove(source)
+	idx.Chunks = append(idx.Chunks, chunks...)
+	idx.Model = embedder.Model()
+	return len(chunks), nil
+}
+
+// Reset forgets every indexed document, e.g. before switching to another embedding model
+func (idx *Index) Reset() {
+	idx.Files, idx.Chunks, idx.Model = nil, nil, ""
+}
+
+// Remove drops all chunks indexed from source
+func (idx *Index) Remove(source string) {
+	delete(idx.Files, source)
+	kept := idx.Chunks[:0]
+	for _, chunk := range idx.Chunks {
+		if chunk.Source != source {
+			kept = append(kept, chunk)
+		}
+	}
+	idx.Chunks = kept
+}
+
+// Search returns up to limit chunks most similar to a query embedded by embedder
+func (idx *Index) Search(query []float32, embedder Embedder, limit int) ([]Result, error) {
+	if len(idx.Chunks) == 0 {
+		return nil, nil
+	}
+	if err := idx.checkModel(embedder); err != nil {
+		return nil, err
+	}
+
+	var results []Result
+	for _, chunk := range idx.Chunks {
+		if score := cosine(query, chunk.Embedding); score >= minScore {
+			results = append(results, Result{Chunk: chunk, Score: score})
+		}
+	}
+	SortResults(results)
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results, nil
+}
+
+// SortResults orders results from most to least similar
+func SortResults(results []Result) {
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+}
+
+// cosine returns the cosine similarity of two vectors
+func cosine(a, b []float32) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		normA += float64(a[i]) * float64(a[i])
+		normB += float64(b[i]) * float64(b[i])
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / (math.Sqrt(normA) * math.Sqrt(normB))
+}
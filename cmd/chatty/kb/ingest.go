@@ -0,0 +1,188 @@
+package kb
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Statuses reported while ingesting documents
+const (
+	StatusEmbedding = "embedding" // Chunks of the document are being embedded
+	StatusAdded     = "added"
+	StatusUpdated   = "updated"
+	StatusUnchanged = "unchanged"
+	StatusDuplicate = "duplicate" // Same content as another indexed document
+	StatusRemoved   = "removed"   // The document no longer exists
+	StatusFailed    = "failed"
+)
+
+// IngestProgress describes the document being ingested
+type IngestProgress struct {
+	Path   string
+	Number int // 1-based position of the document (0 for removals)
+	Total  int
+	Status string
+	Chunks int    // Chunks embedded so far, or added when the document is done
+	Of     int    // Chunks in the document while embedding
+	Detail string // Original of a duplicate, or the error of a failure
+}
+
+// IngestResult counts what an ingest run changed
+type IngestResult struct {
+	Added, Updated, Unchanged, Duplicates, Removed, Failed, Chunks int
+}
+
+// Changed reports whether the run modified the index
+func (r IngestResult) Changed() bool {
+	return r.Added+r.Updated+r.Removed+r.Duplicates > 0
+}
+
+// Ingest indexes the documents at path, a file or a directory. Documents that did
+// not change since the last run are skipped, documents with the same content as
+// another one are only indexed once, and documents deleted from a directory are
+// dropped from the index. A different embedding model than the index was built with
+// re-embeds everything from scratch. Documents that cannot be read are reported and
+// skipped; embedding errors stop the run, keeping what was indexed so far
+func (idx *Index) Ingest(path string, embedder Embedder, progress func(IngestProgress)) (IngestResult, error) {
+	root, err := filepath.Abs(path)
+	if err != nil {
+		return IngestResult{}, fmt.Errorf("failed to resolve %s: %v", path, err)
+	}
+	files, err := FindDocuments(root)
+	if err != nil {
+		return IngestResult{}, err
+	}
+	return idx.IngestFiles(root, files, embedder, progress)
+}
+
+// IngestFiles indexes a list of documents found under root, like Ingest. Indexed
+// documents under root that are missing from files are dropped from the index
+func (idx *Index) IngestFiles(root string, files []string, embedder Embedder, progress func(IngestProgress)) (IngestResult, error) {
+	var result IngestResult
+	if progress == nil {
+		progress = func(IngestProgress) {}
+	}
+
+	// Vectors from different models can't be compared, so a new model starts the index over
+	if idx.Model != "" && idx.Model != embedder.Model() {
+		idx.Reset()
+	}
+	if idx.Files == nil {
+		idx.Files = make(map[string]FileState)
+	}
+
+	// Forget documents deleted from the directory since the last run
+	found := make(map[string]bool)
+	for _, file := range files {
+		found[file] = true
+	}
+	var removed []string
+	for source := range idx.Files {
+		if strings.HasPrefix(source, root+string(filepath.Separator)) && !found[source] {
+			removed = append(removed, source)
+		}
+	}
+	sort.Strings(removed)
+	for _, source := range removed {
+		idx.Remove(source)
+		result.Removed++
+		progress(IngestProgress{Path: source, Status: StatusRemoved})
+	}
+
+	for i, file := range files {
+		report := IngestProgress{Path: file, Number: i + 1, Total: len(files)}
+
+		info, err := os.Stat(file)
+		if err != nil {
+			result.Failed++
+			report.Status, report.Detail = StatusFailed, err.Error()
+			progress(report)
+			continue
+		}
+
+		// Size and modification time are enough to skip most unchanged files
+		state, indexed := idx.Files[file]
+		if indexed && state.Size == info.Size() && state.ModTime.Equal(info.ModTime()) && idx.originalExists(state) {
+			result.Unchanged++
+			report.Status = StatusUnchanged
+			progress(report)
+			continue
+		}
+
+		text, err := ReadDocument(file)
+		if err != nil {
+			result.Failed++
+			report.Status, report.Detail = StatusFailed, err.Error()
+			progress(report)
+			continue
+		}
+		sum := sha256.Sum256([]byte(text))
+		current := FileState{Hash: hex.EncodeToString(sum[:]), Size: info.Size(), ModTime: info.ModTime()}
+
+		// Touched but identical content
+		if indexed && state.Hash == current.Hash && idx.originalExists(state) {
+			current.DuplicateOf = state.DuplicateOf
+			idx.Files[file] = current
+			result.Unchanged++
+			report.Status = StatusUnchanged
+			progress(report)
+			continue
+		}
+
+		// Content already indexed from another document
+		if original := idx.findHash(current.Hash, file); original != "" {
+			idx.Remove(file)
+			current.DuplicateOf = original
+			idx.Files[file] = current
+			result.Duplicates++
+			report.Status, report.Detail = StatusDuplicate, original
+			progress(report)
+			continue
+		}
+
+		count, err := idx.AddDocument(file, text, embedder, func(done, total int) {
+			progress(IngestProgress{Path: file, Number: i + 1, Total: len(files), Status: StatusEmbedding, Chunks: done, Of: total})
+		})
+		if err != nil {
+			return result, err
+		}
+		idx.Files[file] = current
+
+		if indexed {
+			result.Updated++
+			report.Status = StatusUpdated
+		} else {
+			result.Added++
+			report.Status = StatusAdded
+		}
+		result.Chunks += count
+		report.Chunks = count
+		progress(report)
+	}
+
+	return result, nil
+}
+
+// originalExists reports whether the document a duplicate points to is still indexed with the same content
+func (idx *Index) originalExists(state FileState) bool {
+	if state.DuplicateOf == "" {
+		return true
+	}
+	original, ok := idx.Files[state.DuplicateOf]
+	return ok && original.Hash == state.Hash && original.DuplicateOf == ""
+}
+
+// findHash returns another indexed document with the given content hash
+func (idx *Index) findHash(hash, exclude string) string {
+	for source, state := range idx.Files {
+		if source != exclude && state.Hash == hash && state.DuplicateOf == "" {
+			return source
+		}
+	}
+	return ""
+}
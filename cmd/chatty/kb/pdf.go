@@ -0,0 +1,219 @@
+package kb
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+)
+
+var (
+	streamPattern = regexp.MustCompile(`(?s)<<(.*?)>>\s*stream\r?\n`)
+	skipStreams   = regexp.MustCompile(`/Subtype\s*/(Image|Form)|/Type\s*/(XObject|XRef|ObjStm|Metadata)|/Length1|/FontFile`)
+)
+
+// readPDF extracts the text of a PDF, using pdftotext when it is installed
+// and a basic built-in extractor otherwise
+func readPDF(path string) (string, error) {
+	if _, err := exec.LookPath("pdftotext"); err == nil {
+		output, err := exec.Command("pdftotext", "-layout", "-enc", "UTF-8", path, "-").Output()
+		if err != nil {
+			return "", fmt.Errorf("pdftotext failed on %s: %v", path, err)
+		}
+		return string(output), nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if !bytes.HasPrefix(data, []byte("%PDF")) {
+		return "", fmt.Errorf("%s is not a PDF file", path)
+	}
+
+	var sb strings.Builder
+	for _, match := range streamPattern.FindAllSubmatchIndex(data, -1) {
+		dict := string(data[match[2]:match[3]])
+		if skipStreams.MatchString(dict) {
+			continue
+		}
+		start := match[1]
+		end := bytes.Index(data[start:], []byte("endstream"))
+		if end < 0 {
+			break
+		}
+		content := data[start : start+end]
+
+		if strings.Contains(dict, "/FlateDecode") {
+			reader, err := zlib.NewReader(bytes.NewReader(content))
+			if err != nil {
+				continue
+			}
+			// Truncated streams still yield their readable part
+			content, _ = io.ReadAll(reader)
+			reader.Close()
+		} else if strings.Contains(dict, "/Filter") {
+			continue // Other encodings are not supported
+		}
+
+		if bytes.Contains(content, []byte("BT")) {
+			sb.WriteString(extractPDFText(content))
+			sb.WriteString("\n\n")
+		}
+	}
+
+	text := strings.TrimSpace(sb.String())
+	if text == "" {
+		return "", fmt.Errorf("no text found in %s (install pdftotext for better PDF support)", path)
+	}
+	return text, nil
+}
+
+// extractPDFText collects the strings shown by the text operators of a content stream
+func extractPDFText(content []byte) string {
+	var sb strings.Builder
+	var operands []string // Strings since the last operator
+	var numbers []string  // Numbers since the last operator
+	inText := false
+
+	for i := 0; i < len(content); {
+		c := content[i]
+		switch {
+		case c == '(':
+			s, next := readPDFLiteral(content, i)
+			operands = append(operands, s)
+			i = next
+		case c == '<' && i+1 < len(content) && content[i+1] != '<':
+			end := bytes.IndexByte(content[i:], '>')
+			if end < 0 {
+				return sb.String()
+			}
+			operands = append(operands, decodePDFHex(string(content[i+1:i+end])))
+			i += end + 1
+		case c == '[' || c == ']':
+			i++
+		case c == '%':
+			for i < len(content) && content[i] != '\n' && content[i] != '\r' {
+				i++
+			}
+		case c == '-' || c == '.' || (c >= '0' && c <= '9'):
+			start := i
+			for i < len(content) && (content[i] == '-' || content[i] == '.' || (content[i] >= '0' && content[i] <= '9')) {
+				i++
+			}
+			number := string(content[start:i])
+			numbers = append(numbers, number)
+			// Large negative kerning inside TJ arrays separates words
+			if strings.HasPrefix(number, "-") && len(strings.Split(number, ".")[0]) > 3 {
+				operands = append(operands, " ")
+			}
+		case c > ' ' && c != '/' && c != '{' && c != '}':
+			start := i
+			for i < len(content) && content[i] > ' ' && !strings.ContainsRune("()<>[]/%{}", rune(content[i])) {
+				i++
+			}
+			switch op := string(content[start:i]); op {
+			case "BT":
+				inText = true
+			case "ET":
+				inText = false
+				sb.WriteString("\n")
+			case "Tj", "TJ":
+				if inText {
+					sb.WriteString(strings.Join(operands, ""))
+				}
+			case "'", "\"":
+				if inText {
+					sb.WriteString("\n" + strings.Join(operands, ""))
+				}
+			case "T*":
+				sb.WriteString("\n")
+			case "Td", "TD":
+				// A vertical move starts a new line, a horizontal one separates words
+				if len(numbers) >= 2 && strings.Trim(numbers[1], "-0.") != "" {
+					sb.WriteString("\n")
+				} else {
+					sb.WriteString(" ")
+				}
+			}
+			operands = operands[:0]
+			numbers = numbers[:0]
+		default:
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// readPDFLiteral decodes a (literal) string starting at content[start]
+func readPDFLiteral(content []byte, start int) (string, int) {
+	var sb strings.Builder
+	depth := 0
+	for i := start; i < len(content); i++ {
+		c := content[i]
+		switch c {
+		case '\\':
+			i++
+			if i >= len(content) {
+				return sb.String(), i
+			}
+			switch e := content[i]; e {
+			case 'n':
+				sb.WriteByte('\n')
+			case 'r', 't', 'b', 'f':
+				sb.WriteByte(' ')
+			case '\r', '\n':
+				// Line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					value := 0
+					for j := 0; j < 3 && i < len(content) && content[i] >= '0' && content[i] <= '7'; j++ {
+						value = value*8 + int(content[i]-'0')
+						i++
+					}
+					i--
+					sb.WriteRune(rune(value))
+				} else {
+					sb.WriteByte(e)
+				}
+			}
+		case '(':
+			if depth > 0 {
+				sb.WriteByte(c)
+			}
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return sb.String(), i + 1
+			}
+			sb.WriteByte(c)
+		default:
+			sb.WriteRune(rune(c)) // PDFDocEncoding is close enough to Latin-1
+		}
+	}
+	return sb.String(), len(content)
+}
+
+// decodePDFHex decodes a <hex> string, keeping only printable single-byte characters
+func decodePDFHex(hex string) string {
+	hex = strings.Join(strings.Fields(hex), "")
+	if len(hex)%2 == 1 {
+		hex += "0"
+	}
+	var sb strings.Builder
+	for i := 0; i+1 < len(hex); i += 2 {
+		var b byte
+		if _, err := fmt.Sscanf(hex[i:i+2], "%02x", &b); err != nil {
+			return ""
+		}
+		if b >= 32 && b < 127 || b >= 160 {
+			sb.WriteRune(rune(b))
+		}
+	}
+	return sb.String()
+}
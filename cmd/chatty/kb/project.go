@@ -0,0 +1,92 @@
+package kb
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// Larger files are usually generated code or data rather than something worth retrieving
+	maxProjectFileSize = 256 << 10
+
+	// Bytes read to tell text files from binary ones
+	sniffLength = 8000
+)
+
+// ProjectFiles finds the git repository containing dir and lists its text files,
+// tracked or untracked, leaving out everything .gitignore excludes
+func ProjectFiles(dir string) (string, []string, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return "", nil, fmt.Errorf("git is not installed")
+	}
+
+	out, err := exec.Command("git", "-C", dir, "rev-parse", "--show-toplevel").Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("%s is not inside a git repository", dir)
+	}
+	root := strings.TrimSpace(string(out))
+
+	out, err = exec.Command("git", "-C", root, "ls-files", "-z", "--cached", "--others", "--exclude-standard").Output()
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to list the files of %s: %v", root, err)
+	}
+
+	var files []string
+	for _, name := range strings.Split(string(out), "\x00") {
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(root, filepath.FromSlash(name))
+		if isProjectText(path) {
+			files = append(files, path)
+		}
+	}
+	return root, files, nil
+}
+
+// isProjectText reports whether a repository file is a readable document of a reasonable size
+func isProjectText(path string) bool {
+	info, err := os.Lstat(path)
+	if err != nil || !info.Mode().IsRegular() || info.Size() == 0 || info.Size() > maxProjectFileSize {
+		return false
+	}
+	if strings.EqualFold(filepath.Ext(path), ".pdf") {
+		return true
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	head := make([]byte, sniffLength)
+	n, _ := file.Read(head)
+	head = head[:n]
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false
+	}
+	// The sample may end in the middle of a character
+	for i := 0; i < utf8.UTFMax && len(head) > 0 && !utf8.Valid(head); i++ {
+		head = head[:len(head)-1]
+	}
+	return utf8.Valid(head)
+}
+
+// ProjectName returns the knowledge base name for a repository, e.g. "project-chatty-ai-1a2b3c4d"
+func ProjectName(root string) string {
+	sum := sha256.Sum256([]byte(root))
+	base := strings.Map(func(r rune) rune {
+		if r < 128 && namePattern.MatchString(string(r)) {
+			return r
+		}
+		return '-'
+	}, filepath.Base(root))
+	return "project-" + base + "-" + hex.EncodeToString(sum[:4])
+}
@@ -0,0 +1,212 @@
+package kb
+
+import (
+	"archive/zip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	remoteDir = "remote" // Unpacked content of a remote knowledge base, next to its index
+
+	// DefaultRefresh is how often a remote knowledge base is checked for updates
+	DefaultRefresh = 24 * time.Hour
+
+	maxArchiveSize  = 200 << 20 // Largest archive that will be downloaded
+	maxUnpackedSize = 500 << 20 // Largest total size of the unpacked documents
+	downloadTimeout = 10 * time.Minute
+)
+
+// Remote is the archive a knowledge base is synced from
+type Remote struct {
+	URL          string    `json:"url"`
+	Refresh      string    `json:"refresh"` // How often to check for updates, as a Go duration
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	Synced       time.Time `json:"synced"` // Last time the archive was checked
+}
+
+// RemoteName suggests a knowledge base name for an archive URL, e.g. "docs" for https://example.com/docs.zip
+func RemoteName(url string) string {
+	name := path.Base(strings.SplitN(strings.SplitN(url, "?", 2)[0], "#", 2)[0])
+	name = strings.TrimSuffix(name, path.Ext(name))
+	name = strings.Map(func(r rune) rune {
+		if r < 128 && namePattern.MatchString(string(r)) {
+			return r
+		}
+		return '-'
+	}, name)
+	name = strings.Trim(name, ".-")
+	if name == "" {
+		return DefaultName
+	}
+	return name
+}
+
+// SetRemote makes the knowledge base sync from the zip archive at url, checking it every refresh
+func (idx *Index) SetRemote(url string, refresh time.Duration) error {
+	if !strings.HasPrefix(url, "http://") && !strings.HasPrefix(url, "https://") {
+		return fmt.Errorf("invalid URL '%s': only http and https are supported", url)
+	}
+	if refresh <= 0 {
+		refresh = DefaultRefresh
+	}
+	if idx.Remote == nil || idx.Remote.URL != url {
+		idx.Remote = &Remote{URL: url}
+	}
+	idx.Remote.Refresh = refresh.String()
+	return nil
+}
+
+// RemoteDir is where the archive of a remote knowledge base is unpacked
+func (idx *Index) RemoteDir() string {
+	return filepath.Join(filepath.Dir(idx.path), remoteDir)
+}
+
+// NeedsRefresh reports whether a remote knowledge base is due to be checked for updates
+func (idx *Index) NeedsRefresh() bool {
+	if idx.Remote == nil {
+		return false
+	}
+	refresh, err := time.ParseDuration(idx.Remote.Refresh)
+	if err != nil || refresh <= 0 {
+		refresh = DefaultRefresh
+	}
+	return time.Since(idx.Remote.Synced) >= refresh
+}
+
+// Download fetches the archive of a remote knowledge base and unpacks it into RemoteDir,
+// reporting whether it changed since the last sync. The documents still need to be
+// ingested from RemoteDir, and the index saved
+func (idx *Index) Download() (bool, error) {
+	if idx.Remote == nil {
+		return false, fmt.Errorf("knowledge base '%s' is not synced from a URL", idx.Name)
+	}
+	remote := idx.Remote
+
+	req, err := http.NewRequest("GET", remote.URL, nil)
+	if err != nil {
+		return false, fmt.Errorf("invalid URL '%s': %v", remote.URL, err)
+	}
+	req.Header.Set("User-Agent", "chatty")
+	if _, err := os.Stat(idx.RemoteDir()); err == nil {
+		if remote.ETag != "" {
+			req.Header.Set("If-None-Match", remote.ETag)
+		}
+		if remote.LastModified != "" {
+			req.Header.Set("If-Modified-Since", remote.LastModified)
+		}
+	}
+
+	client := &http.Client{Timeout: downloadTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return false, fmt.Errorf("failed to download %s: %v", remote.URL, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotModified {
+		remote.Synced = time.Now()
+		return false, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		return false, fmt.Errorf("failed to download %s: %s", remote.URL, resp.Status)
+	}
+
+	// zip needs random access, so keep the archive in a temporary file
+	archive, err := os.CreateTemp("", "chatty-kb-*.zip")
+	if err != nil {
+		return false, fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	defer os.Remove(archive.Name())
+	defer archive.Close()
+
+	size, err := io.Copy(archive, io.LimitReader(resp.Body, maxArchiveSize+1))
+	if err != nil {
+		return false, fmt.Errorf("failed to download %s: %v", remote.URL, err)
+	}
+	if size > maxArchiveSize {
+		return false, fmt.Errorf("%s is larger than %d MB", remote.URL, maxArchiveSize>>20)
+	}
+
+	// Unpack next to the current content and swap it in only when everything was extracted
+	staging := idx.RemoteDir() + ".new"
+	os.RemoveAll(staging)
+	if err := unzip(archive, size, staging); err != nil {
+		os.RemoveAll(staging)
+		return false, fmt.Errorf("failed to unpack %s: %v", remote.URL, err)
+	}
+	if err := os.RemoveAll(idx.RemoteDir()); err != nil {
+		os.RemoveAll(staging)
+		return false, fmt.Errorf("failed to replace %s: %v", idx.RemoteDir(), err)
+	}
+	if err := os.Rename(staging, idx.RemoteDir()); err != nil {
+		return false, fmt.Errorf("failed to replace %s: %v", idx.RemoteDir(), err)
+	}
+
+	remote.ETag = resp.Header.Get("ETag")
+	remote.LastModified = resp.Header.Get("Last-Modified")
+	remote.Synced = time.Now()
+	return true, nil
+}
+
+// unzip extracts the regular files of an archive into dir, keeping their modification
+// times so that unchanged documents are skipped when ingesting again
+func unzip(archive io.ReaderAt, size int64, dir string) error {
+	reader, err := zip.NewReader(archive, size)
+	if err != nil {
+		return fmt.Errorf("not a zip archive: %v", err)
+	}
+
+	var total uint64
+	for _, file := range reader.File {
+		if !file.Mode().IsRegular() {
+			continue
+		}
+		// Reject entries that would escape the target directory
+		name := filepath.FromSlash(file.Name)
+		if !filepath.IsLocal(name) {
+			return fmt.Errorf("unsafe path '%s' in archive", file.Name)
+		}
+		total += file.UncompressedSize64
+		if total > maxUnpackedSize {
+			return fmt.Errorf("archive unpacks to more than %d MB", maxUnpackedSize>>20)
+		}
+
+		target := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		if err := extractFile(file, target); err != nil {
+			return err
+		}
+		os.Chtimes(target, file.Modified, file.Modified)
+	}
+	return nil
+}
+
+// extractFile writes one archive entry to target
+func extractFile(file *zip.File, target string) error {
+	src, err := file.Open()
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %v", file.Name, err)
+	}
+	defer src.Close()
+
+	dst, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	// The declared size can't be trusted, so never write more than it
+	if _, err := io.Copy(dst, io.LimitReader(src, int64(file.UncompressedSize64))); err != nil {
+		dst.Close()
+		return fmt.Errorf("failed to extract %s: %v", file.Name, err)
+	}
+	return dst.Close()
+}
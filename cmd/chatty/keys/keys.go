@@ -0,0 +1,303 @@
+// Package keys has the keys of chatty's interactive menus, the line editor of chats and the TUI,
+// which can be remapped with keybindings in config.json. Keys are named the way the TUI names
+// them, like "enter", "esc", "tab", "up", "ctrl+c" or "alt+enter"
+package keys
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Actions keys can be bound to
+const (
+	Cancel         = "cancel"          // Leave a menu, the message being typed or the TUI
+	Send           = "send"            // Send the message typed, or choose the menu item highlighted
+	NewLine        = "new_line"        // Start a new line in the message typed
+	SwitchAgent    = "switch_agent"    // Move to the agents in the TUI's sidebar, and back
+	SelectMessages = "select_messages" // Choose a message of the TUI's conversation, with the message box empty
+	SplitView      = "split_view"      // Show a TUI group chat in a column per agent, or as one conversation
+	Interject      = "interject"       // Send the message typed while the agents of a TUI group chat answer, once the one speaking is done
+	Regenerate     = "regenerate"      // Have the agents answer the last message again, with nothing typed
+)
+
+// defaults are the keys of each action unless config.json binds others
+var defaults = map[string][]string{
+	Cancel:         {"esc", "ctrl+c"},
+	Send:           {"enter"},
+	NewLine:        {"alt+enter", "ctrl+j"},
+	SwitchAgent:    {"tab"},
+	SelectMessages: {"up"},
+	SplitView:      {"ctrl+s"},
+	Interject:      {"ctrl+g"},
+	Regenerate:     {"ctrl+r"},
+}
+
+// namedKeys are the keys that have a name of their own, besides letters and symbols
+var namedKeys = map[string]bool{
+	"enter": true, "esc": true, "tab": true, "space": true, "backspace": true, "delete": true,
+	"up": true, "down": true, "left": true, "right": true, "home": true, "end": true,
+	"pgup": true, "pgdown": true,
+}
+
+// aliases are keys a terminal sends as the same character as another key, so they arrive as it
+var aliases = map[string]string{
+	"ctrl+m": "enter",
+	"ctrl+i": "tab",
+	"ctrl+h": "backspace",
+}
+
+var (
+	mu       sync.RWMutex
+	bindings = defaults
+)
+
+// Actions returns the names of the actions keys can be bound to
+func Actions() []string {
+	var names []string
+	for action := range defaults {
+		names = append(names, action)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Configure binds the keys of config.json to their actions, leaving the rest to their default
+// keys. Bindings that aren't valid, or that take a key another action has, are left out, as
+// Check reports them
+func Configure(configured map[string][]string) {
+	valid := make(map[string][]string, len(configured))
+	for action, keys := range configured {
+		if checkAction(action, keys) == nil {
+			valid[action] = normalize(keys)
+		}
+	}
+	// Actions sharing a key go back to their defaults, which may free keys of other actions
+	for {
+		merged := merge(valid)
+		shared := false
+		for _, action := range Actions() {
+			if _, _, ok := conflict(merged, action); ok {
+				if _, ok := valid[action]; ok {
+					delete(valid, action)
+					shared = true
+				}
+			}
+		}
+		if !shared {
+			mu.Lock()
+			bindings = merged
+			mu.Unlock()
+			return
+		}
+	}
+}
+
+// Check returns what is wrong with the keybindings of config.json, nil when they can be bound:
+// an unknown action or key, or a key bound to two actions, counting the default keys of the
+// actions left out
+func Check(configured map[string][]string) error {
+	var actions []string
+	for action := range configured {
+		actions = append(actions, action)
+	}
+	sort.Strings(actions)
+	for _, action := range actions {
+		if err := checkAction(action, configured[action]); err != nil {
+			return err
+		}
+	}
+
+	normalized := make(map[string][]string, len(configured))
+	for action, keys := range configured {
+		normalized[action] = normalize(keys)
+	}
+	merged := merge(normalized)
+	for _, action := range Actions() {
+		if key, other, ok := conflict(merged, action); ok {
+			return fmt.Errorf("%s is bound to both %s and %s: give each action keys of its own", key, min(action, other), max(action, other))
+		}
+	}
+	return nil
+}
+
+// checkAction returns what is wrong with binding keys to an action on their own
+func checkAction(action string, keys []string) error {
+	if _, ok := defaults[action]; !ok {
+		return fmt.Errorf("unknown action %q: use %s", action, strings.Join(Actions(), ", "))
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("no keys for %s", action)
+	}
+	for _, key := range normalize(keys) {
+		if !valid(key) {
+			return fmt.Errorf("unknown key %q for %s: use names like enter, esc, tab, up, ctrl+s or alt+enter", key, action)
+		}
+		alt, letter := "", key
+		if rest, ok := strings.CutPrefix(key, "alt+"); ok {
+			alt, letter = "alt+", rest
+		}
+		if same, ok := aliases[letter]; ok {
+			return fmt.Errorf("%s can't be bound to %s, as terminals send it as %s%s: use %s%s", key, action, alt, same, alt, same)
+		}
+	}
+	return nil
+}
+
+// merge returns the keys of every action: the ones given, or the defaults
+func merge(keys map[string][]string) map[string][]string {
+	merged := make(map[string][]string, len(defaults))
+	for action, bound := range defaults {
+		merged[action] = bound
+	}
+	for action, bound := range keys {
+		merged[action] = bound
+	}
+	return merged
+}
+
+// conflict returns a key of action that another action is bound to as well, with the other
+// action, the first in alphabetical order
+func conflict(merged map[string][]string, action string) (string, string, bool) {
+	for _, other := range Actions() {
+		if other == action {
+			continue
+		}
+		for _, key := range merged[action] {
+			for _, taken := range merged[other] {
+				if key == taken {
+					return key, other, true
+				}
+			}
+		}
+	}
+	return "", "", false
+}
+
+// valid reports whether a key has a name chatty knows
+func valid(key string) bool {
+	if rest, ok := strings.CutPrefix(key, "alt+"); ok {
+		key = rest
+	}
+	if letter, ok := strings.CutPrefix(key, "ctrl+"); ok {
+		return len(letter) == 1 && letter[0] >= 'a' && letter[0] <= 'z'
+	}
+	return namedKeys[key] || len([]rune(key)) == 1
+}
+
+// normalize writes key names in lower case, as the TUI names them
+func normalize(keys []string) []string {
+	normalized := make([]string, len(keys))
+	for i, key := range keys {
+		normalized[i] = strings.ToLower(strings.TrimSpace(key))
+	}
+	return normalized
+}
+
+// Of returns the keys bound to an action
+func Of(action string) []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return bindings[action]
+}
+
+// Matches reports whether key is bound to an action
+func Matches(action, key string) bool {
+	for _, bound := range Of(action) {
+		if bound == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Label returns the first key of an action as it is written in help, like "Ctrl+S" or "Enter"
+func Label(action string) string {
+	keys := Of(action)
+	if len(keys) == 0 {
+		return ""
+	}
+	parts := strings.Split(keys[0], "+")
+	for i, part := range parts {
+		switch part {
+		case "up":
+			parts[i] = "↑"
+		case "down":
+			parts[i] = "↓"
+		case "pgup":
+			parts[i] = "PgUp"
+		case "pgdown":
+			parts[i] = "PgDn"
+		default:
+			parts[i] = strings.ToUpper(part[:1]) + part[1:]
+		}
+	}
+	return strings.Join(parts, "+")
+}
+
+// Name returns the name of the key that raw terminal input starts with: a byte for most keys,
+// Escape followed by another key for Alt with the key, or an escape sequence for arrows and
+// other keys. It is empty for sequences it doesn't know
+func Name(input []byte) string {
+	if len(input) == 0 {
+		return ""
+	}
+	if input[0] == 27 && len(input) > 1 {
+		if input[1] == '[' || input[1] == 'O' {
+			return sequenceName(string(input[2:]))
+		}
+		if name := Name(input[1:]); name != "" {
+			return "alt+" + name
+		}
+		return ""
+	}
+	return RuneName(rune(input[0]))
+}
+
+// RuneName returns the name of the key a character typed in raw mode stands for
+func RuneName(r rune) string {
+	switch {
+	case r == '\r':
+		return "enter"
+	case r == '\t':
+		return "tab"
+	case r == 27:
+		return "esc"
+	case r == ' ':
+		return "space"
+	case r == 8 || r == 127:
+		return "backspace"
+	case r >= 1 && r <= 26:
+		return "ctrl+" + string(rune('a'+r-1))
+	case r < 32:
+		return ""
+	}
+	return strings.ToLower(string(r))
+}
+
+// sequenceName returns the name of the key an escape sequence stands for, given what follows
+// its "\x1b[" or "\x1bO"
+func sequenceName(sequence string) string {
+	switch sequence {
+	case "A":
+		return "up"
+	case "B":
+		return "down"
+	case "C":
+		return "right"
+	case "D":
+		return "left"
+	case "H", "1~", "7~":
+		return "home"
+	case "F", "4~", "8~":
+		return "end"
+	case "3~":
+		return "delete"
+	case "5~":
+		return "pgup"
+	case "6~":
+		return "pgdown"
+	}
+	return ""
+}
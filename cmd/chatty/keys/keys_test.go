@@ -0,0 +1,199 @@
+package keys
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestName(t *testing.T) {
+	tests := []struct {
+		input []byte
+		want  string
+	}{
+		{[]byte("\r"), "enter"},
+		{[]byte("\t"), "tab"},
+		{[]byte{27}, "esc"},
+		{[]byte(" "), "space"},
+		{[]byte{127}, "backspace"},
+		{[]byte{8}, "backspace"},
+		{[]byte{10}, "ctrl+j"},
+		{[]byte{13}, "enter"},
+		{[]byte{9}, "tab"},
+		{[]byte{3}, "ctrl+c"},
+		{[]byte{19}, "ctrl+s"},
+		{[]byte("Q"), "q"},
+		{[]byte("?"), "?"},
+		{[]byte{27, '\r'}, "alt+enter"},
+		{[]byte{27, 'b'}, "alt+b"},
+		{[]byte{27, 8}, "alt+backspace"},
+		{[]byte("\x1b[A"), "up"},
+		{[]byte("\x1bOB"), "down"},
+		{[]byte("\x1b[5~"), "pgup"},
+		{[]byte("\x1b[1;5C"), ""},
+		{[]byte{27, 0}, ""},
+		{[]byte{0}, ""},
+		{nil, ""},
+	}
+	for _, tt := range tests {
+		if got := Name(tt.input); got != tt.want {
+			t.Errorf("Name(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestSequenceName(t *testing.T) {
+	tests := []struct {
+		sequence string
+		want     string
+	}{
+		{"A", "up"},
+		{"B", "down"},
+		{"C", "right"},
+		{"D", "left"},
+		{"H", "home"},
+		{"1~", "home"},
+		{"7~", "home"},
+		{"F", "end"},
+		{"4~", "end"},
+		{"8~", "end"},
+		{"3~", "delete"},
+		{"5~", "pgup"},
+		{"6~", "pgdown"},
+		{"200~", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := sequenceName(tt.sequence); got != tt.want {
+			t.Errorf("sequenceName(%q) = %q, want %q", tt.sequence, got, tt.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		action string
+		keys   []string
+		err    string // Part of the error expected, empty for none
+	}{
+		{Send, []string{"enter"}, ""},
+		{Cancel, []string{"Ctrl+Q", " esc "}, ""},
+		{NewLine, []string{"alt+enter"}, ""},
+		{SwitchAgent, []string{"alt+ctrl+a"}, ""},
+		{SelectMessages, []string{"pgdown"}, ""},
+		{Regenerate, []string{"ctrl+r", "x"}, ""},
+		{Interject, []string{"é"}, ""},
+		{"jump", []string{"enter"}, "unknown action"},
+		{Send, nil, "no keys"},
+		{Send, []string{"ctrl+1"}, "unknown key"},
+		{Send, []string{"ctrl+ab"}, "unknown key"},
+		{Send, []string{"return"}, "unknown key"},
+		{Send, []string{""}, "unknown key"},
+		{Send, []string{"ctrl+m"}, "terminals send it as enter"},
+		{SwitchAgent, []string{"Ctrl+I"}, "terminals send it as tab"},
+		{Regenerate, []string{"ctrl+h"}, "terminals send it as backspace"},
+		{Regenerate, []string{"alt+ctrl+m"}, "terminals send it as alt+enter"},
+		{Send, []string{"ctrl+j"}, "ctrl+j is bound to both new_line and send"},
+		{Regenerate, []string{"Esc"}, "esc is bound to both cancel and regenerate"},
+	}
+	for _, tt := range tests {
+		err := Check(map[string][]string{tt.action: tt.keys})
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("Check(%q, %q) = %v, want nil", tt.action, tt.keys, err)
+		case tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)):
+			t.Errorf("Check(%q, %q) = %v, want an error with %q", tt.action, tt.keys, err, tt.err)
+		}
+	}
+}
+
+func TestCheckConflicts(t *testing.T) {
+	// Keys can be moved to another action along with the one they leave
+	if err := Check(map[string][]string{Send: {"ctrl+j"}, NewLine: {"enter"}}); err != nil {
+		t.Errorf("Check of swapped keys = %v, want nil", err)
+	}
+	err := Check(map[string][]string{SplitView: {"ctrl+q"}, Interject: {"ctrl+q"}})
+	if err == nil || !strings.Contains(err.Error(), "ctrl+q is bound to both") {
+		t.Errorf("Check of a key bound to two actions = %v, want an error", err)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	t.Cleanup(func() { Configure(nil) })
+	tests := []struct {
+		keys []string
+		want string
+	}{
+		{[]string{"enter"}, "Enter"},
+		{[]string{"ctrl+s", "esc"}, "Ctrl+S"},
+		{[]string{"alt+enter"}, "Alt+Enter"},
+		{[]string{"up"}, "↑"},
+		{[]string{"down"}, "↓"},
+		{[]string{"pgup"}, "PgUp"},
+		{[]string{"PgDown"}, "PgDn"},
+		{[]string{"q"}, "Q"},
+	}
+	for _, tt := range tests {
+		// The actions with these keys by default move to others, as a key binds one action
+		Configure(map[string][]string{SplitView: tt.keys, Cancel: {"ctrl+c"}, Send: {"ctrl+e"}, NewLine: {"ctrl+o"}, SelectMessages: {"ctrl+p"}})
+		if got := Label(SplitView); got != tt.want {
+			t.Errorf("Label with keys %q = %q, want %q", tt.keys, got, tt.want)
+		}
+	}
+}
+
+func TestConfigureKeepsDefaults(t *testing.T) {
+	t.Cleanup(func() { Configure(nil) })
+	Configure(map[string][]string{Cancel: {"ctrl+q"}, Send: {"nope"}})
+	if !Matches(Cancel, "ctrl+q") || Matches(Cancel, "esc") {
+		t.Errorf("cancel is bound to %q, want only ctrl+q", Of(Cancel))
+	}
+	if !Matches(Send, "enter") {
+		t.Errorf("send is bound to %q after an invalid binding, want its default", Of(Send))
+	}
+	if !Matches(Regenerate, "ctrl+r") {
+		t.Errorf("regenerate is bound to %q, want its default", Of(Regenerate))
+	}
+}
+
+func TestConfigureConflicts(t *testing.T) {
+	t.Cleanup(func() { Configure(nil) })
+	tests := []struct {
+		name       string
+		configured map[string][]string
+		want       map[string]string // Key each action is bound to first
+	}{
+		{
+			name:       "key of a default",
+			configured: map[string][]string{Send: {"ctrl+j"}},
+			want:       map[string]string{Send: "enter", NewLine: "alt+enter"},
+		},
+		{
+			name:       "key of two actions",
+			configured: map[string][]string{SplitView: {"ctrl+q"}, Interject: {"ctrl+q"}, Regenerate: {"ctrl+e"}},
+			want:       map[string]string{SplitView: "ctrl+s", Interject: "ctrl+g", Regenerate: "ctrl+e"},
+		},
+		{
+			name:       "key freed by a reverted action",
+			configured: map[string][]string{Cancel: {"ctrl+q"}, Send: {"ctrl+q"}, Regenerate: {"enter"}},
+			want:       map[string]string{Cancel: "esc", Send: "enter", Regenerate: "ctrl+r"},
+		},
+		{
+			name:       "swapped keys",
+			configured: map[string][]string{Send: {"ctrl+j"}, NewLine: {"enter"}},
+			want:       map[string]string{Send: "ctrl+j", NewLine: "enter"},
+		},
+		{
+			name:       "alias",
+			configured: map[string][]string{Send: {"ctrl+m"}},
+			want:       map[string]string{Send: "enter"},
+		},
+	}
+	for _, tt := range tests {
+		Configure(tt.configured)
+		for action, want := range tt.want {
+			if got := Of(action); len(got) == 0 || got[0] != want {
+				t.Errorf("%s: %s is bound to %q, want %s first", tt.name, action, got, want)
+			}
+		}
+	}
+}
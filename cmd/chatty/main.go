@@ -3,30 +3,80 @@ package main
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"os/exec"
 	"os/signal"
 	"path/filepath"
+	"regexp"
+	"slices"
+	"runtime"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"gopkg.in/yaml.v3"
 
 	"chatty/cmd/chatty/agents"
+	"chatty/cmd/chatty/animation"
+	"chatty/cmd/chatty/appdir"
+	"chatty/cmd/chatty/atomicfile"
+	"chatty/cmd/chatty/attach"
+	"chatty/cmd/chatty/bridge"
 	"chatty/cmd/chatty/builder"
+	"chatty/cmd/chatty/campaign"
+	"chatty/cmd/chatty/elapsed"
+	"chatty/cmd/chatty/export"
+	"chatty/cmd/chatty/failure"
+	"chatty/cmd/chatty/filelock"
+	"chatty/cmd/chatty/follow"
+	"chatty/cmd/chatty/kb"
+	"chatty/cmd/chatty/keys"
+	"chatty/cmd/chatty/memory"
+	"chatty/cmd/chatty/modes"
+	"chatty/cmd/chatty/notify"
+	"chatty/cmd/chatty/pair"
+	"chatty/cmd/chatty/pipeline"
+	"chatty/cmd/chatty/profile"
+	"chatty/cmd/chatty/render"
+	"chatty/cmd/chatty/scenario"
+	"chatty/cmd/chatty/secrets"
+	"chatty/cmd/chatty/server"
 	"chatty/cmd/chatty/share"
+	"chatty/cmd/chatty/speech"
 	"chatty/cmd/chatty/store"
+	"chatty/cmd/chatty/story"
+	"chatty/cmd/chatty/suggest"
+	"chatty/cmd/chatty/templates"
+	"chatty/cmd/chatty/term"
+	"chatty/cmd/chatty/theme"
+	"chatty/cmd/chatty/tokens"
+	"chatty/cmd/chatty/tools"
+	"chatty/cmd/chatty/tui"
+	"chatty/cmd/chatty/usage"
 )
 
 type Message struct {
     Role    string `json:"role"`
     Content string `json:"content"`
+    Images  []string `json:"images,omitempty"` // Base64 encoded images for multimodal models
+    ToolCalls []tools.Call `json:"tool_calls,omitempty"` // Tools the model asked to run
+    ToolName  string       `json:"tool_name,omitempty"`  // Tool whose result a "tool" message carries
 }
 
 type ChatRequest struct {
@@ -34,12 +84,17 @@ type ChatRequest struct {
     Messages []Message `json:"messages"`
     Stream   bool      `json:"stream"`
     KeepAlive string   `json:"keep_alive,omitempty"`
+    Tools    []tools.Definition `json:"tools,omitempty"`
+    Options  map[string]any     `json:"options,omitempty"`
 }
 
 type ChatResponse struct {
     Message  Message `json:"message"`
     Done     bool    `json:"done"`
     Response string `json:"response"`
+    PromptEvalCount int `json:"prompt_eval_count"` // Tokens of the prompt, reported with the last chunk
+    EvalCount int `json:"eval_count"`       // Tokens of the response, reported with the last chunk
+    EvalDuration int64 `json:"eval_duration"` // Nanoseconds spent generating them
 }
 
 // Add these new types after the existing types
@@ -50,6 +105,11 @@ type ConversationConfig struct {
     Current    int  // Current turn
     AutoMode   bool // If true, agents converse among themselves without user input
     SaveFile   string // Path to save conversation log
+    Reference  string // Attached material (pages, files) shared with all agents
+    SummaryEvery int    // Turns between "so far" summaries in auto mode, 0 for none
+    Facilitator  string // Agent writing the summaries, empty for a plain summary from the model
+    Briefings     []string // Scenario role of each agent, added to its system message
+    WinConditions []string // Scenario outcomes that end the conversation once one happens
 }
 
 // Add this new type for conversation history
@@ -60,17 +120,42 @@ type ConversationHistory struct {
 // Add this new animation type that includes agent info
 type ConversationAnimation struct {
     stopChan chan bool
+    done     chan bool
     agent agents.AgentConfig
 }
 
+// Base URL for Ollama API, from ollama_url in config.json or CHATTY_OLLAMA_URL
+var ollamaBaseURL = "http://localhost:11434"
+
 const (
     // Core configuration
-    ollamaBaseURL = "http://localhost:11434"  // Base URL for Ollama API
     ollamaURLPath = "/api/chat"              // API endpoint path
     keepAlive = "24h"
-    historyDir    = ".chatty"               // Directory to store chat histories
     configFile    = "config.json"           // File to store current agent selection
 
+    // Rounds of tool calls allowed before the model must answer
+    maxToolRounds = 5
+
+    // Times a response cut off midway is picked up again before the turn fails
+    maxResumes = 3
+
+    // Context sizes, in tokens
+    ollamaDefaultContext = 4096  // Ollama's num_ctx when neither the model nor the server sets one
+    responseReserve      = 1024  // Room left for the response, at most a quarter of the context
+    messageOverhead      = 4     // Role and template tokens around each message
+    imageTokens          = 576   // Tokens an image takes for typical vision models
+
+    // History files are compacted to their latest messages once they grow past these, as older
+    // messages no longer fit in a model's context
+    maxHistoryBytes     = 8 << 20 // Checked after each save
+    maxHistoryMessages  = 2000    // Checked as the history is read
+    keptHistoryMessages = 1000    // Messages kept, in at most half of maxHistoryBytes
+
+    // Last message of each agent's request in a conversation between agents
+    groupReplyInstruction = "Respond naturally as part of this conversation and do not add prefixes like '</Your name/> said:' to your messages."
+
+    defaultSummaryEvery = 5 // Turns between "so far" summaries in auto mode when only --facilitator is given
+
     // Request timeouts and retry settings
     maxRetries = 5                          // Increased from 3 to 5
     initialRetryDelay = 2 * time.Second     // Initial delay before first retry
@@ -84,50 +169,40 @@ const (
     maxIdleConns = 100
     maxConnsPerHost = 100
     idleConnTimeout = 90 * time.Second
+    interruptGrace = 2 * time.Second     // Time requests in flight get to end after Ctrl+C
+    readyTimeout = 5 * time.Second       // Timeout for checking that Ollama is running
     
     // Display configuration
     chatTopMargin     = 1           // Number of blank lines before response in chat mode
     chatBottomMargin   = 1          // Number of blank lines after response in chat mode
     converseMargin     = 1          // Number of blank lines between messages in converse mode
-    useEmoji      = true        // Enable/disable emoji display
-    useColors     = true        // Enable/disable colored output
-    colorReset    = "\033[0m"   // Reset color code
     
-    // Animation configuration
-    frameDelay   = 200          // Milliseconds between animation frames
-
+    // Label configuration (templates support {emoji}, {name} and {time})
+    userEmoji = "👤"
+    userName  = "User"
+    defaultUserLabelTemplate  = "{emoji} {name}: "
+    defaultAgentLabelTemplate = "{emoji} {name}: "
 )
 
 // Animation control
 type Animation struct {
     stopChan chan bool
+    done     chan bool
 }
 
 // Start the jumping dots animation
 func startAnimation() *Animation {
     anim := &Animation{
         stopChan: make(chan bool),
+        done:     make(chan bool),
     }
     
     // Start animation in background
     go func() {
-        frames := []string{"   ", ".  ", ".. ", "..."}
-        frameIndex := 0
-        
-        for {
-            select {
-            case <-anim.stopChan:
-                return
-            default:
-                // Clear line and print current frame
-                fmt.Printf("\r%s%s", colorize(getAgentLabel(), currentAgent.LabelColor), frames[frameIndex])
-                
-                // Move to next frame
-                frameIndex = (frameIndex + 1) % len(frames)
-                
-                time.Sleep(time.Millisecond * frameDelay)
-            }
-        }
+        animate(anim.stopChan, func() string {
+            return colorize(getAgentLabel(), currentAgent.LabelColor)
+        })
+        close(anim.done)
     }()
     
     return anim
@@ -136,8 +211,138 @@ func startAnimation() *Animation {
 // Stop the animation
 func (a *Animation) stopAnimation() {
     a.stopChan <- true
+    <-a.done
     // Clear the animation and prepare for response
-    fmt.Printf("\r%s", colorize(getAgentLabel(), currentAgent.LabelColor))
+    if len(animationFrames()) > 0 {
+        fmt.Printf("\r%s", colorize(getAgentLabel(), currentAgent.LabelColor))
+    }
+}
+
+// loadCheckDelay is how long a response may take to start before chatty checks whether Ollama
+// is loading the model, and how often it checks again until the model is in memory
+const loadCheckDelay = 2 * time.Second
+
+// Animation shown while waiting for responses, from animation and animation_delay in
+// config.json
+var (
+    animationStyle  string // Style configured, empty for the default
+    animationDelay  = animation.DefaultDelay
+    animationOption string // Style chosen with --animation for this run
+)
+
+// animationFrames returns the frames of the animation style in use. Without one set, output
+// that isn't a terminal, like a CI log, gets no animation
+func animationFrames() []string {
+    style := animationStyle
+    if animationOption != "" {
+        style = animationOption
+    }
+    if style == "" && !outputIsTerminal() {
+        style = animation.None
+    }
+    return animation.Frames(style)
+}
+
+// outputIsTerminal reports whether chatty prints to a terminal rather than a pipe or a file
+func outputIsTerminal() bool {
+    return term.IsTerminal(terminal())
+}
+
+// terminal returns where chatty's output ends up: os.Stdout, or what it was before --log put a
+// pipe in its place. Whether output goes to a terminal, and how large it is, are told by it
+func terminal() *os.File {
+    if outputTee != nil {
+        return outputTee.Terminal()
+    }
+    return os.Stdout
+}
+
+// animate prints label followed by an animation until stop receives, waiting for a response.
+// While Ollama is loading the model, which takes a while for large ones, it says so with the
+// time spent instead of the animation. The frame is wiped when it stops, leaving the label.
+// Without frames, the label is printed once and nothing else
+func animate(stop chan bool, label func() string) {
+    frames := animationFrames()
+    if len(frames) == 0 {
+        fmt.Print(label())
+        <-stop
+        return
+    }
+    frameIndex := 0
+    start := time.Now()
+    model := agents.GetCurrentModel()
+
+    // Ask Ollama in the background, so checking doesn't hold up the frames
+    var loading atomic.Bool
+    checks := make(chan struct{})
+    defer close(checks)
+    go func() {
+        ticker := time.NewTicker(loadCheckDelay)
+        defer ticker.Stop()
+        for {
+            select {
+            case <-checks:
+                return
+            case <-ticker.C:
+                loaded := modelLoaded(model)
+                loading.Store(!loaded)
+                if loaded {
+                    return
+                }
+            }
+        }
+    }()
+
+    width := utf8.RuneCountInString(frames[0])
+    for {
+        select {
+        case <-stop:
+            // Spaces over what the last frame printed, as the response may be shorter
+            fmt.Printf("\r%s%s", label(), strings.Repeat(" ", width))
+            return
+        default:
+            frame, isLoading := frames[frameIndex], loading.Load()
+            if isLoading {
+                frame = fmt.Sprintf("loading %s… %s", model, formatElapsedTime(start, time.Now()))
+            }
+            // Spaces over the rest of longer frames printed before, once the model has loaded
+            padding := max(width-utf8.RuneCountInString(frame), 0)
+            width = max(width, utf8.RuneCountInString(frame))
+            if isLoading {
+                frame = colorize(frame, theme.Current().Muted)
+            }
+
+            // Clear line and print current frame
+            fmt.Printf("\r%s%s%s", label(), frame, strings.Repeat(" ", padding))
+            
+            // Move to next frame
+            frameIndex = (frameIndex + 1) % len(frames)
+            
+            time.Sleep(animationDelay)
+        }
+    }
+}
+
+// modelLoaded reports whether Ollama has model in memory, taking it as loaded when Ollama
+// can't tell. Names without a tag are the model tagged latest
+func modelLoaded(model string) bool {
+    var running struct {
+        Models []struct {
+            Name string `json:"name"`
+        } `json:"models"`
+    }
+    if err := callOllama(http.MethodGet, ollamaBaseURL+"/api/ps", nil, readyTimeout, &running); err != nil {
+        return true
+    }
+    if !strings.Contains(model, ":") {
+        model += ":latest"
+    }
+    for _, m := range running.Models {
+        if m.Name == model {
+            return true
+        }
+    }
+    return false
 }
 
 type Config struct {
@@ -145,41 +350,187 @@ type Config struct {
 }
 
 // Current agent configuration
-var currentAgent = agents.DefaultAgent
+var currentAgent agents.AgentConfig
 
 // Get system message using agent name
 func getSystemMessage() string {
     // Single agent chat is never in auto mode
-    return currentAgent.GetFullSystemMessage(false, "")
+    return buildSystemMessage(currentAgent, false, "")
+}
+
+// Reset color code of the active theme
+var colorReset = theme.Current().Reset
+
+// Activate a theme and refresh the colors derived from it
+func applyTheme(name string) error {
+    err := theme.Init(name)
+    colorReset = theme.Current().Reset
+    return err
+}
+
+// applySettings applies the settings of config.json that chats read from variables: the theme,
+// emojis, labels, the format of elapsed times, the status line of responses and the animation
+// shown while waiting for them
+func applySettings(config *agents.Config) {
+    // Apply the configured color theme
+    applyTheme(config.Theme)
+
+    // Replace emojis with short codes if requested
+    if config.NoEmoji {
+        theme.SetEmoji(false)
+    }
+
+    // Apply custom label templates
+    userLabelTemplate, agentLabelTemplate = defaultUserLabelTemplate, defaultAgentLabelTemplate
+    if config.UserLabelTemplate != "" {
+        userLabelTemplate = config.UserLabelTemplate
+    }
+    if config.AgentLabelTemplate != "" {
+        agentLabelTemplate = config.AgentLabelTemplate
+    }
+
+    // Format elapsed times in the configured style
+    durationFormat = elapsed.Long
+    if config.DurationFormat != "" {
+        durationFormat = config.DurationFormat
+    }
+
+    statusBar = !config.DisableStatusBar
+
+    // Animate the wait for responses in the configured style
+    animationStyle = config.Animation
+    animationDelay = animation.DefaultDelay
+    if config.AnimationDelay > 0 {
+        animationDelay = time.Duration(config.AnimationDelay) * time.Millisecond
+    }
+
+    // Remap the keys of menus, chats and the TUI
+    keys.Configure(config.Keybindings)
+}
+
+// applyToolSettings applies the permissions and other settings of tools in config.json
+func applyToolSettings(config *agents.Config) {
+    toolPermissions = config.ToolPermissions
+    agentToolPermissions = config.AgentToolPermissions
+    tools.ShellAllowlist = config.ShellAllowlist
+    if config.SearchEngine != "" {
+        tools.SearchEngine = config.SearchEngine
+    }
+    tools.SearxNGURL = config.SearxNGURL
+    if root := config.ToolsRoot; root != "" {
+        if strings.HasPrefix(root, "~/") {
+            if home, err := os.UserHomeDir(); err == nil {
+                root = filepath.Join(home, root[2:])
+            }
+        }
+        tools.SandboxRoot = root
+    }
+}
+
+// reloadChanges applies the edits made to config.json and the agents since the watcher last
+// checked, between messages of a chat, and tells the user about them
+func reloadChanges(watcher *agents.Watcher) agents.Changes {
+    changes := watcher.Check()
+    if changes.Empty() {
+        return changes
+    }
+    if changes.Config && changes.Err == nil {
+        if config, err := agents.GetCurrentConfig(); err == nil {
+            applySettings(config)
+            applyToolSettings(config)
+            ollamaBaseURL = agents.OllamaURL()
+            attach.OllamaURL = ollamaBaseURL
+        }
+    }
+    palette := theme.Current()
+    for _, note := range describeChanges(changes) {
+        fmt.Printf("%s↻ %s%s\n", palette.Muted, note, colorReset)
+    }
+    return changes
+}
+
+// watchChanges reports edits to config.json and the agents while a server or bridge runs. Each
+// request looks up its agent and the model as they are, so they need nothing else to apply
+func watchChanges(logf func(format string, args ...any)) {
+    watcher := agents.NewWatcher()
+    go func() {
+        for range time.Tick(watchInterval) {
+            for _, note := range describeChanges(watcher.Check()) {
+                logf("%s", note)
+            }
+        }
+    }()
+}
+
+// watchInterval is how often servers and bridges check for edits to config.json and the agents
+const watchInterval = 2 * time.Second
+
+// describeChanges tells what was edited in config.json and the agents, a line per kind of change
+func describeChanges(changes agents.Changes) []string {
+    var notes []string
+    if changes.Err != nil {
+        notes = append(notes, fmt.Sprintf("config.json was changed but can't be loaded, so the previous settings stay: %v", changes.Err))
+    } else if changes.Config {
+        note := "Reloaded config.json"
+        if changes.Model != "" {
+            note += fmt.Sprintf(", the model is now %s", changes.Model)
+        }
+        notes = append(notes, note)
+    }
+    for _, change := range []struct {
+        label string
+        names []string
+    }{{"New agents", changes.Added}, {"Updated agents", changes.Updated}, {"Removed agents", changes.Removed}} {
+        if len(change.names) > 0 {
+            notes = append(notes, fmt.Sprintf("%s: %s", change.label, strings.Join(change.names, ", ")))
+        }
+    }
+    return notes
 }
 
 // Format text with color if enabled
 func colorize(text, color string) string {
-    if useColors {
-        return color + text + colorReset
+    if theme.Current().NoColor {
+        return text
     }
-    return text
+    return color + text + colorReset
 }
 
 // Get formatted agent label with optional emoji
 func getAgentLabel() string {
-    label := currentAgent.Name
-    if useEmoji {
-        return currentAgent.Emoji + " " + label + ": "
-    }
-    return label + ": "
+    return formatAgentLabel(currentAgent)
+}
+
+// Label templates loaded from config.json
+var (
+    userLabelTemplate  = defaultUserLabelTemplate
+    agentLabelTemplate = defaultAgentLabelTemplate
+)
+
+// formatLabel fills a label template's {emoji}, {name} and {time} placeholders
+func formatLabel(template, emoji, name string) string {
+    replacer := strings.NewReplacer(
+        "{emoji}", theme.AgentEmoji(emoji, name),
+        "{name}", name,
+        "{time}", time.Now().Format("15:04"),
+    )
+    return replacer.Replace(template)
+}
+
+// formatUserLabel returns the label printed before user messages
+func formatUserLabel() string {
+    return formatLabel(userLabelTemplate, userEmoji, userName)
+}
+
+// formatAgentLabel returns the label printed before an agent's messages
+func formatAgentLabel(agent agents.AgentConfig) string {
+    return formatLabel(agentLabelTemplate, agent.Emoji, agent.Name)
 }
 
 // Get the history file path for a specific agent
 func getHistoryPathForAgent(agentName string) (string, error) {
-    homeDir, err := os.UserHomeDir()
-    if err != nil {
-        return "", err
-    }
-    
-    // Get the history file path from the agents package
-    historyFile := agents.GetHistoryFileName(agentName)
-    return filepath.Join(homeDir, historyFile), nil
+    // Get the history file name from the agents package
+    return appdir.DataPath(agents.GetHistoryFileName(agentName))
 }
 
 // Get the history file path for the current agent
@@ -187,71 +538,67 @@ func getHistoryPath() (string, error) {
     return getHistoryPathForAgent(currentAgent.Name)
 }
 
-// Cache for chat histories
-var historyCache = make(map[string][]Message)
-
-// loadHistory loads chat history with caching
-func loadHistory() ([]Message, error) {
-    // Check cache first
-    if history, exists := historyCache[currentAgent.Name]; exists {
-        return history, nil
-    }
-
-    // For first use, just return initial chat without file I/O
-    historyPath, err := getHistoryPath()
+// lockHistoryFile keeps other chatty processes from chatting with an agent until the returned lock
+// is released, so two chats can't save over each other's messages
+func lockHistoryFile(agentName string) (*filelock.Lock, error) {
+    historyPath, err := getHistoryPathForAgent(agentName)
     if err != nil {
-        return initializeChat(), nil
+        return nil, err
     }
+    return lockHistoryPath(historyPath, agentName)
+}
 
-    // Quick check if file exists without reading it
-    if _, err := os.Stat(historyPath); os.IsNotExist(err) {
-        history := initializeChat()
-        historyCache[currentAgent.Name] = history
-        return history, nil
+// lockHistoryPath locks the history file at path, reporting a lock held by another chatty as
+// the agent's history being in use
+func lockHistoryPath(historyPath, agentName string) (*filelock.Lock, error) {
+    if err := os.MkdirAll(filepath.Dir(historyPath), 0755); err != nil {
+        return nil, fmt.Errorf("failed to create history directory: %v", err)
     }
-
-    // Only read file if it actually exists
-    data, err := os.ReadFile(historyPath)
-    if err != nil {
-        return initializeChat(), nil
+    lock, err := filelock.Acquire(historyPath)
+    var inUse *filelock.InUseError
+    if errors.As(err, &inUse) {
+        return nil, fmt.Errorf("chat history for %s is %v, try again when that chat ends", agentName, err)
     }
+    return lock, err
+}
 
-    var history []Message
-    if err := json.Unmarshal(data, &history); err != nil {
-        history = initializeChat()
-        historyCache[currentAgent.Name] = history
-        return history, nil
+// cachedHistory is an agent's chat history and how many of its messages are already saved
+type cachedHistory struct {
+    messages []Message
+    saved    int
+}
+
+// Cache for chat histories
+var historyCache = make(map[string]cachedHistory)
+
+// loadHistory loads chat history with caching
+func loadHistory() ([]Message, error) {
+    // Check cache first
+    if cached, exists := historyCache[currentAgent.Name]; exists {
+        return cached.messages, nil
     }
 
-    // If history is empty or doesn't start with system message, initialize it
-    if len(history) == 0 {
-        history = initializeChat()
-    } else if history[0].Role != "system" {
-        // Prepend system message if it's missing
-        newHistory := make([]Message, len(history)+1)
-        newHistory[0] = Message{
-            Role:    "system",
-            Content: getSystemMessage(),
-        }
-        copy(newHistory[1:], history)
-        history = newHistory
-    } else if !strings.Contains(history[0].Content, currentAgent.Name) {
-        // Update system message if it's for a different agent
-        history[0] = Message{
-            Role:    "system",
-            Content: getSystemMessage(),
+    // The stored system message is refreshed, so agent, config and memory changes apply
+    history := initializeChat()
+    if historyPath, err := getHistoryPath(); err == nil {
+        // A history that can't be read is reported rather than replaced by a new conversation
+        messages, err := readHistory(historyPath)
+        if err != nil {
+            return nil, fmt.Errorf("%v (chatty --clear \"%s\" starts over)", err, currentAgent.Name)
         }
+        history = append(history, messages...)
     }
 
     // Cache the loaded history
-    historyCache[currentAgent.Name] = history
+    historyCache[currentAgent.Name] = cachedHistory{messages: history, saved: len(history)}
     return history, nil
 }
 
-// saveHistory saves chat history and updates cache
+// saveHistory saves chat history and updates cache. Messages added since the history was loaded
+// are appended to its file, which is only rewritten when earlier messages changed
 func saveHistory(history []Message) error {
-    // Update cache
-    historyCache[currentAgent.Name] = history
+    cached := historyCache[currentAgent.Name]
+    historyCache[currentAgent.Name] = cachedHistory{messages: history, saved: len(history)}
 
     // Ensure directory exists before trying to save
     historyPath, err := getHistoryPath()
@@ -265,38 +612,67 @@ func saveHistory(history []Message) error {
         return fmt.Errorf("failed to create history directory: %v", err)
     }
 
-    // Save the history file
-    data, err := json.MarshalIndent(history, "", "    ")
-    if err != nil {
-        return err
+    if cached.saved > 0 && len(history) >= cached.saved && sameMessages(history[:cached.saved], cached.messages[:cached.saved]) {
+        return appendHistory(historyPath, 0644, history[cached.saved:]...)
+    }
+    return writeHistory(historyPath, 0644, history)
+}
+
+// sameMessages reports whether two histories hold the same messages, ignoring the system message
+// which is refreshed on every load
+func sameMessages(a, b []Message) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if a[i].Role == "system" && b[i].Role == "system" {
+            continue
+        }
+        if a[i].Role != b[i].Role || a[i].Content != b[i].Content || a[i].ToolName != b[i].ToolName || len(a[i].ToolCalls) != len(b[i].ToolCalls) {
+            return false
+        }
     }
-    return os.WriteFile(historyPath, data, 0644)
+    return true
 }
 
 // clearHistory clears chat history and cache
 func clearHistory(target string) error {
     if strings.EqualFold(target, "all") {
         // Clear all histories and cache
-        homeDir, err := os.UserHomeDir()
+        baseDir, err := appdir.DataDir()
         if err != nil {
-            return fmt.Errorf("failed to get home directory: %v", err)
+            return err
         }
         
-        baseDir := filepath.Join(homeDir, historyDir)
         files, err := os.ReadDir(baseDir)
         if err != nil {
             if os.IsNotExist(err) {
                 // Clear cache
-                historyCache = make(map[string][]Message)
+                historyCache = make(map[string]cachedHistory)
                 fmt.Println("No chat histories found. Fresh conversations will be started for each agent.")
                 return nil
             }
             return fmt.Errorf("failed to read history directory: %v", err)
         }
 
+        // Nothing is cleared while a chat is saving to one of the histories, even one not saved yet
+        locked := make(map[string]bool)
+        for _, file := range files {
+            name := strings.TrimSuffix(file.Name(), ".lock")
+            if !strings.HasPrefix(name, "chat_history_") || !strings.HasSuffix(name, ".jsonl") || locked[name] {
+                continue
+            }
+            lock, err := lockHistoryPath(filepath.Join(baseDir, name), historyAgentName(name))
+            if err != nil {
+                return err
+            }
+            defer lock.Release()
+            locked[name] = true
+        }
+
         cleared := false
         for _, file := range files {
-            if strings.HasPrefix(file.Name(), "chat_history_") && strings.HasSuffix(file.Name(), ".json") {
+            if (strings.HasPrefix(file.Name(), "chat_history_") || strings.HasPrefix(file.Name(), "chat_summary_")) && (strings.HasSuffix(file.Name(), ".json") || strings.HasSuffix(file.Name(), ".jsonl")) {
                 err := os.Remove(filepath.Join(baseDir, file.Name()))
                 if err != nil {
                     return fmt.Errorf("failed to remove %s: %v", file.Name(), err)
@@ -306,7 +682,7 @@ func clearHistory(target string) error {
         }
         
         // Clear cache
-        historyCache = make(map[string][]Message)
+        historyCache = make(map[string]cachedHistory)
         
         if cleared {
             fmt.Println("All chat histories have been cleared. Fresh conversations will be started for each agent.")
@@ -318,1222 +694,6903 @@ func clearHistory(target string) error {
 
     // Clear specific agent's history
     if !agents.IsValidAgent(target) {
-        return fmt.Errorf("invalid agent name: %s", target)
+        return failure.New(failure.InvalidAgent, "invalid agent name: %s", target)
     }
 
     // Get proper case for agent name
     agentConfig := agents.GetAgentConfig(target)
     properName := agentConfig.Name
 
+    lock, err := lockHistoryFile(properName)
+    if err != nil {
+        return err
+    }
+    defer lock.Release()
+
     // Clear cache for this agent
     delete(historyCache, properName)
 
+    // The memory summary goes with the history it summarizes
+    if summaryPath, err := getSummaryPathForAgent(target); err == nil {
+        if err := os.Remove(summaryPath); err != nil && !os.IsNotExist(err) {
+            return fmt.Errorf("failed to clear memory for %s: %v", properName, err)
+        }
+    }
+
     historyPath, err := getHistoryPathForAgent(target)
     if err != nil {
         return fmt.Errorf("failed to get history path: %v", err)
     }
 
-    err = os.Remove(historyPath)
-    if err != nil {
-        if os.IsNotExist(err) {
-            fmt.Printf("No history found for %s. A fresh conversation will be started.\n", properName)
-            return nil
+    // Histories saved by earlier versions may not have been converted yet
+    found := false
+    for _, path := range []string{historyPath, strings.TrimSuffix(historyPath, ".jsonl") + ".json"} {
+        err := os.Remove(path)
+        if err != nil && !os.IsNotExist(err) {
+            return fmt.Errorf("failed to clear history for %s: %v", properName, err)
         }
-        return fmt.Errorf("failed to clear history for %s: %v", properName, err)
+        found = found || err == nil
+    }
+    if !found {
+        fmt.Printf("No history found for %s. A fresh conversation will be started.\n", properName)
+        return nil
     }
 
     fmt.Printf("Chat history for %s has been cleared. A fresh conversation will be started.\n", properName)
     return nil
 }
 
-// Initialize a new chat with a system message
-func initializeChat() []Message {
-    return []Message{
-        {
-            Role:    "system",
-            Content: getSystemMessage(),
-        },
+// editorCommand returns the editor to open files with, from $VISUAL or $EDITOR
+func editorCommand() []string {
+    for _, variable := range []string{"VISUAL", "EDITOR"} {
+        if fields := strings.Fields(os.Getenv(variable)); len(fields) > 0 {
+            return fields
+        }
     }
-}
-
-// Update printMargin function name to be more specific
-func printChatMargin(count int) {
-    for i := 0; i < count; i++ {
-        fmt.Println()
+    if runtime.GOOS == "windows" {
+        return []string{"notepad"}
     }
+    return []string{"vi"}
 }
 
-// Get the full Ollama API URL
-func getOllamaAPI() string {
-    return ollamaBaseURL + ollamaURLPath
-}
-
-// Update the animation functions for conversation mode
-func startConversationAnimation(agent agents.AgentConfig) *ConversationAnimation {
-    anim := &ConversationAnimation{
-        stopChan: make(chan bool),
-        agent: agent,
+// editAgent opens an agent's YAML in the editor and saves it once it is valid, asking to edit it
+// again when it isn't. Built-in agents are saved as user-defined agents of the same name, which
+// take their place
+func editAgent(name string) error {
+    agent := agents.GetAgentConfig(name)
+    source, err := agents.AgentFilePath(agent.Name)
+    if err != nil {
+        return err
     }
-    
-    // Start animation in background
-    go func() {
-        frames := []string{"   ", ".  ", ".. ", "..."}
-        frameIndex := 0
-        
-        for {
-            select {
-            case <-anim.stopChan:
-                return
-            default:
-                // Clear line and print current frame with correct agent label
-                label := fmt.Sprintf("%s %s: ", agent.Emoji, agent.Name)
-                fmt.Printf("\r%s%s", colorize(label, agent.LabelColor), frames[frameIndex])
-                
-                // Move to next frame
-                frameIndex = (frameIndex + 1) % len(frames)
-                
-                time.Sleep(time.Millisecond * frameDelay)
-            }
+    target := source
+    if agent.Source == "built-in" {
+        if target, err = agents.UserAgentPath(agent.Name); err != nil {
+            return err
         }
-    }()
-    
-    return anim
-}
-
-// Stop the conversation animation
-func (a *ConversationAnimation) stopAnimation() {
-    a.stopChan <- true
-    // Clear the animation and prepare for response with correct agent label
-    label := fmt.Sprintf("%s %s: ", a.agent.Emoji, a.agent.Name)
-    fmt.Printf("\r%s", colorize(label, a.agent.LabelColor))
-}
-
-// Add this new function at the top level
-func checkOllamaReady() error {
-    client := &http.Client{Timeout: 5 * time.Second}
-    resp, err := client.Get(ollamaBaseURL + ollamaURLPath)
+    }
+    original, err := os.ReadFile(source)
     if err != nil {
-        if os.IsTimeout(err) || strings.Contains(err.Error(), "connection refused") {
-            return fmt.Errorf("ollama is not ready. please ensure 'ollama serve' is running and the service is fully initialized")
-        }
-        return fmt.Errorf("error checking ollama: %v", err)
+        return fmt.Errorf("failed to read agent file: %v", err)
     }
-    defer resp.Body.Close()
-    return nil
-}
 
-// Add global signal channel
-var (
-    debugMode bool
-    globalStopChan = make(chan os.Signal, 1)
-)
-
-// Update the makeAPIRequestWithRetry function
-func makeAPIRequestWithRetry(jsonData []byte, agent string) (*http.Response, error) {
-    // First, check if Ollama is ready
-    if err := checkOllamaReady(); err != nil {
-        return nil, err
+    // Edits go to a copy, so the agent is never left invalid
+    temp, err := os.CreateTemp("", "chatty-agent-*.yaml")
+    if err != nil {
+        return fmt.Errorf("failed to create a file to edit: %v", err)
+    }
+    defer os.Remove(temp.Name())
+    _, err = temp.Write(original)
+    temp.Close()
+    if err != nil {
+        return fmt.Errorf("failed to create a file to edit: %v", err)
     }
 
-    var lastErr error
-    retryDelay := initialRetryDelay
-
-    for attempt := 1; attempt <= maxRetries; attempt++ {
-        // Show retry attempt if not first try
-        if attempt > 1 {
-            fmt.Printf("\nRetrying request for %s (attempt %d/%d)...\n", agent, attempt, maxRetries)
+    palette := theme.Current()
+    validator := share.NewValidator(debugMode)
+    editor := editorCommand()
+    var edited []byte
+    for {
+        cmd := exec.Command(editor[0], append(editor[1:], temp.Name())...)
+        // The editor draws on the terminal itself, rather than through the pipe of --log
+        cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, terminal(), os.Stderr
+        if err := cmd.Run(); err != nil {
+            return fmt.Errorf("failed to run %s: %v (set $EDITOR to the editor to use)", editor[0], err)
         }
-
-        resp, err := makeAPIRequest(jsonData)
-        if err == nil {
-            return resp, nil
+        if edited, err = os.ReadFile(temp.Name()); err != nil {
+            return fmt.Errorf("failed to read the edited file: %v", err)
+        }
+        if bytes.Equal(edited, original) {
+            fmt.Printf("No changes made to %s\n", agent.Name)
+            return nil
         }
 
-        lastErr = err
-
-        // Don't wait after the last attempt
-        if attempt < maxRetries {
-            // Calculate next delay with exponential backoff
-            if attempt > 1 {
-                retryDelay = time.Duration(float64(retryDelay) * 1.5)
-                if retryDelay > maxRetryDelay {
-                    retryDelay = maxRetryDelay
-                }
-            }
-
-            fmt.Printf("Request failed: %v\nWaiting %.0f seconds before retry...\n", 
-                err, retryDelay.Seconds())
-
-            // Wait for either the delay to complete or an interrupt
-            select {
-            case <-time.After(retryDelay):
-                continue
-            case <-globalStopChan:
-                return nil, fmt.Errorf("interrupted")
-            }
+        problems, warnings := checkEditedAgent(edited, original, agent.Name, validator)
+        for _, warning := range warnings {
+            fmt.Printf("%s⚠️ Warning:%s %s\n", palette.Accent, colorReset, warning)
+        }
+        if len(problems) == 0 {
+            break
+        }
+        fmt.Printf("\n%s🚫 %s can't be saved:%s\n", palette.Error, agent.Name, colorReset)
+        for _, problem := range problems {
+            fmt.Printf("  - %s\n", problem)
+        }
+        fmt.Printf("\n%sEdit it again? [Y/n]: %s", palette.Accent, colorReset)
+        answer, err := stdin.ReadString('\n')
+        if answer = strings.ToLower(strings.TrimSpace(answer)); err != nil || answer == "n" || answer == "no" {
+            return fmt.Errorf("%s was left as it was, as the changes aren't valid", agent.Name)
         }
     }
 
-    return nil, fmt.Errorf("after %d attempts: %v", maxRetries, lastErr)
-}
+    if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+        return fmt.Errorf("failed to create user agents directory: %v", err)
+    }
+    if err := atomicfile.WriteFile(target, edited, 0644); err != nil {
+        return fmt.Errorf("failed to save %s: %v", agent.Name, err)
+    }
+    if err := agents.LoadAgents(); err != nil {
+        return fmt.Errorf("failed to reload agents: %v", err)
+    }
 
-// Update the makeAPIRequest function
-func makeAPIRequest(jsonData []byte) (*http.Response, error) {
-    // Print request JSON in debug mode
-    if debugMode {
-        // Pretty print the JSON with indentation
-        var prettyJSON bytes.Buffer
-        if err := json.Indent(&prettyJSON, jsonData, "", "    "); err != nil {
-            fmt.Printf("Error formatting JSON: %v\n", err)
-            return nil, err
-        }
-        
-        // Print with colors and formatting
-        fmt.Printf("\n%sDebug: Request JSON:%s\n", 
-            "\033[38;5;208m", // Orange color for debug
-            colorReset)
-        fmt.Printf("%s%s%s\n\n",
-            "\033[38;5;39m", // Light blue for JSON
-            prettyJSON.String(),
-            colorReset)
+    saved, _ := agents.ParseAgentYAML(edited)
+    fmt.Printf("\n%s✅ Success:%s %s%s%s saved to %s\n", palette.Success, colorReset, palette.Heading, saved.Name, colorReset, target)
+    if source != target {
+        fmt.Printf("Your copy takes the place of the built-in %s\n", agent.Name)
     }
+    return nil
+}
 
-    // Create the request
-    req, err := http.NewRequest("POST", getOllamaAPI(), bytes.NewBuffer(jsonData))
+// checkEditedAgent returns what keeps an edited agent file from being saved, and warnings about
+// it. The agent may keep its name or take one no other agent has. Problems the file had before
+// it was edited, like built-in agents having no tags, are only warnings
+func checkEditedAgent(data, original []byte, name string, validator *share.Validator) ([]string, []string) {
+    agent, err := agents.ParseAgentYAML(data)
     if err != nil {
-        return nil, fmt.Errorf("error creating request: %v", err)
+        return []string{err.Error()}, nil
     }
-    req.Header.Set("Content-Type", "application/json")
-
-    // Create a custom transport with optimized settings for streaming
-    transport := &http.Transport{
-        MaxIdleConns:        maxIdleConns,
-        MaxConnsPerHost:     maxConnsPerHost,
-        DisableCompression:  false,
-        DisableKeepAlives:   false,
-        ForceAttemptHTTP2:   true,
-        MaxIdleConnsPerHost: maxConnsPerHost,
-        WriteBufferSize:     64 * 1024,
-        ReadBufferSize:      64 * 1024,
+    var problems []string
+    if !strings.EqualFold(agent.Name, name) && agents.IsValidAgent(agent.Name) {
+        problems = append(problems, fmt.Sprintf("another agent is already named '%s'", agents.GetAgentConfig(agent.Name).Name))
     }
 
-    // Create client with no timeout
-    client := &http.Client{
-        Transport: transport,
+    existing := make(map[string]bool)
+    if before, err := agents.ParseAgentYAML(original); err == nil {
+        for _, problem := range validator.ValidateLocal(before).Errors {
+            existing[problem] = true
+        }
     }
+    result := validator.ValidateLocal(agent)
+    warnings := result.Warnings
+    for _, problem := range result.Errors {
+        if existing[problem] {
+            warnings = append(warnings, problem)
+        } else {
+            problems = append(problems, problem)
+        }
+    }
+    return problems, warnings
+}
 
-    // Make the request
-    resp, err := client.Do(req)
+// renameAgent renames a user-defined agent along with its chat histories and memory summary,
+// holding its history's lock so no chat with it saves meanwhile. The files are moved first and
+// moved back when the agent can't be renamed
+func renameAgent(name, newName string) (string, error) {
+    name = agents.GetAgentConfig(name).Name
+    newName = strings.TrimSpace(newName)
+    if err := agents.CheckRename(name, newName); err != nil {
+        return "", err
+    }
+    lock, err := lockHistoryFile(name)
     if err != nil {
-        if strings.Contains(err.Error(), "connection refused") {
-            return nil, fmt.Errorf("could not connect to Ollama - make sure 'ollama serve' is running")
-        }
-        return nil, fmt.Errorf("error connecting to Ollama: %v", err)
+        return "", err
     }
+    defer lock.Release()
 
-    // Check for error responses
-    if resp.StatusCode != http.StatusOK {
-        defer resp.Body.Close()
-        
-        // Try to read error details
-        var errorResponse struct {
-            Error string `json:"error"`
+    moves, err := agentFileMoves(name, newName)
+    if err != nil {
+        return "", err
+    }
+    var moved [][2]string
+    undo := func() {
+        for i := len(moved) - 1; i >= 0; i-- {
+            os.Rename(moved[i][1], moved[i][0])
         }
-        body, _ := io.ReadAll(resp.Body)
-        if err := json.Unmarshal(body, &errorResponse); err == nil && errorResponse.Error != "" {
-            if strings.Contains(errorResponse.Error, "model") {
-                return nil, fmt.Errorf("invalid model '%s' - please check your config.json file", agents.GetCurrentModel())
-            }
-            return nil, fmt.Errorf("API error: %s", errorResponse.Error)
+    }
+    for _, move := range moves {
+        if err := os.Rename(move[0], move[1]); err != nil {
+            undo()
+            return "", fmt.Errorf("failed to rename %s: %v", move[0], err)
         }
-        
-        return nil, fmt.Errorf("API error (status %d): failed to process request", resp.StatusCode)
+        moved = append(moved, move)
     }
 
-    return resp, nil
+    path, err := agents.RenameAgent(name, newName)
+    if err != nil {
+        undo()
+        return "", err
+    }
+    if err := usage.Rename(name, newName); err != nil {
+        fmt.Printf("⚠️ Warning: %v\n", err)
+    }
+    return path, nil
 }
 
-// Add this new function to format user messages consistently
-func formatUserMessage(message string) string {
-    return fmt.Sprintf("👤 User: %s", message)
-}
+// agentFileMoves lists the files named after an agent, its histories in chats and server sessions
+// and its memory summary, with the names they take when it is renamed
+func agentFileMoves(name, newName string) ([][2]string, error) {
+    dataDir, err := appdir.DataDir()
+    if err != nil {
+        return nil, err
+    }
+    fileName := func(name string) string {
+        return strings.ReplaceAll(strings.ToLower(name), " ", "_")
+    }
 
-// Add this new type to track conversation time
-type ConversationState struct {
-    startTime time.Time
-    lastActive time.Time
-}
+    dirs := []string{dataDir}
+    sessions, _ := filepath.Glob(filepath.Join(dataDir, sessionsDir, "*"))
+    dirs = append(dirs, sessions...)
 
-// Update the formatElapsedTime function to be more precise
-func formatElapsedTime(start, current time.Time) string {
-    duration := current.Sub(start)
-    
-    parts := []string{}
-    
-    // Calculate each time unit
-    years := int(duration.Hours() / (24 * 365))
-    months := int(duration.Hours() / (24 * 30)) % 12
-    weeks := int(duration.Hours() / (24 * 7)) % 4
-    days := int(duration.Hours() / 24) % 7
-    hours := int(duration.Hours()) % 24
-    minutes := int(duration.Minutes()) % 60
-    
-    // Add non-zero units to parts
-    if years > 0 {
-        if years == 1 {
-            parts = append(parts, "1 year")
-        } else {
-            parts = append(parts, fmt.Sprintf("%d years", years))
+    var moves [][2]string
+    for _, dir := range dirs {
+        for _, pattern := range []string{"chat_history_%s.jsonl", "chat_history_%s.json", "chat_summary_%s.json"} {
+            from := filepath.Join(dir, fmt.Sprintf(pattern, fileName(name)))
+            to := filepath.Join(dir, fmt.Sprintf(pattern, fileName(newName)))
+            if from == to {
+                continue
+            }
+            if _, err := os.Stat(from); err != nil {
+                continue
+            }
+            if _, err := os.Stat(to); err == nil {
+                return nil, fmt.Errorf("%s already exists, move it away to rename %s", to, name)
+            }
+            moves = append(moves, [2]string{from, to})
         }
     }
-    if months > 0 {
-        if months == 1 {
-            parts = append(parts, "1 month")
-        } else {
-            parts = append(parts, fmt.Sprintf("%d months", months))
-        }
+    return moves, nil
+}
+
+// printAgentStats lists how much every agent has been used, most recently used first, so the
+// ones never used can be told apart
+func printAgentStats() error {
+    all, err := usage.Load()
+    if err != nil {
+        return err
     }
-    if weeks > 0 {
-        if weeks == 1 {
-            parts = append(parts, "1 week")
-        } else {
-            parts = append(parts, fmt.Sprintf("%d weeks", weeks))
-        }
+    var names []string
+    for _, name := range agents.GetAllAgentNames() {
+        names = append(names, agents.GetAgentConfig(name).Name)
     }
-    if days > 0 {
-        if days == 1 {
-            parts = append(parts, "1 day")
-        } else {
-            parts = append(parts, fmt.Sprintf("%d days", days))
+    sort.SliceStable(names, func(i, j int) bool {
+        a, b := all[strings.ToLower(names[i])], all[strings.ToLower(names[j])]
+        if a.LastUsed.Equal(b.LastUsed) {
+            return strings.ToLower(names[i]) < strings.ToLower(names[j])
         }
+        return a.LastUsed.After(b.LastUsed)
+    })
+
+    width := len("Agent")
+    for _, name := range names {
+        width = max(width, utf8.RuneCountInString(name))
     }
-    if hours > 0 {
-        if hours == 1 {
-            parts = append(parts, "1 hour")
-        } else {
-            parts = append(parts, fmt.Sprintf("%d hours", hours))
+    palette := theme.Current()
+    fmt.Printf("\n%s📊 Agent Usage%s\n\n", palette.Heading, colorReset)
+    fmt.Printf("  %s%-*s %10s %12s  %s%s\n", palette.Label, width, "Agent", "Messages", "Tokens", "Last used", colorReset)
+    for _, name := range names {
+        stats := all[strings.ToLower(name)]
+        line := fmt.Sprintf("  %-*s %10d %12d  %s", width, name, stats.Messages, stats.Tokens, lastUsedText(stats.LastUsed))
+        if agents.IsDisabled(name) {
+            line += " (disabled)"
         }
-    }
-    if minutes > 0 || len(parts) == 0 {
-        if minutes == 1 {
-            parts = append(parts, "1 minute")
-        } else {
-            parts = append(parts, fmt.Sprintf("%d minutes", minutes))
+        if stats.Messages == 0 {
+            line = palette.Muted + line + colorReset
         }
+        fmt.Println(line)
     }
-    
-    return strings.Join(parts, ", ")
+    fmt.Printf("\n%sAgents you never use can be hidden with chatty --disable or removed with chatty --uninstall%s\n", palette.Muted, colorReset)
+    return nil
 }
 
-// Update the handleMultiAgentConversation function to format participants list without newlines
-func handleMultiAgentConversation(config ConversationConfig) error {
-    // Validate configuration
-    if len(config.Agents) < 2 {
-        return fmt.Errorf("at least two agents are required for a conversation")
+// lastUsedText tells how long ago an agent was last used
+func lastUsedText(lastUsed time.Time) string {
+    if lastUsed.IsZero() {
+        return "never"
     }
+    if time.Since(lastUsed) < time.Minute {
+        return "just now"
+    }
+    return formatElapsedTime(lastUsed, time.Now()) + " ago"
+}
 
-    // Check maximum number of agents
-    const maxAgents = 15
-    if len(config.Agents) > maxAgents {
-        return fmt.Errorf("too many agents: maximum allowed is %d, but got %d", maxAgents, len(config.Agents))
+// Largest agent file --install downloads
+const maxAgentFileSize = 1 << 20
+
+// isAgentSource reports whether --install was given a URL or a YAML file rather than the name
+// of an agent in the store
+func isAgentSource(arg string) bool {
+    if strings.HasPrefix(arg, "http://") || strings.HasPrefix(arg, "https://") {
+        return true
+    }
+    if !strings.HasSuffix(arg, ".yaml") && !strings.HasSuffix(arg, ".yml") {
+        return false
     }
+    info, err := os.Stat(arg)
+    return err == nil && !info.IsDir()
+}
 
-    // Check for duplicate agents
-    seen := make(map[string]bool)
-    for _, name := range config.Agents {
-        // Convert to proper case using GetAgentConfig to ensure consistent comparison
-        properName := agents.GetAgentConfig(name).Name
-        if seen[properName] {
-            return fmt.Errorf("duplicate agent detected: %s (each agent can only be included once)", properName)
+// readAgentSource reads an agent file from a URL or a path
+func readAgentSource(source string) ([]byte, error) {
+    if !strings.HasPrefix(source, "http://") && !strings.HasPrefix(source, "https://") {
+        data, err := os.ReadFile(source)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read %s: %v", source, err)
         }
-        seen[properName] = true
+        return data, nil
     }
 
-    // Validate all agents exist
-    for _, name := range config.Agents {
-        if !agents.IsValidAgent(name) {
-            return fmt.Errorf("invalid agent name: %s", name)
-        }
+    client := &http.Client{Timeout: 30 * time.Second}
+    resp, err := client.Get(source)
+    if err != nil {
+        return nil, fmt.Errorf("failed to download %s: %v", source, err)
     }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return nil, fmt.Errorf("failed to download %s: %s", source, resp.Status)
+    }
+    data, err := io.ReadAll(io.LimitReader(resp.Body, maxAgentFileSize+1))
+    if err != nil {
+        return nil, fmt.Errorf("failed to download %s: %v", source, err)
+    }
+    if len(data) > maxAgentFileSize {
+        return nil, fmt.Errorf("%s is too large for an agent file", source)
+    }
+    return data, nil
+}
 
-    // Load agent configurations
-    agentConfigs := make([]agents.AgentConfig, 0, len(config.Agents))
-    for _, agentName := range config.Agents {
-        agentConfigs = append(agentConfigs, agents.GetAgentConfig(agentName))
+// installAgentSource installs an agent from a URL or a local YAML file, bypassing the store. The
+// file is checked like one edited with --edit and copied as it is into ~/.chatty/agents
+func installAgentSource(source string) error {
+    data, err := readAgentSource(source)
+    if err != nil {
+        return err
+    }
+    agent, err := agents.ParseAgentYAML(data)
+    if err != nil {
+        return fmt.Errorf("%s is not a valid agent file: %v", source, err)
     }
 
-    // Set up colors and emojis for the UI
-    turnSeparatorColor := "\033[1;36m" // Black
-    turnColor := "\033[1;36m"          // Yellow
-    turnNumberColor := "\033[1;37m"    // Cyan
-    timeHeaderColor := "\033[1;32m"    // Green
-    timeValueColor := "\033[1;37m"     // White
-    elapsedTimeColor := "\033[1;35m"   // Magenta
-    inputPromptColor := "\033[1;36m"   // Cyan
-    inputHintColor := "\033[1;30m"     // Gray
-    colorReset := "\033[0m"
-    turnEmoji := "🔄"
-    converseMargin := 1
+    palette := theme.Current()
+    result := share.NewValidator(debugMode).ValidateLocal(agent)
+    for _, warning := range result.Warnings {
+        fmt.Printf("%s⚠️ Warning:%s %s\n", palette.Accent, colorReset, warning)
+    }
+    if !result.IsValid {
+        return fmt.Errorf("%s is not a valid agent file:\n  - %s", source, strings.Join(result.Errors, "\n  - "))
+    }
+    if agents.IsValidAgent(agent.Name) {
+        return fmt.Errorf("an agent named '%s' is already installed (rename it in the file, or remove the installed one with chatty --uninstall)", agents.GetAgentConfig(agent.Name).Name)
+    }
 
-    currentMessage := config.Starter
-    currentTurn := 1
-    firstMessage := true
+    target, err := agents.UserAgentPath(agent.Name)
+    if err != nil {
+        return err
+    }
+    if _, err := os.Stat(target); err == nil {
+        return fmt.Errorf("an agent file already exists at %s", target)
+    }
+    if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+        return fmt.Errorf("failed to create user agents directory: %v", err)
+    }
+    if err := atomicfile.WriteFile(target, data, 0644); err != nil {
+        return fmt.Errorf("failed to install %s: %v", agent.Name, err)
+    }
+    if err := agents.LoadAgents(); err != nil {
+        return fmt.Errorf("failed to reload agents: %v", err)
+    }
 
-    // Initialize conversation histories
-    var conversationLog strings.Builder
-    conversationLog.WriteString(fmt.Sprintf("👤 User: %s\n", config.Starter))
+    fmt.Printf("\n%s✅ Successfully installed %s %s%s\n",
+        palette.Success, theme.AgentEmoji(agent.Emoji, agent.Name), agent.Name, colorReset)
+    fmt.Printf("\n%s💡 Quick Actions:%s\n", palette.Section, colorReset)
+    fmt.Printf("  %s1.%s %sSet as current agent:%s chatty --select %s\"%s\"%s\n",
+        palette.Success, colorReset, palette.Label, colorReset, palette.Value, agent.Name, colorReset)
+    fmt.Printf("  %s2.%s %sStart chatting:%s chatty --with %s\"%s\"%s\n\n",
+        palette.Success, colorReset, palette.Label, colorReset, palette.Value, agent.Name, colorReset)
+    return nil
+}
 
-    // Initialize conversation histories for each agent
-    histories := make([][]Message, len(agentConfigs))
-    for i, agent := range agentConfigs {
-        // Initialize with system message and conversation context
-        histories[i] = []Message{{
+// Initialize a new chat with a system message
+func initializeChat() []Message {
+    return []Message{
+        {
             Role:    "system",
-            Content: agent.GetFullSystemMessage(config.AutoMode, ""),
-        }}
+            Content: getSystemMessage(),
+        },
     }
+}
 
-    // Add the initial user message to all agent histories
-    for i := range histories {
-        histories[i] = append(histories[i], Message{
-            Role:    "user",
-            Content: config.Starter,
-        })
+// Update printMargin function name to be more specific
+func printChatMargin(count int) {
+    for i := 0; i < count; i++ {
+        fmt.Println()
     }
+}
 
-    // Create a reader for user input (only used in non-auto mode)
-    var reader *bufio.Reader
-    if !config.AutoMode {
-        reader = bufio.NewReader(os.Stdin)
-    }
+// Get the full Ollama API URL
+func getOllamaAPI() string {
+    return ollamaBaseURL + ollamaURLPath
+}
 
-    // Initialize conversation state
-    state := ConversationState{
-        startTime: time.Now(),
-        lastActive: time.Now(),
+// newEmbedder creates the embedder used for the knowledge base, served by the same Ollama instance as chats
+func newEmbedder(config *agents.Config) kb.Embedder {
+    model := ""
+    if config != nil {
+        model = config.EmbeddingModel
     }
+    return kb.NewOllamaEmbedder(ollamaBaseURL, model)
+}
 
-    // Maximum number of messages to keep in history per agent
-    const maxMessagesPerAgent = 20
-
-    if config.AutoMode {
-        fmt.Println("\n🤖 Auto-conversation mode enabled. Press Ctrl+C to stop.")
+// Update the animation functions for conversation mode
+func startConversationAnimation(agent agents.AgentConfig) *ConversationAnimation {
+    anim := &ConversationAnimation{
+        stopChan: make(chan bool),
+        done:     make(chan bool),
+        agent: agent,
     }
+    
+    // Start animation in background, with the correct agent label
+    go func() {
+        animate(anim.stopChan, func() string {
+            return colorize(formatAgentLabel(agent), agent.LabelColor)
+        })
+        close(anim.done)
+    }()
+    
+    return anim
+}
 
-    // Create a shared conversation history that will be used to build each agent's history
-    sharedHistory := []Message{
-        {
-            Role:    "user",
-            Content: config.Starter,
-        },
+// Stop the conversation animation
+func (a *ConversationAnimation) stopAnimation() {
+    a.stopChan <- true
+    <-a.done
+    // Clear the animation and prepare for response with correct agent label
+    if len(animationFrames()) > 0 {
+        label := formatAgentLabel(a.agent)
+        fmt.Printf("\r%s", colorize(label, a.agent.LabelColor))
     }
+}
 
+// Add this new function at the top level
+func checkOllamaReady() error {
+    err := callOllama(http.MethodGet, ollamaBaseURL+ollamaURLPath, nil, readyTimeout, nil)
+    var urlErr *url.Error
+    if !errors.As(err, &urlErr) {
+        return nil // Any response means it's running
+    }
+    if urlErr.Timeout() || strings.Contains(err.Error(), "connection refused") {
+        return failure.New(failure.OllamaUnreachable, "ollama is not ready. please ensure 'ollama serve' is running and the service is fully initialized")
+    }
+    return failure.New(failure.OllamaUnreachable, "error checking ollama: %v", err)
+}
+
+// Add global signal handling
+var (
+    debugMode bool
+    jsonErrors bool // Report the error chatty stops on as JSON, for scripts
+    signals = make(chan os.Signal, 1)
+
+    // interruptCtx is cancelled by Ctrl+C, aborting the requests to Ollama in flight
+    interruptCtx, interruptRequests = context.WithCancel(context.Background())
+    // activeRequests counts the requests whose responses are being read, which Ctrl+C lets wind down
+    activeRequests atomic.Int32
+
+    // Output mirroring for --log
+    outputTee *render.Tee
+    outputLog *render.LogWriter
+    closeOutputLog sync.Once
+
+    // Text-to-speech for --speak
+    speakMode bool
+    speaker *speech.Speaker
+
+    // Language of the inline translation shown beneath responses (empty disables it)
+    translateTo string
+
+    // Instructions added to every agent's system message with --system, for this run
+    extraInstructions string
+
+    // Knowledge base searched for context on every message (nil disables retrieval)
+    knowledgeBase *kb.Index
+    embedder kb.Embedder
+
+    // Knowledge bases built from the agents' knowledge directories, by agent name
+    agentIndexes = make(map[string]*kb.Index)
+
+    // Guards retrieval for API clients, who may search the knowledge bases at the same time
+    knowledgeMu sync.Mutex
+
+    // Index of the git repository in the working directory, for --project
+    projectIndex *kb.Index
+
+    // Past exchanges recalled with --recall, shared with the agents as reference material
+    recalledExchanges string
+
+    // Whether agents may call tools, and the models Ollama reported can't
+    toolsEnabled bool
+    toolsUnsupported = make(map[string]bool)
+    toolsUnsupportedMu sync.Mutex
+
+    // Estimates of prompt sizes, corrected with the counts each model reports, and the
+    // context windows of the models used so far
+    tokenCounter tokens.Counter
+    contextWindows = make(map[string]int)
+    contextWindowsMu sync.Mutex
+
+    // Tool permissions from config.json, for all agents and per agent
+    toolPermissions tools.Policy
+    agentToolPermissions map[string]map[string]string
+
+    // Set during --auto conversations, where tools that need approval are declined
+    unattended bool
+
+    // Set by --no-history, for one-shot messages that leave no history, memory or usage behind
+    stateless bool
+
+    // Tool blocks shown while the latest response was prepared, kept for conversation logs
+    toolActivity strings.Builder
+
+    // Facts remembered about the user (nil when memory is disabled)
+    userMemory *memory.Store
+
+    // Rolling summaries of the agents' earlier sessions, by agent name
+    memoryEnabled bool
+    agentSummaries = make(map[string]memory.Summary)
+
+    // Embedding of the last retrieval query
+    lastKnowledgeQuery string
+    lastKnowledgeVector []float32
+)
+
+// Number of knowledge base excerpts added to a request
+const knowledgeResults = 4
+
+// Messages of earlier sessions replayed in a direct chat when the agent has a memory summary
+const recentMessagesWithSummary = 10
+
+// agentKnowledge returns the knowledge base built from an agent's knowledge directory,
+// indexing new and changed documents the first time it is used in a run
+func agentKnowledge(agent agents.AgentConfig) *kb.Index {
+    if agent.Knowledge == "" {
+        return nil
+    }
+    if index, ok := agentIndexes[agent.Name]; ok {
+        return index
+    }
+    agentIndexes[agent.Name] = nil // Only try once per run
+
+    dir := agent.Knowledge
+    if strings.HasPrefix(dir, "~/") {
+        if home, err := os.UserHomeDir(); err == nil {
+            dir = filepath.Join(home, dir[2:])
+        }
+    }
+
+    index, err := kb.Open(agentKnowledgeName(agent.Name))
+    if err != nil {
+        fmt.Printf("⚠️ Warning: %v\n", err)
+        return nil
+    }
+
+    // Bring the index up to date, only showing progress when documents changed
+    announced := false
+    result, err := index.Ingest(dir, embedder, func(p kb.IngestProgress) {
+        if p.Status == kb.StatusUnchanged {
+            return
+        }
+        if !announced {
+            fmt.Printf("\n📚 Updating %s's knowledge from %s\n", agent.Name, agent.Knowledge)
+            announced = true
+        }
+        printIngestProgress(p)
+    })
+    if result.Changed() {
+        if saveErr := index.Save(); saveErr != nil && err == nil {
+            err = saveErr
+        }
+    }
+    if err != nil {
+        fmt.Printf("⚠️ Warning: Failed to index %s's knowledge: %v\n", agent.Name, err)
+    }
+    if announced {
+        fmt.Println()
+    }
+    agentIndexes[agent.Name] = index
+    return index
+}
+
+// openProject indexes the git repository containing the working directory, embedding
+// only the files that changed since the last run
+func openProject() (*kb.Index, error) {
+    cwd, err := os.Getwd()
+    if err != nil {
+        return nil, fmt.Errorf("failed to get working directory: %v", err)
+    }
+    root, files, err := kb.ProjectFiles(cwd)
+    if err != nil {
+        return nil, err
+    }
+    if len(files) == 0 {
+        return nil, fmt.Errorf("no text files found in %s", root)
+    }
+
+    index, err := kb.Open(kb.ProjectName(root))
+    if err != nil {
+        return nil, err
+    }
+
+    // Only show progress when files changed
+    announced := false
+    result, err := index.IngestFiles(root, files, embedder, func(p kb.IngestProgress) {
+        if p.Status == kb.StatusUnchanged {
+            return
+        }
+        if !announced {
+            fmt.Printf("📂 Indexing project %s\n", root)
+            announced = true
+        }
+        printIngestProgress(p)
+    })
+    if result.Changed() {
+        if saveErr := index.Save(); saveErr != nil && err == nil {
+            err = saveErr
+        }
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to index %s: %v", root, err)
+    }
+    if announced {
+        fmt.Println()
+    }
+    return index, nil
+}
+
+// agentKnowledgeName returns the name of the knowledge base holding an agent's documents
+func agentKnowledgeName(agentName string) string {
+    name := strings.Map(func(r rune) rune {
+        if r >= 'a' && r <= 'z' || r >= '0' && r <= '9' {
+            return r
+        }
+        return '-'
+    }, strings.ToLower(agentName))
+    return "agent-" + name
+}
+
+// retrieveKnowledge searches the global knowledge base, the project and an agent's own knowledge for excerpts relevant to query
+func retrieveKnowledge(agent agents.AgentConfig, query string) []kb.Result {
+    knowledgeMu.Lock()
+    defer knowledgeMu.Unlock()
+
+    var indexes []*kb.Index
+    for _, index := range []*kb.Index{knowledgeBase, projectIndex, agentKnowledge(agent)} {
+        if index != nil {
+            indexes = append(indexes, index)
+        }
+    }
+    if len(indexes) == 0 || strings.TrimSpace(query) == "" {
+        return nil
+    }
+
+    // Agents in the same turn search for the same message, so reuse its embedding
+    if query != lastKnowledgeQuery {
+        vector, err := embedder.Embed(query)
+        if err != nil {
+            fmt.Printf("\n⚠️ Warning: Failed to search knowledge base: %v\n", err)
+            return nil
+        }
+        lastKnowledgeQuery, lastKnowledgeVector = query, vector
+    }
+
+    var results []kb.Result
+    for _, index := range indexes {
+        found, err := index.Search(lastKnowledgeVector, embedder, knowledgeResults)
+        if err != nil {
+            fmt.Printf("\n⚠️ Warning: Failed to search knowledge base: %v\n", err)
+            continue
+        }
+        results = append(results, found...)
+    }
+    kb.SortResults(results)
+    if len(results) > knowledgeResults {
+        results = results[:knowledgeResults]
+    }
+    return results
+}
+
+// formatKnowledge renders retrieved excerpts as a numbered message the model can cite
+func formatKnowledge(results []kb.Result) string {
+    if len(results) == 0 {
+        return ""
+    }
+    var sb strings.Builder
+    sb.WriteString("Excerpts from the user's documents that may help with the next response. Use them when relevant and ignore them otherwise. When you use an excerpt, cite its number in brackets, like [1].\n")
+    for i, result := range results {
+        sb.WriteString(fmt.Sprintf("\n[%d] %s (lines %d-%d)\n%s\n", i+1, result.Source, result.StartLine, result.EndLine, result.Text))
+    }
+    return sb.String()
+}
+
+// citationPattern matches excerpt references like [2] in a response
+var citationPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// printCitations lists the documents behind a response: the excerpts it cites,
+// or every excerpt it was given when it cites none
+func printCitations(response string, results []kb.Result) {
+    if len(results) == 0 {
+        return
+    }
+
+    cited := make(map[int]bool)
+    for _, match := range citationPattern.FindAllStringSubmatch(response, -1) {
+        if n, err := strconv.Atoi(match[1]); err == nil && n >= 1 && n <= len(results) {
+            cited[n] = true
+        }
+    }
+
+    title := "Sources cited"
+    if len(cited) == 0 {
+        title = "Sources provided"
+    }
+
+    var sb strings.Builder
+    sb.WriteString("\n\n📎 " + title + ":")
+    for i, result := range results {
+        if len(cited) > 0 && !cited[i+1] {
+            continue
+        }
+        source := result.Source
+        if cwd, err := os.Getwd(); err == nil {
+            if rel, err := filepath.Rel(cwd, source); err == nil && !strings.HasPrefix(rel, "..") {
+                source = rel
+            }
+        }
+        sb.WriteString(fmt.Sprintf("\n  [%d] %s:%d-%d", i+1, source, result.StartLine, result.EndLine))
+    }
+    fmt.Print(colorize(sb.String(), theme.Current().Muted))
+}
+
+
+// withKnowledge returns a copy of a request's messages with retrieved excerpts placed before the last message
+func withKnowledge(messages []Message, knowledge string) []Message {
+    if knowledge == "" || len(messages) == 0 {
+        return messages
+    }
+    last := len(messages) - 1
+    augmented := make([]Message, 0, len(messages)+1)
+    augmented = append(augmented, messages[:last]...)
+    augmented = append(augmented, Message{Role: "user", Content: knowledge})
+    return append(augmented, messages[last])
+}
+
+const (
+    recallIndexName   = "chat-history" // Knowledge base of past conversations searched by --recall
+    recallResults     = 3              // Exchanges shown or recalled into a conversation
+    maxExchangeLength = 2000           // Characters of an exchange that are embedded
+)
+
+// historyAgentName returns the name of the agent a chat history file belongs to
+func historyAgentName(path string) string {
+    name := strings.TrimSuffix(strings.TrimPrefix(filepath.Base(path), "chat_history_"), filepath.Ext(path))
+    name = strings.ReplaceAll(name, "_", " ")
+    if agents.IsValidAgent(name) {
+        return agents.GetAgentConfig(name).Name
+    }
+    return name
+}
+
+// conversationPieces turns a chat history into one piece per exchange: a user message and the reply
+// to it, numbered by their position in the history
+func conversationPieces(agentName string, history []Message) []kb.Piece {
+    var pieces []kb.Piece
+    for i, message := range history {
+        if message.Role != "user" || strings.TrimSpace(message.Content) == "" {
+            continue
+        }
+        text := "User: " + strings.TrimSpace(message.Content)
+        end := i
+        if i+1 < len(history) && history[i+1].Role == "assistant" {
+            text += "\n\n" + agentName + ": " + strings.TrimSpace(history[i+1].Content)
+            end = i + 1
+        }
+        if runes := []rune(text); len(runes) > maxExchangeLength {
+            text = string(runes[:maxExchangeLength])
+        }
+        pieces = append(pieces, kb.Piece{Text: text, StartLine: i, EndLine: end})
+    }
+    return pieces
+}
+
+// indexConversations brings the knowledge base of past conversations up to date with the chat
+// histories, embedding only exchanges that were not indexed before
+func indexConversations() (*kb.Index, error) {
+    dataDir, err := appdir.DataDir()
+    if err != nil {
+        return nil, err
+    }
+    // Convert histories saved by earlier versions first, so they are indexed under their new name
+    legacyPaths, _ := filepath.Glob(filepath.Join(dataDir, "chat_history_*.json"))
+    for _, path := range legacyPaths {
+        readHistory(strings.TrimSuffix(path, ".json") + ".jsonl")
+    }
+    paths, err := filepath.Glob(filepath.Join(dataDir, "chat_history_*.jsonl"))
+    if err != nil {
+        return nil, fmt.Errorf("failed to list chat histories: %v", err)
+    }
+
+    index, err := kb.Open(recallIndexName)
+    if err != nil {
+        return nil, err
+    }
+    if index.Model != "" && index.Model != embedder.Model() {
+        index.Reset()
+    }
+    if index.Files == nil {
+        index.Files = make(map[string]kb.FileState)
+    }
+
+    changed := false
+    found := make(map[string]bool)
+    for _, path := range paths {
+        found[path] = true
+        info, err := os.Stat(path)
+        if err != nil {
+            continue
+        }
+        state, indexed := index.Files[path]
+        if indexed && state.Size == info.Size() && state.ModTime.Equal(info.ModTime()) {
+            continue
+        }
+
+        history, err := readHistory(path)
+        if err != nil {
+            continue
+        }
+
+        agentName := historyAgentName(path)
+        if !changed {
+            fmt.Printf("%s🔎 Indexing past conversations%s\n", theme.Current().Muted, colorReset)
+        }
+        if _, err := index.AddPieces(path, conversationPieces(agentName, history), embedder, nil); err != nil {
+            if changed {
+                index.Save()
+            }
+            return nil, err
+        }
+        index.Files[path] = kb.FileState{Size: info.Size(), ModTime: info.ModTime()}
+        changed = true
+    }
+
+    // Forget cleared histories
+    for source := range index.Files {
+        if !found[source] {
+            index.Remove(source)
+            changed = true
+        }
+    }
+
+    if changed {
+        if err := index.Save(); err != nil {
+            return nil, err
+        }
+    }
+    return index, nil
+}
+
+// recallConversations returns the past exchanges most relevant to query
+func recallConversations(query string) ([]kb.Result, error) {
+    index, err := indexConversations()
+    if err != nil {
+        return nil, err
+    }
+    if len(index.Chunks) == 0 {
+        return nil, nil
+    }
+    vector, err := embedder.Embed(query)
+    if err != nil {
+        return nil, err
+    }
+    return index.Search(vector, embedder, recallResults)
+}
+
+// printRecalled shows the past exchanges found for a --recall query
+func printRecalled(query string, results []kb.Result) {
+    palette := theme.Current()
+    if len(results) == 0 {
+        fmt.Printf("No past conversations match \"%s\"\n", query)
+        return
+    }
+
+    fmt.Printf("🔎 Past conversations matching \"%s\":\n", query)
+    for i, result := range results {
+        fmt.Printf("\n%s[%d] %s%s %s(messages %d-%d, %.0f%% match)%s\n",
+            palette.Success, i+1, historyAgentName(result.Source), colorReset,
+            palette.Muted, result.StartLine, result.EndLine, result.Score*100, colorReset)
+        text := result.Text
+        if runes := []rune(text); len(runes) > 400 {
+            text = string(runes[:400]) + "..."
+        }
+        for _, line := range strings.Split(text, "\n") {
+            if strings.TrimSpace(line) != "" {
+                fmt.Println("   " + line)
+            }
+        }
+    }
+    fmt.Printf("\n%sBring them into a conversation with: chatty --recall \"%s\" --with <agent_name>%s\n", palette.Muted, query, colorReset)
+}
+
+// formatRecalled renders recalled exchanges as reference material for a new conversation
+func formatRecalled(results []kb.Result) string {
+    if len(results) == 0 {
+        return ""
+    }
+    var sb strings.Builder
+    sb.WriteString("The user recalled these exchanges from earlier conversations. Use them as background for this conversation.\n")
+    for _, result := range results {
+        sb.WriteString("\n--- conversation with " + historyAgentName(result.Source) + " ---\n")
+        sb.WriteString(result.Text)
+        sb.WriteString("\n")
+    }
+    sb.WriteString("\n--- end of recalled exchanges ---")
+    return sb.String()
+}
+
+// ingestDocuments indexes the documents at path into a knowledge base, skipping unchanged files
+func ingestDocuments(path, name string) error {
+    index, err := kb.Open(name)
+    if err != nil {
+        return err
+    }
+
+    fmt.Printf("📚 Ingesting %s into '%s'\n\n", path, name)
+    if index.Model != "" && index.Model != embedder.Model() && len(index.Chunks) > 0 {
+        fmt.Printf("%s'%s' was indexed with %s: re-embedding with %s (ingest its other paths again too)%s\n\n",
+            theme.Current().Muted, name, index.Model, embedder.Model(), colorReset)
+    }
+    result, err := index.Ingest(path, embedder, printIngestProgress)
+
+    // Keep the documents indexed before an error so the next run can resume
+    if result.Changed() {
+        if saveErr := index.Save(); saveErr != nil {
+            return saveErr
+        }
+    }
+    if err != nil {
+        return err
+    }
+    if result.Added+result.Updated+result.Unchanged+result.Duplicates+result.Failed == 0 {
+        return fmt.Errorf("no supported documents found in %s (Markdown, text and PDF files)", path)
+    }
+
+    palette := theme.Current()
+    fmt.Printf("\n%s✓ %d chunks indexed into '%s'%s: %d added, %d updated, %d unchanged, %d duplicates, %d removed",
+        palette.Success, result.Chunks, name, colorReset,
+        result.Added, result.Updated, result.Unchanged, result.Duplicates, result.Removed)
+    if result.Failed > 0 {
+        fmt.Printf(", %s%d failed%s", palette.Error, result.Failed, colorReset)
+    }
+    fmt.Println()
+    return nil
+}
+
+// addRemoteKnowledge creates or updates a knowledge base synced from a zip archive: <url> [name] [--refresh <duration>]
+func addRemoteKnowledge(args []string) error {
+    url := args[0]
+    name := kb.RemoteName(url)
+    refresh := kb.DefaultRefresh
+    for i := 1; i < len(args); i++ {
+        switch {
+        case args[i] == "--refresh":
+            if i+1 >= len(args) {
+                return fmt.Errorf("--refresh argument is missing")
+            }
+            duration, err := time.ParseDuration(args[i+1])
+            if err != nil || duration <= 0 {
+                return fmt.Errorf("invalid refresh interval '%s': use a duration like 12h or 30m", args[i+1])
+            }
+            refresh = duration
+            i++
+        case strings.HasPrefix(args[i], "--"):
+            return fmt.Errorf("unknown option '%s'", args[i])
+        default:
+            name = args[i]
+        }
+    }
+
+    index, err := kb.Open(name)
+    if err != nil {
+        return err
+    }
+    if err := index.SetRemote(url, refresh); err != nil {
+        return err
+    }
+    // Adding a URL again syncs it right away
+    index.Remote.Synced = time.Time{}
+    if err := syncRemoteKnowledge(index); err != nil {
+        return err
+    }
+    fmt.Printf("Search it with: chatty --kb %s \"Your question\" (checked for updates every %s)\n", name, index.Remote.Refresh)
+    return nil
+}
+
+// syncRemoteKnowledge downloads the archive of a remote knowledge base and indexes what changed
+func syncRemoteKnowledge(index *kb.Index) error {
+    fmt.Printf("🌐 Syncing '%s' from %s\n", index.Name, index.Remote.URL)
+    changed, err := index.Download()
+    if err != nil {
+        return err
+    }
+    if !changed && len(index.Chunks) > 0 {
+        fmt.Printf("%sAlready up to date%s\n\n", theme.Current().Muted, colorReset)
+        return index.Save()
+    }
+
+    fmt.Println()
+    result, err := index.Ingest(index.RemoteDir(), embedder, printIngestProgress)
+
+    // Always save so the sync time and what was indexed before an error are kept
+    if saveErr := index.Save(); saveErr != nil {
+        return saveErr
+    }
+    if err != nil {
+        return err
+    }
+    if result.Added+result.Updated+result.Unchanged+result.Duplicates+result.Failed == 0 {
+        return fmt.Errorf("no supported documents found in %s (Markdown, text and PDF files)", index.Remote.URL)
+    }
+
+    palette := theme.Current()
+    fmt.Printf("\n%s✓ '%s' synced%s: %d added, %d updated, %d unchanged, %d removed\n\n",
+        palette.Success, index.Name, colorReset, result.Added, result.Updated, result.Unchanged, result.Removed)
+    return nil
+}
+
+// printIngestProgress shows the status of each document while ingesting
+func printIngestProgress(p kb.IngestProgress) {
+    palette := theme.Current()
+
+    // Paths below the working directory are shown relative to it
+    relative := func(path string) string {
+        if cwd, err := os.Getwd(); err == nil {
+            if rel, err := filepath.Rel(cwd, path); err == nil && !strings.HasPrefix(rel, "..") {
+                return rel
+            }
+        }
+        return path
+    }
+    path := relative(p.Path)
+    counter := fmt.Sprintf("[%d/%d]", p.Number, p.Total)
+
+    switch p.Status {
+    case kb.StatusEmbedding:
+        fmt.Printf("\r\033[K%s %s %sembedding %d/%d%s", counter, path, palette.Muted, p.Chunks, p.Of, colorReset)
+    case kb.StatusAdded, kb.StatusUpdated:
+        fmt.Printf("\r\033[K%s %s✓%s %s %s(%s, %d chunks)%s\n", counter, palette.Success, colorReset, path, palette.Muted, p.Status, p.Chunks, colorReset)
+    case kb.StatusUnchanged:
+        fmt.Printf("%s %s· %s (unchanged)%s\n", counter, palette.Muted, path, colorReset)
+    case kb.StatusDuplicate:
+        fmt.Printf("%s %s= %s (duplicate of %s)%s\n", counter, palette.Muted, path, relative(p.Detail), colorReset)
+    case kb.StatusRemoved:
+        fmt.Printf("%s- %s (removed)%s\n", palette.Muted, path, colorReset)
+    case kb.StatusFailed:
+        fmt.Printf("\r\033[K%s %s✗ %s: %s%s\n", counter, palette.Error, path, p.Detail, colorReset)
+    }
+}
+
+// generateText sends a single instruction and input to the model and returns the complete reply
+func generateText(instructions, input string) (string, error) {
+    chatReq := ChatRequest{
+        Model: agents.GetCurrentModel(),
+        Messages: []Message{
+            {
+                Role:    "system",
+                Content: instructions,
+            },
+            {
+                Role:    "user",
+                Content: input,
+            },
+        },
+        Stream:    false,
+        KeepAlive: keepAlive,
+    }
+
+    jsonData, err := json.Marshal(chatReq)
+    if err != nil {
+        return "", fmt.Errorf("error marshaling request: %v", err)
+    }
+
+    resp, err := makeAPIRequest(jsonData)
+    if err != nil {
+        return "", err
+    }
+    defer resp.Body.Close()
+
+    var chatResp ChatResponse
+    if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+        return "", fmt.Errorf("error decoding response: %v", err)
+    }
+    return strings.TrimSpace(chatResp.Message.Content), nil
+}
+
+// translateResponse prints a translation of an agent's completed response beneath it
+func translateResponse(text string) {
+    if translateTo == "" || strings.TrimSpace(text) == "" {
+        return
+    }
+
+    fmt.Println()
+    anim := startAnimation()
+    translation, err := generateText(fmt.Sprintf("You are a translator. Translate the user's message into the language with code %s. Keep the formatting, names and code blocks unchanged. Reply with the translation only, without notes or explanations.", translateTo), text)
+    anim.stopAnimation()
+    if err != nil {
+        fmt.Printf("\n⚠️ Warning: Failed to translate response: %v\n", err)
+        return
+    }
+
+    fmt.Print("\n" + colorize("🌐 "+translation, theme.Current().Muted))
+}
+
+// buildSystemMessage returns an agent's system message with the instructions given with --system,
+// what is remembered about the user and the summary of the agent's earlier sessions
+func buildSystemMessage(agent agents.AgentConfig, isAuto bool, participants string) string {
+    message := agent.GetFullSystemMessage(isAuto, participants)
+    if extraInstructions != "" {
+        message += "\n\nAlso follow these instructions, which take precedence over the guidelines above:\n" + extraInstructions
+    }
+    if userMemory != nil {
+        if facts := userMemory.Prompt(); facts != "" {
+            message += "\n\n" + facts
+        }
+    }
+    if summary := loadAgentSummary(agent).Prompt(); summary != "" {
+        message += "\n\n" + summary
+    }
+    return message
+}
+
+// getSummaryPathForAgent returns the path of an agent's memory summary
+func getSummaryPathForAgent(agentName string) (string, error) {
+    return appdir.DataPath(agents.GetSummaryFileName(agentName))
+}
+
+// loadAgentSummary returns the summary of an agent's earlier sessions
+func loadAgentSummary(agent agents.AgentConfig) memory.Summary {
+    if !memoryEnabled {
+        return memory.Summary{}
+    }
+    if summary, ok := agentSummaries[agent.Name]; ok {
+        return summary
+    }
+
+    var summary memory.Summary
+    if path, err := getSummaryPathForAgent(agent.Name); err == nil {
+        summary, err = memory.LoadSummary(path)
+        if err != nil && debugMode {
+            fmt.Printf("Debug: %v\n", err)
+        }
+    }
+    agentSummaries[agent.Name] = summary
+    return summary
+}
+
+// summarizeSession folds a finished session into the agent's rolling memory summary
+func summarizeSession(agent agents.AgentConfig, transcript string) {
+    if !memoryEnabled || strings.TrimSpace(transcript) == "" {
+        return
+    }
+
+    summary := loadAgentSummary(agent)
+    text, err := generateText(summary.SummaryPrompt(agent.Name), "New session transcript:\n"+transcript)
+    if err != nil || text == "" {
+        if debugMode {
+            fmt.Printf("Debug: failed to summarize the session with %s: %v\n", agent.Name, err)
+        }
+        return
+    }
+
+    summary = memory.Summary{Text: text, Sessions: summary.Sessions + 1, Updated: time.Now()}
+    path, err := getSummaryPathForAgent(agent.Name)
+    if err == nil {
+        err = memory.SaveSummary(path, summary)
+    }
+    if err != nil {
+        fmt.Printf("⚠️ Warning: Failed to save %s's memory: %v\n", agent.Name, err)
+        return
+    }
+    agentSummaries[agent.Name] = summary
+}
+
+// rememberUserFacts asks the model for durable facts in the user's messages and stores the new ones
+func rememberUserFacts(userMessages []string) {
+    if userMemory == nil || len(userMessages) == 0 {
+        return
+    }
+
+    reply, err := generateText(userMemory.ExtractionPrompt(), "User messages:\n- "+strings.Join(userMessages, "\n- "))
+    if err != nil {
+        if debugMode {
+            fmt.Printf("Debug: memory extraction failed: %v\n", err)
+        }
+        return
+    }
+
+    var added []memory.Fact
+    for _, text := range memory.ParseFacts(reply) {
+        if fact, ok := userMemory.Add(text); ok {
+            added = append(added, fact)
+        }
+    }
+    if len(added) == 0 {
+        return
+    }
+    if err := userMemory.Save(); err != nil {
+        fmt.Printf("⚠️ Warning: %v\n", err)
+        return
+    }
+    for _, fact := range added {
+        fmt.Println(colorize(fmt.Sprintf("🧠 Remembered #%d: %s", fact.ID, fact.Text), theme.Current().Muted))
+    }
+}
+
+// handleMemoryCommand lists or forgets remembered facts
+func handleMemoryCommand(args []string) error {
+    store, err := memory.Load()
+    if err != nil {
+        return err
+    }
+
+    action := "list"
+    if len(args) > 0 {
+        action = args[0]
+    }
+
+    palette := theme.Current()
+    switch action {
+    case "list":
+        if len(store.Facts) == 0 {
+            fmt.Println("Nothing remembered yet. Facts about you are collected as you chat.")
+            return nil
+        }
+        fmt.Printf("\n%s🧠 What Chatty remembers about you%s\n\n", palette.Heading, colorReset)
+        for _, fact := range store.Facts {
+            fmt.Printf("  %s#%d%s %s %s(%s)%s\n", palette.Label, fact.ID, colorReset, fact.Text,
+                palette.Muted, fact.Created.Format("2006-01-02"), colorReset)
+        }
+        fmt.Println("\nForget a fact with: chatty --memory forget <id|all>")
+        return nil
+    case "forget":
+        if len(args) < 2 {
+            return fmt.Errorf("missing fact to forget\n\nUsage: chatty --memory forget <id|all>")
+        }
+        if args[1] == "all" {
+            store.Clear()
+        } else {
+            id, err := strconv.Atoi(strings.TrimPrefix(args[1], "#"))
+            if err != nil {
+                return fmt.Errorf("invalid fact id: %s", args[1])
+            }
+            if !store.Forget(id) {
+                return fmt.Errorf("no remembered fact with id %d", id)
+            }
+        }
+        if err := store.Save(); err != nil {
+            return err
+        }
+        fmt.Printf("%s✓ Forgotten%s\n", palette.Success, colorReset)
+        return nil
+    default:
+        return fmt.Errorf("unknown memory command '%s'\n\nUsage: chatty --memory list|forget <id|all>", action)
+    }
+}
+
+// handleProfileCommand manages configuration profiles, each with its own config, agents and
+// histories: profile [list] | profile create <name> [--from <profile>] | profile switch <name>
+func handleProfileCommand(args []string) error {
+    const usage = "Usage: chatty profile [list] | chatty profile create <name> [--from <profile>] | chatty profile switch <name>"
+    action := "list"
+    if len(args) > 0 {
+        action = args[0]
+    }
+    palette := theme.Current()
+
+    switch action {
+    case "list":
+        names, err := appdir.Profiles()
+        if err != nil {
+            return err
+        }
+        fmt.Printf("\n%s🗂️ Profiles%s\n\n", palette.Heading, colorReset)
+        for _, name := range names {
+            if name == appdir.Current() {
+                fmt.Printf("  %s● %s%s %s(in use)%s\n", palette.Success, name, colorReset, palette.Muted, colorReset)
+            } else {
+                fmt.Printf("    %s\n", name)
+            }
+        }
+        fmt.Println("\nSwitch with: chatty profile switch <name>, or use one for a single run with --config-profile <name>")
+        return nil
+    case "create":
+        if len(args) < 2 {
+            return fmt.Errorf("missing profile name\n\n%s", usage)
+        }
+        name := args[1]
+        from := ""
+        if len(args) > 2 {
+            if args[2] != "--from" || len(args) != 4 {
+                return fmt.Errorf("unexpected arguments: %s\n\n%s", strings.Join(args[2:], " "), usage)
+            }
+            from = args[3]
+            if !appdir.Exists(from) {
+                return fmt.Errorf("no profile named '%s' to copy", from)
+            }
+        }
+        dir, err := appdir.Create(name)
+        if err != nil {
+            return err
+        }
+        if from != "" {
+            if err := copyProfile(from, dir); err != nil {
+                os.RemoveAll(dir)
+                return err
+            }
+        }
+        fmt.Printf("%s✓ Created profile '%s'%s in %s\n", palette.Success, name, colorReset, dir)
+        if from != "" {
+            fmt.Printf("  With the config and agents of '%s', and no chat history\n", from)
+        }
+        fmt.Printf("\nUse it with: chatty profile switch %s, or for a single run: chatty --config-profile %s\n", name, name)
+        return nil
+    case "switch":
+        if len(args) != 2 {
+            return fmt.Errorf("missing profile name\n\n%s", usage)
+        }
+        if err := appdir.Switch(args[1]); err != nil {
+            return err
+        }
+        fmt.Printf("%s✓ Switched to profile '%s'%s\n", palette.Success, args[1], colorReset)
+        return nil
+    default:
+        return fmt.Errorf("unknown profile command '%s'\n\n%s", action, usage)
+    }
+}
+
+// handleConfigCommand keeps secrets, like the tokens of the chat bridges, in the system keyring
+func handleConfigCommand(args []string) error {
+    const usage = "Usage: chatty config secrets | chatty config set-secret <name> | chatty config delete-secret <name>"
+    if len(args) == 0 {
+        return fmt.Errorf("missing config command\n\n%s", usage)
+    }
+    palette := theme.Current()
+
+    switch args[0] {
+    case "secrets":
+        fmt.Printf("\n%s🔑 Secrets%s\n\n", palette.Heading, colorReset)
+        var keyringErr error
+        for _, secret := range secrets.Known {
+            status := fmt.Sprintf("%snot set%s", palette.Muted, colorReset)
+            if os.Getenv(secret.Env) != "" {
+                status = fmt.Sprintf("%sfrom %s%s", palette.Success, secret.Env, colorReset)
+            } else if _, err := secrets.Get(secret.Name); err == nil {
+                status = fmt.Sprintf("%sin the keyring%s", palette.Success, colorReset)
+            } else if !errors.Is(err, secrets.ErrNotFound) {
+                keyringErr = err
+            }
+            fmt.Printf("  %s%-20s%s %s\n", palette.Label, secret.Name, colorReset, status)
+            fmt.Printf("  %s%-20s %s%s\n", palette.Muted, "", secret.Description, colorReset)
+        }
+        if keyringErr != nil {
+            fmt.Printf("\nWarning: %v\n", keyringErr)
+        }
+        fmt.Println("\nStore one with: chatty config set-secret <name>. Its variable wins over the keyring when set")
+        return nil
+    case "set-secret":
+        if len(args) != 2 {
+            return fmt.Errorf("missing secret name\n\n%s", usage)
+        }
+        secret, ok := secrets.Find(args[1])
+        if !ok {
+            return fmt.Errorf("unknown secret '%s' (secrets: %s)", args[1], strings.Join(secrets.Names(), ", "))
+        }
+        fmt.Printf("%sValue of %s (not shown): %s", palette.Prompt, secret.Name, colorReset)
+        value, err := term.ReadHidden(os.Stdin)
+        fmt.Println()
+        if err != nil {
+            return fmt.Errorf("failed to read the value: %v", err)
+        }
+        value = strings.TrimSpace(value)
+        if value == "" {
+            return fmt.Errorf("no value given, so %s was left as it was", secret.Name)
+        }
+        if err := secrets.Set(secret.Name, value); err != nil {
+            return fmt.Errorf("%v\n\nSet the %s environment variable instead", err, secret.Env)
+        }
+        fmt.Printf("%s✓ Stored %s in the system keyring%s\n", palette.Success, secret.Name, colorReset)
+        if os.Getenv(secret.Env) != "" {
+            fmt.Printf("  %s%s is set too, and is used instead while it is%s\n", palette.Muted, secret.Env, colorReset)
+        }
+        return nil
+    case "delete-secret":
+        if len(args) != 2 {
+            return fmt.Errorf("missing secret name\n\n%s", usage)
+        }
+        err := secrets.Delete(args[1])
+        if errors.Is(err, secrets.ErrNotFound) {
+            return fmt.Errorf("%s isn't in the keyring", strings.ToLower(args[1]))
+        }
+        if err != nil {
+            return err
+        }
+        fmt.Printf("%s✓ Removed %s from the system keyring%s\n", palette.Success, strings.ToLower(args[1]), colorReset)
+        return nil
+    default:
+        return fmt.Errorf("unknown config command '%s'\n\n%s", args[0], usage)
+    }
+}
+
+// copyProfile copies the config and user agents of a profile into a new profile's directory
+func copyProfile(from, dir string) error {
+    source, _, err := appdir.ProfileDirs(from)
+    if err != nil {
+        return err
+    }
+    files := []string{configFile}
+    agentFiles, _ := filepath.Glob(filepath.Join(source, "agents", "*.yaml"))
+    for _, path := range agentFiles {
+        files = append(files, filepath.Join("agents", filepath.Base(path)))
+    }
+    for _, file := range files {
+        data, err := os.ReadFile(filepath.Join(source, file))
+        if os.IsNotExist(err) {
+            continue
+        }
+        if err != nil {
+            return fmt.Errorf("failed to copy %s: %v", file, err)
+        }
+        target := filepath.Join(dir, file)
+        if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+            return fmt.Errorf("failed to copy %s: %v", file, err)
+        }
+        if err := os.WriteFile(target, data, 0644); err != nil {
+            return fmt.Errorf("failed to copy %s: %v", file, err)
+        }
+    }
+    return nil
+}
+
+// handleToolsCommand lists the tools and their permissions, or changes a permission:
+// --tools [list] | --tools allow|deny|ask|reset <tool> [--agent <name>]
+func handleToolsCommand(args []string) error {
+    const usage = "Usage: chatty --tools [list] | chatty --tools allow|deny|ask|reset <tool> [--agent <name>]"
+    action := "list"
+    if len(args) > 0 {
+        action = args[0]
+    }
+    palette := theme.Current()
+
+    if action == "list" {
+        fmt.Printf("\n%s🔧 Tools%s\n\n", palette.Heading, colorReset)
+        for _, name := range tools.Names() {
+            tool, _ := tools.Get(name)
+            permission := toolPermissions[name]
+            if permission == "" {
+                permission = "default"
+                if tool.Confirm != nil {
+                    permission = "default (asks first)"
+                }
+            }
+            fmt.Printf("  %s%-14s%s %s%-22s%s %s\n", palette.Label, name, colorReset, palette.Accent, permission, colorReset, tool.Description)
+            for agentName, permissions := range agentToolPermissions {
+                if override, ok := permissions[name]; ok {
+                    fmt.Printf("  %-14s %s%s for %s%s\n", "", palette.Muted, override, agentName, colorReset)
+                }
+            }
+        }
+        if !toolsEnabled {
+            fmt.Printf("\n%sTools are turned off by disable_tools in config.json%s\n", palette.Muted, colorReset)
+        }
+        fmt.Println("\nChange a permission with: chatty --tools allow|deny|ask|reset <tool> [--agent <name>]")
+        return nil
+    }
+
+    if len(args) < 2 {
+        return fmt.Errorf("missing tool name\n\n%s", usage)
+    }
+    permission := action
+    if action == "reset" {
+        permission = ""
+    } else if !tools.ValidPermission(action) {
+        return fmt.Errorf("unknown tools command '%s'\n\n%s", action, usage)
+    }
+    tool := args[1]
+    if _, ok := tools.Get(tool); !ok {
+        return fmt.Errorf("unknown tool '%s': see chatty --tools", tool)
+    }
+
+    agentName := ""
+    if len(args) > 2 {
+        if args[2] != "--agent" || len(args) < 4 {
+            return fmt.Errorf("unexpected arguments: %s\n\n%s", strings.Join(args[2:], " "), usage)
+        }
+        if !agents.IsValidAgent(args[3]) {
+            return failure.New(failure.InvalidAgent, "agent '%s' not found", args[3])
+        }
+        agentName = agents.GetAgentConfig(args[3]).Name
+    }
+
+    if err := agents.SetToolPermission(agentName, tool, permission); err != nil {
+        return fmt.Errorf("failed to save config: %v", err)
+    }
+    scope := "all agents"
+    if agentName != "" {
+        scope = agentName
+    }
+    if permission == "" {
+        fmt.Printf("%s✓ %s uses its default permission for %s%s\n", palette.Success, tool, scope, colorReset)
+    } else {
+        fmt.Printf("%s✓ %s set to %s for %s%s\n", palette.Success, tool, permission, scope, colorReset)
+    }
+    return nil
+}
+
+// speakResponse reads an agent's completed response aloud when --speak is enabled
+func speakResponse(agent agents.AgentConfig, text string) {
+    if speaker == nil {
+        return
+    }
+    if err := speaker.Speak(text, agent.Voice); err != nil {
+        fmt.Printf("\n⚠️ Warning: Failed to speak response: %v\n", err)
+    }
+}
+
+// exit flushes any mirrored output before terminating the process
+func exit(code int) {
+    printProfile()
+    filelock.ReleaseAll()
+    closeOutputLog.Do(func() {
+        if outputTee != nil {
+            outputTee.Stop()
+            outputLog.Close()
+        }
+    })
+    os.Exit(code)
+}
+
+// fail reports the error chatty stops on and exits with the code of its kind. With --json the
+// error is written to stderr as JSON, leaving stdout to the response
+func fail(err error, hints ...string) {
+    var suggestion string
+    if failure.KindOf(err) == failure.ModelMissing {
+        var modelHints []string
+        suggestion, modelHints = suggestModel(agents.GetCurrentModel())
+        hints = append(hints, modelHints...)
+    }
+    failShowing(err, hints, func() {
+        fmt.Printf("Error: %v\n", err)
+        if len(hints) > 0 {
+            fmt.Println()
+            for _, hint := range hints {
+                fmt.Println(hint)
+            }
+        }
+        if suggestion != "" {
+            offerModel(suggestion)
+        }
+    })
+}
+
+// installedModels returns the names of the models Ollama has, like "llama3.2:3b"
+func installedModels() ([]string, error) {
+    var tags struct {
+        Models []struct {
+            Name string `json:"name"`
+        } `json:"models"`
+    }
+    if err := callOllama(http.MethodGet, ollamaBaseURL+"/api/tags", nil, readyTimeout, &tags); err != nil {
+        return nil, err
+    }
+    var names []string
+    for _, model := range tags.Models {
+        names = append(names, model.Name)
+    }
+    return names, nil
+}
+
+// closestModel returns the installed model most likely meant by model: the same model with
+// another tag, or one whose name is a typo away. It is empty when none comes close
+func closestModel(model string, installed []string) string {
+    base, _, _ := strings.Cut(model, ":")
+    bases := make([]string, len(installed))
+    for i, name := range installed {
+        bases[i], _, _ = strings.Cut(name, ":")
+        if strings.EqualFold(bases[i], base) {
+            return name
+        }
+    }
+    if name := suggest.Closest(model, installed); name != "" {
+        return name
+    }
+    if closest := suggest.Closest(base, bases); closest != "" {
+        for i := range bases {
+            if bases[i] == closest {
+                return installed[i]
+            }
+        }
+    }
+    return ""
+}
+
+// suggestModel returns the installed model closest to a model Ollama doesn't have, and hints on
+// what to use instead
+func suggestModel(model string) (string, []string) {
+    installed, err := installedModels()
+    if err != nil || len(installed) == 0 {
+        return "", []string{fmt.Sprintf("Hint: Edit %s to set a valid model name", configFilePath()), "Available models can be listed with: ollama list"}
+    }
+    if suggestion := closestModel(model, installed); suggestion != "" {
+        return suggestion, []string{fmt.Sprintf("Did you mean %s?", suggestion)}
+    }
+    return "", []string{"Installed models: " + strings.Join(installed, ", "), fmt.Sprintf("Hint: Edit %s to set one of them as the model", configFilePath())}
+}
+
+// configFilePath returns where config.json is, for messages telling to edit it
+func configFilePath() string {
+    configDir, err := appdir.ConfigDir()
+    if err != nil {
+        return filepath.Join("~", ".chatty", configFile)
+    }
+    return filepath.Join(configDir, configFile)
+}
+
+// offerModel asks whether to switch config.json to a suggested model, when there is someone to ask
+func offerModel(model string) {
+    if unattended || !term.IsTerminal(os.Stdin) {
+        return
+    }
+    palette := theme.Current()
+    fmt.Printf("\n%sUse %s from now on? [y/N]: %s", palette.Accent, model, colorReset)
+    answer, err := stdin.ReadString('\n')
+    if err != nil {
+        return
+    }
+    if answer = strings.ToLower(strings.TrimSpace(answer)); answer != "y" && answer != "yes" {
+        return
+    }
+    if err := agents.UpdateModel(model); err != nil {
+        fmt.Printf("⚠️ Warning: Failed to update config.json: %v\n", err)
+        return
+    }
+    // A model set for the run or the project wins over the one saved
+    if override := agents.ModelOverride(); override != "" {
+        fmt.Printf("%s✓%s config.json now uses %s, but %s wins over it with %s. Change the model there to chat with %s\n", palette.Success, colorReset, model, override, agents.GetCurrentModel(), model)
+        return
+    }
+    fmt.Printf("%s✓%s config.json now uses %s. Run the command again to chat with it\n", palette.Success, colorReset, model)
+}
+
+// failShowing stops on err like fail, with show printing it in the terminal when it takes
+// more than a line, like a list of the agents to pick from
+func failShowing(err error, hints []string, show func()) {
+    kind := failure.KindOf(err)
+    if jsonErrors {
+        report := struct {
+            Kind     string   `json:"kind"`
+            Message  string   `json:"message"`
+            Hints    []string `json:"hints,omitempty"`
+            ExitCode int      `json:"exit_code"`
+        }{kind.String(), err.Error(), hints, kind.ExitCode()}
+        data, _ := json.Marshal(map[string]any{"error": report})
+        fmt.Fprintln(os.Stderr, string(data))
+    } else {
+        show()
+    }
+    exit(kind.ExitCode())
+}
+
+// failInvalidAgent stops on a name that matches no agent, listing the agents there are
+func failInvalidAgent(name string) {
+    err := failure.New(failure.InvalidAgent, "invalid agent name '%s'", name)
+    failShowing(err, []string{"See the available agents with: chatty --list"}, func() {
+        fmt.Printf("Error: Invalid agent name '%s'\n", name)
+        fmt.Println("\nAvailable agents:")
+        fmt.Print(agents.ListAgents())
+    })
+}
+
+// checkEnabled returns an error for an agent that is disabled
+func checkEnabled(name string) error {
+    if agents.IsDisabled(name) {
+        return failure.New(failure.InvalidAgent, "%s is disabled", agents.GetAgentConfig(name).Name)
+    }
+    return nil
+}
+
+// enableHint tells how to enable a disabled agent
+func enableHint(name string) string {
+    return fmt.Sprintf("Enable it with: chatty --enable \"%s\"", agents.GetAgentConfig(name).Name)
+}
+
+// printProfile shows what --profile measured, once, when the run ends
+func printProfile() {
+    summary, ok, err := profile.Finish()
+    if !ok {
+        return
+    }
+    palette := theme.Current()
+    row := func(label, value string) {
+        fmt.Printf("  %s%-22s%s %s\n", palette.Label, label, colorReset, value)
+    }
+    round := func(d time.Duration) string {
+        return d.Round(100 * time.Microsecond).String()
+    }
+
+    fmt.Printf("\n%s⏱️ Profile%s\n", palette.Heading, colorReset)
+    row("Total time", round(summary.Elapsed))
+    row("Requests", fmt.Sprintf("%d (%d retried)", len(summary.Requests), summary.Retries))
+    if len(summary.Requests) > 0 {
+        first, slowest := summary.Requests[0].FirstToken, summary.Requests[0].FirstToken
+        var total time.Duration
+        tokenCount, generating := 0, time.Duration(0)
+        for _, request := range summary.Requests {
+            total += request.FirstToken
+            first = min(first, request.FirstToken)
+            slowest = max(slowest, request.FirstToken)
+            tokenCount += request.Tokens
+            generating += request.Generating
+        }
+        row("Time to first token", fmt.Sprintf("%s average, %s fastest, %s slowest",
+            round(total/time.Duration(len(summary.Requests))), round(first), round(slowest)))
+        rate := profile.Request{Tokens: tokenCount, Generating: generating}.TokensPerSecond()
+        row("Generation", fmt.Sprintf("%d tokens at %.1f tokens/sec", tokenCount, rate))
+    }
+    for _, operation := range summary.Operations {
+        row(strings.ToUpper(operation.Name[:1])+operation.Name[1:], fmt.Sprintf("%d in %s, %s slowest",
+            operation.Count, round(operation.Total), round(operation.Max)))
+    }
+    if summary.PprofDir != "" {
+        fmt.Printf("  %sProfiles written to %s, see them with: go tool pprof %s%s\n", palette.Muted,
+            summary.PprofDir, filepath.Join(summary.PprofDir, "cpu.pprof"), colorReset)
+    }
+    if err != nil {
+        fmt.Printf("Warning: %v\n", err)
+    }
+}
+
+// extractGlobalFlag removes a boolean flag from the arguments, reporting whether it was present
+func extractGlobalFlag(flag string) bool {
+    for i, arg := range os.Args {
+        if arg == flag {
+            os.Args = append(os.Args[:i], os.Args[i+1:]...)
+            return true
+        }
+    }
+    return false
+}
+
+// extractGlobalOption removes a flag and its value from the arguments
+func extractGlobalOption(flag string) (string, bool, error) {
+    for i, arg := range os.Args {
+        if arg == flag {
+            if i+1 >= len(os.Args) {
+                return "", true, fmt.Errorf("%s argument is missing", flag)
+            }
+            value := os.Args[i+1]
+            os.Args = append(os.Args[:i], os.Args[i+2:]...)
+            return value, true, nil
+        }
+    }
+    return "", false, nil
+}
+
+// extractSummaryOptions removes --summary-every and --facilitator from the arguments. A
+// facilitator alone writes a summary every defaultSummaryEvery turns
+func extractSummaryOptions() (int, string) {
+    every, foundEvery, err := extractGlobalOption("--summary-every")
+    if err != nil {
+        fail(err, "Usage: --summary-every N")
+    }
+    facilitator, foundFacilitator, err := extractGlobalOption("--facilitator")
+    if err != nil {
+        fail(err, "Usage: --facilitator <agent_name>")
+    }
+
+    turns := 0
+    if foundEvery {
+        turns, err = strconv.Atoi(every)
+        if err != nil || turns < 1 {
+            fail(fmt.Errorf("--summary-every must be a positive number, not '%s'", every))
+        }
+    } else if foundFacilitator {
+        turns = defaultSummaryEvery
+    }
+    facilitator = strings.TrimSpace(facilitator)
+    if foundFacilitator && !agents.IsValidAgent(facilitator) {
+        failInvalidAgent(facilitator)
+    }
+    return turns, facilitator
+}
+
+// Update the makeAPIRequestWithRetry function
+func makeAPIRequestWithRetry(jsonData []byte, agent string) (*http.Response, error) {
+    // First, check if Ollama is ready
+    if err := checkOllamaReady(); err != nil {
+        return nil, err
+    }
+
+    var lastErr error
+    retryDelay := initialRetryDelay
+
+    for attempt := 1; attempt <= maxRetries; attempt++ {
+        // Show retry attempt if not first try
+        if attempt > 1 {
+            fmt.Printf("\nRetrying request for %s (attempt %d/%d)...\n", agent, attempt, maxRetries)
+            profile.AddRetry()
+        }
+
+        resp, err := makeAPIRequest(jsonData)
+        if err == nil {
+            return resp, nil
+        }
+        if errors.Is(err, errToolsUnsupported) || errors.Is(err, errInterrupted) {
+            return nil, err
+        }
+
+        lastErr = err
+
+        // Don't wait after the last attempt
+        if attempt < maxRetries {
+            // Calculate next delay with exponential backoff
+            if attempt > 1 {
+                retryDelay = time.Duration(float64(retryDelay) * 1.5)
+                if retryDelay > maxRetryDelay {
+                    retryDelay = maxRetryDelay
+                }
+            }
+
+            fmt.Printf("Request failed: %v\nWaiting %.0f seconds before retry...\n", 
+                err, retryDelay.Seconds())
+
+            // Wait for either the delay to complete or an interrupt
+            select {
+            case <-time.After(retryDelay):
+                continue
+            case <-interruptCtx.Done():
+                return nil, errInterrupted
+            }
+        }
+    }
+
+    return nil, fmt.Errorf("after %d attempts: %w", maxRetries, lastErr)
+}
+
+// errToolsUnsupported is returned when a request advertises tools to a model that can't call them
+var errToolsUnsupported = errors.New("the model does not support tools")
+
+// errInterrupted is returned when Ctrl+C aborted a request
+var errInterrupted = errors.New("interrupted")
+
+// ollamaClient makes every request to Ollama, so they share its pool of connections. It has no
+// overall timeout, as responses stream for as long as the model writes: short requests set one
+// with their context, and streams are cancelled when they stall
+var ollamaClient = &http.Client{
+    Transport: &http.Transport{
+        DialContext:         (&net.Dialer{Timeout: requestTimeout, KeepAlive: 30 * time.Second}).DialContext,
+        MaxIdleConns:        maxIdleConns,
+        MaxConnsPerHost:     maxConnsPerHost,
+        MaxIdleConnsPerHost: maxConnsPerHost,
+        IdleConnTimeout:     idleConnTimeout,
+        ForceAttemptHTTP2:   true,
+        WriteBufferSize:     64 * 1024,
+        ReadBufferSize:      64 * 1024,
+    },
+}
+
+// callOllama sends a request to Ollama that must complete within timeout, decoding the JSON
+// response into result unless it is nil
+func callOllama(method, endpoint string, body []byte, timeout time.Duration, result any) error {
+    ctx, cancel := context.WithTimeout(interruptCtx, timeout)
+    defer cancel()
+    req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewReader(body))
+    if err != nil {
+        return err
+    }
+    req.Header.Set("Content-Type", "application/json")
+    resp, err := ollamaClient.Do(req)
+    if err != nil {
+        return err
+    }
+    defer resp.Body.Close()
+    if resp.StatusCode != http.StatusOK {
+        return fmt.Errorf("%s", resp.Status)
+    }
+    if result == nil {
+        return nil
+    }
+    return json.NewDecoder(resp.Body).Decode(result)
+}
+
+// Update the makeAPIRequest function
+func makeAPIRequest(jsonData []byte) (*http.Response, error) {
+    // Print request JSON in debug mode
+    if debugMode {
+        // Pretty print the JSON with indentation
+        var prettyJSON bytes.Buffer
+        if err := json.Indent(&prettyJSON, jsonData, "", "    "); err != nil {
+            fmt.Printf("Error formatting JSON: %v\n", err)
+            return nil, err
+        }
+        
+        // Print with colors and formatting
+        fmt.Printf("\n%sDebug: Request JSON:%s\n", 
+            theme.Current().Accent,
+            colorReset)
+        fmt.Printf("%s%s%s\n\n",
+            theme.Current().Title,
+            prettyJSON.String(),
+            colorReset)
+    }
+
+    // Create the request, cancelled when the response stalls
+    ctx, cancel := context.WithCancelCause(interruptCtx)
+    req, err := http.NewRequestWithContext(ctx, "POST", getOllamaAPI(), bytes.NewBuffer(jsonData))
+    if err != nil {
+        cancel(nil)
+        return nil, fmt.Errorf("error creating request: %v", err)
+    }
+    req.Header.Set("Content-Type", "application/json")
+
+    // Make the request
+    resp, err := ollamaClient.Do(req)
+    if err != nil {
+        cancel(nil)
+        if interruptCtx.Err() != nil {
+            return nil, errInterrupted
+        }
+        if strings.Contains(err.Error(), "connection refused") {
+            return nil, failure.New(failure.OllamaUnreachable, "could not connect to Ollama at %s - make sure 'ollama serve' is running", ollamaBaseURL)
+        }
+        return nil, failure.New(failure.OllamaUnreachable, "error connecting to Ollama: %v", err)
+    }
+
+    // Check for error responses
+    if resp.StatusCode != http.StatusOK {
+        defer cancel(nil)
+        defer resp.Body.Close()
+        
+        // Try to read error details
+        var errorResponse struct {
+            Error string `json:"error"`
+        }
+        body, _ := io.ReadAll(resp.Body)
+        if err := json.Unmarshal(body, &errorResponse); err == nil && errorResponse.Error != "" {
+            if strings.Contains(errorResponse.Error, "does not support tools") {
+                return nil, errToolsUnsupported
+            }
+            if resp.StatusCode == http.StatusNotFound && strings.Contains(errorResponse.Error, "not found") {
+                return nil, failure.New(failure.ModelMissing, "model '%s' is not installed in Ollama", agents.GetCurrentModel())
+            }
+            if strings.Contains(errorResponse.Error, "model") {
+                return nil, failure.New(failure.ModelMissing, "invalid model '%s' - please check your config.json file", agents.GetCurrentModel())
+            }
+            return nil, fmt.Errorf("API error: %s", errorResponse.Error)
+        }
+        
+        return nil, fmt.Errorf("API error (status %d): failed to process request", resp.StatusCode)
+    }
+
+    resp.Body = newStreamBody(ctx, resp.Body, cancel)
+    return resp, nil
+}
+
+// errStalled ends a response Ollama stopped sending
+var errStalled = fmt.Errorf("ollama sent nothing for %s", readTimeout)
+
+// streamBody is a streaming response body that cancels its request when no data arrives for
+// readTimeout, or when Ctrl+C is pressed. The wait only starts once Ollama responds, so loading
+// a model can take longer
+type streamBody struct {
+    io.ReadCloser
+    ctx    context.Context
+    timer  *time.Timer
+    cancel context.CancelCauseFunc
+}
+
+// newStreamBody watches body, cancelling its request with cancel when it stalls
+func newStreamBody(ctx context.Context, body io.ReadCloser, cancel context.CancelCauseFunc) *streamBody {
+    return &streamBody{
+        ReadCloser: body,
+        ctx:        ctx,
+        timer:      time.AfterFunc(readTimeout, func() { cancel(errStalled) }),
+        cancel:     cancel,
+    }
+}
+
+func (b *streamBody) Read(p []byte) (int, error) {
+    n, err := b.ReadCloser.Read(p)
+    if err != nil && errors.Is(context.Cause(b.ctx), errStalled) {
+        return n, errStalled
+    }
+    if err != nil && interruptCtx.Err() != nil {
+        return n, errInterrupted
+    }
+    b.timer.Reset(readTimeout)
+    return n, err
+}
+
+func (b *streamBody) Close() error {
+    b.timer.Stop()
+    b.cancel(nil)
+    return b.ReadCloser.Close()
+}
+
+// Add this new function to format user messages consistently
+func formatUserMessage(message string) string {
+    return formatUserLabel() + message
+}
+
+// Add this new type to track conversation time
+type ConversationState struct {
+    startTime time.Time
+    lastActive time.Time
+}
+
+// Style of elapsed times, from duration_format in config.json
+var durationFormat = elapsed.Long
+
+// formatElapsedTime describes how long has passed from start to current in the configured style
+func formatElapsedTime(start, current time.Time) string {
+    return elapsed.Format(start, current, durationFormat)
+}
+
+// Update the handleMultiAgentConversation function to format participants list without newlines
+// runConversation runs a multi-agent conversation and sends a desktop notification when
+// an unattended run (--auto with --turns) completes or fails
+func runConversation(config ConversationConfig) error {
+    start := time.Now()
+    err := handleMultiAgentConversation(config)
+    if !config.AutoMode || config.Turns == 0 {
+        return err
+    }
+
+    if appConfig, configErr := agents.GetCurrentConfig(); configErr == nil && appConfig.DisableNotifications {
+        return err
+    }
+
+    title := "Chatty conversation finished"
+    message := fmt.Sprintf("%s completed %d turns in %s", strings.Join(config.Agents, ", "), config.Turns,
+        formatElapsedTime(start, time.Now()))
+    if err != nil {
+        title = "Chatty conversation failed"
+        message = err.Error()
+    }
+    if notifyErr := notify.Send(title, message); notifyErr != nil && debugMode {
+        fmt.Printf("Debug: %v\n", notifyErr)
+    }
+    return err
+}
+
+// describeParticipants lists the other members of a conversation for the system message of
+// agentConfigs[speaker], including the user when they take part
+func describeParticipants(agentConfigs []agents.AgentConfig, speaker int, withUser bool) string {
+    var participants strings.Builder
+    for j, other := range agentConfigs {
+        if j != speaker {  // Skip current agent
+            if j > 0 {
+                participants.WriteString(" ")
+            }
+            participants.WriteString(fmt.Sprintf("%d. %s (%s) - %s", 
+                j+1, 
+                other.Name, 
+                other.Emoji,
+                other.Description))
+        }
+    }
+    if withUser {
+        if participants.Len() > 0 {
+            participants.WriteString(" ")
+        }
+        participants.WriteString(fmt.Sprintf("%d. User (👤) - Human participant guiding the conversation", 
+            len(agentConfigs)))
+    }
+    return participants.String()
+}
+
+func handleMultiAgentConversation(config ConversationConfig) error {
+    // Nobody is there to approve tool calls while the agents talk among themselves
+    unattended = config.AutoMode
+
+    // Validate configuration
+    if len(config.Agents) < 2 {
+        return fmt.Errorf("at least two agents are required for a conversation")
+    }
+
+    // Check maximum number of agents
+    const maxAgents = 15
+    if len(config.Agents) > maxAgents {
+        return fmt.Errorf("too many agents: maximum allowed is %d, but got %d", maxAgents, len(config.Agents))
+    }
+
+    // Check for duplicate agents
+    seen := make(map[string]bool)
+    for _, name := range config.Agents {
+        // Convert to proper case using GetAgentConfig to ensure consistent comparison
+        properName := agents.GetAgentConfig(name).Name
+        if seen[properName] {
+            return fmt.Errorf("duplicate agent detected: %s (each agent can only be included once)", properName)
+        }
+        seen[properName] = true
+    }
+
+    // Validate all agents exist
+    for _, name := range config.Agents {
+        if !agents.IsValidAgent(name) {
+            return failure.New(failure.InvalidAgent, "invalid agent name: %s", name)
+        }
+        if err := checkEnabled(name); err != nil {
+            return err
+        }
+    }
+
+    // The facilitator may take part in the conversation or only sum it up
+    var facilitator *agents.AgentConfig
+    if config.Facilitator != "" {
+        if !agents.IsValidAgent(config.Facilitator) {
+            return failure.New(failure.InvalidAgent, "invalid facilitator agent name: %s", config.Facilitator)
+        }
+        if err := checkEnabled(config.Facilitator); err != nil {
+            return err
+        }
+        agent := agents.GetAgentConfig(config.Facilitator)
+        facilitator = &agent
+    }
+
+    // Load agent configurations
+    agentConfigs := make([]agents.AgentConfig, 0, len(config.Agents))
+    for _, agentName := range config.Agents {
+        agentConfigs = append(agentConfigs, agents.GetAgentConfig(agentName))
+    }
+
+    // Agents with auto_save keep a transcript without --save
+    if config.SaveFile == "" {
+        config.SaveFile = autoSavePath(agentConfigs...)
+    }
+
+    // Index the agents' knowledge directories before the conversation starts
+    for _, agent := range agentConfigs {
+        agentKnowledge(agent)
+    }
+
+    // Set up colors and emojis for the UI
+    palette := theme.Current()
+    turnSeparatorColor := palette.Section
+    turnColor := palette.Section
+    turnNumberColor := palette.Text
+    timeHeaderColor := palette.Success
+    timeValueColor := palette.Text
+    elapsedTimeColor := palette.Heading
+    inputPromptColor := palette.Section
+    inputHintColor := palette.Muted
+    turnEmoji := "🔄"
+    converseMargin := 1
+
+    currentMessage := config.Starter
+    currentTurn := 1
+    firstMessage := true
+
+    // Initialize conversation histories
+    var conversationLog strings.Builder
+    conversationLog.WriteString(formatUserLabel() + config.Starter + "\n")
+
+    // Initialize conversation histories for each agent
+    histories := make([][]Message, len(agentConfigs))
+    for i, agent := range agentConfigs {
+        // Initialize with system message and conversation context
+        histories[i] = []Message{{
+            Role:    "system",
+            Content: withBriefing(buildSystemMessage(agent, config.AutoMode, ""), config.Briefings, i),
+        }}
+    }
+
+    // Add the initial user message to all agent histories
+    for i := range histories {
+        histories[i] = append(histories[i], Message{
+            Role:    "user",
+            Content: config.Starter,
+        })
+    }
+
+    // Initialize conversation state
+    state := ConversationState{
+        startTime: time.Now(),
+        lastActive: time.Now(),
+    }
+
+    if config.AutoMode {
+        fmt.Println("\n🤖 Auto-conversation mode enabled. Press Ctrl+C to stop.")
+    }
+
+    // Messages from the user, for the long-term memory (agents' messages are not about the user)
+    userMessages := []string{config.Starter}
+
+    // Create a shared conversation history that will be used to build each agent's history
+    sharedHistory := []Message{
+        {
+            Role:    "user",
+            Content: config.Starter,
+        },
+    }
+
+    // Attached material comes before the starter so every agent reads it first
+    if config.Reference != "" {
+        sharedHistory = append([]Message{{Role: "user", Content: config.Reference}}, sharedHistory...)
+    }
+
+    // Where each turn began, so /rewind can go back to it
+    turns := []turnStart{{message: config.Starter, shared: len(sharedHistory) - 1}}
+
+    // Edits to config.json and the agents apply from the next turn
+    watcher := agents.NewWatcher()
+
+    for {
+        // Update last active time
+        state.lastActive = time.Now()
+
+        // Check for stop signal before starting a new turn
+        if interruptCtx.Err() != nil {
+            fmt.Printf("\n\nConversation ended after %s\n",
+                formatElapsedTime(state.startTime, time.Now()))
+            exit(0)
+        }
+
+        // System messages are built for every response, so edited agents take part as they are now
+        if changes := reloadChanges(watcher); len(changes.Updated) > 0 {
+            for i, agent := range agentConfigs {
+                if agents.IsValidAgent(agent.Name) {
+                    agentConfigs[i] = agents.GetAgentConfig(agent.Name)
+                }
+            }
+        }
+
+        // Print turn header with improved structure
+        elapsed := formatElapsedTime(state.startTime, state.lastActive)
+        
+        // Add single blank line before the top separator
+        fmt.Println()
+        
+        // Print top separator
+        fmt.Printf("%s%s%s\n", turnSeparatorColor, strings.Repeat("─", 60), colorReset)
+        
+        // Print turn information
+        fmt.Printf("%s%s Conversation Turn%s %s%d%s\n",
+            turnColor, turnEmoji, colorReset,
+            turnNumberColor, currentTurn, colorReset)
+        
+        // Print time information with better structure and local timezone
+        localStartTime := state.startTime.Local()
+        
+        // Format timezone as GMT±X
+        _, offset := localStartTime.Zone()
+        var gmtOffset string
+        if offset >= 0 {
+            gmtOffset = fmt.Sprintf("GMT+%d", offset/3600)
+        } else {
+            gmtOffset = fmt.Sprintf("GMT%d", offset/3600)
+        }
+        
+        fmt.Printf("%s%sStarted:%s %s%s %s\n",
+            timeHeaderColor,
+            timeHeaderColor, colorReset,
+            timeValueColor,
+            localStartTime.Format("2006-01-02 15:04:05 ")+gmtOffset,
+            colorReset)
+            
+        fmt.Printf("%s%sElapsed:%s %s%s%s\n",
+            timeHeaderColor,
+            timeHeaderColor, colorReset,
+            timeValueColor, elapsed,
+            colorReset)
+            
+        // Print bottom separator
+        fmt.Printf("%s%s%s\n", turnSeparatorColor, strings.Repeat("─", 60), colorReset)
+
+        // In auto mode, print the user's message
+        if !config.AutoMode {
+            fmt.Println(colorize(formatUserMessage(currentMessage), theme.Current().User))
+            fmt.Println()  // Single blank line after user message
+        } else {
+            fmt.Println()  // Single blank line after separator for auto mode
+        }
+
+        // Update conversation log with user message first (except for the first turn)
+        if firstMessage {
+            // First message is already in the log from initialization
+            firstMessage = false
+            
+            // Print the first message in auto mode
+            if config.AutoMode {
+                fmt.Println(colorize(formatUserMessage(currentMessage), theme.Current().User))
+                fmt.Println()  // Single blank line after user message
+            }
+        } else {
+            // For non-auto mode, add the user's new message to the conversation log and shared history
+            if !config.AutoMode {
+                // Add user message to conversation log
+                conversationLog.WriteString(formatUserLabel() + currentMessage + "\n")
+                
+                // Add the user message to the shared history
+                sharedHistory = append(sharedHistory, Message{
+                    Role:    "user",
+                    Content: currentMessage,
+                })
+            }
+            // For auto mode, we don't add a new user message after the first turn
+        }
+
+        // Process each agent's response in this turn
+        for i, agent := range agentConfigs {
+            // Check for stop signal before each agent's response
+            if interruptCtx.Err() != nil {
+                fmt.Printf("\n\nConversation ended after %s\n",
+                    formatElapsedTime(state.startTime, time.Now()))
+                exit(0)
+            }
+
+            // In auto mode, only add margin between agent responses
+            if i > 0 {
+                for i := 0; i < converseMargin; i++ {
+                    fmt.Println()
+                }
+            }
+            
+            // Start animation with correct agent
+            anim := startConversationAnimation(agent)
+
+            // Update the system message with the participants list
+            histories[i][0] = Message{
+                Role:    "system",
+                Content: withBriefing(buildSystemMessage(agent, config.AutoMode, describeParticipants(agentConfigs, i, !config.AutoMode)), config.Briefings, i),
+            }
+
+            // Build this agent's history from the shared history
+            agentHistory := []Message{histories[i][0]} // Start with the system message
+            
+            // Add all messages from the shared history
+            agentHistory = append(agentHistory, sharedHistory...)
+            
+            // Add a final user message instructing the agent to respond naturally
+            // Check if the last message is already an instruction
+            lastMsgIndex := len(agentHistory) - 1
+            
+            // Always add an instruction message to ensure consistent behavior
+            if lastMsgIndex >= 0 && agentHistory[lastMsgIndex].Role == "user" && 
+               (agentHistory[lastMsgIndex].Content == "Please respond naturally as part of this conversation." ||
+                agentHistory[lastMsgIndex].Content == "Respond naturally as part of this conversation and do not add prefixes like '/<Your name/> said:' to your messages.") {
+                // Replace the last message with our instruction
+                agentHistory[lastMsgIndex] = Message{
+                    Role:    "user",
+                    Content: "Respond naturally as part of this conversation and do not add prefixes like '/<Your name/> said:' to your messages.",
+                }
+            } else {
+                // Add a new instruction message
+                agentHistory = append(agentHistory, Message{
+                    Role:    "user",
+                    Content: groupReplyInstruction,
+                })
+            }
+
+            // Look up the user's documents for this agent
+            knowledge := retrieveKnowledge(agent, currentMessage)
+
+            // Prepare the request with full conversation history
+            chatReq := ChatRequest{
+                Model:    agents.GetCurrentModel(),
+                Messages: withKnowledge(agentHistory, formatKnowledge(knowledge)),
+                Stream:   true,
+                KeepAlive: keepAlive,
+                Tools:    availableTools(agent),
+            }
+
+            // Make the API request with retry and process the response, running any tools the agent calls
+            fullResponseText, err := chatWithTools(chatReq, agent, anim, true)
+            if err != nil {
+                // Check if this was due to a stop signal
+                if errors.Is(err, errInterrupted) {
+                    fmt.Printf("\n\nConversation ended after %s\n",
+                        formatElapsedTime(state.startTime, time.Now()))
+                    exit(0)
+                }
+                return fmt.Errorf("error processing response from %s: %w", agent.Name, err)
+            }
+
+            // Update conversation log
+            conversationLog.WriteString(agentLogEntry(agent, fullResponseText))
+
+            // Show the documents the response is based on
+            printCitations(fullResponseText, knowledge)
+
+            // Show the translation and read the response aloud before the next agent speaks
+            translateResponse(fullResponseText)
+            speakResponse(agent, fullResponseText)
+
+            // Add the agent's response to the shared history
+            sharedHistory = append(sharedHistory, Message{
+                Role:    "assistant",
+                Content: fmt.Sprintf("%s said: %s", agent.Name, fullResponseText),
+            })
+
+            // In auto mode, the last agent's response becomes the prompt for the next turn
+            if config.AutoMode && i == len(agentConfigs)-1 {
+                currentMessage = fullResponseText
+            }
+
+            // Print margins
+            for i := 0; i < converseMargin; i++ {
+                fmt.Println()
+            }
+
+            // If this is the last agent in the turn
+            if i == len(agentConfigs)-1 {
+                // Add extra blank line before next turn separator
+                fmt.Println()
+                
+                // A scenario ends as soon as one of its outcomes happens
+                outcome := ""
+                if len(config.WinConditions) > 0 {
+                    outcome, err = scenarioOutcome(config.WinConditions, sharedHistory)
+                    if errors.Is(err, errInterrupted) {
+                        fmt.Printf("\n\nConversation ended after %s\n",
+                            formatElapsedTime(state.startTime, time.Now()))
+                        exit(0)
+                    }
+                    if err != nil {
+                        fmt.Printf("⚠️ Warning: Failed to check the scenario's outcome: %v\n", err)
+                    }
+                }
+
+                // Check if we should continue
+                if outcome != "" || config.Turns > 0 && currentTurn >= config.Turns {
+                    if outcome != "" {
+                        fmt.Printf("\n%s🏁 Scenario over:%s %s\n", theme.Current().Accent, colorReset, outcome)
+                        conversationLog.WriteString(fmt.Sprintf("\n🏁 Scenario over: %s\n", outcome))
+                    } else {
+                        fmt.Printf("\nConversation completed after %d turns.\n", config.Turns)
+                    }
+                    if config.SaveFile != "" {
+                        if err := saveConversationLog(config.SaveFile, conversationLog.String()); err != nil {
+                            fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
+                        } else {
+                            fmt.Printf("Conversation log saved to: %s\n", config.SaveFile)
+                        }
+                    }
+                    rememberUserFacts(userMessages)
+                    for _, agent := range agentConfigs {
+                        summarizeSession(agent, conversationLog.String())
+                    }
+                    return nil
+                }
+
+                if config.AutoMode {
+                    // Every few turns the conversation is summed up, and the summary stands in for the turns it covers
+                    if config.SummaryEvery > 0 && currentTurn%config.SummaryEvery == 0 {
+                        summary, err := summarizeSoFar(agentConfigs, facilitator, sharedHistory, currentTurn)
+                        if errors.Is(err, errInterrupted) {
+                            fmt.Printf("\n\nConversation ended after %s\n",
+                                formatElapsedTime(state.startTime, time.Now()))
+                            exit(0)
+                        }
+                        if err != nil {
+                            fmt.Printf("⚠️ Warning: Failed to summarize the conversation: %v\n", err)
+                        } else {
+                            conversationLog.WriteString(fmt.Sprintf("\n📋 Summary so far (after turn %d)\n%s\n\n", currentTurn, summary))
+                            sharedHistory = compressHistory(sharedHistory, summary, config.Reference != "", len(agentConfigs))
+                        }
+                    }
+
+                    // Add a small delay between turns in auto mode
+                    time.Sleep(2 * time.Second)
+                    currentTurn++
+                    continue
+                }
+
+                // Print margins and input prompt for non-auto mode
+                fmt.Println()  // Single blank line before input prompt
+                fmt.Printf("%sType your message:%s\n", inputPromptColor, colorReset)
+                fmt.Printf("%s[Press Enter with empty message to end the conversation, type %s for a message of several lines, %s for the agents to answer again, or /rewind <turn> to go back to an earlier turn]%s\n", inputHintColor, term.BlockDelimiter, keys.Label(keys.Regenerate), colorReset)
+                // Going back to a turn drops it and the turns after it, and the message typed next opens it again
+                rewind := func(number int) turnStart {
+                    start := turns[number-1]
+                    sharedHistory = sharedHistory[:start.shared]
+                    userMessages = userMessages[:start.users]
+                    kept := conversationLog.String()[:start.log]
+                    conversationLog.Reset()
+                    conversationLog.WriteString(kept)
+                    turns = turns[:number-1]
+                    currentTurn = number - 1
+                    return start
+                }
+                for {
+                    newMessage, err := readChatMessage()
+                    if errors.Is(err, term.ErrRegenerate) {
+                        if len(turns) == 0 {
+                            fmt.Printf("%sThere is no turn to answer again: type the message to continue from%s\n", palette.Muted, colorReset)
+                            continue
+                        }
+                        // The last turn is played again from the same message
+                        start := rewind(len(turns))
+                        currentMessage = start.message
+                        fmt.Printf("\n%s🔁 The agents answer again: %s%s\n", palette.Accent, start.message, colorReset)
+                        break
+                    }
+                    if err != nil {
+                        return fmt.Errorf("error reading input: %v", err)
+                    }
+
+                    // Trim whitespace and update current message
+                    currentMessage = strings.TrimSpace(newMessage)
+                    fields := strings.Fields(currentMessage)
+                    if len(fields) == 0 || fields[0] != "/rewind" {
+                        break
+                    }
+
+                    if len(fields) != 2 {
+                        printTurns(turns)
+                        continue
+                    }
+                    number, err := strconv.Atoi(fields[1])
+                    if err != nil || number < 1 || number > len(turns) {
+                        fmt.Printf("%sThere is no turn %s: use a number from 1 to %d%s\n", palette.Error, fields[1], len(turns), colorReset)
+                        continue
+                    }
+                    start := rewind(number)
+                    fmt.Printf("\n%s⏪ Back to turn %d, which started with: %s%s\n", palette.Accent, number, start.message, colorReset)
+                    fmt.Printf("%sType the message to continue from there:%s\n", inputPromptColor, colorReset)
+                }
+                if currentMessage == "" {
+                    fmt.Printf("\n%sConversation ended after %s%s\n",
+                        elapsedTimeColor,
+                        formatElapsedTime(state.startTime, time.Now()),
+                        colorReset)
+                    if config.SaveFile != "" {
+                        if err := saveConversationLog(config.SaveFile, conversationLog.String()); err != nil {
+                            fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
+                        } else {
+                            fmt.Printf("Conversation log saved to: %s\n", config.SaveFile)
+                        }
+                    }
+                    rememberUserFacts(userMessages)
+                    for _, agent := range agentConfigs {
+                        summarizeSession(agent, conversationLog.String())
+                    }
+                    return nil
+                }
+
+                // Update conversation log
+                turns = append(turns, turnStart{
+                    message: currentMessage,
+                    shared:  len(sharedHistory),
+                    log:     conversationLog.Len(),
+                    users:   len(userMessages),
+                })
+                conversationLog.WriteString(formatUserLabel() + currentMessage + "\n")
+                userMessages = append(userMessages, currentMessage)
+                
+                // Add user message to history
+                history := append(histories[i], Message{
+                    Role:    "user",
+                    Content: currentMessage,
+                })
+                
+                // Update history for this agent
+                histories[i] = history
+                
+                fmt.Println()  // Single blank line after user input
+                
+                currentTurn++
+            }
+        }
+    }
+}
+
+// turnStart is the state of an interactive conversation before a turn, restored by /rewind
+type turnStart struct {
+    message string // The user's message opening the turn
+    shared  int    // Messages in the shared history before it
+    log     int    // Length of the conversation log before it
+    users   int    // Messages from the user before it
+}
+
+// printTurns lists the turns of a conversation with the message each started with, for /rewind
+func printTurns(turns []turnStart) {
+    palette := theme.Current()
+    fmt.Printf("%sGo back to a turn with /rewind <turn>:%s\n", palette.Muted, colorReset)
+    for i, turn := range turns {
+        message := strings.ReplaceAll(turn.message, "\n", " ")
+        if runes := []rune(message); len(runes) > 60 {
+            message = string(runes[:57]) + "..."
+        }
+        fmt.Printf("  %s%d.%s %s\n", palette.Accent, i+1, colorReset, message)
+    }
+}
+
+// withBriefing adds the scenario role of the agent at index i to its system message
+func withBriefing(system string, briefings []string, i int) string {
+    if i >= len(briefings) || briefings[i] == "" {
+        return system
+    }
+    return system + "\n\n" + briefings[i]
+}
+
+// scenarioOutcome asks the model whether the conversation has reached one of the scenario's
+// win conditions, returning the one it has or "" while the scenario goes on
+func scenarioOutcome(conditions []string, history []Message) (string, error) {
+    var transcript strings.Builder
+    for _, message := range history {
+        if message.Role == "user" {
+            transcript.WriteString("User: ")
+        }
+        transcript.WriteString(message.Content + "\n\n")
+    }
+    reply, err := generateText(scenario.JudgeInstructions(conditions), transcript.String())
+    if err != nil {
+        return "", err
+    }
+    outcome, _ := scenario.ParseOutcome(reply, conditions)
+    return outcome, nil
+}
+
+// summarizeSoFar writes a short summary of an auto conversation after a turn, in a block of its
+// own. A facilitator writes it in their own voice, otherwise the model sums it up plainly
+func summarizeSoFar(participants []agents.AgentConfig, facilitator *agents.AgentConfig, history []Message, turn int) (string, error) {
+    names := make([]string, len(participants))
+    for i, agent := range participants {
+        names[i] = agent.Name
+    }
+    instructions := fmt.Sprintf("You are the facilitator of a conversation between %s. Write a short summary of the conversation so far: the main point each participant made, where they agree and disagree, and the open questions. Use at most five bullet points and 120 words. Write the summary only, without a greeting or a title.",
+        strings.Join(names, ", "))
+    var transcript strings.Builder
+    for _, message := range history {
+        if message.Role == "user" {
+            transcript.WriteString("User: ")
+        }
+        transcript.WriteString(message.Content + "\n\n")
+    }
+
+    palette := theme.Current()
+    fmt.Printf("%s%s%s\n", palette.Accent, strings.Repeat("═", 60), colorReset)
+    fmt.Printf("%s📋 Summary so far%s %s(after turn %d)%s\n", palette.Accent, colorReset, palette.Muted, turn, colorReset)
+    fmt.Printf("%s%s%s\n\n", palette.Accent, strings.Repeat("═", 60), colorReset)
+
+    if facilitator != nil {
+        return agentTurn(*facilitator, []Message{
+            {Role: "system", Content: buildSystemMessage(*facilitator, true, "") + "\n\n" + instructions},
+            {Role: "user", Content: transcript.String()},
+        })
+    }
+    fmt.Print(colorize("Summarizing...", palette.Muted))
+    summary, err := generateText(instructions, transcript.String())
+    fmt.Print("\r\033[K")
+    if err != nil {
+        return "", err
+    }
+    fmt.Printf("%s\n\n", summary)
+    return summary, nil
+}
+
+// compressHistory replaces the messages a summary covers with the summary, keeping the attached
+// material, the topic and the last keep replies so the agents carry on from where they were
+func compressHistory(history []Message, summary string, hasReference bool, keep int) []Message {
+    head := 1 // The topic
+    if hasReference {
+        head = 2
+    }
+    if len(history) <= head+keep {
+        return history
+    }
+    compressed := append([]Message(nil), history[:head]...)
+    compressed = append(compressed, Message{Role: "user", Content: "Summary of the conversation so far:\n" + summary})
+    return append(compressed, history[len(history)-keep:]...)
+}
+
+// modeOptions are the options of a --mode command
+type modeOptions struct {
+    subject     string // From --topic, --topic-file or the plain arguments
+    questions   int
+    ideas       int
+    quizEvery   int
+    chapters    int
+    notes       string   // Notes file of a standup
+    gitDirs     []string // Repositories of a standup
+    since       string
+    saveFile    string
+    attachments attachmentOptions
+}
+
+// parseModeArgs reads the options following --with for a --mode command
+func parseModeArgs(args []string) (modeOptions, error) {
+    var options modeOptions
+    var words []string
+    value := func(i int) (string, error) {
+        if i+1 >= len(args) {
+            return "", fmt.Errorf("%s argument is missing", args[i])
+        }
+        return args[i+1], nil
+    }
+    for i := 0; i < len(args); i++ {
+        var err error
+        switch args[i] {
+        case "--topic":
+            options.subject, err = value(i)
+            i++
+        case "--topic-file":
+            var path string
+            if path, err = value(i); err == nil {
+                options.subject, err = readStarterFile(path)
+            }
+            i++
+        case "--questions":
+            var count string
+            if count, err = value(i); err == nil {
+                options.questions, err = strconv.Atoi(count)
+                if err != nil || options.questions < 1 {
+                    err = fmt.Errorf("--questions must be a positive number, not '%s'", count)
+                }
+            }
+            i++
+        case "--ideas":
+            var count string
+            if count, err = value(i); err == nil {
+                options.ideas, err = strconv.Atoi(count)
+                if err != nil || options.ideas < 1 {
+                    err = fmt.Errorf("--ideas must be a positive number, not '%s'", count)
+                }
+            }
+            i++
+        case "--quiz-every":
+            var count string
+            if count, err = value(i); err == nil {
+                options.quizEvery, err = strconv.Atoi(count)
+                if err != nil || options.quizEvery < 1 {
+                    err = fmt.Errorf("--quiz-every must be a positive number, not '%s'", count)
+                }
+            }
+            i++
+        case "--chapters":
+            var count string
+            if count, err = value(i); err == nil {
+                options.chapters, err = strconv.Atoi(count)
+                if err != nil || options.chapters < 1 {
+                    err = fmt.Errorf("--chapters must be a positive number, not '%s'", count)
+                }
+            }
+            i++
+        case "--notes":
+            options.notes, err = value(i)
+            i++
+        case "--git":
+            var dir string
+            dir, err = value(i)
+            options.gitDirs = append(options.gitDirs, dir)
+            i++
+        case "--since":
+            options.since, err = value(i)
+            i++
+        case "--save":
+            options.saveFile, err = value(i)
+            i++
+        case "--url":
+            var url string
+            url, err = value(i)
+            options.attachments.urls = append(options.attachments.urls, url)
+            i++
+        case "--file":
+            var path string
+            path, err = value(i)
+            options.attachments.files = append(options.attachments.files, path)
+            i++
+        case "--ocr":
+            options.attachments.ocr = true
+        default:
+            if strings.HasPrefix(args[i], "--") {
+                return options, fmt.Errorf("%s can't be used with --mode", args[i])
+            }
+            words = append(words, args[i])
+        }
+        if err != nil {
+            return options, err
+        }
+    }
+    if len(words) > 0 {
+        if options.subject != "" {
+            return options, fmt.Errorf("cannot use both a message and --topic or --topic-file")
+        }
+        options.subject = strings.Join(words, " ")
+    }
+    options.subject = strings.TrimSpace(options.subject)
+    return options, nil
+}
+
+// handleModeCommand starts a chat in a structured mode with the agents given to --with
+func handleModeCommand(name string, agentNames []string, args []string) error {
+    mode, err := modes.Lookup(name)
+    if err != nil {
+        return err
+    }
+    for _, agentName := range agentNames {
+        if !agents.IsValidAgent(agentName) {
+            return failure.New(failure.InvalidAgent, "invalid agent name: %s", agentName)
+        }
+    }
+    options, err := parseModeArgs(args)
+    if err != nil {
+        return err
+    }
+    if options.questions != 0 && mode.Name != modes.Interview {
+        return fmt.Errorf("--questions only applies to --mode %s", modes.Interview)
+    }
+    if options.ideas != 0 && mode.Name != modes.Brainstorm {
+        return fmt.Errorf("--ideas only applies to --mode %s", modes.Brainstorm)
+    }
+    if options.quizEvery != 0 && mode.Name != modes.Tutor {
+        return fmt.Errorf("--quiz-every only applies to --mode %s", modes.Tutor)
+    }
+    if options.chapters != 0 && mode.Name != modes.Story {
+        return fmt.Errorf("--chapters only applies to --mode %s", modes.Story)
+    }
+    if (options.notes != "" || len(options.gitDirs) > 0 || options.since != "") && mode.Name != modes.Standup {
+        return fmt.Errorf("--notes, --git and --since only apply to --mode %s", modes.Standup)
+    }
+    reference, err := loadAttachments(options.attachments)
+    if err != nil {
+        return err
+    }
+
+    switch mode.Name {
+    case modes.Interview:
+        if len(agentNames) > 2 {
+            return fmt.Errorf("an interview takes an interviewer and at most one interviewee agent, not %d agents", len(agentNames))
+        }
+        config := InterviewConfig{
+            Interviewer: agentNames[0],
+            Subject:     options.subject,
+            Questions:   options.questions,
+            SaveFile:    options.saveFile,
+            Reference:   reference,
+        }
+        if len(agentNames) == 2 {
+            config.Interviewee = agentNames[1]
+        }
+        return handleInterview(config)
+    case modes.GameMaster:
+        if len(agentNames) > 1 {
+            return fmt.Errorf("a game takes a single game master agent, not %d agents", len(agentNames))
+        }
+        return handleGameMaster(GameMasterConfig{
+            GameMaster: agentNames[0],
+            Campaign:   options.subject,
+            SaveFile:   options.saveFile,
+            Reference:  reference,
+        })
+    case modes.Tutor:
+        if len(agentNames) > 1 {
+            return fmt.Errorf("a lesson takes a single tutor agent, not %d agents", len(agentNames))
+        }
+        return handleTutor(TutorConfig{
+            Tutor:     agentNames[0],
+            Topic:     options.subject,
+            QuizEvery: options.quizEvery,
+            SaveFile:  options.saveFile,
+            Reference: reference,
+        })
+    case modes.Standup:
+        if len(agentNames) > 1 {
+            return fmt.Errorf("a standup is written by a single agent, not %d agents", len(agentNames))
+        }
+        return handleStandup(StandupConfig{
+            Agent:        agentNames[0],
+            Project:      options.subject,
+            Notes:        options.notes,
+            Repositories: options.gitDirs,
+            Since:        options.since,
+            SaveFile:     options.saveFile,
+            Reference:    reference,
+        })
+    case modes.Story:
+        return handleStory(StoryConfig{
+            Agents:    agentNames,
+            Title:     options.subject,
+            Chapters:  options.chapters,
+            SaveFile:  options.saveFile,
+            Reference: reference,
+        })
+    case modes.Brainstorm:
+        return handleBrainstorm(BrainstormConfig{
+            Agents:    agentNames,
+            Topic:     options.subject,
+            Ideas:     options.ideas,
+            SaveFile:  options.saveFile,
+            Reference: reference,
+        })
+    }
+    return nil
+}
+
+// stdin is read by everything asking the user for input, so input read ahead for one question
+// isn't lost to the next
+var stdin = bufio.NewReader(os.Stdin)
+
+// inputEditor edits the messages typed in interactive chats
+var inputEditor *term.LineEditor
+
+const (
+    inputHistoryFile = "input_history" // Messages typed in interactive chats, recalled with ↑
+    maxInputHistory  = 1000
+)
+
+// readUserInput shows the user's label and reads the message typed after it with the line
+// editor. Ctrl+C exits like it does anywhere else
+func readUserInput() (string, error) {
+    return readInput(lineEditor().ReadLine)
+}
+
+// readChatMessage reads a message like readUserInput, returning term.ErrRegenerate when the
+// user asks for the last message to be answered again
+func readChatMessage() (string, error) {
+    return readInput(lineEditor().ReadMessage)
+}
+
+// readInput reads the user's message with read, after their label
+func readInput(read func(prompt string) (string, error)) (string, error) {
+    line, err := read(colorize(formatUserLabel(), theme.Current().User))
+    if errors.Is(err, term.ErrInterrupted) {
+        signals <- os.Interrupt
+        select {}
+    }
+    return line, err
+}
+
+// lineEditor returns the line editor of interactive chats, with the messages typed before
+func lineEditor() *term.LineEditor {
+    if inputEditor == nil {
+        var history *term.History
+        if path, err := appdir.DataPath(inputHistoryFile); err == nil {
+            history = term.LoadHistory(path, maxInputHistory)
+        }
+        inputEditor = term.NewLineEditor(os.Stdin, os.Stdout, stdin, history)
+    }
+    return inputEditor
+}
+
+// readSubject asks the user what a structured chat is about, empty when they answer nothing
+func readSubject(reader *bufio.Reader, question string) (string, error) {
+    fmt.Print("\n" + question + " ")
+    line, err := reader.ReadString('\n')
+    if err != nil && line == "" {
+        return "", fmt.Errorf("error reading input: %v", err)
+    }
+    return strings.TrimSpace(line), nil
+}
+
+// InterviewConfig is an interview started with --mode interview
+type InterviewConfig struct {
+    Interviewer string
+    Interviewee string // Agent answering the questions, empty when the user does
+    Subject     string // Position or subject the interview is for
+    Questions   int    // 0 means modes.DefaultQuestions
+    SaveFile    string
+    Reference   string // Attached material, like a resume, shared with the interviewer
+}
+
+// handleInterview runs an interview: the interviewer asks one question a turn, the user or the
+// interviewee agent answers it, and once the questions are answered the interviewer evaluates
+// the answers. The user can end it early with an empty answer
+func handleInterview(config InterviewConfig) error {
+    interviewer := agents.GetAgentConfig(config.Interviewer)
+    participants := []agents.AgentConfig{interviewer}
+    var interviewee *agents.AgentConfig
+    if config.Interviewee != "" {
+        agent := agents.GetAgentConfig(config.Interviewee)
+        if strings.EqualFold(agent.Name, interviewer.Name) {
+            return fmt.Errorf("%s can't interview themselves", agent.Name)
+        }
+        interviewee = &agent
+        participants = append(participants, agent)
+        // Nobody is there to approve tool calls while the agents talk among themselves
+        unattended = true
+    }
+    if config.Questions == 0 {
+        config.Questions = modes.DefaultQuestions
+    }
+
+    reader := stdin
+    if config.Subject == "" {
+        if interviewee != nil {
+            return fmt.Errorf("an interview between agents needs a subject, e.g. chatty --with \"%s,%s\" --mode interview \"Senior Go developer\"",
+                interviewer.Name, interviewee.Name)
+        }
+        subject, err := readSubject(reader, "What is the interview for? (e.g. Senior Go developer):")
+        if err != nil {
+            return err
+        }
+        config.Subject = subject
+        if config.Subject == "" {
+            fmt.Println("Interview cancelled.")
+            return nil
+        }
+    }
+    if config.SaveFile == "" {
+        config.SaveFile = autoSavePath(participants...)
+    }
+
+    palette := theme.Current()
+    candidateName := "You"
+    if interviewee != nil {
+        candidateName = theme.AgentEmoji(interviewee.Emoji, interviewee.Name) + " " + interviewee.Name
+    }
+    fmt.Printf("\n%s🎤 Interview for %s%s\n", palette.Heading, config.Subject, colorReset)
+    fmt.Printf("%sInterviewer:%s %s %s\n", palette.Label, colorReset, theme.AgentEmoji(interviewer.Emoji, interviewer.Name), interviewer.Name)
+    fmt.Printf("%sCandidate:%s %s\n", palette.Label, colorReset, candidateName)
+    fmt.Printf("%sQuestions:%s %d\n", palette.Label, colorReset, config.Questions)
+    if interviewee == nil {
+        fmt.Printf("%s[Press Enter with an empty answer to end the interview early]%s\n", palette.Muted, colorReset)
+    }
+
+    // The interviewer's questions are its own messages and the answers are the user's; the
+    // interviewee agent sees it the other way round
+    interviewerHistory := []Message{{
+        Role:    "system",
+        Content: buildSystemMessage(interviewer, false, "") + "\n\n" + modes.InterviewerGuidelines(config.Subject, config.Questions),
+    }}
+    if config.Reference != "" {
+        interviewerHistory = append(interviewerHistory,
+            Message{Role: "user", Content: config.Reference},
+            Message{Role: "assistant", Content: "I have read it and will keep it in mind during the interview."})
+    }
+    var intervieweeHistory []Message
+    if interviewee != nil {
+        intervieweeHistory = []Message{{
+            Role:    "system",
+            Content: buildSystemMessage(*interviewee, false, "") + "\n\n" + modes.IntervieweeGuidelines(config.Subject, interviewer.Name),
+        }}
+    }
+
+    start := time.Now()
+    ended := func() {
+        fmt.Printf("\n\nInterview ended after %s\n", formatElapsedTime(start, time.Now()))
+        exit(0)
+    }
+    var transcript strings.Builder
+    var userAnswers []string
+    pending := "" // The last answer, which goes to the interviewer with the next request
+    answered := 0
+    for number := 1; number <= config.Questions; number++ {
+        fmt.Printf("\n%s%s%s\n", palette.Section, strings.Repeat("─", 60), colorReset)
+        fmt.Printf("%s❓ Question%s %s%d of %d%s\n", palette.Section, colorReset, palette.Text, number, config.Questions, colorReset)
+        fmt.Printf("%s%s%s\n\n", palette.Section, strings.Repeat("─", 60), colorReset)
+
+        prompt := strings.TrimSpace(pending + "\n\n" + modes.QuestionPrompt(number, config.Questions))
+        pending = ""
+        interviewerHistory = append(interviewerHistory, Message{Role: "user", Content: prompt})
+        question, err := agentTurn(interviewer, interviewerHistory)
+        if errors.Is(err, errInterrupted) {
+            ended()
+        }
+        if err != nil {
+            return fmt.Errorf("error processing response from %s: %w", interviewer.Name, err)
+        }
+        interviewerHistory = append(interviewerHistory, Message{Role: "assistant", Content: question})
+        transcript.WriteString(agentLogEntry(interviewer, question))
+
+        var answer string
+        if interviewee != nil {
+            intervieweeHistory = append(intervieweeHistory, Message{Role: "user", Content: question})
+            answer, err = agentTurn(*interviewee, intervieweeHistory)
+            if errors.Is(err, errInterrupted) {
+                ended()
+            }
+            if err != nil {
+                return fmt.Errorf("error processing response from %s: %w", interviewee.Name, err)
+            }
+            intervieweeHistory = append(intervieweeHistory, Message{Role: "assistant", Content: answer})
+            transcript.WriteString(agentLogEntry(*interviewee, answer))
+        } else {
+            line, err := readUserInput()
+            if err != nil && line == "" && !errors.Is(err, io.EOF) {
+                return fmt.Errorf("error reading input: %v", err)
+            }
+            answer = strings.TrimSpace(line)
+            if answer == "" {
+                break
+            }
+            transcript.WriteString(formatUserLabel() + answer + "\n")
+            userAnswers = append(userAnswers, answer)
+        }
+        answered++
+        pending = answer
+    }
+
+    if answered == 0 {
+        fmt.Println("\nInterview ended before any question was answered.")
+        return nil
+    }
+
+    fmt.Printf("\n%s%s%s\n", palette.Heading, strings.Repeat("═", 60), colorReset)
+    fmt.Printf("%s📝 Evaluation%s\n", palette.Heading, colorReset)
+    fmt.Printf("%s%s%s\n\n", palette.Heading, strings.Repeat("═", 60), colorReset)
+    interviewerHistory = append(interviewerHistory, Message{
+        Role:    "user",
+        Content: strings.TrimSpace(pending + "\n\n" + modes.EvaluationPrompt(config.Subject, answered)),
+    })
+    evaluation, err := agentTurn(interviewer, interviewerHistory)
+    if errors.Is(err, errInterrupted) {
+        ended()
+    }
+    if err != nil {
+        return fmt.Errorf("error processing response from %s: %w", interviewer.Name, err)
+    }
+    transcript.WriteString("\n📝 Evaluation\n" + agentLogEntry(interviewer, evaluation))
+
+    fmt.Printf("%sInterview ended after %s%s\n", palette.Heading, formatElapsedTime(start, time.Now()), colorReset)
+    if config.SaveFile != "" {
+        if err := saveConversationLog(config.SaveFile, transcript.String()); err != nil {
+            fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
+        } else {
+            fmt.Printf("Conversation log saved to: %s\n", config.SaveFile)
+        }
+    }
+    rememberUserFacts(userAnswers)
+    for _, agent := range participants {
+        summarizeSession(agent, transcript.String())
+    }
+    return nil
+}
+
+// agentTurn streams an agent's next message in a structured chat
+func agentTurn(agent agents.AgentConfig, messages []Message) (string, error) {
+    return agentTurnWithTools(agent, messages, nil)
+}
+
+// agentTurnWithTools streams an agent's next message, offering it the tools available
+func agentTurnWithTools(agent agents.AgentConfig, messages []Message, available []tools.Definition) (string, error) {
+    anim := startConversationAnimation(agent)
+    chatReq := ChatRequest{
+        Model:     agents.GetCurrentModel(),
+        Messages:  messages,
+        Stream:    true,
+        KeepAlive: keepAlive,
+        Tools:     available,
+    }
+    text, err := chatWithTools(chatReq, agent, anim, true)
+    if err != nil {
+        return "", err
+    }
+    fmt.Println()
+    translateResponse(text)
+    speakResponse(agent, text)
+    fmt.Println()
+    return text, nil
+}
+
+// BrainstormConfig is a brainstorm started with --mode brainstorm
+type BrainstormConfig struct {
+    Agents    []string
+    Topic     string
+    Ideas     int    // Ideas each agent contributes, 0 means modes.DefaultIdeas
+    SaveFile  string
+    Reference string // Attached material shared with all agents
+}
+
+// handleBrainstorm runs a brainstorm: each agent suggests ideas on the topic in turn, seeing the
+// ones already suggested, then ranks the ideas of the others, and the ideas are listed by the
+// points the rankings gave them
+func handleBrainstorm(config BrainstormConfig) error {
+    if len(config.Agents) < 2 {
+        return fmt.Errorf("a brainstorm takes at least two agents, e.g. chatty --with \"Tesla,Edison\" --mode brainstorm \"<topic>\"")
+    }
+    participants := make([]agents.AgentConfig, 0, len(config.Agents))
+    seen := make(map[string]bool)
+    for _, name := range config.Agents {
+        agent := agents.GetAgentConfig(name)
+        if seen[agent.Name] {
+            return fmt.Errorf("duplicate agent detected: %s (each agent can only be included once)", agent.Name)
+        }
+        seen[agent.Name] = true
+        participants = append(participants, agent)
+    }
+    if config.Ideas == 0 {
+        config.Ideas = modes.DefaultIdeas
+    }
+    if config.Topic == "" {
+        topic, err := readSubject(stdin, "What should the agents brainstorm about?")
+        if err != nil {
+            return err
+        }
+        if topic == "" {
+            fmt.Println("Brainstorm cancelled.")
+            return nil
+        }
+        config.Topic = topic
+    }
+    if config.SaveFile == "" {
+        config.SaveFile = autoSavePath(participants...)
+    }
+    // Nobody is there to approve tool calls while the agents work among themselves
+    unattended = true
+
+    palette := theme.Current()
+    fmt.Printf("\n%s💡 Brainstorm: %s%s\n", palette.Heading, config.Topic, colorReset)
+    fmt.Println("Participants:")
+    for i, agent := range participants {
+        fmt.Printf("%d. %s %s - %s\n", i+1, theme.AgentEmoji(agent.Emoji, agent.Name), agent.Name, agent.Description)
+    }
+
+    start := time.Now()
+    var transcript strings.Builder
+    transcript.WriteString(formatUserLabel() + config.Topic + "\n")
+    turn := func(i int, prompt string) (string, error) {
+        agent := participants[i]
+        messages := []Message{{
+            Role:    "system",
+            Content: buildSystemMessage(agent, true, describeParticipants(participants, i, false)) + "\n\n" + modes.BrainstormGuidelines(),
+        }}
+        if config.Reference != "" {
+            messages = append(messages, Message{Role: "user", Content: config.Reference})
+        }
+        messages = append(messages, Message{Role: "user", Content: prompt})
+        text, err := agentTurn(agent, messages)
+        if errors.Is(err, errInterrupted) {
+            fmt.Printf("\n\nBrainstorm ended after %s\n", formatElapsedTime(start, time.Now()))
+            exit(0)
+        }
+        if err != nil {
+            return "", fmt.Errorf("error processing response from %s: %w", agent.Name, err)
+        }
+        transcript.WriteString(agentLogEntry(agent, text))
+        return text, nil
+    }
+    phase := func(title string) {
+        fmt.Printf("\n%s%s%s\n", palette.Section, strings.Repeat("─", 60), colorReset)
+        fmt.Printf("%s%s%s\n", palette.Section, title, colorReset)
+        fmt.Printf("%s%s%s\n\n", palette.Section, strings.Repeat("─", 60), colorReset)
+        transcript.WriteString("\n" + title + "\n")
+    }
+
+    // Each agent sees the ideas before its own, so they don't repeat
+    phase("💡 Ideas")
+    var ideas []modes.Idea
+    for i, agent := range participants {
+        text, err := turn(i, modes.IdeasPrompt(config.Topic, config.Ideas, ideas))
+        if err != nil {
+            return err
+        }
+        for _, idea := range modes.ParseIdeas(text, config.Ideas) {
+            ideas = append(ideas, modes.Idea{Text: idea, Author: agent.Name})
+        }
+    }
+
+    phase("🗳️ Voting")
+    for i, agent := range participants {
+        own := make(map[int]bool)
+        for index, idea := range ideas {
+            if idea.Author == agent.Name {
+                own[index] = true
+            }
+        }
+        picks := modes.Picks(len(ideas) - len(own))
+        if picks == 0 {
+            continue
+        }
+        text, err := turn(i, modes.VotePrompt(config.Topic, ideas, agent.Name, picks))
+        if err != nil {
+            return err
+        }
+        ranked := modes.ParseVotes(text, len(ideas), picks, own)
+        if len(ranked) == 0 {
+            fmt.Printf("%s⚠️ No valid votes found in %s's ballot%s\n\n", palette.Muted, agent.Name, colorReset)
+        }
+        modes.Tally(ideas, ranked, picks)
+    }
+
+    fmt.Printf("\n%s%s%s\n", palette.Heading, strings.Repeat("═", 60), colorReset)
+    fmt.Printf("%s🏆 Ranked Ideas%s\n", palette.Heading, colorReset)
+    fmt.Printf("%s%s%s\n\n", palette.Heading, strings.Repeat("═", 60), colorReset)
+    transcript.WriteString("\n🏆 Ranked Ideas\n")
+    for place, idea := range modes.Rank(ideas) {
+        votes := "votes"
+        if idea.Votes == 1 {
+            votes = "vote"
+        }
+        fmt.Printf("%s%2d.%s %s\n", palette.Accent, place+1, colorReset, idea.Text)
+        fmt.Printf("    %s%s · %d points from %d %s%s\n", palette.Muted, idea.Author, idea.Points, idea.Votes, votes, colorReset)
+        transcript.WriteString(fmt.Sprintf("%d. %s (%s, %d points from %d %s)\n", place+1, idea.Text, idea.Author, idea.Points, idea.Votes, votes))
+    }
+
+    fmt.Printf("\n%sBrainstorm ended after %s%s\n", palette.Heading, formatElapsedTime(start, time.Now()), colorReset)
+    if config.SaveFile != "" {
+        if err := saveConversationLog(config.SaveFile, transcript.String()); err != nil {
+            fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
+        } else {
+            fmt.Printf("Conversation log saved to: %s\n", config.SaveFile)
+        }
+    }
+    for _, agent := range participants {
+        summarizeSession(agent, transcript.String())
+    }
+    return nil
+}
+
+// GameMasterConfig is a role-playing session started with --mode gm
+type GameMasterConfig struct {
+    GameMaster string
+    Campaign   string // Name of the campaign, continued when it was played before
+    SaveFile   string
+    Reference  string // Attached material, like house rules or a character sheet
+}
+
+// handleGameMaster runs a session of a campaign: the game master narrates, rolls dice and saves
+// the scene, inventory and notes as they change, and the user says what they do. An empty
+// message ends the session, which is summed up for the next one
+func handleGameMaster(config GameMasterConfig) error {
+    gm := agents.GetAgentConfig(config.GameMaster)
+    reader := stdin
+    if config.Campaign == "" {
+        if names, err := campaign.List(); err == nil && len(names) > 0 {
+            fmt.Printf("\nSaved campaigns: %s\n", strings.Join(names, ", "))
+        }
+        name, err := readSubject(reader, "Which campaign? (a new name starts one):")
+        if err != nil {
+            return err
+        }
+        if name == "" {
+            fmt.Println("Session cancelled.")
+            return nil
+        }
+        config.Campaign = name
+    }
+    state, err := campaign.Load(config.Campaign)
+    if err != nil {
+        return err
+    }
+    resumed := !state.New()
+    if config.SaveFile == "" {
+        config.SaveFile = autoSavePath(gm)
+    }
+
+    // The game tools are the game master's even when its tools are limited or turned off
+    var available []tools.Definition
+    for _, tool := range campaign.Tools(state) {
+        tools.Register(tool)
+        if len(gm.Tools) > 0 {
+            gm.Tools = append(gm.Tools, tool.Name)
+        }
+        if !toolsEnabled {
+            available = append(available, tool.Definition())
+        }
+    }
+    if toolsEnabled {
+        available = availableTools(gm)
+    }
+
+    palette := theme.Current()
+    fmt.Printf("\n%s🎲 %s%s\n", palette.Heading, state.Name, colorReset)
+    fmt.Printf("%sGame master:%s %s %s\n", palette.Label, colorReset, theme.AgentEmoji(gm.Emoji, gm.Name), gm.Name)
+    fmt.Printf("%sSession:%s %d\n", palette.Label, colorReset, state.Sessions+1)
+    if resumed {
+        fmt.Printf("\n%s%s%s\n", palette.Muted, state.Describe(), colorReset)
+    }
+    fmt.Printf("%s[Type /roll 1d20+2 to roll yourself, /state to see the game, or press Enter with an empty message to end the session]%s\n",
+        palette.Muted, colorReset)
+
+    history := []Message{{Role: "system"}}
+    if config.Reference != "" {
+        history = append(history,
+            Message{Role: "user", Content: config.Reference},
+            Message{Role: "assistant", Content: "I have read it and will keep it in mind during the game."})
+    }
+
+    start := time.Now()
+    var transcript strings.Builder
+    var userMessages []string
+    message := modes.SessionPrompt(resumed)
+    for {
+        // The game state the game master sees follows the changes it saved
+        history[0].Content = buildSystemMessage(gm, false, "") + "\n\n" + modes.GameMasterGuidelines(state.Name, state.Describe(), state.Recap)
+        history = append(history, Message{Role: "user", Content: message})
+        fmt.Println()
+        reply, err := agentTurnWithTools(gm, history, available)
+        if errors.Is(err, errInterrupted) {
+            fmt.Printf("\n\nSession ended after %s\n", formatElapsedTime(start, time.Now()))
+            exit(0)
+        }
+        if err != nil {
+            return fmt.Errorf("error processing response from %s: %w", gm.Name, err)
+        }
+        history = append(history, Message{Role: "assistant", Content: reply})
+        transcript.WriteString(agentLogEntry(gm, reply))
+
+        message = ""
+        for message == "" {
+            line, err := readUserInput()
+            if err != nil && line == "" && !errors.Is(err, io.EOF) {
+                return fmt.Errorf("error reading input: %v", err)
+            }
+            line = strings.TrimSpace(line)
+            switch {
+            case line == "":
+                return endGameSession(gm, state, config.SaveFile, transcript.String(), userMessages, start)
+            case line == "/state":
+                fmt.Printf("%s%s%s\n", palette.Muted, state.Describe(), colorReset)
+            case strings.HasPrefix(line, "/roll"):
+                roll, err := campaign.RollDice(strings.TrimSpace(strings.TrimPrefix(line, "/roll")))
+                if err != nil {
+                    fmt.Printf("%sError: %v%s\n", palette.Error, err, colorReset)
+                    continue
+                }
+                fmt.Printf("%s🎲 %s%s\n", palette.Accent, roll, colorReset)
+                message = "I rolled " + roll.String()
+            default:
+                message = line
+                userMessages = append(userMessages, line)
+            }
+        }
+        transcript.WriteString(formatUserLabel() + message + "\n")
+    }
+}
+
+// endGameSession saves the transcript and the recap of the session the next one starts from
+func endGameSession(gm agents.AgentConfig, state *campaign.State, saveFile, transcript string, userMessages []string, start time.Time) error {
+    palette := theme.Current()
+    fmt.Printf("\n%sSession ended after %s%s\n", palette.Heading, formatElapsedTime(start, time.Now()), colorReset)
+    if saveFile != "" {
+        if err := saveConversationLog(saveFile, transcript); err != nil {
+            fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
+        } else {
+            fmt.Printf("Conversation log saved to: %s\n", saveFile)
+        }
+    }
+
+    fmt.Print(colorize("Saving the campaign...", palette.Muted))
+    recap, err := generateText(modes.RecapInstructions(state.Name, state.Recap), transcript)
+    fmt.Print("\r\033[K")
+    if err != nil {
+        fmt.Printf("⚠️ Warning: Failed to write the recap of the session: %v\n", err)
+    } else {
+        state.Recap = recap
+    }
+    state.Sessions++
+    if err := state.Save(); err != nil {
+        return err
+    }
+    fmt.Printf("%sCampaign saved. Continue it with:%s chatty --with \"%s\" --mode gm \"%s\"\n",
+        palette.Success, colorReset, gm.Name, state.Name)
+
+    rememberUserFacts(userMessages)
+    summarizeSession(gm, transcript)
+    return nil
+}
+
+// TutorConfig is a lesson started with --mode tutor
+type TutorConfig struct {
+    Tutor     string
+    Topic     string
+    QuizEvery int    // Answers between quizzes, 0 means modes.DefaultQuizEvery
+    SaveFile  string
+    Reference string // Attached material, like course notes, shared with the tutor
+}
+
+// handleTutor runs a lesson: the tutor plans the steps of the topic, then leads the user through
+// them with questions, moving on once their answers show they understand a step and quizzing
+// them every few answers. An empty message ends the lesson
+func handleTutor(config TutorConfig) error {
+    tutor := agents.GetAgentConfig(config.Tutor)
+    if config.QuizEvery == 0 {
+        config.QuizEvery = modes.DefaultQuizEvery
+    }
+    reader := stdin
+    if config.Topic == "" {
+        topic, err := readSubject(reader, "What would you like to learn?")
+        if err != nil {
+            return err
+        }
+        if topic == "" {
+            fmt.Println("Lesson cancelled.")
+            return nil
+        }
+        config.Topic = topic
+    }
+    if config.SaveFile == "" {
+        config.SaveFile = autoSavePath(tutor)
+    }
+
+    palette := theme.Current()
+    fmt.Print(colorize("\nPlanning the lesson...", palette.Muted))
+    plan, err := generateText(modes.PlanInstructions(), strings.TrimSpace(config.Topic+"\n\n"+config.Reference))
+    fmt.Print("\r\033[K")
+    if err != nil {
+        return fmt.Errorf("failed to plan the lesson: %v", err)
+    }
+    lesson := modes.NewLesson(config.Topic, plan)
+
+    fmt.Printf("\n%s🎓 Lesson: %s%s\n", palette.Heading, config.Topic, colorReset)
+    fmt.Printf("%sTutor:%s %s %s\n", palette.Label, colorReset, theme.AgentEmoji(tutor.Emoji, tutor.Name), tutor.Name)
+    fmt.Printf("%sPlan:%s\n%s\n", palette.Label, colorReset, lesson.Progress())
+    fmt.Printf("%s[Type /plan to see your progress, or press Enter with an empty message to end the lesson]%s\n", palette.Muted, colorReset)
+
+    history := []Message{{Role: "system"}}
+    if config.Reference != "" {
+        history = append(history,
+            Message{Role: "user", Content: config.Reference},
+            Message{Role: "assistant", Content: "I have read it and will use it in the lesson."})
+    }
+
+    start := time.Now()
+    var transcript strings.Builder
+    var userMessages []string
+    message := fmt.Sprintf("I'd like to learn about %s. Let's start with the first step.", config.Topic)
+    sinceQuiz := 0      // Answers since the last quiz
+    quizzing := false // The user's next message answers a quiz
+    for {
+        // The guidelines follow the lesson to its current step
+        history[0].Content = buildSystemMessage(tutor, false, "") + "\n\n" + lesson.TutorGuidelines()
+        history = append(history, Message{Role: "user", Content: message})
+        fmt.Println()
+        reply, err := agentTurn(tutor, history)
+        if errors.Is(err, errInterrupted) {
+            fmt.Printf("\n\nLesson ended after %s\n", formatElapsedTime(start, time.Now()))
+            exit(0)
+        }
+        if err != nil {
+            return fmt.Errorf("error processing response from %s: %w", tutor.Name, err)
+        }
+        history = append(history, Message{Role: "assistant", Content: reply})
+        transcript.WriteString(agentLogEntry(tutor, reply))
+
+        var line string
+        for line == "" {
+            input, err := readUserInput()
+            if err != nil && input == "" && !errors.Is(err, io.EOF) {
+                return fmt.Errorf("error reading input: %v", err)
+            }
+            input = strings.TrimSpace(input)
+            switch input {
+            case "":
+                return endLesson(tutor, lesson, config.SaveFile, transcript.String(), userMessages, start)
+            case "/plan":
+                fmt.Printf("%s%s%s\n", palette.Muted, lesson.Progress(), colorReset)
+            default:
+                line = input
+            }
+        }
+        transcript.WriteString(formatUserLabel() + line + "\n")
+        userMessages = append(userMessages, line)
+
+        // The tutor moves on once the user's own answers show they understand the step
+        if !lesson.Finished() {
+            fmt.Print(colorize("Checking your progress...", palette.Muted))
+            verdict, err := generateText(lesson.UnderstoodInstructions(), transcript.String())
+            fmt.Print("\r\033[K")
+            if err != nil {
+                fmt.Printf("⚠️ Warning: Failed to check your progress: %v\n", err)
+            } else if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(verdict)), "YES") {
+                fmt.Printf("%s✅ Step %d done: %s%s\n", palette.Success, lesson.Current+1, lesson.Steps[lesson.Current], colorReset)
+                transcript.WriteString(fmt.Sprintf("\n✅ Step %d done: %s\n\n", lesson.Current+1, lesson.Steps[lesson.Current]))
+                lesson.Advance()
+            }
+        }
+
+        switch {
+        case quizzing:
+            message = modes.QuizAnswerPrompt(line)
+            quizzing = false
+        case sinceQuiz+1 == config.QuizEvery:
+            fmt.Printf("%s📝 Quiz time%s\n", palette.Accent, colorReset)
+            message = line + "\n\n" + lesson.QuizPrompt()
+            quizzing = true
+            sinceQuiz = 0
+        default:
+            message = line
+            sinceQuiz++
+        }
+    }
+}
+
+// endLesson shows how far the lesson got and saves it
+func endLesson(tutor agents.AgentConfig, lesson *modes.Lesson, saveFile, transcript string, userMessages []string, start time.Time) error {
+    palette := theme.Current()
+    fmt.Printf("\n%s%s%s\n", palette.Heading, strings.Repeat("═", 60), colorReset)
+    fmt.Printf("%s📚 Lesson progress%s %s(%d of %d steps done)%s\n", palette.Heading, colorReset,
+        palette.Muted, min(lesson.Current, len(lesson.Steps)), len(lesson.Steps), colorReset)
+    fmt.Printf("%s%s%s\n", palette.Heading, strings.Repeat("═", 60), colorReset)
+    fmt.Println(lesson.Progress())
+    transcript += "\n📚 Lesson progress\n" + lesson.Progress() + "\n"
+
+    fmt.Printf("\n%sLesson ended after %s%s\n", palette.Heading, formatElapsedTime(start, time.Now()), colorReset)
+    if saveFile != "" {
+        if err := saveConversationLog(saveFile, transcript); err != nil {
+            fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
+        } else {
+            fmt.Printf("Conversation log saved to: %s\n", saveFile)
+        }
+    }
+    rememberUserFacts(userMessages)
+    summarizeSession(tutor, transcript)
+    return nil
+}
+
+// PipelineConfig is a pipeline of agents started with --pipeline
+type PipelineConfig struct {
+    Stages   []string // Agents in the order they work on the topic
+    Topic    string
+    SaveFile string   // File the final result is saved to
+}
+
+// handlePipeline has each agent of a pipeline work on the output of the one before it, the
+// first on the topic itself, and saves what the last one writes when asked to
+func handlePipeline(config PipelineConfig) error {
+    // The output goes from agent to agent without asking the user anything
+    unattended = true
+
+    palette := theme.Current()
+    fmt.Printf("\n%s🔗 Pipeline: %s%s\n", palette.Heading, strings.Join(config.Stages, " → "), colorReset)
+    fmt.Printf("%sTopic:%s %s\n", palette.Label, colorReset, config.Topic)
+
+    output := ""
+    for i, name := range config.Stages {
+        agent := agents.GetAgentConfig(name)
+        stage := i + 1
+        fmt.Printf("\n%s%s%s\n", palette.Section, strings.Repeat("─", 60), colorReset)
+        fmt.Printf("%s🔗 Stage%s %s%d of %d%s\n", palette.Section, colorReset, palette.Text, stage, len(config.Stages), colorReset)
+        fmt.Printf("%s%s%s\n\n", palette.Section, strings.Repeat("─", 60), colorReset)
+
+        messages := []Message{
+            {Role: "system", Content: buildSystemMessage(agent, false, "") + "\n\n" + pipeline.Guidelines(stage, config.Stages)},
+            {Role: "user", Content: pipeline.StagePrompt(config.Topic, stage, config.Stages, output)},
+        }
+        response, err := agentTurn(agent, messages)
+        if errors.Is(err, errInterrupted) {
+            fmt.Printf("\n\nPipeline stopped at %s, stage %d of %d\n", agent.Name, stage, len(config.Stages))
+            exit(0)
+        }
+        if err != nil {
+            return fmt.Errorf("error processing response from %s: %w", agent.Name, err)
+        }
+        output = strings.TrimSpace(response)
+    }
+
+    if config.SaveFile != "" {
+        if err := saveConversationLog(config.SaveFile, output+"\n"); err != nil {
+            return fmt.Errorf("failed to save the result: %w", err)
+        }
+        fmt.Printf("\nResult saved to: %s\n", config.SaveFile)
+    }
+    return nil
+}
+
+const (
+    // watchPollInterval is how often --watch checks the file for new text, and watchSettle how
+    // long the file has to stop growing before the text goes to the agent, so a burst of lines
+    // is sent at once
+    watchPollInterval = time.Second
+    watchSettle       = 2 * time.Second
+
+    // defaultOnChange is what the agent is asked to do with new text without --on-change
+    defaultOnChange = "Summarize what is new, pointing out any errors or warnings."
+)
+
+// handleWatchCommand follows a file, like a build log, and sends the text added to it to an
+// agent with the instruction given to --on-change, once the file stops growing for a moment.
+// It runs until Ctrl+C
+func handleWatchCommand(args []string) error {
+    const usage = "Usage: chatty --watch <file> [--agent <name>] [--on-change \"instruction\"]"
+    var path, agentName string
+    instruction := defaultOnChange
+    for i := 0; i < len(args); i++ {
+        switch args[i] {
+        case "--agent", "--on-change":
+            if i+1 >= len(args) {
+                return fmt.Errorf("missing value for %s\n\n%s", args[i], usage)
+            }
+            if args[i] == "--agent" {
+                agentName = strings.TrimSpace(args[i+1])
+            } else {
+                instruction = strings.TrimSpace(args[i+1])
+            }
+            i++
+        default:
+            if strings.HasPrefix(args[i], "--") {
+                return fmt.Errorf("unknown option '%s'\n\n%s", args[i], usage)
+            }
+            if path != "" {
+                return fmt.Errorf("too many arguments\n\n%s", usage)
+            }
+            path = args[i]
+        }
+    }
+    if path == "" {
+        return fmt.Errorf("missing file to watch\n\n%s", usage)
+    }
+    if instruction == "" {
+        return fmt.Errorf("--on-change needs an instruction, e.g. \"summarize new errors\"")
+    }
+    if agentName == "" {
+        agentName = defaultAgentName()
+    }
+    if !agents.IsValidAgent(agentName) {
+        return failure.New(failure.InvalidAgent, "agent '%s' not found", agentName)
+    }
+    if err := checkEnabled(agentName); err != nil {
+        return err
+    }
+    agent := agents.GetAgentConfig(agentName)
+    file, err := follow.Open(path)
+    if err != nil {
+        return err
+    }
+
+    // Nobody is there to approve tool calls while the file is watched
+    unattended = true
+
+    palette := theme.Current()
+    fmt.Printf("\n%s👀 Watching %s%s\n", palette.Heading, path, colorReset)
+    fmt.Printf("%sAgent:%s %s %s\n", palette.Label, colorReset, theme.AgentEmoji(agent.Emoji, agent.Name), agent.Name)
+    fmt.Printf("%sOn change:%s %s\n", palette.Label, colorReset, instruction)
+    fmt.Println("Press Ctrl+C to stop")
+
+    var pending string
+    var cut bool
+    var grew time.Time
     for {
-        // Update last active time
-        state.lastActive = time.Now()
+        select {
+        case <-interruptCtx.Done():
+            return nil
+        case <-time.After(watchPollInterval):
+        }
+        text, left, err := file.Read()
+        if err != nil {
+            return fmt.Errorf("can't read %s: %v", path, err)
+        }
+        if text != "" {
+            pending += text
+            cut = cut || left
+            if len(pending) > follow.MaxRead {
+                pending, cut = follow.Tail(pending, follow.MaxRead), true
+            }
+            grew = time.Now()
+            continue
+        }
+        if strings.TrimSpace(pending) == "" || time.Since(grew) < watchSettle {
+            continue
+        }
+
+        fmt.Printf("\n%s%s%s\n", palette.Section, strings.Repeat("─", 60), colorReset)
+        fmt.Printf("%s📄 %s changed%s %s%s%s\n\n", palette.Section, path, colorReset, palette.Muted, time.Now().Format("15:04:05"), colorReset)
+        messages := []Message{
+            {Role: "system", Content: buildSystemMessage(agent, false, "")},
+            {Role: "user", Content: watchPrompt(instruction, filepath.Base(path), pending, cut)},
+        }
+        pending, cut = "", false
+        if _, err := agentTurn(agent, messages); err != nil {
+            if errors.Is(err, errInterrupted) {
+                return nil
+            }
+            // The next change may go through, once Ollama is back
+            fmt.Printf("\n%s⚠️ %s couldn't answer: %v%s\n", palette.Error, agent.Name, err, colorReset)
+        }
+    }
+}
+
+// watchPrompt asks an agent to do what --on-change says with the text added to a watched file
+func watchPrompt(instruction, name, text string, cut bool) string {
+    note := ""
+    if cut {
+        note = " (only the last part, as a lot was added)"
+    }
+    return fmt.Sprintf("%s\n\nThis was added to %s%s:\n\n```\n%s\n```", instruction, name, note, strings.TrimRight(text, "\n"))
+}
+
+// PairConfig is a pair-programming session started with --pair
+type PairConfig struct {
+    Agent    string
+    File     string
+    Starter  string // First message, asked for when empty
+    SaveFile string
+}
+
+// handlePairProgramming chats about a source file kept in the agent's context. The file is read
+// again before every reply, so edits made meanwhile are seen, and the diffs the agent proposes
+// are applied once the user accepts them. An empty message ends the session
+func handlePairProgramming(config PairConfig) error {
+    agent := agents.GetAgentConfig(config.Agent)
+    file, err := pair.Open(config.File)
+    if err != nil {
+        return err
+    }
+    if config.SaveFile == "" {
+        config.SaveFile = autoSavePath(agent)
+    }
+
+    palette := theme.Current()
+    fmt.Printf("\n%s👥 Pair programming on %s%s\n", palette.Heading, file.Path, colorReset)
+    fmt.Printf("%sAgent:%s %s %s\n", palette.Label, colorReset, theme.AgentEmoji(agent.Emoji, agent.Name), agent.Name)
+    fmt.Printf("%s[Changes to the file are picked up before every reply. Press Enter with an empty message to end the session]%s\n", palette.Muted, colorReset)
+
+    // The file's contents are kept in one message, replaced whenever they change
+    history := []Message{
+        {Role: "system", Content: buildSystemMessage(agent, false, "") + "\n\n" + pair.Guidelines(file.Name())},
+        {Role: "user", Content: file.Context()},
+        {Role: "assistant", Content: fmt.Sprintf("I have read %s.", file.Name())},
+    }
+
+    reader := stdin
+    readMessage := func() (string, error) {
+        fmt.Println()
+        line, err := readUserInput()
+        if err != nil && line == "" && !errors.Is(err, io.EOF) {
+            return "", fmt.Errorf("error reading input: %v", err)
+        }
+        return strings.TrimSpace(line), nil
+    }
+
+    start := time.Now()
+    var transcript strings.Builder
+    var userMessages []string
+    message := config.Starter
+    if message != "" {
+        fmt.Println()
+        fmt.Println(colorize(formatUserMessage(message), theme.Current().User))
+    }
+    notes := "" // What happened to the agent's last diffs, told with the next message
+    for {
+        if message == "" {
+            if message, err = readMessage(); err != nil {
+                return err
+            }
+            if message == "" {
+                break
+            }
+        }
+        transcript.WriteString(formatUserLabel() + message + "\n")
+        userMessages = append(userMessages, message)
+
+        changed, err := file.Sync()
+        if err != nil {
+            return err
+        }
+        if changed {
+            fmt.Printf("%s🔄 %s changed on disk, sending the new version%s\n", palette.Muted, file.Name(), colorReset)
+            history[1].Content = file.Context()
+            notes += fmt.Sprintf("(%s changed on disk since your last reply: its current contents are above.)\n", file.Name())
+        }
+        history = append(history, Message{Role: "user", Content: strings.TrimSpace(notes + "\n" + message)})
+        notes = ""
+
+        fmt.Println()
+        reply, err := agentTurn(agent, history)
+        if errors.Is(err, errInterrupted) {
+            fmt.Printf("\n\nSession ended after %s\n", formatElapsedTime(start, time.Now()))
+            exit(0)
+        }
+        if err != nil {
+            return fmt.Errorf("error processing response from %s: %w", agent.Name, err)
+        }
+        history = append(history, Message{Role: "assistant", Content: reply})
+        transcript.WriteString(agentLogEntry(agent, reply))
+
+        for i, diff := range pair.Extract(reply) {
+            notes += offerDiff(file, diff, i+1, reader, &transcript)
+        }
+        if notes != "" {
+            history[1].Content = file.Context()
+        }
+        message = ""
+    }
+
+    fmt.Printf("\n%sSession ended after %s%s\n", palette.Heading, formatElapsedTime(start, time.Now()), colorReset)
+    if config.SaveFile != "" {
+        if err := saveConversationLog(config.SaveFile, transcript.String()); err != nil {
+            fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
+        } else {
+            fmt.Printf("Conversation log saved to: %s\n", config.SaveFile)
+        }
+    }
+    rememberUserFacts(userMessages)
+    summarizeSession(agent, transcript.String())
+    return nil
+}
+
+// offerDiff asks the user whether to apply a diff the agent proposed and applies it when they
+// accept, returning what happened for the agent to know
+func offerDiff(file *pair.File, diff pair.Diff, number int, reader *bufio.Reader, transcript *strings.Builder) string {
+    palette := theme.Current()
+    // The file may have changed while the agent was answering
+    if _, err := file.Sync(); err != nil {
+        fmt.Printf("%s⚠️ %v%s\n", palette.Error, err, colorReset)
+        return fmt.Sprintf("(Change %d was not applied: %v.)\n", number, err)
+    }
+    updated, err := pair.Apply(file.Content, diff)
+    if err != nil {
+        fmt.Printf("%s⚠️ Can't apply change %d: %v%s\n", palette.Error, number, err, colorReset)
+        transcript.WriteString(fmt.Sprintf("⚠️ Change %d didn't apply: %v\n", number, err))
+        return fmt.Sprintf("(Change %d did not apply: %v. Write diffs against the current contents.)\n", number, err)
+    }
+
+    fmt.Printf("\n%sApply change %d to %s (+%d -%d lines)? [y/N]: %s", palette.Accent, number, file.Name(), diff.Added(), diff.Removed(), colorReset)
+    answer, _ := reader.ReadString('\n')
+    answer = strings.ToLower(strings.TrimSpace(answer))
+    if answer != "y" && answer != "yes" {
+        fmt.Printf("%sChange %d skipped%s\n", palette.Muted, number, colorReset)
+        transcript.WriteString(fmt.Sprintf("Change %d skipped\n", number))
+        return fmt.Sprintf("(I did not apply change %d.)\n", number)
+    }
+    if err := file.Write(updated); err != nil {
+        fmt.Printf("%s⚠️ %v%s\n", palette.Error, err, colorReset)
+        return fmt.Sprintf("(Change %d was not applied: %v.)\n", number, err)
+    }
+    fmt.Printf("%s✅ Change %d applied to %s%s\n", palette.Success, number, file.Path, colorReset)
+    transcript.WriteString(fmt.Sprintf("✅ Change %d applied to %s\n", number, file.Path))
+    return fmt.Sprintf("(I applied change %d: the file's current contents are above.)\n", number)
+}
+
+// StandupConfig is a standup summary requested with --mode standup
+type StandupConfig struct {
+    Agent        string
+    Project      string   // Optional name the standup is for
+    Notes        string   // Notes file to read
+    Repositories []string // Git repositories whose commits are read
+    Since        string   // Start of the period covered, in a form git understands; empty for the last working day
+    SaveFile     string   // Where the summary is written as well
+    Reference    string   // Attached material, like a ticket list, read along with the notes
+}
+
+// handleStandup writes a standup summary from the user's notes and commits, without asking
+// anything, so it can run from cron. Nothing is asked of the model when there's nothing to report
+func handleStandup(config StandupConfig) error {
+    agent := agents.GetAgentConfig(config.Agent)
+    if config.Notes == "" && len(config.Repositories) == 0 && config.Reference == "" {
+        return fmt.Errorf("a standup is written from --notes <file>, --git <repository> or both")
+    }
+    since := config.Since
+    if since == "" {
+        since = modes.StandupSince(time.Now()).Format("2006-01-02 15:04")
+    }
+
+    var notes string
+    if config.Notes != "" {
+        data, err := os.ReadFile(config.Notes)
+        if err != nil {
+            return fmt.Errorf("failed to read notes: %v", err)
+        }
+        notes = string(data)
+    }
+    var activity []string
+    for _, dir := range config.Repositories {
+        report, err := gitActivity(dir, since)
+        if err != nil {
+            return err
+        }
+        if report != "" {
+            activity = append(activity, report)
+        }
+    }
+
+    palette := theme.Current()
+    title := "📋 Standup for " + time.Now().Format("Monday, 2 January 2006")
+    if config.Project != "" {
+        title += " · " + config.Project
+    }
+    fmt.Printf("\n%s%s%s\n", palette.Heading, title, colorReset)
+    fmt.Printf("%sBy %s, covering the work since %s%s\n\n", palette.Muted, agent.Name, since, colorReset)
+    if strings.TrimSpace(notes) == "" && len(activity) == 0 && config.Reference == "" {
+        fmt.Printf("Nothing to report: no notes and no commits since %s.\n", since)
+        return nil
+    }
+
+    // Progress is only shown on a terminal, keeping the output of cron jobs clean
+    interactive := outputIsTerminal()
+    if interactive {
+        fmt.Print(colorize("Writing the standup...", palette.Muted))
+    }
+    summary, err := generateText(buildSystemMessage(agent, true, "")+"\n\n"+modes.StandupGuidelines(since),
+        strings.TrimSpace(config.Reference+"\n\n"+modes.StandupInput(config.Project, notes, activity)))
+    if interactive {
+        fmt.Print("\r\033[K")
+    }
+    if err != nil {
+        return fmt.Errorf("failed to write the standup: %v", err)
+    }
+    fmt.Println(summary)
+
+    if config.SaveFile != "" {
+        if err := saveConversationLog(config.SaveFile, title+"\n\n"+summary+"\n"); err != nil {
+            return err
+        }
+        fmt.Printf("\nStandup saved to: %s\n", config.SaveFile)
+    }
+    return nil
+}
+
+// gitActivity describes the user's commits in a repository since a date, on every branch, and
+// the changes not committed yet. It is empty when there's neither
+func gitActivity(dir, since string) (string, error) {
+    git := func(args ...string) (string, error) {
+        output, err := exec.Command("git", append([]string{"-C", dir}, args...)...).Output()
+        return strings.TrimRight(string(output), "\n"), err
+    }
+    root, err := git("rev-parse", "--show-toplevel")
+    if err != nil {
+        return "", fmt.Errorf("%s is not a git repository", dir)
+    }
+    name := filepath.Base(root)
+
+    args := []string{"log", "--all", "--no-merges", "--since=" + since, "--date=short", "--format=%ad %s"}
+    // Only the user's own commits, when git knows who they are
+    if email, _ := git("config", "user.email"); email != "" {
+        args = append(args, "--author="+email)
+    }
+    commits, err := git(args...)
+    if err != nil {
+        return "", fmt.Errorf("failed to read the git log of %s: %v", name, err)
+    }
+    status, err := git("status", "--short")
+    if err != nil {
+        return "", fmt.Errorf("failed to read the git status of %s: %v", name, err)
+    }
+
+    var sb strings.Builder
+    if commits != "" {
+        fmt.Fprintf(&sb, "My commits in %s:\n%s\n", name, commits)
+    }
+    if status != "" {
+        branch, _ := git("branch", "--show-current")
+        fmt.Fprintf(&sb, "Uncommitted changes in %s (branch %s):\n%s\n", name, branch, status)
+    }
+    return strings.TrimSpace(sb.String()), nil
+}
+
+// StoryConfig is a writing session started with --mode story
+type StoryConfig struct {
+    Agents    []string
+    Title     string // Title of the story, continued when it was started before
+    Chapters  int    // Chapters to write, 0 means modes.DefaultChapters
+    SaveFile  string
+    Reference string // Attached material, like notes on the world, shared with the authors
+}
+
+// handleStory has agents co-write a story: a new one starts with each agent creating a
+// character, then the agents take turns writing passages of each chapter. After every chapter
+// it is titled and summed up and the character sheets are brought up to date. The story is
+// saved after every passage, so it can be continued or exported with --export-story
+func handleStory(config StoryConfig) error {
+    if len(config.Agents) < 2 {
+        return fmt.Errorf("a story is written by at least two agents, e.g. chatty --with \"Jane Austen,Kafka\" --mode story \"<title>\"")
+    }
+    authors := make([]agents.AgentConfig, 0, len(config.Agents))
+    seen := make(map[string]bool)
+    for _, name := range config.Agents {
+        agent := agents.GetAgentConfig(name)
+        if seen[agent.Name] {
+            return fmt.Errorf("duplicate agent detected: %s (each agent can only be included once)", agent.Name)
+        }
+        seen[agent.Name] = true
+        authors = append(authors, agent)
+    }
+    if config.Chapters == 0 {
+        config.Chapters = modes.DefaultChapters
+    }
+
+    reader := stdin
+    if config.Title == "" {
+        if titles, err := story.List(); err == nil && len(titles) > 0 {
+            fmt.Printf("\nSaved stories: %s\n", strings.Join(titles, ", "))
+        }
+        title, err := readSubject(reader, "What is the story's title? (a new title starts one):")
+        if err != nil {
+            return err
+        }
+        if title == "" {
+            fmt.Println("Story cancelled.")
+            return nil
+        }
+        config.Title = title
+    }
+    tale, err := story.Load(config.Title)
+    if err != nil {
+        return err
+    }
+    if tale.New() {
+        premise, err := readSubject(reader, "What is it about? (press Enter to let the agents decide):")
+        if err != nil {
+            return err
+        }
+        tale.Premise = premise
+    }
+    if config.SaveFile == "" {
+        config.SaveFile = autoSavePath(authors...)
+    }
+    // Nobody is there to approve tool calls while the agents write among themselves
+    unattended = true
+
+    palette := theme.Current()
+    fmt.Printf("\n%s📖 %s%s\n", palette.Heading, tale.Title, colorReset)
+    if tale.Premise != "" {
+        fmt.Printf("%s%s%s\n", palette.Muted, tale.Premise, colorReset)
+    }
+    fmt.Println("Authors:")
+    for i, agent := range authors {
+        fmt.Printf("%d. %s %s - %s\n", i+1, theme.AgentEmoji(agent.Emoji, agent.Name), agent.Name, agent.Description)
+    }
+
+    start := time.Now()
+    var transcript strings.Builder
+    ended := func() {
+        fmt.Printf("\n\nStory ended after %s\n", formatElapsedTime(start, time.Now()))
+        exit(0)
+    }
+    turn := func(i int, prompt string) (string, error) {
+        agent := authors[i]
+        var earlier []string
+        for _, chapter := range tale.Chapters {
+            if chapter.Summary != "" {
+                earlier = append(earlier, chapter.Summary)
+            }
+        }
+        messages := []Message{{
+            Role:    "system",
+            Content: buildSystemMessage(agent, true, describeParticipants(authors, i, false)) + "\n\n" + modes.StoryGuidelines(tale.Title, tale.Premise, tale.Sheets(), earlier),
+        }}
+        if config.Reference != "" {
+            messages = append(messages, Message{Role: "user", Content: config.Reference})
+        }
+        messages = append(messages, Message{Role: "user", Content: prompt})
+        text, err := agentTurn(agent, messages)
+        if errors.Is(err, errInterrupted) {
+            ended()
+        }
+        if err != nil {
+            return "", fmt.Errorf("error processing response from %s: %w", agent.Name, err)
+        }
+        transcript.WriteString(agentLogEntry(agent, text))
+        return text, nil
+    }
+    section := func(title string) {
+        fmt.Printf("\n%s%s%s\n", palette.Section, strings.Repeat("─", 60), colorReset)
+        fmt.Printf("%s%s%s\n", palette.Section, title, colorReset)
+        fmt.Printf("%s%s%s\n\n", palette.Section, strings.Repeat("─", 60), colorReset)
+        transcript.WriteString("\n" + title + "\n")
+    }
+
+    // Each author brings a character to a new story
+    if tale.New() {
+        section("🎭 Characters")
+        for i := range authors {
+            text, err := turn(i, modes.CharacterPrompt(tale.Sheets()))
+            if err != nil {
+                return err
+            }
+            if tale.SetCharacters(text) == 0 {
+                fmt.Printf("%s⚠️ No character sheet found in %s's reply%s\n\n", palette.Muted, authors[i].Name, colorReset)
+            }
+        }
+        if err := tale.Save(); err != nil {
+            return err
+        }
+    }
+
+    for written := 0; written < config.Chapters; written++ {
+        number := len(tale.Chapters) + 1
+        previous := ""
+        if number > 1 {
+            if passages := tale.Chapters[number-2].Passages; len(passages) > 0 {
+                last := passages[len(passages)-1]
+                previous = story.Clean(last.Author, last.Text)
+            }
+        }
+        tale.Chapters = append(tale.Chapters, story.Chapter{})
+        chapter := &tale.Chapters[len(tale.Chapters)-1]
+        section(fmt.Sprintf("📖 Chapter %d", number))
+
+        var text strings.Builder
+        for round := 0; round < modes.StoryRounds; round++ {
+            for i, agent := range authors {
+                last := round == modes.StoryRounds-1 && i == len(authors)-1
+                passage, err := turn(i, modes.PassagePrompt(number, previous, strings.TrimSpace(text.String()), last))
+                if err != nil {
+                    return err
+                }
+                chapter.Passages = append(chapter.Passages, story.Passage{Author: agent.Name, Text: passage})
+                text.WriteString(story.Clean(agent.Name, passage) + "\n\n")
+                if err := tale.Save(); err != nil {
+                    return err
+                }
+            }
+        }
+
+        // The next chapters are written from the summary, and the sheets follow the characters
+        fmt.Print(colorize("Editing the chapter...", palette.Muted))
+        reply, err := generateText(modes.ChapterInstructions(), text.String())
+        if err == nil {
+            chapter.Title, chapter.Summary = modes.ParseChapter(reply)
+            reply, err = generateText(modes.SheetsInstructions(tale.Sheets()), text.String())
+            if err == nil {
+                tale.SetCharacters(reply)
+            }
+        }
+        fmt.Print("\r\033[K")
+        if err != nil {
+            fmt.Printf("⚠️ Warning: Failed to edit the chapter: %v\n", err)
+        }
+        if err := tale.Save(); err != nil {
+            return err
+        }
+        if chapter.Title != "" {
+            fmt.Printf("%s✒️ Chapter %d: %s%s\n", palette.Accent, number, chapter.Title, colorReset)
+            transcript.WriteString(fmt.Sprintf("✒️ Chapter %d: %s\n", number, chapter.Title))
+        }
+    }
+
+    fmt.Printf("\n%sStory saved after %s. Export it with:%s chatty --export-story \"%s\"\n",
+        palette.Heading, formatElapsedTime(start, time.Now()), colorReset, tale.Title)
+    if config.SaveFile != "" {
+        if err := saveConversationLog(config.SaveFile, transcript.String()); err != nil {
+            fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
+        } else {
+            fmt.Printf("Conversation log saved to: %s\n", config.SaveFile)
+        }
+    }
+    for _, agent := range authors {
+        summarizeSession(agent, transcript.String())
+    }
+    return nil
+}
+
+// Update the processStreamResponse function to use the conversation animation
+// streamHandler receives the chunks of a response streamed to an API client instead of the terminal
+type streamHandler func(chunk string)
+
+// streamStats is what Ollama and the stream tell about a response besides its text
+type streamStats struct {
+    promptTokens int           // Size of the prompt
+    evalTokens   int           // Size of the response
+    evalDuration time.Duration // Spent generating the response
+    firstToken   time.Time     // When the first chunk with content arrived
+}
+
+// statusBar is whether responses streaming to a terminal show a status line under them, off
+// with disable_status_bar in config.json
+var statusBar = true
+
+// startStatusLine reserves the bottom row of the terminal for the status of a response as it
+// streams, nil when output goes elsewhere, like a pipe, or is mirrored to a --log file, which
+// would get the status lines among the response
+func startStatusLine() *render.StatusLine {
+    if !statusBar || outputTee != nil || !outputIsTerminal() {
+        return nil
+    }
+    palette := theme.Current()
+    return render.StartStatusLine(os.Stdout, term.Height(os.Stdout), term.Width(os.Stdout), palette.Muted, palette.Reset)
+}
+
+// streamStatus describes a response streaming since start: how long it has taken, the tokens
+// received so far and how many a second
+func streamStatus(start time.Time, count int) string {
+    now := time.Now()
+    status := fmt.Sprintf("%s · %d tokens", formatElapsedTime(start, now), count)
+    if seconds := now.Sub(start).Seconds(); seconds >= 1 {
+        status += fmt.Sprintf(" · %.1f tokens/s", float64(count)/seconds)
+    }
+    return status
+}
+
+// newStreamRenderer returns the renderer printing a response in the terminal, nil when it goes
+// to a streamHandler
+func newStreamRenderer(anim any) *render.StreamRenderer {
+    var textColor string
+    switch a := anim.(type) {
+    case streamHandler:
+        return nil
+    case *Animation:
+        textColor = currentAgent.TextColor
+    case *ConversationAnimation:
+        textColor = a.agent.TextColor
+    }
+    return render.NewStreamRenderer(theme.Current().AgentTextColor(textColor), !theme.Current().NoColor)
+}
+
+// processStreamResponse prints a streamed response with renderer as it arrives, or hands it to a
+// streamHandler passed as anim, and returns its text, the tools the model called and its statistics
+func processStreamResponse(resp *http.Response, anim any, renderer *render.StreamRenderer) (string, []tools.Call, streamStats, error) {
+    var stats streamStats
+    var fullResponse strings.Builder
+    var toolCalls []tools.Call
+    var firstChunk bool = true
+
+    // A status line under the response tells how it is coming along, until it completes
+    var status *render.StatusLine
+    var start time.Time
+    received := 0
+    
+    // Create a buffered reader for better performance
+    reader := bufio.NewReaderSize(resp.Body, 64*1024)
+    
+    // Create a decoder that reads from our buffered reader
+    decoder := json.NewDecoder(reader)
+
+    for {
+        var streamResp ChatResponse
+        err := decoder.Decode(&streamResp)
+        
+        if err == io.EOF {
+            // Ollama ends every response with a done chunk, so the connection was closed midway
+            return fullResponse.String(), toolCalls, stats, fmt.Errorf("error reading response: %v", io.ErrUnexpectedEOF)
+        }
+        if errors.Is(err, errInterrupted) {
+            // Leave the terminal in order, with what was received so far
+            if renderer != nil {
+                fmt.Print(renderer.Flush())
+            }
+            return fullResponse.String(), toolCalls, stats, errInterrupted
+        }
+        if err != nil {
+            return fullResponse.String(), toolCalls, stats, fmt.Errorf("error reading response: %v", err)
+        }
+        if stats.firstToken.IsZero() && (streamResp.Message.Content != "" || len(streamResp.Message.ToolCalls) > 0) {
+            stats.firstToken = time.Now()
+        }
+        if streamResp.Done {
+            stats.promptTokens = streamResp.PromptEvalCount
+            stats.evalTokens = streamResp.EvalCount
+            stats.evalDuration = time.Duration(streamResp.EvalDuration)
+        }
+
+        // Handle first chunk animation
+        if firstChunk {
+            switch a := anim.(type) {
+            case *Animation:
+                a.stopAnimation()
+            case *ConversationAnimation:
+                a.stopAnimation()
+            }
+            firstChunk = false
+            if renderer != nil {
+                status = startStatusLine()
+                defer status.Clear()
+                start = time.Now()
+            }
+        }
+        
+        // Hand chunks for a client over as they are, without terminal formatting
+        if handler, ok := anim.(streamHandler); ok {
+            handler(streamResp.Message.Content)
+            fullResponse.WriteString(streamResp.Message.Content)
+            toolCalls = append(toolCalls, streamResp.Message.ToolCalls...)
+            if streamResp.Done {
+                return fullResponse.String(), toolCalls, stats, nil
+            }
+            continue
+        }
+
+        // Print the response chunk, highlighting any code blocks. Ollama streams a token per chunk
+        fmt.Print(renderer.Render(streamResp.Message.Content))
+        fullResponse.WriteString(streamResp.Message.Content)
+        toolCalls = append(toolCalls, streamResp.Message.ToolCalls...)
+        if streamResp.Message.Content != "" {
+            received++
+            status.Update(streamStatus(start, received))
+        }
+        
+        if streamResp.Done {
+            fmt.Print(renderer.Flush())
+            return fullResponse.String(), toolCalls, stats, nil
+        }
+    }
+}
+
+// confirmToolCall asks the user whether an agent may go ahead with a tool call.
+// Without a terminal to ask on, or anyone to answer in --auto mode, the call is declined
+func confirmToolCall(action string) bool {
+    palette := theme.Current()
+    if unattended {
+        fmt.Printf("\n%s⚠️ Declined to %s: autonomous conversations only run tools allowed with chatty --tools allow <tool>%s", palette.Muted, action, colorReset)
+        return false
+    }
+    if !term.IsTerminal(os.Stdin) {
+        fmt.Printf("\n%s⚠️ Declined to %s: no terminal to ask for approval%s", palette.Muted, action, colorReset)
+        return false
+    }
+
+    fmt.Printf("\n%s⚠️ Allow the agent to %s? [y/N]: %s", palette.Accent, action, colorReset)
+    reader := stdin
+    answer, err := reader.ReadString('\n')
+    if err != nil {
+        return false
+    }
+    answer = strings.ToLower(strings.TrimSpace(answer))
+    return answer == "y" || answer == "yes"
+}
+
+// printWebSources lists the web pages the tools consulted for a response
+func printWebSources(sources []tools.Source) {
+    if len(sources) == 0 {
+        return
+    }
+    var sb strings.Builder
+    sb.WriteString("\n\n🔗 Web sources:")
+    for i, source := range sources {
+        title := source.Title
+        if title == "" {
+            title = source.URL
+        }
+        sb.WriteString(fmt.Sprintf("\n  [%d] %s", i+1, title))
+        if title != source.URL {
+            sb.WriteString(" - " + source.URL)
+        }
+    }
+    fmt.Print(colorize(sb.String(), theme.Current().Muted))
+}
+
+// agentLogEntry formats an agent's response for a conversation log, after the tools it used to prepare it
+func agentLogEntry(agent agents.AgentConfig, response string) string {
+    if toolActivity.Len() == 0 {
+        return formatAgentLabel(agent) + response + "\n"
+    }
+    return formatAgentLabel(agent) + "\n" + toolActivity.String() + response + "\n"
+}
+
+// toolPolicy returns the tool permissions that apply to an agent: its own overrides on top of the global ones,
+// with every tool outside the agent's tools list denied
+func toolPolicy(agent agents.AgentConfig) tools.Policy {
+    policy := make(tools.Policy)
+    for tool, permission := range toolPermissions {
+        policy[tool] = permission
+    }
+    for name, permissions := range agentToolPermissions {
+        if strings.EqualFold(name, agent.Name) {
+            for tool, permission := range permissions {
+                policy[tool] = permission
+            }
+        }
+    }
+    if len(agent.Tools) > 0 {
+        listed := make(map[string]bool)
+        for _, name := range agent.Tools {
+            listed[name] = true
+        }
+        for _, name := range tools.Names() {
+            if !listed[name] {
+                policy[name] = tools.PermissionDeny
+            }
+        }
+    }
+    return policy
+}
+
+// availableTools returns the tools advertised to an agent's model, or nil when tools are off or unsupported
+func availableTools(agent agents.AgentConfig) []tools.Definition {
+    if !toolsEnabled {
+        return nil
+    }
+    toolsUnsupportedMu.Lock()
+    unsupported := toolsUnsupported[agents.GetCurrentModel()]
+    toolsUnsupportedMu.Unlock()
+    if unsupported {
+        return nil
+    }
+    return tools.Definitions(toolPolicy(agent))
+}
+
+// contextWindow returns how many tokens of context a model runs with: context_window from
+// config.json, the num_ctx the model was created with, or the server's default, within the
+// model's own limit
+func contextWindow(model string) int {
+    if config, err := agents.GetCurrentConfig(); err == nil && config.ContextWindow > 0 {
+        return config.ContextWindow
+    }
+
+    contextWindowsMu.Lock()
+    defer contextWindowsMu.Unlock()
+    if window, ok := contextWindows[model]; ok {
+        return window
+    }
+    window := ollamaDefaultContext
+    if n, err := strconv.Atoi(os.Getenv("OLLAMA_CONTEXT_LENGTH")); err == nil && n > 0 {
+        window = n
+    }
+
+    var info struct {
+        Parameters string         `json:"parameters"`
+        ModelInfo  map[string]any `json:"model_info"`
+    }
+    body, _ := json.Marshal(map[string]string{"model": model})
+    callOllama(http.MethodPost, ollamaBaseURL+"/api/show", body, requestTimeout, &info)
+    for _, line := range strings.Split(info.Parameters, "\n") {
+        if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "num_ctx" {
+            if n, err := strconv.Atoi(fields[1]); err == nil && n > 0 {
+                window = n
+            }
+        }
+    }
+    for key, value := range info.ModelInfo {
+        if limit, ok := value.(float64); ok && strings.HasSuffix(key, ".context_length") && limit > 0 && int(limit) < window {
+            window = int(limit)
+        }
+    }
+    if debugMode {
+        fmt.Printf("Debug: %s runs with %d tokens of context\n", model, window)
+    }
+    contextWindows[model] = window
+    return window
+}
+
+// modelOptions returns the options chat requests run the model with, nil for the model's defaults.
+// Requests with other options make Ollama load the model again
+func modelOptions() map[string]any {
+    if config, err := agents.GetCurrentConfig(); err == nil && config.ContextWindow > 0 {
+        return map[string]any{"num_ctx": config.ContextWindow}
+    }
+    return nil
+}
+
+// startsChat reports whether a command line chats with agents, rather than managing them
+func startsChat(args []string) bool {
+    if len(args) < 2 {
+        return false
+    }
+    switch args[1] {
+    case "--with", "--with-random", "--scenario", "--pair", "--pipeline", "--watch", "serve", "bridge", "tui", "--save", "--image", "--url", "--file", "--ocr", "--template":
+        return true
+    }
+    switch args[1] {
+    case "init", "profile", "migrate-xdg", "config":
+        return false
+    }
+    return !strings.HasPrefix(args[1], "--")
+}
+
+// warmUpModel has Ollama load the model in the background while the command gets ready, so the
+// first response doesn't wait for the model to load. A model that is already loaded stays loaded
+func warmUpModel() {
+    chatReq := ChatRequest{
+        Model:     agents.GetCurrentModel(),
+        Messages:  []Message{}, // Without messages, Ollama only loads the model
+        KeepAlive: keepAlive,
+        Options:   modelOptions(),
+    }
+    jsonData, err := json.Marshal(chatReq)
+    if err != nil {
+        return
+    }
+    go func() {
+        start := time.Now()
+        req, err := http.NewRequestWithContext(interruptCtx, http.MethodPost, getOllamaAPI(), bytes.NewReader(jsonData))
+        if err != nil {
+            return
+        }
+        req.Header.Set("Content-Type", "application/json")
+        resp, err := ollamaClient.Do(req)
+        if err != nil {
+            return // Reported when the chat starts
+        }
+        io.Copy(io.Discard, resp.Body)
+        resp.Body.Close()
+        if debugMode {
+            fmt.Printf("Debug: %s ready after %s\n", chatReq.Model, time.Since(start).Round(time.Millisecond))
+        }
+    }()
+}
+
+// requestTokens estimates the size of a request's prompt, before correcting for the model
+func requestTokens(chatReq ChatRequest) int {
+    total := 0
+    for _, msg := range chatReq.Messages {
+        total += messageTokens(msg)
+    }
+    if len(chatReq.Tools) > 0 {
+        definitions, _ := json.Marshal(chatReq.Tools)
+        total += tokens.Estimate(string(definitions))
+    }
+    return total
+}
+
+// messageTokens estimates the size of a message in a prompt
+func messageTokens(msg Message) int {
+    total := messageOverhead + tokens.Estimate(msg.Content) + len(msg.Images)*imageTokens
+    if len(msg.ToolCalls) > 0 {
+        calls, _ := json.Marshal(msg.ToolCalls)
+        total += tokens.Estimate(string(calls))
+    }
+    return total
+}
+
+// fitContext drops the oldest messages of a request until it fits in the model's context with
+// room for the response, keeping the system message and the latest message. A tool call goes
+// together with its results. It returns the estimated size of the prompt that is left
+func fitContext(chatReq *ChatRequest) int {
+    window := contextWindow(chatReq.Model)
+    chatReq.Options = modelOptions()
+    budget := window - min(responseReserve, window/4)
+
+    estimate := requestTokens(*chatReq)
+    if tokenCounter.Adjust(chatReq.Model, estimate) <= budget {
+        return estimate
+    }
+
+    messages := chatReq.Messages
+    first := 0
+    if len(messages) > 0 && messages[0].Role == "system" {
+        first = 1
+    }
+    dropped := 0
+    for len(messages)-first > 1 && tokenCounter.Adjust(chatReq.Model, estimate) > budget {
+        estimate -= messageTokens(messages[first])
+        messages = append(messages[:first:first], messages[first+1:]...)
+        dropped++
+        // Results of a dropped tool call would answer nothing
+        for len(messages)-first > 1 && messages[first].Role == "tool" {
+            estimate -= messageTokens(messages[first])
+            messages = append(messages[:first:first], messages[first+1:]...)
+            dropped++
+        }
+    }
+    if debugMode {
+        fmt.Printf("Debug: dropped the %d oldest messages to fit %d tokens of context\n", dropped, window)
+    }
+    chatReq.Messages = messages
+    return estimate
+}
+
+// profileRequest records a streamed response for --profile. Without the counts Ollama reports,
+// the response's size is estimated and timed from its first chunk
+func profileRequest(sent time.Time, text string, stats streamStats) {
+    if !profile.Enabled() || stats.firstToken.IsZero() {
+        return
+    }
+    request := profile.Request{
+        FirstToken: stats.firstToken.Sub(sent),
+        Tokens:     stats.evalTokens,
+        Generating: stats.evalDuration,
+    }
+    if request.Tokens == 0 || request.Generating == 0 {
+        request.Tokens = tokens.Estimate(text)
+        request.Generating = time.Since(stats.firstToken)
+    }
+    profile.AddRequest(request)
+}
+
+// spentTokens returns the tokens a request read and wrote, as Ollama counted them or estimated
+// when it didn't
+func spentTokens(estimate int, text string, stats streamStats) int {
+    spent := stats.promptTokens
+    if spent == 0 {
+        spent = estimate
+    }
+    if stats.evalTokens > 0 {
+        return spent + stats.evalTokens
+    }
+    return spent + tokens.Estimate(text)
+}
+
+// chatWithTools sends a chat request and streams the reply, running the tools the model calls
+// and sending their results back until it answers. It takes over the animation, which is
+// stopped by the time it returns, and retries failed requests when retry is set
+func chatWithTools(chatReq ChatRequest, agent agents.AgentConfig, anim any, retry bool) (string, error) {
+    stop := func() {
+        switch a := anim.(type) {
+        case *Animation:
+            a.stopAnimation()
+        case *ConversationAnimation:
+            a.stopAnimation()
+        }
+    }
+
+    // Responses for API clients may be prepared at the same time, so only terminal chats keep tool activity
+    _, toClient := anim.(streamHandler)
+    var fullResponse strings.Builder
+    if !toClient {
+        tools.TakeSources()
+        toolActivity.Reset()
+    }
+    spent := 0 // Tokens of every round, counted in the agent's usage
+    for round := 0; ; round++ {
+        // The model must answer in words once it has used its rounds of tool calls
+        if round == maxToolRounds {
+            chatReq.Tools = nil
+        }
+
+        estimate := fitContext(&chatReq)
+        jsonData, err := json.Marshal(chatReq)
+        if err != nil {
+            stop()
+            return "", fmt.Errorf("error marshaling request: %v", err)
+        }
+
+        var resp *http.Response
+        sent := time.Now()
+        activeRequests.Add(1)
+        if retry {
+            resp, err = makeAPIRequestWithRetry(jsonData, agent.Name)
+        } else {
+            resp, err = makeAPIRequest(jsonData)
+        }
+        if errors.Is(err, errToolsUnsupported) && chatReq.Tools != nil {
+            activeRequests.Add(-1)
+            // Ask again without tools, and don't offer them to this model for the rest of the run
+            toolsUnsupportedMu.Lock()
+            toolsUnsupported[chatReq.Model] = true
+            toolsUnsupportedMu.Unlock()
+            chatReq.Tools = nil
+            round--
+            continue
+        }
+        if err != nil {
+            activeRequests.Add(-1)
+            stop()
+            return "", err
+        }
+
+        renderer := newStreamRenderer(anim)
+        text, calls, stats, err := processStreamResponse(resp, anim, renderer)
+        resp.Body.Close()
+        tokenCounter.Observe(chatReq.Model, estimate, stats.promptTokens)
+
+        // A response cut off midway is picked up where it stopped, rather than started over
+        for resumes := 0; err != nil && !errors.Is(err, errInterrupted) && text != "" && len(calls) == 0 && resumes < maxResumes; resumes++ {
+            var rest string
+            rest, calls, stats, err = resumeResponse(chatReq, agent, text, err, anim, renderer)
+            text += rest
+        }
+        activeRequests.Add(-1)
+        if err != nil && renderer != nil {
+            fmt.Print(renderer.Flush())
+        }
+        if err == nil {
+            profileRequest(sent, text, stats)
+            spent += spentTokens(estimate, text, stats)
+        }
+        fullResponse.WriteString(text)
+        if err != nil {
+            return fullResponse.String(), err
+        }
+        if len(calls) == 0 {
+            // --no-history runs leave usage statistics as they were, like histories and memory
+            if !stateless {
+                if err := usage.Record(agent.Name, spent); err != nil && debugMode {
+                    fmt.Printf("Debug: %v\n", err)
+                }
+            }
+            if !toClient {
+                printWebSources(tools.TakeSources())
+            }
+            return fullResponse.String(), nil
+        }
+
+        // Run the tools and hand their results back to the model
+        chatReq.Messages = append(chatReq.Messages, Message{Role: "assistant", Content: text, ToolCalls: calls})
+        if text != "" && !toClient {
+            fmt.Println()
+        }
+        for _, call := range calls {
+            opening := tools.FormatCall(call)
+            if !toClient {
+                fmt.Print("\n" + colorize(opening, theme.Current().Muted))
+            }
+            result := tools.Execute(call, toolPolicy(agent))
+            closing := tools.FormatResult(result)
+            if !toClient {
+                fmt.Print(colorize(closing, theme.Current().Muted))
+                toolActivity.WriteString(opening + closing)
+            }
+            chatReq.Messages = append(chatReq.Messages, Message{
+                Role:     "tool",
+                Content:  result,
+                ToolName: call.Function.Name,
+            })
+        }
+
+        // Wait for the answer with a fresh label
+        switch anim.(type) {
+        case streamHandler:
+        case *Animation:
+            anim = startAnimation()
+        default:
+            anim = startConversationAnimation(agent)
+        }
+    }
+}
+
+// resumePrompt asks the model to finish a response that was cut off
+const resumePrompt = "Your last response was cut off. Continue it from exactly where it stopped, without repeating anything or mentioning the interruption."
+
+// resumeResponse asks the model to continue the partial response a stream broke off with cause,
+// printing the rest with the same renderer or handing it to the same streamHandler
+func resumeResponse(chatReq ChatRequest, agent agents.AgentConfig, partial string, cause error, anim any, renderer *render.StreamRenderer) (string, []tools.Call, streamStats, error) {
+    if renderer != nil {
+        fmt.Print(colorize(fmt.Sprintf("\n⚠️ Response cut off (%v), asking %s to continue...\n", cause, agent.Name), theme.Current().Muted))
+    }
+    profile.AddRetry()
+
+    chatReq.Messages = append(append([]Message(nil), chatReq.Messages...),
+        Message{Role: "assistant", Content: partial},
+        Message{Role: "user", Content: resumePrompt})
+    fitContext(&chatReq)
+    jsonData, err := json.Marshal(chatReq)
+    if err != nil {
+        return "", nil, streamStats{}, fmt.Errorf("error marshaling request: %v", err)
+    }
+    resp, err := makeAPIRequestWithRetry(jsonData, agent.Name)
+    if err != nil {
+        return "", nil, streamStats{}, err
+    }
+    defer resp.Body.Close()
+
+    // The animation was stopped by the first chunk of the response
+    if _, toClient := anim.(streamHandler); !toClient {
+        anim = nil
+    }
+    return processStreamResponse(resp, anim, renderer)
+}
+
+// Check if chatty is initialized
+func isChattyInitialized() bool {
+    configDir, err := appdir.ConfigDir()
+    if err != nil {
+        return false
+    }
+    
+    if _, err := os.Stat(configDir); os.IsNotExist(err) {
+        return false
+    }
+    
+    return true
+}
+
+// Initialize chatty environment
+func initializeChatty() error {
+    fmt.Println("\n🚀 Initializing Chatty environment...")
+    
+    // Preload the LLM model
+    agentConfig, err := agents.GetCurrentConfig()
+    if err != nil {
+        fmt.Printf("\n⚠️ Warning: Could not get agent config: %v\n", err)
+        return err
+    }
+    
+    curlCmd := exec.Command("curl", ollamaBaseURL+"/api/generate", "-d", 
+        fmt.Sprintf(`{"model": "%s", "keep_alive": -1}`, agentConfig.Model))
+    
+    if debugMode {
+        fmt.Printf("\nExecuting: curl %s/api/generate -d '{\"model\": \"%s\", \"keep_alive\": -1}'\n", 
+            ollamaBaseURL, agentConfig.Model)
+        curlOut, err := curlCmd.CombinedOutput()
+        if err != nil {
+            fmt.Printf("\n⚠️ Warning: Failed to preload model: %v\n%s\n", err, string(curlOut))
+        } else {
+            fmt.Printf("\n✓ Response: %s\n", string(curlOut))
+        }
+    } else {
+        err := curlCmd.Run()
+        if err != nil {
+            fmt.Printf("\n⚠️ Warning: Failed to preload model: %v\n", err)
+        } else {
+            fmt.Printf("%s✓%s Model preloaded\n", theme.Current().Success, colorReset)
+        }
+    }
+    
+    // Create necessary directories and files
+    configDir, err := appdir.ConfigDir()
+    if err != nil {
+        return err
+    }
+    dataDir, err := appdir.DataDir()
+    if err != nil {
+        return err
+    }
+
+    // Create the configuration and data directories, the same ~/.chatty on Windows
+    for _, dir := range []string{configDir, dataDir} {
+        if err := os.MkdirAll(dir, 0755); err != nil {
+            return fmt.Errorf("failed to create chatty directory: %v", err)
+        }
+    }
+    fmt.Printf("%s✓%s Created %s%s%s directory\n", 
+        theme.Current().Success, colorReset,  // Checkmark
+        theme.Current().Value, configDir, colorReset)    // Path
+    if dataDir != configDir {
+        fmt.Printf("%s✓%s Created %s%s%s directory\n", 
+            theme.Current().Success, colorReset,
+            theme.Current().Value, dataDir, colorReset)
+    }
+
+    // Initialize agents
+    if err := agents.CreateDefaultConfig(); err != nil {
+        return fmt.Errorf("failed to create default config: %v", err)
+    }
+    fmt.Printf("%s✓%s Created default configuration\n", 
+        theme.Current().Success, colorReset)
+
+    // Create agents directory
+    agentsDir := filepath.Join(configDir, "agents")
+    if err := os.MkdirAll(agentsDir, 0755); err != nil {
+        return fmt.Errorf("failed to create agents directory: %v", err)
+    }
+    fmt.Printf("%s✓%s Created agents directory\n", 
+        theme.Current().Success, colorReset)
+
+    // Get default agent info
+    defaultAgent := agents.GetDefaultAgent()
+
+    // Theme colors for better readability
+    palette := theme.Current()
+    colorHeading := palette.Heading
+    colorSection := palette.Section
+    colorSuccess := palette.Success
+    colorLabel := palette.Label  // Command labels
+    colorValue := palette.Value
+
+    // Print success message with enhanced formatting
+    fmt.Printf("\n%s🎉 Chatty has been successfully initialized!%s\n\n", 
+        colorSuccess, colorReset)
+
+    fmt.Printf("%s📌 Default Agent:%s\n", colorSection, colorReset)
+    fmt.Printf("   %s %s%s%s - %s\n\n",
+        theme.AgentEmoji(defaultAgent.Emoji, defaultAgent.Name),
+        palette.AgentColor(defaultAgent.LabelColor),
+        defaultAgent.Name,
+        colorReset,
+        defaultAgent.Description)
+
+    fmt.Printf("%s🎯 Quick Start Guide%s\n", colorHeading, colorReset)
+    
+    // Basic Commands Section
+    fmt.Printf("\n   %s💬 Basic Commands:%s\n", colorSection, colorReset)
+    fmt.Printf("   • %sOne-off message:%s chatty %s\"Your message here\"%s\n",
+        colorLabel, colorReset, colorValue, colorReset)
+    fmt.Printf("   • %sSimple chat mode:%s chatty --with %s<agent_name>%s\n",
+        colorLabel, colorReset, colorValue, colorReset)
+    
+    // Agent Management Section
+    fmt.Printf("\n   %s🧠 Agent Management:%s\n", colorSection, colorReset)
+    fmt.Printf("   • %sList installed agents:%s chatty --list\n",
+        colorLabel, colorReset)
+    fmt.Printf("   • %sBrowse store agents:%s chatty --store\n",
+        colorLabel, colorReset)
+    fmt.Printf("   • %sView agent details:%s chatty --show %s<agent_name>%s\n",
+        colorLabel, colorReset, colorValue, colorReset)
+    fmt.Printf("   • %sInstall an agent:%s chatty --install %s<agent_name>%s\n",
+        colorLabel, colorReset, colorValue, colorReset)
+    fmt.Printf("   • %sSwitch active agent:%s chatty --select %s<agent_name>%s\n",
+        colorLabel, colorReset, colorValue, colorReset)
+    
+    // Advanced Features Section
+    fmt.Printf("\n   %s🌟 Advanced Features:%s\n", colorSection, colorReset)
+    fmt.Printf("   • %sGroup chat mode:%s chatty --with %s\"Einstein,Ada,Tux\"%s --topic \"Let's talk\"\n",
+        colorLabel, colorReset, colorValue, colorReset)
+    fmt.Printf("   • %sRandom agents chat:%s chatty --with-random %s3%s --topic \"Hello\"\n",
+        colorLabel, colorReset, colorValue, colorReset)
+    fmt.Printf("   • %sAutonomous mode:%s Add %s--auto%s flag to group chats\n",
+        colorLabel, colorReset, colorValue, colorReset)
+    fmt.Printf("   • %sSave conversations:%s Add %s--save filename.txt%s to any command\n",
+        colorLabel, colorReset, colorValue, colorReset)
+
+    fmt.Printf("\n%s💡 Pro Tips:%s\n", colorSection, colorReset)
+    fmt.Printf("   • Use %s--turns N%s to limit conversation length\n",
+        colorLabel, colorReset)
+    fmt.Printf("   • Press %sCtrl+C%s to stop auto-conversations gracefully\n",
+        colorLabel, colorReset)
+    fmt.Printf("   • Use %s--topic-file path.txt%s to read topics from a file\n",
+        colorLabel, colorReset)
+    fmt.Printf("   • Clear history with %s--clear all%s or %s--clear \"Agent Name\"%s\n",
+        colorLabel, colorReset, colorLabel, colorReset)
+
+    fmt.Printf("\n%s🌟 Ready to start your AI journey!%s\n\n",
+        colorSuccess, colorReset)
+    
+    return nil
+}
+
+// Add this new function after the makeAgentRequest function
+func getRandomAgents(count int) ([]string, error) {
+    if count < 2 || count > 15 {
+        return nil, fmt.Errorf("number of agents must be between 2 and 15, got %d", count)
+    }
+
+    // Get all available agents, leaving out disabled ones
+    allAgents := agents.GetEnabledAgentNames()
+    if len(allAgents) < count {
+        return nil, fmt.Errorf("not enough agents available: requested %d but only have %d", count, len(allAgents))
+    }
+
+    // Create a copy of the slice to shuffle
+    shuffled := make([]string, len(allAgents))
+    copy(shuffled, allAgents)
+
+    // Fisher-Yates shuffle
+    for i := len(shuffled) - 1; i > 0; i-- {
+        j := time.Now().UnixNano() % int64(i+1)
+        shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+    }
+
+    // Return the first 'count' agents
+    return shuffled[:count], nil
+}
+
+// readStarterFile reads the contents of a text file to use as a starter message
+func readStarterFile(filePath string) (string, error) {
+    content, err := os.ReadFile(filePath)
+    if err != nil {
+        return "", fmt.Errorf("failed to read starter file: %v", err)
+    }
+    return strings.TrimSpace(string(content)), nil
+}
+
+// fillTemplate reads a prompt template and fills each placeholder with the value given with
+// --var, or else the one in its CHATTY_VAR_ environment variable. {{stdin}} takes what is piped
+// to chatty, and values still missing are asked for at the terminal, unless --no-history rules
+// out waiting for input
+func fillTemplate(name string, vars map[string]string) (string, error) {
+    path, err := templates.Path(name)
+    if err != nil {
+        return "", err
+    }
+    text, err := templates.Load(path)
+    if err != nil {
+        return "", err
+    }
+    piped := !term.IsTerminal(os.Stdin)
+    interactive := !piped && !unattended
+
+    values := make(map[string]string)
+    palette := theme.Current()
+    for _, placeholder := range templates.Placeholders(text) {
+        if value, ok := vars[placeholder]; ok {
+            values[placeholder] = value
+            continue
+        }
+        if value, ok := os.LookupEnv(templates.EnvVar(placeholder)); ok {
+            values[placeholder] = value
+            continue
+        }
+        if placeholder == templates.Stdin && piped {
+            data, err := io.ReadAll(stdin)
+            if err != nil {
+                return "", fmt.Errorf("failed to read standard input: %v", err)
+            }
+            values[placeholder] = strings.TrimRight(string(data), "\n")
+            continue
+        }
+        if !interactive {
+            return "", fmt.Errorf("no value for {{%s}} in %s: pass --var %s=<value> or set %s",
+                placeholder, path, placeholder, templates.EnvVar(placeholder))
+        }
+        fmt.Printf("%s%s:%s ", palette.Accent, placeholder, colorReset)
+        line, err := stdin.ReadString('\n')
+        if err != nil && line == "" {
+            return "", fmt.Errorf("error reading input: %v", err)
+        }
+        values[placeholder] = strings.TrimSpace(line)
+    }
+    return templates.Fill(text, values), nil
+}
+
+// Add this new function to save conversation logs
+func saveConversationLog(logPath string, content string) error {
+    // Create directory if it doesn't exist
+    dir := filepath.Dir(logPath)
+    if err := os.MkdirAll(dir, 0755); err != nil {
+        return fmt.Errorf("failed to create directory: %v", err)
+    }
+
+    // Write the content to the file
+    if err := os.WriteFile(logPath, []byte(content), 0644); err != nil {
+        return fmt.Errorf("failed to save conversation log: %v", err)
+    }
+
+    return nil
+}
+
+// Where transcripts of agents with auto_save go when they have no save_dir
+const defaultSaveDir = "transcripts"
+
+// autoSavePath returns where a chat is saved when one of its agents has auto_save set: a file
+// named after the time and the agents, in the save_dir of the first agent saving, or in
+// ~/.chatty/transcripts. It is empty when none of the agents auto-saves
+func autoSavePath(participants ...agents.AgentConfig) string {
+    dir := ""
+    saving := false
+    var names []string
+    for _, agent := range participants {
+        names = append(names, strings.ReplaceAll(strings.ToLower(agent.Name), " ", "_"))
+        if agent.AutoSave && !saving {
+            saving = true
+            dir = agent.SaveDir
+        }
+    }
+    if !saving {
+        return ""
+    }
+
+    if strings.HasPrefix(dir, "~/") {
+        if home, err := os.UserHomeDir(); err == nil {
+            dir = filepath.Join(home, dir[2:])
+        }
+    }
+    if dir == "" {
+        dataDir, err := appdir.DataDir()
+        if err != nil {
+            return ""
+        }
+        dir = filepath.Join(dataDir, defaultSaveDir)
+    }
+    base := filepath.Join(dir, time.Now().Format("2006-01-02_15-04-05")+"_"+strings.Join(names, "_"))
+    path := base + ".txt"
+    for i := 2; ; i++ {
+        if _, err := os.Stat(path); os.IsNotExist(err) {
+            return path
+        }
+        path = fmt.Sprintf("%s_%d.txt", base, i) // Another chat started the same second
+    }
+}
+
+// Image formats accepted by multimodal models
+var supportedImageTypes = map[string]bool{
+    "image/png":  true,
+    "image/jpeg": true,
+    "image/gif":  true,
+    "image/webp": true,
+    "image/bmp":  true,
+}
+
+// loadImages reads image files and base64 encodes them for the chat request
+func loadImages(paths []string) ([]string, error) {
+    var images []string
+    for _, path := range paths {
+        data, err := os.ReadFile(path)
+        if err != nil {
+            return nil, fmt.Errorf("failed to read image: %v", err)
+        }
+        if contentType := http.DetectContentType(data); !supportedImageTypes[contentType] {
+            return nil, fmt.Errorf("%s is not a supported image (detected %s)", path, contentType)
+        }
+        images = append(images, base64.StdEncoding.EncodeToString(data))
+    }
+    return images, nil
+}
+
+// withoutImages returns a copy of the history without image data, which is too large to keep on disk
+func withoutImages(history []Message) []Message {
+    stripped := make([]Message, len(history))
+    for i, msg := range history {
+        msg.Images = nil
+        stripped[i] = msg
+    }
+    return stripped
+}
+
+// attachmentOptions collects the --url, --file, and --ocr arguments of a command
+type attachmentOptions struct {
+    urls  []string
+    files []string
+    ocr   bool // Extract the text of attached images
+}
+
+// loadAttachments fetches the attached pages and files and formats them as reference material for a prompt
+func loadAttachments(options attachmentOptions) (string, error) {
+    if options.ocr && len(options.files) == 0 {
+        return "", fmt.Errorf("--ocr needs an image attached with --file")
+    }
+
+    var docs []attach.Document
+    for _, url := range options.urls {
+        fmt.Printf("🔗 Fetching %s\n", url)
+        doc, err := attach.FetchURL(url)
+        if err != nil {
+            return "", err
+        }
+        docs = append(docs, doc)
+    }
+
+    if len(options.files) > 0 {
+        var visionModel string
+        if config, err := agents.GetCurrentConfig(); err == nil {
+            visionModel = config.OCRModel
+        }
+        for _, path := range options.files {
+            fmt.Printf("📄 Reading %s\n", path)
+            doc, err := attach.ReadFile(path, options.ocr, visionModel)
+            if err != nil {
+                return "", err
+            }
+            docs = append(docs, doc)
+        }
+    }
+
+    // Exchanges recalled with --recall come along with the attachments
+    reference := attach.FormatContext(docs)
+    if recalledExchanges != "" {
+        if reference != "" {
+            reference += "\n\n"
+        }
+        reference += recalledExchanges
+    }
+    return reference, nil
+}
+
+// copyLastCodeBlock copies the last code block from an agent's most recent response to the clipboard
+func copyLastCodeBlock(agentName string) error {
+    if agentName != "" {
+        if !agents.IsValidAgent(agentName) {
+            return failure.New(failure.InvalidAgent, "invalid agent name: %s", agentName)
+        }
+        currentAgent = agents.GetAgentConfig(agentName)
+    }
+
+    history, err := loadHistory()
+    if err != nil {
+        return fmt.Errorf("failed to load history: %v", err)
+    }
+
+    // Walk back through the history to find the latest response containing code
+    for i := len(history) - 1; i >= 0; i-- {
+        if history[i].Role != "assistant" {
+            continue
+        }
+        blocks := render.ExtractCodeBlocks(history[i].Content)
+        if len(blocks) == 0 {
+            continue
+        }
+
+        block := blocks[len(blocks)-1]
+        if err := render.CopyToClipboard(block.Code); err != nil {
+            return err
+        }
+
+        language := block.Language
+        if language == "" {
+            language = "plain text"
+        }
+        lines := strings.Count(block.Code, "\n") + 1
+        fmt.Printf("%s✓%s Copied %d line(s) of %s from %s's last code block to the clipboard\n",
+            theme.Current().Success, colorReset, lines, language, currentAgent.Name)
+        return nil
+    }
+
+    return fmt.Errorf("no code blocks found in %s's chat history", currentAgent.Name)
+}
+
+// loadTranscript builds an exportable transcript from an agent's chat history or a saved conversation log
+func loadTranscript(source string) (export.Transcript, error) {
+    if info, err := os.Stat(source); err == nil && !info.IsDir() {
+        content, err := os.ReadFile(source)
+        if err != nil {
+            return export.Transcript{}, fmt.Errorf("failed to read conversation log: %v", err)
+        }
+        title := strings.TrimSuffix(filepath.Base(source), filepath.Ext(source))
+        return export.Transcript{
+            Title:   "Conversation: " + title,
+            Entries: parseConversationLog(string(content)),
+        }, nil
+    }
+
+    if !agents.IsValidAgent(source) {
+        return export.Transcript{}, fmt.Errorf("'%s' is neither an agent nor a conversation log file", source)
+    }
+
+    agent := agents.GetAgentConfig(source)
+    historyPath, err := getHistoryPathForAgent(agent.Name)
+    if err != nil {
+        return export.Transcript{}, err
+    }
+    history, err := readHistory(historyPath)
+    if err != nil {
+        return export.Transcript{}, err
+    }
+    if len(history) == 0 {
+        return export.Transcript{}, fmt.Errorf("no chat history found for %s", agent.Name)
+    }
+
+    transcript := export.Transcript{Title: "Chat with " + agent.Name}
+    for _, msg := range history {
+        switch msg.Role {
+        case "user":
+            transcript.Entries = append(transcript.Entries, export.Entry{Speaker: userName, Text: msg.Content})
+        case "assistant":
+            transcript.Entries = append(transcript.Entries, export.Entry{Speaker: agent.Name, Color: agent.LabelColor, Voice: agent.Voice, Text: msg.Content})
+        }
+    }
+    return transcript, nil
+}
+
+// labelPattern matches a rendered label at the start of a line, with or without emojis
+func labelPattern(template, emoji, name string) *regexp.Regexp {
+    emojiPattern := regexp.QuoteMeta(theme.Badge(name))
+    if emoji != "" {
+        emojiPattern = "(?:" + regexp.QuoteMeta(emoji) + "|" + emojiPattern + ")"
+    }
+    pattern := strings.NewReplacer(
+        regexp.QuoteMeta("{emoji}"), emojiPattern,
+        regexp.QuoteMeta("{name}"), regexp.QuoteMeta(name),
+        regexp.QuoteMeta("{time}"), `\d{1,2}:\d{2}`,
+    ).Replace(regexp.QuoteMeta(template))
+    return regexp.MustCompile("^" + pattern)
+}
+
+// parseConversationLog splits a log written with --save into messages, using the label of each line
+func parseConversationLog(content string) []export.Entry {
+    type speaker struct {
+        entry   export.Entry
+        pattern *regexp.Regexp
+    }
+
+    speakers := []speaker{{
+        entry:   export.Entry{Speaker: userName},
+        pattern: labelPattern(userLabelTemplate, userEmoji, userName),
+    }}
+    for _, name := range agents.GetAllAgentNames() {
+        agent := agents.GetAgentConfig(name)
+        speakers = append(speakers, speaker{
+            entry:   export.Entry{Speaker: agent.Name, Color: agent.LabelColor, Voice: agent.Voice},
+            pattern: labelPattern(agentLabelTemplate, agent.Emoji, agent.Name),
+        })
+    }
+
+    var entries []export.Entry
+    for _, line := range strings.Split(content, "\n") {
+        matched := false
+        for _, s := range speakers {
+            if label := s.pattern.FindString(line); label != "" {
+                entry := s.entry
+                entry.Text = strings.TrimPrefix(line, label)
+                entries = append(entries, entry)
+                matched = true
+                break
+            }
+        }
+        if matched {
+            continue
+        }
+        if len(entries) == 0 {
+            if strings.TrimSpace(line) == "" {
+                continue
+            }
+            entries = append(entries, export.Entry{})
+        }
+        entries[len(entries)-1].Text += "\n" + line
+    }
+    return entries
+}
+
+// exportConversation writes an agent's chat history or a conversation log to a file
+func exportConversation(source, format, output string) error {
+    transcript, err := loadTranscript(source)
+    if err != nil {
+        return err
+    }
+
+    if output == "" {
+        base := filepath.Base(source)
+        if agents.IsValidAgent(source) {
+            base = strings.ReplaceAll(strings.ToLower(source), " ", "_") + "_chat"
+        }
+        output = strings.TrimSuffix(base, filepath.Ext(base)) + "." + format
+    }
+
+    // Audio exports read each message with the speaker's voice
+    tts := speaker
+    if format == export.FormatWAV && tts == nil {
+        engine, voice := "", ""
+        if config, err := agents.GetCurrentConfig(); err == nil {
+            engine, voice = config.TTSEngine, config.TTSVoice
+        }
+        if tts, err = speech.NewSpeaker(engine, voice); err != nil {
+            return err
+        }
+    }
+
+    if err := export.Write(output, format, transcript, tts); err != nil {
+        return err
+    }
+    fmt.Printf("%s✓%s Exported %d message(s) to %s%s%s\n",
+        theme.Current().Success, colorReset, len(transcript.Entries),
+        theme.Current().Value, output, colorReset)
+    return nil
+}
+
+// Add a new function to handle single-agent chat
+func handleSingleAgentChat(agentName string, starter string, saveFile string, listen bool, imagePaths []string, reference string) error {
+    // Validate agent exists
+    if !agents.IsValidAgent(agentName) {
+        return failure.New(failure.InvalidAgent, "invalid agent name: %s", agentName)
+    }
+
+    // The history is held for the whole chat, which saves to it when it ends
+    lock, err := lockHistoryFile(agents.GetAgentConfig(agentName).Name)
+    if err != nil {
+        return err
+    }
+    defer lock.Release()
+
+    // Agents with auto_save keep a transcript without --save
+    if saveFile == "" {
+        saveFile = autoSavePath(agents.GetAgentConfig(agentName))
+    }
+
+    // Images are attached to the first user message
+    pendingImages, err := loadImages(imagePaths)
+    if err != nil {
+        return err
+    }
+
+    // Set up voice input
+    var listener *speech.Listener
+    if listen {
+        command, model := "", ""
+        if config, err := agents.GetCurrentConfig(); err == nil {
+            command, model = config.STTCommand, config.STTModel
+        }
+        listener, err = speech.NewListener(command, model)
+        if err != nil {
+            return err
+        }
+    }
+    
+    // Get agent configuration
+    agent := agents.GetAgentConfig(agentName)
+
+    // Index the agent's knowledge directory before the chat starts
+    agentKnowledge(agent)
+    
+    // Print welcome message
+    fmt.Printf("\n💬 Chat with %s %s\n", theme.AgentEmoji(agent.Emoji, agent.Name), agent.Name)
+    fmt.Printf("%s\n", agent.Description)
+
+    // Show exit message at the beginning of the chat
+    fmt.Println()
+    if listener != nil {
+        fmt.Printf("Press Enter with empty message to speak, or type %s to end the conversation", listenExitCommand)
+    } else {
+        fmt.Printf("Press Enter with empty message to end the conversation")
+    }
+    fmt.Println()
+    fmt.Printf("%sType %s on a line of its own to write a message of several lines, ending with another %s, or press %s for %s to answer again%s\n", theme.Current().Muted, term.BlockDelimiter, term.BlockDelimiter, keys.Label(keys.Regenerate), agent.Name, colorReset)
+    
+    // Initialize conversation log
+    var conversationLog strings.Builder
+    if starter != "" {
+        conversationLog.WriteString(formatUserLabel() + starter + "\n")
+    }
+    
+    // Try to load existing history for this agent
+    historyPath, err := getHistoryPathForAgent(agentName)
+    var history []Message
+    
+    if err == nil {
+        if existingHistory, err := readHistory(historyPath); err == nil && len(existingHistory) > 0 {
+            // Successfully loaded history
+            history = existingHistory
 
-        // Check for stop signal before starting a new turn
-        select {
-        case <-globalStopChan:
-            fmt.Printf("\n\nConversation ended after %s\n",
-                formatElapsedTime(state.startTime, time.Now()))
-            os.Exit(0)
-        default:
+            // Earlier sessions are covered by the memory summary, so only replay the latest messages
+            if loadAgentSummary(agent).Text != "" && len(history) > recentMessagesWithSummary {
+                history = history[len(history)-recentMessagesWithSummary:]
+            }
         }
+    }
+    
+    // If no history was loaded, initialize with system message
+    if len(history) == 0 {
+        history = []Message{{
+            Role:    "system",
+            Content: buildSystemMessage(agent, false, ""),
+        }}
+    } else {
+        // Prepend system message to existing history
+        history = append([]Message{{
+            Role:    "system",
+            Content: buildSystemMessage(agent, false, ""),
+        }}, history...)
+    }
+    // Only the messages of this conversation are added to the saved history
+    savedMessages := len(history)
+    
+    // Attached material is sent ahead of the first message
+    if reference != "" {
+        history = append(history, Message{
+            Role:    "user",
+            Content: reference,
+        })
+    }
 
-        // Print turn header with improved structure
-        elapsed := formatElapsedTime(state.startTime, state.lastActive)
+    // Messages typed by the user, for the long-term memory
+    var userMessages []string
+
+    // Add starter message if provided
+    currentMessage := starter
+    if currentMessage != "" {
+        userMessages = append(userMessages, currentMessage)
+        history = append(history, Message{
+            Role:    "user",
+            Content: currentMessage,
+            Images:  pendingImages,
+        })
+        pendingImages = nil
         
-        // Add single blank line before the top separator
-        fmt.Println()
+        // Print the starter message
+        fmt.Println(colorize(formatUserMessage(currentMessage), theme.Current().User))
+        fmt.Println()  // Single blank line after user message
+    }
+    
+    // Create a reader for user input
+    reader := stdin
+
+    // Edits to config.json and the agents apply from the next message
+    watcher := agents.NewWatcher()
+
+    // Where the last answer starts in the log, which drops it when it is regenerated
+    answerStart := 0
+    
+    for {
+        // If we have a current message, get agent's response
+        if currentMessage != "" {
+            // Start animation
+            anim := startConversationAnimation(agent)
+            
+            // Add instruction message
+            history = append(history, Message{
+                Role:    "user",
+                Content: "Respond naturally as part of this conversation and do not add prefixes like '<Your name> said:' to your messages.",
+            })
+            
+            // Prepare the request
+            knowledge := retrieveKnowledge(agent, currentMessage)
+            chatReq := ChatRequest{
+                Model:    agents.GetCurrentModel(),
+                Messages: withKnowledge(history, formatKnowledge(knowledge)),
+                Stream:   true,
+                KeepAlive: keepAlive,
+                Tools:    availableTools(agent),
+            }
+            
+            // Make the API request with retry and process the response, running any tools the agent calls
+            fullResponseText, err := chatWithTools(chatReq, agent, anim, true)
+            if err != nil {
+                return fmt.Errorf("error processing response: %w", err)
+            }
+            
+            // Update conversation log
+            answerStart = conversationLog.Len()
+            conversationLog.WriteString(agentLogEntry(agent, fullResponseText))
+            
+            // Show the documents the response is based on
+            printCitations(fullResponseText, knowledge)
+
+            // Show the translation and read the response aloud
+            translateResponse(fullResponseText)
+            speakResponse(agent, fullResponseText)
+            
+            // Add the response to history
+            history = append(history, Message{
+                Role:    "assistant",
+                Content: fullResponseText,
+            })
+            
+            // Remove the instruction message
+            if len(history) >= 2 && history[len(history)-2].Role == "user" && 
+               history[len(history)-2].Content == "Respond naturally as part of this conversation and do not add prefixes like '<Your name> said:' to your messages." {
+                // Remove the instruction message
+                history = append(history[:len(history)-2], history[len(history)-1])
+            }
+            
+            fmt.Println()  // Single blank line after response
+        }
         
-        // Print top separator
-        fmt.Printf("%s%s%s\n", turnSeparatorColor, strings.Repeat("─", 60), colorReset)
+        // Add a blank line before prompting for user input
+        fmt.Println()
+
+        // Pick up edits made during the chat, which may change the agent's system message
+        if changes := reloadChanges(watcher); !changes.Empty() && agents.IsValidAgent(agentName) {
+            agent = agents.GetAgentConfig(agentName)
+            history[0].Content = buildSystemMessage(agent, false, "")
+        }
         
-        // Print turn information
-        fmt.Printf("%s%s Conversation Turn%s %s%d%s\n",
-            turnColor, turnEmoji, colorReset,
-            turnNumberColor, currentTurn, colorReset)
+        // Prompt for user input
+        newMessage, err := readChatMessage()
+        if errors.Is(err, term.ErrRegenerate) {
+            // The last answer is dropped, and the message it answered is sent again
+            last := len(history) - 1
+            if last-1 < savedMessages || history[last].Role != "assistant" || history[last-1].Role != "user" {
+                fmt.Printf("%sThere is no answer to regenerate yet%s\n", theme.Current().Muted, colorReset)
+                currentMessage = ""
+                continue
+            }
+            history = history[:last]
+            currentMessage = history[last-1].Content
+            kept := conversationLog.String()[:answerStart]
+            conversationLog.Reset()
+            conversationLog.WriteString(kept)
+            fmt.Printf("%s🔁 %s answers again%s\n\n", theme.Current().Accent, agent.Name, colorReset)
+            continue
+        }
+        if err != nil {
+            return fmt.Errorf("error reading input: %v", err)
+        }
         
-        // Print time information with better structure and local timezone
-        localStartTime := state.startTime.Local()
+        // Trim whitespace
+        currentMessage = strings.TrimSpace(newMessage)
         
-        // Format timezone as GMT±X
-        _, offset := localStartTime.Zone()
-        var gmtOffset string
-        if offset >= 0 {
-            gmtOffset = fmt.Sprintf("GMT+%d", offset/3600)
-        } else {
-            gmtOffset = fmt.Sprintf("GMT%d", offset/3600)
+        // In listen mode an empty message records from the microphone
+        if listener != nil {
+            if currentMessage == "" {
+                currentMessage, err = listenForMessage(listener, reader)
+                if err != nil {
+                    fmt.Printf("\n⚠️ %v\n", err)
+                    continue
+                }
+                if currentMessage == "" {
+                    fmt.Println("\nNothing was heard, please try again.")
+                    continue
+                }
+                fmt.Println(colorize(formatUserMessage(currentMessage), theme.Current().User))
+            } else if currentMessage == listenExitCommand {
+                currentMessage = ""
+            }
         }
         
-        fmt.Printf("%s%sStarted:%s %s%s %s\n",
-            timeHeaderColor,
-            timeHeaderColor, colorReset,
-            timeValueColor,
-            localStartTime.Format("2006-01-02 15:04:05 ")+gmtOffset,
-            colorReset)
+        // Check for exit
+        if currentMessage == "" {
+            fmt.Println("\nConversation ended.")
             
-        fmt.Printf("%s%sElapsed:%s %s%s%s\n",
-            timeHeaderColor,
-            timeHeaderColor, colorReset,
-            timeValueColor, elapsed,
-            colorReset)
+            // Save conversation history for the agent
+            historyPath, err := getHistoryPathForAgent(agentName)
+            if err == nil {
+                // Filter out system messages and special instruction messages before saving
+                var filteredHistory []Message
+                for _, msg := range history[savedMessages:] {
+                    if msg.Role == "system" || 
+                       (msg.Role == "user" && msg.Content == "Respond naturally as part of this conversation and do not add prefixes like '<Your name> said:' to your messages.") {
+                        continue
+                    }
+                    filteredHistory = append(filteredHistory, msg)
+                }
+                
+                // Save the filtered history
+                if err := appendHistory(historyPath, 0644, filteredHistory...); err != nil {
+                    fmt.Printf("Warning: Failed to save conversation history: %v\n", err)
+                }
+            }
             
-        // Print bottom separator
-        fmt.Printf("%s%s%s\n", turnSeparatorColor, strings.Repeat("─", 60), colorReset)
+            // Save conversation log to file if requested
+            if saveFile != "" {
+                if err := saveConversationLog(saveFile, conversationLog.String()); err != nil {
+                    fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
+                } else {
+                    fmt.Printf("Conversation log saved to: %s\n", saveFile)
+                }
+            }
+
+            rememberUserFacts(userMessages)
+            if len(userMessages) > 0 {
+                summarizeSession(agent, conversationLog.String())
+            }
+            return nil
+        }
+        
+        // Update conversation log
+        conversationLog.WriteString(formatUserLabel() + currentMessage + "\n")
+        userMessages = append(userMessages, currentMessage)
+        
+        // Add user message to history
+        history = append(history, Message{
+            Role:    "user",
+            Content: currentMessage,
+            Images:  pendingImages,
+        })
+        pendingImages = nil
+        
+        fmt.Println()  // Single blank line after user input
+    }
+}
+
+// listenExitCommand ends a chat in listen mode, where an empty message starts recording
+const listenExitCommand = "/exit"
+
+// listenForMessage records the user's voice until Enter is pressed and returns the transcription
+func listenForMessage(listener *speech.Listener, reader *bufio.Reader) (string, error) {
+    fmt.Printf("%s🎤 Listening... press Enter to stop%s", theme.Current().Emphasis, colorReset)
+    text, err := listener.Listen(func() {
+        reader.ReadString('\n')
+    })
+    fmt.Print("\r\033[K")
+    return text, err
+}
+
+// Update the main function to handle the new command
+// defaultServePort is where chatty serve listens unless --port says otherwise
+const defaultServePort = 8080
+
+// chattyBackend gives API clients the installed agents, their histories and chats with them.
+// Requests without a session token go through the same global state as the terminal, so they
+// run one at a time. Sessions keep their own histories and run side by side
+type chattyBackend struct {
+    mu sync.Mutex
+
+    historyLocksMu sync.Mutex
+    historyLocks   map[string]*sync.Mutex
+
+    interjectMu sync.Mutex
+    interjected map[string]bool // Sessions whose group chat round stops after the agent answering
+}
+
+// sessionsDir is where the histories of API sessions are kept, in a directory per session
+const sessionsDir = "sessions"
+
+// defaultAgentName returns the agent selected with --select, used when a request names none
+func defaultAgentName() string {
+    config, err := agents.GetCurrentConfig()
+    if err != nil || config.CurrentAgent == "" || !agents.IsValidAgent(config.CurrentAgent) {
+        return agents.GetDefaultAgent().Name
+    }
+    return agents.GetAgentConfig(config.CurrentAgent).Name
+}
+
+// historyPath returns the history file of an agent, in the session's own directory for sessions.
+// Directories are named after a hash of the token, so tokens aren't stored on disk
+func (b *chattyBackend) historyPath(session, agentName string) (string, error) {
+    if session == "" {
+        return getHistoryPathForAgent(agentName)
+    }
+    dataDir, err := appdir.DataDir()
+    if err != nil {
+        return "", err
+    }
+    sum := sha256.Sum256([]byte(session))
+    name := agents.GetHistoryFileName(agentName)
+    return filepath.Join(dataDir, sessionsDir, hex.EncodeToString(sum[:8]), name), nil
+}
+
+// lockHistory holds a history file until the returned function is called, so each exchange
+// is read and saved whole
+func (b *chattyBackend) lockHistory(path string) func() {
+    b.historyLocksMu.Lock()
+    if b.historyLocks == nil {
+        b.historyLocks = make(map[string]*sync.Mutex)
+    }
+    lock, ok := b.historyLocks[path]
+    if !ok {
+        lock = &sync.Mutex{}
+        b.historyLocks[path] = lock
+    }
+    b.historyLocksMu.Unlock()
+
+    lock.Lock()
+    return lock.Unlock
+}
+
+// lockOwner serializes requests without a session, which share the terminal's global state
+func (b *chattyBackend) lockOwner(session string) func() {
+    if session != "" {
+        return func() {}
+    }
+    b.mu.Lock()
+    return b.mu.Unlock
+}
+
+// systemMessage returns an agent's system message for a request. What chatty remembers about
+// the person running it is left out of sessions
+func (b *chattyBackend) systemMessage(session string, agent agents.AgentConfig, participants string) string {
+    if session != "" {
+        return agent.GetFullSystemMessage(false, participants)
+    }
+    return buildSystemMessage(agent, false, participants)
+}
+
+// readHistory returns the messages stored in a history file, nil when there is none. Histories
+// saved as a JSON array by earlier versions are converted, and files with damaged lines, left by
+// a save that was cut short, or too large are compacted
+func readHistory(path string) ([]Message, error) {
+    defer profile.Time("history reads")()
+    data, err := os.ReadFile(path)
+    if os.IsNotExist(err) {
+        return readLegacyHistory(path)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read chat history: %v", err)
+    }
+
+    var history []Message
+    damaged := false
+    for _, line := range bytes.Split(data, []byte("\n")) {
+        if len(bytes.TrimSpace(line)) == 0 {
+            continue
+        }
+        var msg Message
+        if err := json.Unmarshal(line, &msg); err != nil || msg.Role == "system" {
+            damaged = true
+            continue
+        }
+        history = append(history, msg)
+    }
+    compact := len(history) > maxHistoryMessages || len(data) > maxHistoryBytes
+    if compact {
+        history = latestHistory(history)
+    }
+    if damaged || compact {
+        info, err := os.Stat(path)
+        if err == nil {
+            err = writeHistory(path, info.Mode().Perm(), history)
+        }
+        if err != nil {
+            return nil, fmt.Errorf("failed to compact chat history: %v", err)
+        }
+    }
+    return history, nil
+}
+
+// readLegacyHistory converts the history saved as a JSON array next to path, if there is one
+func readLegacyHistory(path string) ([]Message, error) {
+    legacyPath := strings.TrimSuffix(path, filepath.Ext(path)) + ".json"
+    data, err := os.ReadFile(legacyPath)
+    if os.IsNotExist(err) {
+        return nil, nil
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to read chat history: %v", err)
+    }
+    var history []Message
+    if err := json.Unmarshal(data, &history); err != nil {
+        return nil, fmt.Errorf("failed to parse chat history: %v", err)
+    }
+
+    info, err := os.Stat(legacyPath)
+    if err == nil {
+        err = writeHistory(path, info.Mode().Perm(), history)
+    }
+    if err != nil {
+        return nil, fmt.Errorf("failed to convert chat history: %v", err)
+    }
+    os.Remove(legacyPath)
+    return readHistory(path)
+}
+
+// appendHistory adds messages to the end of a history file, creating it with perm
+func appendHistory(path string, perm os.FileMode, messages ...Message) error {
+    defer profile.Time("history appends")()
+    data, err := encodeHistory(messages)
+    if err != nil || len(data) == 0 {
+        return err
+    }
+    file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, perm)
+    if err != nil {
+        return err
+    }
+    defer file.Close()
+
+    // Start on a line of its own when the last save was cut short
+    if info, err := file.Stat(); err == nil && info.Size() > 0 {
+        last := make([]byte, 1)
+        if _, err := file.ReadAt(last, info.Size()-1); err == nil && last[0] != '\n' {
+            data = append([]byte("\n"), data...)
+        }
+    }
+    if _, err := file.Write(data); err != nil {
+        return err
+    }
+    // A message reported as saved stays saved after a crash
+    if err := file.Sync(); err != nil {
+        return err
+    }
+    info, statErr := file.Stat()
+    if err := file.Close(); err != nil {
+        return err
+    }
+    if statErr == nil && info.Size() > maxHistoryBytes {
+        _, err := readHistory(path)
+        return err
+    }
+    return nil
+}
 
-        // In auto mode, print the user's message
-        if !config.AutoMode {
-            fmt.Println(colorize(formatUserMessage(currentMessage), "\033[1;36m"))
-            fmt.Println()  // Single blank line after user message
-        } else {
-            fmt.Println()  // Single blank line after separator for auto mode
+// latestHistory returns the latest messages of a history, as many as keptHistoryMessages in half
+// of maxHistoryBytes, starting with a message of the user rather than an answer to nothing
+func latestHistory(history []Message) []Message {
+    start, size := len(history), 0
+    for start > 0 && len(history)-start < keptHistoryMessages {
+        size += len(history[start-1].Content)
+        if size > maxHistoryBytes/2 {
+            break
         }
+        start--
+    }
+    for i := start; i < len(history); i++ {
+        if history[i].Role == "user" {
+            return history[i:]
+        }
+    }
+    return history[start:]
+}
 
-        // Update conversation log with user message first (except for the first turn)
-        if firstMessage {
-            // First message is already in the log from initialization
-            firstMessage = false
-            
-            // Print the first message in auto mode
-            if config.AutoMode {
-                fmt.Println(colorize(formatUserMessage(currentMessage), "\033[1;36m"))
-                fmt.Println()  // Single blank line after user message
-            }
-        } else {
-            // For non-auto mode, add the user's new message to the conversation log and shared history
-            if !config.AutoMode {
-                // Add user message to conversation log
-                conversationLog.WriteString(fmt.Sprintf("👤 User: %s\n", currentMessage))
-                
-                // Add the user message to the shared history
-                sharedHistory = append(sharedHistory, Message{
-                    Role:    "user",
-                    Content: currentMessage,
-                })
-            }
-            // For auto mode, we don't add a new user message after the first turn
+// writeHistory replaces a history file with messages. The file is swapped whole, so a crash or
+// Ctrl+C while saving leaves either the old history or the new one, never part of it
+func writeHistory(path string, perm os.FileMode, messages []Message) error {
+    defer profile.Time("history rewrites")()
+    data, err := encodeHistory(messages)
+    if err != nil {
+        return err
+    }
+    return atomicfile.WriteFile(path, data, perm)
+}
+
+// encodeHistory formats messages as history lines, one per message, leaving out system messages
+// and image data, which is too large to keep on disk
+func encodeHistory(messages []Message) ([]byte, error) {
+    var buf bytes.Buffer
+    for _, msg := range withoutImages(messages) {
+        if msg.Role == "system" {
+            continue
+        }
+        line, err := json.Marshal(msg)
+        if err != nil {
+            return nil, err
         }
+        buf.Write(line)
+        buf.WriteByte('\n')
+    }
+    return buf.Bytes(), nil
+}
 
-        // Process each agent's response in this turn
-        for i, agent := range agentConfigs {
-            // Check for stop signal before each agent's response
-            select {
-            case <-globalStopChan:
-                fmt.Printf("\n\nConversation ended after %s\n",
-                    formatElapsedTime(state.startTime, time.Now()))
-                os.Exit(0)
-            default:
-            }
+// apiAgent describes an installed agent to API clients
+func apiAgent(agent agents.AgentConfig, current string) server.Agent {
+    return server.Agent{
+        Name:        agent.Name,
+        Description: agent.Description,
+        Emoji:       agent.Emoji,
+        Tags:        agent.Tags,
+        Source:      agent.Source,
+        Current:     agent.Name == current,
+    }
+}
 
-            // In auto mode, only add margin between agent responses
-            if i > 0 {
-                for i := 0; i < converseMargin; i++ {
-                    fmt.Println()
-                }
-            }
-            
-            // Start animation with correct agent
-            anim := startConversationAnimation(agent)
+// Agents lists the installed agents
+func (b *chattyBackend) Agents() []server.Agent {
+    current := defaultAgentName()
+    var list []server.Agent
+    for _, name := range agents.GetEnabledAgentNames() {
+        list = append(list, apiAgent(agents.GetAgentConfig(name), current))
+    }
+    return list
+}
 
-            // Build participants list excluding current agent
-            var participants strings.Builder
-            for j, other := range agentConfigs {
-                if j != i {  // Skip current agent
-                    if j > 0 {
-                        participants.WriteString(" ")
-                    }
-                    participants.WriteString(fmt.Sprintf("%d. %s (%s) - %s", 
-                        j+1, 
-                        other.Name, 
-                        other.Emoji,
-                        other.Description))
-                }
-            }
-            if !config.AutoMode {
-                if participants.Len() > 0 {
-                    participants.WriteString(" ")
-                }
-                participants.WriteString(fmt.Sprintf("%d. User (👤) - Human participant guiding the conversation", 
-                    len(agentConfigs)))
-            }
+// History returns the messages exchanged with an agent, without its system message
+func (b *chattyBackend) History(session, name string) ([]server.Message, error) {
+    if !agents.IsValidAgent(name) {
+        return nil, fmt.Errorf("agent '%s' %w", name, server.ErrNotFound)
+    }
+    path, err := b.historyPath(session, agents.GetAgentConfig(name).Name)
+    if err != nil {
+        return nil, err
+    }
+    unlock := b.lockHistory(path)
+    history, err := readHistory(path)
+    unlock()
+    if err != nil {
+        return nil, err
+    }
 
-            // Update the system message with the participants list
-            histories[i][0] = Message{
-                Role:    "system",
-                Content: agent.GetFullSystemMessage(config.AutoMode, participants.String()),
-            }
+    var messages []server.Message
+    for _, msg := range history {
+        if msg.Role == "user" || msg.Role == "assistant" {
+            messages = append(messages, server.Message{Role: msg.Role, Content: msg.Content})
+        }
+    }
+    return messages, nil
+}
 
-            // Build this agent's history from the shared history
-            agentHistory := []Message{histories[i][0]} // Start with the system message
-            
-            // Add all messages from the shared history
-            agentHistory = append(agentHistory, sharedHistory...)
-            
-            // Add a final user message instructing the agent to respond naturally
-            // Check if the last message is already an instruction
-            lastMsgIndex := len(agentHistory) - 1
-            
-            // Always add an instruction message to ensure consistent behavior
-            if lastMsgIndex >= 0 && agentHistory[lastMsgIndex].Role == "user" && 
-               (agentHistory[lastMsgIndex].Content == "Please respond naturally as part of this conversation." ||
-                agentHistory[lastMsgIndex].Content == "Respond naturally as part of this conversation and do not add prefixes like '/<Your name/> said:' to your messages.") {
-                // Replace the last message with our instruction
-                agentHistory[lastMsgIndex] = Message{
-                    Role:    "user",
-                    Content: "Respond naturally as part of this conversation and do not add prefixes like '/<Your name/> said:' to your messages.",
-                }
-            } else {
-                // Add a new instruction message
-                agentHistory = append(agentHistory, Message{
-                    Role:    "user",
-                    Content: "Respond naturally as part of this conversation and do not add prefixes like '</Your name/> said:' to your messages.",
-                })
-            }
+// Chat continues the conversation with an agent, saving the exchange to its history like a chat in the terminal
+func (b *chattyBackend) Chat(session, name, message string, onChunk func(chunk string)) (string, string, error) {
+    agent, err := chatAgent(name)
+    if err != nil {
+        return "", "", err
+    }
+    if session != "" {
+        return b.sessionChat(session, agent, message, onChunk)
+    }
+    return b.ownerChat(agent, message, false, onChunk)
+}
 
-            // Ensure we don't exceed the token limit
-            if len(agentHistory) > maxMessagesPerAgent {
-                // Keep the system message and the most recent messages
-                agentHistory = append([]Message{agentHistory[0]}, agentHistory[len(agentHistory)-maxMessagesPerAgent+1:]...)
-            }
+// Regenerate has an agent answer the last message of the user's own history with it again,
+// replacing its last answer. Sessions can't, as the TUI is the only one asking
+func (b *chattyBackend) Regenerate(session, name string, onChunk func(chunk string)) (string, string, error) {
+    if session != "" {
+        return "", "", fmt.Errorf("answers can only be regenerated without a session: %w", server.ErrInvalid)
+    }
+    agent, err := chatAgent(name)
+    if err != nil {
+        return "", "", err
+    }
+    return b.ownerChat(agent, "", true, onChunk)
+}
 
-            // Prepare the request with full conversation history
-            chatReq := ChatRequest{
-                Model:    agents.GetCurrentModel(),
-                Messages: agentHistory,
-                Stream:   true,
-                KeepAlive: keepAlive,
-            }
+// chatAgent returns the agent a chat request names, the current one when it names none
+func chatAgent(name string) (agents.AgentConfig, error) {
+    if name == "" {
+        name = defaultAgentName()
+    }
+    if !agents.IsValidAgent(name) {
+        return agents.AgentConfig{}, fmt.Errorf("agent '%s' %w", name, server.ErrNotFound)
+    }
+    if err := checkEnabled(name); err != nil {
+        return agents.AgentConfig{}, fmt.Errorf("%v: %w", err, server.ErrConflict)
+    }
+    return agents.GetAgentConfig(name), nil
+}
 
-            jsonData, err := json.Marshal(chatReq)
-            if err != nil {
-                anim.stopAnimation()
-                return fmt.Errorf("error marshaling request for %s: %v", agent.Name, err)
-            }
+// ownerChat continues the user's own conversation with an agent, the one chats in the terminal
+// have, with a message or by answering the last one again when regenerate is set
+func (b *chattyBackend) ownerChat(agent agents.AgentConfig, message string, regenerate bool, onChunk func(chunk string)) (string, string, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    path, err := b.historyPath("", agent.Name)
+    if err != nil {
+        return agent.Name, "", err
+    }
+    defer b.lockHistory(path)()
+    lock, err := lockHistoryFile(agent.Name)
+    if err != nil {
+        return agent.Name, "", fmt.Errorf("%w: %v", server.ErrConflict, err)
+    }
+    defer lock.Release()
 
-            // Make the API request with retry
-            resp, err := makeAPIRequestWithRetry(jsonData, agent.Name)
-            if err != nil {
-                anim.stopAnimation()
-                return fmt.Errorf("error making request for %s: %v", agent.Name, err)
-            }
+    previous := currentAgent
+    currentAgent = agent
+    defer func() { currentAgent = previous }()
 
-            // Process the response
-            fullResponseText, err := processStreamResponse(resp, anim)
-            if err != nil {
-                // Check if this was due to a stop signal
-                if config.AutoMode {
-                    select {
-                    case <-globalStopChan:
-                        fmt.Printf("\n\nConversation ended after %s\n",
-                            formatElapsedTime(state.startTime, time.Now()))
-                        os.Exit(0)
-                    default:
-                    }
-                }
-                return fmt.Errorf("error processing response from %s: %v", agent.Name, err)
-            }
+    // Chats in the terminal may have added to the history since it was cached
+    delete(historyCache, agent.Name)
+    history, err := loadHistory()
+    if err != nil {
+        return agent.Name, "", fmt.Errorf("failed to load chat history: %v", err)
+    }
+    if regenerate {
+        last := len(history) - 1
+        if last < 1 || history[last].Role != "assistant" || history[last-1].Role != "user" {
+            return agent.Name, "", fmt.Errorf("%s has no answer to regenerate: %w", agent.Name, server.ErrInvalid)
+        }
+        // A copy, so the cached history is still the one on disk when it is saved
+        history, message = append([]Message(nil), history[:last]...), history[last-1].Content
+    } else {
+        history = append(history, Message{Role: "user", Content: message})
+    }
 
-            // Update conversation log
-            conversationLog.WriteString(fmt.Sprintf("%s %s: %s\n", 
-                agent.Emoji, 
-                agent.Name, 
-                fullResponseText))
+    response, err := b.respond(history, agent, message, onChunk)
+    if err != nil {
+        return agent.Name, "", err
+    }
 
-            // Add the agent's response to the shared history
-            sharedHistory = append(sharedHistory, Message{
-                Role:    "assistant",
-                Content: fmt.Sprintf("%s said: %s", agent.Name, fullResponseText),
-            })
+    history = append(history, Message{Role: "assistant", Content: response})
+    if err := saveHistory(history); err != nil {
+        return agent.Name, "", fmt.Errorf("failed to save chat history: %v", err)
+    }
+    if !regenerate {
+        rememberUserFacts([]string{message})
+    }
+    return agent.Name, response, nil
+}
 
-            // In auto mode, the last agent's response becomes the prompt for the next turn
-            if config.AutoMode && i == len(agentConfigs)-1 {
-                currentMessage = fullResponseText
-            }
+// sessionChat continues a session's conversation with an agent. The session's history is held
+// for the whole exchange, so a second message for the same agent waits for the first answer
+func (b *chattyBackend) sessionChat(session string, agent agents.AgentConfig, message string, onChunk func(chunk string)) (string, string, error) {
+    path, err := b.historyPath(session, agent.Name)
+    if err != nil {
+        return agent.Name, "", err
+    }
+    defer b.lockHistory(path)()
 
-            // Print margins
-            for i := 0; i < converseMargin; i++ {
-                fmt.Println()
-            }
+    conversation, err := readHistory(path)
+    if err != nil {
+        return agent.Name, "", err
+    }
+    exchange := []Message{{Role: "user", Content: message}}
+    history := append([]Message{{Role: "system", Content: b.systemMessage(session, agent, "")}}, conversation...)
+    history = append(history, exchange...)
 
-            // If this is the last agent in the turn
-            if i == len(agentConfigs)-1 {
-                // Add extra blank line before next turn separator
-                fmt.Println()
-                
-                // Check if we should continue
-                if config.Turns > 0 && currentTurn >= config.Turns {
-                    fmt.Printf("\nConversation completed after %d turns.\n", config.Turns)
-                    if config.SaveFile != "" {
-                        if err := saveConversationLog(config.SaveFile, conversationLog.String()); err != nil {
-                            fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
-                        } else {
-                            fmt.Printf("Conversation log saved to: %s\n", config.SaveFile)
-                        }
-                    }
-                    return nil
-                }
+    response, err := b.respond(history, agent, message, onChunk)
+    if err != nil {
+        return agent.Name, "", err
+    }
 
-                if config.AutoMode {
-                    // Add a small delay between turns in auto mode
-                    time.Sleep(2 * time.Second)
-                    currentTurn++
-                    continue
-                }
+    exchange = append(exchange, Message{Role: "assistant", Content: response})
+    if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+        return agent.Name, "", fmt.Errorf("failed to create session directory: %v", err)
+    }
+    if err := appendHistory(path, 0600, exchange...); err != nil {
+        return agent.Name, "", fmt.Errorf("failed to save chat history: %v", err)
+    }
+    return agent.Name, response, nil
+}
 
-                // Print margins and input prompt for non-auto mode
-                fmt.Println()  // Single blank line before input prompt
-                fmt.Printf("%sType your message:%s\n", inputPromptColor, colorReset)
-                fmt.Printf("%s[Press Enter with empty message to end the conversation]%s\n", inputHintColor, colorReset)
-                fmt.Print(colorize("👤 User: ", "\033[1;36m"))
-                
-                // Read user input
-                newMessage, err := reader.ReadString('\n')
-                if err != nil {
-                    return fmt.Errorf("error reading input: %v", err)
-                }
-                
-                // Trim whitespace and update current message
-                currentMessage = strings.TrimSpace(newMessage)
-                if currentMessage == "" {
-                    fmt.Printf("\n%sConversation ended after %s%s\n",
-                        elapsedTimeColor,
-                        formatElapsedTime(state.startTime, time.Now()),
-                        colorReset)
-                    if config.SaveFile != "" {
-                        if err := saveConversationLog(config.SaveFile, conversationLog.String()); err != nil {
-                            fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
-                        } else {
-                            fmt.Printf("Conversation log saved to: %s\n", config.SaveFile)
-                        }
-                    }
-                    return nil
-                }
+// respond has an agent answer a conversation for a client, with what its knowledge says about query
+func (b *chattyBackend) respond(history []Message, agent agents.AgentConfig, query string, onChunk func(chunk string)) (string, error) {
+    knowledge := retrieveKnowledge(agent, query)
+    chatReq := ChatRequest{
+        Model:     agents.GetCurrentModel(),
+        Messages:  withKnowledge(history, formatKnowledge(knowledge)),
+        Stream:    true,
+        KeepAlive: keepAlive,
+        Tools:     availableTools(agent),
+    }
+    return chatWithTools(chatReq, agent, streamHandler(onChunk), false)
+}
 
-                // Update conversation log
-                conversationLog.WriteString(fmt.Sprintf("👤 User: %s\n", currentMessage))
-                
-                // Add user message to history
-                history := append(histories[i], Message{
-                    Role:    "user",
-                    Content: currentMessage,
-                })
-                
-                // Update history for this agent
-                histories[i] = history
-                
-                fmt.Println()  // Single blank line after user input
-                
-                currentTurn++
-            }
+// Complete answers a conversation sent by an OpenAI client as an agent. The agent's system message
+// comes first, followed by the client's instructions, and its chat history is left alone
+func (b *chattyBackend) Complete(session, name string, messages []server.Message, onChunk func(chunk string)) (string, string, error) {
+    defer b.lockOwner(session)()
+
+    if name == "" {
+        name = defaultAgentName()
+    }
+    if !agents.IsValidAgent(name) {
+        return "", "", fmt.Errorf("model '%s' %w: use the name of an installed agent", name, server.ErrNotFound)
+    }
+    agent := agents.GetAgentConfig(name)
+
+    system := b.systemMessage(session, agent, "")
+    var conversation []Message
+    lastUser := ""
+    for _, msg := range messages {
+        switch msg.Role {
+        case "system":
+            system += "\n\n" + msg.Content
+        case "user":
+            lastUser = msg.Content
+            conversation = append(conversation, Message{Role: msg.Role, Content: msg.Content})
+        default:
+            conversation = append(conversation, Message{Role: msg.Role, Content: msg.Content})
         }
     }
+    history := append([]Message{{Role: "system", Content: system}}, conversation...)
+
+    response, err := b.respond(history, agent, lastUser, onChunk)
+    if err != nil {
+        return agent.Name, "", err
+    }
+    return agent.Name, response, nil
 }
 
-// Update the processStreamResponse function to use the conversation animation
-func processStreamResponse(resp *http.Response, anim any) (string, error) {
-    var fullResponse strings.Builder
-    var firstChunk bool = true
-    
-    // Create a buffered reader for better performance
-    reader := bufio.NewReaderSize(resp.Body, 64*1024)
-    
-    // Create a decoder that reads from our buffered reader
-    decoder := json.NewDecoder(reader)
+// Group runs a round of a group chat for a client: each agent answers in turn, seeing the transcript
+// and the answers of the agents before it, like a conversation started with --with
+func (b *chattyBackend) Group(session string, names []string, transcript []server.GroupMessage, onEvent func(event server.GroupEvent)) error {
+    defer b.lockOwner(session)()
 
-    for {
-        // Check for interrupt
-        select {
-        case <-globalStopChan:
-            return fullResponse.String(), fmt.Errorf("interrupted")
-        default:
+    const maxAgents = 15
+    if len(names) > maxAgents {
+        return fmt.Errorf("too many agents: maximum allowed is %d, but got %d", maxAgents, len(names))
+    }
+    var agentConfigs []agents.AgentConfig
+    seen := make(map[string]bool)
+    for _, name := range names {
+        if !agents.IsValidAgent(name) {
+            return fmt.Errorf("agent '%s' %w", name, server.ErrNotFound)
         }
-
-        var streamResp ChatResponse
-        err := decoder.Decode(&streamResp)
-        
-        if err == io.EOF {
-            return fullResponse.String(), nil
+        agent := agents.GetAgentConfig(name)
+        if seen[agent.Name] {
+            return fmt.Errorf("duplicate agent detected: %s (each agent can only be included once)", agent.Name)
         }
-        if err != nil {
-            return fullResponse.String(), fmt.Errorf("error reading response: %v", err)
+        seen[agent.Name] = true
+        agentConfigs = append(agentConfigs, agent)
+    }
+    // An interjection that came after the last round ended isn't for this one
+    b.interjection(session)
+
+    var sharedHistory []Message
+    lastUser := ""
+    for _, msg := range transcript {
+        if msg.Speaker == "" || strings.EqualFold(msg.Speaker, userName) {
+            lastUser = msg.Content
+            sharedHistory = append(sharedHistory, Message{Role: "user", Content: msg.Content})
+        } else {
+            sharedHistory = append(sharedHistory, Message{Role: "assistant", Content: fmt.Sprintf("%s said: %s", msg.Speaker, msg.Content)})
         }
+    }
 
-        // Handle first chunk animation
-        if firstChunk {
-            switch a := anim.(type) {
-            case *Animation:
-                a.stopAnimation()
-            case *ConversationAnimation:
-                a.stopAnimation()
-            }
-            firstChunk = false
-        }
-        
-        // Print the response chunk with the appropriate color
-        var textColor string
-        switch a := anim.(type) {
-        case *Animation:
-            textColor = currentAgent.TextColor
-        case *ConversationAnimation:
-            textColor = a.agent.TextColor
+    for i, agent := range agentConfigs {
+        if i > 0 && b.interjection(session) {
+            return nil
         }
-        
-        fmt.Print(colorize(streamResp.Message.Content, textColor))
-        fullResponse.WriteString(streamResp.Message.Content)
-        
-        if streamResp.Done {
-            return fullResponse.String(), nil
+        agentHistory := []Message{{
+            Role:    "system",
+            Content: b.systemMessage(session, agent, describeParticipants(agentConfigs, i, true)),
+        }}
+        agentHistory = append(agentHistory, sharedHistory...)
+        agentHistory = append(agentHistory, Message{Role: "user", Content: groupReplyInstruction})
+
+        onEvent(server.GroupEvent{Type: server.EventTurnStart, Agent: agent.Name})
+        response, err := b.respond(agentHistory, agent, lastUser, func(chunk string) {
+            onEvent(server.GroupEvent{Type: server.EventChunk, Agent: agent.Name, Content: chunk})
+        })
+        if err != nil {
+            return fmt.Errorf("error processing response from %s: %v", agent.Name, err)
         }
+        onEvent(server.GroupEvent{Type: server.EventTurnEnd, Agent: agent.Name, Content: response})
+
+        sharedHistory = append(sharedHistory, Message{
+            Role:    "assistant",
+            Content: fmt.Sprintf("%s said: %s", agent.Name, response),
+        })
     }
+    return nil
 }
 
-// Check if chatty is initialized
-func isChattyInitialized() bool {
-    homeDir, err := os.UserHomeDir()
+// Interject ends the session's group chat round once the agent answering is done, for the user
+// to have their say before the others answer
+func (b *chattyBackend) Interject(session string) {
+    b.interjectMu.Lock()
+    defer b.interjectMu.Unlock()
+    if b.interjected == nil {
+        b.interjected = make(map[string]bool)
+    }
+    b.interjected[session] = true
+}
+
+// interjection reports whether the user interjected in the session's round, which only stops it once
+func (b *chattyBackend) interjection(session string) bool {
+    b.interjectMu.Lock()
+    defer b.interjectMu.Unlock()
+    interjected := b.interjected[session]
+    delete(b.interjected, session)
+    return interjected
+}
+
+// StoreAgents lists the community store's agents matching a query, noting those already installed
+func (b *chattyBackend) StoreAgents(query string) ([]server.StoreAgent, error) {
+    found, err := store.NewHandler(debugMode).FindAgents(query)
     if err != nil {
-        return false
+        return nil, err
     }
-    
-    chattyDir := filepath.Join(homeDir, historyDir)
-    if _, err := os.Stat(chattyDir); os.IsNotExist(err) {
-        return false
+    var list []server.StoreAgent
+    for _, agent := range found {
+        list = append(list, server.StoreAgent{
+            ID:          agent.ID,
+            Name:        agent.Name,
+            Description: agent.Description,
+            Emoji:       agent.Emoji,
+            Tags:        agent.Tags,
+            Author:      agent.Author,
+            Installed:   agents.IsValidAgent(agent.Name),
+        })
     }
-    
-    return true
+    return list, nil
 }
 
-// Initialize chatty environment
-func initializeChatty() error {
-    fmt.Println("\n🚀 Initializing Chatty environment...")
-    
-    // Preload the LLM model
-    agentConfig, err := agents.GetCurrentConfig()
-    if err != nil {
-        fmt.Printf("\n⚠️ Warning: Could not get agent config: %v\n", err)
-        return err
+// InstallAgent installs an agent from the community store, like chatty --install
+func (b *chattyBackend) InstallAgent(name string) (server.Agent, error) {
+    b.mu.Lock()
+    defer b.mu.Unlock()
+
+    if agents.IsValidAgent(name) {
+        return server.Agent{}, fmt.Errorf("%w: agent '%s' is already installed", server.ErrConflict, agents.GetAgentConfig(name).Name)
     }
-    
-    curlCmd := exec.Command("curl", ollamaBaseURL+"/api/generate", "-d", 
-        fmt.Sprintf(`{"model": "%s", "keep_alive": -1}`, agentConfig.Model))
-    
-    if debugMode {
-        fmt.Printf("\nExecuting: curl %s/api/generate -d '{\"model\": \"%s\", \"keep_alive\": -1}'\n", 
-            ollamaBaseURL, agentConfig.Model)
-        curlOut, err := curlCmd.CombinedOutput()
-        if err != nil {
-            fmt.Printf("\n⚠️ Warning: Failed to preload model: %v\n%s\n", err, string(curlOut))
-        } else {
-            fmt.Printf("\n✓ Response: %s\n", string(curlOut))
-        }
-    } else {
-        err := curlCmd.Run()
-        if err != nil {
-            fmt.Printf("\n⚠️ Warning: Failed to preload model: %v\n", err)
-        } else {
-            fmt.Printf("%s✓%s Model preloaded\n", "\033[32m", colorReset)
-        }
+    info, err := store.NewHandler(debugMode).DownloadAgent(name)
+    if errors.Is(err, store.ErrNotInStore) {
+        return server.Agent{}, fmt.Errorf("agent '%s' %w in the store", name, server.ErrNotFound)
     }
-    
-    // Create necessary directories and files
-    homeDir, err := os.UserHomeDir()
     if err != nil {
-        return fmt.Errorf("failed to get home directory: %v", err)
+        return server.Agent{}, err
     }
-
-    // Create .chatty directory
-    chattyDir := filepath.Join(homeDir, historyDir)
-    if err := os.MkdirAll(chattyDir, 0755); err != nil {
-        return fmt.Errorf("failed to create chatty directory: %v", err)
+    if err := agents.LoadAgents(); err != nil {
+        return server.Agent{}, fmt.Errorf("failed to load agents: %v", err)
     }
-    fmt.Printf("%s✓%s Created %s~/.chatty%s directory\n", 
-        "\033[32m", colorReset,  // Green checkmark
-        "\033[1;34m", colorReset) // Blue path
+    return apiAgent(agents.GetAgentConfig(info.Name), defaultAgentName()), nil
+}
 
-    // Initialize agents
-    if err := agents.CreateDefaultConfig(); err != nil {
-        return fmt.Errorf("failed to create default config: %v", err)
+// BuildAgent has the model create an agent from a description, like chatty --build without the
+// questions: the agent gets the default colors and the given tags, or general
+func (b *chattyBackend) BuildAgent(description string, tags []string) (server.Agent, error) {
+    handler := builder.NewHandler(debugMode)
+    agent, err := handler.Generate(description)
+    if err != nil {
+        return server.Agent{}, fmt.Errorf("%w: %v", server.ErrInvalid, err)
+    }
+    agent.Tags = tags
+    if len(agent.Tags) == 0 {
+        agent.Tags = []string{"general"}
     }
-    fmt.Printf("%s✓%s Created default configuration\n", 
-        "\033[32m", colorReset)
 
-    // Create agents directory
-    agentsDir := filepath.Join(chattyDir, "agents")
-    if err := os.MkdirAll(agentsDir, 0755); err != nil {
-        return fmt.Errorf("failed to create agents directory: %v", err)
+    b.mu.Lock()
+    defer b.mu.Unlock()
+    if agents.IsValidAgent(agent.Name) {
+        return server.Agent{}, fmt.Errorf("%w: an agent named '%s' is already installed", server.ErrConflict, agent.Name)
     }
-    fmt.Printf("%s✓%s Created agents directory\n", 
-        "\033[32m", colorReset)
+    if _, err := handler.SaveToAgents(agent); errors.Is(err, builder.ErrAgentExists) {
+        return server.Agent{}, fmt.Errorf("%w: %v", server.ErrConflict, err)
+    } else if err != nil {
+        return server.Agent{}, err
+    }
+    if err := agents.LoadAgents(); err != nil {
+        return server.Agent{}, fmt.Errorf("failed to load agents: %v", err)
+    }
+    return apiAgent(agents.GetAgentConfig(agent.Name), defaultAgentName()), nil
+}
 
-    // Get default agent info
-    defaultAgent := agents.DefaultAgent
+// UninstallAgent removes an agent installed by the user, like chatty --uninstall
+func (b *chattyBackend) UninstallAgent(name string) error {
+    b.mu.Lock()
+    defer b.mu.Unlock()
 
-    // Define color constants for better readability
-    colorMagenta := "\033[1;35m"
-    colorCyan := "\033[1;36m"
-    colorGreen := "\033[32m"
-    colorPurple := "\033[1;95m"  // Nice purple color for command labels
-    colorBlue := "\033[1;34m"
+    if !agents.IsValidAgent(name) {
+        return fmt.Errorf("agent '%s' %w", name, server.ErrNotFound)
+    }
+    agent := agents.GetAgentConfig(name)
+    if agent.Source == "built-in" {
+        return fmt.Errorf("%w: '%s' is a built-in agent and can't be uninstalled", server.ErrConflict, agent.Name)
+    }
+    return agents.UninstallAgent(agent.Name)
+}
 
-    // Print success message with enhanced formatting
-    fmt.Printf("\n%s🎉 Chatty has been successfully initialized!%s\n\n", 
-        colorGreen, colorReset)
+// handleServeCommand runs the local HTTP API, and the browser chat with --web:
+// chatty serve [--port N] [--host address] [--web] [--require-session]
+func handleServeCommand(args []string) error {
+    const usage = "Usage: chatty serve [--port N] [--host address] [--web] [--require-session] [--allow-tools]"
+    host, port := "127.0.0.1", defaultServePort
+    web, requireSession, allowTools := false, false, false
+    for i := 0; i < len(args); i++ {
+        if args[i] == "--web" {
+            web = true
+            continue
+        }
+        if args[i] == "--allow-tools" {
+            allowTools = true
+            continue
+        }
+        if args[i] == "--require-session" {
+            requireSession = true
+            continue
+        }
+        if i+1 >= len(args) {
+            return fmt.Errorf("missing value for %s\n\n%s", args[i], usage)
+        }
+        switch args[i] {
+        case "--port":
+            value, err := strconv.Atoi(args[i+1])
+            if err != nil || value <= 0 || value > 65535 {
+                return fmt.Errorf("invalid port '%s'", args[i+1])
+            }
+            port = value
+        case "--host":
+            host = args[i+1]
+        default:
+            return fmt.Errorf("unknown option '%s'\n\n%s", args[i], usage)
+        }
+        i++
+    }
 
-    fmt.Printf("%s📌 Default Agent:%s\n", colorCyan, colorReset)
-    fmt.Printf("   %s %s%s%s - %s\n\n",
-        defaultAgent.Emoji,
-        defaultAgent.LabelColor,
-        defaultAgent.Name,
-        colorReset,
-        defaultAgent.Description)
+    if err := checkOllamaReady(); err != nil {
+        fmt.Printf("Warning: %v\n", err)
+    }
 
-    fmt.Printf("%s🎯 Quick Start Guide%s\n", colorMagenta, colorReset)
-    
-    // Basic Commands Section
-    fmt.Printf("\n   %s💬 Basic Commands:%s\n", colorCyan, colorReset)
-    fmt.Printf("   • %sOne-off message:%s chatty %s\"Your message here\"%s\n",
-        colorPurple, colorReset, colorBlue, colorReset)
-    fmt.Printf("   • %sSimple chat mode:%s chatty --with %s<agent_name>%s\n",
-        colorPurple, colorReset, colorBlue, colorReset)
-    
-    // Agent Management Section
-    fmt.Printf("\n   %s🧠 Agent Management:%s\n", colorCyan, colorReset)
-    fmt.Printf("   • %sList installed agents:%s chatty --list\n",
-        colorPurple, colorReset)
-    fmt.Printf("   • %sBrowse store agents:%s chatty --store\n",
-        colorPurple, colorReset)
-    fmt.Printf("   • %sView agent details:%s chatty --show %s<agent_name>%s\n",
-        colorPurple, colorReset, colorBlue, colorReset)
-    fmt.Printf("   • %sInstall an agent:%s chatty --install %s<agent_name>%s\n",
-        colorPurple, colorReset, colorBlue, colorReset)
-    fmt.Printf("   • %sSwitch active agent:%s chatty --select %s<agent_name>%s\n",
-        colorPurple, colorReset, colorBlue, colorReset)
-    
-    // Advanced Features Section
-    fmt.Printf("\n   %s🌟 Advanced Features:%s\n", colorCyan, colorReset)
-    fmt.Printf("   • %sGroup chat mode:%s chatty --with %s\"Einstein,Ada,Tux\"%s --topic \"Let's talk\"\n",
-        colorPurple, colorReset, colorBlue, colorReset)
-    fmt.Printf("   • %sRandom agents chat:%s chatty --with-random %s3%s --topic \"Hello\"\n",
-        colorPurple, colorReset, colorBlue, colorReset)
-    fmt.Printf("   • %sAutonomous mode:%s Add %s--auto%s flag to group chats\n",
-        colorPurple, colorReset, colorBlue, colorReset)
-    fmt.Printf("   • %sSave conversations:%s Add %s--save filename.txt%s to any command\n",
-        colorPurple, colorReset, colorBlue, colorReset)
+    // Nobody is at the terminal to approve tool calls made for API clients, and tools that run
+    // without asking, like read_file and http_get, would let any client read local files and send
+    // them out, so they are only offered with --allow-tools
+    unattended = true
+    if !allowTools {
+        toolsEnabled = false
+    }
 
-    fmt.Printf("\n%s💡 Pro Tips:%s\n", colorCyan, colorReset)
-    fmt.Printf("   • Use %s--turns N%s to limit conversation length\n",
-        colorPurple, colorReset)
-    fmt.Printf("   • Press %sCtrl+C%s to stop auto-conversations gracefully\n",
-        colorPurple, colorReset)
-    fmt.Printf("   • Use %s--topic-file path.txt%s to read topics from a file\n",
-        colorPurple, colorReset)
-    fmt.Printf("   • Clear history with %s--clear all%s or %s--clear \"Agent Name\"%s\n",
-        colorPurple, colorReset, colorPurple, colorReset)
+    addr := fmt.Sprintf("%s:%d", host, port)
+    palette := theme.Current()
+    fmt.Printf("\n%s🌐 Serving chatty on http://%s%s\n\n", palette.Heading, addr, colorReset)
+    fmt.Printf("  %sPOST%s /sessions          Returns a token; send it as \"Authorization: Bearer <token>\" for a separate history\n", palette.Label, colorReset)
+    fmt.Printf("  %sPOST%s /chat              {\"agent\": \"Ada\", \"message\": \"Hello\", \"stream\": false}\n", palette.Label, colorReset)
+    fmt.Printf("  %sGET%s  /agents\n", palette.Label, colorReset)
+    fmt.Printf("  %sGET%s  /history/{agent}\n", palette.Label, colorReset)
+    fmt.Printf("  %sGET%s  /store?q=query     Agents in the community store\n", palette.Label, colorReset)
+    fmt.Printf("  %sPOST%s /agents/install    {\"name\": \"Socrates\"}\n", palette.Label, colorReset)
+    fmt.Printf("  %sPOST%s /agents/build      {\"description\": \"A patient chess coach\", \"tags\": [\"games\"]}\n", palette.Label, colorReset)
+    fmt.Printf("  %sDEL%s  /agents/{name}     Uninstall an agent you added\n", palette.Label, colorReset)
+    fmt.Printf("  %sPOST%s /v1/chat/completions  OpenAI-compatible, with an agent name as the model\n", palette.Label, colorReset)
+    fmt.Printf("  %sGET%s  /v1/models\n", palette.Label, colorReset)
+    fmt.Printf("  %sPOST%s /group             {\"agents\": [\"Ada\", \"Tesla\"], \"messages\": [{\"content\": \"Hello\"}]}\n", palette.Label, colorReset)
+    fmt.Printf("  %sWS%s   /group/ws          Live group chats: turn_start, chunk and turn_end events\n\n", palette.Label, colorReset)
+
+    api := server.New(&chattyBackend{})
+    if net.ParseIP(host) == nil && host != "" {
+        api.AllowHost(host)
+    }
+    if requireSession {
+        api.RequireSession()
+        fmt.Printf("%s🔒 Every request needs a session token%s\n\n", palette.Muted, colorReset)
+    }
+    if !allowTools {
+        fmt.Printf("%s🧰 Agents can't use tools for API clients; --allow-tools lets them%s\n\n", palette.Muted, colorReset)
+    }
+    if web {
+        api.EnableWeb()
+        fmt.Printf("%s💻 Open http://%s in your browser to chat%s\n\n", palette.Success, addr, colorReset)
+    }
+    fmt.Println("Press Ctrl+C to stop")
 
-    fmt.Printf("\n%s🌟 Ready to start your AI journey!%s\n\n",
-        colorGreen, colorReset)
-    
-    return nil
+    // Agents and settings edited while serving apply to the next request
+    watchChanges(func(format string, args ...any) {
+        fmt.Printf("%s[%s] %s%s\n", palette.Muted, time.Now().Format("15:04:05"), fmt.Sprintf(format, args...), colorReset)
+    })
+
+    return api.ListenAndServe(addr)
 }
 
-// Add this new function after the makeAgentRequest function
-func getRandomAgents(count int) ([]string, error) {
-    if count < 2 || count > 15 {
-        return nil, fmt.Errorf("number of agents must be between 2 and 15, got %d", count)
+// handleTUICommand chats in a full-screen interface, with the agents in a sidebar:
+// chatty tui [agent]
+func handleTUICommand(args []string) error {
+    const usage = "Usage: chatty tui [agent]\n       chatty tui --with <agent1>,<agent2>,... [--split]"
+    var options tui.Options
+    var rest []string
+    for i := 0; i < len(args); i++ {
+        switch args[i] {
+        case "--split":
+            options.Split = true
+        case "--with":
+            if i+1 >= len(args) {
+                return fmt.Errorf("missing value for --with\n\n%s", usage)
+            }
+            i++
+            names, err := agents.ExpandGroups(strings.Split(args[i], ","))
+            if err != nil {
+                return failure.Wrap(failure.InvalidAgent, err)
+            }
+            for _, name := range names {
+                if name = strings.TrimSpace(name); name == "" {
+                    continue
+                }
+                if !agents.IsValidAgent(name) {
+                    return failure.New(failure.InvalidAgent, "agent '%s' not found", name)
+                }
+                if err := checkEnabled(name); err != nil {
+                    return err
+                }
+                name = agents.GetAgentConfig(name).Name
+                if slices.Contains(options.Group, name) {
+                    return fmt.Errorf("duplicate agent detected: %s (each agent can only be included once)", name)
+                }
+                options.Group = append(options.Group, name)
+            }
+        default:
+            rest = append(rest, args[i])
+        }
     }
-
-    // Get all available agents
-    allAgents := agents.GetAllAgentNames()
-    if len(allAgents) < count {
-        return nil, fmt.Errorf("not enough agents available: requested %d but only have %d", count, len(allAgents))
+    if len(rest) > 1 || len(rest) == 1 && options.Group != nil {
+        return fmt.Errorf("too many arguments\n\n%s", usage)
     }
+    if options.Group != nil && len(options.Group) < 2 {
+        return fmt.Errorf("at least two agents are required for a group chat\n\n%s", usage)
+    }
+    if options.Split && options.Group == nil {
+        return fmt.Errorf("--split shows the agents of a group chat side by side: use it with --with\n\n%s", usage)
+    }
+    agentName := defaultAgentName()
+    if len(rest) == 1 {
+        if !agents.IsValidAgent(rest[0]) {
+            return failure.New(failure.InvalidAgent, "agent '%s' not found", rest[0])
+        }
+        agentName = agents.GetAgentConfig(rest[0]).Name
+    }
+    options.Agent = agentName
 
-    // Create a copy of the slice to shuffle
-    shuffled := make([]string, len(allAgents))
-    copy(shuffled, allAgents)
-
-    // Fisher-Yates shuffle
-    for i := len(shuffled) - 1; i > 0; i-- {
-        j := time.Now().UnixNano() % int64(i+1)
-        shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+    if err := checkOllamaReady(); err != nil {
+        fmt.Printf("Warning: %v\n", err)
     }
 
-    // Return the first 'count' agents
-    return shuffled[:count], nil
-}
+    // Questions asked at the terminal would be drawn over, so tool calls that need approval are
+    // declined as in chatty serve
+    unattended = true
 
-// readStarterFile reads the contents of a text file to use as a starter message
-func readStarterFile(filePath string) (string, error) {
-    content, err := os.ReadFile(filePath)
+    // Whatever chatty prints while the TUI is up, like tool calls and reloads, is shown in it
+    // rather than over it, and kept in the --log file in place of the TUI's screens
+    reader, writer, err := os.Pipe()
     if err != nil {
-        return "", fmt.Errorf("failed to read starter file: %v", err)
+        return err
     }
-    return strings.TrimSpace(string(content)), nil
-}
+    stdout := os.Stdout
+    os.Stdout = writer
+    defer func() {
+        os.Stdout = stdout
+        writer.Close()
+    }()
 
-// Add this new function to save conversation logs
-func saveConversationLog(logPath string, content string) error {
-    // Create directory if it doesn't exist
-    dir := filepath.Dir(logPath)
-    if err := os.MkdirAll(dir, 0755); err != nil {
-        return fmt.Errorf("failed to create directory: %v", err)
+    watchChanges(func(format string, args ...any) {
+        fmt.Printf(format+"\n", args...)
+    })
+    options.Output, options.Notes = terminal(), reader
+    if outputLog != nil {
+        options.Notes = io.TeeReader(reader, outputLog)
     }
+    return tui.Run(&chattyBackend{}, options)
+}
 
-    // Write the content to the file
-    if err := os.WriteFile(logPath, []byte(content), 0644); err != nil {
-        return fmt.Errorf("failed to save conversation log: %v", err)
+// bridgeSecret returns a token of a chat service from its environment variable or the keyring,
+// empty when it is in neither
+func bridgeSecret(name string) (string, error) {
+    value, err := secrets.Lookup(name)
+    if err != nil {
+        secret, _ := secrets.Find(name)
+        return "", fmt.Errorf("failed to read %s: %v (set %s instead)", name, err, secret.Env)
     }
-
-    return nil
+    return value, nil
 }
 
-// Add a new function to handle single-agent chat
-func handleSingleAgentChat(agentName string, starter string, saveFile string) error {
-    // Validate agent exists
-    if !agents.IsValidAgent(agentName) {
-        return fmt.Errorf("invalid agent name: %s", agentName)
+// handleBridgeCommand relays messages between a chat service and the agents:
+// chatty bridge slack|discord [--channel <channel>=<agent>[,<agent>...]]... [--agent name] [--allow-tools]
+// chatty bridge discord [--auto <channel>=<agent>,<agent>[,<agent>...]]... [--turns N]
+// chatty bridge matrix [--room <room>=<agent>[,<agent>...]]... [--agent name] [--allow-tools]
+func handleBridgeCommand(args []string) error {
+    const usage = "Usage: chatty bridge slack|discord [--channel <channel>=<agent>[,<agent>...]]... [--agent name] [--allow-tools]\n" +
+        "       chatty bridge discord [--auto <channel>=<agent>,<agent>[,<agent>...]]... [--turns N]\n" +
+        "       chatty bridge matrix [--room <room>=<agent>[,<agent>...]]... [--agent name] [--allow-tools]"
+    if len(args) == 0 {
+        return fmt.Errorf("missing service\n\n%s", usage)
+    }
+    service := args[0]
+    if service != "slack" && service != "discord" && service != "matrix" {
+        return fmt.Errorf("unknown service '%s': use slack, discord or matrix\n\n%s", service, usage)
     }
-    
-    // Get agent configuration
-    agent := agents.GetAgentConfig(agentName)
-    
-    // Print welcome message
-    fmt.Printf("\n💬 Chat with %s %s\n", agent.Emoji, agent.Name)
-    fmt.Printf("%s\n", agent.Description)
 
-    // Show exit message at the beginning of the chat
-    fmt.Println()
-    fmt.Printf("Press Enter with empty message to end the conversation")
-    fmt.Println()
-    
-    // Initialize conversation log
-    var conversationLog strings.Builder
-    if starter != "" {
-        conversationLog.WriteString(fmt.Sprintf("👤 User: %s\n", starter))
+    config, err := agents.GetCurrentConfig()
+    if err != nil {
+        return failure.New(failure.ConfigError, "failed to load config: %v", err)
     }
-    
-    // Try to load existing history for this agent
-    historyPath, err := getHistoryPathForAgent(agentName)
-    var history []Message
-    
-    if err == nil {
-        // Check if history file exists
-        if _, err := os.Stat(historyPath); err == nil {
-            // Read and parse the history file
-            data, err := os.ReadFile(historyPath)
-            if err == nil {
-                var existingHistory []Message
-                if err := json.Unmarshal(data, &existingHistory); err == nil && len(existingHistory) > 0 {
-                    // Successfully loaded history
-                    history = existingHistory
-                }
-            }
+    channels := make(map[string][]string)
+    autoChannels := make(map[string][]string)
+    configured := config.SlackChannels
+    switch service {
+    case "discord":
+        configured = config.DiscordChannels
+        for channel, names := range config.DiscordAutoChannels {
+            autoChannels[channel] = names
         }
+    case "matrix":
+        configured = config.MatrixRooms
     }
-    
-    // If no history was loaded, initialize with system message
-    if len(history) == 0 {
-        history = []Message{{
-            Role:    "system",
-            Content: agent.GetFullSystemMessage(false, ""),
-        }}
-    } else {
-        // Prepend system message to existing history
-        history = append([]Message{{
-            Role:    "system",
-            Content: agent.GetFullSystemMessage(false, ""),
-        }}, history...)
-    }
-    
-    // Add starter message if provided
-    currentMessage := starter
-    if currentMessage != "" {
-        history = append(history, Message{
-            Role:    "user",
-            Content: currentMessage,
-        })
-        
-        // Print the starter message
-        fmt.Println(colorize(formatUserMessage(currentMessage), "\033[1;36m"))
-        fmt.Println()  // Single blank line after user message
+    for channel, names := range configured {
+        channels[channel] = names
     }
-    
-    // Create a reader for user input
-    reader := bufio.NewReader(os.Stdin)
-    
-    // Maximum number of messages to keep in history
-    const maxMessagesInHistory = 50
-    
-    for {
-        // If we have a current message, get agent's response
-        if currentMessage != "" {
-            // Start animation
-            anim := startConversationAnimation(agent)
-            
-            // Add instruction message
-            history = append(history, Message{
-                Role:    "user",
-                Content: "Respond naturally as part of this conversation and do not add prefixes like '<Your name> said:' to your messages.",
-            })
-            
-            // Ensure we don't exceed the token limit
-            if len(history) > maxMessagesInHistory {
-                // Keep the system message and the most recent messages
-                history = append([]Message{history[0]}, history[len(history)-maxMessagesInHistory+1:]...)
-            }
-            
-            // Prepare the request
-            chatReq := ChatRequest{
-                Model:    agents.GetCurrentModel(),
-                Messages: history,
-                Stream:   true,
-                KeepAlive: keepAlive,
+    defaultAgent := ""
+    turns := 0
+    allowTools := false
+    for i := 1; i < len(args); i++ {
+        if args[i] == "--allow-tools" {
+            allowTools = true
+            continue
+        }
+        if i+1 >= len(args) {
+            return fmt.Errorf("missing value for %s\n\n%s", args[i], usage)
+        }
+        switch {
+        case args[i] == "--channel" || (args[i] == "--room" && service == "matrix") || (args[i] == "--auto" && service == "discord"):
+            channel, list, ok := strings.Cut(args[i+1], "=")
+            if !ok || channel == "" || list == "" {
+                return fmt.Errorf("invalid channel mapping '%s': use <channel>=<agent>[,<agent>...]", args[i+1])
             }
-            
-            jsonData, err := json.Marshal(chatReq)
-            if err != nil {
-                anim.stopAnimation()
-                return fmt.Errorf("error marshaling request: %v", err)
+            var names []string
+            for _, name := range strings.Split(list, ",") {
+                names = append(names, strings.TrimSpace(name))
             }
-            
-            // Make the API request with retry
-            resp, err := makeAPIRequestWithRetry(jsonData, agent.Name)
-            if err != nil {
-                anim.stopAnimation()
-                return fmt.Errorf("error making request: %v", err)
+            if args[i] == "--auto" {
+                autoChannels[channel] = names
+            } else {
+                channels[channel] = names
             }
-            
-            // Process the response
-            fullResponseText, err := processStreamResponse(resp, anim)
-            if err != nil {
-                return fmt.Errorf("error processing response: %v", err)
+        case args[i] == "--turns" && service == "discord":
+            turns, err = strconv.Atoi(args[i+1])
+            if err != nil || turns < 1 {
+                return fmt.Errorf("invalid number of turns '%s': use a positive number", args[i+1])
             }
-            
-            // Update conversation log
-            conversationLog.WriteString(fmt.Sprintf("%s %s: %s\n", 
-                agent.Emoji, 
-                agent.Name, 
-                fullResponseText))
-            
-            // Add the response to history
-            history = append(history, Message{
-                Role:    "assistant",
-                Content: fullResponseText,
-            })
-            
-            // Remove the instruction message
-            if len(history) >= 2 && history[len(history)-2].Role == "user" && 
-               history[len(history)-2].Content == "Respond naturally as part of this conversation and do not add prefixes like '<Your name> said:' to your messages." {
-                // Remove the instruction message
-                history = append(history[:len(history)-2], history[len(history)-1])
+        case args[i] == "--agent":
+            defaultAgent = args[i+1]
+        default:
+            return fmt.Errorf("unknown option '%s'\n\n%s", args[i], usage)
+        }
+        i++
+    }
+
+    // Check the agents up front, rather than when the first message arrives
+    if defaultAgent != "" && !agents.IsValidAgent(defaultAgent) {
+        return failure.New(failure.InvalidAgent, "agent '%s' not found", defaultAgent)
+    }
+    for _, mappings := range []map[string][]string{channels, autoChannels} {
+        for channel, names := range mappings {
+            for _, name := range names {
+                if !agents.IsValidAgent(name) {
+                    return failure.New(failure.InvalidAgent, "agent '%s' of channel %s not found", name, channel)
+                }
             }
-            
-            fmt.Println()  // Single blank line after response
         }
-        
-        // Add a blank line before prompting for user input
-        fmt.Println()
-        
-        // Prompt for user input
-        fmt.Print(colorize("👤 User: ", "\033[1;36m"))
-        
-        // Read user input
-        newMessage, err := reader.ReadString('\n')
+    }
+    for channel, names := range autoChannels {
+        if len(names) < 2 {
+            return fmt.Errorf("channel %s needs at least two agents to hold a conversation", channel)
+        }
+    }
+    if defaultAgent == "" {
+        defaultAgent = defaultAgentName()
+    }
+
+    var relay interface{ Run() error }
+    logf := func(format string, args ...any) {
+        fmt.Printf("%s[%s] %s%s\n", theme.Current().Muted, time.Now().Format("15:04:05"), fmt.Sprintf(format, args...), colorReset)
+    }
+    switch service {
+    case "slack":
+        appToken, err := bridgeSecret("slack_app_token")
         if err != nil {
-            return fmt.Errorf("error reading input: %v", err)
+            return err
         }
-        
-        // Trim whitespace
-        currentMessage = strings.TrimSpace(newMessage)
-        
-        // Check for exit
-        if currentMessage == "" {
-            fmt.Println("\nConversation ended.")
-            
-            // Save conversation history for the agent
-            historyPath, err := getHistoryPathForAgent(agentName)
-            if err == nil {
-                // Filter out system messages and special instruction messages before saving
-                var filteredHistory []Message
-                for _, msg := range history {
-                    if msg.Role == "system" || 
-                       (msg.Role == "user" && msg.Content == "Respond naturally as part of this conversation and do not add prefixes like '<Your name> said:' to your messages.") {
-                        continue
-                    }
-                    filteredHistory = append(filteredHistory, msg)
-                }
-                
-                // Save the filtered history
-                data, err := json.MarshalIndent(filteredHistory, "", "    ")
-                if err == nil {
-                    if err := os.WriteFile(historyPath, data, 0644); err != nil {
-                        fmt.Printf("Warning: Failed to save conversation history: %v\n", err)
-                    }
-                }
-            }
-            
-            // Save conversation log to file if requested
-            if saveFile != "" {
-                if err := saveConversationLog(saveFile, conversationLog.String()); err != nil {
-                    fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
-                } else {
-                    fmt.Printf("Conversation log saved to: %s\n", saveFile)
-                }
-            }
-            return nil
+        botToken, err := bridgeSecret("slack_bot_token")
+        if err != nil {
+            return err
         }
-        
-        // Update conversation log
-        conversationLog.WriteString(fmt.Sprintf("👤 User: %s\n", currentMessage))
-        
-        // Add user message to history
-        history = append(history, Message{
-            Role:    "user",
-            Content: currentMessage,
-        })
-        
-        fmt.Println()  // Single blank line after user input
+        if appToken == "" || botToken == "" {
+            return fmt.Errorf("set SLACK_APP_TOKEN (xapp-...) and SLACK_BOT_TOKEN (xoxb-...) to your Slack app's tokens, or store them with chatty config set-secret slack_app_token and slack_bot_token")
+        }
+        relay = &bridge.Slack{
+            AppToken:     appToken,
+            BotToken:     botToken,
+            Channels:     channels,
+            DefaultAgent: defaultAgent,
+            Engine:       &chattyBackend{},
+            Logf:         logf,
+        }
+    case "matrix":
+        homeserver := os.Getenv("MATRIX_HOMESERVER")
+        token, err := bridgeSecret("matrix_access_token")
+        if err != nil {
+            return err
+        }
+        if homeserver == "" || token == "" {
+            return fmt.Errorf("set MATRIX_HOMESERVER (e.g. https://matrix.example.org) and MATRIX_ACCESS_TOKEN to your bot account's homeserver and access token, or store the token with chatty config set-secret matrix_access_token")
+        }
+        relay = &bridge.Matrix{
+            Homeserver:   homeserver,
+            AccessToken:  token,
+            Rooms:        channels,
+            DefaultAgent: defaultAgent,
+            Engine:       &chattyBackend{},
+            Logf:         logf,
+        }
+    case "discord":
+        token, err := bridgeSecret("discord_bot_token")
+        if err != nil {
+            return err
+        }
+        if token == "" {
+            return fmt.Errorf("set DISCORD_BOT_TOKEN to your Discord bot's token, or store it with chatty config set-secret discord_bot_token")
+        }
+        relay = &bridge.Discord{
+            Token:        token,
+            Channels:     channels,
+            AutoChannels: autoChannels,
+            Turns:        turns,
+            DefaultAgent: defaultAgent,
+            Engine:       &chattyBackend{},
+            Logf:         logf,
+        }
+    }
+
+    if err := checkOllamaReady(); err != nil {
+        fmt.Printf("Warning: %v\n", err)
+    }
+
+    // Nobody is at the terminal to approve tool calls made for the service's users, and tools that
+    // run without asking, like read_file and http_get, would let anyone in a channel read local
+    // files and reach internal addresses, so they are only offered with --allow-tools
+    unattended = true
+    if !allowTools {
+        toolsEnabled = false
+    }
+
+    palette := theme.Current()
+    serviceNames := map[string]string{"slack": "Slack", "discord": "Discord", "matrix": "Matrix"}
+    fmt.Printf("\n%s🔌 Bridging %s to your agents%s\n\n", palette.Heading, serviceNames[service], colorReset)
+    for channel, names := range channels {
+        fmt.Printf("  %s%s%s → %s\n", palette.Label, channel, colorReset, strings.Join(names, ", "))
+    }
+    if turns == 0 {
+        turns = bridge.DefaultAutoTurns
+    }
+    for channel, names := range autoChannels {
+        fmt.Printf("  %s%s%s → %s (talking for %d rounds after each message)\n", palette.Label, channel, colorReset, strings.Join(names, ", "), turns)
+    }
+    fmt.Printf("  %sDirect messages and mentions%s → %s\n\n", palette.Label, colorReset, defaultAgent)
+    if !allowTools {
+        fmt.Printf("%s🧰 Agents can't use tools for %s users; --allow-tools lets them%s\n\n", palette.Muted, serviceNames[service], colorReset)
     }
+
+    // Agents and settings edited while bridging apply to the next message
+    watchChanges(logf)
+    return relay.Run()
 }
 
-// Update the main function to handle the new command
 func main() {
     // Set up global signal handler at program start
-    signal.Notify(globalStopChan, os.Interrupt, syscall.SIGTERM)
+    signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
     defer func() {
-        signal.Stop(globalStopChan)
+        signal.Stop(signals)
         // Force immediate exit
-        os.Exit(0)
+        exit(0)
     }()
 
-    // Add signal handler goroutine
+    // Add signal handler goroutine: requests in flight are aborted and given a moment to end
+    // cleanly, so responses aren't cut off in the middle of writing to the terminal
     go func() {
-        <-globalStopChan
+        <-signals
+        interruptRequests()
+        deadline := time.Now().Add(interruptGrace)
+        for activeRequests.Load() > 0 && time.Now().Before(deadline) {
+            time.Sleep(10 * time.Millisecond)
+        }
         fmt.Println("\nInterrupted by user. Exiting...")
-        os.Exit(0)
+        exit(0)
     }()
 
+    // Windows consoles show colors once told to, and those that can't are treated like NO_COLOR
+    if !term.EnableANSI() {
+        os.Setenv("NO_COLOR", "1")
+    }
+
     // Add debug flag check at the start
-    for i, arg := range os.Args {
-        if arg == "--debug" {
-            debugMode = true
-            // Remove debug flag from args
-            os.Args = append(os.Args[:i], os.Args[i+1:]...)
-            break
+    debugMode = extractGlobalFlag("--debug")
+
+    // Errors for scripts: JSON on stderr, with an exit code for each kind of error
+    jsonErrors = extractGlobalFlag("--json")
+
+    // Use a configuration profile for this run instead of the one switched to, also chosen with
+    // CHATTY_PROFILE
+    profileName, foundProfile, err := extractGlobalOption("--config-profile")
+    if err != nil {
+        fail(err, "Usage: --config-profile <name>")
+    }
+    if foundProfile {
+        if err := appdir.Use(profileName); err != nil {
+            fail(err, fmt.Sprintf("Create it with: chatty profile create %s", profileName))
+        }
+    } else if name := os.Getenv("CHATTY_PROFILE"); name != "" {
+        if err := appdir.Use(name); err != nil {
+            fail(fmt.Errorf("CHATTY_PROFILE: %v", err), fmt.Sprintf("Create it with: chatty profile create %s", name))
+        }
+    }
+
+    // Measure the run, summarizing it at exit, and write pprof profiles with --pprof
+    if extractGlobalFlag("--profile") {
+        profile.Enable()
+    }
+    pprofDir, foundPprof, err := extractGlobalOption("--pprof")
+    if err != nil {
+        fail(err, "Usage: --pprof <directory>")
+    }
+    if foundPprof {
+        if err := profile.StartPprof(pprofDir); err != nil {
+            fail(err)
+        }
+    }
+
+    // Read agent responses aloud
+    speakMode = extractGlobalFlag("--speak")
+
+    // Search the git repository in the working directory
+    projectMode := extractGlobalFlag("--project")
+
+    // Answer a one-shot message on its own, without reading or writing histories and memory, and
+    // without ever waiting for input, for cron jobs and scripts
+    stateless = extractGlobalFlag("--no-history")
+    if stateless {
+        unattended = true
+        if len(os.Args) > 1 {
+            switch os.Args[1] {
+            case "--with", "--with-random", "--scenario", "--pair", "--watch", "serve", "bridge", "tui":
+                fail(fmt.Errorf("--no-history only applies to one-shot messages, not %s", os.Args[1]), "Usage: chatty --no-history \"message\"")
+            }
+        }
+    }
+
+    // Search past conversations, bringing the matches into the conversation if one is started
+    recallQuery, foundRecall, err := extractGlobalOption("--recall")
+    if err != nil {
+        fail(err, "Usage: --recall \"what you remember about the conversation\"")
+    }
+
+    // Show responses translated to the user's language
+    translateOption, foundTranslate, err := extractGlobalOption("--translate")
+    if err != nil {
+        fail(err, "Usage: --translate <language_code>")
+    }
+
+    // Answer in a preset style for this run, instead of the configured base guidelines
+    styleOption, foundStyle, err := extractGlobalOption("--style")
+    if err != nil {
+        fail(err, "Usage: --style <"+strings.Join(agents.StyleNames(), "|")+">")
+    }
+    if foundStyle {
+        if err := agents.UseStyle(styleOption); err != nil {
+            var hints []string
+            for _, style := range agents.Styles() {
+                hints = append(hints, fmt.Sprintf("%-8s %s", style.Name, style.Description))
+            }
+            fail(err, hints...)
+        }
+    }
+
+    // Tweak how agents behave for this run, without an agent of their own
+    systemOption, foundSystem, err := extractGlobalOption("--system")
+    if err != nil {
+        fail(err, "Usage: --system \"<instructions>\", e.g. --system \"answer only in bullet points\"")
+    }
+    if foundSystem {
+        extraInstructions = strings.TrimSpace(systemOption)
+    }
+
+    // Reply in another language for this run, instead of language_code in config.json
+    langOption, foundLang, err := extractGlobalOption("--lang")
+    if err != nil {
+        fail(err, "Usage: --lang <language_code>, e.g. pt-BR")
+    }
+    if foundLang {
+        if err := agents.UseLanguage(langOption); err != nil {
+            fail(err)
+        }
+    }
+
+    // Animate the wait for responses in another style for this run, or not at all
+    animationOption, _, err = extractGlobalOption("--animation")
+    if err != nil {
+        fail(err, "Usage: --animation <"+strings.Join(animation.Styles, "|")+">")
+    }
+    if animationOption != "" && !slices.Contains(animation.Styles, animationOption) {
+        fail(fmt.Errorf("unknown animation style: %s", animationOption), "Usage: --animation <"+strings.Join(animation.Styles, "|")+">")
+    }
+
+    // Honor NO_COLOR before the configured theme is known
+    applyTheme("")
+
+    // Knowledge base to search, or to ingest into with --ingest. "--kb add-remote" is a command instead
+    var kbOption string
+    var foundKB bool
+    if len(os.Args) < 3 || os.Args[1] != "--kb" || os.Args[2] != "add-remote" {
+        kbOption, foundKB, err = extractGlobalOption("--kb")
+        if err != nil {
+            fail(err, "Usage: --kb <name>")
+        }
+    }
+
+    // Mirror all output to a plain-text log file if requested
+    logPath, foundLog, err := extractGlobalOption("--log")
+    if err != nil {
+        fail(err, "Usage: --log <filename>")
+    }
+    if foundLog {
+        logWriter, err := render.NewLogWriter(logPath)
+        if err != nil {
+            fail(err)
+        }
+        tee, err := render.StartTee(logWriter)
+        if err != nil {
+            logWriter.Close()
+            fail(err)
         }
+        outputTee = tee
+        outputLog = logWriter
     }
 
     // Check if this is the init command
     if len(os.Args) > 1 && os.Args[1] == "init" {
         if isChattyInitialized() {
             fmt.Println("Chatty is already initialized.")
-            fmt.Println("To start over, remove the ~/.chatty directory and run 'chatty init' again.")
+            configDir, _ := appdir.ConfigDir()
+            fmt.Printf("To start over, remove the %s directory and run 'chatty init' again.\n", configDir)
             return
         }
         if err := initializeChatty(); err != nil {
             fmt.Printf("Error initializing Chatty: %v\n", err)
-            os.Exit(1)
+            exit(1)
         }
         return
     }
@@ -1545,56 +7602,284 @@ func main() {
         fmt.Println("   Chatty requires some initial setup to create your personal chat environment.")
         fmt.Println("\n🔧 How to fix this:")
         fmt.Println("   Simply run the following command:")
-        fmt.Printf("   %s%s chatty init%s\n", "\033[1;36m", "\033[1m", "\033[0m")
+        fmt.Printf("   %s chatty init%s\n", theme.Current().Section, colorReset)
         fmt.Println("\n💡 This will:")
-        fmt.Println("   • Create your personal chat directory (~/.chatty)")
+        configDir, _ := appdir.ConfigDir()
+        fmt.Printf("   • Create your personal chat directory (%s)\n", configDir)
         fmt.Println("   • Set up default configurations")
         fmt.Println("   • Install built-in AI agents")
         fmt.Println("   • Prepare everything for your first chat")
-        os.Exit(1)
+        exit(1)
+    }
+
+    // Bring config.json up to date with settings renamed since it was written, rather than
+    // loading it without them
+    migration, err := agents.MigrateConfigFile()
+    if err != nil {
+        fail(failure.New(failure.ConfigError, "%v", err))
+    }
+    if migration != nil {
+        fmt.Printf("%s✓ Updated config.json for this version of chatty:%s\n", theme.Current().Success, colorReset)
+        for _, change := range migration.Changes {
+            fmt.Printf("  • %s\n", change)
+        }
+        fmt.Printf("  %sThe previous file is saved as %s%s\n\n", theme.Current().Muted, migration.Backup, colorReset)
     }
 
     // Now that we know chatty is initialized, load agents
     if err := agents.LoadAgents(); err != nil {
-        fmt.Printf("Error loading agents: %v\n", err)
-        os.Exit(1)
+        fail(fmt.Errorf("failed to load agents: %v", err))
+    }
+    currentAgent = agents.GetDefaultAgent()
+
+    // Load configuration at startup, with the project's .chatty.yaml if there is one
+    project, err := agents.GetProjectConfig()
+    if err != nil {
+        fail(failure.New(failure.ConfigError, "%v", err), fmt.Sprintf("Fix or remove %s", agents.ProjectFileName))
+    }
+    if project != nil && project.Agent != "" && !agents.IsValidAgent(project.Agent) {
+        fmt.Printf("Warning: %s: no agent named '%s', which is ignored\n", project.Path, project.Agent)
+        // The rest of the file still applies
+        project.Agent = ""
+    }
+    config, err := agents.GetCurrentConfig()
+    if err != nil {
+        hint := fmt.Sprintf("Fix %s, or remove it to go back to the defaults", configFilePath())
+        var envErr *agents.EnvError
+        if errors.As(err, &envErr) {
+            hint = fmt.Sprintf("Fix or unset %s", envErr.Variable)
+        }
+        fail(failure.New(failure.ConfigError, "failed to load config: %v", err), hint)
+    } else {
+        // Set current agent from config
+        currentAgent = agents.GetAgentConfig(config.CurrentAgent)
+
+        // Talk to the Ollama server in the settings, which may be another machine or container
+        ollamaBaseURL = agents.OllamaURL()
+        attach.OllamaURL = ollamaBaseURL
+
+        // Settings that are ignored or have no effect are pointed out, rather than silently dropped.
+        // An unknown theme is among them, and the default theme is used instead
+        if problems, err := agents.CheckConfigFile(); err == nil {
+            for _, problem := range problems {
+                fmt.Printf("Warning: config.json, %v\n", problem)
+            }
+        }
+        for _, problem := range agents.CheckEnv() {
+            fmt.Printf("Warning: %s\n", problem)
+        }
+
+        // Apply the theme, labels and other settings of how chats look
+        applySettings(config)
+
+        // Translate responses unless agents already use the display language
+        if config.DisplayLanguage != "" && !strings.EqualFold(config.DisplayLanguage, config.LanguageCode) {
+            translateTo = config.DisplayLanguage
+        }
+    }
+
+    // Load the model while the rest of the chat gets ready
+    if startsChat(os.Args) {
+        warmUpModel()
+    }
+
+    // The --translate flag overrides the configured display language
+    if foundTranslate {
+        translateTo = translateOption
+    }
+
+    // Load what is remembered about the user
+    if (config == nil || !config.DisableMemory) && !stateless {
+        memoryEnabled = true
+        userMemory, err = memory.Load()
+        if err != nil {
+            fmt.Printf("Warning: %v\n", err)
+        }
+    }
+
+    // Let agents call tools unless turned off, asking before anything risky
+    toolsEnabled = config == nil || !config.DisableTools
+    tools.Approve = confirmToolCall
+    if toolsEnabled && config != nil && config.CodeInterpreter != "" {
+        if err := tools.EnableInterpreter(config.CodeInterpreter); err != nil {
+            fmt.Printf("Warning: %v\n", err)
+        }
+    }
+    if toolsEnabled {
+        for _, err := range tools.LoadCustom() {
+            fmt.Printf("Warning: %v\n", err)
+        }
+    }
+    if config != nil {
+        applyToolSettings(config)
+    }
+
+    // Open the knowledge base used for retrieval
+    embedder = newEmbedder(config)
+    kbName := kbOption
+    if !foundKB && config != nil {
+        kbName = config.KnowledgeBase
+    }
+    if kbName != "" && (len(os.Args) < 2 || (os.Args[1] != "--ingest" && os.Args[1] != "--kb")) {
+        if !kb.Exists(kbName) {
+            fmt.Printf("Error: knowledge base '%s' not found\n", kbName)
+            fmt.Printf("\nCreate it with: chatty --ingest <path> --kb %s\n", kbName)
+            exit(1)
+        }
+        knowledgeBase, err = kb.Open(kbName)
+        if err != nil {
+            fail(err)
+        }
+
+        // Pick up updates to a knowledge base shared from a URL, keeping the current copy if that fails
+        if knowledgeBase.NeedsRefresh() {
+            if err := syncRemoteKnowledge(knowledgeBase); err != nil {
+                fmt.Printf("⚠️ Warning: Failed to refresh knowledge base '%s': %v\n\n", kbName, err)
+            }
+        }
+    }
+    if projectMode {
+        projectIndex, err = openProject()
+        if err != nil {
+            fail(err)
+        }
+    }
+    if foundRecall {
+        results, err := recallConversations(recallQuery)
+        if err != nil {
+            fmt.Printf("Error: failed to search past conversations: %v\n", err)
+            exit(1)
+        }
+        if len(os.Args) < 2 {
+            printRecalled(recallQuery, results)
+            return
+        }
+        if len(results) == 0 {
+            fmt.Printf("%sNo past conversations match \"%s\"%s\n\n", theme.Current().Muted, recallQuery, colorReset)
+        } else {
+            fmt.Printf("%s🔎 Recalled %d past exchanges about \"%s\"%s\n\n", theme.Current().Muted, len(results), recallQuery, colorReset)
+        }
+        recalledExchanges = formatRecalled(results)
     }
 
-    // Load configuration at startup
-    config, err := agents.GetCurrentConfig()
-    if err != nil {
-        fmt.Printf("Error loading config: %v\n", err)
-        // Continue with default agent
-    } else {
-        // Set current agent from config
-        currentAgent = agents.GetAgentConfig(config.CurrentAgent)
+    // Set up text-to-speech
+    if speakMode {
+        engine, voice := "", ""
+        if config != nil {
+            engine, voice = config.TTSEngine, config.TTSVoice
+        }
+        speaker, err = speech.NewSpeaker(engine, voice)
+        if err != nil {
+            fail(err)
+        }
     }
 
     if len(os.Args) < 2 {
         fmt.Println("Usage: chatty \"Your message here\" [--save <filename>]")
         fmt.Println("Special commands:")
         fmt.Println("  init                          Initialize Chatty environment")
+        fmt.Println("  serve [--port N] [--host h]   Serve a local HTTP API for other apps (default: 127.0.0.1:8080)")
+        fmt.Println("      --web                     Also serve a chat page to use chatty from the browser")
+        fmt.Println("      --require-session         Only answer requests with a session token, each with its own histories")
+        fmt.Println("      --allow-tools             Let agents use tools for API clients (off, as they could read your files)")
+        fmt.Println("  tui [agent]                   Chat in a full-screen interface, with your agents in a sidebar")
+        fmt.Println("  bridge slack                  Answer Slack messages with your agents (SLACK_APP_TOKEN, SLACK_BOT_TOKEN)")
+        fmt.Println("      --channel <c>=<agent,...> Agents answering every message in a channel, in turn when several")
+        fmt.Println("      --agent <name>            Agent answering direct messages and mentions (default: current)")
+        fmt.Println("      --allow-tools             Let agents use tools for the service's users (off, as they could read your files)")
+        fmt.Println("  bridge discord                Answer Discord messages with your agents (DISCORD_BOT_TOKEN), same options as slack")
+        fmt.Println("      --auto <c>=<agent,...>    Agents conversing among themselves in a channel after each message")
+        fmt.Println("      --turns N                 Rounds they talk for in --auto channels (default: 3)")
+        fmt.Println("  bridge matrix                 Answer Matrix messages with your agents (MATRIX_HOMESERVER, MATRIX_ACCESS_TOKEN)")
+        fmt.Println("      --room <r>=<agent,...>    Agents answering every message in a room, by ID or alias")
+        fmt.Println("  config secrets                List the tokens chatty can keep in the system keyring, and where each is set")
+        fmt.Println("  config set-secret <name>      Store a token in the system keyring instead of a file; delete-secret removes it")
+        fmt.Println("  migrate-xdg                   Move ~/.chatty to $XDG_CONFIG_HOME/chatty and $XDG_DATA_HOME/chatty")
+        fmt.Println("  profile [list]                List configuration profiles, each with its own config, agents and histories")
+        fmt.Println("  profile create <name>         Create a profile; --from <profile> copies its config and agents")
+        fmt.Println("  profile switch <name>         Use a profile from now on (default: the main configuration)")
         fmt.Println("  --clear [all|agent_name]      Clear chat history (all or specific agent)")
         fmt.Println("  --list                        List available agents")
+        fmt.Println("  --list --stats                Show how much each agent is used, to find the ones you never use")
         fmt.Println("  --select <agent_name>         Select an agent")
         fmt.Println("  --current                     Show current agent")
+        fmt.Println("  --copy-code [agent_name]      Copy the last code block from an agent's response")
+        fmt.Println("  --export <agent_name|file>    Export a chat history or saved conversation log")
+        fmt.Println("      --format pdf|wav          Export format: PDF document or spoken audio (default: pdf)")
+        fmt.Println("      --output <filename>       Output file (default: named after the source)")
+        fmt.Println("  --ingest <path> [--kb <name>] Index Markdown, text and PDF files into a knowledge base (default: default)")
+        fmt.Println("  --kb add-remote <url> [name]  Index a zip archive of documents and keep it in sync")
+        fmt.Println("      --refresh <duration>      How often to check the archive for updates (default: 24h)")
+        fmt.Println("  --memory [list]               Show what Chatty remembers about you")
+        fmt.Println("  --memory forget <id|all>      Forget a remembered fact")
+        fmt.Println("  --tools [list]                Show the tools agents can use and their permissions")
+        fmt.Println("  --tools allow|deny|ask|reset <tool> [--agent <name>]")
+        fmt.Println("                                Let a tool run freely, never offer it, always ask first, or restore its default")
         fmt.Println("  --with <agent_name>           Start a direct chat with a single agent")
         fmt.Println("  --with <agent1>,<agent2>,...  Start a conversation between agents (interactive mode)")
+        fmt.Println("  --with @<group>               Start a conversation with the agents of a group from config.json")
         fmt.Println("      --topic \"message\"         Initial message for the conversation (required for --auto)")
         fmt.Println("      --topic-file <path>       Read initial message from a text file (required for --auto)")
         fmt.Println("      --turns N                 Number of conversation turns (default: infinite)")
         fmt.Println("      --auto                    Enable autonomous conversation mode")
+        fmt.Println("      --summary-every N         With --auto, sum up the conversation every N turns to keep the context short")
+        fmt.Println("      --facilitator <agent>     Agent writing the summaries instead of the model (every 5 turns by default)")
         fmt.Println("      --save <filename>         Save conversation log to a file")
+        fmt.Println("      --listen                  Speak your messages instead of typing them (single agent only)")
+        fmt.Println("      --image <path>            Attach an image to the first message (single agent, multimodal models)")
+        fmt.Println("      --url <address>           Fetch a web page and share it with the agents as reference material")
+        fmt.Println("      --file <path> [--ocr]     Share a text file, or the text of an image read with OCR")
+        fmt.Println("      --mode <mode>             Chat in a structured mode, see Modes below")
         fmt.Println("  --with-random <N>             Start a conversation with N random agents")
+        fmt.Println("  --scenario <file.yaml|name>   Play a role-play scenario with the agents and roles it defines")
+        fmt.Println("  --pair <file> [\"message\"]     Pair program on a file with an agent, applying the diffs it proposes")
+        fmt.Println("  --pipeline \"A>B>...\"         Pass a topic through agents in turn, each working on the last one's output")
+        fmt.Println("      --topic \"message\"         What the first agent works on")
+        fmt.Println("      --save <filename>         Save the final result to a file")
+        fmt.Println("  --watch <file>                Send what is added to a file, like a build log, to an agent as it changes")
+        fmt.Println("      --agent <name>            Agent to send it to (default: the selected agent)")
+        fmt.Println("      --on-change \"instruction\" What the agent does with it (default: summarize what is new)")
+        fmt.Println("  --export-story <title>        Compile a story written with --mode story into chapters; --output saves it")
         fmt.Println("  --install <agent_name>        Install a new agent from the store")
+        fmt.Println("  --install <url|file.yaml>     Install an agent from a URL or a local YAML file")
         fmt.Println("  --uninstall <agent_name>      Uninstall a user-defined agent")
+        fmt.Println("  --clone <agent> <new_name>    Copy an agent under a new name; --customize edits the copy")
+        fmt.Println("  --rename <agent> <new_name>   Rename a user-defined agent, keeping its chat history")
+        fmt.Println("  --edit <agent_name>           Edit an agent's YAML in $EDITOR, saving it once it is valid")
+        fmt.Println("  --disable <agent_name>        Hide an agent from --list, --with-random and selection, keeping its history")
+        fmt.Println("  --enable <agent_name>         Make a disabled agent available again")
         fmt.Println("  --show <agent_name>           Show detailed information about an agent")
         fmt.Println("  --store                       List available agents in store")
         fmt.Println("  --store --category <n>        List agents in a specific category")
         fmt.Println("  --store --tags <tag1,tag2>    List agents with specific tags")
         fmt.Println("  --store --search <query>      Search for agents by name, description, or tags")
+        fmt.Println("\nModes:")
+        for _, mode := range modes.All {
+            fmt.Printf("  %-29s %s\n", mode.Name, mode.Description)
+            fmt.Printf("      chatty %s\n", mode.Usage)
+        }
         fmt.Println("\nOptions for simple chat mode:")
         fmt.Println("  --save <filename>             Save conversation log to a file")
+        fmt.Println("  --image <path>                Attach an image for multimodal models like llava")
+        fmt.Println("  --url <address>               Fetch a web page and include its text in the prompt")
+        fmt.Println("  --file <path> [--ocr]         Include a text file, or the text of an image read with OCR")
+        fmt.Println("  --no-history                  Answer the message on its own, saving nothing and never asking anything")
+        fmt.Println("  --template <file|name>        Send a prompt template, with its {{placeholders}} filled in")
+        fmt.Println("      --var name=value          Value of a placeholder (or set CHATTY_VAR_NAME; {{stdin}} takes piped input)")
+        fmt.Println("\nGlobal options:")
+        fmt.Println("  --log <filename>              Append all output (without colors) to a file as it is printed")
+        fmt.Println("  --speak                       Read agent responses aloud (espeak, say or piper)")
+        fmt.Println("  --system \"<instructions>\"    Add instructions to the agents' system messages for this run")
+        fmt.Println("  --lang <language_code>        Reply in another language for this run, e.g. pt-BR")
+        fmt.Println("  --style <name>                Answer in a preset style for this run: concise, formal, verbose or eli5")
+        fmt.Println("  --translate <language_code>   Show a translation of each response beneath it, e.g. en-US")
+        fmt.Println("  --kb <name>                   Answer with excerpts from a knowledge base built with --ingest")
+        fmt.Println("  --project                     Answer with excerpts from the git repository in this directory")
+        fmt.Println("  --recall \"query\"              Search past conversations; with a chat command, bring the matches into it")
+        fmt.Println("  --config-profile <name>       Use a configuration profile for this run")
+        fmt.Println("  --profile                     Show time to first token, tokens/sec, retries and history I/O at exit")
+        fmt.Println("  --pprof <directory>           Also write CPU and heap profiles for go tool pprof")
+        fmt.Println("  --json                        Report errors as JSON on stderr, for scripts")
         fmt.Println("\nNote: The --debug flag can be used with any command to show debug information.")
         return
     }
@@ -1604,19 +7889,97 @@ func main() {
     case "--build":
         handler := builder.NewHandler(debugMode)
         if err := handler.HandleBuildCommand(os.Args[2:]); err != nil {
-            fmt.Printf("Error: %v\n", err)
-            os.Exit(1)
+            fail(err)
+        }
+        return
+    case "serve":
+        if err := handleServeCommand(os.Args[2:]); err != nil {
+            fail(err)
+        }
+        return
+    case "bridge":
+        if err := handleBridgeCommand(os.Args[2:]); err != nil {
+            fail(err)
+        }
+        return
+    case "tui":
+        if err := handleTUICommand(os.Args[2:]); err != nil {
+            fail(err)
+        }
+        return
+    case "--watch":
+        if err := handleWatchCommand(os.Args[2:]); err != nil {
+            fail(err)
+        }
+        return
+    case "profile":
+        if err := handleProfileCommand(os.Args[2:]); err != nil {
+            fail(err)
+        }
+        return
+    case "config":
+        if err := handleConfigCommand(os.Args[2:]); err != nil {
+            fail(err)
+        }
+        return
+    case "migrate-xdg":
+        migration, err := appdir.MigrateLegacy()
+        if err != nil {
+            fail(err)
+        }
+        palette := theme.Current()
+        fmt.Printf("%s✓ Moved %d files and directories out of %s%s\n", palette.Success, migration.Moved, migration.Legacy, colorReset)
+        fmt.Printf("  %sConfiguration:%s %s\n", palette.Label, colorReset, migration.Config)
+        fmt.Printf("  %sData:%s          %s\n", palette.Label, colorReset, migration.Data)
+        return
+    case "--tools":
+        if err := handleToolsCommand(os.Args[2:]); err != nil {
+            fail(err)
+        }
+        return
+    case "--memory":
+        if err := handleMemoryCommand(os.Args[2:]); err != nil {
+            fail(err)
+        }
+        return
+    case "--ingest":
+        if len(os.Args) < 3 {
+            fmt.Println("Usage: chatty --ingest <file|directory> [--kb <name>]")
+            return
+        }
+        name := kbOption
+        if name == "" {
+            name = kb.DefaultName
+        }
+        if err := ingestDocuments(os.Args[2], name); err != nil {
+            fail(err)
+        }
+        return
+    case "--kb":
+        if len(os.Args) < 4 || os.Args[2] != "add-remote" {
+            fmt.Println("Usage: chatty --kb add-remote <url> [name] [--refresh <duration>]")
+            fmt.Println("\nTo search a knowledge base, pass --kb <name> with a message or chat command")
+            return
+        }
+        if err := addRemoteKnowledge(os.Args[3:]); err != nil {
+            fail(err)
         }
         return
     case "--with":
         if len(os.Args) < 3 {
-            fmt.Println("Usage: chatty --with <agent_name> or <agent1>,<agent2>,... [options]")
+            fmt.Println("Usage: chatty --with <agent_name> or <agent1>,<agent2>,... or @<group> [options]")
             fmt.Println("\nOptions:")
             fmt.Println("  --topic \"message\"         Initial message for the conversation (required for --auto)")
             fmt.Println("  --topic-file <path>       Read initial message from a text file (required for --auto)")
             fmt.Println("  --turns N                 Number of conversation turns (default: infinite)")
             fmt.Println("  --auto                    Enable autonomous conversation mode (requires --topic)")
+            fmt.Println("  --summary-every N         With --auto, sum up the conversation every N turns to keep the context short")
+            fmt.Println("  --facilitator <agent>     Agent writing the summaries instead of the model (every 5 turns by default)")
             fmt.Println("  --save <filename>         Save conversation log to a file")
+            fmt.Println("  --listen                  Speak your messages instead of typing them (single agent only)")
+            fmt.Println("  --image <path>            Attach an image to the first message (single agent only)")
+            fmt.Println("  --url <address>           Fetch a web page and share it with the agents as reference material")
+            fmt.Println("  --file <path> [--ocr]     Share a text file, or the text of an image read with OCR")
             return
         }
 
@@ -1630,11 +7993,40 @@ func main() {
             }
         }
 
+        // Groups like @scientists stand for the agents listed under them in config.json
+        agentNames, err := agents.ExpandGroups(agentNames)
+        if err != nil {
+            hint := "Define groups under agent_groups in config.json, e.g. \"scientists\": [\"Einstein\", \"Tesla\"]"
+            if names := agents.GroupNames(); len(names) > 0 {
+                hint = "Groups in config.json: @" + strings.Join(names, ", @")
+            }
+            fail(failure.Wrap(failure.InvalidAgent, err), hint)
+        }
+
         if len(agentNames) == 0 {
             fmt.Println("Error: No valid agent names provided")
             return
         }
 
+        // Disabled agents stay out of chats until enabled again
+        for _, name := range agentNames {
+            if err := checkEnabled(name); err != nil {
+                fail(err, enableHint(name))
+            }
+        }
+
+        // Structured modes like interviews take their own options
+        mode, foundMode, err := extractGlobalOption("--mode")
+        if err != nil {
+            fail(err, "Usage: --mode "+strings.Join(modes.Names(), "|"))
+        }
+        if foundMode {
+            if err := handleModeCommand(mode, agentNames, os.Args[3:]); err != nil {
+                fail(err)
+            }
+            return
+        }
+
         // Single agent mode
         if len(agentNames) == 1 {
             // Get agent name
@@ -1642,10 +8034,7 @@ func main() {
             
             // Check if agent exists
             if !agents.IsValidAgent(agentName) {
-                fmt.Printf("Error: Invalid agent name '%s'\n", agentName)
-                fmt.Println("\nAvailable agents:")
-                fmt.Print(agents.ListAgents())
-                return
+                failInvalidAgent(agentName)
             }
 
             // Parse other arguments
@@ -1653,8 +8042,12 @@ func main() {
             var topicMessage string
             var foundTopicArg bool
             var autoMode bool
+            var listen bool
+            var imagePaths []string
+            var attachments attachmentOptions
+            var messageArgs []string
 
-            // Find the --topic, --topic-file, and --save arguments
+            // Find the --topic, --topic-file, --save, --listen, --image, --url, --file, and --ocr arguments
             for i := 3; i < len(os.Args); i++ {
                 switch os.Args[i] {
                 case "--topic":
@@ -1684,8 +8077,7 @@ func main() {
                     var err error
                     topicMessage, err = readStarterFile(os.Args[i+1])
                     if err != nil {
-                        fmt.Printf("Error: %v\n", err)
-                        return
+                        fail(err)
                     }
                     i++
                 case "--auto":
@@ -1698,19 +8090,64 @@ func main() {
                     }
                     saveFile = os.Args[i+1]
                     i++
+                case "--listen":
+                    listen = true
+                case "--image":
+                    if i+1 >= len(os.Args) {
+                        fmt.Println("Error: --image argument is missing")
+                        fmt.Println("\nUsage: --image <path>")
+                        return
+                    }
+                    imagePaths = append(imagePaths, os.Args[i+1])
+                    i++
+                case "--url":
+                    if i+1 >= len(os.Args) {
+                        fmt.Println("Error: --url argument is missing")
+                        fmt.Println("\nUsage: --url <address>")
+                        return
+                    }
+                    attachments.urls = append(attachments.urls, os.Args[i+1])
+                    i++
+                case "--file":
+                    if i+1 >= len(os.Args) {
+                        fmt.Println("Error: --file argument is missing")
+                        fmt.Println("\nUsage: --file <path> [--ocr]")
+                        return
+                    }
+                    attachments.files = append(attachments.files, os.Args[i+1])
+                    i++
+                case "--ocr":
+                    attachments.ocr = true
+                default:
+                    // A plain argument is the first message, like --topic
+                    if !strings.HasPrefix(os.Args[i], "--") {
+                        messageArgs = append(messageArgs, os.Args[i])
+                    }
                 }
             }
 
+            if len(messageArgs) > 0 {
+                if foundTopicArg {
+                    fmt.Println("Error: cannot use both a message and --topic or --topic-file")
+                    return
+                }
+                topicMessage = strings.Join(messageArgs, " ")
+            }
+
             // Auto mode is not valid for single agent chat
             if autoMode {
                 fmt.Println("Error: --auto flag is only valid for multi-agent conversations")
                 return
             }
 
+            reference, err := loadAttachments(attachments)
+            if err != nil {
+                fail(err)
+            }
+
             // Start the single-agent chat with the provided topic message or empty string
-            if err := handleSingleAgentChat(agentName, topicMessage, saveFile); err != nil {
-                fmt.Printf("Error: %v\n", err)
-                return
+            if err := handleSingleAgentChat(agentName, topicMessage, saveFile, listen, imagePaths, reference); err != nil {
+                fail(err)
             }
             return
         } else {
@@ -1722,11 +8159,13 @@ func main() {
             var foundTopicArg bool
             var autoMode bool
             var saveFile string
+            var attachments attachmentOptions
 
             // Set the agent names
             config.Agents = agentNames
+            config.SummaryEvery, config.Facilitator = extractSummaryOptions()
 
-            // Find the --topic, --topic-file, --auto, --turns, and --save arguments
+            // Find the --topic, --topic-file, --auto, --turns, --save, --url, --file, and --ocr arguments
             for i := 3; i < len(os.Args); i++ {
                 switch os.Args[i] {
                 case "--topic":
@@ -1756,8 +8195,7 @@ func main() {
                     var err error
                     topicMessage, err = readStarterFile(os.Args[i+1])
                     if err != nil {
-                        fmt.Printf("Error: %v\n", err)
-                        return
+                        fail(err)
                     }
                     i++
                 case "--auto":
@@ -1779,6 +8217,24 @@ func main() {
                     }
                     saveFile = os.Args[i+1]
                     i++
+                case "--url":
+                    if i+1 >= len(os.Args) {
+                        fmt.Println("Error: --url argument is missing")
+                        fmt.Println("\nUsage: --url <address>")
+                        return
+                    }
+                    attachments.urls = append(attachments.urls, os.Args[i+1])
+                    i++
+                case "--file":
+                    if i+1 >= len(os.Args) {
+                        fmt.Println("Error: --file argument is missing")
+                        fmt.Println("\nUsage: --file <path> [--ocr]")
+                        return
+                    }
+                    attachments.files = append(attachments.files, os.Args[i+1])
+                    i++
+                case "--ocr":
+                    attachments.ocr = true
                 }
             }
 
@@ -1787,6 +8243,9 @@ func main() {
                 fmt.Println("Error: --topic or --topic-file is required when using --auto")
                 return
             }
+            if config.SummaryEvery > 0 && !autoMode {
+                fail(fmt.Errorf("--summary-every and --facilitator only apply to --auto conversations"))
+            }
 
             // Display participants list for auto mode
             if autoMode {
@@ -1794,7 +8253,7 @@ func main() {
                 fmt.Println("Participants:")
                 for i, agentName := range agentNames {
                     agent := agents.GetAgentConfig(agentName)
-                    fmt.Printf("%d. %s %s - %s\n", i+1, agent.Emoji, agent.Name, agent.Description)
+                    fmt.Printf("%d. %s %s - %s\n", i+1, theme.AgentEmoji(agent.Emoji, agent.Name), agent.Name, agent.Description)
                 }
                 fmt.Println()
             }
@@ -1805,17 +8264,14 @@ func main() {
                 fmt.Println("Participants:")
                 for i, agentName := range agentNames {
                     agent := agents.GetAgentConfig(agentName)
-                    fmt.Printf("%d. %s %s - %s\n", i+1, agent.Emoji, agent.Name, agent.Description)
+                    fmt.Printf("%d. %s %s - %s\n", i+1, theme.AgentEmoji(agent.Emoji, agent.Name), agent.Name, agent.Description)
                 }
                 
                 fmt.Println("\nEnter your message to start the conversation:")
                 fmt.Println()
                 fmt.Println("Press Enter with empty message to end the conversation")
                 fmt.Println()
-                fmt.Print(colorize("👤 User: ", "\033[1;36m"))
-                
-                reader := bufio.NewReader(os.Stdin)
-                input, err := reader.ReadString('\n')
+                input, err := readUserInput()
                 if err != nil {
                     fmt.Printf("Error reading input: %v\n", err)
                     return
@@ -1832,10 +8288,13 @@ func main() {
             config.Turns = turns
             config.AutoMode = autoMode
             config.SaveFile = saveFile
+            config.Reference, err = loadAttachments(attachments)
+            if err != nil {
+                fail(err)
+            }
 
-            if err := handleMultiAgentConversation(config); err != nil {
-                fmt.Printf("Error: %v\n", err)
-                return
+            if err := runConversation(config); err != nil {
+                fail(err)
             }
             return
         }
@@ -1848,6 +8307,8 @@ func main() {
             fmt.Println("  --topic-file <path>       Read initial message from a text file (required for --auto)")
             fmt.Println("  --turns N                 Number of conversation turns (default: infinite)")
             fmt.Println("  --auto                    Enable autonomous conversation mode")
+            fmt.Println("  --summary-every N         With --auto, sum up the conversation every N turns to keep the context short")
+            fmt.Println("  --facilitator <agent>     Agent writing the summaries instead of the model (every 5 turns by default)")
             fmt.Println("  --save <filename>         Save conversation log to a file")
             return
         }
@@ -1862,8 +8323,7 @@ func main() {
         // Get random agents
         selectedAgents, err := getRandomAgents(numAgents)
         if err != nil {
-            fmt.Printf("Error: %v\n", err)
-            return
+            fail(err)
         }
 
         // Parse other arguments
@@ -1873,125 +8333,458 @@ func main() {
         var foundTopicArg bool
         var autoMode bool
         var saveFile string
+        var attachments attachmentOptions
 
         // Set the randomly selected agents
         config.Agents = selectedAgents
+        config.SummaryEvery, config.Facilitator = extractSummaryOptions()
+
+        // Find the --topic, --topic-file, --auto, --turns, --save, --url, --file, and --ocr arguments
+        for i := 3; i < len(os.Args); i++ {
+            switch os.Args[i] {
+            case "--topic":
+                if foundTopicArg {
+                    fmt.Println("Error: cannot use both --topic and --topic-file")
+                    return
+                }
+                foundTopicArg = true
+                if i+1 >= len(os.Args) {
+                    fmt.Println("Error: --topic argument is missing")
+                    fmt.Println("\nUsage: --topic \"your message here\"")
+                    return
+                }
+                topicMessage = os.Args[i+1]
+                i++
+            case "--topic-file":
+                if foundTopicArg {
+                    fmt.Println("Error: cannot use both --topic and --topic-file")
+                    return
+                }
+                foundTopicArg = true
+                if i+1 >= len(os.Args) {
+                    fmt.Println("Error: --topic-file argument is missing")
+                    fmt.Println("\nUsage: --topic-file <path>")
+                    return
+                }
+                var err error
+                topicMessage, err = readStarterFile(os.Args[i+1])
+                if err != nil {
+                    fail(err)
+                }
+                i++
+            case "--auto":
+                autoMode = true
+            case "--turns":
+                if i+1 < len(os.Args) {
+                    turns, err = strconv.Atoi(os.Args[i+1])
+                    if err != nil {
+                        fmt.Printf("Error: invalid turns value: %v\n", err)
+                        return
+                    }
+                    i++
+                }
+            case "--save":
+                if i+1 >= len(os.Args) {
+                    fmt.Println("Error: --save argument is missing")
+                    fmt.Println("\nUsage: --save <filename>")
+                    return
+                }
+                saveFile = os.Args[i+1]
+                i++
+            case "--url":
+                if i+1 >= len(os.Args) {
+                    fmt.Println("Error: --url argument is missing")
+                    fmt.Println("\nUsage: --url <address>")
+                    return
+                }
+                attachments.urls = append(attachments.urls, os.Args[i+1])
+                i++
+            case "--file":
+                if i+1 >= len(os.Args) {
+                    fmt.Println("Error: --file argument is missing")
+                    fmt.Println("\nUsage: --file <path> [--ocr]")
+                    return
+                }
+                attachments.files = append(attachments.files, os.Args[i+1])
+                i++
+            case "--ocr":
+                attachments.ocr = true
+            }
+        }
+
+        // For autonomous mode, topic is required
+        if autoMode && !foundTopicArg {
+            fmt.Println("Error: --topic or --topic-file is required when using --auto")
+            return
+        }
+        if config.SummaryEvery > 0 && !autoMode {
+            fail(fmt.Errorf("--summary-every and --facilitator only apply to --auto conversations"))
+        }
+
+        // Display participants list for auto mode
+        if autoMode {
+            fmt.Println("\n🎭 Multi-agent conversation started")
+            fmt.Println("Participants:")
+            for i, agentName := range selectedAgents {
+                agent := agents.GetAgentConfig(agentName)
+                fmt.Printf("%d. %s %s - %s\n", i+1, theme.AgentEmoji(agent.Emoji, agent.Name), agent.Name, agent.Description)
+            }
+            fmt.Println()
+        }
+
+        // For interactive mode, if no topic is provided, prompt the user
+        if !autoMode && !foundTopicArg {
+            fmt.Println("\n🎭 Multi-agent conversation started")
+            fmt.Println("Participants:")
+            for i, agentName := range selectedAgents {
+                agent := agents.GetAgentConfig(agentName)
+                fmt.Printf("%d. %s %s - %s\n", i+1, theme.AgentEmoji(agent.Emoji, agent.Name), agent.Name, agent.Description)
+            }
+            
+            fmt.Println("\nEnter your message to start the conversation:")
+            fmt.Println()
+            fmt.Println("Press Enter with empty message to end the conversation")
+            fmt.Println()
+            input, err := readUserInput()
+            if err != nil {
+                fmt.Printf("Error reading input: %v\n", err)
+                return
+            }
+            
+            topicMessage = strings.TrimSpace(input)
+            if topicMessage == "" {
+                fmt.Println("Conversation cancelled.")
+                return
+            }
+        }
+
+        config.Starter = topicMessage
+        config.Turns = turns
+        config.AutoMode = autoMode
+        config.SaveFile = saveFile
+        config.Reference, err = loadAttachments(attachments)
+        if err != nil {
+            fail(err)
+        }
+
+        if err := runConversation(config); err != nil {
+            fail(err)
+        }
+        return
+
+    case "--scenario":
+        if len(os.Args) < 3 {
+            fmt.Println("Usage: chatty --scenario <file.yaml | name> [options]")
+            fmt.Println("\nOptions:")
+            fmt.Println("  --turns N                 Number of conversation turns, overriding the scenario's")
+            fmt.Println("  --auto                    Let the agents play it out among themselves")
+            fmt.Println("  --summary-every N         With --auto, sum up the conversation every N turns to keep the context short")
+            fmt.Println("  --facilitator <agent>     Agent writing the summaries instead of the model (every 5 turns by default)")
+            fmt.Println("  --save <filename>         Save conversation log to a file")
+            fmt.Println("\nNames are looked up in the scenarios directory next to config.json.")
+            return
+        }
+
+        path, err := scenario.Path(os.Args[2])
+        if err != nil {
+            fail(err)
+        }
+        play, err := scenario.Load(path)
+        if err != nil {
+            fail(err)
+        }
+
+        var config ConversationConfig
+        config.SummaryEvery, config.Facilitator = extractSummaryOptions()
+        config.Agents = play.Agents()
+        config.Turns = play.Turns
+        config.AutoMode = play.Auto
+        config.WinConditions = play.WinConditions
+        for i := range play.Participants {
+            config.Briefings = append(config.Briefings, play.Briefing(i))
+        }
+
+        // The options on the command line take precedence over the scenario's
+        for i := 3; i < len(os.Args); i++ {
+            switch os.Args[i] {
+            case "--auto":
+                config.AutoMode = true
+            case "--turns":
+                if i+1 >= len(os.Args) {
+                    fail(fmt.Errorf("--turns argument is missing"), "Usage: --turns N")
+                }
+                config.Turns, err = strconv.Atoi(os.Args[i+1])
+                if err != nil || config.Turns < 0 {
+                    fail(fmt.Errorf("invalid turns value: '%s'", os.Args[i+1]))
+                }
+                i++
+            case "--save":
+                if i+1 >= len(os.Args) {
+                    fail(fmt.Errorf("--save argument is missing"), "Usage: --save <filename>")
+                }
+                config.SaveFile = os.Args[i+1]
+                i++
+            default:
+                fail(fmt.Errorf("unknown option for --scenario: %s", os.Args[i]), "Run 'chatty --scenario' to see the options")
+            }
+        }
+        if config.SummaryEvery > 0 && !config.AutoMode {
+            fail(fmt.Errorf("--summary-every and --facilitator only apply to --auto conversations"))
+        }
+        if config.AutoMode && play.UserRole != "" {
+            fail(fmt.Errorf("the scenario gives the user a role, so it can't be played with --auto"))
+        }
 
-        // Find the --topic, --topic-file, --auto, --turns, and --save arguments
+        for _, name := range config.Agents {
+            if !agents.IsValidAgent(name) {
+                failInvalidAgent(name)
+            }
+            if err := checkEnabled(name); err != nil {
+                fail(err, enableHint(name))
+            }
+        }
+
+        palette := theme.Current()
+        fmt.Printf("\n%s🎬 %s%s\n", palette.Heading, play.Title, colorReset)
+        if setting := strings.TrimSpace(play.Setting); setting != "" {
+            fmt.Printf("%s%s%s\n", palette.Muted, setting, colorReset)
+        }
+        fmt.Printf("\n%sCast:%s\n", palette.Section, colorReset)
+        for i, participant := range play.Participants {
+            agent := agents.GetAgentConfig(participant.Agent)
+            fmt.Printf("%d. %s %s%s%s as %s\n", i+1, theme.AgentEmoji(agent.Emoji, agent.Name),
+                palette.Label, agent.Name, colorReset, strings.TrimSpace(participant.Role))
+        }
+        if play.UserRole != "" {
+            fmt.Printf("%d. 👤 %sYou%s as %s\n", len(play.Participants)+1, palette.Label, colorReset, strings.TrimSpace(play.UserRole))
+        }
+        if len(play.WinConditions) > 0 {
+            fmt.Printf("\n%sEnds when:%s\n", palette.Section, colorReset)
+            for _, condition := range play.WinConditions {
+                fmt.Printf("- %s\n", strings.TrimSpace(condition))
+            }
+        }
+
+        // The opening narration sets the scene for every agent
+        config.Starter = play.Opening
+        if err := runConversation(config); err != nil {
+            fail(err)
+        }
+        return
+
+    case "--pipeline":
+        if len(os.Args) < 3 {
+            fmt.Println("Usage: chatty --pipeline \"Agent1>Agent2>...\" --topic \"message\" [options]")
+            fmt.Println("\nEach agent works on the output of the one before it; the last one's is the result.")
+            fmt.Println("\nOptions:")
+            fmt.Println("  --topic \"message\"         What the first agent works on (or pass it as a message)")
+            fmt.Println("  --topic-file <path>       Read the topic from a text file")
+            fmt.Println("  --save <filename>         Save the final result to a file")
+            return
+        }
+        stages, err := pipeline.Parse(os.Args[2])
+        if err != nil {
+            fail(err)
+        }
+        config := PipelineConfig{Stages: stages}
+        var words []string
         for i := 3; i < len(os.Args); i++ {
             switch os.Args[i] {
             case "--topic":
-                if foundTopicArg {
-                    fmt.Println("Error: cannot use both --topic and --topic-file")
-                    return
-                }
-                foundTopicArg = true
                 if i+1 >= len(os.Args) {
-                    fmt.Println("Error: --topic argument is missing")
-                    fmt.Println("\nUsage: --topic \"your message here\"")
-                    return
+                    fail(fmt.Errorf("--topic argument is missing"), "Usage: --topic \"message\"")
                 }
-                topicMessage = os.Args[i+1]
+                config.Topic = os.Args[i+1]
                 i++
             case "--topic-file":
-                if foundTopicArg {
-                    fmt.Println("Error: cannot use both --topic and --topic-file")
-                    return
-                }
-                foundTopicArg = true
                 if i+1 >= len(os.Args) {
-                    fmt.Println("Error: --topic-file argument is missing")
-                    fmt.Println("\nUsage: --topic-file <path>")
-                    return
+                    fail(fmt.Errorf("--topic-file argument is missing"), "Usage: --topic-file <path>")
                 }
-                var err error
-                topicMessage, err = readStarterFile(os.Args[i+1])
+                topic, err := readStarterFile(os.Args[i+1])
                 if err != nil {
-                    fmt.Printf("Error: %v\n", err)
-                    return
+                    fail(err)
                 }
+                config.Topic = topic
                 i++
-            case "--auto":
-                autoMode = true
-            case "--turns":
-                if i+1 < len(os.Args) {
-                    turns, err = strconv.Atoi(os.Args[i+1])
-                    if err != nil {
-                        fmt.Printf("Error: invalid turns value: %v\n", err)
-                        return
-                    }
-                    i++
-                }
             case "--save":
                 if i+1 >= len(os.Args) {
-                    fmt.Println("Error: --save argument is missing")
-                    fmt.Println("\nUsage: --save <filename>")
-                    return
+                    fail(fmt.Errorf("--save argument is missing"), "Usage: --save <filename>")
                 }
-                saveFile = os.Args[i+1]
+                config.SaveFile = os.Args[i+1]
                 i++
+            default:
+                if strings.HasPrefix(os.Args[i], "--") {
+                    fail(fmt.Errorf("unknown option for --pipeline: %s", os.Args[i]), "Run 'chatty --pipeline' to see the options")
+                }
+                words = append(words, os.Args[i])
+            }
+        }
+        if len(words) > 0 {
+            if config.Topic != "" {
+                fail(fmt.Errorf("cannot use both a message and --topic or --topic-file"))
+            }
+            config.Topic = strings.Join(words, " ")
+        }
+        config.Topic = strings.TrimSpace(config.Topic)
+        if config.Topic == "" {
+            fail(fmt.Errorf("a pipeline needs a topic"), "Usage: chatty --pipeline \""+os.Args[2]+"\" --topic \"message\"")
+        }
+        for _, name := range config.Stages {
+            if !agents.IsValidAgent(name) {
+                failInvalidAgent(name)
             }
+            if err := checkEnabled(name); err != nil {
+                fail(err, enableHint(name))
+            }
+        }
+        if err := handlePipeline(config); err != nil {
+            fail(err)
         }
+        return
 
-        // For autonomous mode, topic is required
-        if autoMode && !foundTopicArg {
-            fmt.Println("Error: --topic or --topic-file is required when using --auto")
+    case "--pair":
+        if len(os.Args) < 3 {
+            fmt.Println("Usage: chatty --pair <file> [\"message\"] [options]")
+            fmt.Println("\nOptions:")
+            fmt.Println("  --with <agent>            Agent to pair with (default: the selected agent)")
+            fmt.Println("  --save <filename>         Save conversation log to a file")
             return
         }
+        config := PairConfig{File: os.Args[2]}
+        var words []string
+        for i := 3; i < len(os.Args); i++ {
+            switch os.Args[i] {
+            case "--with":
+                if i+1 >= len(os.Args) {
+                    fail(fmt.Errorf("--with argument is missing"), "Usage: --with <agent_name>")
+                }
+                config.Agent = strings.TrimSpace(os.Args[i+1])
+                i++
+            case "--save":
+                if i+1 >= len(os.Args) {
+                    fail(fmt.Errorf("--save argument is missing"), "Usage: --save <filename>")
+                }
+                config.SaveFile = os.Args[i+1]
+                i++
+            default:
+                if strings.HasPrefix(os.Args[i], "--") {
+                    fail(fmt.Errorf("unknown option for --pair: %s", os.Args[i]), "Run 'chatty --pair' to see the options")
+                }
+                words = append(words, os.Args[i])
+            }
+        }
+        config.Starter = strings.TrimSpace(strings.Join(words, " "))
+        if config.Agent == "" {
+            config.Agent = defaultAgentName()
+        }
+        if !agents.IsValidAgent(config.Agent) {
+            failInvalidAgent(config.Agent)
+        }
+        if err := checkEnabled(config.Agent); err != nil {
+            fail(err, enableHint(config.Agent))
+        }
+        if err := handlePairProgramming(config); err != nil {
+            fail(err)
+        }
+        return
 
-        // Display participants list for auto mode
-        if autoMode {
-            fmt.Println("\n🎭 Multi-agent conversation started")
-            fmt.Println("Participants:")
-            for i, agentName := range selectedAgents {
-                agent := agents.GetAgentConfig(agentName)
-                fmt.Printf("%d. %s %s - %s\n", i+1, agent.Emoji, agent.Name, agent.Description)
+    case "--copy-code":
+        agentName := ""
+        if len(os.Args) > 2 {
+            agentName = os.Args[2]
+        }
+        if err := copyLastCodeBlock(agentName); err != nil {
+            fail(err)
+        }
+        return
+    case "--export":
+        if len(os.Args) < 3 {
+            fmt.Println("Usage: chatty --export <agent_name|log_file> [--format pdf|wav] [--output <filename>]")
+            exit(1)
+        }
+
+        source := os.Args[2]
+        format := ""
+        output := ""
+        for i := 3; i < len(os.Args); i++ {
+            switch os.Args[i] {
+            case "--format", "--output":
+                if i+1 >= len(os.Args) {
+                    fmt.Printf("Error: %s argument is missing\n", os.Args[i])
+                    exit(1)
+                }
+                if os.Args[i] == "--format" {
+                    format = strings.ToLower(os.Args[i+1])
+                } else {
+                    output = os.Args[i+1]
+                }
+                i++
+            default:
+                fmt.Printf("Error: unknown option %s\n", os.Args[i])
+                exit(1)
             }
-            fmt.Println()
         }
 
-        // For interactive mode, if no topic is provided, prompt the user
-        if !autoMode && !foundTopicArg {
-            fmt.Println("\n🎭 Multi-agent conversation started")
-            fmt.Println("Participants:")
-            for i, agentName := range selectedAgents {
-                agent := agents.GetAgentConfig(agentName)
-                fmt.Printf("%d. %s %s - %s\n", i+1, agent.Emoji, agent.Name, agent.Description)
+        // Guess the format from the output file name when not given
+        if format == "" {
+            format = strings.TrimPrefix(strings.ToLower(filepath.Ext(output)), ".")
+            if format == "" {
+                format = export.FormatPDF
             }
-            
-            fmt.Println("\nEnter your message to start the conversation:")
-            fmt.Println()
-            fmt.Println("Press Enter with empty message to end the conversation")
-            fmt.Println()
-            fmt.Print(colorize("👤 User: ", "\033[1;36m"))
-            
-            reader := bufio.NewReader(os.Stdin)
-            input, err := reader.ReadString('\n')
+        }
+
+        if err := exportConversation(source, format, output); err != nil {
+            fail(err)
+        }
+        return
+    case "--export-story":
+        if len(os.Args) < 3 {
+            fmt.Println("Usage: chatty --export-story <title> [--output <file.md>]")
+            titles, err := story.List()
             if err != nil {
-                fmt.Printf("Error reading input: %v\n", err)
-                return
+                fail(err)
             }
-            
-            topicMessage = strings.TrimSpace(input)
-            if topicMessage == "" {
-                fmt.Println("Conversation cancelled.")
-                return
+            if len(titles) > 0 {
+                fmt.Printf("\nStories: %s\n", strings.Join(titles, ", "))
             }
+            return
         }
 
-        config.Starter = topicMessage
-        config.Turns = turns
-        config.AutoMode = autoMode
-        config.SaveFile = saveFile
+        output := ""
+        for i := 3; i < len(os.Args); i++ {
+            switch os.Args[i] {
+            case "--output":
+                if i+1 >= len(os.Args) {
+                    fmt.Printf("Error: %s argument is missing\n", os.Args[i])
+                    exit(1)
+                }
+                output = os.Args[i+1]
+                i++
+            default:
+                fmt.Printf("Error: unknown option %s\n", os.Args[i])
+                exit(1)
+            }
+        }
 
-        if err := handleMultiAgentConversation(config); err != nil {
-            fmt.Printf("Error: %v\n", err)
+        tale, err := story.Open(os.Args[2])
+        if err != nil {
+            fail(err, "Run 'chatty --export-story' to list the stories")
+        }
+        // Without --output the manuscript goes to stdout, to be piped or redirected
+        if output == "" {
+            fmt.Print(tale.Markdown())
             return
         }
+        if err := saveConversationLog(output, tale.Markdown()); err != nil {
+            fail(err)
+        }
+        fmt.Printf("%s✅ %s exported to %s (%d chapters)%s\n", theme.Current().Success, tale.Title, output, len(tale.Chapters), colorReset)
         return
-
     case "--current":
         fmt.Printf("Current agent: %s - %s\n", currentAgent.Name, currentAgent.Description)
+        if project != nil {
+            fmt.Printf("Project settings: %s\n", project.Path)
+        }
         return
     case "--share":
         if len(os.Args) < 3 {
@@ -2002,8 +8795,7 @@ func main() {
 
         handler := share.NewHandler(debugMode)
         if err := handler.ShareAgent(os.Args[2]); err != nil {
-            fmt.Printf("Error: %v\n", err)
-            os.Exit(1)
+            fail(err)
         }
         return
     case "--select":
@@ -2015,10 +8807,10 @@ func main() {
 
         agentName := os.Args[2]
         if !agents.IsValidAgent(agentName) {
-            fmt.Printf("Error: Invalid agent name '%s'\n", agentName)
-            fmt.Println("\nAvailable agents:")
-            fmt.Print(agents.ListAgents())
-            return
+            failInvalidAgent(agentName)
+        }
+        if err := checkEnabled(agentName); err != nil {
+            fail(err, enableHint(agentName))
         }
 
         if err := agents.UpdateCurrentAgent(agentName); err != nil {
@@ -2027,8 +8819,11 @@ func main() {
         }
 
         agent := agents.GetAgentConfig(agentName)
-        fmt.Printf("\n✅ Current agent set to: %s %s\n", agent.Emoji, agent.Name)
+        fmt.Printf("\n✅ Current agent set to: %s %s\n", theme.AgentEmoji(agent.Emoji, agent.Name), agent.Name)
         fmt.Printf("Description: %s\n", agent.Description)
+        if project != nil && project.Agent != "" && !strings.EqualFold(project.Agent, agent.Name) {
+            fmt.Printf("\nNote: %s chooses %s while you work in this project\n", project.Path, project.Agent)
+        }
         return
     case "--clear":
         target := "all"
@@ -2036,11 +8831,16 @@ func main() {
             target = os.Args[2]
         }
         if err := clearHistory(target); err != nil {
-            fmt.Printf("Error: %v\n", err)
-            return
+            fail(err)
         }
         return
     case "--list":
+        if extractGlobalFlag("--stats") {
+            if err := printAgentStats(); err != nil {
+                fail(err)
+            }
+            return
+        }
         fmt.Print(agents.ListAgents())
         return
     case "--store":
@@ -2070,7 +8870,7 @@ func main() {
             } else {
                 fmt.Printf("Unknown flag: %s\n", os.Args[i])
                 fmt.Println("\nUsage: chatty --store [--category \"Category Name\"] [--tags \"tag1,tag2\"] [--search \"query\"]")
-                os.Exit(1)
+                exit(1)
             }
         }
         
@@ -2098,21 +8898,27 @@ func main() {
         }
         
         if err != nil {
-            fmt.Printf("Error: %v\n", err)
-            os.Exit(1)
+            fail(err)
         }
         return
     case "--install":
         if len(os.Args) < 3 {
-            fmt.Println("Error: Missing agent name. Usage: chatty --install <agent_name>")
+            fmt.Println("Error: Missing agent name. Usage: chatty --install <agent_name|url|file.yaml>")
             fmt.Println("\nUse 'chatty --store' to see available agents.")
-            os.Exit(1)
+            exit(1)
+        }
+
+        // Agents can also come from a URL or a file shared outside the store
+        if isAgentSource(os.Args[2]) {
+            if err := installAgentSource(os.Args[2]); err != nil {
+                fail(err)
+            }
+            return
         }
 
         handler := store.NewHandler(debugMode)
         if err := handler.InstallAgent(os.Args[2]); err != nil {
-            fmt.Printf("Error: %v\n", err)
-            os.Exit(1)
+            fail(err)
         }
         return
     case "--uninstall":
@@ -2121,81 +8927,180 @@ func main() {
             fmt.Println("\nUsage: chatty --uninstall \"Agent Name\"")
             fmt.Println("\nNote: Only user-defined agents can be uninstalled.")
             fmt.Println("To see available user-defined agents, use: chatty --list")
-            os.Exit(1)
+            exit(1)
         }
 
         agentName := os.Args[2]
         
-        // Define colors
-        colorMagenta := "\u001b[1;35m"
-        colorRed := "\u001b[1;31m"
-        colorGreen := "\u001b[1;32m"
-        colorPurple := "\u001b[1;95m"
-        colorReset := "\u001b[0m"
+        // Theme colors
+        palette := theme.Current()
+        colorHeading := palette.Heading
+        colorError := palette.Error
+        colorSuccess := palette.Success
+        colorLabel := palette.Label
 
         // Try to uninstall the agent
         if err := agents.UninstallAgent(agentName); err != nil {
-            if strings.Contains(err.Error(), "cannot uninstall built-in agent") {
-                fmt.Printf("\n%s🚫 Error:%s Cannot uninstall %s%s%s - it is a built-in agent\n", 
-                    colorRed, colorReset, colorMagenta, agentName, colorReset)
-                fmt.Println("\nOnly user-defined agents can be uninstalled.")
-                fmt.Printf("To see available user-defined agents, use: %schatty --list%s\n",
-                    colorPurple, colorReset)
-            } else if strings.Contains(err.Error(), "not found") {
-                fmt.Printf("\n%s🚫 Error:%s Agent %s%s%s not found\n", 
-                    colorRed, colorReset, colorMagenta, agentName, colorReset)
-                fmt.Printf("\nTo see available agents, use: %schatty --list%s\n",
-                    colorPurple, colorReset)
-            } else {
-                fmt.Printf("\n%s🚫 Error:%s %v\n", colorRed, colorReset, err)
+            if strings.Contains(err.Error(), "not found") {
+                err = failure.Wrap(failure.InvalidAgent, err)
             }
-            os.Exit(1)
+            failShowing(err, nil, func() {
+                if strings.Contains(err.Error(), "cannot uninstall built-in agent") {
+                    fmt.Printf("\n%s🚫 Error:%s Cannot uninstall %s%s%s - it is a built-in agent\n", 
+                        colorError, colorReset, colorHeading, agentName, colorReset)
+                    fmt.Println("\nOnly user-defined agents can be uninstalled.")
+                    fmt.Printf("To see available user-defined agents, use: %schatty --list%s\n",
+                        colorLabel, colorReset)
+                } else if strings.Contains(err.Error(), "not found") {
+                    fmt.Printf("\n%s🚫 Error:%s Agent %s%s%s not found\n", 
+                        colorError, colorReset, colorHeading, agentName, colorReset)
+                    fmt.Printf("\nTo see available agents, use: %schatty --list%s\n",
+                        colorLabel, colorReset)
+                } else {
+                    fmt.Printf("\n%s🚫 Error:%s %v\n", colorError, colorReset, err)
+                }
+            })
         }
 
         // Success message
         fmt.Printf("\n%s✅ Success:%s Agent %s%s%s has been uninstalled\n", 
-            colorGreen, colorReset, colorMagenta, agentName, colorReset)
+            colorSuccess, colorReset, colorHeading, agentName, colorReset)
         
         // Show available actions
         fmt.Println("\nQuick Actions:")
         fmt.Printf("  • %sView available agents:%s chatty --list\n", 
-            colorPurple, colorReset)
+            colorLabel, colorReset)
         fmt.Printf("  • %sView store agents:%s chatty --store\n", 
-            colorPurple, colorReset)
-        os.Exit(0)
+            colorLabel, colorReset)
+        exit(0)
+    case "--disable", "--enable":
+        disable := os.Args[1] == "--disable"
+        if len(os.Args) < 3 {
+            fail(fmt.Errorf("missing agent name"), fmt.Sprintf("Usage: chatty %s <agent_name>", os.Args[1]))
+        }
+        agentName := os.Args[2]
+        if !agents.IsValidAgent(agentName) {
+            failInvalidAgent(agentName)
+        }
+        if err := agents.SetDisabled(agentName, disable); err != nil {
+            fail(err)
+        }
+
+        palette := theme.Current()
+        agent := agents.GetAgentConfig(agentName)
+        if disable {
+            fmt.Printf("\n%s✅ Success:%s %s%s%s is disabled. Its file and chat history are kept\n",
+                palette.Success, colorReset, palette.Heading, agent.Name, colorReset)
+            fmt.Printf("To use it again: %schatty --enable \"%s\"%s\n", palette.Label, agent.Name, colorReset)
+        } else {
+            fmt.Printf("\n%s✅ Success:%s %s%s%s is enabled\n",
+                palette.Success, colorReset, palette.Heading, agent.Name, colorReset)
+        }
+        return
+    case "--edit":
+        if len(os.Args) < 3 {
+            fail(fmt.Errorf("missing agent name"), "Usage: chatty --edit <agent_name>")
+        }
+        if !agents.IsValidAgent(os.Args[2]) {
+            failInvalidAgent(os.Args[2])
+        }
+        if err := editAgent(os.Args[2]); err != nil {
+            fail(err)
+        }
+        return
+    case "--clone":
+        customize := extractGlobalFlag("--customize")
+        if len(os.Args) < 4 {
+            fail(fmt.Errorf("missing agent names"), "Usage: chatty --clone <agent_name> <new_name> [--customize]")
+        }
+        source, newName := os.Args[2], os.Args[3]
+        if !agents.IsValidAgent(source) {
+            failInvalidAgent(source)
+        }
+
+        path, err := agents.CloneAgent(source, newName)
+        if err != nil {
+            fail(err)
+        }
+
+        palette := theme.Current()
+        fmt.Printf("\n%s✅ Success:%s %s%s%s is now a copy of %s%s%s, saved to %s\n",
+            palette.Success, colorReset, palette.Heading, newName, colorReset,
+            palette.Heading, agents.GetAgentConfig(source).Name, colorReset, path)
+
+        // Let the copy be specialized right away
+        if customize {
+            handler := builder.NewHandler(debugMode)
+            edited, err := handler.EditAgentFile(path)
+            if err != nil {
+                fail(err)
+            }
+            if edited != nil {
+                newName = edited.Name
+                fmt.Printf("\n%s✅ Changes saved%s\n", palette.Success, colorReset)
+            }
+        }
+
+        fmt.Println("\nQuick Actions:")
+        fmt.Printf("  • %sChat with it:%s chatty --with \"%s\"\n", palette.Label, colorReset, newName)
+        fmt.Printf("  • %sView agent details:%s chatty --show \"%s\"\n", palette.Label, colorReset, newName)
+        return
+    case "--rename":
+        if len(os.Args) < 4 {
+            fail(fmt.Errorf("missing agent names"), "Usage: chatty --rename <agent_name> <new_name>")
+        }
+        oldName, newName := os.Args[2], strings.TrimSpace(os.Args[3])
+        if !agents.IsValidAgent(oldName) {
+            failInvalidAgent(oldName)
+        }
+        oldName = agents.GetAgentConfig(oldName).Name
+
+        path, err := renameAgent(oldName, newName)
+        if err != nil {
+            fail(err)
+        }
+
+        palette := theme.Current()
+        fmt.Printf("\n%s✅ Success:%s %s%s%s is now %s%s%s, saved to %s\n",
+            palette.Success, colorReset, palette.Heading, oldName, colorReset,
+            palette.Heading, newName, colorReset, path)
+        fmt.Println("Its chat history and memory moved along with it")
+        // A user-defined agent may have replaced a built-in one of the same name, which is back now
+        if agents.IsValidAgent(oldName) {
+            fmt.Printf("The built-in %s%s%s is available again\n", palette.Heading, agents.GetAgentConfig(oldName).Name, colorReset)
+        }
+
+        fmt.Println("\nQuick Actions:")
+        fmt.Printf("  • %sChat with it:%s chatty --with \"%s\"\n", palette.Label, colorReset, newName)
+        fmt.Printf("  • %sView agent details:%s chatty --show \"%s\"\n", palette.Label, colorReset, newName)
+        return
     case "--show":
         if len(os.Args) < 3 {
             fmt.Println("Error: Missing agent name. Usage: chatty --show <agent_name>")
-            os.Exit(1)
+            exit(1)
         }
 
         // First try local agents
         if agents.IsValidAgent(os.Args[2]) {
-            // Define color constants for better readability
-            colorMagenta := "\033[1;35m"
-            colorCyan := "\033[1;36m"
-            colorGreen := "\033[32m"
-            colorPurple := "\033[1;95m"
-            colorBlue := "\033[1;34m"
-            colorYellow := "\033[1;33m"
-            colorReset := "\033[0m"
-            
-            // Force a refresh of the agents cache
-            if err := agents.LoadAgents(); err != nil {
-                fmt.Printf("Error refreshing agents: %v\n", err)
-                os.Exit(1)
-            }
+            // Theme colors for better readability
+            palette := theme.Current()
+            colorHeading := palette.Heading
+            colorSection := palette.Section
+            colorSuccess := palette.Success
+            colorLabel := palette.Label
+            colorValue := palette.Value
+            colorEmphasis := palette.Emphasis
             
             // Check if the agent exists
             if !agents.IsValidAgent(os.Args[2]) {
                 // If not a valid agent, check if it's a sample agent
-                homeDir, err := os.UserHomeDir()
+                configDir, err := appdir.ConfigDir()
                 if err != nil {
-                    fmt.Printf("Error getting home directory: %v\n", err)
-                    os.Exit(1)
+                    fmt.Printf("Error: %v\n", err)
+                    exit(1)
                 }
                 
-                sampleAgentPath := filepath.Join(homeDir, ".chatty", "agents", os.Args[2]+".yaml.sample")
+                sampleAgentPath := filepath.Join(configDir, "agents", os.Args[2]+".yaml.sample")
                 
                 // First check if it's installed under a different name
                 if _, err := os.Stat(sampleAgentPath); err == nil {
@@ -2207,9 +9112,9 @@ func main() {
                             // Check if this agent is already installed under its proper name
                             if agents.IsValidAgent(sampleAgent.Name) {
                                 fmt.Printf("\n%s⚠️  Note:%s The agent '%s' is already installed as '%s'\n", 
-                                    colorYellow, colorReset, os.Args[2], sampleAgent.Name)
+                                    colorEmphasis, colorReset, os.Args[2], sampleAgent.Name)
                                 fmt.Printf("Please use: chatty --show \"%s\"\n\n", sampleAgent.Name)
-                                os.Exit(1)
+                                exit(1)
                             }
                         }
                     }
@@ -2219,47 +9124,48 @@ func main() {
                     data, err = os.ReadFile(sampleAgentPath)
                     if err != nil {
                         fmt.Printf("Error reading sample agent file: %v\n", err)
-                        os.Exit(1)
+                        exit(1)
                     }
                     
                     // Parse the YAML to get agent details
                     var agent agents.AgentConfig
                     if err := yaml.Unmarshal(data, &agent); err != nil {
                         fmt.Printf("Error parsing sample agent file: %v\n", err)
-                        os.Exit(1)
+                        exit(1)
                     }
 
                     fmt.Printf("\n%s🔍 Sample Agent Profile: %s%s%s\n", 
-                        colorMagenta, colorYellow, agent.Name, colorReset)
+                        colorHeading, colorEmphasis, agent.Name, colorReset)
                     
-                    fmt.Printf("\n%s📋 Basic Information%s\n", colorCyan, colorReset)
+                    fmt.Printf("\n%s📋 Basic Information%s\n", colorSection, colorReset)
                     fmt.Printf("  %s•%s %sIdentifier:%s %s\n", 
-                        colorGreen, colorReset, colorPurple, colorReset, os.Args[2])
+                        colorSuccess, colorReset, colorLabel, colorReset, os.Args[2])
                     fmt.Printf("  %s•%s %sEmoji:%s %s\n", 
-                        colorGreen, colorReset, colorPurple, colorReset, agent.Emoji)
+                        colorSuccess, colorReset, colorLabel, colorReset, agent.Emoji)
                     fmt.Printf("  %s•%s %sDescription:%s %s\n", 
-                        colorGreen, colorReset, colorPurple, colorReset, agent.Description)
+                        colorSuccess, colorReset, colorLabel, colorReset, agent.Description)
                     fmt.Printf("  %s•%s %sStatus:%s Sample (Not Installed)\n", 
-                        colorGreen, colorReset, colorPurple, colorReset)
+                        colorSuccess, colorReset, colorLabel, colorReset)
 
-                    fmt.Printf("\n%s🎭 System Message%s\n", colorCyan, colorReset)
-                    fmt.Printf("%s%s%s\n", colorBlue, agent.SystemMessage, colorReset)
+                    fmt.Printf("\n%s🎭 System Message%s\n", colorSection, colorReset)
+                    fmt.Printf("%s%s%s\n", colorValue, agent.SystemMessage, colorReset)
 
-                    fmt.Printf("\n%s💡 Quick Actions%s\n", colorCyan, colorReset)
+                    fmt.Printf("\n%s💡 Quick Actions%s\n", colorSection, colorReset)
                     fmt.Printf("  %s1.%s %sInstall this agent:%s chatty --install %s\n", 
-                        colorGreen, colorReset, colorPurple, colorReset, os.Args[2])
+                        colorSuccess, colorReset, colorLabel, colorReset, os.Args[2])
                     fmt.Printf("  %s2.%s %sAfter installation:%s chatty --select \"%s\"\n", 
-                        colorGreen, colorReset, colorPurple, colorReset, agent.Name)
+                        colorSuccess, colorReset, colorLabel, colorReset, agent.Name)
                     fmt.Printf("  %s3.%s %sStart chatting:%s chatty --with \"%s\"\n\n", 
-                        colorGreen, colorReset, colorPurple, colorReset, agent.Name)
+                        colorSuccess, colorReset, colorLabel, colorReset, agent.Name)
                 } else {
-                    fmt.Printf("Error: Agent '%s' not found\n", os.Args[2])
-                    fmt.Println("\nTry these commands:")
-                    fmt.Printf("  • %sView available agents:%s chatty --list\n", 
-                        colorPurple, colorReset)
-                    fmt.Printf("  • %sView sample agents:%s chatty --list-more\n", 
-                        colorPurple, colorReset)
-                    os.Exit(1)
+                    failShowing(failure.New(failure.InvalidAgent, "agent '%s' not found", os.Args[2]), nil, func() {
+                        fmt.Printf("Error: Agent '%s' not found\n", os.Args[2])
+                        fmt.Println("\nTry these commands:")
+                        fmt.Printf("  • %sView available agents:%s chatty --list\n", 
+                            colorLabel, colorReset)
+                        fmt.Printf("  • %sView sample agents:%s chatty --list-more\n", 
+                            colorLabel, colorReset)
+                    })
                 }
             } else {
                 // Get the agent configuration using the agents package
@@ -2279,17 +9185,21 @@ func main() {
                 }
                 
                 fmt.Printf("\n%s🔍 %s Profile: %s%s%s\n", 
-                    colorMagenta, agentType, colorYellow, agent.Name, colorReset)
+                    colorHeading, agentType, colorEmphasis, agent.Name, colorReset)
                 
-                fmt.Printf("\n%s📋 Basic Information%s\n", colorCyan, colorReset)
+                fmt.Printf("\n%s📋 Basic Information%s\n", colorSection, colorReset)
                 fmt.Printf("  %s•%s %sIdentifier:%s %s\n", 
-                    colorGreen, colorReset, colorPurple, colorReset, strings.ToLower(agent.Name))
+                    colorSuccess, colorReset, colorLabel, colorReset, strings.ToLower(agent.Name))
                 fmt.Printf("  %s•%s %sEmoji:%s %s\n", 
-                    colorGreen, colorReset, colorPurple, colorReset, agent.Emoji)
+                    colorSuccess, colorReset, colorLabel, colorReset, agent.Emoji)
                 fmt.Printf("  %s•%s %sDescription:%s %s\n", 
-                    colorGreen, colorReset, colorPurple, colorReset, agent.Description)
+                    colorSuccess, colorReset, colorLabel, colorReset, agent.Description)
                 fmt.Printf("  %s•%s %sType:%s %s\n", 
-                    colorGreen, colorReset, colorPurple, colorReset, agentType)
+                    colorSuccess, colorReset, colorLabel, colorReset, agentType)
+                if agent.LanguageCode != "" {
+                    fmt.Printf("  %s•%s %sLanguage:%s %s\n", 
+                        colorSuccess, colorReset, colorLabel, colorReset, agent.LanguageCode)
+                }
                 
                 // Determine status text
                 var statusText string
@@ -2300,13 +9210,22 @@ func main() {
                 }
                 
                 fmt.Printf("  %s•%s %sStatus:%s %s%s%s\n", 
-                    colorGreen, colorReset, colorPurple, colorReset,
-                    colorGreen, statusText, colorReset)
-
-                fmt.Printf("\n%s🎭 System Message%s\n", colorCyan, colorReset)
-                fmt.Printf("%s%s%s\n", colorBlue, agent.SystemMessage, colorReset)
-
-                fmt.Printf("\n%s💡 Quick Actions%s\n", colorCyan, colorReset)
+                    colorSuccess, colorReset, colorLabel, colorReset,
+                    colorSuccess, statusText, colorReset)
+
+                stats := usage.Get(agent.Name)
+                fmt.Printf("\n%s📊 Usage%s\n", colorSection, colorReset)
+                fmt.Printf("  %s•%s %sMessages:%s %d\n", 
+                    colorSuccess, colorReset, colorLabel, colorReset, stats.Messages)
+                fmt.Printf("  %s•%s %sTokens:%s %d\n", 
+                    colorSuccess, colorReset, colorLabel, colorReset, stats.Tokens)
+                fmt.Printf("  %s•%s %sLast used:%s %s\n", 
+                    colorSuccess, colorReset, colorLabel, colorReset, lastUsedText(stats.LastUsed))
+
+                fmt.Printf("\n%s🎭 System Message%s\n", colorSection, colorReset)
+                fmt.Printf("%s%s%s\n", colorValue, agent.SystemMessage, colorReset)
+
+                fmt.Printf("\n%s💡 Quick Actions%s\n", colorSection, colorReset)
                 
                 // Track action number
                 actionNum := 1
@@ -2314,42 +9233,47 @@ func main() {
                 // Show "Set as current agent" only if not active
                 if !isActive {
                     fmt.Printf("  %s%d.%s %sSet as current agent:%s chatty --select \"%s\"\n", 
-                        colorGreen, actionNum, colorReset, colorPurple, colorReset, agent.Name)
+                        colorSuccess, actionNum, colorReset, colorLabel, colorReset, agent.Name)
                     actionNum++
                 }
 
                 // Show chat actions with proper numbering
                 fmt.Printf("  %s%d.%s %sStart a chat:%s chatty --with \"%s\"\n", 
-                    colorGreen, actionNum, colorReset, colorPurple, colorReset, agent.Name)
+                    colorSuccess, actionNum, colorReset, colorLabel, colorReset, agent.Name)
                 actionNum++
 
                 fmt.Printf("  %s%d.%s %sStart group chat:%s chatty --with \"%s,<other_agent>\"\n", 
-                    colorGreen, actionNum, colorReset, colorPurple, colorReset, agent.Name)
+                    colorSuccess, actionNum, colorReset, colorLabel, colorReset, agent.Name)
                 actionNum++
 
                 fmt.Printf("  %s%d.%s %sAuto conversation:%s chatty --with \"%s,<other_agent>\" --auto --topic \"<topic or message>\"\n", 
-                    colorGreen, actionNum, colorReset, colorPurple, colorReset, agent.Name)
+                    colorSuccess, actionNum, colorReset, colorLabel, colorReset, agent.Name)
                 actionNum++
 
                 fmt.Printf("  %s%d.%s %sClear chat history:%s chatty --clear \"%s\"\n\n", 
-                    colorGreen, actionNum, colorReset, colorPurple, colorReset, agent.Name)
+                    colorSuccess, actionNum, colorReset, colorLabel, colorReset, agent.Name)
             }
         } else {
             // Try store agents
             handler := store.NewHandler(debugMode)
             if err := handler.ShowAgent(os.Args[2]); err != nil {
-                fmt.Printf("Error: Agent '%s' not found locally or in store\n", os.Args[2])
-                fmt.Println("\nTry these commands:")
-                fmt.Printf("  • View local agents:  chatty --list\n")
-                fmt.Printf("  • View store agents:  chatty --store\n")
-                os.Exit(1)
+                failShowing(failure.New(failure.InvalidAgent, "agent '%s' not found locally or in store", os.Args[2]), nil, func() {
+                    fmt.Printf("Error: Agent '%s' not found locally or in store\n", os.Args[2])
+                    fmt.Println("\nTry these commands:")
+                    fmt.Printf("  • View local agents:  chatty --list\n")
+                    fmt.Printf("  • View store agents:  chatty --store\n")
+                })
             }
         }
         return
     }
 
-    // Parse arguments for --save
+    // Parse arguments for --save, --image, --url, --file, --ocr, --template and --var
     var saveFile string
+    var templateName string
+    templateVars := make(map[string]string)
+    var imagePaths []string
+    var attachments attachmentOptions
     var messageArgs []string
     for i := 1; i < len(os.Args); i++ {
         if os.Args[i] == "--save" {
@@ -2360,28 +9284,111 @@ func main() {
             }
             saveFile = os.Args[i+1]
             i++ // Skip the filename in next iteration
+        } else if os.Args[i] == "--image" {
+            if i+1 >= len(os.Args) {
+                fmt.Println("Error: --image argument is missing")
+                fmt.Println("\nUsage: --image <path>")
+                return
+            }
+            imagePaths = append(imagePaths, os.Args[i+1])
+            i++
+        } else if os.Args[i] == "--url" {
+            if i+1 >= len(os.Args) {
+                fmt.Println("Error: --url argument is missing")
+                fmt.Println("\nUsage: --url <address>")
+                return
+            }
+            attachments.urls = append(attachments.urls, os.Args[i+1])
+            i++
+        } else if os.Args[i] == "--file" {
+            if i+1 >= len(os.Args) {
+                fmt.Println("Error: --file argument is missing")
+                fmt.Println("\nUsage: --file <path> [--ocr]")
+                return
+            }
+            attachments.files = append(attachments.files, os.Args[i+1])
+            i++
+        } else if os.Args[i] == "--ocr" {
+            attachments.ocr = true
+        } else if os.Args[i] == "--template" {
+            if i+1 >= len(os.Args) {
+                fmt.Println("Error: --template argument is missing")
+                fmt.Println("\nUsage: --template <file|name> [--var name=value]")
+                return
+            }
+            templateName = os.Args[i+1]
+            i++
+        } else if os.Args[i] == "--var" {
+            if i+1 >= len(os.Args) {
+                fmt.Println("Error: --var argument is missing")
+                fmt.Println("\nUsage: --var name=value")
+                return
+            }
+            name, value, err := templates.ParseVar(os.Args[i+1])
+            if err != nil {
+                fail(err)
+            }
+            templateVars[name] = value
+            i++
         } else {
             messageArgs = append(messageArgs, os.Args[i])
         }
     }
 
     userInput := strings.Join(messageArgs, " ")
+    if templateName != "" {
+        prompt, err := fillTemplate(templateName, templateVars)
+        if err != nil {
+            fail(err)
+        }
+        // Words after the template are added to it, like a note
+        userInput = strings.TrimSpace(prompt + "\n\n" + userInput)
+    } else if len(templateVars) > 0 {
+        fail(fmt.Errorf("--var only applies to --template"), "Usage: chatty --template <file|name> --var name=value")
+    }
     if userInput == "" {
         fmt.Println("Error: message cannot be empty")
         return
     }
     
-    // Load existing history
-    history, err := loadHistory()
+    // Without history, the message is answered on its own and nothing is locked or saved
+    history := initializeChat()
+    if !stateless {
+        lock, err := lockHistoryFile(currentAgent.Name)
+        if err != nil {
+            fail(err)
+        }
+        defer lock.Release()
+
+        // Load existing history
+        history, err = loadHistory()
+        if err != nil {
+            fmt.Printf("Error loading history: %v\n", err)
+            return
+        }
+    }
+
+    images, err := loadImages(imagePaths)
     if err != nil {
-        fmt.Printf("Error loading history: %v\n", err)
-        return
+        fail(err)
+    }
+
+    reference, err := loadAttachments(attachments)
+    if err != nil {
+        fail(err)
+    }
+    if reference != "" {
+        history = append(history, Message{
+            Role:    "user",
+            Content: reference,
+        })
     }
 
     // Add user message to history
     history = append(history, Message{
         Role:    "user",
         Content: userInput,
+        Images:  images,
     })
 
     // Convert existing history to use proper roles for the request
@@ -2402,45 +9409,31 @@ func main() {
     }
     
     // Prepare the request
+    knowledge := retrieveKnowledge(currentAgent, userInput)
     chatReq := ChatRequest{
         Model:    agents.GetCurrentModel(),
-        Messages: newHistory,
+        Messages: withKnowledge(newHistory, formatKnowledge(knowledge)),
         Stream:   true,
         KeepAlive: keepAlive,
-    }
-
-    jsonData, err := json.Marshal(chatReq)
-    if err != nil {
-        fmt.Printf("Error marshaling request: %v\n", err)
-        return
+        Tools:    availableTools(currentAgent),
     }
 
     // Print top margin
     printChatMargin(chatTopMargin)
 
     // Start the animation before making the API request
-    fmt.Printf("%s", colorize(getAgentLabel(), currentAgent.LabelColor))
     anim := startAnimation()
 
-    // Make the API request with timeout (passing false for regular chat)
-    resp, err := makeAPIRequest(jsonData)
+    // Make the API request and process the streaming response, running any tools the agent calls
+    fullResponseText, err := chatWithTools(chatReq, currentAgent, anim, false)
     if err != nil {
-        anim.stopAnimation() // Stop animation on error
-        fmt.Printf("\nError: %v\n", err)
-        if strings.Contains(err.Error(), "invalid model") {
-            fmt.Printf("\nHint: Edit ~/.chatty/config.json to set a valid model name\n")
-            fmt.Printf("Available models can be listed with: ollama list\n")
-        }
-        return
+        fmt.Println()
+        fail(err)
     }
-    defer resp.Body.Close()
 
-    // Process the streaming response (passing false for regular chat)
-    fullResponseText, err := processStreamResponse(resp, anim)
-    if err != nil {
-        fmt.Printf("\nError: %v\n", err)
-        return
-    }
+    // Show the documents the response is based on, and its translation
+    printCitations(fullResponseText, knowledge)
+    translateResponse(fullResponseText)
 
     // Ensure we're on a new line before printing margin
     fmt.Println()
@@ -2448,6 +9441,9 @@ func main() {
     // Print bottom margin
     printChatMargin(chatBottomMargin)
 
+    // Read the response aloud
+    speakResponse(currentAgent, fullResponseText)
+
     // Save the response to history
     history = append(history, Message{
         Role:    "assistant",
@@ -2455,18 +9451,20 @@ func main() {
     })
 
     // Save updated history
-    if err := saveHistory(history); err != nil {
-        fmt.Printf("\nWarning: Failed to save chat history: %v\n", err)
+    if !stateless {
+        if err := saveHistory(history); err != nil {
+            fmt.Printf("\nWarning: Failed to save chat history: %v\n", err)
+        }
     }
 
-    // Save conversation log if requested
+    // Save conversation log if requested, or if the agent always keeps one
+    if saveFile == "" && !stateless {
+        saveFile = autoSavePath(currentAgent)
+    }
     if saveFile != "" {
         var conversationLog strings.Builder
-        conversationLog.WriteString(fmt.Sprintf("👤 User: %s\n", userInput))
-        conversationLog.WriteString(fmt.Sprintf("%s %s: %s\n", 
-            currentAgent.Emoji, 
-            currentAgent.Name, 
-            fullResponseText))
+        conversationLog.WriteString(formatUserLabel() + userInput + "\n")
+        conversationLog.WriteString(agentLogEntry(currentAgent, fullResponseText))
         
         if err := saveConversationLog(saveFile, conversationLog.String()); err != nil {
             fmt.Printf("Warning: Failed to save conversation log: %v\n", err)
@@ -2474,4 +9472,6 @@ func main() {
             fmt.Printf("Conversation log saved to: %s\n", saveFile)
         }
     }
+
+    rememberUserFacts([]string{userInput})
 } 
\ No newline at end of file
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"chatty/cmd/chatty/tools"
+)
+
+// isolate points chatty at empty configuration and data directories, with no settings
+// overridden, for the length of a test
+func isolate(t *testing.T) {
+	t.Helper()
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("XDG_CONFIG_HOME", home+"/config")
+	t.Setenv("XDG_DATA_HOME", home+"/data")
+	t.Setenv("CHATTY_PROFILE", "")
+	t.Setenv("CHATTY_CONTEXT_WINDOW", "")
+	t.Setenv("OLLAMA_CONTEXT_LENGTH", "")
+}
+
+// turn returns a message of about n tokens
+func turn(role string, n int) Message {
+	return Message{Role: role, Content: strings.TrimSpace(strings.Repeat("word ", n))}
+}
+
+func TestFitContext(t *testing.T) {
+	isolate(t)
+	// A 400 token window leaves 300 for the prompt, 100 being kept for the response
+	t.Setenv("CHATTY_CONTEXT_WINDOW", "400")
+
+	call := Message{Role: "assistant", ToolCalls: []tools.Call{{Function: tools.CallFunction{Name: "calculator", Arguments: tools.Arguments{"expression": "1+1"}}}}}
+	tests := []struct {
+		name     string
+		messages []Message
+		want     []string // Roles of the messages left, in order
+	}{
+		{
+			name:     "fits",
+			messages: []Message{turn("system", 50), turn("user", 50), turn("assistant", 50), turn("user", 50)},
+			want:     []string{"system", "user", "assistant", "user"},
+		},
+		{
+			name:     "drops the oldest turns",
+			messages: []Message{turn("system", 50), turn("user", 100), turn("assistant", 100), turn("user", 60), turn("assistant", 60), turn("user", 60)},
+			want:     []string{"system", "user", "assistant", "user"},
+		},
+		{
+			name:     "without a system message",
+			messages: []Message{turn("user", 100), turn("assistant", 100), turn("user", 100), turn("assistant", 100)},
+			want:     []string{"user", "assistant"},
+		},
+		{
+			name:     "keeps the latest turn when it alone is too long",
+			messages: []Message{turn("system", 50), turn("user", 50), turn("assistant", 50), turn("user", 500)},
+			want:     []string{"system", "user"},
+		},
+		{
+			name:     "keeps the system message when it alone is too long",
+			messages: []Message{turn("system", 500), turn("user", 50), turn("assistant", 50), turn("user", 50)},
+			want:     []string{"system", "user"},
+		},
+		{
+			name:     "drops tool results with their call",
+			messages: []Message{turn("system", 50), turn("user", 100), call, turn("tool", 60), turn("tool", 60), turn("assistant", 50), turn("user", 50)},
+			want:     []string{"system", "assistant", "user"},
+		},
+	}
+	for i, tt := range tests {
+		chatReq := ChatRequest{Model: fmt.Sprintf("fit-%d", i), Messages: append([]Message{}, tt.messages...)}
+		estimate := fitContext(&chatReq)
+
+		var roles []string
+		for _, msg := range chatReq.Messages {
+			roles = append(roles, msg.Role)
+		}
+		if strings.Join(roles, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: fitContext left %q, want %q", tt.name, roles, tt.want)
+			continue
+		}
+		if tt.messages[0].Role == "system" && chatReq.Messages[0].Content != tt.messages[0].Content {
+			t.Errorf("%s: fitContext changed the system message", tt.name)
+		}
+		if last := chatReq.Messages[len(chatReq.Messages)-1]; last.Content != tt.messages[len(tt.messages)-1].Content {
+			t.Errorf("%s: fitContext didn't keep the latest message", tt.name)
+		}
+		if got := requestTokens(chatReq); estimate != got {
+			t.Errorf("%s: fitContext estimated %d tokens, the messages left are %d", tt.name, estimate, got)
+		}
+		if len(chatReq.Messages) > 2 && estimate > 300 {
+			t.Errorf("%s: fitContext left %d tokens, want at most 300", tt.name, estimate)
+		}
+		if chatReq.Options["num_ctx"] != 400 {
+			t.Errorf("%s: fitContext set options %v, want num_ctx 400", tt.name, chatReq.Options)
+		}
+	}
+}
+
+func TestContextWindow(t *testing.T) {
+	isolate(t)
+	models := map[string]string{
+		"created":   `{"parameters": "temperature 0.7\nnum_ctx 8192"}`,
+		"limited":   `{"parameters": "num_ctx 8192", "model_info": {"llama.context_length": 2048}}`,
+		"large":     `{"parameters": "num_ctx 8192", "model_info": {"llama.context_length": 131072}}`,
+		"plain":     `{}`,
+		"unlimited": `{"model_info": {"qwen2.context_length": 32768}}`,
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Model string `json:"model"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		info, ok := models[req.Model]
+		if r.URL.Path != "/api/show" || !ok {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, info)
+	}))
+	defer server.Close()
+	defer func(url string) { ollamaBaseURL = url }(ollamaBaseURL)
+	ollamaBaseURL = server.URL
+
+	tests := []struct {
+		model  string
+		server string // OLLAMA_CONTEXT_LENGTH
+		config string // CHATTY_CONTEXT_WINDOW
+		want   int
+	}{
+		{"created", "", "", 8192},
+		{"limited", "", "", 2048},
+		{"large", "", "", 8192},
+		{"plain", "", "", ollamaDefaultContext},
+		{"missing", "", "", ollamaDefaultContext},
+		{"unlimited", "16384", "", 16384},
+		{"created", "", "1000", 1000},
+	}
+	for _, tt := range tests {
+		contextWindowsMu.Lock()
+		delete(contextWindows, tt.model)
+		contextWindowsMu.Unlock()
+		t.Setenv("OLLAMA_CONTEXT_LENGTH", tt.server)
+		t.Setenv("CHATTY_CONTEXT_WINDOW", tt.config)
+		if got := contextWindow(tt.model); got != tt.want {
+			t.Errorf("contextWindow(%q) with OLLAMA_CONTEXT_LENGTH=%q CHATTY_CONTEXT_WINDOW=%q = %d, want %d", tt.model, tt.server, tt.config, got, tt.want)
+		}
+	}
+}
+
+func TestHistoryCompaction(t *testing.T) {
+	path := t.TempDir() + "/chat_history_ada.jsonl"
+	var history []Message
+	for i := 0; i < maxHistoryMessages+1; i++ {
+		role := "user"
+		if i%2 == 1 {
+			role = "assistant"
+		}
+		history = append(history, Message{Role: role, Content: fmt.Sprintf("message %d", i)})
+	}
+	if err := appendHistory(path, 0o600, history...); err != nil {
+		t.Fatal(err)
+	}
+
+	read, err := readHistory(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) > keptHistoryMessages || len(read) == 0 {
+		t.Fatalf("readHistory returned %d messages, want at most %d", len(read), keptHistoryMessages)
+	}
+	if read[0].Role != "user" {
+		t.Errorf("the compacted history starts with a %s message, want a user message", read[0].Role)
+	}
+	if last := read[len(read)-1].Content; last != history[len(history)-1].Content {
+		t.Errorf("the compacted history ends with %q, want the latest message", last)
+	}
+	if again, err := readHistory(path); err != nil || len(again) != len(read) {
+		t.Errorf("reading the compacted file again returned %d messages, %v, want %d", len(again), err, len(read))
+	}
+
+	// A file past maxHistoryBytes is compacted as soon as it is saved
+	large := strings.Repeat("x", maxHistoryBytes/8)
+	for i := 0; i < 10; i++ {
+		if err := appendHistory(path, 0o600, Message{Role: "user", Content: large}, Message{Role: "assistant", Content: "ok"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if info, err := os.Stat(path); err != nil || info.Size() > maxHistoryBytes {
+		t.Errorf("the history file is %d bytes after saving, want at most %d", info.Size(), maxHistoryBytes)
+	}
+}
+
+func TestLatestHistory(t *testing.T) {
+	history := []Message{{Role: "user", Content: "a"}, {Role: "assistant", Content: "b"}, {Role: "tool", Content: "c"}, {Role: "assistant", Content: "d"}}
+	if got := latestHistory(history); len(got) != len(history) {
+		t.Errorf("latestHistory dropped messages from a short history: %v", got)
+	}
+	if got := latestHistory(history[1:]); len(got) != 3 {
+		t.Errorf("latestHistory without a user message returned %v, want all of it", got)
+	}
+}
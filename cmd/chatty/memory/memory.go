@@ -0,0 +1,148 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"chatty/cmd/chatty/appdir"
+)
+
+const (
+	memoryFile = "memory.json"
+)
+
+// Fact is something durable chatty learned about the user
+type Fact struct {
+	ID      int       `json:"id"`
+	Text    string    `json:"text"`
+	Created time.Time `json:"created"`
+}
+
+// Store holds the facts remembered across conversations in ~/.chatty/memory.json
+type Store struct {
+	Facts []Fact `json:"facts"`
+
+	path string
+}
+
+// Load reads the memory file, returning an empty store if there is none yet
+func Load() (*Store, error) {
+	dataDir, err := appdir.DataDir()
+	if err != nil {
+		return nil, err
+	}
+
+	store := &Store{path: filepath.Join(dataDir, memoryFile)}
+	data, err := os.ReadFile(store.path)
+	if os.IsNotExist(err) {
+		return store, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read memory: %v", err)
+	}
+	if err := json.Unmarshal(data, store); err != nil {
+		return nil, fmt.Errorf("failed to parse memory: %v", err)
+	}
+	return store, nil
+}
+
+// Save writes the memory file
+func (s *Store) Save() error {
+	data, err := json.MarshalIndent(s, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to encode memory: %v", err)
+	}
+	if err := os.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write memory: %v", err)
+	}
+	return nil
+}
+
+// Add remembers a fact unless an identical one is already known, reporting whether it was added
+func (s *Store) Add(text string) (Fact, bool) {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		return Fact{}, false
+	}
+	for _, fact := range s.Facts {
+		if strings.EqualFold(strings.TrimSuffix(fact.Text, "."), strings.TrimSuffix(text, ".")) {
+			return fact, false
+		}
+	}
+
+	id := 1
+	for _, fact := range s.Facts {
+		if fact.ID >= id {
+			id = fact.ID + 1
+		}
+	}
+	fact := Fact{ID: id, Text: text, Created: time.Now()}
+	s.Facts = append(s.Facts, fact)
+	return fact, true
+}
+
+// Forget removes the fact with the given ID, reporting whether it existed
+func (s *Store) Forget(id int) bool {
+	for i, fact := range s.Facts {
+		if fact.ID == id {
+			s.Facts = append(s.Facts[:i], s.Facts[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// Clear forgets all facts
+func (s *Store) Clear() {
+	s.Facts = nil
+}
+
+// Prompt renders the facts as a section for system messages, or "" when nothing is remembered
+func (s *Store) Prompt() string {
+	if len(s.Facts) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	sb.WriteString("What you remember about the user from earlier conversations (use it naturally, without listing it back):")
+	for _, fact := range s.Facts {
+		sb.WriteString("\n- " + fact.Text)
+	}
+	return sb.String()
+}
+
+// ExtractionPrompt builds the instructions that ask a model for new durable facts in the user's messages
+func (s *Store) ExtractionPrompt() string {
+	var sb strings.Builder
+	sb.WriteString("You maintain a long-term memory about the user of a chat application. ")
+	sb.WriteString("Read the user's messages and extract durable facts worth remembering in future conversations, ")
+	sb.WriteString("such as their name, occupation, location, projects, preferences and the tools or languages they use. ")
+	sb.WriteString("Ignore one-off requests, questions, opinions about the current topic and anything said by the assistants. ")
+	sb.WriteString("Write each fact as a short third-person sentence, e.g. \"The user's name is Sam.\" or \"The user prefers Go.\" ")
+	if len(s.Facts) > 0 {
+		sb.WriteString("Do not repeat these facts that are already known:")
+		for _, fact := range s.Facts {
+			sb.WriteString("\n- " + fact.Text)
+		}
+		sb.WriteString("\n")
+	}
+	sb.WriteString("Reply with a JSON array of strings only, or [] if there is nothing new.")
+	return sb.String()
+}
+
+// ParseFacts reads the JSON array of facts from a model reply, tolerating text around it
+func ParseFacts(reply string) []string {
+	start := strings.Index(reply, "[")
+	end := strings.LastIndex(reply, "]")
+	if start < 0 || end < start {
+		return nil
+	}
+	var facts []string
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &facts); err != nil {
+		return nil
+	}
+	return facts
+}
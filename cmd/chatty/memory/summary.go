@@ -0,0 +1,66 @@
+package memory
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+
+	"chatty/cmd/chatty/atomicfile"
+)
+
+// Summary is an agent's rolling memory of its earlier sessions with the user
+type Summary struct {
+	Text     string    `json:"summary"`
+	Sessions int       `json:"sessions"` // Sessions folded into the summary
+	Updated  time.Time `json:"updated"`
+}
+
+// LoadSummary reads an agent's summary, returning an empty one if there is none yet
+func LoadSummary(path string) (Summary, error) {
+	var summary Summary
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return summary, nil
+	}
+	if err != nil {
+		return summary, fmt.Errorf("failed to read memory summary: %v", err)
+	}
+	if err := json.Unmarshal(data, &summary); err != nil {
+		return summary, fmt.Errorf("failed to parse memory summary: %v", err)
+	}
+	return summary, nil
+}
+
+// SaveSummary writes an agent's summary, replacing the previous one whole
+func SaveSummary(path string, summary Summary) error {
+	data, err := json.MarshalIndent(summary, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to encode memory summary: %v", err)
+	}
+	if err := atomicfile.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write memory summary: %v", err)
+	}
+	return nil
+}
+
+// Prompt renders the summary as a section for the agent's system message, or "" when it is empty
+func (s Summary) Prompt() string {
+	if s.Text == "" {
+		return ""
+	}
+	return "Summary of your earlier sessions with the user (continue from it as someone who remembers them):\n" + s.Text
+}
+
+// SummaryPrompt builds the instructions that fold a finished session into an agent's summary
+func (s Summary) SummaryPrompt(agentName string) string {
+	prompt := fmt.Sprintf("You maintain the long-term memory of %s, a chat agent. ", agentName) +
+		"Write an updated summary of all sessions between the agent and the user, merging the previous summary with the new session transcript. " +
+		"Keep the topics discussed, decisions, open questions and anything the agent promised to follow up on. " +
+		"Drop small talk and details that will not matter later. " +
+		"Write in the second person, addressed to the agent (\"You discussed...\"), in at most 200 words. Reply with the summary only."
+	if s.Text != "" {
+		prompt += "\n\nPrevious summary:\n" + s.Text
+	}
+	return prompt
+}
@@ -0,0 +1,126 @@
+package modes
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	DefaultIdeas = 3 // Ideas each agent contributes without --ideas
+	maxPicks     = 3 // Ideas each agent ranks when voting
+)
+
+var (
+	listItemPattern = regexp.MustCompile(`^\s*(?:\d+[.)]|[-*•])\s+(.+)$`)
+	votePattern     = regexp.MustCompile(`#(\d+)`)
+)
+
+// Idea is an idea contributed in a brainstorm, with the votes it got
+type Idea struct {
+	Text   string
+	Author string
+	Points int // From rankings: an agent's first pick gets the most
+	Votes  int // Agents that ranked it at all
+}
+
+// BrainstormGuidelines tells an agent how to take part in a brainstorm
+func BrainstormGuidelines() string {
+	return `You are taking part in a brainstorming session with other agents. Contribute ideas in your own voice and from your own expertise. Each idea should be concrete and different from the ones already suggested. When asked to vote, judge the ideas fairly on their merits, not on who suggested them.`
+}
+
+// IdeasPrompt asks an agent for its ideas on the topic, after the ones already suggested
+func IdeasPrompt(topic string, count int, earlier []Idea) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "Brainstorming topic: %s\n\n", topic)
+	if len(earlier) > 0 {
+		sb.WriteString("Ideas already suggested, which you must not repeat:\n")
+		for _, idea := range earlier {
+			fmt.Fprintf(&sb, "- %s (%s)\n", idea.Text, idea.Author)
+		}
+		sb.WriteString("\n")
+	}
+	fmt.Fprintf(&sb, "Suggest exactly %d new ideas as a numbered list, one line each: a short title in bold, a dash and one sentence on why it works. Write nothing before or after the list.", count)
+	return sb.String()
+}
+
+// ParseIdeas returns the ideas in an agent's reply, at most limit of them. Replies that aren't a
+// list count as a single idea
+func ParseIdeas(text string, limit int) []string {
+	var ideas []string
+	for _, line := range strings.Split(text, "\n") {
+		match := listItemPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		// Bold titles are asked for, but the list is shown as plain text
+		if idea := strings.TrimSpace(strings.ReplaceAll(match[1], "**", "")); idea != "" {
+			ideas = append(ideas, idea)
+		}
+		if len(ideas) == limit {
+			break
+		}
+	}
+	if len(ideas) == 0 && strings.TrimSpace(text) != "" {
+		ideas = append(ideas, strings.Join(strings.Fields(text), " "))
+	}
+	return ideas
+}
+
+// Picks returns how many ideas a voter ranks among the ideas of others
+func Picks(others int) int {
+	return min(maxPicks, others)
+}
+
+// VotePrompt asks an agent to rank the ideas, leaving out its own
+func VotePrompt(topic string, ideas []Idea, voter string, picks int) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "The brainstorm on \"%s\" is over. These are the ideas:\n\n", topic)
+	for i, idea := range ideas {
+		fmt.Fprintf(&sb, "#%d %s (%s)\n", i+1, idea.Text, idea.Author)
+	}
+	fmt.Fprintf(&sb, "\nVote for the best %d ideas that are not yours (%s). Answer with a numbered list, best first, each line starting with the idea's number like #4 and followed by a one-sentence reason. Write nothing else.", picks, voter)
+	return sb.String()
+}
+
+// ParseVotes returns the ideas a ballot ranks, best first, as indexes into the ideas. Numbers
+// outside the list, repeats and the ideas in skip are left out
+func ParseVotes(text string, count, picks int, skip map[int]bool) []int {
+	var ranked []int
+	seen := make(map[int]bool)
+	for _, match := range votePattern.FindAllStringSubmatch(text, -1) {
+		number, err := strconv.Atoi(match[1])
+		index := number - 1
+		if err != nil || index < 0 || index >= count || seen[index] || skip[index] {
+			continue
+		}
+		seen[index] = true
+		ranked = append(ranked, index)
+		if len(ranked) == picks {
+			break
+		}
+	}
+	return ranked
+}
+
+// Tally adds a ballot to the ideas: with n picks, the first gets n points and the last one
+func Tally(ideas []Idea, ranked []int, picks int) {
+	for place, index := range ranked {
+		ideas[index].Points += picks - place
+		ideas[index].Votes++
+	}
+}
+
+// Rank returns the ideas by points, then votes, ties keeping the order they were suggested in
+func Rank(ideas []Idea) []Idea {
+	ranked := append([]Idea(nil), ideas...)
+	sort.SliceStable(ranked, func(i, j int) bool {
+		if ranked[i].Points != ranked[j].Points {
+			return ranked[i].Points > ranked[j].Points
+		}
+		return ranked[i].Votes > ranked[j].Votes
+	})
+	return ranked
+}
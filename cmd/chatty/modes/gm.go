@@ -0,0 +1,41 @@
+package modes
+
+import "fmt"
+
+// GameMasterGuidelines tells the game master how to run the campaign, given where it stands
+func GameMasterGuidelines(campaign, state, recap string) string {
+	story := "This is the first session: create the setting and the player's situation."
+	if recap != "" {
+		story = "The story so far:\n" + recap
+	}
+	return fmt.Sprintf(`You are the game master of a tabletop role-playing campaign called "%s", played by the user.
+
+%s
+
+Current game state:
+%s
+
+Rules of play:
+- Describe the world vividly but briefly, voice the characters the party meets, and end every message by asking the player what they do.
+- Never decide the player's actions for them.
+- Whenever the outcome of an action is uncertain, call the roll_dice tool instead of inventing a result, and narrate what the roll means. Use 1d20 plus a modifier for checks and attacks.
+- Whenever the scene changes, the party gains or loses items, or something happens worth remembering in a later session, call the update_game_state tool right away. The game state is only what you save with it.
+- When the player writes "I rolled ...", they rolled the dice themselves: use that result.`, campaign, story, state)
+}
+
+// SessionPrompt starts a session: a new campaign opens with a scene, a continued one with a recap
+func SessionPrompt(resumed bool) string {
+	if resumed {
+		return "We are continuing the campaign. Give a short recap of where we left off, then set the scene and ask what I do."
+	}
+	return "Let's begin the campaign. Set the opening scene, save it with update_game_state, and ask what I do."
+}
+
+// RecapInstructions asks for the story so far when a session ends, for the next session to start from
+func RecapInstructions(campaign, earlier string) string {
+	previous := ""
+	if earlier != "" {
+		previous = "\n\nThe recap of the earlier sessions, to fold into the new one:\n" + earlier
+	}
+	return fmt.Sprintf(`You keep the records of a tabletop role-playing campaign called "%s". From the transcript of the session that just ended, write the story so far for the game master of the next session: the main events, the characters met, open quests and the cliffhanger the session ended on. Use at most 200 words of plain prose, without a title.%s`, campaign, previous)
+}
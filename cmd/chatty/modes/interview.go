@@ -0,0 +1,46 @@
+package modes
+
+import "fmt"
+
+// DefaultQuestions is how many questions an interview has without --questions
+const DefaultQuestions = 5
+
+// InterviewerGuidelines tells the interviewer how to run an interview about subject
+func InterviewerGuidelines(subject string, questions int) string {
+	return fmt.Sprintf(`You are conducting an interview for: %s.
+
+Interview rules:
+- The interview has %d questions. Ask exactly one question per message, never several at once.
+- Start with a one-line welcome, then ask the first question.
+- After each answer, react in one short sentence at most, then ask the next question. Follow up on weak or vague answers, and make the questions harder when answers are strong.
+- Do not answer your own questions, give hints, or evaluate the candidate until you are asked for the final evaluation.
+- Stay in character as the interviewer the whole time.`, subject, questions)
+}
+
+// QuestionPrompt asks the interviewer for the question with the number, counting from 1
+func QuestionPrompt(number, total int) string {
+	if number == total {
+		return fmt.Sprintf("Ask question %d of %d, the last one.", number, total)
+	}
+	return fmt.Sprintf("Ask question %d of %d.", number, total)
+}
+
+// IntervieweeGuidelines tells an agent taking the interview how to answer
+func IntervieweeGuidelines(subject, interviewer string) string {
+	return fmt.Sprintf(`You are being interviewed by %s for: %s.
+
+Answer each question as a strong candidate would, in your own voice and drawing on your own background. Keep answers focused, a few short paragraphs at most, and give concrete examples. Do not ask the interviewer questions back or play the interviewer.`, interviewer, subject)
+}
+
+// EvaluationPrompt asks the interviewer for the evaluation once the questions are answered
+func EvaluationPrompt(subject string, answered int) string {
+	return fmt.Sprintf(`The interview for %s is over after %d answered questions. Step out of the conversation and write the final evaluation of the candidate, in this structure:
+
+**Overall score:** a score from 1 to 10 and a one-sentence verdict
+**Answers:** one line per question with a score from 1 to 5 and why
+**Strengths:** two or three bullet points
+**To improve:** two or three bullet points, each with a concrete suggestion
+**Recommendation:** whether the candidate is ready for it (for a job: hire, maybe or no hire), with a short reason
+
+Base it only on the answers given.`, subject, answered)
+}
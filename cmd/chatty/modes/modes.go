@@ -0,0 +1,78 @@
+// Package modes holds the structured ways of chatting besides a free conversation, chosen with
+// --mode, and the instructions that keep agents to them
+package modes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Mode names for --mode
+const (
+	Interview  = "interview"
+	Brainstorm = "brainstorm"
+	GameMaster = "gm"
+	Tutor      = "tutor"
+	Standup    = "standup"
+	Story      = "story"
+)
+
+// Mode is a structured way of chatting
+type Mode struct {
+	Name        string
+	Description string
+	Usage       string // Agents it takes and its own options
+}
+
+// All lists the modes, as shown in help
+var All = []Mode{
+	{
+		Name:        Interview,
+		Description: "One agent interviews you, or a second agent, and evaluates the answers at the end",
+		Usage:       "--with <interviewer>[,<interviewee>] --mode interview \"<position or subject>\" [--questions N]",
+	},
+	{
+		Name:        Brainstorm,
+		Description: "Agents suggest ideas on a topic, then vote on them for a ranked list",
+		Usage:       "--with <agent1>,<agent2>,... --mode brainstorm \"<topic>\" [--ideas N]",
+	},
+	{
+		Name:        GameMaster,
+		Description: "An agent runs a tabletop role-playing game for you, rolling dice and keeping the scene and inventory between sessions",
+		Usage:       "--with <game_master> --mode gm \"<campaign>\"",
+	},
+	{
+		Name:        Tutor,
+		Description: "The agent teaches a topic by asking guiding questions, following a lesson plan and quizzing you along the way",
+		Usage:       "--with <tutor> --mode tutor \"<topic>\" [--quiz-every N]",
+	},
+	{
+		Name:        Standup,
+		Description: "The agent writes your daily standup from a notes file or your git commits since the last working day, ready for cron",
+		Usage:       "--with <agent> --mode standup [\"<project>\"] [--notes <file>] [--git <repository>] [--since <date>]",
+	},
+	{
+		Name:        Story,
+		Description: "Agents co-write a story chapter by chapter, keeping character sheets between sessions",
+		Usage:       "--with <agent1>,<agent2>,... --mode story \"<title>\" [--chapters N]",
+	},
+}
+
+// Names returns the names of the modes
+func Names() []string {
+	names := make([]string, len(All))
+	for i, mode := range All {
+		names[i] = mode.Name
+	}
+	return names
+}
+
+// Lookup returns the mode with the name, in any case
+func Lookup(name string) (Mode, error) {
+	for _, mode := range All {
+		if strings.EqualFold(mode.Name, name) {
+			return mode, nil
+		}
+	}
+	return Mode{}, fmt.Errorf("unknown mode '%s': use %s", name, strings.Join(Names(), ", "))
+}
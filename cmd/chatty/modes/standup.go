@@ -0,0 +1,57 @@
+package modes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+const maxNotes = 12000 // Characters of a notes file read, the latest ones
+
+// StandupSince returns when the work a standup covers started: the beginning of the previous
+// working day, so Monday's standup covers Friday
+func StandupSince(now time.Time) time.Time {
+	days := 1
+	switch now.Weekday() {
+	case time.Monday:
+		days = 3
+	case time.Sunday:
+		days = 2
+	}
+	day := now.AddDate(0, 0, -days)
+	return time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, now.Location())
+}
+
+// StandupGuidelines tells the agent how to write the standup summary
+func StandupGuidelines(since string) string {
+	return fmt.Sprintf(`You write daily standup updates from the user's notes and commits since %s. Write in the first person, as the user, in this structure and nothing else:
+
+**Yesterday**
+- What was done, grouped by topic, one bullet each
+
+**Today**
+- What comes next, from open items, work in progress and natural next steps
+
+**Blockers**
+- Anything blocked or waiting on someone, or "None"
+
+Keep it under 150 words, plain and specific. Leave out commit hashes, and don't invent work that isn't in the material.`, since)
+}
+
+// StandupInput joins the material a standup is written from
+func StandupInput(project, notes string, activity []string) string {
+	var sb strings.Builder
+	if project != "" {
+		fmt.Fprintf(&sb, "Project: %s\n\n", project)
+	}
+	if notes = strings.TrimSpace(notes); notes != "" {
+		if runes := []rune(notes); len(runes) > maxNotes {
+			notes = "[earlier notes left out]\n" + string(runes[len(runes)-maxNotes:])
+		}
+		fmt.Fprintf(&sb, "My notes:\n%s\n\n", notes)
+	}
+	for _, repository := range activity {
+		sb.WriteString(repository + "\n\n")
+	}
+	return strings.TrimSpace(sb.String())
+}
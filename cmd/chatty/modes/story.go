@@ -0,0 +1,100 @@
+package modes
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DefaultChapters = 1 // Chapters written in a session without --chapters
+	StoryRounds     = 2 // Passages each agent writes in a chapter
+)
+
+// StoryGuidelines tells an author how to co-write the story, and where it stands
+func StoryGuidelines(title, premise, sheets string, earlier []string) string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "You are co-writing a work of fiction titled \"%s\" with other authors, taking turns to write passages of it.", title)
+	if premise != "" {
+		fmt.Fprintf(&sb, "\n\nPremise: %s", premise)
+	}
+	if sheets != "" {
+		fmt.Fprintf(&sb, "\n\nCharacter sheets, which your writing must stay true to:\n%s", sheets)
+	}
+	if len(earlier) > 0 {
+		sb.WriteString("\n\nThe story so far:")
+		for i, summary := range earlier {
+			fmt.Fprintf(&sb, "\nChapter %d: %s", i+1, summary)
+		}
+	}
+	sb.WriteString(`
+
+Writing rules:
+- Write only the story itself: prose and dialogue, in the same tense and point of view as the passages before yours. No titles, headings, notes to the other authors or comments on the writing.
+- Continue exactly where the last passage stopped, without repeating or summarizing it.
+- Bring your own voice and style, but keep the story consistent.
+- Write two to four paragraphs.`)
+	return sb.String()
+}
+
+// CharacterPrompt asks an author to create a character for the cast
+func CharacterPrompt(sheets string) string {
+	others := ""
+	if sheets != "" {
+		others = " different from these:\n" + sheets + "\n\n"
+	}
+	return fmt.Sprintf("Before we start, create one character for the story%sAnswer with a single line, the character's name, a colon and their sheet: appearance, personality, what they want and what they hide, in at most 50 words.", others)
+}
+
+// PassagePrompt asks an author for the next passage of the chapter, given its text so far. The
+// opening passage follows on from the end of the previous chapter, when there is one
+func PassagePrompt(chapter int, previous, text string, last bool) string {
+	var sb strings.Builder
+	switch {
+	case text == "" && previous != "":
+		fmt.Fprintf(&sb, "The previous chapter ended with:\n\n%s\n\nWrite the opening passage of chapter %d.", previous, chapter)
+	case text == "":
+		fmt.Fprintf(&sb, "Write the opening passage of chapter %d.", chapter)
+	default:
+		fmt.Fprintf(&sb, "Chapter %d so far:\n\n%s\n\nWrite the next passage.", chapter, text)
+	}
+	if last {
+		sb.WriteString(" Yours is the last passage of the chapter: bring it to a close that makes the reader want the next one.")
+	}
+	return sb.String()
+}
+
+// ChapterInstructions asks for the title and summary of a finished chapter
+func ChapterInstructions() string {
+	return `You are the editor of a novel. Read the chapter and answer with exactly two lines:
+Title: a short, evocative title for the chapter
+Summary: what happens in it, in at most two sentences`
+}
+
+// ParseChapter reads the title and summary from the reply to ChapterInstructions
+func ParseChapter(reply string) (title, summary string) {
+	for _, line := range strings.Split(reply, "\n") {
+		line = strings.TrimSpace(strings.ReplaceAll(line, "**", ""))
+		if value, ok := cutLabel(line, "Title:"); ok {
+			title = strings.Trim(value, `"`)
+		} else if value, ok := cutLabel(line, "Summary:"); ok {
+			summary = value
+		}
+	}
+	return title, summary
+}
+
+// cutLabel returns what follows a label at the start of a line, in any case
+func cutLabel(line, label string) (string, bool) {
+	if len(line) < len(label) || !strings.EqualFold(line[:len(label)], label) {
+		return "", false
+	}
+	return strings.TrimSpace(line[len(label):]), true
+}
+
+// SheetsInstructions asks for the character sheets brought up to date with a chapter
+func SheetsInstructions(sheets string) string {
+	return fmt.Sprintf(`You keep the character sheets of a novel. These are the sheets before the chapter the user gives you:
+%s
+
+Update them with what the chapter changed: what the characters did, learned and now want. Add characters who became important. Answer with every character, one per line, as the name, a colon and the sheet in at most 60 words, and nothing else.`, sheets)
+}
@@ -0,0 +1,115 @@
+package modes
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	DefaultQuizEvery = 3 // Answers between quizzes without --quiz-every
+	maxLessonSteps   = 6
+)
+
+// Lesson is the plan of a tutoring session and how far the learner got through it
+type Lesson struct {
+	Topic   string
+	Steps   []string
+	Current int // Index of the step being taught, len(Steps) once all are done
+}
+
+// PlanInstructions asks the model for the steps of a lesson on a topic
+func PlanInstructions() string {
+	return fmt.Sprintf("You plan lessons. Break the topic the user gives into between 3 and %d steps, from the basics to the hardest idea, each building on the one before. Answer with a numbered list, one short line per step, and nothing else.", maxLessonSteps)
+}
+
+// NewLesson returns the lesson planned in the reply to PlanInstructions. A reply without a list
+// makes a lesson of a single step, the topic itself
+func NewLesson(topic, plan string) *Lesson {
+	lesson := &Lesson{Topic: topic}
+	for _, line := range strings.Split(plan, "\n") {
+		if match := listItemPattern.FindStringSubmatch(line); match != nil {
+			if step := strings.TrimSpace(strings.ReplaceAll(match[1], "**", "")); step != "" {
+				lesson.Steps = append(lesson.Steps, step)
+			}
+		}
+		if len(lesson.Steps) == maxLessonSteps {
+			break
+		}
+	}
+	if len(lesson.Steps) == 0 {
+		lesson.Steps = []string{topic}
+	}
+	return lesson
+}
+
+// Finished reports whether every step was taught
+func (l *Lesson) Finished() bool {
+	return l.Current >= len(l.Steps)
+}
+
+// Advance moves on to the next step
+func (l *Lesson) Advance() {
+	if !l.Finished() {
+		l.Current++
+	}
+}
+
+// Covered returns the steps taught so far, the current one included
+func (l *Lesson) Covered() []string {
+	return l.Steps[:min(l.Current+1, len(l.Steps))]
+}
+
+// Progress renders the plan with the steps done checked and the current one pointed at
+func (l *Lesson) Progress() string {
+	var sb strings.Builder
+	for i, step := range l.Steps {
+		mark := "[ ]"
+		switch {
+		case i < l.Current:
+			mark = "[x]"
+		case i == l.Current:
+			mark = "[>]"
+		}
+		fmt.Fprintf(&sb, "%s %d. %s\n", mark, i+1, step)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
+
+// TutorGuidelines tells the tutor to teach by asking, following the lesson plan
+func (l *Lesson) TutorGuidelines() string {
+	current := "All the steps are done: review what the learner found hardest and let them ask anything."
+	if !l.Finished() {
+		current = fmt.Sprintf("You are now on step %d: %s", l.Current+1, l.Steps[l.Current])
+	}
+	return fmt.Sprintf(`You are a Socratic tutor teaching the user: %s.
+
+Lesson plan:
+%s
+
+%s
+
+Tutoring rules:
+- Don't lecture or hand out answers. Lead the learner to work things out with one guiding question at a time, building on what they already know.
+- When they are wrong, don't just correct them: ask a question that shows where their reasoning breaks.
+- When they are stuck after two tries, give a small hint, never the full answer.
+- Keep each message short: at most a brief explanation and then your question.
+- Stay on the current step until the learner shows they understand it.`, l.Topic, l.Progress(), current)
+}
+
+// UnderstoodInstructions asks the model whether the learner has understood the current step
+func (l *Lesson) UnderstoodInstructions() string {
+	return fmt.Sprintf(`You follow a tutoring session on %s. Read the transcript and decide whether the learner has shown, in their own answers, that they understand this step: %s
+
+Answer YES only if their own words show it, not the tutor's. Otherwise answer NO. Answer YES or NO only.`, l.Topic, l.Steps[l.Current])
+}
+
+// QuizPrompt asks the tutor for a quiz on the steps covered so far, after the learner's message
+func (l *Lesson) QuizPrompt() string {
+	return fmt.Sprintf("Before going on, quiz me: reply briefly to my message, then ask me one short quiz question on what we covered so far (%s). Don't give the answer.",
+		strings.Join(l.Covered(), "; "))
+}
+
+// QuizAnswerPrompt has the tutor check the answer to its quiz before the lesson goes on
+func QuizAnswerPrompt(answer string) string {
+	return answer + "\n\n(This is my answer to your quiz. Tell me whether it's right, explain briefly what I missed if anything, then go on with the lesson.)"
+}
@@ -0,0 +1,217 @@
+package pair
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+var (
+	diffBlockPattern = regexp.MustCompile("(?s)```(?:diff|patch)[^\\n]*\\n(.*?)```")
+	hunkPattern      = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+)
+
+// Hunk is a change to a block of lines: Old is what is there now, with its context, and New
+// what replaces it
+type Hunk struct {
+	OldStart int // Line where Old starts, from 1, or 0 when the diff doesn't say
+	Old      []string
+	New      []string
+}
+
+// Diff is a change an agent proposed, in unified diff format
+type Diff struct {
+	Text  string
+	Hunks []Hunk
+}
+
+// Added and Removed count the lines the diff adds and removes
+func (d Diff) Added() int   { return d.count(func(h Hunk) int { return len(h.New) }) }
+func (d Diff) Removed() int { return d.count(func(h Hunk) int { return len(h.Old) }) }
+
+// count adds up a number over the hunks, leaving out the context lines they share
+func (d Diff) count(lines func(Hunk) int) int {
+	total := 0
+	for _, hunk := range d.Hunks {
+		total += lines(hunk) - shared(hunk)
+	}
+	return total
+}
+
+// shared returns how many lines of a hunk are context, kept on both sides
+func shared(h Hunk) int {
+	start := 0
+	for start < len(h.Old) && start < len(h.New) && h.Old[start] == h.New[start] {
+		start++
+	}
+	end := 0
+	for end < len(h.Old)-start && end < len(h.New)-start && h.Old[len(h.Old)-1-end] == h.New[len(h.New)-1-end] {
+		end++
+	}
+	return start + end
+}
+
+// Extract returns the diffs in the ```diff blocks of an agent's reply, skipping blocks that
+// aren't a change to anything
+func Extract(reply string) []Diff {
+	var diffs []Diff
+	for _, match := range diffBlockPattern.FindAllStringSubmatch(reply, -1) {
+		hunks := Parse(match[1])
+		if len(hunks) > 0 {
+			diffs = append(diffs, Diff{Text: strings.TrimRight(match[1], "\n"), Hunks: hunks})
+		}
+	}
+	return diffs
+}
+
+// Parse reads the hunks of a unified diff. File headers are skipped, and a diff without hunk
+// headers, as models sometimes write them, is read as a single hunk
+func Parse(diff string) []Hunk {
+	var hunks []Hunk
+	var current *Hunk
+	lines := strings.Split(strings.TrimRight(diff, "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := strings.TrimSuffix(lines[i], "\r")
+		switch {
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			current = nil
+			i++
+			continue
+		case strings.HasPrefix(line, "diff ") || strings.HasPrefix(line, "index ") || strings.HasPrefix(line, `\ `):
+			continue
+		case strings.HasPrefix(line, "@@"):
+			hunk := Hunk{}
+			if match := hunkPattern.FindStringSubmatch(line); match != nil {
+				hunk.OldStart, _ = strconv.Atoi(match[1])
+			}
+			hunks = append(hunks, hunk)
+			current = &hunks[len(hunks)-1]
+			continue
+		}
+		if current == nil {
+			hunks = append(hunks, Hunk{})
+			current = &hunks[len(hunks)-1]
+		}
+		switch {
+		case line == "":
+			// Blank context lines often lose their leading space
+			current.Old = append(current.Old, "")
+			current.New = append(current.New, "")
+		case line[0] == '-':
+			current.Old = append(current.Old, line[1:])
+		case line[0] == '+':
+			current.New = append(current.New, line[1:])
+		case line[0] == ' ':
+			current.Old = append(current.Old, line[1:])
+			current.New = append(current.New, line[1:])
+		default:
+			// Context that lost its leading space
+			current.Old = append(current.Old, line)
+			current.New = append(current.New, line)
+		}
+	}
+
+	changes := hunks[:0]
+	for _, hunk := range hunks {
+		if shared(hunk) < len(hunk.Old) || shared(hunk) < len(hunk.New) {
+			changes = append(changes, hunk)
+		}
+	}
+	return changes
+}
+
+// Apply returns the content with the diff's hunks applied in order. A hunk is placed where its
+// lines are found, nearest to the line it names, so a diff still applies after edits above it
+func Apply(content string, diff Diff) (string, error) {
+	lines := strings.Split(content, "\n")
+	from := 0   // Hunks apply after the ones before them
+	offset := 0 // Lines added by earlier hunks, moving the later ones
+	for n, hunk := range diff.Hunks {
+		at, replacement := -1, hunk.New
+		if len(hunk.Old) == 0 {
+			at = min(max(hunk.OldStart+offset, from), len(lines))
+		} else if at = find(lines, hunk.Old, from, hunk.OldStart-1+offset, exactLine); at < 0 {
+			// The hunk's context lines only match the file's ignoring whitespace, so the file's
+			// own are kept rather than the hunk's copies, which would change their indentation
+			if at = find(lines, hunk.Old, from, hunk.OldStart-1+offset, looseLine); at >= 0 {
+				replacement = keepContext(hunk, lines[at:at+len(hunk.Old)])
+			}
+		}
+		if at < 0 && len(diff.Hunks) > 1 {
+			return "", fmt.Errorf("hunk %d doesn't match the file, which may have changed since the diff was written", n+1)
+		}
+		if at < 0 {
+			return "", fmt.Errorf("the diff doesn't match the file, which may have changed since it was written")
+		}
+		lines = append(append(append([]string{}, lines[:at]...), replacement...), lines[at+len(hunk.Old):]...)
+		from = at + len(hunk.New)
+		offset += len(hunk.New) - len(hunk.Old)
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+// keepContext returns the new lines of a hunk with its context lines, those in both its old and
+// new lines, replaced by the lines of the file they matched
+func keepContext(hunk Hunk, matched []string) []string {
+	// Longest common subsequence of the old and new lines, which pairs up the context lines
+	common := make([][]int, len(hunk.Old)+1)
+	for i := range common {
+		common[i] = make([]int, len(hunk.New)+1)
+	}
+	for i := len(hunk.Old) - 1; i >= 0; i-- {
+		for j := len(hunk.New) - 1; j >= 0; j-- {
+			if hunk.Old[i] == hunk.New[j] {
+				common[i][j] = common[i+1][j+1] + 1
+			} else {
+				common[i][j] = max(common[i+1][j], common[i][j+1])
+			}
+		}
+	}
+
+	kept := append([]string{}, hunk.New...)
+	for i, j := 0, 0; i < len(hunk.Old) && j < len(hunk.New); {
+		switch {
+		case hunk.Old[i] == hunk.New[j]:
+			kept[j] = matched[i]
+			i++
+			j++
+		case common[i+1][j] >= common[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return kept
+}
+
+// exactLine and looseLine compare a line of the file with one of a hunk, looseLine ignoring
+// the whitespace around it
+func exactLine(a, b string) bool { return a == b }
+func looseLine(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) }
+
+// find returns where block is in lines at or after from, nearest to the line expected, or -1
+func find(lines, block []string, from, expected int, equal func(a, b string) bool) int {
+	best := -1
+	for i := from; i+len(block) <= len(lines); i++ {
+		matches := true
+		for j, line := range block {
+			if !equal(lines[i+j], line) {
+				matches = false
+				break
+			}
+		}
+		if matches && (best < 0 || distance(i, expected) < distance(best, expected)) {
+			best = i
+		}
+	}
+	return best
+}
+
+// distance returns how many lines apart two lines are
+func distance(a, b int) int {
+	if a > b {
+		return a - b
+	}
+	return b - a
+}
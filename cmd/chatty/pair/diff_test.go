@@ -0,0 +1,202 @@
+package pair
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestApply(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		diff    string
+		want    string
+	}{
+		{
+			name:    "single hunk",
+			content: "a\nb\nc\n",
+			diff:    "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want:    "a\nB\nc\n",
+		},
+		{
+			name:    "context offset",
+			content: "x\ny\na\nb\nc\n",
+			diff:    "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n",
+			want:    "x\ny\na\nB\nc\n",
+		},
+		{
+			name:    "nearest match to the named line",
+			content: "a\nb\nc\na\nb\nc\n",
+			diff:    "@@ -4,3 +4,3 @@\n a\n-b\n+B\n c\n",
+			want:    "a\nb\nc\na\nB\nc\n",
+		},
+		{
+			name:    "loose whitespace",
+			content: "func f() {\n\treturn 1\n}\n",
+			diff:    "@@ -1,3 +1,3 @@\n func f() {\n-    return 1\n+\treturn 2\n }\n",
+			want:    "func f() {\n\treturn 2\n}\n",
+		},
+		{
+			name:    "loose context keeps the file's indentation",
+			content: "func f() {\n    if ok {\n        return 1\n    }\n    return 0\n}\n",
+			diff:    "@@ -2,4 +2,4 @@\n   if ok {\n-    return 1\n+    return 2\n   }\n   return 0\n",
+			want:    "func f() {\n    if ok {\n    return 2\n    }\n    return 0\n}\n",
+		},
+		{
+			name:    "loose context between changes",
+			content: "\ta := 1\n\tb := 2\n\tc := 3\n",
+			diff:    "@@ -1,3 +1,3 @@\n-  a := 1\n+  a := 10\n   b := 2\n-  c := 3\n+  c := 30\n",
+			want:    "  a := 10\n\tb := 2\n  c := 30\n",
+		},
+		{
+			name:    "no trailing newline",
+			content: "a\nb\nc",
+			diff:    "@@ -2,2 +2,2 @@\n b\n-c\n\\ No newline at end of file\n+C\n\\ No newline at end of file\n",
+			want:    "a\nb\nC",
+		},
+		{
+			name:    "no trailing newline, appending",
+			content: "a\nb",
+			diff:    "@@ -1,2 +1,3 @@\n a\n b\n+c\n",
+			want:    "a\nb\nc",
+		},
+		{
+			name:    "multiple hunks",
+			content: "1\n2\n3\n4\n5\n6\n7\n8\n",
+			diff:    "@@ -1,2 +1,3 @@\n 1\n+1.5\n 2\n@@ -6,3 +7,2 @@\n 6\n-7\n 8\n",
+			want:    "1\n1.5\n2\n3\n4\n5\n6\n8\n",
+		},
+		{
+			name:    "multiple hunks with the same context",
+			content: "a\nb\nc\na\nb\nc\n",
+			diff:    "@@ -1,3 +1,3 @@\n a\n-b\n+B\n c\n@@ -4,3 +4,3 @@\n a\n-b\n+B2\n c\n",
+			want:    "a\nB\nc\na\nB2\nc\n",
+		},
+		{
+			name:    "file headers and no hunk header",
+			content: "a\nb\n",
+			diff:    "--- a/f.txt\n+++ b/f.txt\n a\n-b\n+c\n",
+			want:    "a\nc\n",
+		},
+		{
+			name:    "pure insertion",
+			content: "a\nb\n",
+			diff:    "@@ -1,0 +2,1 @@\n+x\n",
+			want:    "a\nx\nb\n",
+		},
+	}
+	for _, tt := range tests {
+		diff := Diff{Text: tt.diff, Hunks: Parse(tt.diff)}
+		got, err := Apply(tt.content, diff)
+		if err != nil {
+			t.Errorf("%s: Apply returned %v", tt.name, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%s: Apply = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplyMismatch(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		diff    string
+		err     string
+	}{
+		{
+			name:    "changed line",
+			content: "a\nb\nc\n",
+			diff:    "@@ -1,3 +1,3 @@\n a\n-x\n+B\n c\n",
+			err:     "the diff doesn't match",
+		},
+		{
+			name:    "second hunk",
+			content: "a\nb\nc\nd\n",
+			diff:    "@@ -1,2 +1,2 @@\n-a\n+A\n b\n@@ -3,2 +3,2 @@\n c\n-e\n+E\n",
+			err:     "hunk 2 doesn't match",
+		},
+		{
+			name:    "hunks out of order",
+			content: "a\nb\nc\nd\n",
+			diff:    "@@ -3,2 +3,2 @@\n-c\n+C\n d\n@@ -1,2 +1,2 @@\n-a\n+A\n b\n",
+			err:     "hunk 2 doesn't match",
+		},
+	}
+	for _, tt := range tests {
+		path := filepath.Join(t.TempDir(), "file.txt")
+		if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		file, err := Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Apply(file.Content, Diff{Text: tt.diff, Hunks: Parse(tt.diff)})
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: Apply returned %v, want an error with %q", tt.name, err, tt.err)
+		}
+		if got != "" {
+			t.Errorf("%s: Apply = %q with an error, want nothing", tt.name, got)
+		}
+		if file.Content != tt.content {
+			t.Errorf("%s: the file's content changed to %q", tt.name, file.Content)
+		}
+		if data, _ := os.ReadFile(path); string(data) != tt.content {
+			t.Errorf("%s: the file on disk changed to %q", tt.name, data)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		diff  string
+		hunks int
+		start []int
+	}{
+		{"one hunk", "@@ -3,2 +3,2 @@\n-a\n+b\n", 1, []int{3}},
+		{"two hunks", "@@ -1 +1 @@\n-a\n+b\n@@ -10,2 +10,2 @@\n x\n-c\n+d\n", 2, []int{1, 10}},
+		{"no hunk header", "-a\n+b\n", 1, []int{0}},
+		{"bare hunk header", "@@ @@\n-a\n+b\n", 1, []int{0}},
+		{"context only", "@@ -1,2 +1,2 @@\n a\n b\n", 0, nil},
+		{"empty", "", 0, nil},
+	}
+	for _, tt := range tests {
+		hunks := Parse(tt.diff)
+		if len(hunks) != tt.hunks {
+			t.Errorf("%s: Parse returned %d hunks, want %d", tt.name, len(hunks), tt.hunks)
+			continue
+		}
+		for i, hunk := range hunks {
+			if hunk.OldStart != tt.start[i] {
+				t.Errorf("%s: hunk %d starts at %d, want %d", tt.name, i+1, hunk.OldStart, tt.start[i])
+			}
+		}
+	}
+}
+
+func TestDiffCounts(t *testing.T) {
+	diff := Diff{Hunks: Parse("@@ -1,3 +1,4 @@\n a\n-b\n+B\n+B2\n c\n@@ -9 +10 @@\n-x\n")}
+	if diff.Added() != 2 || diff.Removed() != 2 {
+		t.Errorf("Added, Removed = %d, %d, want 2, 2", diff.Added(), diff.Removed())
+	}
+}
+
+func TestExtract(t *testing.T) {
+	reply := "Here's the fix:\n\n```diff\n@@ -1 +1 @@\n-a\n+b\n```\n\nAnd an example:\n\n```go\nfmt.Println()\n```\n\n" +
+		"```diff\n a\n b\n```\n\n```patch\n-c\n+d\n```\n"
+	diffs := Extract(reply)
+	if len(diffs) != 2 {
+		t.Fatalf("Extract returned %d diffs, want 2", len(diffs))
+	}
+	if diffs[0].Text != "@@ -1 +1 @@\n-a\n+b" {
+		t.Errorf("first diff is %q", diffs[0].Text)
+	}
+	if diffs[1].Text != "-c\n+d" {
+		t.Errorf("second diff is %q", diffs[1].Text)
+	}
+}
@@ -0,0 +1,85 @@
+// Package pair keeps a source file in an agent's context while pair programming: it notices when
+// the file changes on disk, and applies the diffs the agent proposes once the user accepts them
+package pair
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"chatty/cmd/chatty/atomicfile"
+)
+
+const maxFileSize = 256 << 10 // Larger files don't fit a model's context
+
+// File is the source file being worked on, as last read from disk
+type File struct {
+	Path    string
+	Content string
+	mode    os.FileMode
+}
+
+// Open reads the file to pair on
+func Open(path string) (*File, error) {
+	f := &File{Path: path}
+	if _, err := f.Sync(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// Sync reads the file again, reporting whether it changed since it was last read
+func (f *File) Sync() (bool, error) {
+	info, err := os.Stat(f.Path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %v", f.Path, err)
+	}
+	if info.IsDir() {
+		return false, fmt.Errorf("%s is a directory, not a file", f.Path)
+	}
+	if info.Size() > maxFileSize {
+		return false, fmt.Errorf("%s is too large to pair on (%d KB, at most %d KB)", f.Path, info.Size()>>10, maxFileSize>>10)
+	}
+	data, err := os.ReadFile(f.Path)
+	if err != nil {
+		return false, fmt.Errorf("failed to read %s: %v", f.Path, err)
+	}
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) >= 0 {
+		return false, fmt.Errorf("%s is not a text file", f.Path)
+	}
+	f.mode = info.Mode().Perm()
+	changed := string(data) != f.Content
+	f.Content = string(data)
+	return changed, nil
+}
+
+// Write saves new contents to the file, keeping its permissions
+func (f *File) Write(content string) error {
+	if err := atomicfile.WriteFile(f.Path, []byte(content), f.mode); err != nil {
+		return fmt.Errorf("failed to write %s: %v", f.Path, err)
+	}
+	f.Content = content
+	return nil
+}
+
+// Name returns the file's name without its directory
+func (f *File) Name() string {
+	return filepath.Base(f.Path)
+}
+
+// Context is the message that gives the agent the current contents of the file, with line
+// numbers left out so diffs are written against the exact text
+func (f *File) Context() string {
+	language := strings.TrimPrefix(filepath.Ext(f.Path), ".")
+	return fmt.Sprintf("Current contents of %s:\n\n```%s\n%s\n```", f.Name(), language, strings.TrimRight(f.Content, "\n"))
+}
+
+// Guidelines tells the agent how to pair program on the file
+func Guidelines(name string) string {
+	return fmt.Sprintf(`You are pair programming with the user on %s. Its current contents are always in the conversation, kept up to date as it changes.
+
+When you suggest a change to the file, write it as a unified diff in a `+"```diff"+` block, with a @@ header for each hunk and three lines of unchanged context around every change, copied exactly from the current contents. The user can apply it with one keypress, so keep each diff focused on one change and explain it briefly before the block. For questions and explanations, answer normally without a diff.`, name)
+}
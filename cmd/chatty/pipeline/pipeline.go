@@ -0,0 +1,49 @@
+// Package pipeline chains agents with --pipeline, each working on what the one before it wrote,
+// and holds the instructions that keep each agent to its part
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Separator goes between the agents of a pipeline, as in "Researcher>Summarizer>Critic"
+const Separator = ">"
+
+// Parse returns the agents of a pipeline in order
+func Parse(spec string) ([]string, error) {
+	var stages []string
+	for _, name := range strings.Split(spec, Separator) {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return nil, fmt.Errorf("'%s' has an empty stage: name an agent between each %s, e.g. \"Researcher>Summarizer>Critic\"", spec, Separator)
+		}
+		stages = append(stages, name)
+	}
+	return stages, nil
+}
+
+// Guidelines tells the agent of a stage, counting from 1, what its part in the pipeline is
+func Guidelines(stage int, stages []string) string {
+	var next string
+	if stage < len(stages) {
+		next = fmt.Sprintf(" Your output goes to %s, who works on it next, so write only the result, without greetings or remarks about the pipeline.", stages[stage])
+	} else {
+		next = " Yours is the last stage, so your output is the final result given to the user."
+	}
+	return fmt.Sprintf(`You are stage %d of %d in a pipeline of agents: %s.
+Each agent works on the output of the one before it, in its own role and expertise.%s`, stage, len(stages), strings.Join(stages, " → "), next)
+}
+
+// StagePrompt is the message the agent of a stage gets: the topic, and the output of the stage
+// before it, if any
+func StagePrompt(topic string, stage int, stages []string, previous string) string {
+	if stage == 1 {
+		return topic
+	}
+	return fmt.Sprintf(`The topic is: %s
+
+Here is the output of %s, the previous stage:
+
+%s`, topic, stages[stage-2], previous)
+}
@@ -0,0 +1,185 @@
+// Package profile measures where a run of chatty spends its time: how long the model takes to
+// start answering and how fast it writes, requests sent again, and time spent on files
+package profile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"sync"
+	"time"
+)
+
+const (
+	cpuProfileName  = "cpu.pprof"
+	heapProfileName = "heap.pprof"
+)
+
+var (
+	mu         sync.Mutex
+	enabled    bool
+	started    time.Time
+	requests   []Request
+	retries    int
+	operations = make(map[string]*Operation)
+	order      []string // Operations in the order they were first timed
+	cpuFile    *os.File
+	pprofDir   string
+)
+
+// Request is a response the model streamed
+type Request struct {
+	FirstToken time.Duration // From sending the request to the first chunk with content
+	Tokens     int           // Tokens generated
+	Generating time.Duration // Spent generating them
+}
+
+// TokensPerSecond returns how fast the response was generated, 0 when it wasn't measured
+func (r Request) TokensPerSecond() float64 {
+	if r.Generating <= 0 {
+		return 0
+	}
+	return float64(r.Tokens) / r.Generating.Seconds()
+}
+
+// Operation is the time spent on one kind of work, like reading chat histories
+type Operation struct {
+	Name  string
+	Count int
+	Total time.Duration
+	Max   time.Duration
+}
+
+// Summary is what was measured during the run
+type Summary struct {
+	Elapsed    time.Duration
+	Requests   []Request
+	Retries    int
+	Operations []Operation
+	PprofDir   string // Where the pprof profiles were written, empty when they weren't
+}
+
+// Enable starts measuring. Until it is called, the other functions do nothing
+func Enable() {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled {
+		enabled = true
+		started = time.Now()
+	}
+}
+
+// Enabled reports whether the run is being measured
+func Enabled() bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return enabled
+}
+
+// StartPprof enables measuring and records a CPU profile into dir, where a heap profile is also
+// written by Finish
+func StartPprof(dir string) error {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create profile directory: %v", err)
+	}
+	file, err := os.Create(filepath.Join(dir, cpuProfileName))
+	if err != nil {
+		return fmt.Errorf("failed to create CPU profile: %v", err)
+	}
+	if err := pprof.StartCPUProfile(file); err != nil {
+		file.Close()
+		return fmt.Errorf("failed to start CPU profile: %v", err)
+	}
+	Enable()
+	mu.Lock()
+	defer mu.Unlock()
+	cpuFile = file
+	pprofDir = dir
+	return nil
+}
+
+// AddRequest records a streamed response
+func AddRequest(request Request) {
+	mu.Lock()
+	defer mu.Unlock()
+	if enabled {
+		requests = append(requests, request)
+	}
+}
+
+// AddRetry records a request sent again after it failed
+func AddRetry() {
+	mu.Lock()
+	defer mu.Unlock()
+	if enabled {
+		retries++
+	}
+}
+
+// Time starts timing an operation, which ends when the returned function is called
+func Time(name string) func() {
+	if !Enabled() {
+		return func() {}
+	}
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		mu.Lock()
+		defer mu.Unlock()
+		operation, ok := operations[name]
+		if !ok {
+			operation = &Operation{Name: name}
+			operations[name] = operation
+			order = append(order, name)
+		}
+		operation.Count++
+		operation.Total += elapsed
+		if elapsed > operation.Max {
+			operation.Max = elapsed
+		}
+	}
+}
+
+// Finish stops measuring, writing the pprof profiles when they were requested, and returns what
+// was measured. It reports false when the run wasn't measured
+func Finish() (Summary, bool, error) {
+	mu.Lock()
+	defer mu.Unlock()
+	if !enabled {
+		return Summary{}, false, nil
+	}
+	enabled = false
+
+	summary := Summary{
+		Elapsed:  time.Since(started),
+		Requests: requests,
+		Retries:  retries,
+		PprofDir: pprofDir,
+	}
+	for _, name := range order {
+		summary.Operations = append(summary.Operations, *operations[name])
+	}
+
+	if cpuFile == nil {
+		return summary, true, nil
+	}
+	pprof.StopCPUProfile()
+	err := cpuFile.Close()
+	cpuFile = nil
+
+	heapFile, createErr := os.Create(filepath.Join(pprofDir, heapProfileName))
+	if createErr != nil {
+		return summary, true, fmt.Errorf("failed to create heap profile: %v", createErr)
+	}
+	defer heapFile.Close()
+	runtime.GC() // Up-to-date statistics of what is still in use
+	if writeErr := pprof.WriteHeapProfile(heapFile); writeErr != nil {
+		return summary, true, fmt.Errorf("failed to write heap profile: %v", writeErr)
+	}
+	if err != nil {
+		return summary, true, fmt.Errorf("failed to write CPU profile: %v", err)
+	}
+	return summary, true, nil
+}
@@ -0,0 +1,47 @@
+package render
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+// clipboardCommands lists the clipboard tools tried on each platform, in order of preference
+func clipboardCommands() [][]string {
+	switch runtime.GOOS {
+	case "darwin":
+		return [][]string{{"pbcopy"}}
+	case "windows":
+		return [][]string{{"clip"}}
+	default:
+		commands := [][]string{
+			{"xclip", "-selection", "clipboard"},
+			{"xsel", "--clipboard", "--input"},
+		}
+		// Prefer the Wayland tool when running under Wayland
+		if os.Getenv("WAYLAND_DISPLAY") != "" {
+			commands = append([][]string{{"wl-copy"}}, commands...)
+		}
+		return commands
+	}
+}
+
+// CopyToClipboard copies text to the system clipboard using the first available tool
+func CopyToClipboard(text string) error {
+	var tried []string
+	for _, args := range clipboardCommands() {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			tried = append(tried, args[0])
+			continue
+		}
+		cmd := exec.Command(args[0], args[1:]...)
+		cmd.Stdin = strings.NewReader(text)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to copy with %s: %v", args[0], err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no clipboard tool found (tried: %s)", strings.Join(tried, ", "))
+}
@@ -0,0 +1,217 @@
+package render
+
+import (
+	"strings"
+	"unicode"
+
+	"chatty/cmd/chatty/theme"
+)
+
+// language describes the lexical rules used to highlight a language
+type language struct {
+	keywords     map[string]bool
+	types        map[string]bool
+	lineComments []string
+	blockComment [2]string
+}
+
+// words builds a lookup set from a space separated list
+func words(list string) map[string]bool {
+	set := make(map[string]bool)
+	for _, w := range strings.Fields(list) {
+		set[w] = true
+	}
+	return set
+}
+
+var (
+	cLikeTypes = "int char float double void bool long short unsigned signed byte string"
+
+	languages = map[string]language{
+		"go": {
+			keywords:     words("break case chan const continue default defer else fallthrough for func go goto if import interface map package range return select struct switch type var nil true false iota"),
+			types:        words("bool byte complex64 complex128 error float32 float64 int int8 int16 int32 int64 rune string uint uint8 uint16 uint32 uint64 uintptr any"),
+			lineComments: []string{"//"},
+			blockComment: [2]string{"/*", "*/"},
+		},
+		"python": {
+			keywords:     words("and as assert async await break class continue def del elif else except finally for from global if import in is lambda nonlocal not or pass raise return try while with yield None True False self"),
+			types:        words("int float str bool list dict set tuple bytes object"),
+			lineComments: []string{"#"},
+		},
+		"javascript": {
+			keywords:     words("break case catch class const continue debugger default delete do else export extends finally for function if import in instanceof let new return super switch this throw try typeof var void while with yield async await of null undefined true false"),
+			types:        words("string number boolean any unknown never object void interface type enum"),
+			lineComments: []string{"//"},
+			blockComment: [2]string{"/*", "*/"},
+		},
+		"rust": {
+			keywords:     words("as async await break const continue crate dyn else enum extern false fn for if impl in let loop match mod move mut pub ref return self Self static struct super trait true type unsafe use where while"),
+			types:        words("i8 i16 i32 i64 i128 isize u8 u16 u32 u64 u128 usize f32 f64 bool char str String Vec Option Result Box"),
+			lineComments: []string{"//"},
+			blockComment: [2]string{"/*", "*/"},
+		},
+		"c": {
+			keywords:     words("auto break case const continue default do else enum extern for goto if inline register return sizeof static struct switch typedef union volatile while class namespace public private protected template typename new delete this true false nullptr NULL include define"),
+			types:        words(cLikeTypes + " size_t auto"),
+			lineComments: []string{"//"},
+			blockComment: [2]string{"/*", "*/"},
+		},
+		"java": {
+			keywords:     words("abstract assert break case catch class const continue default do else enum extends final finally for goto if implements import instanceof interface native new package private protected public return static super switch synchronized this throw throws transient try volatile while null true false var"),
+			types:        words(cLikeTypes + " String Integer Boolean Object List Map"),
+			lineComments: []string{"//"},
+			blockComment: [2]string{"/*", "*/"},
+		},
+		"shell": {
+			keywords:     words("if then else elif fi for while until do done case esac in function return local export exit echo source set unset readonly shift break continue"),
+			lineComments: []string{"#"},
+		},
+		"sql": {
+			keywords:     words("select from where insert into values update set delete create table drop alter index join inner left right outer on group by order having limit offset and or not null as distinct union all primary key foreign references SELECT FROM WHERE INSERT INTO VALUES UPDATE SET DELETE CREATE TABLE DROP ALTER INDEX JOIN INNER LEFT RIGHT OUTER ON GROUP BY ORDER HAVING LIMIT OFFSET AND OR NOT NULL AS DISTINCT UNION ALL PRIMARY KEY FOREIGN REFERENCES"),
+			types:        words("int integer varchar text boolean date timestamp serial INT INTEGER VARCHAR TEXT BOOLEAN DATE TIMESTAMP SERIAL"),
+			lineComments: []string{"--"},
+			blockComment: [2]string{"/*", "*/"},
+		},
+		"yaml": {
+			keywords:     words("true false null yes no"),
+			lineComments: []string{"#"},
+		},
+		"json": {
+			keywords: words("true false null"),
+		},
+	}
+
+	// Aliases commonly used in fenced code blocks
+	languageAliases = map[string]string{
+		"golang": "go", "py": "python", "python3": "python",
+		"js": "javascript", "jsx": "javascript", "ts": "javascript", "tsx": "javascript", "typescript": "javascript",
+		"rs": "rust", "cpp": "c", "c++": "c", "h": "c", "hpp": "c", "cs": "c", "csharp": "c",
+		"kotlin": "java", "kt": "java", "scala": "java",
+		"sh": "shell", "bash": "shell", "zsh": "shell", "console": "shell",
+		"yml": "yaml", "postgres": "sql", "mysql": "sql", "sqlite": "sql",
+	}
+)
+
+// lookupLanguage resolves a fence info string to a known language
+func lookupLanguage(name string) (language, bool) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if alias, ok := languageAliases[name]; ok {
+		name = alias
+	}
+	lang, ok := languages[name]
+	return lang, ok
+}
+
+// Highlighter colors code one line at a time, keeping block comment state between lines
+type Highlighter struct {
+	lang      language
+	known     bool
+	inComment bool
+	palette   theme.Theme
+}
+
+// NewHighlighter creates a highlighter for the given fence language
+func NewHighlighter(lang string) *Highlighter {
+	l, ok := lookupLanguage(lang)
+	return &Highlighter{lang: l, known: ok, palette: theme.Current()}
+}
+
+// HighlightLine returns the line with ANSI colors applied
+func (h *Highlighter) HighlightLine(line string) string {
+	if !h.known {
+		return h.palette.Code + line + h.palette.Reset
+	}
+
+	var sb strings.Builder
+	i := 0
+	for i < len(line) {
+		rest := line[i:]
+
+		// Continue or close a block comment
+		if h.inComment {
+			end := strings.Index(rest, h.lang.blockComment[1])
+			if end < 0 {
+				sb.WriteString(h.palette.Comment + rest + h.palette.Reset)
+				return sb.String()
+			}
+			end += len(h.lang.blockComment[1])
+			sb.WriteString(h.palette.Comment + rest[:end] + h.palette.Reset)
+			h.inComment = false
+			i += end
+			continue
+		}
+
+		// Block comment start
+		if h.lang.blockComment[0] != "" && strings.HasPrefix(rest, h.lang.blockComment[0]) {
+			h.inComment = true
+			sb.WriteString(h.palette.Comment + h.lang.blockComment[0])
+			sb.WriteString(h.palette.Reset)
+			i += len(h.lang.blockComment[0])
+			continue
+		}
+
+		// Line comment runs to the end of the line
+		isComment := false
+		for _, marker := range h.lang.lineComments {
+			if strings.HasPrefix(rest, marker) {
+				isComment = true
+				break
+			}
+		}
+		if isComment {
+			sb.WriteString(h.palette.Comment + rest + h.palette.Reset)
+			return sb.String()
+		}
+
+		c := line[i]
+		switch {
+		case c == '"' || c == '\'' || c == '`':
+			end := i + 1
+			for end < len(line) && line[end] != c {
+				if line[end] == '\\' {
+					end++
+				}
+				end++
+			}
+			if end < len(line) {
+				end++
+			} else {
+				end = len(line)
+			}
+			sb.WriteString(h.palette.String + line[i:end] + h.palette.Reset)
+			i = end
+		case c >= '0' && c <= '9':
+			end := i
+			for end < len(line) && (isWordByte(line[end]) || line[end] == '.') {
+				end++
+			}
+			sb.WriteString(h.palette.Number + line[i:end] + h.palette.Reset)
+			i = end
+		case isWordByte(c):
+			end := i
+			for end < len(line) && isWordByte(line[end]) {
+				end++
+			}
+			word := line[i:end]
+			switch {
+			case h.lang.keywords[word]:
+				sb.WriteString(h.palette.Keyword + word + h.palette.Reset)
+			case h.lang.types[word]:
+				sb.WriteString(h.palette.Type + word + h.palette.Reset)
+			default:
+				sb.WriteString(h.palette.Code + word + h.palette.Reset)
+			}
+			i = end
+		default:
+			sb.WriteString(h.palette.Code + string(c) + h.palette.Reset)
+			i++
+		}
+	}
+	return sb.String()
+}
+
+// isWordByte reports whether the byte can be part of an identifier
+func isWordByte(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 || unicode.IsLetter(rune(c)) || unicode.IsDigit(rune(c))
+}
@@ -0,0 +1,118 @@
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// LogWriter appends rendered output to a file as plain text, one line at a time
+type LogWriter struct {
+	file   *os.File
+	line   bytes.Buffer
+	escape bool // Inside an ANSI escape sequence
+	csi    bool // Inside a CSI sequence (ESC [ ... final byte)
+	mutex  sync.Mutex
+}
+
+// NewLogWriter opens (or creates) a log file in append mode
+func NewLogWriter(path string) (*LogWriter, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open log file: %v", err)
+	}
+	return &LogWriter{file: file}, nil
+}
+
+// Write strips ANSI codes and writes every completed line to the log file
+func (w *LogWriter) Write(p []byte) (int, error) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for _, b := range p {
+		switch {
+		case w.csi:
+			// CSI sequences end with a byte in the range @ to ~
+			if b >= 0x40 && b <= 0x7e {
+				w.csi = false
+			}
+		case w.escape:
+			w.escape = false
+			if b == '[' {
+				w.csi = true
+			}
+		case b == 0x1b:
+			w.escape = true
+		case b == '\r':
+			// Carriage returns redraw the line (animations), so only the last version is kept
+			w.line.Reset()
+		case b == '\n':
+			w.line.WriteByte('\n')
+			if _, err := w.file.Write(w.line.Bytes()); err != nil {
+				return 0, err
+			}
+			w.line.Reset()
+		default:
+			w.line.WriteByte(b)
+		}
+	}
+	return len(p), nil
+}
+
+// Close writes any partial line and closes the file
+func (w *LogWriter) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.line.Len() > 0 {
+		w.line.WriteByte('\n')
+		w.file.Write(w.line.Bytes())
+		w.line.Reset()
+	}
+	return w.file.Close()
+}
+
+// Tee mirrors everything written to os.Stdout into an extra writer. os.Stdout is a pipe while it
+// runs, so whether output goes to a terminal, and how large it is, are told by Terminal
+type Tee struct {
+	original *os.File
+	pipe     *os.File
+	done     chan struct{}
+}
+
+// StartTee redirects os.Stdout through a pipe that copies output to both the terminal and w
+func StartTee(w io.Writer) (*Tee, error) {
+	reader, writer, err := os.Pipe()
+	if err != nil {
+		return nil, fmt.Errorf("failed to create output pipe: %v", err)
+	}
+
+	tee := &Tee{
+		original: os.Stdout,
+		pipe:     writer,
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(tee.done)
+		io.Copy(io.MultiWriter(tee.original, w), reader)
+		reader.Close()
+	}()
+
+	os.Stdout = writer
+	return tee, nil
+}
+
+// Terminal returns the file output went to before the tee, the terminal when there is one
+func (t *Tee) Terminal() *os.File {
+	return t.original
+}
+
+// Stop restores os.Stdout and waits until all pending output has been copied
+func (t *Tee) Stop() {
+	os.Stdout = t.original
+	t.pipe.Close()
+	<-t.done
+}
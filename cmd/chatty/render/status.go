@@ -0,0 +1,58 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// statusInterval is how often a StatusLine is redrawn at most, so fast streams don't spend
+// their time redrawing it
+const statusInterval = 100 * time.Millisecond
+
+// StatusLine keeps a line of status on the bottom row of a terminal while a response streams
+// above it. The rows above scroll as usual, and Clear gives the bottom row back
+type StatusLine struct {
+	out     io.Writer
+	rows    int
+	columns int
+	color   string
+	reset   string
+	drawn   time.Time
+	cleared bool
+}
+
+// StartStatusLine reserves the bottom row of a terminal of rows by columns for a status line
+// in color, which may be empty. It returns nil when the terminal is too small to spare a row
+func StartStatusLine(out io.Writer, rows, columns int, color, reset string) *StatusLine {
+	if rows < 3 || columns < 10 {
+		return nil
+	}
+	// Move down and back up a row, scrolling if the cursor is at the bottom, so the text
+	// doesn't end up under the status line. Setting the scrolling region moves the cursor, so
+	// it is saved first
+	fmt.Fprintf(out, "\033D\033M\0337\033[1;%dr\0338", rows-1)
+	return &StatusLine{out: out, rows: rows, columns: columns, color: color, reset: reset}
+}
+
+// Update shows text on the status line, cut to the width of the terminal. Updates that come
+// sooner than statusInterval after the last one drawn are skipped
+func (s *StatusLine) Update(text string) {
+	if s == nil || s.cleared || time.Since(s.drawn) < statusInterval {
+		return
+	}
+	s.drawn = time.Now()
+	if runes := []rune(text); len(runes) > s.columns-1 {
+		text = string(runes[:s.columns-1])
+	}
+	fmt.Fprintf(s.out, "\0337\033[%d;1H\033[2K%s%s%s\0338", s.rows, s.color, text, s.reset)
+}
+
+// Clear removes the status line and lets text scroll over the whole terminal again
+func (s *StatusLine) Clear() {
+	if s == nil || s.cleared {
+		return
+	}
+	s.cleared = true
+	fmt.Fprintf(s.out, "\0337\033[r\033[%d;1H\033[2K\0338", s.rows)
+}
@@ -0,0 +1,177 @@
+package render
+
+import (
+	"strings"
+
+	"chatty/cmd/chatty/theme"
+)
+
+// codeFence marks the start and end of a fenced code block
+const codeFence = "```"
+
+// StreamRenderer formats streamed response chunks, highlighting fenced code blocks
+type StreamRenderer struct {
+	textColor   string
+	useColors   bool
+	inCode      bool
+	pending     strings.Builder // Text of the current line not yet printed
+	lineStarted bool            // True once text of the current line has been printed
+	highlighter *Highlighter
+	palette     theme.Theme
+}
+
+// NewStreamRenderer creates a renderer that prints prose with the given text color
+func NewStreamRenderer(textColor string, useColors bool) *StreamRenderer {
+	return &StreamRenderer{
+		textColor: textColor,
+		useColors: useColors,
+		palette:   theme.Current(),
+	}
+}
+
+// Render consumes a streamed chunk and returns the text that is ready to be printed
+func (r *StreamRenderer) Render(chunk string) string {
+	var out strings.Builder
+	for len(chunk) > 0 {
+		newline := strings.IndexByte(chunk, '\n')
+		if newline < 0 {
+			r.pending.WriteString(chunk)
+			out.WriteString(r.drainPartial())
+			break
+		}
+		r.pending.WriteString(chunk[:newline])
+		out.WriteString(r.finishLine())
+		chunk = chunk[newline+1:]
+	}
+	return out.String()
+}
+
+// Flush returns any buffered text once the stream is complete
+func (r *StreamRenderer) Flush() string {
+	if r.pending.Len() == 0 {
+		return ""
+	}
+	line := r.pending.String()
+	r.pending.Reset()
+	if r.inCode || isFence(line) {
+		return r.formatCodeLine(line)
+	}
+	return r.formatText(line)
+}
+
+// drainPartial prints prose as it arrives, holding back lines that may turn out to be code
+func (r *StreamRenderer) drainPartial() string {
+	if r.inCode {
+		return "" // Code is highlighted a full line at a time
+	}
+	text := r.pending.String()
+	if !r.lineStarted {
+		trimmed := strings.TrimLeft(text, " \t")
+		if len(trimmed) < len(codeFence) && strings.HasPrefix(codeFence, trimmed) {
+			return "" // Could still become a fence
+		}
+		if strings.HasPrefix(trimmed, codeFence) {
+			return "" // Wait for the full fence line to learn the language
+		}
+	}
+	r.pending.Reset()
+	r.lineStarted = true
+	return r.formatText(text)
+}
+
+// finishLine handles a completed line of output
+func (r *StreamRenderer) finishLine() string {
+	line := r.pending.String()
+	r.pending.Reset()
+	started := r.lineStarted
+	r.lineStarted = false
+
+	if !started && isFence(line) {
+		if r.inCode {
+			r.inCode = false
+			r.highlighter = nil
+		} else {
+			r.inCode = true
+			lang := strings.TrimSpace(strings.TrimLeft(line, " \t")[len(codeFence):])
+			r.highlighter = NewHighlighter(lang)
+		}
+		return r.colorize(line, r.palette.Fence) + "\n"
+	}
+
+	if r.inCode {
+		return r.formatCodeLine(line) + "\n"
+	}
+	return r.formatText(line) + "\n"
+}
+
+// formatCodeLine highlights a single line inside a code block
+func (r *StreamRenderer) formatCodeLine(line string) string {
+	if !r.useColors {
+		return line
+	}
+	if r.highlighter == nil || isFence(line) {
+		return r.colorize(line, r.palette.Fence)
+	}
+	return r.highlighter.HighlightLine(line)
+}
+
+// formatText colors regular prose
+func (r *StreamRenderer) formatText(text string) string {
+	if text == "" {
+		return ""
+	}
+	return r.colorize(text, r.textColor)
+}
+
+// colorize wraps text in a color when colors are enabled
+func (r *StreamRenderer) colorize(text, color string) string {
+	if !r.useColors {
+		return text
+	}
+	return color + text + r.palette.Reset
+}
+
+// isFence reports whether a line opens or closes a fenced code block
+func isFence(line string) bool {
+	return strings.HasPrefix(strings.TrimLeft(line, " \t"), codeFence)
+}
+
+// CodeBlock is a fenced code block extracted from a message
+type CodeBlock struct {
+	Language string
+	Code     string
+}
+
+// ExtractCodeBlocks returns all fenced code blocks in a message, in order
+func ExtractCodeBlocks(text string) []CodeBlock {
+	var blocks []CodeBlock
+	var current *CodeBlock
+	var body []string
+
+	for _, line := range strings.Split(text, "\n") {
+		if isFence(line) {
+			if current == nil {
+				current = &CodeBlock{
+					Language: strings.TrimSpace(strings.TrimLeft(line, " \t")[len(codeFence):]),
+				}
+				body = nil
+			} else {
+				current.Code = strings.Join(body, "\n")
+				blocks = append(blocks, *current)
+				current = nil
+			}
+			continue
+		}
+		if current != nil {
+			body = append(body, line)
+		}
+	}
+
+	// Keep an unterminated block from a truncated response
+	if current != nil && len(body) > 0 {
+		current.Code = strings.Join(body, "\n")
+		blocks = append(blocks, *current)
+	}
+
+	return blocks
+}
@@ -0,0 +1,186 @@
+// Package scenario loads role-play scenarios: YAML files setting the scene of a group
+// conversation, with a role for each agent, the narration it opens with and the outcomes that
+// end it
+package scenario
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"chatty/cmd/chatty/appdir"
+)
+
+const (
+	scenariosDir = "scenarios" // Where scenarios can be found by name
+	maxSize      = 1 << 20
+)
+
+// Participant is an agent taking part in a scenario
+type Participant struct {
+	Agent string `yaml:"agent"`
+	Role  string `yaml:"role"`
+	Goal  string `yaml:"goal,omitempty"` // What the character wants, kept from the others
+}
+
+// Scenario is a role-play set up in a YAML file
+type Scenario struct {
+	Title         string        `yaml:"title"`
+	Setting       string        `yaml:"setting"`
+	Opening       string        `yaml:"opening"` // Narration the conversation starts with
+	Participants  []Participant `yaml:"participants"`
+	WinConditions []string      `yaml:"win_conditions,omitempty"` // Outcomes that end it, like "the thieves escape"
+	UserRole      string        `yaml:"user_role,omitempty"`      // Who the user plays, when they take part
+	Turns         int           `yaml:"turns,omitempty"`
+	Auto          bool          `yaml:"auto,omitempty"` // The agents play it out among themselves
+}
+
+// Path returns the file of a scenario given as a path, or as the name of a file in
+// ~/.chatty/scenarios with or without its .yaml extension
+func Path(name string) (string, error) {
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	configDir, err := appdir.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(configDir, scenariosDir)
+	for _, candidate := range []string{name, name + ".yaml", name + ".yml"} {
+		path := filepath.Join(dir, candidate)
+		if _, err := os.Stat(path); err == nil && !strings.ContainsAny(name, `/\`) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("scenario '%s' not found, as a file or in %s", name, dir)
+}
+
+// Load reads and checks a scenario file
+func Load(path string) (*Scenario, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %v", err)
+	}
+	if info.Size() > maxSize {
+		return nil, fmt.Errorf("scenario %s is too large", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read scenario: %v", err)
+	}
+	s, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid scenario %s: %v", path, err)
+	}
+	return s, nil
+}
+
+// Parse reads a scenario from YAML, rejecting fields scenarios don't have so a misspelled one
+// isn't silently ignored
+func Parse(data []byte) (*Scenario, error) {
+	var s Scenario
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&s); err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("the file is empty")
+		}
+		message := strings.ReplaceAll(err.Error(), " in type scenario.Scenario", "")
+		message = strings.ReplaceAll(message, " in type scenario.Participant", "")
+		message = strings.TrimPrefix(message, "yaml: ")
+		message = strings.ReplaceAll(message, "unmarshal errors:\n  ", "")
+		return nil, errors.New(message)
+	}
+
+	s.Title = strings.TrimSpace(s.Title)
+	s.Opening = strings.TrimSpace(s.Opening)
+	switch {
+	case s.Title == "":
+		return nil, fmt.Errorf("title is required")
+	case s.Opening == "":
+		return nil, fmt.Errorf("opening is required: the narration the scenario starts with")
+	case len(s.Participants) < 2:
+		return nil, fmt.Errorf("participants must list at least two agents")
+	case s.Turns < 0:
+		return nil, fmt.Errorf("turns can't be negative")
+	case s.Auto && s.UserRole != "":
+		return nil, fmt.Errorf("user_role can't be used with auto, as the user doesn't take part")
+	}
+	for i, p := range s.Participants {
+		if strings.TrimSpace(p.Agent) == "" || strings.TrimSpace(p.Role) == "" {
+			return nil, fmt.Errorf("participant %d needs an agent and a role", i+1)
+		}
+	}
+	return &s, nil
+}
+
+// Agents returns the names of the agents taking part, in order
+func (s *Scenario) Agents() []string {
+	names := make([]string, len(s.Participants))
+	for i, p := range s.Participants {
+		names[i] = strings.TrimSpace(p.Agent)
+	}
+	return names
+}
+
+// Briefing tells the participant at index i who they play, in the scene the scenario sets
+func (s *Scenario) Briefing(i int) string {
+	p := s.Participants[i]
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "This conversation is a role-play scenario: %s.\n", s.Title)
+	if setting := strings.TrimSpace(s.Setting); setting != "" {
+		fmt.Fprintf(&sb, "\nSetting: %s\n", setting)
+	}
+	fmt.Fprintf(&sb, "\nYour role: %s\n", strings.TrimSpace(p.Role))
+	if goal := strings.TrimSpace(p.Goal); goal != "" {
+		fmt.Fprintf(&sb, "Your goal, which the others don't know: %s\n", goal)
+	}
+	sb.WriteString("\nThe other roles:\n")
+	for j, other := range s.Participants {
+		if j != i {
+			fmt.Fprintf(&sb, "- %s plays %s\n", strings.TrimSpace(other.Agent), strings.TrimSpace(other.Role))
+		}
+	}
+	if role := strings.TrimSpace(s.UserRole); role != "" {
+		fmt.Fprintf(&sb, "- The user plays %s\n", role)
+	}
+	if len(s.WinConditions) > 0 {
+		sb.WriteString("\nThe scenario ends as soon as one of these happens:\n")
+		for _, condition := range s.WinConditions {
+			fmt.Fprintf(&sb, "- %s\n", strings.TrimSpace(condition))
+		}
+	}
+	sb.WriteString("\nStay in character: speak and act as your role would, describing your actions briefly, and work toward your goal.")
+	return sb.String()
+}
+
+// JudgeInstructions asks the model whether a transcript has reached one of the win conditions
+func JudgeInstructions(conditions []string) string {
+	var sb strings.Builder
+	sb.WriteString("You judge a role-play scenario. It ends as soon as one of these outcomes has clearly happened in the story:\n")
+	for i, condition := range conditions {
+		fmt.Fprintf(&sb, "%d. %s\n", i+1, strings.TrimSpace(condition))
+	}
+	sb.WriteString("\nRead the transcript and answer with the number of the outcome that has happened, or NONE if none has happened yet. Plans, threats and attempts don't count. Answer with the number or NONE only.")
+	return sb.String()
+}
+
+// ParseOutcome returns the win condition a judge's reply names, if any
+func ParseOutcome(reply string, conditions []string) (string, bool) {
+	fields := strings.Fields(strings.Trim(strings.TrimSpace(reply), ".#*"))
+	if len(fields) == 0 {
+		return "", false
+	}
+	number, err := strconv.Atoi(strings.Trim(fields[0], ".#*:)"))
+	if err != nil || number < 1 || number > len(conditions) {
+		return "", false
+	}
+	return strings.TrimSpace(conditions[number-1]), true
+}
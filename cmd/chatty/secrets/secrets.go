@@ -0,0 +1,138 @@
+// Package secrets keeps API keys and tokens in the system keyring (the macOS Keychain, the
+// Windows Credential Manager or the Secret Service of Linux desktops) rather than in plain text
+// in config.json. Each profile has its own
+package secrets
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/zalando/go-keyring"
+
+	"chatty/cmd/chatty/appdir"
+)
+
+const service = "chatty" // Name the secrets are filed under in the keyring
+
+// Secret is a key or token chatty can keep in the keyring
+type Secret struct {
+	Name        string // Name given to chatty config set-secret
+	Env         string // Variable used instead of the keyring when it is set
+	Description string
+}
+
+// Known are the secrets chatty uses
+var Known = []Secret{
+	{"slack_app_token", "SLACK_APP_TOKEN", "App-level token of the Slack app (xapp-...), for chatty bridge slack"},
+	{"slack_bot_token", "SLACK_BOT_TOKEN", "Bot token of the Slack app (xoxb-...), for chatty bridge slack"},
+	{"matrix_access_token", "MATRIX_ACCESS_TOKEN", "Access token of the bot account, for chatty bridge matrix"},
+	{"discord_bot_token", "DISCORD_BOT_TOKEN", "Token of the Discord bot, for chatty bridge discord"},
+}
+
+// ErrNotFound is returned for secrets that aren't in the keyring
+var ErrNotFound = errors.New("not in the keyring")
+
+// Find returns the secret with the name
+func Find(name string) (Secret, bool) {
+	for _, secret := range Known {
+		if secret.Name == strings.ToLower(name) {
+			return secret, true
+		}
+	}
+	return Secret{}, false
+}
+
+// Names returns the names of the known secrets
+func Names() []string {
+	names := make([]string, len(Known))
+	for i, secret := range Known {
+		names[i] = secret.Name
+	}
+	return names
+}
+
+// Set stores the value of a secret in the keyring, replacing the one it had
+func Set(name, value string) error {
+	secret, err := find(name)
+	if err != nil {
+		return err
+	}
+	if err := keyring.Set(profileService(), secret.Name, value); err != nil {
+		return unavailable(err)
+	}
+	return nil
+}
+
+// Get returns the value of a secret in the keyring, or ErrNotFound
+func Get(name string) (string, error) {
+	secret, err := find(name)
+	if err != nil {
+		return "", err
+	}
+	value, err := keyring.Get(profileService(), secret.Name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", unavailable(err)
+	}
+	return value, nil
+}
+
+// Delete removes a secret from the keyring, or returns ErrNotFound
+func Delete(name string) error {
+	secret, err := find(name)
+	if err != nil {
+		return err
+	}
+	err = keyring.Delete(profileService(), secret.Name)
+	if errors.Is(err, keyring.ErrNotFound) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return unavailable(err)
+	}
+	return nil
+}
+
+// Lookup returns the value of a secret from its variable, or else from the keyring. It is empty
+// when the secret is set in neither
+func Lookup(name string) (string, error) {
+	secret, err := find(name)
+	if err != nil {
+		return "", err
+	}
+	if value := strings.TrimSpace(os.Getenv(secret.Env)); value != "" {
+		return value, nil
+	}
+	value, err := Get(secret.Name)
+	if errors.Is(err, ErrNotFound) {
+		return "", nil
+	}
+	return value, err
+}
+
+// find returns the known secret with the name, or an error listing them
+func find(name string) (Secret, error) {
+	secret, ok := Find(name)
+	if !ok {
+		return Secret{}, fmt.Errorf("unknown secret '%s' (secrets: %s)", name, strings.Join(Names(), ", "))
+	}
+	return secret, nil
+}
+
+// profileService returns the name the secrets of the profile in use are filed under
+func profileService() string {
+	if profile := appdir.Current(); profile != appdir.DefaultProfile {
+		return service + "/" + profile
+	}
+	return service
+}
+
+// unavailable explains a keyring that can't be used, which is common on servers without a
+// desktop session
+func unavailable(err error) error {
+	return fmt.Errorf("the system keyring isn't available: %v", err)
+}
@@ -0,0 +1,184 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"chatty/cmd/chatty/websocket"
+)
+
+const maxSocketTurns = 20 // Rounds a WebSocket client can ask for at once
+
+// GroupMessage is a message of a group chat, from the user when Speaker is empty
+type GroupMessage struct {
+	Speaker string `json:"speaker,omitempty"`
+	Content string `json:"content"`
+}
+
+// Group chat event types
+const (
+	EventTurnStart = "turn_start" // An agent starts answering
+	EventChunk     = "chunk"      // A piece of the answer, in Content
+	EventTurnEnd   = "turn_end"   // The agent finished, with its whole answer in Content
+	EventError     = "error"      // The round stopped, with the reason in Content
+	EventRoundEnd  = "round_end"  // Every round asked for is over and the user can answer (WebSocket only)
+)
+
+// GroupEvent reports the progress of a round of a group chat
+type GroupEvent struct {
+	Type    string `json:"type"`
+	Agent   string `json:"agent,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+// groupRequest is the body of POST /group
+type groupRequest struct {
+	Agents   []string       `json:"agents"`
+	Messages []GroupMessage `json:"messages"`
+}
+
+// handleGroup runs a round of a group chat: every agent answers the conversation so far in turn.
+// The client keeps the transcript, adding the agents' answers and the user's next message to it.
+// Events are streamed as newline-delimited JSON
+func (s *Server) handleGroup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	var req groupRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, bodyStatus(err), err.Error())
+		return
+	}
+	if len(req.Agents) < 2 {
+		writeError(w, http.StatusBadRequest, "at least two agents are required for a group chat")
+		return
+	}
+	if len(req.Messages) == 0 {
+		writeError(w, http.StatusBadRequest, "messages are required")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	started := false
+	err := s.backend.Group(sessionToken(r), req.Agents, req.Messages, func(event GroupEvent) {
+		if event.Type == EventChunk && event.Content == "" {
+			return
+		}
+		started = true
+		encoder.Encode(event)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+	if err != nil {
+		if !started {
+			writeBackendError(w, err)
+			return
+		}
+		encoder.Encode(GroupEvent{Type: EventError, Content: err.Error()})
+	}
+}
+
+// socketRequest is a message from a WebSocket group chat client
+type socketRequest struct {
+	Type    string   `json:"type"`    // start, to begin a chat with Agents, or message
+	Agents  []string `json:"agents"`  // The agents taking part, for start
+	Content string   `json:"content"` // The user's message
+	Turns   int      `json:"turns"`   // Rounds to run, the later ones without the user (default 1)
+}
+
+// handleGroupSocket runs a group chat over a WebSocket. Unlike POST /group, the server keeps the
+// transcript: the client starts with the agents and a message, then sends the user's answers,
+// receiving the events of every round as they happen
+func (s *Server) handleGroupSocket(w http.ResponseWriter, r *http.Request) {
+	conn, err := websocket.Upgrade(w, r, maxRequestBody)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	defer conn.Close()
+	session := sessionToken(r)
+
+	// Keep reading while rounds run, so pings are answered and a closed connection ends the chat
+	incoming := make(chan []byte, 16)
+	go func() {
+		defer close(incoming)
+		for {
+			data, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			incoming <- data
+		}
+	}()
+	closed := false
+	send := func(event GroupEvent) {
+		data, _ := json.Marshal(event)
+		if err := conn.WriteText(data); err != nil {
+			closed = true
+		}
+	}
+
+	var members []string
+	var transcript []GroupMessage
+	for data := range incoming {
+		var req socketRequest
+		if err := json.Unmarshal(data, &req); err != nil {
+			send(GroupEvent{Type: EventError, Content: fmt.Sprintf("invalid message: %v", err)})
+			continue
+		}
+		switch req.Type {
+		case "start":
+			if len(req.Agents) < 2 {
+				send(GroupEvent{Type: EventError, Content: "at least two agents are required for a group chat"})
+				continue
+			}
+			members, transcript = req.Agents, nil
+		case "message":
+			if members == nil {
+				send(GroupEvent{Type: EventError, Content: "send a start message with the agents first"})
+				continue
+			}
+		default:
+			send(GroupEvent{Type: EventError, Content: fmt.Sprintf("unknown message type '%s': use start or message", req.Type)})
+			continue
+		}
+		if strings.TrimSpace(req.Content) == "" {
+			send(GroupEvent{Type: EventError, Content: "content is required"})
+			continue
+		}
+
+		transcript = append(transcript, GroupMessage{Content: req.Content})
+		turns := req.Turns
+		if turns < 1 {
+			turns = 1
+		} else if turns > maxSocketTurns {
+			turns = maxSocketTurns
+		}
+		for turn := 0; turn < turns && !closed; turn++ {
+			err := s.backend.Group(session, members, transcript, func(event GroupEvent) {
+				if event.Type == EventChunk && event.Content == "" {
+					return
+				}
+				if event.Type == EventTurnEnd {
+					transcript = append(transcript, GroupMessage{Speaker: event.Agent, Content: event.Content})
+				}
+				send(event)
+			})
+			if err != nil {
+				send(GroupEvent{Type: EventError, Content: err.Error()})
+				if errors.Is(err, ErrNotFound) {
+					members = nil
+				}
+				break
+			}
+		}
+		send(GroupEvent{Type: EventRoundEnd})
+	}
+}
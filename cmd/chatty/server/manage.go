@@ -0,0 +1,110 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// The agent roster can be managed like with chatty --store, --install, --build and --uninstall.
+// Installed agents are shared by every session
+
+const maxBuildTags = 5 // Tags an agent can have, like in chatty --build
+
+// StoreAgent describes an agent of the community store
+type StoreAgent struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Emoji       string   `json:"emoji"`
+	Tags        []string `json:"tags,omitempty"`
+	Author      string   `json:"author,omitempty"`
+	Installed   bool     `json:"installed"`
+}
+
+// installRequest is the body of POST /agents/install
+type installRequest struct {
+	Name string `json:"name"` // Name or ID of the agent in the store
+}
+
+// buildRequest is the body of POST /agents/build
+type buildRequest struct {
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"` // Default: general
+}
+
+// handleAgentAction installs, builds or uninstalls an agent:
+// POST /agents/install, POST /agents/build and DELETE /agents/{name}
+func (s *Server) handleAgentAction(w http.ResponseWriter, r *http.Request) {
+	action := strings.TrimPrefix(r.URL.Path, "/agents/")
+	if action == "" || strings.Contains(action, "/") {
+		writeError(w, http.StatusNotFound, "use /agents/install, /agents/build or /agents/{name}")
+		return
+	}
+
+	switch {
+	case action == "install" && r.Method == http.MethodPost:
+		var req installRequest
+		if err := readJSON(w, r, &req); err != nil {
+			writeError(w, bodyStatus(err), err.Error())
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			writeError(w, http.StatusBadRequest, "name is required")
+			return
+		}
+		agent, err := s.backend.InstallAgent(strings.TrimSpace(req.Name))
+		if err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, agent)
+	case action == "build" && r.Method == http.MethodPost:
+		var req buildRequest
+		if err := readJSON(w, r, &req); err != nil {
+			writeError(w, bodyStatus(err), err.Error())
+			return
+		}
+		if strings.TrimSpace(req.Description) == "" {
+			writeError(w, http.StatusBadRequest, "description is required")
+			return
+		}
+		if len(req.Tags) > maxBuildTags {
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("an agent can have at most %d tags", maxBuildTags))
+			return
+		}
+		agent, err := s.backend.BuildAgent(req.Description, req.Tags)
+		if err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusCreated, agent)
+	case action == "install" || action == "build":
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+	case r.Method == http.MethodDelete:
+		if err := s.backend.UninstallAgent(action); err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeError(w, http.StatusMethodNotAllowed, "use DELETE to uninstall an agent")
+	}
+}
+
+// handleStore lists the agents of the community store, those matching the q parameter when given
+func (s *Server) handleStore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	agents, err := s.backend.StoreAgents(r.URL.Query().Get("q"))
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	if agents == nil {
+		agents = []StoreAgent{}
+	}
+	writeJSON(w, http.StatusOK, agents)
+}
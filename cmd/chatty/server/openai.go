@@ -0,0 +1,226 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// The OpenAI-compatible endpoints treat each installed agent as a model, so any OpenAI
+// client can chat with an agent by naming it in the model field. Clients send the whole
+// conversation with every request, so agents' chat histories are left untouched
+
+// openAIMessage is a message in OpenAI's chat format. Content is a string, or a list of
+// parts of which the text parts are used
+type openAIMessage struct {
+	Role    string          `json:"role"`
+	Content json.RawMessage `json:"content"`
+}
+
+// text returns the message's content as plain text
+func (m openAIMessage) text() (string, error) {
+	if len(m.Content) == 0 || string(m.Content) == "null" {
+		return "", nil
+	}
+	var s string
+	if err := json.Unmarshal(m.Content, &s); err == nil {
+		return s, nil
+	}
+	var parts []struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	}
+	if err := json.Unmarshal(m.Content, &parts); err != nil {
+		return "", fmt.Errorf("content must be a string or a list of parts")
+	}
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n"), nil
+}
+
+// completionRequest is the body of POST /v1/chat/completions. Sampling options are accepted and ignored
+type completionRequest struct {
+	Model    string          `json:"model"`
+	Messages []openAIMessage `json:"messages"`
+	Stream   bool            `json:"stream"`
+}
+
+type completionChoice struct {
+	Index        int           `json:"index"`
+	Message      *replyMessage `json:"message,omitempty"`
+	Delta        *replyMessage `json:"delta,omitempty"`
+	FinishReason *string       `json:"finish_reason"`
+}
+
+type replyMessage struct {
+	Role    string `json:"role,omitempty"`
+	Content string `json:"content,omitempty"`
+}
+
+type completionResponse struct {
+	ID      string             `json:"id"`
+	Object  string             `json:"object"`
+	Created int64              `json:"created"`
+	Model   string             `json:"model"`
+	Choices []completionChoice `json:"choices"`
+}
+
+// handleCompletions answers an OpenAI chat completion request as the agent named by model,
+// streaming server-sent events when asked to
+func (s *Server) handleCompletions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "use POST", "")
+		return
+	}
+	var req completionRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeOpenAIError(w, bodyStatus(err), err.Error(), "")
+		return
+	}
+	var messages []Message
+	for i, msg := range req.Messages {
+		content, err := msg.text()
+		if err != nil {
+			writeOpenAIError(w, http.StatusBadRequest, fmt.Sprintf("messages[%d]: %v", i, err), "")
+			return
+		}
+		switch msg.Role {
+		case "system", "developer":
+			messages = append(messages, Message{Role: "system", Content: content})
+		case "user", "assistant":
+			messages = append(messages, Message{Role: msg.Role, Content: content})
+		}
+	}
+	if len(messages) == 0 || messages[len(messages)-1].Role != "user" {
+		writeOpenAIError(w, http.StatusBadRequest, "messages must end with a user message", "")
+		return
+	}
+
+	model := s.agentName(req.Model)
+	id := "chatcmpl-" + randomID()
+	created := time.Now().Unix()
+	stop := "stop"
+
+	if !req.Stream {
+		name, response, err := s.backend.Complete(sessionToken(r), model, messages, func(string) {})
+		if err != nil {
+			writeCompletionError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, completionResponse{
+			ID: id, Object: "chat.completion", Created: created, Model: name,
+			Choices: []completionChoice{{Message: &replyMessage{Role: "assistant", Content: response}, FinishReason: &stop}},
+		})
+		return
+	}
+
+	flusher, _ := w.(http.Flusher)
+	started := false
+	send := func(value any) {
+		data, _ := json.Marshal(value)
+		fmt.Fprintf(w, "data: %s\n\n", data)
+		if flusher != nil {
+			flusher.Flush()
+		}
+	}
+	chunk := func(delta replyMessage, finish *string) completionResponse {
+		return completionResponse{
+			ID: id, Object: "chat.completion.chunk", Created: created, Model: model,
+			Choices: []completionChoice{{Delta: &delta, FinishReason: finish}},
+		}
+	}
+	_, _, err := s.backend.Complete(sessionToken(r), model, messages, func(content string) {
+		if content == "" {
+			return
+		}
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			started = true
+			send(chunk(replyMessage{Role: "assistant"}, nil))
+		}
+		send(chunk(replyMessage{Content: content}, nil))
+	})
+	if err != nil {
+		if !started {
+			writeCompletionError(w, err)
+			return
+		}
+		send(map[string]any{"error": map[string]string{"message": err.Error(), "type": "server_error"}})
+		return
+	}
+	if !started {
+		w.Header().Set("Content-Type", "text/event-stream")
+		send(chunk(replyMessage{Role: "assistant"}, nil))
+	}
+	send(chunk(replyMessage{}, &stop))
+	fmt.Fprint(w, "data: [DONE]\n\n")
+}
+
+// agentName resolves a model field to the proper name of an installed agent, the current
+// agent when it is empty
+func (s *Server) agentName(model string) string {
+	for _, agent := range s.backend.Agents() {
+		if model == "" && agent.Current || strings.EqualFold(agent.Name, model) {
+			return agent.Name
+		}
+	}
+	return model
+}
+
+// handleModels lists the installed agents as models
+func (s *Server) handleModels(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeOpenAIError(w, http.StatusMethodNotAllowed, "use GET", "")
+		return
+	}
+	type model struct {
+		ID      string `json:"id"`
+		Object  string `json:"object"`
+		Created int64  `json:"created"`
+		OwnedBy string `json:"owned_by"`
+	}
+	models := []model{}
+	for _, agent := range s.backend.Agents() {
+		models = append(models, model{ID: agent.Name, Object: "model", OwnedBy: "chatty"})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"object": "list", "data": models})
+}
+
+// writeOpenAIError sends an error in OpenAI's format
+func writeOpenAIError(w http.ResponseWriter, status int, message, code string) {
+	kind := "invalid_request_error"
+	if status >= 500 {
+		kind = "server_error"
+	}
+	body := map[string]any{"message": message, "type": kind}
+	if code != "" {
+		body["code"] = code
+	}
+	writeJSON(w, status, map[string]any{"error": body})
+}
+
+// writeCompletionError reports a backend failure, as model_not_found for unknown agents
+func writeCompletionError(w http.ResponseWriter, err error) {
+	if errors.Is(err, ErrNotFound) {
+		writeOpenAIError(w, http.StatusNotFound, err.Error(), "model_not_found")
+		return
+	}
+	writeOpenAIError(w, http.StatusInternalServerError, err.Error(), "")
+}
+
+// randomID returns a random hexadecimal identifier
+func randomID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
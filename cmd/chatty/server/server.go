@@ -0,0 +1,290 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const maxRequestBody = 1 << 20
+
+// Agent describes an installed agent to API clients
+type Agent struct {
+	Name        string   `json:"name"`
+	Description string   `json:"description"`
+	Emoji       string   `json:"emoji"`
+	Tags        []string `json:"tags,omitempty"`
+	Source      string   `json:"source"`
+	Current     bool     `json:"current"`
+}
+
+// Message is one message of a chat history
+type Message struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Backend is the part of chatty the server drives: the installed agents, their histories and chats.
+// Every call but Agents gets the client's session token, empty for requests sent without one,
+// and the backend must keep each session's histories apart. Calls for different sessions may run
+// at the same time
+type Backend interface {
+	Agents() []Agent
+	History(session, agent string) ([]Message, error)
+	// Chat sends a message to an agent, passing the response to onChunk as it streams,
+	// and returns the agent's proper name and the complete response
+	Chat(session, agent, message string, onChunk func(chunk string)) (string, string, error)
+	// Complete answers a conversation supplied by the client as an agent, without touching its
+	// history, and returns the agent's proper name and the response
+	Complete(session, agent string, messages []Message, onChunk func(chunk string)) (string, string, error)
+	// Group has each agent answer a group chat in turn, reporting progress to onEvent
+	Group(session string, agents []string, messages []GroupMessage, onEvent func(event GroupEvent)) error
+
+	// StoreAgents lists the community store's agents matching query, all of them when it is empty
+	StoreAgents(query string) ([]StoreAgent, error)
+	// InstallAgent installs an agent from the store, by name or ID
+	InstallAgent(name string) (Agent, error)
+	// BuildAgent has the model create an agent from a description and installs it
+	BuildAgent(description string, tags []string) (Agent, error)
+	// UninstallAgent removes an agent installed by the user
+	UninstallAgent(name string) error
+}
+
+// Errors a Backend wraps to report why a request failed
+var (
+	ErrNotFound = errors.New("not found")       // Agents that aren't installed or in the store
+	ErrConflict = errors.New("conflict")        // Changes the roster doesn't allow, like installing an agent twice
+	ErrInvalid  = errors.New("invalid request") // Requests the backend can't act on as they are
+)
+
+// Server exposes a Backend over HTTP
+type Server struct {
+	backend        Backend
+	mux            *http.ServeMux
+	requireSession bool
+	hosts          []string // Names besides localhost the server is reached by, from AllowHost
+}
+
+// New creates a server for a backend
+func New(backend Backend) *Server {
+	s := &Server{backend: backend, mux: http.NewServeMux()}
+	s.mux.HandleFunc("/sessions", s.handleSessions)
+	s.mux.HandleFunc("/chat", s.handleChat)
+	s.mux.HandleFunc("/agents", s.handleAgents)
+	s.mux.HandleFunc("/agents/", s.handleAgentAction)
+	s.mux.HandleFunc("/store", s.handleStore)
+	s.mux.HandleFunc("/history/", s.handleHistory)
+	s.mux.HandleFunc("/group", s.handleGroup)
+	s.mux.HandleFunc("/group/ws", s.handleGroupSocket)
+	s.mux.HandleFunc("/v1/chat/completions", s.handleCompletions)
+	s.mux.HandleFunc("/v1/models", s.handleModels)
+	return s
+}
+
+// ServeHTTP routes a request to its endpoint, once its origin and session token are checked
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.checkOrigin(w, r) || !s.checkSession(w, r) {
+		return
+	}
+	s.mux.ServeHTTP(w, r)
+}
+
+// AllowHost lets requests reach the server by a host name other than localhost, such as the
+// name given to --host. Addresses like 127.0.0.1 are always allowed
+func (s *Server) AllowHost(name string) {
+	s.hosts = append(s.hosts, name)
+}
+
+// checkOrigin refuses requests that web pages could send from another site. Browsers send an
+// Origin with them, which must be this server, and DNS rebinding sends them to a host name of
+// the attacker's, which must be localhost, an address or a name allowed with AllowHost
+func (s *Server) checkOrigin(w http.ResponseWriter, r *http.Request) bool {
+	host := r.Host
+	if name, _, err := net.SplitHostPort(host); err == nil {
+		host = name
+	}
+	host = strings.Trim(host, "[]")
+	allowed := net.ParseIP(host) != nil || strings.EqualFold(host, "localhost")
+	for _, name := range s.hosts {
+		allowed = allowed || strings.EqualFold(host, name)
+	}
+	if !allowed {
+		writeError(w, http.StatusForbidden, fmt.Sprintf("host %s is not allowed", r.Host))
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		if u, err := url.Parse(origin); err != nil || !strings.EqualFold(u.Host, r.Host) {
+			writeError(w, http.StatusForbidden, fmt.Sprintf("origin %s is not allowed", origin))
+			return false
+		}
+	}
+	return true
+}
+
+// errNotJSON is returned for request bodies sent as anything but JSON, which web pages can send
+// to any site without asking it first
+var errNotJSON = errors.New("send the body as application/json")
+
+// readJSON decodes a JSON request body into value
+func readJSON(w http.ResponseWriter, r *http.Request, value any) error {
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType != "application/json" {
+		return errNotJSON
+	}
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxRequestBody)).Decode(value); err != nil {
+		return fmt.Errorf("invalid request: %v", err)
+	}
+	return nil
+}
+
+// bodyStatus returns the status of a response to a body readJSON rejected
+func bodyStatus(err error) int {
+	if errors.Is(err, errNotJSON) {
+		return http.StatusUnsupportedMediaType
+	}
+	return http.StatusBadRequest
+}
+
+// ListenAndServe serves the API on addr until it fails
+func (s *Server) ListenAndServe(addr string) error {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           s,
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	return server.ListenAndServe()
+}
+
+// chatRequest is the body of POST /chat
+type chatRequest struct {
+	Agent   string `json:"agent"` // Default: the current agent
+	Message string `json:"message"`
+	Stream  bool   `json:"stream"`
+}
+
+// chatResponse is the reply to POST /chat, or the last line of a streamed reply
+type chatResponse struct {
+	Agent    string `json:"agent"`
+	Response string `json:"response"`
+	Done     bool   `json:"done"`
+}
+
+// chatChunk is a line of a streamed reply
+type chatChunk struct {
+	Content string `json:"content"`
+	Done    bool   `json:"done"`
+}
+
+// handleChat sends a message to an agent. Streamed replies are newline-delimited JSON: chunks
+// of the response followed by the complete response, or an error
+func (s *Server) handleChat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	var req chatRequest
+	if err := readJSON(w, r, &req); err != nil {
+		writeError(w, bodyStatus(err), err.Error())
+		return
+	}
+	if strings.TrimSpace(req.Message) == "" {
+		writeError(w, http.StatusBadRequest, "message is required")
+		return
+	}
+
+	if !req.Stream {
+		name, response, err := s.backend.Chat(sessionToken(r), req.Agent, req.Message, func(string) {})
+		if err != nil {
+			writeBackendError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, chatResponse{Agent: name, Response: response, Done: true})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	encoder := json.NewEncoder(w)
+	started := false
+	name, response, err := s.backend.Chat(sessionToken(r), req.Agent, req.Message, func(chunk string) {
+		if chunk == "" {
+			return
+		}
+		started = true
+		encoder.Encode(chatChunk{Content: chunk})
+		if flusher != nil {
+			flusher.Flush()
+		}
+	})
+	if err != nil {
+		if !started {
+			writeBackendError(w, err)
+			return
+		}
+		encoder.Encode(map[string]string{"error": err.Error()})
+		return
+	}
+	encoder.Encode(chatResponse{Agent: name, Response: response, Done: true})
+}
+
+// handleAgents lists the installed agents
+func (s *Server) handleAgents(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	writeJSON(w, http.StatusOK, s.backend.Agents())
+}
+
+// handleHistory returns the chat history of the agent named in the path
+func (s *Server) handleHistory(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "use GET")
+		return
+	}
+	agent := strings.TrimPrefix(r.URL.Path, "/history/")
+	if agent == "" || strings.Contains(agent, "/") {
+		writeError(w, http.StatusNotFound, "use /history/{agent}")
+		return
+	}
+	messages, err := s.backend.History(sessionToken(r), agent)
+	if err != nil {
+		writeBackendError(w, err)
+		return
+	}
+	if messages == nil {
+		messages = []Message{}
+	}
+	writeJSON(w, http.StatusOK, messages)
+}
+
+// writeJSON sends a value as a JSON response
+func writeJSON(w http.ResponseWriter, status int, value any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(value)
+}
+
+// writeError sends an error message as a JSON response
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
+
+// writeBackendError reports a backend failure with the status matching its cause
+func writeBackendError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrConflict):
+		status = http.StatusConflict
+	case errors.Is(err, ErrInvalid):
+		status = http.StatusUnprocessableEntity
+	}
+	writeError(w, status, err.Error())
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strings"
+)
+
+// Sessions let several people share one server: each client sends its own token, and the
+// backend keeps a separate chat history per token. Requests without a token use the histories
+// of the person running chatty, unless the server requires a session
+
+const maxTokenLength = 128
+
+// SessionHeader carries the session token for clients that can't set an Authorization header
+const SessionHeader = "X-Chatty-Session"
+
+// sessionToken returns the token a request was sent with: a bearer token, the X-Chatty-Session
+// header, or the session query parameter, which is the only option browsers have for WebSockets
+func sessionToken(r *http.Request) string {
+	token := ""
+	if auth := r.Header.Get("Authorization"); len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		token = auth[7:]
+	} else if header := r.Header.Get(SessionHeader); header != "" {
+		token = header
+	} else {
+		token = r.URL.Query().Get("session")
+	}
+	return strings.TrimSpace(token)
+}
+
+// RequireSession rejects API requests that don't carry a session token
+func (s *Server) RequireSession() {
+	s.requireSession = true
+}
+
+// checkSession reports whether a request may go on, answering it when it may not
+func (s *Server) checkSession(w http.ResponseWriter, r *http.Request) bool {
+	token := sessionToken(r)
+	if len(token) > maxTokenLength {
+		writeError(w, http.StatusBadRequest, "session token is too long")
+		return false
+	}
+	if token == "" && s.requireSession && r.URL.Path != "/" && r.URL.Path != "/sessions" {
+		const message = "a session token is required: create one with POST /sessions"
+		if strings.HasPrefix(r.URL.Path, "/v1/") {
+			writeOpenAIError(w, http.StatusUnauthorized, message, "invalid_api_key")
+		} else {
+			writeError(w, http.StatusUnauthorized, message)
+		}
+		return false
+	}
+	return true
+}
+
+// handleSessions creates a session, returning the token to send with later requests
+func (s *Server) handleSessions(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "use POST")
+		return
+	}
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to create a session")
+		return
+	}
+	writeJSON(w, http.StatusCreated, map[string]string{"token": hex.EncodeToString(b)})
+}
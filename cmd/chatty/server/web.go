@@ -0,0 +1,23 @@
+package server
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// webPage is the browser chat, a single page using the JSON endpoints
+//
+//go:embed web/index.html
+var webPage []byte
+
+// EnableWeb serves the browser chat at the root of the server
+func (s *Server) EnableWeb() {
+	s.mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write(webPage)
+	})
+}
@@ -14,6 +14,8 @@ import (
 	"gopkg.in/yaml.v3"
 
 	"chatty/cmd/chatty/agents"
+	"chatty/cmd/chatty/appdir"
+	"chatty/cmd/chatty/theme"
 )
 
 // Handler manages agent sharing operations
@@ -48,16 +50,17 @@ type orderedAgentFields struct {
 // ShareAgent handles the agent sharing process
 func (h *Handler) ShareAgent(agentName string) error {
 	// Define colors for output
-	colorMagenta := "\033[1;35m"
-	colorCyan := "\033[1;36m"
-	colorGreen := "\033[32m"
-	colorYellow := "\033[1;33m"
-	colorRed := "\033[1;31m"
-	colorBlue := "\033[1;34m"
-	colorReset := "\033[0m"
+	palette := theme.Current()
+	colorHeading := palette.Heading
+	colorSection := palette.Section
+	colorSuccess := palette.Success
+	colorEmphasis := palette.Emphasis
+	colorError := palette.Error
+	colorValue := palette.Value
+	colorReset := palette.Reset
 
 	fmt.Printf("\n%s📝 Preparing to share %s with the community...%s\n\n",
-		colorMagenta, agentName, colorReset)
+		colorHeading, agentName, colorReset)
 
 	// Start validation animation
 	anim := NewShareAnimation("Validating agent configuration...")
@@ -65,7 +68,7 @@ func (h *Handler) ShareAgent(agentName string) error {
 
 	// Get agent configuration
 	agent := agents.GetAgentConfig(agentName)
-	if agent.Name == agents.DefaultAgent.Name {
+	if agent.Name == agents.GetDefaultAgent().Name {
 		anim.Stop()
 		return fmt.Errorf("agent '%s' not found", agentName)
 	}
@@ -75,7 +78,7 @@ func (h *Handler) ShareAgent(agentName string) error {
 	anim.Stop()
 
 	// Print validation results
-	fmt.Printf("%s1. Validating agent configuration...%s\n", colorCyan, colorReset)
+	fmt.Printf("%s1. Validating agent configuration...%s\n", colorSection, colorReset)
 	
 	// Check if we have a name conflict error
 	nameConflict := false
@@ -88,9 +91,9 @@ func (h *Handler) ShareAgent(agentName string) error {
 	
 	// Handle name conflict by allowing user to rename
 	if nameConflict {
-		fmt.Printf("\n%s⚠️ Name Conflict Detected%s\n", colorYellow, colorReset)
+		fmt.Printf("\n%s⚠️ Name Conflict Detected%s\n", colorEmphasis, colorReset)
 		fmt.Printf("An agent with the name '%s%s%s' already exists in the community store.\n", 
-			colorCyan, agent.Name, colorReset)
+			colorSection, agent.Name, colorReset)
 		fmt.Printf("You must rename your agent to proceed with sharing.\n\n")
 		
 		// Prompt for a new name
@@ -98,19 +101,19 @@ func (h *Handler) ShareAgent(agentName string) error {
 		originalName := agent.Name
 		
 		for {
-			fmt.Printf("%sEnter a new name for your agent:%s ", colorYellow, colorReset)
+			fmt.Printf("%sEnter a new name for your agent:%s ", colorEmphasis, colorReset)
 			newName, _ := reader.ReadString('\n')
 			newName = strings.TrimSpace(newName)
 			
 			if newName == "" {
-				fmt.Printf("%s❌ Name cannot be empty. Please try again.%s\n", colorRed, colorReset)
+				fmt.Printf("%s❌ Name cannot be empty. Please try again.%s\n", colorError, colorReset)
 				continue
 			}
 			
 			// Check if the new name is valid format
 			isValid, errorMsg := h.validator.isValidAgentName(newName)
 			if !isValid {
-				fmt.Printf("%s❌ %s%s\n\n", colorRed, errorMsg, colorReset)
+				fmt.Printf("%s❌ %s%s\n\n", colorError, errorMsg, colorReset)
 				continue
 			}
 			
@@ -118,23 +121,23 @@ func (h *Handler) ShareAgent(agentName string) error {
 			exists, err := h.validator.CheckStoreForDuplicateName(newName)
 			if err != nil {
 				fmt.Printf("%s⚠️ Warning: Could not check for duplicate names: %v%s\n", 
-					colorYellow, err, colorReset)
+					colorEmphasis, err, colorReset)
 			} else if exists {
 				fmt.Printf("%s❌ The name '%s' also exists in the store. Please choose another name.%s\n\n", 
-					colorRed, newName, colorReset)
+					colorError, newName, colorReset)
 				continue
 			}
 			
 			// Update the agent name
 			agent.Name = newName
-			fmt.Printf("\n%s✓ Agent renamed to '%s'%s\n\n", colorGreen, newName, colorReset)
+			fmt.Printf("\n%s✓ Agent renamed to '%s'%s\n\n", colorSuccess, newName, colorReset)
 			
 			// Re-validate the agent with the new name
 			result = h.validator.ValidateAgent(agent)
 			
 			// If it's now valid, proceed; otherwise, show other errors
 			if !result.IsValid {
-				fmt.Printf("%s❌ Validation failed with other issues:%s\n", colorRed, colorReset)
+				fmt.Printf("%s❌ Validation failed with other issues:%s\n", colorError, colorReset)
 				for _, err := range result.Errors {
 					if !strings.Contains(err, "already exists in the store") {
 						fmt.Printf("   - %s\n", err)
@@ -145,7 +148,7 @@ func (h *Handler) ShareAgent(agentName string) error {
 			
 			// Prompt to save the agent locally with the new name
 			fmt.Printf("%sWould you like to save the agent locally with the new name? [Y/n]:%s ", 
-				colorCyan, colorReset)
+				colorSection, colorReset)
 			saveResponse, _ := reader.ReadString('\n')
 			saveResponse = strings.ToLower(strings.TrimSpace(saveResponse))
 			
@@ -153,16 +156,16 @@ func (h *Handler) ShareAgent(agentName string) error {
 			if saveResponse != "n" && saveResponse != "no" {
 				if err := h.saveRenamedAgent(agent, originalName); err != nil {
 					fmt.Printf("%s⚠️ Warning: Could not save renamed agent locally: %v%s\n", 
-						colorYellow, err, colorReset)
+						colorEmphasis, err, colorReset)
 				} else {
-					fmt.Printf("%s✓ Agent saved locally with the new name%s\n\n", colorGreen, colorReset)
+					fmt.Printf("%s✓ Agent saved locally with the new name%s\n\n", colorSuccess, colorReset)
 				}
 			}
 			
 			break
 		}
 	} else if !result.IsValid {
-		fmt.Printf("\n%s❌ Validation failed:%s\n", colorRed, colorReset)
+		fmt.Printf("\n%s❌ Validation failed:%s\n", colorError, colorReset)
 		for _, err := range result.Errors {
 			fmt.Printf("   - %s\n", err)
 		}
@@ -177,10 +180,10 @@ func (h *Handler) ShareAgent(agentName string) error {
 		}
 		
 		if tagError {
-			fmt.Printf("\n%s📌 Tag Requirements:%s\n", colorYellow, colorReset)
+			fmt.Printf("\n%s📌 Tag Requirements:%s\n", colorEmphasis, colorReset)
 			fmt.Printf("   - Each agent must have 1-5 tags\n")
 			fmt.Printf("   - Tags can be added through the 'Edit tags' option in the agent editor\n")
-			fmt.Printf("   - Run '%schatty --build%s' to create or edit an agent with tags\n\n", colorBlue, colorReset)
+			fmt.Printf("   - Run '%schatty --build%s' to create or edit an agent with tags\n\n", colorValue, colorReset)
 		}
 		
 		fmt.Println("\nPlease fix these issues and try again.")
@@ -189,7 +192,7 @@ func (h *Handler) ShareAgent(agentName string) error {
 
 	// If there were warnings but validation passed
 	if len(result.Warnings) > 0 && result.IsValid {
-		fmt.Printf("\n%s⚠️  Warnings:%s\n", colorYellow, colorReset)
+		fmt.Printf("\n%s⚠️  Warnings:%s\n", colorEmphasis, colorReset)
 		for _, warning := range result.Warnings {
 			fmt.Printf("   - %s\n", warning)
 		}
@@ -197,29 +200,29 @@ func (h *Handler) ShareAgent(agentName string) error {
 
 	// If validation is successful
 	if result.IsValid {
-		fmt.Printf("   %s✓%s Required fields present\n", colorGreen, colorReset)
-		fmt.Printf("   %s✓%s Format valid\n", colorGreen, colorReset)
-		fmt.Printf("   %s✓%s Security checks passed\n", colorGreen, colorReset)
-		fmt.Printf("   %s✓%s Tags valid (%d tags)\n\n", colorGreen, colorReset, len(agent.Tags))
+		fmt.Printf("   %s✓%s Required fields present\n", colorSuccess, colorReset)
+		fmt.Printf("   %s✓%s Format valid\n", colorSuccess, colorReset)
+		fmt.Printf("   %s✓%s Security checks passed\n", colorSuccess, colorReset)
+		fmt.Printf("   %s✓%s Tags valid (%d tags)\n\n", colorSuccess, colorReset, len(agent.Tags))
 
 		// Show tags in validation success
 		if len(agent.Tags) > 0 {
-			fmt.Printf("   %sTags:%s ", colorCyan, colorReset)
+			fmt.Printf("   %sTags:%s ", colorSection, colorReset)
 			for i, tag := range agent.Tags {
 				if i > 0 {
 					fmt.Print(", ")
 				}
-				fmt.Printf("%s%s%s", colorBlue, tag, colorReset)
+				fmt.Printf("%s%s%s", colorValue, tag, colorReset)
 			}
-			fmt.Println("\n")
+			fmt.Print("\n\n")
 		}
 	}
 
 	// Collect author information
-	fmt.Printf("%s2. Author Information%s\n", colorCyan, colorReset)
+	fmt.Printf("%s2. Author Information%s\n", colorSection, colorReset)
 	fmt.Printf("   Please provide your name as you want it to appear in the agent's metadata.\n")
 	fmt.Printf("   This will help the community know who created this agent.\n\n")
-	fmt.Printf("%s❓ Author name:%s ", colorCyan, colorReset)
+	fmt.Printf("%s❓ Author name:%s ", colorSection, colorReset)
 	
 	reader := bufio.NewReader(os.Stdin)
 	authorName, err := reader.ReadString('\n')
@@ -234,16 +237,16 @@ func (h *Handler) ShareAgent(agentName string) error {
 
 	// Show forking instructions
 	originalRepoURL := h.config.BaseURL
-	fmt.Printf("\n%s3. Repository Setup Required%s\n", colorCyan, colorReset)
-	fmt.Printf("   Please fork this repository: %s%s%s\n\n", colorBlue, originalRepoURL, colorReset)
+	fmt.Printf("\n%s3. Repository Setup Required%s\n", colorSection, colorReset)
+	fmt.Printf("   Please fork this repository: %s%s%s\n\n", colorValue, originalRepoURL, colorReset)
 	
-	fmt.Printf("%s📌 Follow these steps:%s\n", colorYellow, colorReset)
+	fmt.Printf("%s📌 Follow these steps:%s\n", colorEmphasis, colorReset)
 	fmt.Printf("   1. Visit the repository URL above\n")
 	fmt.Printf("   2. Click the 'Fork' button in the top-right\n")
 	fmt.Printf("   3. Wait for GitHub to complete the fork\n\n")
 
 	// Ask for confirmation
-	fmt.Printf("%s❓ Have you forked the repository? [y/N]:%s ", colorCyan, colorReset)
+	fmt.Printf("%s❓ Have you forked the repository? [y/N]:%s ", colorSection, colorReset)
 	var response string
 	fmt.Scanln(&response)
 	response = strings.ToLower(strings.TrimSpace(response))
@@ -252,7 +255,7 @@ func (h *Handler) ShareAgent(agentName string) error {
 	}
 
 	// Ask for forked repository URL
-	fmt.Printf("\n%s4. Enter your forked repository URL:%s\n", colorCyan, colorReset)
+	fmt.Printf("\n%s4. Enter your forked repository URL:%s\n", colorSection, colorReset)
 	fmt.Printf("   (Example: https://github.com/your-username/chatty-ai-community-store)\n")
 	fmt.Printf("   URL: ")
 	
@@ -306,14 +309,14 @@ func (h *Handler) ShareAgent(agentName string) error {
 		url.QueryEscape(branchName))
 
 	// Open browser with the new file URL
-	fmt.Printf("\n%s5. Creating agent file...%s\n", colorCyan, colorReset)
+	fmt.Printf("\n%s5. Creating agent file...%s\n", colorSection, colorReset)
 	if err := h.openBrowser(newFileURL); err != nil {
 		fmt.Printf("\n%s⚠️  Could not open browser automatically. Please open this URL manually:%s\n%s\n",
-			colorYellow, colorReset, newFileURL)
+			colorEmphasis, colorReset, newFileURL)
 	}
 
 	// Show final instructions
-	fmt.Printf("\n%s6. Final Instructions%s\n", colorCyan, colorReset)
+	fmt.Printf("\n%s6. Final Instructions%s\n", colorSection, colorReset)
 	fmt.Printf("   - Please wait for the repository maintainers to review your submission.\n")
 	fmt.Printf("   - Once approved, your agent will be added to the community store.\n")
 	fmt.Printf("   - Thank you for contributing to the community!\n\n")
@@ -342,13 +345,13 @@ func (h *Handler) openBrowser(url string) error {
 // saveRenamedAgent saves the agent with its new name to the user's agents directory
 func (h *Handler) saveRenamedAgent(agent agents.AgentConfig, originalName string) error {
 	// Get the home directory
-	homeDir, err := os.UserHomeDir()
+	configDir, err := appdir.ConfigDir()
 	if err != nil {
-		return fmt.Errorf("failed to get home directory: %v", err)
+		return err
 	}
 	
 	// Build the path to the agents directory
-	agentsDir := filepath.Join(homeDir, ".chatty", "agents")
+	agentsDir := filepath.Join(configDir, "agents")
 	
 	// Create the new filename
 	newFilename := fmt.Sprintf("%s.yaml", strings.ToLower(strings.ReplaceAll(agent.Name, " ", "_")))
@@ -208,4 +208,18 @@ func (v *Validator) isValidAgentName(name string) (bool, string) {
 	}
 	
 	return true, ""
-} 
\ No newline at end of file
+}
+
+// ValidateLocal checks an agent kept on this machine, like one edited with chatty --edit: its
+// required fields and content, without the store checks that only matter when sharing it
+func (v *Validator) ValidateLocal(agent agents.AgentConfig) ValidationResult {
+	result := ValidationResult{
+		IsValid:  true,
+		Errors:   make([]string, 0),
+		Warnings: make([]string, 0),
+	}
+	v.validateRequiredFields(agent, &result)
+	v.validateContent(agent, &result)
+	result.IsValid = len(result.Errors) == 0
+	return result
+}
@@ -0,0 +1,144 @@
+package speech
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// blankAudioPattern matches whisper's non-speech markers such as [BLANK_AUDIO]
+var blankAudioPattern = regexp.MustCompile(`\[[A-Z_ ]+\]`)
+
+// whisperCommands are the names the whisper.cpp command line tool is installed under
+var whisperCommands = []string{"whisper-cli", "whisper-cpp"}
+
+// Listener records speech from the microphone and transcribes it locally
+type Listener struct {
+	recorder []string // Recording command, the output file is appended
+	command  string   // Custom transcription command with a {file} placeholder
+	whisper  string   // whisper.cpp executable, used when no custom command is set
+	model    string   // whisper.cpp model path
+}
+
+// NewListener sets up recording and transcription. A custom command takes precedence over whisper.cpp
+func NewListener(command, model string) (*Listener, error) {
+	recorder, err := findRecorder()
+	if err != nil {
+		return nil, err
+	}
+
+	l := &Listener{recorder: recorder, command: command, model: model}
+	if command != "" {
+		if !strings.Contains(command, "{file}") {
+			return nil, fmt.Errorf("stt_command must contain a {file} placeholder for the recorded audio")
+		}
+		return l, nil
+	}
+
+	for _, name := range whisperCommands {
+		if path, err := exec.LookPath(name); err == nil {
+			l.whisper = path
+			break
+		}
+	}
+	if l.whisper == "" {
+		return nil, fmt.Errorf("no transcriber found: install whisper.cpp (whisper-cli) or set stt_command in config.json")
+	}
+	if model == "" {
+		return nil, fmt.Errorf("whisper.cpp needs a model: set stt_model in config.json to a ggml model path")
+	}
+	return l, nil
+}
+
+// findRecorder returns the command used to record 16 kHz mono WAV audio
+func findRecorder() ([]string, error) {
+	recorders := [][]string{
+		{"arecord", "-q", "-f", "S16_LE", "-r", "16000", "-c", "1", "-t", "wav"},
+		{"rec", "-q", "-r", "16000", "-c", "1", "-b", "16"},
+	}
+	if runtime.GOOS == "darwin" {
+		recorders = append(recorders, []string{"ffmpeg", "-loglevel", "quiet", "-y", "-f", "avfoundation", "-i", ":0", "-ar", "16000", "-ac", "1"})
+	} else {
+		recorders = append(recorders, []string{"ffmpeg", "-loglevel", "quiet", "-y", "-f", "pulse", "-i", "default", "-ar", "16000", "-ac", "1"})
+	}
+
+	for _, recorder := range recorders {
+		if _, err := exec.LookPath(recorder[0]); err == nil {
+			return recorder, nil
+		}
+	}
+	return nil, fmt.Errorf("no audio recorder found (install alsa-utils, sox or ffmpeg)")
+}
+
+// Listen records until waitForStop returns, then transcribes the recording
+func (l *Listener) Listen(waitForStop func()) (string, error) {
+	dir, err := os.MkdirTemp("", "chatty-listen")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wavPath := filepath.Join(dir, "input.wav")
+	cmd := exec.Command(l.recorder[0], append(l.recorder[1:], wavPath)...)
+	if err := cmd.Start(); err != nil {
+		return "", fmt.Errorf("failed to start recording: %v", err)
+	}
+
+	waitForStop()
+
+	// Recorders finalize the WAV header when interrupted
+	if err := cmd.Process.Signal(os.Interrupt); err != nil {
+		cmd.Process.Kill()
+	}
+	done := make(chan struct{})
+	go func() {
+		cmd.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(3 * time.Second):
+		cmd.Process.Kill()
+		<-done
+	}
+
+	if info, err := os.Stat(wavPath); err != nil || info.Size() == 0 {
+		return "", fmt.Errorf("no audio was recorded")
+	}
+	return l.Transcribe(wavPath)
+}
+
+// Transcribe converts a WAV file to text
+func (l *Listener) Transcribe(wavPath string) (string, error) {
+	var cmd *exec.Cmd
+	if l.command != "" {
+		command := strings.ReplaceAll(l.command, "{file}", shellQuote(wavPath))
+		if runtime.GOOS == "windows" {
+			cmd = exec.Command("cmd", "/C", command)
+		} else {
+			cmd = exec.Command("sh", "-c", command)
+		}
+	} else {
+		cmd = exec.Command(l.whisper, "-m", l.model, "-f", wavPath, "-nt", "-np")
+	}
+
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("transcription failed: %v", err)
+	}
+	text := blankAudioPattern.ReplaceAllString(string(output), " ")
+	return strings.Join(strings.Fields(text), " "), nil
+}
+
+// shellQuote quotes a path for use in a shell command
+func shellQuote(path string) string {
+	if runtime.GOOS == "windows" {
+		return `"` + path + `"`
+	}
+	return "'" + strings.ReplaceAll(path, "'", `'\''`) + "'"
+}
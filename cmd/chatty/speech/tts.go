@@ -0,0 +1,208 @@
+package speech
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+)
+
+// Supported text-to-speech engines
+const (
+	EngineEspeak = "espeak"
+	EngineSay    = "say"
+	EnginePiper  = "piper"
+)
+
+// Engines lists the supported engines in order of preference for auto-detection
+var Engines = []string{EngineSay, EnginePiper, EngineEspeak}
+
+// Speaker reads text aloud with a text-to-speech engine
+type Speaker struct {
+	engine       string
+	command      string // Resolved executable
+	defaultVoice string // Used when an agent has no voice of its own
+}
+
+// NewSpeaker creates a speaker for the given engine, or detects an installed one when engine is empty
+func NewSpeaker(engine, defaultVoice string) (*Speaker, error) {
+	candidates := Engines
+	if engine != "" {
+		candidates = []string{strings.ToLower(engine)}
+	}
+
+	for _, name := range candidates {
+		command, err := findEngine(name)
+		if err != nil {
+			if engine != "" {
+				return nil, err
+			}
+			continue
+		}
+		// Piper cannot speak without a voice model, so only pick it automatically when one is configured
+		if engine == "" && name == EnginePiper && defaultVoice == "" {
+			continue
+		}
+		return &Speaker{engine: name, command: command, defaultVoice: defaultVoice}, nil
+	}
+
+	return nil, fmt.Errorf("no text-to-speech engine found (install espeak-ng, or piper on Linux; macOS includes say)")
+}
+
+// findEngine resolves the executable of an engine
+func findEngine(name string) (string, error) {
+	var commands []string
+	switch name {
+	case EngineEspeak:
+		commands = []string{"espeak-ng", "espeak"}
+	case EngineSay:
+		if runtime.GOOS != "darwin" {
+			return "", fmt.Errorf("the say engine is only available on macOS")
+		}
+		commands = []string{"say"}
+	case EnginePiper:
+		commands = []string{"piper"}
+	default:
+		return "", fmt.Errorf("unknown text-to-speech engine '%s' (available: %s)", name, strings.Join(Engines, ", "))
+	}
+
+	for _, command := range commands {
+		if path, err := exec.LookPath(command); err == nil {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("text-to-speech engine '%s' is not installed", name)
+}
+
+// Engine returns the name of the engine in use
+func (s *Speaker) Engine() string {
+	return s.engine
+}
+
+// Speak reads text aloud with the given voice and waits until it finishes
+func (s *Speaker) Speak(text, voice string) error {
+	text = CleanText(text)
+	if text == "" {
+		return nil
+	}
+	if voice == "" {
+		voice = s.defaultVoice
+	}
+
+	switch s.engine {
+	case EnginePiper:
+		return s.speakPiper(text, voice)
+	case EngineSay:
+		args := []string{"-f", "-"}
+		if voice != "" {
+			args = append(args, "-v", voice)
+		}
+		return s.run(text, args...)
+	default:
+		args := []string{"--stdin"}
+		if voice != "" {
+			args = append(args, "-v", voice)
+		}
+		return s.run(text, args...)
+	}
+}
+
+// Synthesize renders text to a WAV file with the given voice instead of playing it
+func (s *Speaker) Synthesize(text, voice, path string) error {
+	text = CleanText(text)
+	if text == "" {
+		text = "..."
+	}
+	if voice == "" {
+		voice = s.defaultVoice
+	}
+
+	switch s.engine {
+	case EnginePiper:
+		if voice == "" {
+			return fmt.Errorf("piper needs a voice model: set 'voice' to the path of a .onnx model")
+		}
+		return s.run(text, "--model", voice, "--output_file", path)
+	case EngineSay:
+		args := []string{"-f", "-", "-o", path, "--file-format=WAVE", "--data-format=LEI16@22050"}
+		if voice != "" {
+			args = append(args, "-v", voice)
+		}
+		return s.run(text, args...)
+	default:
+		args := []string{"--stdin", "-w", path}
+		if voice != "" {
+			args = append(args, "-v", voice)
+		}
+		return s.run(text, args...)
+	}
+}
+
+// speakPiper renders speech to a temporary WAV file with piper and plays it
+func (s *Speaker) speakPiper(text, voice string) error {
+	if voice == "" {
+		return fmt.Errorf("piper needs a voice model: set 'voice' to the path of a .onnx model")
+	}
+
+	dir, err := os.MkdirTemp("", "chatty-speech")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+
+	wavPath := filepath.Join(dir, "speech.wav")
+	if err := s.run(text, "--model", voice, "--output_file", wavPath); err != nil {
+		return err
+	}
+	return PlayFile(wavPath)
+}
+
+// run executes the engine with text on stdin
+func (s *Speaker) run(text string, args ...string) error {
+	cmd := exec.Command(s.command, args...)
+	cmd.Stdin = strings.NewReader(text)
+	if output, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%s failed: %v %s", s.engine, err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
+
+// PlayFile plays an audio file with the first available player
+func PlayFile(path string) error {
+	players := [][]string{
+		{"afplay"},
+		{"paplay"},
+		{"aplay", "-q"},
+		{"ffplay", "-nodisp", "-autoexit", "-loglevel", "quiet"},
+	}
+	for _, player := range players {
+		if _, err := exec.LookPath(player[0]); err != nil {
+			continue
+		}
+		cmd := exec.Command(player[0], append(player[1:], path)...)
+		if err := cmd.Run(); err != nil {
+			return fmt.Errorf("failed to play audio with %s: %v", player[0], err)
+		}
+		return nil
+	}
+	return fmt.Errorf("no audio player found (tried afplay, paplay, aplay and ffplay)")
+}
+
+var (
+	codeBlockPattern  = regexp.MustCompile("(?s)```.*?(```|$)")
+	inlineCodePattern = regexp.MustCompile("`([^`]*)`")
+	linkPattern       = regexp.MustCompile(`\[([^\]]*)\]\([^)]*\)`)
+	markupPattern     = regexp.MustCompile(`[*_#>~|]+`)
+)
+
+// CleanText removes markdown that should not be read aloud, such as code blocks and emphasis markers
+func CleanText(text string) string {
+	text = codeBlockPattern.ReplaceAllString(text, " (code omitted) ")
+	text = inlineCodePattern.ReplaceAllString(text, "$1")
+	text = linkPattern.ReplaceAllString(text, "$1")
+	text = markupPattern.ReplaceAllString(text, " ")
+	return strings.Join(strings.Fields(text), " ")
+}
@@ -0,0 +1,131 @@
+package speech
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"time"
+)
+
+// pcmAudio holds 16-bit mono samples
+type pcmAudio struct {
+	sampleRate int
+	samples    []int16
+}
+
+// readWAV loads a 16-bit PCM WAV file, mixing multiple channels down to mono
+func readWAV(path string) (*pcmAudio, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read audio: %v", err)
+	}
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("%s is not a WAV file", path)
+	}
+
+	var channels, bits, format int
+	var sampleRate int
+	var pcm []byte
+	for offset := 12; offset+8 <= len(data); {
+		id := string(data[offset : offset+4])
+		size := int(binary.LittleEndian.Uint32(data[offset+4 : offset+8]))
+		body := offset + 8
+		// Streaming writers may leave the size unset, so clamp it to the file
+		if size < 0 || body+size > len(data) {
+			size = len(data) - body
+		}
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("invalid WAV format chunk in %s", path)
+			}
+			format = int(binary.LittleEndian.Uint16(data[body:]))
+			channels = int(binary.LittleEndian.Uint16(data[body+2:]))
+			sampleRate = int(binary.LittleEndian.Uint32(data[body+4:]))
+			bits = int(binary.LittleEndian.Uint16(data[body+14:]))
+		case "data":
+			pcm = data[body : body+size]
+		}
+		offset = body + size + size%2
+	}
+
+	if format != 1 || bits != 16 || channels == 0 {
+		return nil, fmt.Errorf("%s must be 16-bit PCM audio", path)
+	}
+
+	frames := len(pcm) / (2 * channels)
+	audio := &pcmAudio{sampleRate: sampleRate, samples: make([]int16, frames)}
+	for i := 0; i < frames; i++ {
+		sum := 0
+		for c := 0; c < channels; c++ {
+			sum += int(int16(binary.LittleEndian.Uint16(pcm[(i*channels+c)*2:])))
+		}
+		audio.samples[i] = int16(sum / channels)
+	}
+	return audio, nil
+}
+
+// resample converts audio to another sample rate with linear interpolation
+func (a *pcmAudio) resample(rate int) []int16 {
+	if a.sampleRate == rate || len(a.samples) == 0 {
+		return a.samples
+	}
+	count := int(int64(len(a.samples)) * int64(rate) / int64(a.sampleRate))
+	out := make([]int16, count)
+	ratio := float64(a.sampleRate) / float64(rate)
+	for i := range out {
+		pos := float64(i) * ratio
+		index := int(pos)
+		if index+1 >= len(a.samples) {
+			out[i] = a.samples[len(a.samples)-1]
+			continue
+		}
+		frac := pos - float64(index)
+		out[i] = int16(float64(a.samples[index])*(1-frac) + float64(a.samples[index+1])*frac)
+	}
+	return out
+}
+
+// ConcatWAV joins WAV files into a single mono file, with a pause between them.
+// Files with different sample rates are converted to the rate of the first one
+func ConcatWAV(output string, inputs []string, pause time.Duration) error {
+	var rate int
+	var samples []int16
+	for i, input := range inputs {
+		audio, err := readWAV(input)
+		if err != nil {
+			return err
+		}
+		if i == 0 {
+			rate = audio.sampleRate
+		} else {
+			samples = append(samples, make([]int16, int(pause.Seconds()*float64(rate)))...)
+		}
+		samples = append(samples, audio.resample(rate)...)
+	}
+	if rate == 0 {
+		return fmt.Errorf("no audio to write")
+	}
+
+	var buf bytes.Buffer
+	dataSize := len(samples) * 2
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(36+dataSize))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // PCM
+	binary.Write(&buf, binary.LittleEndian, uint16(1)) // Mono
+	binary.Write(&buf, binary.LittleEndian, uint32(rate))
+	binary.Write(&buf, binary.LittleEndian, uint32(rate*2))
+	binary.Write(&buf, binary.LittleEndian, uint16(2))
+	binary.Write(&buf, binary.LittleEndian, uint16(16))
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(dataSize))
+	binary.Write(&buf, binary.LittleEndian, samples)
+
+	if err := os.WriteFile(output, buf.Bytes(), 0644); err != nil {
+		return fmt.Errorf("failed to write audio file: %v", err)
+	}
+	return nil
+}
@@ -1,6 +1,7 @@
 package store
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -10,6 +11,9 @@ import (
 	"time"
 
 	"gopkg.in/yaml.v3"
+
+	"chatty/cmd/chatty/appdir"
+	"chatty/cmd/chatty/theme"
 )
 
 // Handler implements store operations
@@ -186,13 +190,14 @@ func (h *Handler) getCategoryDescription(categoryName string) string {
 
 // ListAgents displays all agents in the store, organized by categories
 func (h *Handler) ListAgents() error {
-	// Define color constants for better readability
-	colorMagenta := "\033[1;35m"
-	colorCyan := "\033[1;36m"
-	colorYellow := "\033[1;33m" // Bright yellow for better visibility
-	colorWhite := "\033[1;37m"  // Bright white for better visibility
-	colorReset := "\033[0m"
-	colorGray := "\033[1;37m"   // Changed from dark gray to light gray for better readability
+	// Theme colors for better readability
+	palette := theme.Current()
+	colorHeading := palette.Heading
+	colorSection := palette.Section
+	colorEmphasis := palette.Emphasis
+	colorText := palette.Text
+	colorReset := palette.Reset
+	colorDetail := palette.Text
 	
 	// Start loading animation
 	anim := NewStoreAnimation("Fetching community store data...")
@@ -213,9 +218,9 @@ func (h *Handler) ListAgents() error {
 	
 	// Display header
 	fmt.Printf("\n%s Community Store (%d agents available)%s\n", 
-		colorMagenta, index.TotalAgents, colorReset)
+		colorHeading, index.TotalAgents, colorReset)
 	fmt.Printf("%s%s%s\n", 
-		colorMagenta, strings.Repeat("━", 50), colorReset)
+		colorHeading, strings.Repeat("━", 50), colorReset)
 	
 	// Categorize agents
 	categorizedAgents := h.categorizeAgents(index.Files)
@@ -275,26 +280,26 @@ func (h *Handler) ListAgents() error {
 			
 			// Display category header with TOTAL count from All
 			fmt.Printf("\n%s📂 %s%s%s (%d)%s\n", 
-				colorCyan, colorCyan, category, colorReset, len(categoryResult.All), colorReset)
+				colorSection, colorSection, category, colorReset, len(categoryResult.All), colorReset)
 			
 			// Display category description if available
 			if description != "" {
-				fmt.Printf("%s%s%s\n", colorGray, description, colorReset)
+				fmt.Printf("%s%s%s\n", colorDetail, description, colorReset)
 			}
 			
 			// Print a separator line under the category header
-			fmt.Printf("%s%s%s\n", colorCyan, strings.Repeat("━", 50), colorReset)
+			fmt.Printf("%s%s%s\n", colorSection, strings.Repeat("━", 50), colorReset)
 			
 			// Display agents in this category (filtered subset)
 			for _, agent := range categoryResult.Filtered {
 				// Print each agent with emoji, name, and description
 				fmt.Printf("  %s %s%s%s%s %s%s%s\n",
-					agent.Emoji,
-					colorYellow,
+					theme.AgentEmoji(agent.Emoji, agent.Name),
+					colorEmphasis,
 					agent.Name,
 					colorReset,
 					h.formatAuthor(agent.Author),
-					colorWhite,
+					colorText,
 					agent.Description,
 					colorReset)
 			}
@@ -302,7 +307,7 @@ func (h *Handler) ListAgents() error {
 			// If we're showing a limited set, add a note
 			if len(categoryResult.Filtered) < len(categoryResult.All) {
 				fmt.Printf("\n  %s... and %d more (use --category \"%s\" to see all)%s\n", 
-					colorGray, 
+					colorDetail, 
 					len(categoryResult.All) - len(categoryResult.Filtered),
 					category,
 					colorReset)
@@ -311,16 +316,16 @@ func (h *Handler) ListAgents() error {
 	}
 	
 	// Display help section
-	fmt.Printf("\n%s💡 Quick Actions%s\n", colorCyan, colorReset)
-	fmt.Printf("%s%s%s\n", colorCyan, strings.Repeat("━", 50), colorReset)
+	fmt.Printf("\n%s💡 Quick Actions%s\n", colorSection, colorReset)
+	fmt.Printf("%s%s%s\n", colorSection, strings.Repeat("━", 50), colorReset)
 	fmt.Printf("   %s1.%s %sView agent details:%s chatty --show %s\"Agent Name\"%s\n", 
-		colorYellow, colorReset, colorYellow, colorReset, colorYellow, colorReset)
+		colorEmphasis, colorReset, colorEmphasis, colorReset, colorEmphasis, colorReset)
 	fmt.Printf("   %s2.%s %sInstall an agent:%s chatty --install %s\"Agent Name\"%s\n", 
-		colorYellow, colorReset, colorYellow, colorReset, colorYellow, colorReset)
+		colorEmphasis, colorReset, colorEmphasis, colorReset, colorEmphasis, colorReset)
 	fmt.Printf("   %s3.%s %sFilter by category:%s chatty --store --category %s\"Category Name\"%s\n", 
-		colorYellow, colorReset, colorYellow, colorReset, colorYellow, colorReset)
+		colorEmphasis, colorReset, colorEmphasis, colorReset, colorEmphasis, colorReset)
 	fmt.Printf("   %s4.%s %sSearch agents:%s chatty --store --search %s\"query\"%s\n\n", 
-		colorYellow, colorReset, colorYellow, colorReset, colorYellow, colorReset)
+		colorEmphasis, colorReset, colorEmphasis, colorReset, colorEmphasis, colorReset)
 	
 	return nil
 }
@@ -335,14 +340,15 @@ func (h *Handler) formatAuthor(author string) string {
 
 // ShowAgent displays detailed information about a store agent
 func (h *Handler) ShowAgent(name string) error {
-	// Define color constants for better readability
-	colorMagenta := "\033[1;35m"
-	colorCyan := "\033[1;36m"
-	colorGreen := "\033[32m"
-	colorPurple := "\033[1;95m"
-	colorBlue := "\033[1;34m"
-	colorYellow := "\033[1;33m"
-	colorReset := "\033[0m"
+	// Theme colors for better readability
+	palette := theme.Current()
+	colorHeading := palette.Heading
+	colorSection := palette.Section
+	colorSuccess := palette.Success
+	colorLabel := palette.Label
+	colorValue := palette.Value
+	colorEmphasis := palette.Emphasis
+	colorReset := palette.Reset
 
 	// Start loading animation
 	anim := NewStoreAnimation("Fetching agent details from community store...")
@@ -387,50 +393,51 @@ func (h *Handler) ShowAgent(name string) error {
 
 	// Display agent information with consistent styling
 	fmt.Printf("\n%s🔍 Community Store Agent: %s%s%s\n", 
-		colorMagenta, colorYellow, agentInfo.Name, colorReset)
+		colorHeading, colorEmphasis, agentInfo.Name, colorReset)
 	
-	fmt.Printf("\n%s📋 Basic Information%s\n", colorCyan, colorReset)
+	fmt.Printf("\n%s📋 Basic Information%s\n", colorSection, colorReset)
 	fmt.Printf("  %s•%s %sIdentifier:%s %s\n", 
-		colorGreen, colorReset, colorPurple, colorReset, agentInfo.ID)
+		colorSuccess, colorReset, colorLabel, colorReset, agentInfo.ID)
 	fmt.Printf("  %s•%s %sEmoji:%s %s\n", 
-		colorGreen, colorReset, colorPurple, colorReset, agentInfo.Emoji)
+		colorSuccess, colorReset, colorLabel, colorReset, agentInfo.Emoji)
 	fmt.Printf("  %s•%s %sDescription:%s %s\n", 
-		colorGreen, colorReset, colorPurple, colorReset, agentInfo.Description)
+		colorSuccess, colorReset, colorLabel, colorReset, agentInfo.Description)
 	fmt.Printf("  %s•%s %sAdded:%s %s\n", 
-		colorGreen, colorReset, colorPurple, colorReset, agentInfo.CreatedAt.Format("2006-01-02"))
+		colorSuccess, colorReset, colorLabel, colorReset, agentInfo.CreatedAt.Format("2006-01-02"))
 	
 	// Display author if present
 	if author, ok := agentYAML["author"].(string); ok && author != "" {
 		fmt.Printf("  %s•%s %sAuthor:%s %s\n", 
-			colorGreen, colorReset, colorPurple, colorReset, author)
+			colorSuccess, colorReset, colorLabel, colorReset, author)
 	}
 	
 	fmt.Printf("  %s•%s %sStatus:%s Available in Store\n", 
-		colorGreen, colorReset, colorPurple, colorReset)
+		colorSuccess, colorReset, colorLabel, colorReset)
 
-	fmt.Printf("\n%s🎭 System Message%s\n", colorCyan, colorReset)
-	fmt.Printf("%s%s%s\n", colorBlue, agentYAML["system_message"], colorReset)
+	fmt.Printf("\n%s🎭 System Message%s\n", colorSection, colorReset)
+	fmt.Printf("%s%s%s\n", colorValue, agentYAML["system_message"], colorReset)
 
-	fmt.Printf("\n%s💡 Quick Actions%s\n", colorCyan, colorReset)
+	fmt.Printf("\n%s💡 Quick Actions%s\n", colorSection, colorReset)
 	fmt.Printf("  %s1.%s %sInstall this agent:%s chatty --install \"%s\"\n", 
-		colorGreen, colorReset, colorPurple, colorReset, agentInfo.Name)
+		colorSuccess, colorReset, colorLabel, colorReset, agentInfo.Name)
 	fmt.Printf("  %s2.%s %sAfter installation:%s chatty --select \"%s\"\n", 
-		colorGreen, colorReset, colorPurple, colorReset, agentInfo.Name)
+		colorSuccess, colorReset, colorLabel, colorReset, agentInfo.Name)
 	fmt.Printf("  %s3.%s %sStart chatting:%s chatty --with \"%s\"\n\n", 
-		colorGreen, colorReset, colorPurple, colorReset, agentInfo.Name)
+		colorSuccess, colorReset, colorLabel, colorReset, agentInfo.Name)
 
 	return nil
 }
 
 // ListAgentsByCategory displays agents filtered by a specific category
 func (h *Handler) ListAgentsByCategory(categoryName string) error {
-	// Define color constants for better readability
-	colorMagenta := "\033[1;35m"
-	colorCyan := "\033[1;36m"
-	colorYellow := "\033[1;33m" // Bright yellow for better visibility
-	colorWhite := "\033[1;37m"  // Bright white for better visibility
-	colorReset := "\033[0m"
-	colorGray := "\033[1;37m"   // Changed from dark gray to light gray for better readability
+	// Theme colors for better readability
+	palette := theme.Current()
+	colorHeading := palette.Heading
+	colorSection := palette.Section
+	colorEmphasis := palette.Emphasis
+	colorText := palette.Text
+	colorReset := palette.Reset
+	colorDetail := palette.Text
 	
 	// Start loading animation
 	anim := NewStoreAnimation("Fetching community store data...")
@@ -469,10 +476,10 @@ func (h *Handler) ListAgentsByCategory(categoryName string) error {
 	// Check if the category was found
 	if matchedCategory == "" {
 		fmt.Printf("\n%s❌ Category not found: %s%s\n\n", 
-			colorYellow, categoryName, colorReset)
+			colorEmphasis, categoryName, colorReset)
 		
 		// Show available categories
-		fmt.Printf("%sAvailable categories:%s\n", colorCyan, colorReset)
+		fmt.Printf("%sAvailable categories:%s\n", colorSection, colorReset)
 		
 		// Sort categories alphabetically
 		var categories []string
@@ -499,26 +506,26 @@ func (h *Handler) ListAgentsByCategory(categoryName string) error {
 	
 	// Display header
 	fmt.Printf("\n%s📂 Category: %s%s%s (%d agents)%s\n", 
-		colorMagenta, colorYellow, matchedCategory, colorReset, totalCount, colorReset)
+		colorHeading, colorEmphasis, matchedCategory, colorReset, totalCount, colorReset)
 	
 	// Display category description if available
 	if description != "" {
-		fmt.Printf("%s%s%s\n", colorGray, description, colorReset)
+		fmt.Printf("%s%s%s\n", colorDetail, description, colorReset)
 	}
 	
 	fmt.Printf("%s%s%s\n\n", 
-		colorMagenta, strings.Repeat("━", 50), colorReset)
+		colorHeading, strings.Repeat("━", 50), colorReset)
 	
 	// Display agents
 	for _, agent := range agents {
 		// Print each agent with emoji, name, and description
 		fmt.Printf("  %s %s%s%s%s %s%s%s\n",
-			agent.Emoji,
-			colorYellow,
+			theme.AgentEmoji(agent.Emoji, agent.Name),
+			colorEmphasis,
 			agent.Name,
 			colorReset,
 			h.formatAuthor(agent.Author),
-			colorWhite,
+			colorText,
 			agent.Description,
 			colorReset)
 		
@@ -528,33 +535,34 @@ func (h *Handler) ListAgentsByCategory(categoryName string) error {
 	// If we're showing a limited set, display a notice
 	if len(agents) < totalCount {
 		fmt.Printf("%sShowing %d of %d agents. For complete list:%s\n", 
-			colorGray, len(agents), totalCount, colorReset)
+			colorDetail, len(agents), totalCount, colorReset)
 		fmt.Printf("  chatty --store --category \"%s\" --all\n\n", matchedCategory)
 	}
 	
 	// Display help section
-	fmt.Printf("%s💡 Quick Actions%s\n", colorCyan, colorReset)
-	fmt.Printf("%s%s%s\n", colorCyan, strings.Repeat("━", 50), colorReset)
+	fmt.Printf("%s💡 Quick Actions%s\n", colorSection, colorReset)
+	fmt.Printf("%s%s%s\n", colorSection, strings.Repeat("━", 50), colorReset)
 	fmt.Printf("   %s1.%s %sView agent details:%s chatty --show %s\"Agent Name\"%s\n", 
-		colorYellow, colorReset, colorYellow, colorReset, colorYellow, colorReset)
+		colorEmphasis, colorReset, colorEmphasis, colorReset, colorEmphasis, colorReset)
 	fmt.Printf("   %s2.%s %sInstall an agent:%s chatty --install %s\"Agent Name\"%s\n", 
-		colorYellow, colorReset, colorYellow, colorReset, colorYellow, colorReset)
+		colorEmphasis, colorReset, colorEmphasis, colorReset, colorEmphasis, colorReset)
 	fmt.Printf("   %s3.%s %sReturn to store:%s chatty --store\n\n", 
-		colorYellow, colorReset, colorYellow, colorReset)
+		colorEmphasis, colorReset, colorEmphasis, colorReset)
 	
 	return nil
 }
 
 // ListAgentsByTags displays agents filtered by specific tags
 func (h *Handler) ListAgentsByTags(tags []string) error {
-	// Define color constants for better readability
-	colorMagenta := "\033[1;35m"
-	colorCyan := "\033[1;36m"
-	colorYellow := "\033[1;33m" // Bright yellow for better visibility
-	colorWhite := "\033[1;37m"  // Bright white for better visibility
-	colorReset := "\033[0m"
-	colorBlue := "\033[1;34m"
-	colorGray := "\033[1;37m"   // Changed from dark gray to light gray for better readability
+	// Theme colors for better readability
+	palette := theme.Current()
+	colorHeading := palette.Heading
+	colorSection := palette.Section
+	colorEmphasis := palette.Emphasis
+	colorText := palette.Text
+	colorReset := palette.Reset
+	colorValue := palette.Value
+	colorDetail := palette.Text
 	
 	// Start loading animation
 	anim := NewStoreAnimation("Fetching community store data...")
@@ -579,11 +587,11 @@ func (h *Handler) ListAgentsByTags(tags []string) error {
 	// Check if any agents match the tags
 	if len(filteredAgents) == 0 {
 		fmt.Printf("\n%s❌ No agents found with tags: %s%s\n\n", 
-			colorYellow, strings.Join(tags, ", "), colorReset)
+			colorEmphasis, strings.Join(tags, ", "), colorReset)
 		
 		// Show available tags if we have tag definitions
 		if h.tagsConfig != nil && len(h.tagsConfig.Tags) > 0 {
-			fmt.Printf("%sAvailable tags:%s\n", colorCyan, colorReset)
+			fmt.Printf("%sAvailable tags:%s\n", colorSection, colorReset)
 			
 			// Get and sort tag names
 			var tagNames []string
@@ -596,8 +604,8 @@ func (h *Handler) ListAgentsByTags(tags []string) error {
 			for _, tagName := range tagNames {
 				tagDef := h.tagsConfig.Tags[tagName]
 				fmt.Printf("  • %s%s%s: %s%s%s\n", 
-					colorBlue, tagDef.Name, colorReset, 
-					colorWhite, tagDef.Description, colorReset)
+					colorValue, tagDef.Name, colorReset, 
+					colorText, tagDef.Description, colorReset)
 			}
 			fmt.Println()
 		}
@@ -607,27 +615,27 @@ func (h *Handler) ListAgentsByTags(tags []string) error {
 	
 	// Display header with tag filter
 	fmt.Printf("\n%s🏷️  Agents with tags: %s%s%s (%d agents)%s\n", 
-		colorMagenta, colorYellow, strings.Join(tags, ", "), colorReset, len(filteredAgents), colorReset)
+		colorHeading, colorEmphasis, strings.Join(tags, ", "), colorReset, len(filteredAgents), colorReset)
 	
 	fmt.Printf("%s%s%s\n\n", 
-		colorMagenta, strings.Repeat("━", 50), colorReset)
+		colorHeading, strings.Repeat("━", 50), colorReset)
 	
 	// Display all filtered agents
 	for _, agent := range filteredAgents {
 		// Print each agent with emoji, name, and description
 		fmt.Printf("  %s %s%s%s%s %s%s%s\n",
-			agent.Emoji,
-			colorYellow,
+			theme.AgentEmoji(agent.Emoji, agent.Name),
+			colorEmphasis,
 			agent.Name,
 			colorReset,
 			h.formatAuthor(agent.Author),
-			colorWhite,
+			colorText,
 			agent.Description,
 			colorReset)
 		
 		// Display tags with highlighting for matched tags
 		if len(agent.Tags) > 0 {
-			fmt.Printf("     %sTags:%s ", colorGray, colorReset)
+			fmt.Printf("     %sTags:%s ", colorDetail, colorReset)
 			for i, tag := range agent.Tags {
 				if i > 0 {
 					fmt.Print(", ")
@@ -643,9 +651,9 @@ func (h *Handler) ListAgentsByTags(tags []string) error {
 				}
 				
 				if isMatched {
-					fmt.Printf("%s%s%s", colorCyan, tag, colorReset)
+					fmt.Printf("%s%s%s", colorSection, tag, colorReset)
 				} else {
-					fmt.Printf("%s%s%s", colorBlue, tag, colorReset)
+					fmt.Printf("%s%s%s", colorValue, tag, colorReset)
 				}
 			}
 			fmt.Println()
@@ -655,28 +663,29 @@ func (h *Handler) ListAgentsByTags(tags []string) error {
 	}
 	
 	// Display help section
-	fmt.Printf("%s💡 Quick Actions%s\n", colorCyan, colorReset)
-	fmt.Printf("%s%s%s\n", colorCyan, strings.Repeat("━", 50), colorReset)
+	fmt.Printf("%s💡 Quick Actions%s\n", colorSection, colorReset)
+	fmt.Printf("%s%s%s\n", colorSection, strings.Repeat("━", 50), colorReset)
 	fmt.Printf("   %s1.%s %sView agent details:%s chatty --show %s\"Agent Name\"%s\n", 
-		colorYellow, colorReset, colorYellow, colorReset, colorYellow, colorReset)
+		colorEmphasis, colorReset, colorEmphasis, colorReset, colorEmphasis, colorReset)
 	fmt.Printf("   %s2.%s %sInstall an agent:%s chatty --install %s\"Agent Name\"%s\n", 
-		colorYellow, colorReset, colorYellow, colorReset, colorYellow, colorReset)
+		colorEmphasis, colorReset, colorEmphasis, colorReset, colorEmphasis, colorReset)
 	fmt.Printf("   %s3.%s %sReturn to store:%s chatty --store\n\n", 
-		colorYellow, colorReset, colorYellow, colorReset)
+		colorEmphasis, colorReset, colorEmphasis, colorReset)
 	
 	return nil
 }
 
 // InstallAgent downloads and installs an agent from the store
 func (h *Handler) InstallAgent(name string) error {
-	// Define color constants for better readability
-	colorMagenta := "\033[1;35m"
-	colorCyan := "\033[1;36m"
-	colorGreen := "\033[32m"
-	colorPurple := "\033[1;95m"
-	colorBlue := "\033[1;34m"
-	colorYellow := "\033[1;33m"
-	colorReset := "\033[0m"
+	// Theme colors for better readability
+	palette := theme.Current()
+	colorHeading := palette.Heading
+	colorSection := palette.Section
+	colorSuccess := palette.Success
+	colorLabel := palette.Label
+	colorValue := palette.Value
+	colorEmphasis := palette.Emphasis
+	colorReset := palette.Reset
 
 	// Start loading animation
 	anim := NewStoreAnimation("Checking agent status...")
@@ -706,15 +715,15 @@ func (h *Handler) InstallAgent(name string) error {
 				if strings.EqualFold(agentConfig.Name, name) {
 					anim.Stop()
 					fmt.Printf("\n%s📝 Note:%s %s%s%s is a built-in agent and is already available\n\n", 
-						colorYellow, colorReset,
-						colorMagenta, name, colorReset)
-					fmt.Printf("%s💡 Quick Actions:%s\n", colorCyan, colorReset)
+						colorEmphasis, colorReset,
+						colorHeading, name, colorReset)
+					fmt.Printf("%s💡 Quick Actions:%s\n", colorSection, colorReset)
 					fmt.Printf("  %s1.%s %sStart chatting:%s chatty --with %s\"%s\"%s\n",
-						colorGreen, colorReset, colorPurple, colorReset, colorBlue, name, colorReset)
+						colorSuccess, colorReset, colorLabel, colorReset, colorValue, name, colorReset)
 					fmt.Printf("  %s2.%s %sSet as default:%s chatty --select %s\"%s\"%s\n",
-						colorGreen, colorReset, colorPurple, colorReset, colorBlue, name, colorReset)
+						colorSuccess, colorReset, colorLabel, colorReset, colorValue, name, colorReset)
 					fmt.Printf("  %s3.%s %sView details:%s chatty --show %s\"%s\"%s\n\n",
-						colorGreen, colorReset, colorPurple, colorReset, colorBlue, name, colorReset)
+						colorSuccess, colorReset, colorLabel, colorReset, colorValue, name, colorReset)
 					return nil
 				}
 			}
@@ -722,12 +731,12 @@ func (h *Handler) InstallAgent(name string) error {
 	}
 
 	// Then check if it's already installed as a custom agent
-	homeDir, err := os.UserHomeDir()
+	configDir, err := appdir.ConfigDir()
 	if err != nil {
 		anim.Stop()
-		return fmt.Errorf("failed to get home directory: %v", err)
+		return err
 	}
-	agentsDir := filepath.Join(homeDir, ".chatty", "agents")
+	agentsDir := filepath.Join(configDir, "agents")
 
 	// Read all installed agent files
 	files, err = os.ReadDir(agentsDir)
@@ -750,15 +759,15 @@ func (h *Handler) InstallAgent(name string) error {
 				if strings.EqualFold(agentConfig.Name, name) {
 					anim.Stop()
 					fmt.Printf("\n%s📝 Note:%s Agent %s%s%s is already installed\n\n", 
-						colorYellow, colorReset,
-						colorMagenta, name, colorReset)
-					fmt.Printf("%s💡 Quick Actions:%s\n", colorCyan, colorReset)
+						colorEmphasis, colorReset,
+						colorHeading, name, colorReset)
+					fmt.Printf("%s💡 Quick Actions:%s\n", colorSection, colorReset)
 					fmt.Printf("  %s1.%s %sStart chatting:%s chatty --with %s\"%s\"%s\n",
-						colorGreen, colorReset, colorPurple, colorReset, colorBlue, name, colorReset)
+						colorSuccess, colorReset, colorLabel, colorReset, colorValue, name, colorReset)
 					fmt.Printf("  %s2.%s %sSet as default:%s chatty --select %s\"%s\"%s\n",
-						colorGreen, colorReset, colorPurple, colorReset, colorBlue, name, colorReset)
+						colorSuccess, colorReset, colorLabel, colorReset, colorValue, name, colorReset)
 					fmt.Printf("  %s3.%s %sView details:%s chatty --show %s\"%s\"%s\n\n",
-						colorGreen, colorReset, colorPurple, colorReset, colorBlue, name, colorReset)
+						colorSuccess, colorReset, colorLabel, colorReset, colorValue, name, colorReset)
 					return nil
 				}
 			}
@@ -770,55 +779,99 @@ func (h *Handler) InstallAgent(name string) error {
 	anim = NewStoreAnimation("Fetching agent from community store...")
 	anim.Start()
 
-	// Fetch store index
-	index, err := h.client.FetchIndex()
+	agentInfo, err := h.DownloadAgent(name)
 	if err != nil {
 		anim.Stop()
 		return err
 	}
 
-	// Find agent in index
+	// Stop animation before showing success message
+	anim.Stop()
+
+	fmt.Printf("\n%s✅ Successfully installed %s %s%s\n", 
+		colorSuccess, theme.AgentEmoji(agentInfo.Emoji, agentInfo.Name), agentInfo.Name, colorReset)
+	fmt.Printf("\n%s💡 Quick Actions:%s\n", colorSection, colorReset)
+	fmt.Printf("  %s1.%s %sSet as current agent:%s chatty --select %s\"%s\"%s\n",
+		colorSuccess, colorReset, colorLabel, colorReset, colorValue, agentInfo.Name, colorReset)
+	fmt.Printf("  %s2.%s %sStart chatting:%s chatty --with %s\"%s\"%s\n\n",
+		colorSuccess, colorReset, colorLabel, colorReset, colorValue, agentInfo.Name, colorReset)
+
+	return nil
+}
+
+// ErrNotInStore is returned for agents the store doesn't have
+var ErrNotInStore = errors.New("not found in store")
+
+// DownloadAgent fetches an agent from the store by name or ID and saves it to the agents
+// directory, without any output, returning its store entry
+func (h *Handler) DownloadAgent(name string) (*AgentInfo, error) {
+	configDir, err := appdir.ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	agentsDir := filepath.Join(configDir, "agents")
+
+	index, err := h.client.FetchIndex()
+	if err != nil {
+		return nil, err
+	}
+
 	var agentInfo *AgentInfo
-	for _, agent := range index.Files {
+	for i, agent := range index.Files {
 		if strings.EqualFold(agent.Name, name) || strings.EqualFold(agent.ID, name) {
-			agentInfo = &agent
+			agentInfo = &index.Files[i]
 			break
 		}
 	}
-
 	if agentInfo == nil {
-		anim.Stop()
-		return fmt.Errorf("agent '%s' not found in store", name)
+		return nil, fmt.Errorf("agent '%s' %w", name, ErrNotInStore)
 	}
 
-	// Fetch agent YAML
 	data, err := h.client.FetchAgent(agentInfo.Filename)
 	if err != nil {
-		anim.Stop()
-		return err
+		return nil, err
 	}
-
-	// Create target filename
-	targetPath := filepath.Join(agentsDir, agentInfo.Filename)
-
-	// Write agent file
-	if err := os.WriteFile(targetPath, data, 0644); err != nil {
-		anim.Stop()
-		return fmt.Errorf("failed to save agent file: %v", err)
+	if err := os.MkdirAll(agentsDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create agents directory: %v", err)
 	}
+	if err := os.WriteFile(filepath.Join(agentsDir, filepath.Base(agentInfo.Filename)), data, 0644); err != nil {
+		return nil, fmt.Errorf("failed to save agent file: %v", err)
+	}
+	return agentInfo, nil
+}
 
-	// Stop animation before showing success message
-	anim.Stop()
-
-	fmt.Printf("\n%s✅ Successfully installed %s %s%s\n", 
-		colorGreen, agentInfo.Emoji, agentInfo.Name, colorReset)
-	fmt.Printf("\n%s💡 Quick Actions:%s\n", colorCyan, colorReset)
-	fmt.Printf("  %s1.%s %sSet as current agent:%s chatty --select %s\"%s\"%s\n",
-		colorGreen, colorReset, colorPurple, colorReset, colorBlue, agentInfo.Name, colorReset)
-	fmt.Printf("  %s2.%s %sStart chatting:%s chatty --with %s\"%s\"%s\n\n",
-		colorGreen, colorReset, colorPurple, colorReset, colorBlue, agentInfo.Name, colorReset)
+// FindAgents returns the store agents whose name, description or tags contain the query,
+// sorted by name, or every agent when the query is empty
+func (h *Handler) FindAgents(query string) ([]AgentInfo, error) {
+	index, err := h.client.FetchIndex()
+	if err != nil {
+		return nil, err
+	}
+	searchTerm := strings.ToLower(query)
+	var matchedAgents []AgentInfo
+	for _, agent := range index.Files {
+		if matchesSearch(agent, searchTerm) {
+			matchedAgents = append(matchedAgents, agent)
+		}
+	}
+	sort.Slice(matchedAgents, func(i, j int) bool {
+		return matchedAgents[i].Name < matchedAgents[j].Name
+	})
+	return matchedAgents, nil
+}
 
-	return nil
+// matchesSearch reports whether a lowercase search term appears in an agent's name, description or tags
+func matchesSearch(agent AgentInfo, searchTerm string) bool {
+	if strings.Contains(strings.ToLower(agent.Name), searchTerm) ||
+		strings.Contains(strings.ToLower(agent.Description), searchTerm) {
+		return true
+	}
+	for _, tag := range agent.Tags {
+		if strings.Contains(strings.ToLower(tag), searchTerm) {
+			return true
+		}
+	}
+	return false
 }
 
 // GetIndex retrieves the store index
@@ -842,15 +895,16 @@ func (h *Handler) GetIndex() (*StoreIndex, error) {
 
 // SearchAgents searches for agents matching the query in name, description, or tags
 func (h *Handler) SearchAgents(query string) error {
-	// Define color constants for better readability
-	colorMagenta := "\033[1;35m"
-	colorCyan := "\033[1;36m"
-	colorYellow := "\033[1;33m" // Bright yellow for better visibility
-	colorGreen := "\033[32m"
-	colorReset := "\033[0m"
-	colorBlue := "\033[1;34m"
-	colorWhite := "\033[1;37m"  // Bright white for better visibility
-	colorGray := "\033[1;37m"   // Changed from dark gray to light gray for better readability
+	// Theme colors for better readability
+	palette := theme.Current()
+	colorHeading := palette.Heading
+	colorSection := palette.Section
+	colorEmphasis := palette.Emphasis
+	colorSuccess := palette.Success
+	colorReset := palette.Reset
+	colorValue := palette.Value
+	colorText := palette.Text
+	colorDetail := palette.Text
 	
 	// Start loading animation
 	anim := NewStoreAnimation("Searching agents...")
@@ -873,20 +927,7 @@ func (h *Handler) SearchAgents(query string) error {
 	var matchedAgents []AgentInfo
 	for _, agent := range index.Files {
 		// Check if the search term appears in name, description, or tags
-		nameMatch := strings.Contains(strings.ToLower(agent.Name), searchTerm)
-		descMatch := strings.Contains(strings.ToLower(agent.Description), searchTerm)
-		
-		// Check tags
-		tagMatch := false
-		for _, tag := range agent.Tags {
-			if strings.Contains(strings.ToLower(tag), searchTerm) {
-				tagMatch = true
-				break
-			}
-		}
-		
-		// Add agent if any field matches
-		if nameMatch || descMatch || tagMatch {
+		if matchesSearch(agent, searchTerm) {
 			matchedAgents = append(matchedAgents, agent)
 		}
 	}
@@ -894,9 +935,9 @@ func (h *Handler) SearchAgents(query string) error {
 	// Check if any matches were found
 	if len(matchedAgents) == 0 {
 		fmt.Printf("\n%s❌ No agents found matching: '%s'%s\n\n", 
-			colorYellow, query, colorReset)
+			colorEmphasis, query, colorReset)
 		fmt.Printf("%sTry a different search term or browse all agents with:%s\n", 
-			colorCyan, colorReset)
+			colorSection, colorReset)
 		fmt.Printf("  chatty --store\n\n")
 		return fmt.Errorf("no agents found matching search term: %s", query)
 	}
@@ -916,27 +957,27 @@ func (h *Handler) SearchAgents(query string) error {
 	
 	// Display header with search term
 	fmt.Printf("\n%s🔍 Search results for: '%s' (%d agents found)%s\n", 
-		colorMagenta, query, totalCount, colorReset)
+		colorHeading, query, totalCount, colorReset)
 	fmt.Printf("%s%s%s\n\n", 
-		colorMagenta, strings.Repeat("━", 50), colorReset)
+		colorHeading, strings.Repeat("━", 50), colorReset)
 	
 	// Display matched agents (limited set)
 	for i := 0; i < displayCount; i++ {
 		agent := matchedAgents[i]
 		// Print each agent with emoji, name, and description
 		fmt.Printf("  %s %s%s%s%s %s%s%s\n",
-			agent.Emoji,
-			colorYellow,
+			theme.AgentEmoji(agent.Emoji, agent.Name),
+			colorEmphasis,
 			agent.Name,
 			colorReset,
 			h.formatAuthor(agent.Author),
-			colorWhite,
+			colorText,
 			agent.Description,
 			colorReset)
 		
 		// Display tags if available
 		if len(agent.Tags) > 0 {
-			fmt.Printf("     %sTags:%s ", colorGray, colorReset)
+			fmt.Printf("     %sTags:%s ", colorDetail, colorReset)
 			for i, tag := range agent.Tags {
 				if i > 0 {
 					fmt.Print(", ")
@@ -944,9 +985,9 @@ func (h *Handler) SearchAgents(query string) error {
 				
 				// Highlight tag if it matches the search term
 				if strings.Contains(strings.ToLower(tag), searchTerm) {
-					fmt.Printf("%s%s%s", colorCyan, tag, colorReset)
+					fmt.Printf("%s%s%s", colorSection, tag, colorReset)
 				} else {
-					fmt.Printf("%s%s%s", colorBlue, tag, colorReset)
+					fmt.Printf("%s%s%s", colorValue, tag, colorReset)
 				}
 			}
 			fmt.Println()
@@ -958,18 +999,18 @@ func (h *Handler) SearchAgents(query string) error {
 	// If only showing a subset, display a note
 	if displayCount < totalCount {
 		fmt.Printf("%sShowing %d of %d results. Refine your search for more specific results.%s\n\n",
-			colorGray, displayCount, totalCount, colorReset)
+			colorDetail, displayCount, totalCount, colorReset)
 	}
 	
 	// Display help section
-	fmt.Printf("%s💡 Quick Actions%s\n", colorCyan, colorReset)
-	fmt.Printf("%s%s%s\n", colorCyan, strings.Repeat("━", 50), colorReset)
+	fmt.Printf("%s💡 Quick Actions%s\n", colorSection, colorReset)
+	fmt.Printf("%s%s%s\n", colorSection, strings.Repeat("━", 50), colorReset)
 	fmt.Printf("   %s1.%s %sView agent details:%s chatty --show %s\"Agent Name\"%s\n", 
-		colorGreen, colorReset, colorYellow, colorReset, colorBlue, colorReset)
+		colorSuccess, colorReset, colorEmphasis, colorReset, colorValue, colorReset)
 	fmt.Printf("   %s2.%s %sInstall an agent:%s chatty --install %s\"Agent Name\"%s\n", 
-		colorGreen, colorReset, colorYellow, colorReset, colorBlue, colorReset)
+		colorSuccess, colorReset, colorEmphasis, colorReset, colorValue, colorReset)
 	fmt.Printf("   %s3.%s %sReturn to store:%s chatty --store\n", 
-		colorGreen, colorReset, colorYellow, colorReset)
+		colorSuccess, colorReset, colorEmphasis, colorReset)
 	
 	return nil
 } 
\ No newline at end of file
@@ -0,0 +1,70 @@
+package story
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// Lines agents add around their writing, like "Here's my continuation:" or "---"
+	preamblePattern  = regexp.MustCompile(`(?i)^(here('s| is)|sure|certainly|okay|continuing)\b.*:\s*$`)
+	separatorPattern = regexp.MustCompile(`^\s*(?:-{3,}|\*{3,}|_{3,})\s*$`)
+	headingPattern   = regexp.MustCompile(`^\s*#{1,6}\s`)
+)
+
+// Clean returns a passage as prose: without the author's name in front, the lines agents add
+// around their writing, or headings and separators
+func Clean(author, text string) string {
+	text = strings.TrimSpace(text)
+	for _, prefix := range []string{author + " said:", author + ":", "**" + author + ":**", "**" + author + "**:"} {
+		if len(text) >= len(prefix) && strings.EqualFold(text[:len(prefix)], prefix) {
+			text = strings.TrimSpace(text[len(prefix):])
+		}
+	}
+	var lines []string
+	for i, line := range strings.Split(text, "\n") {
+		if separatorPattern.MatchString(line) || headingPattern.MatchString(line) {
+			continue
+		}
+		if i == 0 && preamblePattern.MatchString(strings.TrimSpace(line)) {
+			continue
+		}
+		lines = append(lines, strings.TrimRight(line, " \t"))
+	}
+	return collapseBlankLines(strings.TrimSpace(strings.Join(lines, "\n")))
+}
+
+// collapseBlankLines keeps paragraphs apart with a single blank line
+func collapseBlankLines(text string) string {
+	for strings.Contains(text, "\n\n\n") {
+		text = strings.ReplaceAll(text, "\n\n\n", "\n\n")
+	}
+	return text
+}
+
+// Markdown compiles the story into a manuscript: the title, then every chapter's passages as
+// continuous prose, with an appendix of the character sheets
+func (s *Story) Markdown() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n", s.Title)
+	for i, chapter := range s.Chapters {
+		title := fmt.Sprintf("Chapter %d", i+1)
+		if chapter.Title != "" {
+			title += ": " + chapter.Title
+		}
+		fmt.Fprintf(&sb, "\n## %s\n", title)
+		for _, passage := range chapter.Passages {
+			if text := Clean(passage.Author, passage.Text); text != "" {
+				sb.WriteString("\n" + text + "\n")
+			}
+		}
+	}
+	if len(s.Characters) > 0 {
+		sb.WriteString("\n## Characters\n\n")
+		for _, character := range s.Characters {
+			fmt.Fprintf(&sb, "- **%s**: %s\n", character.Name, character.Sheet)
+		}
+	}
+	return sb.String()
+}
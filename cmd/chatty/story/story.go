@@ -0,0 +1,219 @@
+// Package story keeps the stories agents write together: the premise, the character sheets
+// that carry over from one session to the next, and the chapters, which export to a manuscript
+// without the chat around them
+package story
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"chatty/cmd/chatty/appdir"
+	"chatty/cmd/chatty/atomicfile"
+)
+
+const (
+	storiesDir = "stories" // A JSON file per story
+)
+
+// Character is the sheet of a character, kept up to date as the story goes
+type Character struct {
+	Name  string `json:"name"`
+	Sheet string `json:"sheet"` // Appearance, personality, goals and what happened to them
+}
+
+// Passage is a part of a chapter written by one agent
+type Passage struct {
+	Author string `json:"author"`
+	Text   string `json:"text"`
+}
+
+// Chapter is a chapter of the story
+type Chapter struct {
+	Title    string    `json:"title,omitempty"`
+	Summary  string    `json:"summary,omitempty"` // Given to the authors of later chapters instead of the text
+	Passages []Passage `json:"passages"`
+}
+
+// Story is a story being written
+type Story struct {
+	Title      string      `json:"title"`
+	Premise    string      `json:"premise,omitempty"`
+	Characters []Character `json:"characters,omitempty"`
+	Chapters   []Chapter   `json:"chapters,omitempty"`
+	Updated    time.Time   `json:"updated"`
+
+	path string
+}
+
+// Dir returns the directory stories are kept in
+func Dir() (string, error) {
+	dataDir, err := appdir.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, storiesDir), nil
+}
+
+// fileName turns a title into the name of its file, like the-last-lighthouse.json
+func fileName(title string) string {
+	var sb strings.Builder
+	dash := false
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			sb.WriteRune(r)
+			dash = false
+		} else if !dash && sb.Len() > 0 {
+			sb.WriteRune('-')
+			dash = true
+		}
+	}
+	return strings.TrimSuffix(sb.String(), "-") + ".json"
+}
+
+// Load returns the story with the title, or a new one when it was never started
+func Load(title string) (*Story, error) {
+	title = strings.TrimSpace(title)
+	if fileName(title) == ".json" {
+		return nil, fmt.Errorf("story title '%s' needs letters or digits", title)
+	}
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fileName(title))
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &Story{Title: title, path: path}, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read story: %v", err)
+	}
+	var s Story
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse story %s: %v", path, err)
+	}
+	s.path = path
+	return &s, nil
+}
+
+// Open returns a story that was started, failing for titles that don't have one
+func Open(title string) (*Story, error) {
+	s, err := Load(title)
+	if err != nil {
+		return nil, err
+	}
+	if s.New() {
+		return nil, fmt.Errorf("no story titled '%s'", title)
+	}
+	return s, nil
+}
+
+// List returns the titles of the stories, the most recently written first
+func List() ([]string, error) {
+	dir, err := Dir()
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var stories []Story
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			continue
+		}
+		var s Story
+		if json.Unmarshal(data, &s) == nil && s.Title != "" {
+			stories = append(stories, s)
+		}
+	}
+	sort.Slice(stories, func(i, j int) bool {
+		return stories[i].Updated.After(stories[j].Updated)
+	})
+	titles := make([]string, len(stories))
+	for i, s := range stories {
+		titles[i] = s.Title
+	}
+	return titles, nil
+}
+
+// New reports whether the story was never saved
+func (s *Story) New() bool {
+	return s.Updated.IsZero()
+}
+
+// Save writes the story to its file
+func (s *Story) Save() error {
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create stories directory: %v", err)
+	}
+	s.Updated = time.Now()
+	data, err := json.MarshalIndent(s, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode story: %v", err)
+	}
+	if err := atomicfile.WriteFile(s.path, data, 0644); err != nil {
+		return fmt.Errorf("failed to save story: %v", err)
+	}
+	return nil
+}
+
+// SetCharacters replaces the character sheets with the ones in text, written one per line as
+// "Name: sheet". Characters left out keep their sheets, and the text having none changes nothing
+func (s *Story) SetCharacters(text string) int {
+	found := ParseCharacters(text)
+	for _, character := range found {
+		replaced := false
+		for i := range s.Characters {
+			if strings.EqualFold(s.Characters[i].Name, character.Name) {
+				s.Characters[i].Sheet = character.Sheet
+				replaced = true
+			}
+		}
+		if !replaced {
+			s.Characters = append(s.Characters, character)
+		}
+	}
+	return len(found)
+}
+
+// sheetPattern matches a character sheet line: an optional list marker, the name, possibly in
+// bold, and the sheet after a colon
+var sheetPattern = regexp.MustCompile(`^\s*(?:[-*•]|\d+[.)])?\s*\**([^:*]{1,60}?)\**\s*:\s*\**\s*(.+)$`)
+
+// ParseCharacters reads character sheets written one per line as "Name: sheet"
+func ParseCharacters(text string) []Character {
+	var characters []Character
+	for _, line := range strings.Split(text, "\n") {
+		match := sheetPattern.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		name := strings.TrimSpace(match[1])
+		sheet := strings.TrimSpace(match[2])
+		if name == "" || sheet == "" || len(strings.Fields(name)) > 5 {
+			continue
+		}
+		characters = append(characters, Character{Name: name, Sheet: sheet})
+	}
+	return characters
+}
+
+// Sheets renders the character sheets for the authors
+func (s *Story) Sheets() string {
+	var sb strings.Builder
+	for _, character := range s.Characters {
+		fmt.Fprintf(&sb, "- %s: %s\n", character.Name, character.Sheet)
+	}
+	return strings.TrimSuffix(sb.String(), "\n")
+}
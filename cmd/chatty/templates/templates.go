@@ -0,0 +1,105 @@
+// Package templates fills prompt templates for chatty --template: text files with placeholders
+// like {{file}}, whose values come from --var flags, environment variables or standard input
+package templates
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"chatty/cmd/chatty/appdir"
+)
+
+const (
+	templatesDir = "templates" // Where templates can be found by name
+	maxSize      = 1 << 20
+
+	// EnvPrefix starts the environment variables holding values of placeholders, followed by the
+	// name in capitals: CHATTY_VAR_FILE for {{file}}
+	EnvPrefix = "CHATTY_VAR_"
+
+	// Stdin is the placeholder filled with what is piped to chatty
+	Stdin = "stdin"
+)
+
+// placeholderPattern matches {{name}}, with or without spaces inside the braces
+var placeholderPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_-]*)\s*\}\}`)
+
+// Path returns the file of a template given as a path, or as the name of a file in
+// ~/.chatty/templates with or without its .tmpl extension
+func Path(name string) (string, error) {
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	configDir, err := appdir.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	dir := filepath.Join(configDir, templatesDir)
+	for _, candidate := range []string{name, name + ".tmpl"} {
+		path := filepath.Join(dir, candidate)
+		if _, err := os.Stat(path); err == nil && !strings.ContainsAny(name, `/\`) {
+			return path, nil
+		}
+	}
+	return "", fmt.Errorf("template '%s' not found, as a file or in %s", name, dir)
+}
+
+// Load reads a template file
+func Load(path string) (string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template: %v", err)
+	}
+	if info.Size() > maxSize {
+		return "", fmt.Errorf("template %s is too large", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template: %v", err)
+	}
+	return string(data), nil
+}
+
+// ParseVar splits a --var argument like file=main.go into the name and value of a placeholder
+func ParseVar(arg string) (string, string, error) {
+	name, value, ok := strings.Cut(arg, "=")
+	name = strings.TrimSpace(name)
+	if !ok || !placeholderPattern.MatchString("{{"+name+"}}") {
+		return "", "", fmt.Errorf("--var takes a name and a value, like file=main.go, not '%s'", arg)
+	}
+	return name, value, nil
+}
+
+// Placeholders returns the names of the placeholders in a template, each once, in the order
+// they first appear
+func Placeholders(text string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, match := range placeholderPattern.FindAllStringSubmatch(text, -1) {
+		if name := match[1]; !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// EnvVar returns the name of the environment variable holding the value of a placeholder
+func EnvVar(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+// Fill replaces the placeholders of a template with their values. Placeholders without a value
+// are left as they are
+func Fill(text string, values map[string]string) string {
+	return placeholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		name := placeholderPattern.FindStringSubmatch(placeholder)[1]
+		if value, ok := values[name]; ok {
+			return value
+		}
+		return placeholder
+	})
+}
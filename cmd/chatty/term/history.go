@@ -0,0 +1,83 @@
+package term
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"chatty/cmd/chatty/atomicfile"
+)
+
+// History is the lines entered at a LineEditor, kept in a file between runs. The file has a JSON
+// string per line, the most recent last, so lines with line breaks fit
+type History struct {
+	path    string
+	limit   int
+	entries []string
+}
+
+// LoadHistory reads the history kept in a file, keeping up to limit lines. A file that doesn't
+// exist yet is an empty history
+func LoadHistory(path string, limit int) *History {
+	h := &History{path: path, limit: limit}
+	file, err := os.Open(path)
+	if err != nil {
+		return h
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		var line string
+		if err := json.Unmarshal(scanner.Bytes(), &line); err == nil && line != "" {
+			h.entries = append(h.entries, line)
+		}
+	}
+	if len(h.entries) > limit {
+		h.entries = h.entries[len(h.entries)-limit:]
+	}
+	return h
+}
+
+// Entries returns the lines entered, the most recent last
+func (h *History) Entries() []string {
+	if h == nil {
+		return nil
+	}
+	return h.entries
+}
+
+// Add records a line entered and saves the history. Blank lines and repeats of the last line
+// aren't recorded
+func (h *History) Add(line string) error {
+	if h == nil || strings.TrimSpace(line) == "" {
+		return nil
+	}
+	if len(h.entries) > 0 && h.entries[len(h.entries)-1] == line {
+		return nil
+	}
+	h.entries = append(h.entries, line)
+	if len(h.entries) > h.limit {
+		h.entries = h.entries[len(h.entries)-h.limit:]
+	}
+	if h.path == "" {
+		return nil
+	}
+
+	var data []byte
+	for _, entry := range h.entries {
+		encoded, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		data = append(append(data, encoded...), '\n')
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0755); err != nil {
+		return err
+	}
+	// Only for the user's eyes, like what they typed
+	return atomicfile.WriteFile(h.path, data, 0600)
+}
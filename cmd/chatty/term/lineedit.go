@@ -0,0 +1,508 @@
+package term
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"chatty/cmd/chatty/keys"
+
+	"github.com/mattn/go-runewidth"
+)
+
+// BlockDelimiter on a line of its own starts a message of several lines, which ends at the next
+// one, like the triple quotes of Python
+const BlockDelimiter = `"""`
+
+// LineEditor reads lines typed at a terminal with the editing keys of shells: ←/→ and Home/End
+// or Ctrl+A/E to move, Ctrl+W, Ctrl+U and Ctrl+K to delete a word, to the start or to the end,
+// and ↑/↓ through the lines entered before. Input that isn't a terminal is read as it comes.
+// Messages can span several lines: pasted text keeps its line breaks, Alt+Enter starts a new
+// line, and so does Enter between lines of BlockDelimiter
+type LineEditor struct {
+	in      *os.File
+	out     *os.File
+	reader  *bufio.Reader // Shared with anything else reading from in, so no input read ahead is lost
+	history *History
+}
+
+// NewLineEditor returns a line editor reading keys from in through reader and drawing the line
+// on out. Lines entered are added to history, which may be nil
+func NewLineEditor(in, out *os.File, reader *bufio.Reader, history *History) *LineEditor {
+	return &LineEditor{in: in, out: out, reader: reader, history: history}
+}
+
+// ErrRegenerate is returned by ReadMessage for the regenerate key pressed with nothing typed
+var ErrRegenerate = errors.New("regenerate")
+
+// ReadLine shows the prompt and returns the text typed after it, without the final line break
+// or the lines of BlockDelimiter. It returns io.EOF for Ctrl+D on an empty line, and
+// ErrInterrupted for the keys that cancel, Ctrl+C unless config.json binds others
+func (e *LineEditor) ReadLine(prompt string) (string, error) {
+	return e.read(prompt, false)
+}
+
+// ReadMessage reads a chat message like ReadLine, returning ErrRegenerate when the regenerate
+// key is pressed with nothing typed, for the last message to be answered again
+func (e *LineEditor) ReadMessage(prompt string) (string, error) {
+	return e.read(prompt, true)
+}
+
+func (e *LineEditor) read(prompt string, regenerate bool) (string, error) {
+	restore, err := makeRaw(e.in)
+	if err != nil {
+		fmt.Fprint(e.out, prompt)
+		return e.readPlain()
+	}
+	defer restore()
+
+	// Pasted text is marked, so its line breaks don't send it
+	io.WriteString(e.out, "\033[?2004h")
+	defer io.WriteString(e.out, "\033[?2004l")
+
+	// Only the last line of a prompt is drawn again as the text changes
+	if i := strings.LastIndex(prompt, "\n"); i >= 0 {
+		io.WriteString(e.out, strings.ReplaceAll(prompt[:i+1], "\n", "\r\n"))
+		prompt = prompt[i+1:]
+	}
+	// Output mirrored to a --log file goes through a pipe, which has no size, unlike the terminal
+	// keys are read from. Windows consoles only tell their size through their output, though
+	terminal := e.out
+	if _, _, err := size(terminal); err != nil {
+		terminal = e.in
+	}
+	s := &lineState{
+		out:         e.out,
+		terminal:    terminal,
+		prompt:      prompt,
+		promptWidth: displayWidth(prompt),
+		history:     append(append([]string(nil), e.history.Entries()...), ""),
+		regenerate:  regenerate,
+	}
+	s.index = len(s.history) - 1
+	s.refresh()
+
+	for {
+		r, _, err := e.reader.ReadRune()
+		if err != nil {
+			return "", err
+		}
+		if s.pasting && r != 27 {
+			switch {
+			case r == '\r' || r == '\n':
+				s.insert([]rune{'\n'})
+			case r == '\t':
+				s.insert([]rune("    "))
+			case unicode.IsPrint(r):
+				s.insert([]rune{r})
+			}
+			// Long pastes are drawn once they are in, rather than a key at a time
+			if e.reader.Buffered() == 0 {
+				s.refresh()
+			}
+			continue
+		}
+		var key string
+		if r == 27 { // Escape sequences of arrows and other keys, or Alt with a key
+			key = e.readEscape(s)
+		} else {
+			key = keys.RuneName(r)
+		}
+		switch s.action(key) {
+		case keys.Send:
+			if s.inBlock() && !s.blockClosed() {
+				s.insert([]rune{'\n'})
+				break
+			}
+			text := s.text()
+			s.finish()
+			e.history.Add(text)
+			return text, nil
+		case keys.NewLine:
+			s.insert([]rune{'\n'})
+		case keys.Cancel:
+			s.finish()
+			return "", ErrInterrupted
+		case keys.Regenerate:
+			s.finish()
+			return "", ErrRegenerate
+		default:
+			// Editing keys
+			switch r {
+			case 4: // Ctrl+D
+				if len(s.buf) == 0 {
+					s.finish()
+					return "", io.EOF
+				}
+				if s.inBlock() {
+					// Ends the message without the closing delimiter
+					text := s.text()
+					s.finish()
+					e.history.Add(text)
+					return text, nil
+				}
+				s.deleteForward()
+			case 1: // Ctrl+A
+				s.pos = s.lineStart(s.pos)
+			case 5: // Ctrl+E
+				s.pos = s.lineEnd(s.pos)
+			case 2: // Ctrl+B
+				s.move(-1)
+			case 6: // Ctrl+F
+				s.move(1)
+			case 8, 127: // Backspace
+				if s.pos > 0 {
+					s.delete(s.pos-1, s.pos)
+				}
+			case 23: // Ctrl+W
+				s.delete(s.wordStart(), s.pos)
+			case 21: // Ctrl+U
+				s.delete(s.lineStart(s.pos), s.pos)
+			case 11: // Ctrl+K
+				s.delete(s.pos, s.lineEnd(s.pos))
+			case 16: // Ctrl+P
+				s.up()
+			case 14: // Ctrl+N
+				s.down()
+			case 12: // Ctrl+L
+				io.WriteString(e.out, "\033[H\033[2J")
+				s.row = 0
+			case '\t':
+				s.insert([]rune("    "))
+			default:
+				if unicode.IsPrint(r) {
+					s.insert([]rune{r})
+				}
+			}
+		}
+		s.refresh()
+	}
+}
+
+// action returns the action a key is bound to while typing, or "" for none. Esc isn't one of
+// them, as it starts the escape sequences of other keys, and the regenerate key is only one
+// for messages read with ReadMessage, before anything is typed
+func (s *lineState) action(key string) string {
+	if key == "" || key == "esc" {
+		return ""
+	}
+	for _, action := range []string{keys.Send, keys.NewLine, keys.Cancel, keys.Regenerate} {
+		if keys.Matches(action, key) && (action != keys.Regenerate || s.regenerate && len(s.buf) == 0) {
+			return action
+		}
+	}
+	return ""
+}
+
+// readPlain reads input that isn't a terminal a line at a time, a block of lines at a time
+// between lines of BlockDelimiter
+func (e *LineEditor) readPlain() (string, error) {
+	line, err := e.reader.ReadString('\n')
+	if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+		return "", err
+	}
+	line = strings.TrimRight(line, "\r\n")
+	if strings.TrimSpace(line) != BlockDelimiter {
+		return line, nil
+	}
+	var lines []string
+	for {
+		line, err := e.reader.ReadString('\n')
+		line = strings.TrimRight(line, "\r\n")
+		if strings.TrimSpace(line) == BlockDelimiter || (err != nil && line == "") {
+			return strings.Join(lines, "\n"), nil
+		}
+		lines = append(lines, line)
+		if err != nil {
+			return strings.Join(lines, "\n"), nil
+		}
+	}
+}
+
+// readEscape handles the keys that arrive as escape sequences. It returns the name of a key
+// bound to an action for ReadLine to do it, or "" when the key was handled here
+func (e *LineEditor) readEscape(s *lineState) string {
+	r, _, err := e.reader.ReadRune()
+	if err != nil {
+		return ""
+	}
+	if r == '\n' { // Alt+Enter, as some terminals send it
+		r = '\r'
+	}
+	if r != '[' && r != 'O' {
+		key := "alt+" + keys.RuneName(r)
+		if s.action(key) != "" {
+			return key
+		}
+	}
+	switch r {
+	case 'b': // Alt+B
+		s.pos = s.wordStart()
+		return ""
+	case 'f': // Alt+F
+		s.pos = s.wordEnd()
+		return ""
+	case 'd': // Alt+D
+		s.delete(s.pos, s.wordEnd())
+		return ""
+	case 8, 127: // Alt+Backspace
+		s.delete(s.wordStart(), s.pos)
+		return ""
+	case '[', 'O':
+	default:
+		return ""
+	}
+
+	// CSI sequences: parameters, then a final letter (or ~)
+	var sequence []rune
+	for {
+		c, _, err := e.reader.ReadRune()
+		if err != nil {
+			return ""
+		}
+		sequence = append(sequence, c)
+		if c >= 0x40 && c <= 0x7e {
+			break
+		}
+	}
+	if key := keys.Name([]byte("\033[" + string(sequence))); s.action(key) != "" {
+		return key
+	}
+	switch string(sequence) {
+	case "200~": // Start of pasted text
+		s.pasting = true
+	case "201~": // End of pasted text
+		s.pasting = false
+	case "A":
+		s.up()
+	case "B":
+		s.down()
+	case "C":
+		s.move(1)
+	case "D":
+		s.move(-1)
+	case "H", "1~", "7~":
+		s.pos = s.lineStart(s.pos)
+	case "F", "4~", "8~":
+		s.pos = s.lineEnd(s.pos)
+	case "3~": // Delete
+		s.deleteForward()
+	case "1;5C", "1;3C": // Ctrl+→, Alt+→
+		s.pos = s.wordEnd()
+	case "1;5D", "1;3D": // Ctrl+←, Alt+←
+		s.pos = s.wordStart()
+	}
+	return ""
+}
+
+// lineState is the text being edited, which may span several lines
+type lineState struct {
+	out         io.Writer
+	terminal    *os.File // Measured for where the line wraps
+	prompt      string
+	promptWidth int
+	buf         []rune
+	pos         int      // Cursor, as an index in buf
+	row         int      // Row the cursor was left on by the last refresh, counted from the prompt's
+	history     []string // Lines entered before, then the one being typed
+	index       int      // Line of history being edited
+	pasting     bool     // Between the marks terminals put around pasted text
+	regenerate  bool     // The regenerate key ends the message, when nothing is typed
+}
+
+func (s *lineState) insert(runes []rune) {
+	s.buf = append(s.buf[:s.pos], append(runes, s.buf[s.pos:]...)...)
+	s.pos += len(runes)
+}
+
+// delete removes the runes from start to end, leaving the cursor at start
+func (s *lineState) delete(start, end int) {
+	if start >= end {
+		return
+	}
+	s.buf = append(s.buf[:start], s.buf[end:]...)
+	s.pos = start
+}
+
+func (s *lineState) deleteForward() {
+	if s.pos < len(s.buf) {
+		s.delete(s.pos, s.pos+1)
+	}
+}
+
+func (s *lineState) move(by int) {
+	s.pos = max(0, min(len(s.buf), s.pos+by))
+}
+
+// wordStart returns where the word before the cursor starts
+func (s *lineState) wordStart() int {
+	i := s.pos
+	for i > 0 && unicode.IsSpace(s.buf[i-1]) {
+		i--
+	}
+	for i > 0 && !unicode.IsSpace(s.buf[i-1]) {
+		i--
+	}
+	return i
+}
+
+// wordEnd returns where the word after the cursor ends
+func (s *lineState) wordEnd() int {
+	i := s.pos
+	for i < len(s.buf) && unicode.IsSpace(s.buf[i]) {
+		i++
+	}
+	for i < len(s.buf) && !unicode.IsSpace(s.buf[i]) {
+		i++
+	}
+	return i
+}
+
+// lineStart returns where the line with the rune at i starts
+func (s *lineState) lineStart(i int) int {
+	for i > 0 && s.buf[i-1] != '\n' {
+		i--
+	}
+	return i
+}
+
+// lineEnd returns where the line with the rune at i ends, before its line break
+func (s *lineState) lineEnd(i int) int {
+	for i < len(s.buf) && s.buf[i] != '\n' {
+		i++
+	}
+	return i
+}
+
+// up moves the cursor to the line above, or recalls the line entered before from the first line
+func (s *lineState) up() {
+	start := s.lineStart(s.pos)
+	if start == 0 {
+		s.recall(-1)
+		return
+	}
+	above := s.lineStart(start - 1)
+	s.pos = min(above+s.pos-start, start-1)
+}
+
+// down moves the cursor to the line below, or recalls the line entered after from the last line
+func (s *lineState) down() {
+	end := s.lineEnd(s.pos)
+	if end == len(s.buf) {
+		s.recall(1)
+		return
+	}
+	s.pos = min(end+1+s.pos-s.lineStart(s.pos), s.lineEnd(end+1))
+}
+
+// recall replaces the text with an earlier or later one from the history. Edits to recalled
+// lines are kept until the line is entered, like in shells
+func (s *lineState) recall(by int) {
+	index := s.index + by
+	if index < 0 || index >= len(s.history) {
+		return
+	}
+	s.history[s.index] = string(s.buf)
+	s.index = index
+	s.buf = []rune(s.history[index])
+	s.pos = len(s.buf)
+}
+
+// inBlock reports whether the text started with a line of BlockDelimiter
+func (s *lineState) inBlock() bool {
+	first, _, _ := strings.Cut(string(s.buf), "\n")
+	return strings.TrimSpace(first) == BlockDelimiter
+}
+
+// blockClosed reports whether the cursor is at the end of a block's closing delimiter
+func (s *lineState) blockClosed() bool {
+	start := s.lineStart(s.pos)
+	return start > 0 && s.pos == len(s.buf) && strings.TrimSpace(string(s.buf[start:])) == BlockDelimiter
+}
+
+// text returns the text entered, without the lines of a block's delimiters
+func (s *lineState) text() string {
+	text := string(s.buf)
+	if !s.inBlock() {
+		return text
+	}
+	lines := strings.Split(text, "\n")[1:]
+	if len(lines) > 0 && strings.TrimSpace(lines[len(lines)-1]) == BlockDelimiter {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// position returns the row and column the text up to i ends at, counted from the start of the
+// prompt. Lines after the first are indented like the first, after the prompt
+func (s *lineState) position(i, width int) (int, int) {
+	row, column := 0, s.promptWidth
+	for _, r := range s.buf[:i] {
+		if r == '\n' {
+			row, column = row+1, s.promptWidth
+			continue
+		}
+		w := runewidth.RuneWidth(r)
+		if column+w > width {
+			row, column = row+1, 0
+		}
+		column += w
+	}
+	return row, column
+}
+
+// refresh draws the prompt and the text again, which may wrap over several rows, and puts the
+// cursor in place
+func (s *lineState) refresh() {
+	width := 80
+	if s.terminal != nil {
+		width = Width(s.terminal)
+	}
+	var b strings.Builder
+	if s.row > 0 {
+		fmt.Fprintf(&b, "\033[%dA", s.row)
+	}
+	b.WriteString("\r\033[J")
+	b.WriteString(s.prompt)
+	b.WriteString(strings.ReplaceAll(string(s.buf), "\n", "\r\n"+strings.Repeat(" ", s.promptWidth)))
+
+	endRow, endColumn := s.position(len(s.buf), width)
+	if endColumn >= width {
+		// Terminals wait for the next character to move to a new row, so move there now
+		b.WriteString("\r\n")
+		endRow++
+	}
+	row, column := s.position(s.pos, width)
+	if column >= width {
+		row, column = row+1, 0
+	}
+	if up := endRow - row; up > 0 {
+		fmt.Fprintf(&b, "\033[%dA", up)
+	}
+	b.WriteString("\r")
+	if column > 0 {
+		fmt.Fprintf(&b, "\033[%dC", column)
+	}
+	s.row = row
+	io.WriteString(s.out, b.String())
+}
+
+// finish leaves the cursor on a new row after the text
+func (s *lineState) finish() {
+	s.pos = len(s.buf)
+	s.refresh()
+	io.WriteString(s.out, "\r\n")
+}
+
+// escapeSequence matches the escape sequences of colors in prompts
+var escapeSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// displayWidth returns the number of columns text takes on a terminal
+func displayWidth(text string) int {
+	return runewidth.StringWidth(escapeSequence.ReplaceAllString(text, ""))
+}
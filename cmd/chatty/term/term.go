@@ -0,0 +1,100 @@
+// Package term switches the terminal into raw mode, for menus that read a key at a time and the
+// line editor of interactive chats, and turns on escape sequences for colors where consoles need
+// it. golang.org/x/term does the work on each platform, with what only Windows consoles need to
+// be told in term_windows.go
+package term
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrInterrupted is returned by ReadHidden when Ctrl+C or Ctrl+D is pressed
+var ErrInterrupted = errors.New("interrupted")
+
+// MakeRaw puts the terminal f reads from into raw mode, where keys arrive as they are pressed
+// without being echoed, and returns a function restoring the mode it was in
+func MakeRaw(f *os.File) (func(), error) {
+	return makeRaw(f)
+}
+
+func makeRaw(f *os.File) (func(), error) {
+	fd := int(f.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	enableVirtualInput(f)
+	return func() { term.Restore(fd, state) }, nil
+}
+
+// IsTerminal reports whether f is a terminal, rather than a pipe, a file or a device like
+// /dev/null
+func IsTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+func size(f *os.File) (int, int, error) {
+	return term.GetSize(int(f.Fd()))
+}
+
+// EnableANSI lets the console interpret ANSI escape sequences for colors and cursor movement,
+// which only Windows consoles need to be told. It reports whether they are interpreted
+func EnableANSI() bool {
+	return enableANSI()
+}
+
+// Width returns the number of columns of the terminal f writes to, 80 when it can't be told
+func Width(f *os.File) int {
+	if columns, _, err := size(f); err == nil && columns > 0 {
+		return columns
+	}
+	return 80
+}
+
+// Height returns the number of rows of the terminal f writes to, 0 when it can't be told
+func Height(f *os.File) int {
+	if _, rows, err := size(f); err == nil && rows > 0 {
+		return rows
+	}
+	return 0
+}
+
+// ReadHidden reads a line from f without echoing it, for passwords and tokens. Input that isn't
+// a terminal is read as it comes
+func ReadHidden(f *os.File) (string, error) {
+	restore, err := makeRaw(f)
+	if err != nil {
+		line, err := bufio.NewReader(f).ReadString('\n')
+		if err != nil && !(errors.Is(err, io.EOF) && line != "") {
+			return "", err
+		}
+		return strings.TrimRight(line, "\r\n"), nil
+	}
+	defer restore()
+
+	var line []byte
+	key := make([]byte, 1)
+	for {
+		if _, err := f.Read(key); err != nil {
+			return "", err
+		}
+		switch key[0] {
+		case '\r', '\n':
+			return string(line), nil
+		case 3, 4: // Ctrl+C, Ctrl+D
+			return "", ErrInterrupted
+		case 8, 127: // Backspace
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+			}
+		default:
+			line = append(line, key[0])
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build !windows
+
+package term
+
+import "os"
+
+// Terminals send keys as escape sequences and interpret them for colors without being told
+func enableVirtualInput(f *os.File) {}
+
+func enableANSI() bool {
+	return true
+}
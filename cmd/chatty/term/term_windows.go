@@ -0,0 +1,29 @@
+package term
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// enableVirtualInput has the console send keys like the arrows as the same escape sequences as
+// terminals elsewhere, once f is in raw mode
+func enableVirtualInput(f *os.File) {
+	handle := windows.Handle(f.Fd())
+	var mode uint32
+	if windows.GetConsoleMode(handle, &mode) == nil {
+		windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_INPUT)
+	}
+}
+
+func enableANSI() bool {
+	handle := windows.Handle(os.Stdout.Fd())
+	var mode uint32
+	if err := windows.GetConsoleMode(handle, &mode); err != nil {
+		return true // Redirected to a file or a pipe, which take the sequences as they are
+	}
+	if mode&windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING != 0 {
+		return true
+	}
+	return windows.SetConsoleMode(handle, mode|windows.ENABLE_VIRTUAL_TERMINAL_PROCESSING) == nil
+}
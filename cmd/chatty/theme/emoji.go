@@ -0,0 +1,83 @@
+package theme
+
+import (
+	"os"
+	"runtime"
+	"strings"
+	"unicode"
+)
+
+// maxBadgeLength is the number of letters kept in an emoji-free badge
+const maxBadgeLength = 4
+
+var emojiEnabled = detectEmojiSupport()
+
+// detectEmojiSupport guesses whether the terminal can render emojis
+func detectEmojiSupport() bool {
+	if os.Getenv("CHATTY_NO_EMOJI") != "" {
+		return false
+	}
+
+	// The Linux virtual console and dumb terminals have no emoji glyphs
+	switch os.Getenv("TERM") {
+	case "linux", "dumb":
+		return false
+	}
+
+	// The legacy Windows console cannot render emojis, Windows Terminal can
+	if runtime.GOOS == "windows" && os.Getenv("WT_SESSION") == "" {
+		return false
+	}
+
+	// An explicit non UTF-8 locale cannot encode emojis
+	for _, name := range []string{"LC_ALL", "LC_CTYPE", "LANG"} {
+		if locale := os.Getenv(name); locale != "" {
+			locale = strings.ToLower(locale)
+			return strings.Contains(locale, "utf-8") || strings.Contains(locale, "utf8")
+		}
+	}
+
+	return true
+}
+
+// SetEmoji enables or disables emoji rendering
+func SetEmoji(enabled bool) {
+	mutex.Lock()
+	emojiEnabled = enabled
+	mutex.Unlock()
+}
+
+// EmojiEnabled reports whether emojis should be printed
+func EmojiEnabled() bool {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return emojiEnabled
+}
+
+// Badge returns the bracketed short code used in place of an emoji (e.g. "Ada" -> "[ADA]")
+func Badge(name string) string {
+	var code []rune
+	for _, r := range strings.TrimSpace(name) {
+		if unicode.IsSpace(r) {
+			break
+		}
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			code = append(code, unicode.ToUpper(r))
+		}
+		if len(code) == maxBadgeLength {
+			break
+		}
+	}
+	if len(code) == 0 {
+		return "[?]"
+	}
+	return "[" + string(code) + "]"
+}
+
+// AgentEmoji returns the emoji for a name, or its badge when emojis are disabled
+func AgentEmoji(emoji, name string) string {
+	if !EmojiEnabled() || emoji == "" {
+		return Badge(name)
+	}
+	return emoji
+}
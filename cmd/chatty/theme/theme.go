@@ -0,0 +1,209 @@
+package theme
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// DefaultTheme is used when config.json does not select a theme
+const DefaultTheme = "dark"
+
+// Theme holds the ANSI color codes for every semantic role used in the UI
+type Theme struct {
+	Name string
+
+	// General purpose roles
+	Heading  string // Page headers (e.g. "🤖 Available Agents")
+	Section  string // Section headers and separators
+	Label    string // Command and field labels
+	Value    string // Values, paths and agent names in commands
+	Success  string // Checkmarks and success messages
+	Emphasis string // Highlighted names and warnings
+	Error    string // Error messages
+	Text     string // Regular emphasized text
+	Muted    string // Hints and secondary information
+	User     string // User messages in conversations
+
+	// Builder roles
+	Title     string // Builder titles
+	Subtitle  string // Builder section headers
+	Highlight string // Selected menu items and current markers
+	Prompt    string // Input prompts
+	Bright    string // Field values shown to the user
+	Accent    string // Spinners, debug output and notices
+
+	// Syntax highlighting roles
+	Keyword string
+	String  string
+	Number  string
+	Comment string
+	Type    string
+	Code    string
+	Fence   string
+
+	// AgentText overrides agents' own text colors when set (for readability on light backgrounds)
+	AgentText string
+
+	// NoColor disables all colors, including the agents' own label and text colors
+	NoColor bool
+
+	Reset string
+}
+
+var themes = map[string]Theme{
+	"dark": {
+		Name:      "dark",
+		Heading:   "\033[1;35m",
+		Section:   "\033[1;36m",
+		Label:     "\033[1;95m",
+		Value:     "\033[1;34m",
+		Success:   "\033[32m",
+		Emphasis:  "\033[1;33m",
+		Error:     "\033[1;31m",
+		Text:      "\033[1;37m",
+		Muted:     "\033[1;30m",
+		User:      "\033[1;36m",
+		Title:     "\033[38;5;39m",
+		Subtitle:  "\033[38;5;171m",
+		Highlight: "\033[38;5;82m",
+		Prompt:    "\033[38;5;251m",
+		Bright:    "\033[38;5;255m",
+		Accent:    "\033[38;5;208m",
+		Keyword:   "\033[38;5;204m",
+		String:    "\033[38;5;114m",
+		Number:    "\033[38;5;215m",
+		Comment:   "\033[38;5;244m",
+		Type:      "\033[38;5;80m",
+		Code:      "\033[38;5;252m",
+		Fence:     "\033[38;5;240m",
+		Reset:     "\033[0m",
+	},
+	"light": {
+		Name:      "light",
+		Heading:   "\033[38;5;90m",
+		Section:   "\033[38;5;24m",
+		Label:     "\033[38;5;127m",
+		Value:     "\033[38;5;25m",
+		Success:   "\033[38;5;28m",
+		Emphasis:  "\033[38;5;130m",
+		Error:     "\033[38;5;160m",
+		Text:      "\033[38;5;235m",
+		Muted:     "\033[38;5;244m",
+		User:      "\033[38;5;24m",
+		Title:     "\033[38;5;25m",
+		Subtitle:  "\033[38;5;91m",
+		Highlight: "\033[38;5;28m",
+		Prompt:    "\033[38;5;238m",
+		Bright:    "\033[38;5;232m",
+		Accent:    "\033[38;5;166m",
+		Keyword:   "\033[38;5;125m",
+		String:    "\033[38;5;28m",
+		Number:    "\033[38;5;130m",
+		Comment:   "\033[38;5;245m",
+		Type:      "\033[38;5;30m",
+		Code:      "\033[38;5;235m",
+		Fence:     "\033[38;5;247m",
+		AgentText: "\033[38;5;235m",
+		Reset:     "\033[0m",
+	},
+	"solarized": {
+		Name:      "solarized",
+		Heading:   "\033[38;5;125m",
+		Section:   "\033[38;5;37m",
+		Label:     "\033[38;5;61m",
+		Value:     "\033[38;5;33m",
+		Success:   "\033[38;5;64m",
+		Emphasis:  "\033[38;5;136m",
+		Error:     "\033[38;5;160m",
+		Text:      "\033[38;5;245m",
+		Muted:     "\033[38;5;240m",
+		User:      "\033[38;5;37m",
+		Title:     "\033[38;5;33m",
+		Subtitle:  "\033[38;5;61m",
+		Highlight: "\033[38;5;64m",
+		Prompt:    "\033[38;5;244m",
+		Bright:    "\033[38;5;254m",
+		Accent:    "\033[38;5;166m",
+		Keyword:   "\033[38;5;64m",
+		String:    "\033[38;5;37m",
+		Number:    "\033[38;5;125m",
+		Comment:   "\033[38;5;240m",
+		Type:      "\033[38;5;136m",
+		Code:      "\033[38;5;244m",
+		Fence:     "\033[38;5;240m",
+		Reset:     "\033[0m",
+	},
+	"mono": {
+		Name:    "mono",
+		NoColor: true,
+	},
+}
+
+var (
+	current = themes[DefaultTheme]
+	mutex   sync.RWMutex
+)
+
+// Set activates the named theme
+func Set(name string) error {
+	if name == "" {
+		name = DefaultTheme
+	}
+
+	t, ok := themes[strings.ToLower(name)]
+	if !ok {
+		return fmt.Errorf("unknown theme '%s' (available: %s)", name, strings.Join(Names(), ", "))
+	}
+
+	mutex.Lock()
+	current = t
+	mutex.Unlock()
+	return nil
+}
+
+// Current returns the active theme
+func Current() Theme {
+	mutex.RLock()
+	defer mutex.RUnlock()
+	return current
+}
+
+// Names returns the available theme names in alphabetical order
+func Names() []string {
+	names := make([]string, 0, len(themes))
+	for name := range themes {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Init selects the configured theme, honoring the NO_COLOR convention
+func Init(name string) error {
+	if os.Getenv("NO_COLOR") != "" {
+		return Set("mono")
+	}
+	return Set(name)
+}
+
+// AgentColor returns an agent's own label color, or nothing when colors are disabled
+func (t Theme) AgentColor(color string) string {
+	if t.NoColor {
+		return ""
+	}
+	return color
+}
+
+// AgentTextColor returns the color for an agent's message text
+func (t Theme) AgentTextColor(color string) string {
+	if t.NoColor {
+		return ""
+	}
+	if t.AgentText != "" {
+		return t.AgentText
+	}
+	return color
+}
@@ -0,0 +1,110 @@
+// Package tokens estimates how much of a model's context text takes up, so conversations can be
+// trimmed to what fits
+package tokens
+
+import (
+	"sync"
+	"unicode"
+)
+
+const (
+	minRatio  = 0.5 // Reported counts further off than this from the estimate are ignored,
+	maxRatio  = 2.0 // like those of prompts the model had partly cached
+	smoothing = 0.3 // Weight of the latest report in a model's correction
+)
+
+// Estimate returns roughly how many tokens text is for the byte-pair tokenizers of current
+// models: about one per short word, one per three digits, one per punctuation mark or line
+// break, and one or more per CJK character or symbol
+func Estimate(text string) int {
+	count := 0
+	runes := []rune(text)
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case isCJK(r):
+			count++
+			i++
+		case unicode.IsLetter(r) || unicode.IsMark(r):
+			start, ascii := i, true
+			for i < len(runes) && !isCJK(runes[i]) && (unicode.IsLetter(runes[i]) || unicode.IsMark(runes[i])) {
+				ascii = ascii && runes[i] < unicode.MaxASCII
+				i++
+			}
+			if ascii {
+				count += (i - start + 5) / 6
+			} else {
+				count += (i - start + 2) / 3
+			}
+		case unicode.IsDigit(r):
+			start := i
+			for i < len(runes) && unicode.IsDigit(runes[i]) {
+				i++
+			}
+			count += (i - start + 2) / 3
+		case r == ' ' || r == '\t':
+			// A single space goes with the next word, indentation takes a token per few spaces
+			start := i
+			for i < len(runes) && (runes[i] == ' ' || runes[i] == '\t') {
+				i++
+			}
+			count += (i - start - 1 + 3) / 4
+		case unicode.IsSpace(r):
+			for i < len(runes) && unicode.IsSpace(runes[i]) && runes[i] != ' ' && runes[i] != '\t' {
+				i++
+			}
+			count++
+		case r > 0x2000:
+			count += 2 // Emojis and symbols span several bytes, which tokenizers rarely merge
+			i++
+		default:
+			count++
+			i++
+		}
+	}
+	return count
+}
+
+// isCJK reports whether r is a Chinese, Japanese or Korean character, which tokenizers mostly
+// give a token of their own
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
+
+// Counter corrects estimates for each model with the prompt sizes the model reports, as
+// tokenizers differ between models
+type Counter struct {
+	mu     sync.Mutex
+	ratios map[string]float64 // Reported tokens per estimated token, by model
+}
+
+// Adjust returns an estimate corrected for the model
+func (c *Counter) Adjust(model string, estimate int) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if ratio, ok := c.ratios[model]; ok {
+		return int(float64(estimate)*ratio + 0.5)
+	}
+	return estimate
+}
+
+// Observe records how many tokens the model counted in a prompt that was estimated at estimate
+func (c *Counter) Observe(model string, estimate, reported int) {
+	if estimate <= 0 || reported <= 0 {
+		return
+	}
+	ratio := float64(reported) / float64(estimate)
+	if ratio < minRatio || ratio > maxRatio {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.ratios == nil {
+		c.ratios = make(map[string]float64)
+	}
+	if previous, ok := c.ratios[model]; ok {
+		ratio = previous*(1-smoothing) + ratio*smoothing
+	}
+	c.ratios[model] = ratio
+}
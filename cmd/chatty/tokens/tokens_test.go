@@ -0,0 +1,81 @@
+package tokens
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEstimate(t *testing.T) {
+	tests := []struct {
+		text string
+		want int
+	}{
+		{"", 0},
+		{"hello", 1},
+		{"Hello world", 2},
+		{"internationalization", 4},
+		{"a, b.", 4},
+		{"12345", 2},
+		{"3.14", 3},
+		{"héllo", 2},
+		{"привет", 2},
+		{"你好世界", 4},
+		{"日本語テキスト", 7},
+		{"hello你好", 3},
+		{"😀", 2},
+		{"→", 2},
+		{"a\nb", 3},
+		{"a\r\n\r\nb", 3},
+		{"        x", 3},
+		{"\tx", 1},
+		{"x y", 2},
+	}
+	for _, tt := range tests {
+		if got := Estimate(tt.text); got != tt.want {
+			t.Errorf("Estimate(%q) = %d, want %d", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateGrows(t *testing.T) {
+	// Trimming relies on longer text never counting for less
+	for _, text := range []string{"word ", "12 ", "你", "😀", "\n", "  "} {
+		previous := 0
+		for n := 1; n <= 50; n++ {
+			got := Estimate(strings.Repeat(text, n))
+			if got < previous {
+				t.Errorf("Estimate of %d × %q = %d, less than %d for one fewer", n, text, got, previous)
+			}
+			previous = got
+		}
+	}
+}
+
+func TestCounter(t *testing.T) {
+	var c Counter
+	if got := c.Adjust("llama", 100); got != 100 {
+		t.Errorf("Adjust before any report = %d, want 100", got)
+	}
+
+	c.Observe("llama", 100, 150)
+	if got := c.Adjust("llama", 100); got != 150 {
+		t.Errorf("Adjust after a report of 1.5× = %d, want 150", got)
+	}
+	if got := c.Adjust("qwen", 100); got != 100 {
+		t.Errorf("Adjust for another model = %d, want 100", got)
+	}
+
+	c.Observe("llama", 100, 100)
+	if got := c.Adjust("llama", 100); got != 135 {
+		t.Errorf("Adjust after reports of 1.5× and 1× = %d, want 135", got)
+	}
+
+	// Reports far off the estimate, or without counts, are ignored
+	for _, reported := range []int{10, 1000, 0, -5} {
+		c.Observe("llama", 100, reported)
+	}
+	c.Observe("llama", 0, 100)
+	if got := c.Adjust("llama", 100); got != 135 {
+		t.Errorf("Adjust after ignored reports = %d, want 135", got)
+	}
+}
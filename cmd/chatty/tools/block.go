@@ -0,0 +1,58 @@
+package tools
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	blockResultLines = 6   // Lines of a result shown in a tool block
+	blockLineLength  = 160 // Characters of each line shown in a tool block
+)
+
+// FormatCall renders the opening of a tool block: the tool's name and one line per argument
+func FormatCall(call Call) string {
+	var sb strings.Builder
+	sb.WriteString("┌─ 🔧 " + call.Function.Name + "\n")
+
+	names := make([]string, 0, len(call.Function.Arguments))
+	for name := range call.Function.Arguments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		sb.WriteString("│ " + name + ": " + shorten(formatValue(call.Function.Arguments[name])) + "\n")
+	}
+	return sb.String()
+}
+
+// FormatResult renders the end of a tool block: the first lines of the result and how much was left out
+func FormatResult(result string) string {
+	var sb strings.Builder
+	sb.WriteString("├─ result\n")
+
+	lines := strings.Split(strings.TrimRight(result, "\n"), "\n")
+	shown := lines
+	if len(shown) > blockResultLines {
+		shown = shown[:blockResultLines]
+	}
+	for _, line := range shown {
+		sb.WriteString("│ " + shorten(line) + "\n")
+	}
+	if hidden := len(lines) - len(shown); hidden > 0 {
+		sb.WriteString(fmt.Sprintf("└─ %d more lines\n", hidden))
+	} else {
+		sb.WriteString("└─\n")
+	}
+	return sb.String()
+}
+
+// shorten cuts a line to blockLineLength characters
+func shorten(line string) string {
+	line = strings.TrimRight(line, "\r")
+	if runes := []rune(line); len(runes) > blockLineLength {
+		return string(runes[:blockLineLength]) + "…"
+	}
+	return line
+}
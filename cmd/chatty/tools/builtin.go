@@ -0,0 +1,54 @@
+package tools
+
+import (
+	"fmt"
+	"time"
+
+	"chatty/cmd/chatty/attach"
+)
+
+func init() {
+	Register(Tool{
+		Name:        "time",
+		Description: "Get the current date and time, optionally in another time zone",
+		Parameters: map[string]Property{
+			"timezone": {Type: "string", Description: "IANA time zone such as Europe/Paris (default: the user's local time)"},
+		},
+		Run: currentTime,
+	})
+	Register(Tool{
+		Name:        "http_get",
+		Description: "Fetch a web page or text document and return its readable text",
+		Parameters: map[string]Property{
+			"url": {Type: "string", Description: "http or https URL to fetch"},
+		},
+		Required: []string{"url"},
+		Run:      httpGet,
+	})
+}
+
+// currentTime returns the current date and time
+func currentTime(args Arguments) (string, error) {
+	now := time.Now()
+	if name := args.String("timezone"); name != "" {
+		location, err := time.LoadLocation(name)
+		if err != nil {
+			return "", fmt.Errorf("unknown time zone '%s'", name)
+		}
+		now = now.In(location)
+	}
+	return now.Format("Monday, 2 January 2006 15:04:05 MST (UTC-07:00)"), nil
+}
+
+// httpGet returns the readable text of a web page
+func httpGet(args Arguments) (string, error) {
+	doc, err := attach.FetchURL(args.String("url"))
+	if err != nil {
+		return "", err
+	}
+	addSource(Source{Title: doc.Title, URL: doc.Source})
+	if doc.Title != "" {
+		return doc.Title + "\n\n" + doc.Text, nil
+	}
+	return doc.Text, nil
+}
@@ -0,0 +1,239 @@
+package tools
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+func init() {
+	Register(Tool{
+		Name:        "calculator",
+		Description: "Evaluate an arithmetic expression exactly, e.g. (1250 * 1.07) ^ 3 / 12 or sqrt(2) * pi. Supports + - * / % ^, parentheses, pi, e and the functions sqrt, abs, round, floor, ceil, exp, ln, log, sin, cos and tan",
+		Parameters: map[string]Property{
+			"expression": {Type: "string", Description: "Expression to evaluate"},
+		},
+		Required: []string{"expression"},
+		Run: func(args Arguments) (string, error) {
+			value, err := Evaluate(args.String("expression"))
+			if err != nil {
+				return "", err
+			}
+			return strconv.FormatFloat(value, 'g', 15, 64), nil
+		},
+	})
+}
+
+var (
+	constants = map[string]float64{"pi": math.Pi, "e": math.E}
+	functions = map[string]func(float64) float64{
+		"sqrt": math.Sqrt, "abs": math.Abs, "round": math.Round, "floor": math.Floor, "ceil": math.Ceil,
+		"exp": math.Exp, "ln": math.Log, "log": math.Log10, "sin": math.Sin, "cos": math.Cos, "tan": math.Tan,
+	}
+)
+
+// Evaluate computes the value of an arithmetic expression
+func Evaluate(expression string) (float64, error) {
+	p := &parser{input: strings.ReplaceAll(expression, "**", "^")}
+	value, err := p.expression()
+	if err != nil {
+		return 0, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return 0, fmt.Errorf("unexpected '%s' at position %d", p.input[p.pos:], p.pos+1)
+	}
+	if math.IsNaN(value) || math.IsInf(value, 0) {
+		return 0, fmt.Errorf("the result is not a finite number")
+	}
+	return value, nil
+}
+
+// parser is a recursive descent parser over an expression, evaluating as it goes
+type parser struct {
+	input string
+	pos   int
+}
+
+func (p *parser) skipSpaces() {
+	for p.pos < len(p.input) && unicode.IsSpace(rune(p.input[p.pos])) {
+		p.pos++
+	}
+}
+
+// next returns the next significant character, or 0 at the end
+func (p *parser) next() byte {
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return p.input[p.pos]
+	}
+	return 0
+}
+
+// expression = term { ("+" | "-") term }
+func (p *parser) expression() (float64, error) {
+	value, err := p.term()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		switch p.next() {
+		case '+':
+			p.pos++
+			right, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			value += right
+		case '-':
+			p.pos++
+			right, err := p.term()
+			if err != nil {
+				return 0, err
+			}
+			value -= right
+		default:
+			return value, nil
+		}
+	}
+}
+
+// term = unary { ("*" | "/" | "%") unary }
+func (p *parser) term() (float64, error) {
+	value, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	for {
+		op := p.next()
+		if op != '*' && op != '/' && op != '%' {
+			return value, nil
+		}
+		p.pos++
+		right, err := p.unary()
+		if err != nil {
+			return 0, err
+		}
+		switch op {
+		case '*':
+			value *= right
+		case '/':
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			value /= right
+		case '%':
+			if right == 0 {
+				return 0, fmt.Errorf("division by zero")
+			}
+			value = math.Mod(value, right)
+		}
+	}
+}
+
+// unary = ("-" | "+") unary | power
+func (p *parser) unary() (float64, error) {
+	switch p.next() {
+	case '-':
+		p.pos++
+		value, err := p.unary()
+		return -value, err
+	case '+':
+		p.pos++
+		return p.unary()
+	}
+	return p.power()
+}
+
+// power = primary [ "^" unary ], right associative so 2^3^2 is 2^9
+func (p *parser) power() (float64, error) {
+	base, err := p.primary()
+	if err != nil {
+		return 0, err
+	}
+	if p.next() != '^' {
+		return base, nil
+	}
+	p.pos++
+	exponent, err := p.unary()
+	if err != nil {
+		return 0, err
+	}
+	return math.Pow(base, exponent), nil
+}
+
+// primary = number | constant | function "(" expression ")" | "(" expression ")"
+func (p *parser) primary() (float64, error) {
+	c := p.next()
+	switch {
+	case c == '(':
+		p.pos++
+		value, err := p.expression()
+		if err != nil {
+			return 0, err
+		}
+		if p.next() != ')' {
+			return 0, fmt.Errorf("missing closing parenthesis")
+		}
+		p.pos++
+		return value, nil
+	case c >= '0' && c <= '9' || c == '.':
+		start := p.pos
+		for p.pos < len(p.input) && (p.input[p.pos] >= '0' && p.input[p.pos] <= '9' || p.input[p.pos] == '.' || p.input[p.pos] == '_') {
+			p.pos++
+		}
+		// Scientific notation like 1e-3
+		if p.pos < len(p.input) && (p.input[p.pos] == 'e' || p.input[p.pos] == 'E') {
+			end := p.pos + 1
+			if end < len(p.input) && (p.input[end] == '-' || p.input[end] == '+') {
+				end++
+			}
+			if end < len(p.input) && p.input[end] >= '0' && p.input[end] <= '9' {
+				for end < len(p.input) && p.input[end] >= '0' && p.input[end] <= '9' {
+					end++
+				}
+				p.pos = end
+			}
+		}
+		text := strings.ReplaceAll(p.input[start:p.pos], "_", "")
+		value, err := strconv.ParseFloat(text, 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid number '%s'", text)
+		}
+		return value, nil
+	case unicode.IsLetter(p.nextRune()):
+		start := p.pos
+		for p.pos < len(p.input) && unicode.IsLetter(p.nextRune()) {
+			_, size := utf8.DecodeRuneInString(p.input[p.pos:])
+			p.pos += size
+		}
+		name := strings.ToLower(p.input[start:p.pos])
+		if value, ok := constants[name]; ok {
+			return value, nil
+		}
+		function, ok := functions[name]
+		if !ok {
+			return 0, fmt.Errorf("unknown name '%s'", name)
+		}
+		if p.next() != '(' {
+			return 0, fmt.Errorf("%s needs its argument in parentheses", name)
+		}
+		value, err := p.primary()
+		if err != nil {
+			return 0, err
+		}
+		return function(value), nil
+	case c == 0:
+		return 0, fmt.Errorf("unexpected end of expression")
+	}
+	return 0, fmt.Errorf("unexpected '%c' at position %d", p.nextRune(), p.pos+1)
+}
+
+// nextRune returns the character at the current position, which may take several bytes
+func (p *parser) nextRune() rune {
+	r, _ := utf8.DecodeRuneInString(p.input[p.pos:])
+	return r
+}
@@ -0,0 +1,117 @@
+package tools
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestEvaluate(t *testing.T) {
+	tests := []struct {
+		expression string
+		want       float64
+	}{
+		{"1 + 2 * 3", 7},
+		{"(1 + 2) * 3", 9},
+		{"10 - 4 - 3", 3},
+		{"100 / 10 / 5", 2},
+		{"7 % 4 * 2", 6},
+		{"2 + 3 ^ 2", 11},
+		{"2 * 3 ^ 2", 18},
+		{"2 ^ 3 ^ 2", 512},
+		{"2 ** 10", 1024},
+		{"-3", -3},
+		{"--3", 3},
+		{"+-3", -3},
+		{"-2 ^ 2", -4},
+		{"(-2) ^ 2", 4},
+		{"2 ^ -1", 0.5},
+		{"3 - -2", 5},
+		{"4 * -(1 + 1)", -8},
+		{"((2))", 2},
+		{"(1 + (2 * (3 + 4)))", 15},
+		{"1_000 * 1.5", 1500},
+		{"1e3 + 2.5E-1", 1000.25},
+		{".5 * 4", 2},
+		{"sqrt(16) + abs(-2)", 6},
+		{"round(2.5) + floor(1.9) + ceil(1.1)", 6},
+		{"log(1000)", 3},
+		{"ln(e)", 1},
+		{"2 * PI", 2 * math.Pi},
+		{"  1\t+\n1  ", 2},
+	}
+	for _, tt := range tests {
+		got, err := Evaluate(tt.expression)
+		if err != nil {
+			t.Errorf("Evaluate(%q) returned %v", tt.expression, err)
+			continue
+		}
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Evaluate(%q) = %v, want %v", tt.expression, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateErrors(t *testing.T) {
+	tests := []struct {
+		expression string
+		err        string
+	}{
+		{"1 / 0", "division by zero"},
+		{"1 / (2 - 2)", "division by zero"},
+		{"5 % 0", "division by zero"},
+		{"sqrt(-1)", "not a finite number"},
+		{"10 ^ 400", "not a finite number"},
+		{"", "unexpected end"},
+		{"   ", "unexpected end"},
+		{"1 +", "unexpected end"},
+		{"-", "unexpected end"},
+		{"(1 + 2", "missing closing parenthesis"},
+		{"1 + 2)", "unexpected ')'"},
+		{"()", "unexpected ')'"},
+		{"1 2", "unexpected '2'"},
+		{"2 * * 3", "unexpected '*'"},
+		{"1..2", "invalid number"},
+		{"x + 1", "unknown name 'x'"},
+		{"sqrt 4", "needs its argument in parentheses"},
+		{"sqrt", "needs its argument in parentheses"},
+		{"1 = 1", "unexpected '= 1'"},
+		{"2 ^", "unexpected end"},
+		{"é", "unknown name 'é'"},
+		{"2 × 3", "unexpected '× 3'"},
+		{"€5", "unexpected '€'"},
+	}
+	for _, tt := range tests {
+		got, err := Evaluate(tt.expression)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("Evaluate(%q) = %v, %v, want an error with %q", tt.expression, got, err, tt.err)
+		}
+	}
+}
+
+func TestEvaluateTruncated(t *testing.T) {
+	// Every prefix of an expression, as a model cut off mid-call would send, is an error or a
+	// value, never a panic
+	expression := "sqrt((1_250 * 1.07e-2) ^ -3 / 12) % round(-pi)"
+	for i := range expression {
+		Evaluate(expression[:i])
+	}
+}
+
+func TestCalculatorTool(t *testing.T) {
+	policy := Policy{"calculator": PermissionAllow}
+	tests := []struct {
+		expression string
+		want       string
+	}{
+		{"(1250 * 1.07) ^ 3 / 12", "199388509.114583"},
+		{"1 / 3", "0.333333333333333"},
+		{"1 / 0", "Error: division by zero"},
+	}
+	for _, tt := range tests {
+		call := Call{Function: CallFunction{Name: "calculator", Arguments: Arguments{"expression": tt.expression}}}
+		if got := Execute(call, policy); got != tt.want {
+			t.Errorf("calculator(%q) = %q, want %q", tt.expression, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,247 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"chatty/cmd/chatty/appdir"
+)
+
+const (
+	customDir            = "tools" // User-defined tools, one YAML file each
+	defaultCustomTimeout = time.Minute
+	maxCustomOutput      = 1 << 20
+)
+
+// CustomTool is a tool declared in ~/.chatty/tools/<name>.yaml that runs a local
+// program or calls an HTTP endpoint
+type CustomTool struct {
+	Name        string                     `yaml:"name"`
+	Description string                     `yaml:"description"`
+	Parameters  map[string]CustomParameter `yaml:"parameters,omitempty"`
+	Command     []string                   `yaml:"command,omitempty"` // Program and arguments, run without a shell
+	HTTP        *CustomHTTP                `yaml:"http,omitempty"`
+	Confirm     bool                       `yaml:"confirm,omitempty"` // Ask the user before every call
+	Timeout     string                     `yaml:"timeout,omitempty"` // Go duration, default 1m
+}
+
+// CustomParameter is an argument of a user-defined tool
+type CustomParameter struct {
+	Type        string   `yaml:"type,omitempty"` // string (default), number, integer or boolean
+	Description string   `yaml:"description"`
+	Required    bool     `yaml:"required,omitempty"`
+	Enum        []string `yaml:"enum,omitempty"`
+}
+
+// CustomHTTP is the endpoint a user-defined tool calls
+type CustomHTTP struct {
+	URL     string            `yaml:"url"`              // May contain {argument} placeholders
+	Method  string            `yaml:"method,omitempty"` // GET (default) or POST, which sends the arguments as JSON
+	Headers map[string]string `yaml:"headers,omitempty"`
+}
+
+// CustomDir returns the directory user-defined tools are loaded from
+func CustomDir() (string, error) {
+	configDir, err := appdir.ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(configDir, customDir), nil
+}
+
+// LoadCustom registers the user-defined tools in CustomDir. Files that can't be used
+// are skipped and reported in the returned errors
+func LoadCustom() []error {
+	dir, err := CustomDir()
+	if err != nil {
+		return []error{err}
+	}
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.yaml"))
+	more, _ := filepath.Glob(filepath.Join(dir, "*.yml"))
+	paths = append(paths, more...)
+	sort.Strings(paths)
+
+	var errs []error
+	for _, path := range paths {
+		tool, err := loadCustomTool(path)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("skipping tool %s: %v", filepath.Base(path), err))
+			continue
+		}
+		if _, exists := registry[tool.Name]; exists {
+			errs = append(errs, fmt.Errorf("skipping tool %s: '%s' is already a tool", filepath.Base(path), tool.Name))
+			continue
+		}
+		Register(tool)
+	}
+	return errs
+}
+
+// loadCustomTool reads and validates a tool declaration
+func loadCustomTool(path string) (Tool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Tool{}, err
+	}
+	var custom CustomTool
+	if err := yaml.Unmarshal(data, &custom); err != nil {
+		return Tool{}, fmt.Errorf("invalid YAML: %v", err)
+	}
+
+	switch {
+	case custom.Name == "":
+		return Tool{}, fmt.Errorf("name is required")
+	case strings.ContainsAny(custom.Name, " \t/"):
+		return Tool{}, fmt.Errorf("name '%s' must be a single word", custom.Name)
+	case custom.Description == "":
+		return Tool{}, fmt.Errorf("description is required")
+	case len(custom.Command) == 0 && custom.HTTP == nil:
+		return Tool{}, fmt.Errorf("either command or http is required")
+	case len(custom.Command) > 0 && custom.HTTP != nil:
+		return Tool{}, fmt.Errorf("command and http can't be used together")
+	case custom.HTTP != nil && custom.HTTP.URL == "":
+		return Tool{}, fmt.Errorf("http.url is required")
+	}
+	timeout := defaultCustomTimeout
+	if custom.Timeout != "" {
+		if timeout, err = time.ParseDuration(custom.Timeout); err != nil || timeout <= 0 {
+			return Tool{}, fmt.Errorf("invalid timeout '%s'", custom.Timeout)
+		}
+	}
+
+	tool := Tool{
+		Name:        custom.Name,
+		Description: custom.Description,
+		Parameters:  make(map[string]Property),
+	}
+	for name, parameter := range custom.Parameters {
+		kind := parameter.Type
+		if kind == "" {
+			kind = "string"
+		}
+		tool.Parameters[name] = Property{Type: kind, Description: parameter.Description, Enum: parameter.Enum}
+		if parameter.Required {
+			tool.Required = append(tool.Required, name)
+		}
+	}
+	sort.Strings(tool.Required)
+
+	if len(custom.Command) > 0 {
+		tool.Run = func(args Arguments) (string, error) {
+			return runCustomCommand(custom.Command, args, timeout)
+		}
+	} else {
+		tool.Run = func(args Arguments) (string, error) {
+			return callCustomHTTP(custom.HTTP, args, timeout)
+		}
+	}
+	if custom.Confirm {
+		tool.Confirm = func(args Arguments) string {
+			return "use " + Describe(Call{Function: CallFunction{Name: custom.Name, Arguments: args}})
+		}
+	}
+	return tool, nil
+}
+
+// expand replaces {argument} placeholders, escaping values with escape
+func expand(template string, args Arguments, escape func(string) string) string {
+	for name := range args {
+		template = strings.ReplaceAll(template, "{"+name+"}", escape(args.String(name)))
+	}
+	return template
+}
+
+// runCustomCommand runs a tool's program with the arguments substituted into its
+// command line, as CHATTY_ARG_<NAME> variables and as JSON on standard input
+func runCustomCommand(command []string, args Arguments, timeout time.Duration) (string, error) {
+	argv := make([]string, len(command))
+	for i, part := range command {
+		argv[i] = expand(part, args, func(s string) string { return s })
+	}
+	if strings.HasPrefix(argv[0], "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			argv[0] = filepath.Join(home, argv[0][2:])
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, argv[0], argv[1:]...)
+	input, _ := json.Marshal(args)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Env = os.Environ()
+	for name := range args {
+		cmd.Env = append(cmd.Env, "CHATTY_ARG_"+strings.ToUpper(name)+"="+args.String(name))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return "", fmt.Errorf("%s did not finish within %s", argv[0], timeout)
+		}
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return "", fmt.Errorf("%s failed: %s", argv[0], message)
+	}
+	return stdout.String(), nil
+}
+
+// callCustomHTTP calls a tool's endpoint and returns the response body
+func callCustomHTTP(endpoint *CustomHTTP, args Arguments, timeout time.Duration) (string, error) {
+	address := expand(endpoint.URL, args, url.QueryEscape)
+	method := strings.ToUpper(endpoint.Method)
+	if method == "" {
+		method = "GET"
+	}
+
+	var body io.Reader
+	if method == "POST" {
+		payload, err := json.Marshal(args)
+		if err != nil {
+			return "", fmt.Errorf("failed to encode arguments: %v", err)
+		}
+		body = bytes.NewReader(payload)
+	}
+	req, err := http.NewRequest(method, address, body)
+	if err != nil {
+		return "", fmt.Errorf("invalid request: %v", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	for name, value := range endpoint.Headers {
+		req.Header.Set(name, os.ExpandEnv(value))
+	}
+
+	client := &http.Client{Timeout: timeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("request failed: %v", err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxCustomOutput))
+	if err != nil {
+		return "", fmt.Errorf("failed to read the response: %v", err)
+	}
+	if resp.StatusCode >= 300 {
+		return "", fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return string(data), nil
+}
@@ -0,0 +1,156 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxReadSize = 1 << 20 // Largest file read_file will open
+
+// SandboxRoot is the directory read_file and write_file are confined to. Relative
+// paths are resolved against it; when empty, the working directory is used
+var SandboxRoot string
+
+func init() {
+	Register(Tool{
+		Name:        "read_file",
+		Description: "Read a text file in the user's working directory",
+		Parameters: map[string]Property{
+			"path": {Type: "string", Description: "Path of the file, relative to the working directory"},
+		},
+		Required: []string{"path"},
+		Run:      readFile,
+	})
+	Register(Tool{
+		Name:        "write_file",
+		Description: "Create or overwrite a text file in the user's working directory. The user is asked to approve every write",
+		Parameters: map[string]Property{
+			"path":    {Type: "string", Description: "Path of the file, relative to the working directory"},
+			"content": {Type: "string", Description: "Full content of the file"},
+			"mode":    {Type: "string", Description: "overwrite (default) or append", Enum: []string{"overwrite", "append"}},
+		},
+		Required: []string{"path"},
+		Run:      writeFile,
+		Confirm:  describeWrite,
+	})
+}
+
+// sandboxPath resolves a path inside the sandbox, rejecting anything that would leave it,
+// including through symbolic links
+func sandboxPath(path string) (string, error) {
+	root := SandboxRoot
+	if root == "" {
+		cwd, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to get working directory: %v", err)
+		}
+		root = cwd
+	}
+	root, err := filepath.Abs(root)
+	if err != nil {
+		return "", fmt.Errorf("invalid sandbox %s: %v", root, err)
+	}
+	if resolved, err := filepath.EvalSymlinks(root); err == nil {
+		root = resolved
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(root, path)
+	}
+	path = filepath.Clean(path)
+
+	// Resolve links in the part of the path that exists, so new files can be written
+	resolved := path
+	for dir, rest := path, ""; ; {
+		if real, err := filepath.EvalSymlinks(dir); err == nil {
+			resolved = filepath.Join(real, rest)
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		rest = filepath.Join(filepath.Base(dir), rest)
+		dir = parent
+	}
+
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside %s, the only directory tools may access", path, root)
+	}
+	return resolved, nil
+}
+
+// readFile returns the content of a text file
+func readFile(args Arguments) (string, error) {
+	path, err := sandboxPath(args.String("path"))
+	if err != nil {
+		return "", err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot access %s: %v", path, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > maxReadSize {
+		return "", fmt.Errorf("%s is larger than %d KB", path, maxReadSize>>10)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s: %v", path, err)
+	}
+	if !utf8.Valid(data) {
+		return "", fmt.Errorf("%s is not a text file", path)
+	}
+	return string(data), nil
+}
+
+// describeWrite tells the user what a write_file call is about to change
+func describeWrite(args Arguments) string {
+	path, err := sandboxPath(args.String("path"))
+	if err != nil {
+		return "" // Refused when it runs, no need to ask
+	}
+	size := len(args.String("content"))
+	if args.String("mode") == "append" {
+		return fmt.Sprintf("append %d bytes to %s", size, path)
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Sprintf("overwrite %s with %d bytes", path, size)
+	}
+	return fmt.Sprintf("create %s with %d bytes", path, size)
+}
+
+// writeFile creates, overwrites or appends to a text file
+func writeFile(args Arguments) (string, error) {
+	path, err := sandboxPath(args.String("path"))
+	if err != nil {
+		return "", err
+	}
+	content := args.String("content")
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %v", filepath.Dir(path), err)
+	}
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if args.String("mode") == "append" {
+		flags = os.O_CREATE | os.O_WRONLY | os.O_APPEND
+	}
+	file, err := os.OpenFile(path, flags, 0644)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %v", path, err)
+	}
+	if _, err := file.WriteString(content); err != nil {
+		file.Close()
+		return "", fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := file.Close(); err != nil {
+		return "", fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	return fmt.Sprintf("Wrote %d bytes to %s", len(content), path), nil
+}
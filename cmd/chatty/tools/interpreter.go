@@ -0,0 +1,187 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	interpreterTimeout = 2 * time.Minute // Long enough for a container image to be pulled on first use
+	maxCodeOutput      = 64 << 10
+)
+
+// Interpreter sandboxes
+const (
+	SandboxAuto      = "auto"      // A container when Docker or Podman is installed, otherwise a temporary directory
+	SandboxContainer = "container" // A container without network access, failing when no runtime is installed
+	SandboxLocal     = "local"     // A temporary directory on the user's machine, asking before every run
+)
+
+// language describes how to run a snippet in a temporary directory or a container
+type language struct {
+	file    string
+	local   [][]string // Commands tried in order until one is installed
+	image   string
+	command []string
+}
+
+var languages = map[string]language{
+	"python": {
+		file:    "main.py",
+		local:   [][]string{{"python3", "main.py"}, {"python", "main.py"}},
+		image:   "python:3-alpine",
+		command: []string{"python", "main.py"},
+	},
+	"go": {
+		file:    "main.go",
+		local:   [][]string{{"go", "run", "main.go"}},
+		image:   "golang:1-alpine",
+		command: []string{"go", "run", "main.go"},
+	},
+}
+
+// EnableInterpreter registers the run_code tool, which runs Python and Go snippets in the given sandbox
+func EnableInterpreter(sandbox string) error {
+	engine := ""
+	switch sandbox {
+	case SandboxAuto:
+		engine = containerRuntime()
+	case SandboxContainer:
+		if engine = containerRuntime(); engine == "" {
+			return fmt.Errorf("code_interpreter is set to %s but neither docker nor podman is installed", SandboxContainer)
+		}
+	case SandboxLocal:
+	default:
+		return fmt.Errorf("unknown code_interpreter '%s': use %s, %s or %s", sandbox, SandboxAuto, SandboxContainer, SandboxLocal)
+	}
+
+	isolation := "Each run starts in an empty directory without access to the user's files or the network"
+	if engine == "" {
+		isolation = "Each run starts in an empty temporary directory, and the user is asked to approve it"
+	}
+	tool := Tool{
+		Name:        "run_code",
+		Description: "Run a Python or Go program and return its exit status and output, to check code or compute results. " + isolation + ". Go code must be a complete main package",
+		Parameters: map[string]Property{
+			"language": {Type: "string", Description: "Programming language", Enum: []string{"python", "go"}},
+			"code":     {Type: "string", Description: "Source code of the program"},
+		},
+		Required: []string{"language", "code"},
+		Run: func(args Arguments) (string, error) {
+			return runCode(args.String("language"), args.String("code"), engine)
+		},
+	}
+	if engine == "" {
+		// Outside a container the code runs with the user's permissions
+		tool.Confirm = func(args Arguments) string {
+			code := strings.TrimRight(args.String("code"), "\n")
+			return "run this " + args.String("language") + " code:\n\n    " + strings.ReplaceAll(code, "\n", "\n    ") + "\n\n"
+		}
+	}
+	Register(tool)
+	return nil
+}
+
+// containerRuntime returns the first container runtime installed, or ""
+func containerRuntime() string {
+	for _, name := range []string{"docker", "podman"} {
+		if _, err := exec.LookPath(name); err == nil {
+			return name
+		}
+	}
+	return ""
+}
+
+// runCode writes a snippet to a fresh temporary directory and runs it there, inside a container
+// when a container engine is given
+func runCode(name, code, engine string) (string, error) {
+	lang, ok := languages[name]
+	if !ok {
+		return "", fmt.Errorf("unsupported language '%s': use python or go", name)
+	}
+
+	dir, err := os.MkdirTemp("", "chatty-code-")
+	if err != nil {
+		return "", fmt.Errorf("failed to create a working directory: %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.WriteFile(filepath.Join(dir, lang.file), []byte(code), 0644); err != nil {
+		return "", fmt.Errorf("failed to write the code: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), interpreterTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	container := ""
+	if engine != "" {
+		container = containerName()
+		argv := []string{"run", "--rm", "--name", container, "--network", "none",
+			"--memory", "512m", "--cpus", "1", "--pids-limit", "256",
+			"-v", dir + ":/work", "-w", "/work", lang.image}
+		cmd = exec.CommandContext(ctx, engine, append(argv, lang.command...)...)
+	} else {
+		argv := lang.local[0]
+		for _, candidate := range lang.local {
+			if _, err := exec.LookPath(candidate[0]); err == nil {
+				argv = candidate
+				break
+			}
+		}
+		cmd = exec.CommandContext(ctx, argv[0], argv[1:]...)
+		cmd.Dir = dir
+		cmd.Env = append(os.Environ(), "HOME="+dir, "TMPDIR="+dir)
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &limitedBuffer{buf: &stdout}
+	cmd.Stderr = &limitedBuffer{buf: &stderr}
+
+	err = cmd.Run()
+	status := 0
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		if container != "" {
+			// Stopping the client leaves the container running
+			exec.Command(engine, "kill", container).Run()
+		}
+		return "", fmt.Errorf("the program did not finish within %s", interpreterTimeout)
+	case errors.As(err, &exitErr):
+		status = exitErr.ExitCode()
+	case err != nil:
+		return "", fmt.Errorf("failed to run the code: %v", err)
+	}
+	return formatOutput(status, stdout.String(), stderr.String()), nil
+}
+
+// containerName returns a unique name for a run's container, so it can be killed on timeout
+func containerName() string {
+	suffix := make([]byte, 6)
+	rand.Read(suffix)
+	return "chatty-code-" + hex.EncodeToString(suffix)
+}
+
+// limitedBuffer keeps the first maxCodeOutput bytes written to it and discards the rest
+type limitedBuffer struct {
+	buf *bytes.Buffer
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := maxCodeOutput - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+		} else {
+			b.buf.Write(p)
+		}
+	}
+	return len(p), nil
+}
@@ -0,0 +1,208 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	searchResults = 5 // Results returned to the model
+	searchTimeout = 20 * time.Second
+
+	duckDuckGoURL = "https://html.duckduckgo.com/html/"
+)
+
+// Search backends
+const (
+	SearchDuckDuckGo = "duckduckgo"
+	SearchSearxNG    = "searxng"
+)
+
+// SearchEngine selects the web_search backend, and SearxNGURL is the instance used by SearchSearxNG
+var (
+	SearchEngine = SearchDuckDuckGo
+	SearxNGURL   string
+)
+
+var (
+	duckResultPattern  = regexp.MustCompile(`(?s)<a[^>]+class="result__a"[^>]+href="([^"]+)"[^>]*>(.*?)</a>`)
+	duckSnippetPattern = regexp.MustCompile(`(?s)<a[^>]+class="result__snippet"[^>]*>(.*?)</a>`)
+	tagPattern         = regexp.MustCompile(`<[^>]+>`)
+)
+
+// Source is a web page a tool consulted, listed under the response
+type Source struct {
+	Title string
+	URL   string
+}
+
+// sources collects the pages consulted while an agent prepares a response
+var (
+	sources   []Source
+	sourcesMu sync.Mutex
+)
+
+// TakeSources returns the pages consulted since the last call, and forgets them
+func TakeSources() []Source {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	taken := sources
+	sources = nil
+	return taken
+}
+
+// addSource records a consulted page once
+func addSource(source Source) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	for _, known := range sources {
+		if known.URL == source.URL {
+			return
+		}
+	}
+	sources = append(sources, source)
+}
+
+func init() {
+	Register(Tool{
+		Name:        "web_search",
+		Description: "Search the web and return the top results with their titles, addresses and snippets. Fetch a result with http_get to read it in full",
+		Parameters: map[string]Property{
+			"query": {Type: "string", Description: "What to search for"},
+		},
+		Required: []string{"query"},
+		Run:      webSearch,
+	})
+}
+
+// webSearch runs a query against the configured backend
+func webSearch(args Arguments) (string, error) {
+	query := args.String("query")
+
+	var results []searchResult
+	var err error
+	switch SearchEngine {
+	case "", SearchDuckDuckGo:
+		results, err = searchDuckDuckGo(query)
+	case SearchSearxNG:
+		results, err = searchSearxNG(query)
+	default:
+		return "", fmt.Errorf("unknown search engine '%s': use %s or %s", SearchEngine, SearchDuckDuckGo, SearchSearxNG)
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return fmt.Sprintf("No results found for '%s'", query), nil
+	}
+	if len(results) > searchResults {
+		results = results[:searchResults]
+	}
+
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("Web results for '%s':\n", query))
+	for i, result := range results {
+		addSource(Source{Title: result.Title, URL: result.URL})
+		sb.WriteString(fmt.Sprintf("\n[%d] %s\n%s\n%s\n", i+1, result.Title, result.URL, result.Snippet))
+	}
+	return sb.String(), nil
+}
+
+// searchResult is one hit of a web search
+type searchResult struct {
+	Title   string
+	URL     string
+	Snippet string
+}
+
+// fetchSearch downloads a search results page
+func fetchSearch(address string) ([]byte, error) {
+	req, err := http.NewRequest("GET", address, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid search URL: %v", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (compatible; chatty)")
+
+	client := &http.Client{Timeout: searchTimeout}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("search failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("search failed: %s", resp.Status)
+	}
+	return io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+}
+
+// searchDuckDuckGo scrapes DuckDuckGo's HTML results page, which needs no API key
+func searchDuckDuckGo(query string) ([]searchResult, error) {
+	body, err := fetchSearch(duckDuckGoURL + "?q=" + url.QueryEscape(query))
+	if err != nil {
+		return nil, err
+	}
+
+	page := string(body)
+	links := duckResultPattern.FindAllStringSubmatch(page, -1)
+	snippets := duckSnippetPattern.FindAllStringSubmatch(page, -1)
+
+	var results []searchResult
+	for i, link := range links {
+		address := html.UnescapeString(link[1])
+		// Result links go through a redirect that carries the real address
+		if parsed, err := url.Parse(address); err == nil && parsed.Query().Get("uddg") != "" {
+			address = parsed.Query().Get("uddg")
+		}
+		if strings.HasPrefix(address, "//") {
+			address = "https:" + address
+		}
+		result := searchResult{Title: stripTags(link[2]), URL: address}
+		if i < len(snippets) {
+			result.Snippet = stripTags(snippets[i][1])
+		}
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+// searchSearxNG queries a SearxNG instance through its JSON API
+func searchSearxNG(query string) ([]searchResult, error) {
+	if SearxNGURL == "" {
+		return nil, fmt.Errorf("searxng_url is not set in config.json")
+	}
+	body, err := fetchSearch(strings.TrimSuffix(SearxNGURL, "/") + "/search?format=json&q=" + url.QueryEscape(query))
+	if err != nil {
+		return nil, err
+	}
+
+	var response struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, fmt.Errorf("unexpected response from SearxNG (is the json format enabled?): %v", err)
+	}
+
+	var results []searchResult
+	for _, result := range response.Results {
+		results = append(results, searchResult{Title: result.Title, URL: result.URL, Snippet: result.Content})
+	}
+	return results, nil
+}
+
+// stripTags reduces an HTML fragment to plain text
+func stripTags(fragment string) string {
+	text := html.UnescapeString(tagPattern.ReplaceAllString(fragment, ""))
+	return strings.Join(strings.Fields(text), " ")
+}
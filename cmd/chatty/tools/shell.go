@@ -0,0 +1,96 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+	"time"
+)
+
+const shellTimeout = 2 * time.Minute
+
+// ShellAllowlist holds commands run_shell may run without asking, like "ls" or "git status".
+// A command matches an entry when it is the entry itself or starts with it followed by arguments
+var ShellAllowlist []string
+
+func init() {
+	Register(Tool{
+		Name:        "run_shell",
+		Description: "Run a shell command on the user's machine and return its output. The user is asked to approve commands first",
+		Parameters: map[string]Property{
+			"command": {Type: "string", Description: "Command line to run in the working directory"},
+		},
+		Required: []string{"command"},
+		Run:      runShell,
+		Confirm: func(args Arguments) string {
+			command := args.String("command")
+			if allowedCommand(command) {
+				return ""
+			}
+			return "run `" + command + "`"
+		},
+	})
+}
+
+// allowedCommand reports whether a command is on the allowlist. Commands that chain or
+// redirect with shell operators always need approval, so "ls; rm -rf ~" can't pass as "ls"
+func allowedCommand(command string) bool {
+	command = strings.TrimSpace(command)
+	if strings.ContainsAny(command, ";&|<>`$()\n") {
+		return false
+	}
+	for _, allowed := range ShellAllowlist {
+		allowed = strings.TrimSpace(allowed)
+		if allowed != "" && (command == allowed || strings.HasPrefix(command, allowed+" ")) {
+			return true
+		}
+	}
+	return false
+}
+
+// runShell runs a command and reports its exit status and output
+func runShell(args Arguments) (string, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), shellTimeout)
+	defer cancel()
+
+	var cmd *exec.Cmd
+	if runtime.GOOS == "windows" {
+		cmd = exec.CommandContext(ctx, "cmd", "/C", args.String("command"))
+	} else {
+		cmd = exec.CommandContext(ctx, "sh", "-c", args.String("command"))
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	status := 0
+	var exitErr *exec.ExitError
+	switch {
+	case ctx.Err() == context.DeadlineExceeded:
+		return "", fmt.Errorf("the command did not finish within %s", shellTimeout)
+	case errors.As(err, &exitErr):
+		status = exitErr.ExitCode()
+	case err != nil:
+		return "", fmt.Errorf("failed to run the command: %v", err)
+	}
+
+	return formatOutput(status, stdout.String(), stderr.String()), nil
+}
+
+// formatOutput reports a program's exit status and output to the model
+func formatOutput(status int, stdout, stderr string) string {
+	var sb strings.Builder
+	sb.WriteString(fmt.Sprintf("exit status %d\n", status))
+	if stdout != "" {
+		sb.WriteString("stdout:\n" + stdout + "\n")
+	}
+	if stderr != "" {
+		sb.WriteString("stderr:\n" + stderr + "\n")
+	}
+	return strings.TrimRight(sb.String(), "\n")
+}
@@ -0,0 +1,226 @@
+package tools
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const maxResultLength = 8000 // Characters of a tool result sent back to the model
+
+// Definition describes a tool to the model, in Ollama's tool-calling format
+type Definition struct {
+	Type     string   `json:"type"`
+	Function Function `json:"function"`
+}
+
+// Function is the name, purpose and parameters of a tool
+type Function struct {
+	Name        string     `json:"name"`
+	Description string     `json:"description"`
+	Parameters  Parameters `json:"parameters"`
+}
+
+// Parameters is the JSON schema of a tool's arguments
+type Parameters struct {
+	Type       string              `json:"type"`
+	Properties map[string]Property `json:"properties"`
+	Required   []string            `json:"required,omitempty"`
+}
+
+// Property is one argument of a tool
+type Property struct {
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Enum        []string `json:"enum,omitempty"`
+}
+
+// Call is a tool invocation requested by the model
+type Call struct {
+	Function CallFunction `json:"function"`
+}
+
+// CallFunction names the tool to run and its arguments
+type CallFunction struct {
+	Name      string    `json:"name"`
+	Arguments Arguments `json:"arguments"`
+}
+
+// Arguments are the values the model passed to a tool
+type Arguments map[string]any
+
+// String returns an argument as text, or "" when it is missing
+func (a Arguments) String(name string) string {
+	value, ok := a[name]
+	if !ok || value == nil {
+		return ""
+	}
+	if s, ok := value.(string); ok {
+		return s
+	}
+	return fmt.Sprint(value)
+}
+
+// Tool is an action agents can take during a conversation
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]Property
+	Required    []string
+	Run         func(args Arguments) (string, error)
+
+	// Confirm describes what a call is about to do when the user must approve it first,
+	// returning "" when it can run without asking. Nil means the tool never asks
+	Confirm func(args Arguments) string
+}
+
+// Permissions decide whether a tool may run
+const (
+	PermissionAllow = "allow" // Run without asking
+	PermissionDeny  = "deny"  // Never offered to the model
+	PermissionAsk   = "ask"   // Ask the user before every call
+)
+
+// Policy maps tool names to permissions. Tools without one keep their own
+// behavior: most run freely, and those with a Confirm hook ask when it says so
+type Policy map[string]string
+
+// Allows reports whether a tool may be offered to the model
+func (p Policy) Allows(name string) bool {
+	return p[name] != PermissionDeny
+}
+
+// ValidPermission reports whether permission is allow, deny or ask
+func ValidPermission(permission string) bool {
+	return permission == PermissionAllow || permission == PermissionDeny || permission == PermissionAsk
+}
+
+// Approve asks the user whether a tool call described by action may run. It declines
+// everything until the application provides a way to ask
+var Approve = func(action string) bool {
+	return false
+}
+
+// Definition returns the description of the tool advertised to the model
+func (t Tool) Definition() Definition {
+	properties := t.Parameters
+	if properties == nil {
+		properties = map[string]Property{}
+	}
+	return Definition{
+		Type: "function",
+		Function: Function{
+			Name:        t.Name,
+			Description: t.Description,
+			Parameters: Parameters{
+				Type:       "object",
+				Properties: properties,
+				Required:   t.Required,
+			},
+		},
+	}
+}
+
+var registry = make(map[string]Tool)
+
+// Register makes a tool available to agents, replacing any tool with the same name
+func Register(tool Tool) {
+	registry[tool.Name] = tool
+}
+
+// Get returns the tool with the given name
+func Get(name string) (Tool, bool) {
+	tool, ok := registry[name]
+	return tool, ok
+}
+
+// Names lists the registered tools in alphabetical order
+func Names() []string {
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Definitions returns the definitions of the registered tools the policy allows
+func Definitions(policy Policy) []Definition {
+	var definitions []Definition
+	for _, name := range Names() {
+		if policy.Allows(name) {
+			definitions = append(definitions, registry[name].Definition())
+		}
+	}
+	return definitions
+}
+
+// Execute runs a tool call under a policy and returns the text sent back to the model.
+// Failures are reported to the model as text so it can correct itself
+func Execute(call Call, policy Policy) string {
+	tool, ok := registry[call.Function.Name]
+	if !ok || !policy.Allows(tool.Name) {
+		return fmt.Sprintf("Error: there is no tool named '%s'", call.Function.Name)
+	}
+	for _, name := range tool.Required {
+		if call.Function.Arguments.String(name) == "" {
+			return fmt.Sprintf("Error: missing required argument '%s'", name)
+		}
+	}
+
+	var action string
+	switch policy[tool.Name] {
+	case PermissionAllow:
+	case PermissionAsk:
+		action = "use " + Describe(call)
+		if tool.Confirm != nil {
+			if described := tool.Confirm(call.Function.Arguments); described != "" {
+				action = described
+			}
+		}
+	default:
+		if tool.Confirm != nil {
+			action = tool.Confirm(call.Function.Arguments)
+		}
+	}
+	if action != "" && !Approve(action) {
+		return "Error: the user did not allow this. Do not try again unless they ask you to"
+	}
+
+	result, err := tool.Run(call.Function.Arguments)
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+	if runes := []rune(result); len(runes) > maxResultLength {
+		result = string(runes[:maxResultLength]) + "\n\n[output truncated]"
+	}
+	return result
+}
+
+// Describe renders a call as name(arg=value, ...) for display
+func Describe(call Call) string {
+	names := make([]string, 0, len(call.Function.Arguments))
+	for name := range call.Function.Arguments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	args := make([]string, 0, len(names))
+	for _, name := range names {
+		args = append(args, name+"="+formatValue(call.Function.Arguments[name]))
+	}
+	return call.Function.Name + "(" + strings.Join(args, ", ") + ")"
+}
+
+// formatValue renders an argument value as JSON, leaving characters like & readable
+func formatValue(value any) string {
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return fmt.Sprint(value)
+	}
+	return strings.TrimSpace(buf.String())
+}
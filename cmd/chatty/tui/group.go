@@ -0,0 +1,171 @@
+package tui
+
+import (
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"chatty/cmd/chatty/server"
+	"chatty/cmd/chatty/theme"
+)
+
+// minColumnWidth is the narrowest column an agent gets in the split view. Terminals too narrow
+// for a column per agent show the conversation as one
+const minColumnWidth = 24
+
+// sendGroup has the agents of the group chat answer the conversation in turn, streaming their
+// responses to the model
+func (m *model) sendGroup() tea.Cmd {
+	events := make(chan streamMsg, 64)
+	members, transcript := m.group, m.transcript()
+	go func() {
+		err := m.engine.Group("", members, transcript, func(event server.GroupEvent) {
+			switch event.Type {
+			case server.EventTurnStart:
+				events <- streamMsg{start: true, agent: event.Agent}
+			case server.EventChunk:
+				events <- streamMsg{chunk: event.Content}
+			case server.EventTurnEnd:
+				events <- streamMsg{end: true, agent: event.Agent, response: event.Content}
+			}
+		})
+		events <- streamMsg{done: true, err: err}
+		close(events)
+	}()
+	m.events = events
+	m.streaming = true
+	m.speaking = ""
+	m.partial.Reset()
+	return tea.Batch(waitForStream(events), m.spinner.Tick)
+}
+
+// interject sends the message typed once the agent answering is done, before the other agents
+// of the group chat answer
+func (m *model) interject() {
+	text := strings.TrimSpace(m.input.Value())
+	if m.group == nil || text == "" || m.interjection != "" {
+		return
+	}
+	m.input.Reset()
+	m.interjection = text
+	m.engine.Interject("")
+}
+
+// transcript returns the messages of the group chat so far, without notes
+func (m *model) transcript() []server.GroupMessage {
+	var transcript []server.GroupMessage
+	for _, e := range m.entries {
+		switch e.role {
+		case "user":
+			transcript = append(transcript, server.GroupMessage{Content: e.content})
+		case "assistant":
+			transcript = append(transcript, server.GroupMessage{Speaker: e.agent, Content: e.content})
+		}
+	}
+	return transcript
+}
+
+// inChat reports whether an agent takes part in the chat shown
+func (m *model) inChat(name string) bool {
+	if m.group == nil {
+		return name == m.agent
+	}
+	for _, member := range m.group {
+		if member == name {
+			return true
+		}
+	}
+	return false
+}
+
+// columnWidth returns the columns of text each agent gets in the split view, the panes being a
+// column apart
+func (m *model) columnWidth() int {
+	if len(m.group) == 0 {
+		return 0
+	}
+	return (m.viewport.Width - (len(m.group) - 1)) / len(m.group)
+}
+
+// splitView reports whether the conversation is shown in a column per agent
+func (m *model) splitView() bool {
+	return m.split && m.group != nil && m.columnWidth() >= minColumnWidth
+}
+
+// toggleSplit switches group chats between a column per agent and one conversation
+func (m *model) toggleSplit() {
+	if m.group == nil {
+		m.notice = "Columns are for group chats: start one with chatty tui --with <agent1>,<agent2>"
+		return
+	}
+	m.split = !m.split
+	m.scrolled = 0
+	if m.split && !m.splitView() {
+		m.notice = "The terminal is too narrow for a column per agent"
+	}
+	if m.focus == focusMessages {
+		m.setFocus(focusInput)
+	}
+	m.refresh(true)
+}
+
+// columnLines renders the part of the conversation an agent's column shows, a line per row:
+// the user's messages, the agent's answers and notes
+func (m *model) columnLines(agent string, width int) []string {
+	var blocks []string
+	for _, e := range m.entries {
+		if e.role == "assistant" && e.agent != agent {
+			continue
+		}
+		blocks = append(blocks, m.renderEntry(e, width))
+	}
+	if m.streaming && m.speaking == agent {
+		blocks = append(blocks, m.renderEntry(entry{role: "assistant", agent: agent, content: m.partial.String()}, width))
+	}
+	if len(blocks) == 0 {
+		return nil
+	}
+	return strings.Split(strings.Join(blocks, "\n\n"), "\n")
+}
+
+// scrollColumns scrolls the columns up or down by a number of lines, together, stopping once
+// the longest column shows its first line
+func (m *model) scrollColumns(up bool, lines int) {
+	if !up {
+		m.scrolled = max(m.scrolled-lines, 0)
+		return
+	}
+	longest := 0
+	for _, agent := range m.group {
+		longest = max(longest, len(m.columnLines(agent, m.columnWidth())))
+	}
+	m.scrolled = max(min(m.scrolled+lines, longest-m.columnHeight()), 0)
+}
+
+// columnHeight returns the lines of the conversation a column shows, under its header
+func (m *model) columnHeight() int {
+	return max(m.viewport.Height-2, 1)
+}
+
+// renderColumns shows the group chat in a column per agent, each headed by the agent's label
+func (m *model) renderColumns() string {
+	palette := theme.Current()
+	width, height := m.columnWidth(), m.viewport.Height
+	separator := strings.TrimSuffix(strings.Repeat(palette.Muted+"│"+palette.Reset+"\n", height), "\n")
+
+	var panes []string
+	for i, agent := range m.group {
+		if i > 0 {
+			panes = append(panes, separator)
+		}
+		lines := m.columnLines(agent, width)
+		end := max(len(lines)-m.scrolled, min(len(lines), m.columnHeight()))
+		start := max(end-m.columnHeight(), 0)
+		header := palette.Label + truncate(m.agentLabel(agent), width) + palette.Reset
+		rule := palette.Muted + strings.Repeat("─", width) + palette.Reset
+		pane := strings.Join(append([]string{header, rule}, lines[start:end]...), "\n")
+		panes = append(panes, lipgloss.NewStyle().Width(width).Height(height).MaxHeight(height).Render(pane))
+	}
+	return lipgloss.NewStyle().Width(m.viewport.Width).Render(lipgloss.JoinHorizontal(lipgloss.Top, panes...))
+}
@@ -0,0 +1,80 @@
+package tui
+
+import (
+	"fmt"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+
+	"chatty/cmd/chatty/render"
+)
+
+// selectMessages starts choosing a message of the conversation, from the latest one
+func (m *model) selectMessages() {
+	if len(m.entries) == 0 {
+		return
+	}
+	m.cursor = len(m.entries) - 1
+	m.setFocus(focusMessages)
+	m.refresh(false)
+}
+
+// updateSelection moves between the messages, copying or quoting the one chosen
+func (m *model) updateSelection(msg tea.KeyMsg) tea.Cmd {
+	switch msg.String() {
+	case "up", "k":
+		if m.cursor > 0 {
+			m.cursor--
+		}
+	case "down", "j":
+		if m.cursor < len(m.entries)-1 {
+			m.cursor++
+		}
+	case "home", "g":
+		m.cursor = 0
+	case "end", "G":
+		m.cursor = len(m.entries) - 1
+	case "c", "y":
+		if err := render.CopyToClipboard(m.entries[m.cursor].content); err != nil {
+			m.notice = fmt.Sprintf("Failed to copy: %v", err)
+		} else {
+			m.notice = "Copied the message to the clipboard"
+		}
+	case "q", ">", "enter":
+		m.input.SetValue(quote(m.entries[m.cursor].content) + "\n\n" + m.input.Value())
+		m.setFocus(focusInput)
+		m.refresh(false)
+		return nil
+	default:
+		return nil
+	}
+	m.refresh(false)
+	return nil
+}
+
+// scrollToCursor scrolls the conversation to show as much of the chosen message as fits
+func (m *model) scrollToCursor() {
+	if m.cursor < 0 || m.cursor >= len(m.offsets) {
+		return
+	}
+	top := m.offsets[m.cursor]
+	bottom := m.viewport.TotalLineCount() - 1
+	if m.cursor+1 < len(m.offsets) {
+		bottom = m.offsets[m.cursor+1] - 2 // Messages are a blank line apart
+	}
+	switch {
+	case top < m.viewport.YOffset || bottom-top >= m.viewport.Height:
+		m.viewport.SetYOffset(top)
+	case bottom >= m.viewport.YOffset+m.viewport.Height:
+		m.viewport.SetYOffset(bottom - m.viewport.Height + 1)
+	}
+}
+
+// quote marks each line of a message as quoted, like replies to emails
+func quote(text string) string {
+	lines := strings.Split(strings.TrimSpace(text), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight("> "+line, " ")
+	}
+	return strings.Join(lines, "\n")
+}
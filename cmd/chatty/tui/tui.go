@@ -0,0 +1,677 @@
+// Package tui is chatty's full-screen chat: the conversation in a scrollable pane, an input box
+// and a sidebar to switch between agents, with responses rendered as they stream. Group chats
+// can show each agent in a column of its own
+package tui
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/charmbracelet/bubbles/spinner"
+	"github.com/charmbracelet/bubbles/textarea"
+	"github.com/charmbracelet/bubbles/viewport"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+
+	"chatty/cmd/chatty/keys"
+	"chatty/cmd/chatty/render"
+	"chatty/cmd/chatty/server"
+	"chatty/cmd/chatty/theme"
+)
+
+const (
+	sidebarWidth = 28 // Columns of the agent sidebar, borders included
+	minWidth     = 70 // Narrower terminals hide the sidebar
+	inputHeight  = 3  // Lines of the input box
+)
+
+// Engine is the part of chatty the TUI drives, the same chats as chatty serve. The TUI passes no
+// session, so chats go to the user's own histories like chats in the terminal
+type Engine interface {
+	Agents() []server.Agent
+	History(session, agent string) ([]server.Message, error)
+	// Chat sends a message to an agent, passing the response to onChunk as it streams
+	Chat(session, agent, message string, onChunk func(chunk string)) (string, string, error)
+	// Regenerate has an agent answer the last message of its history again, replacing its answer
+	Regenerate(session, agent string, onChunk func(chunk string)) (string, string, error)
+	// Group has each agent answer the conversation so far in turn, reporting the answers with
+	// onEvent as they stream
+	Group(session string, agents []string, transcript []server.GroupMessage, onEvent func(event server.GroupEvent)) error
+	// Interject ends the group chat round running once the agent answering is done
+	Interject(session string)
+}
+
+// Options are how the TUI starts
+type Options struct {
+	Agent  string    // Agent chatted with first, the current one when empty
+	Group  []string  // Agents of a group chat to start with instead, by their names
+	Split  bool      // Show each agent of the group chat in a column of its own
+	Output io.Writer // Terminal the TUI draws on
+	Notes  io.Reader // Anything else chatty prints while the TUI runs, shown as notes
+}
+
+// Run shows the TUI until the user quits
+func Run(engine Engine, options Options) error {
+	m := newModel(engine, options)
+	programOptions := []tea.ProgramOption{tea.WithAltScreen(), tea.WithMouseCellMotion()}
+	if options.Output != nil {
+		programOptions = append(programOptions, tea.WithOutput(options.Output))
+	}
+	program := tea.NewProgram(m, programOptions...)
+	if options.Notes != nil {
+		go forwardNotes(program, options.Notes)
+	}
+	_, err := program.Run()
+	return err
+}
+
+// entry is a message of the conversation shown
+type entry struct {
+	role    string // user, assistant or note
+	agent   string // Name of the agent who wrote it
+	content string
+}
+
+// focusArea is where key presses go
+type focusArea int
+
+const (
+	focusInput focusArea = iota
+	focusSidebar
+	focusMessages // Choosing a message to copy or quote
+)
+
+// Messages the model receives besides input
+type (
+	historyMsg struct {
+		agent    string
+		messages []server.Message
+		err      error
+	}
+	streamMsg struct {
+		chunk    string
+		start    bool // An agent of a group chat starts answering
+		end      bool // An agent of a group chat finished, with its answer in response
+		done     bool
+		agent    string
+		response string
+		err      error
+	}
+	noteMsg string
+)
+
+// model is the state of the TUI
+type model struct {
+	engine   Engine
+	agents   []server.Agent
+	selected int      // Agent highlighted in the sidebar
+	agent    string   // Agent chatted with
+	group    []string // Agents of the group chat, which answer each message in turn
+	speaking string   // Agent whose response is streaming in
+
+	entries   []entry
+	streaming bool
+	partial   strings.Builder  // Response streaming in
+	events    <-chan streamMsg // Where the streaming response comes from
+	cursor    int              // Message chosen while selecting
+	offsets   []int            // Line each message starts on in the conversation pane
+	notice    string           // Shown in the status line until the next key press
+	split     bool             // Group chats show a column per agent
+	scrolled  int              // Lines the columns are scrolled up from the bottom
+
+	interjection string // Message typed while a group chat round ran, sent once it ends
+
+	focus    focusArea
+	viewport viewport.Model
+	input    textarea.Model
+	spinner  spinner.Model
+	width    int
+	height   int
+	ready    bool
+}
+
+func newModel(engine Engine, options Options) *model {
+	input := textarea.New()
+	input.Placeholder = "Type a message, " + keys.Label(keys.Send) + " to send"
+	input.ShowLineNumbers = false
+	input.CharLimit = 0
+	input.SetHeight(inputHeight)
+	input.KeyMap.InsertNewline.SetKeys(keys.Of(keys.NewLine)...)
+	input.Focus()
+
+	m := &model{
+		engine:  engine,
+		agents:  engine.Agents(),
+		group:   options.Group,
+		split:   options.Split,
+		input:   input,
+		spinner: spinner.New(spinner.WithSpinner(spinner.Dot)),
+	}
+	agent := options.Agent
+	for i, a := range m.agents {
+		if (agent == "" && a.Current) || strings.EqualFold(a.Name, agent) {
+			m.selected = i
+		}
+	}
+	if len(m.agents) > 0 {
+		m.agent = m.agents[m.selected].Name
+	}
+	if m.group != nil {
+		m.entries = append(m.entries, entry{role: "note", content: "Group chat with " + strings.Join(m.group, ", ") + ": everyone answers each message in turn"})
+	}
+	return m
+}
+
+func (m *model) Init() tea.Cmd {
+	if m.group != nil {
+		return textarea.Blink
+	}
+	return tea.Batch(textarea.Blink, m.loadHistory(m.agent))
+}
+
+// loadHistory reads an agent's chat history to show it
+func (m *model) loadHistory(agent string) tea.Cmd {
+	return func() tea.Msg {
+		messages, err := m.engine.History("", agent)
+		return historyMsg{agent: agent, messages: messages, err: err}
+	}
+}
+
+// send has the agent answer a message, streaming the response to the model
+func (m *model) send(text string) tea.Cmd {
+	agent := m.agent
+	return m.stream(func(onChunk func(chunk string)) (string, string, error) {
+		return m.engine.Chat("", agent, text, onChunk)
+	})
+}
+
+// regenerate has the agents answer the last message again, in place of their answers
+func (m *model) regenerate() tea.Cmd {
+	last := m.lastMessage()
+	if m.streaming || last < 0 || last == len(m.entries)-1 {
+		return nil
+	}
+	answered := false
+	for _, e := range m.entries[last+1:] {
+		answered = answered || e.role == "assistant"
+	}
+	if !answered {
+		return nil
+	}
+	m.entries = m.entries[:last+1]
+	m.scrolled = 0
+	m.refresh(true)
+	if m.group != nil {
+		return m.sendGroup()
+	}
+	agent := m.agent
+	return m.stream(func(onChunk func(chunk string)) (string, string, error) {
+		return m.engine.Regenerate("", agent, onChunk)
+	})
+}
+
+// lastMessage returns the entry of the user's last message, -1 before they send one
+func (m *model) lastMessage() int {
+	for i := len(m.entries) - 1; i >= 0; i-- {
+		if m.entries[i].role == "user" {
+			return i
+		}
+	}
+	return -1
+}
+
+// stream runs chat, streaming the agent's response to the model
+func (m *model) stream(chat func(onChunk func(chunk string)) (string, string, error)) tea.Cmd {
+	events := make(chan streamMsg, 64)
+	agent := m.agent
+	go func() {
+		name, response, err := chat(func(chunk string) {
+			events <- streamMsg{chunk: chunk}
+		})
+		events <- streamMsg{done: true, agent: name, response: response, err: err}
+		close(events)
+	}()
+	m.events = events
+	m.streaming = true
+	m.speaking = agent
+	m.partial.Reset()
+	return tea.Batch(waitForStream(events), m.spinner.Tick)
+}
+
+// waitForStream delivers the next piece of a streaming response
+func waitForStream(events <-chan streamMsg) tea.Cmd {
+	return func() tea.Msg {
+		return <-events
+	}
+}
+
+func (m *model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	var cmds []tea.Cmd
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.width, m.height = msg.Width, msg.Height
+		m.layout()
+		m.refresh(true)
+		return m, nil
+
+	case tea.KeyMsg:
+		m.notice = ""
+		switch key := msg.String(); {
+		case key == "ctrl+c":
+			return m, tea.Quit
+		case keys.Matches(keys.Cancel, key):
+			if m.focus != focusInput {
+				m.setFocus(focusInput)
+				return m, nil
+			}
+			if !m.streaming {
+				return m, tea.Quit
+			}
+			return m, nil
+		case keys.Matches(keys.SwitchAgent, key):
+			if m.focus == focusInput && m.showSidebar() {
+				m.setFocus(focusSidebar)
+			} else {
+				m.setFocus(focusInput)
+			}
+			return m, nil
+		case keys.Matches(keys.SplitView, key):
+			m.toggleSplit()
+			return m, nil
+		case keys.Matches(keys.Interject, key) && m.focus == focusInput && m.streaming:
+			m.interject()
+			return m, nil
+		case keys.Matches(keys.Regenerate, key) && m.focus == focusInput && m.input.Value() == "":
+			return m, m.regenerate()
+		case key == "pgup" || key == "pgdown":
+			if m.splitView() {
+				m.scrollColumns(key == "pgup", m.viewport.Height)
+				return m, nil
+			}
+			var cmd tea.Cmd
+			m.viewport, cmd = m.viewport.Update(msg)
+			return m, cmd
+		}
+		switch m.focus {
+		case focusSidebar:
+			return m, m.updateSidebar(msg)
+		case focusMessages:
+			return m, m.updateSelection(msg)
+		}
+		if keys.Matches(keys.SelectMessages, msg.String()) && m.input.Value() == "" && !m.splitView() {
+			m.selectMessages()
+			return m, nil
+		}
+		if keys.Matches(keys.Send, msg.String()) {
+			text := strings.TrimSpace(m.input.Value())
+			if text == "" || m.streaming || (m.agent == "" && m.group == nil) {
+				return m, nil
+			}
+			m.input.Reset()
+			m.entries = append(m.entries, entry{role: "user", content: text})
+			m.scrolled = 0
+			m.refresh(true)
+			if m.group != nil {
+				return m, m.sendGroup()
+			}
+			return m, m.send(text)
+		}
+
+	case tea.MouseMsg:
+		if m.splitView() {
+			switch msg.Type {
+			case tea.MouseWheelUp:
+				m.scrollColumns(true, 3)
+			case tea.MouseWheelDown:
+				m.scrollColumns(false, 3)
+			}
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.viewport, cmd = m.viewport.Update(msg)
+		return m, cmd
+
+	case historyMsg:
+		if msg.agent != m.agent || m.group != nil {
+			return m, nil
+		}
+		m.entries = nil
+		if m.focus == focusMessages {
+			m.setFocus(focusInput)
+		}
+		if msg.err != nil {
+			m.entries = append(m.entries, entry{role: "note", content: fmt.Sprintf("Failed to load the history: %v", msg.err)})
+		}
+		for _, message := range msg.messages {
+			m.entries = append(m.entries, entry{role: message.Role, agent: m.agent, content: message.Content})
+		}
+		m.refresh(true)
+		return m, nil
+
+	case streamMsg:
+		switch {
+		case msg.start:
+			m.speaking = msg.agent
+			m.partial.Reset()
+			m.refresh(false)
+			return m, waitForStream(m.events)
+		case msg.end:
+			m.entries = append(m.entries, entry{role: "assistant", agent: msg.agent, content: msg.response})
+			m.speaking = ""
+			m.partial.Reset()
+			m.refresh(false)
+			return m, waitForStream(m.events)
+		case !msg.done:
+			m.partial.WriteString(msg.chunk)
+			m.refresh(false)
+			return m, waitForStream(m.events)
+		}
+		m.streaming = false
+		if msg.response != "" || m.partial.Len() > 0 {
+			content := msg.response
+			if content == "" {
+				content = m.partial.String()
+			}
+			m.entries = append(m.entries, entry{role: "assistant", agent: m.speaking, content: content})
+		}
+		if msg.err != nil {
+			m.entries = append(m.entries, entry{role: "note", content: fmt.Sprintf("Error: %v", msg.err)})
+		}
+		m.partial.Reset()
+		if text := m.interjection; text != "" {
+			m.interjection = ""
+			if msg.err != nil {
+				m.input.SetValue(text)
+			} else {
+				m.entries = append(m.entries, entry{role: "user", content: text})
+				m.refresh(true)
+				return m, m.sendGroup()
+			}
+		}
+		m.refresh(true)
+		return m, nil
+
+	case noteMsg:
+		// Notes include agents added or removed while the TUI runs
+		m.agents = m.engine.Agents()
+		if m.selected >= len(m.agents) {
+			m.selected = len(m.agents) - 1
+		}
+		m.entries = append(m.entries, entry{role: "note", content: string(msg)})
+		m.refresh(false)
+		return m, nil
+
+	case spinner.TickMsg:
+		if !m.streaming {
+			return m, nil
+		}
+		var cmd tea.Cmd
+		m.spinner, cmd = m.spinner.Update(msg)
+		return m, cmd
+	}
+
+	var cmd tea.Cmd
+	m.input, cmd = m.input.Update(msg)
+	cmds = append(cmds, cmd)
+	return m, tea.Batch(cmds...)
+}
+
+// updateSidebar moves through the agents, switching to the one chosen with the send key
+func (m *model) updateSidebar(msg tea.KeyMsg) tea.Cmd {
+	switch key := msg.String(); {
+	case key == "up" || key == "k":
+		if m.selected > 0 {
+			m.selected--
+		}
+	case key == "down" || key == "j":
+		if m.selected < len(m.agents)-1 {
+			m.selected++
+		}
+	case keys.Matches(keys.Send, key):
+		if m.streaming || len(m.agents) == 0 {
+			return nil
+		}
+		// Choosing an agent leaves a group chat for a chat with the agent alone
+		m.agent = m.agents[m.selected].Name
+		m.group = nil
+		m.entries = nil
+		m.setFocus(focusInput)
+		m.refresh(true)
+		return m.loadHistory(m.agent)
+	}
+	return nil
+}
+
+func (m *model) setFocus(focus focusArea) {
+	m.focus = focus
+	if focus == focusInput {
+		m.input.Focus()
+	} else {
+		m.input.Blur()
+	}
+}
+
+// showSidebar reports whether the terminal is wide enough for the sidebar
+func (m *model) showSidebar() bool {
+	return m.width >= minWidth
+}
+
+// layout sizes the panes to the terminal
+func (m *model) layout() {
+	chatWidth := m.width
+	if m.showSidebar() {
+		chatWidth -= sidebarWidth
+	}
+	// Borders take two lines and columns around the conversation and the input, and the status
+	// line one more
+	viewportHeight := m.height - 1 - (inputHeight + 2) - 2
+	if viewportHeight < 1 {
+		viewportHeight = 1
+	}
+	if !m.ready {
+		m.viewport = viewport.New(chatWidth-2, viewportHeight)
+		m.ready = true
+	} else {
+		m.viewport.Width, m.viewport.Height = chatWidth-2, viewportHeight
+	}
+	m.input.SetWidth(chatWidth - 2)
+}
+
+// refresh redraws the conversation, following it to the bottom when asked or already there
+func (m *model) refresh(bottom bool) {
+	if !m.ready {
+		return
+	}
+	follow := bottom || m.viewport.AtBottom()
+	m.viewport.SetContent(m.renderEntries())
+	if m.focus == focusMessages {
+		m.scrollToCursor()
+	} else if follow {
+		m.viewport.GotoBottom()
+	}
+}
+
+// renderEntries renders the conversation to fit the message pane
+func (m *model) renderEntries() string {
+	width := m.viewport.Width
+	if width < 10 {
+		width = 10
+	}
+	var blocks []string
+	m.offsets = m.offsets[:0]
+	line := 0
+	for i, e := range m.entries {
+		block := m.markSelected(m.renderEntry(e, width-2), m.focus == focusMessages && i == m.cursor)
+		m.offsets = append(m.offsets, line)
+		line += lipgloss.Height(block) + 1
+		blocks = append(blocks, block)
+	}
+	if m.streaming && m.speaking != "" {
+		blocks = append(blocks, m.markSelected(m.renderEntry(entry{role: "assistant", agent: m.speaking, content: m.partial.String()}, width-2), false))
+	}
+	return strings.Join(blocks, "\n\n")
+}
+
+// markSelected puts a bar beside the lines of the message chosen, and a margin beside the others
+func (m *model) markSelected(block string, selected bool) string {
+	palette := theme.Current()
+	margin := "  "
+	if selected {
+		margin = palette.Accent + "▌ " + palette.Reset
+	}
+	return margin + strings.ReplaceAll(block, "\n", "\n"+margin)
+}
+
+// renderEntry renders a message with its label, wrapped to width
+func (m *model) renderEntry(e entry, width int) string {
+	palette := theme.Current()
+	wrap := lipgloss.NewStyle().Width(width)
+	switch e.role {
+	case "user":
+		return wrap.Render(palette.User + "You: " + palette.Reset + e.content)
+	case "note":
+		return wrap.Render(palette.Muted + e.content + palette.Reset)
+	}
+	label := palette.Label + m.agentLabel(e.agent) + ":" + palette.Reset
+	text := e.content
+	if text == "" && m.streaming {
+		text = m.spinner.View()
+	} else {
+		renderer := render.NewStreamRenderer(palette.Text, !palette.NoColor)
+		text = renderer.Render(text) + renderer.Flush()
+	}
+	return wrap.Render(label + "\n" + text)
+}
+
+// agentLabel returns an agent's emoji and name
+func (m *model) agentLabel(name string) string {
+	for _, a := range m.agents {
+		if a.Name == name {
+			return theme.AgentEmoji(a.Emoji, a.Name) + " " + a.Name
+		}
+	}
+	return name
+}
+
+func (m *model) View() string {
+	if !m.ready {
+		return "Loading..."
+	}
+	border := lipgloss.NewStyle().Border(lipgloss.RoundedBorder())
+	conversation := m.viewport.View()
+	if m.splitView() {
+		conversation = m.renderColumns()
+	}
+	chat := lipgloss.JoinVertical(lipgloss.Left,
+		border.Render(conversation),
+		border.Render(m.input.View()),
+	)
+	body := chat
+	if m.showSidebar() {
+		body = lipgloss.JoinHorizontal(lipgloss.Top, m.renderSidebar(lipgloss.Height(chat)), chat)
+	}
+	return lipgloss.JoinVertical(lipgloss.Left, body, m.statusLine())
+}
+
+// renderSidebar lists the agents, marking the one chatted with and the one highlighted
+func (m *model) renderSidebar(height int) string {
+	palette := theme.Current()
+	inner := sidebarWidth - 2
+	lines := []string{palette.Heading + "Agents" + palette.Reset, ""}
+
+	// Scroll the list to keep the highlighted agent in view
+	visible := height - 2 - len(lines)
+	start := 0
+	if visible > 0 && m.selected >= visible {
+		start = m.selected - visible + 1
+	}
+	for i := start; i < len(m.agents) && (visible <= 0 || i < start+visible); i++ {
+		a := m.agents[i]
+		marker := "  "
+		if m.inChat(a.Name) {
+			marker = "● "
+		}
+		line := truncate(marker+theme.AgentEmoji(a.Emoji, a.Name)+" "+a.Name, inner)
+		if i == m.selected && m.focus == focusSidebar {
+			line = palette.Highlight + line + palette.Reset
+		}
+		lines = append(lines, line)
+	}
+	return lipgloss.NewStyle().
+		Border(lipgloss.RoundedBorder()).
+		Width(inner).
+		Height(height - 2).
+		Render(strings.Join(lines, "\n"))
+}
+
+// statusLine shows what is going on and the keys to use
+func (m *model) statusLine() string {
+	palette := theme.Current()
+	var status string
+	switch {
+	case m.notice != "":
+		status = m.notice
+	case m.focus == focusMessages:
+		status = "↑/↓: Choose message • c: Copy • q: Quote in your message • " + keys.Label(keys.Cancel) + ": Back to the message"
+	case m.streaming && m.interjection != "":
+		status = m.spinner.View() + " Your message goes in once the agent answering is done"
+	case m.streaming && m.speaking == "":
+		status = m.spinner.View() + " Waiting for the agents"
+	case m.streaming && m.group != nil:
+		status = m.spinner.View() + " " + m.speaking + " is answering • " + keys.Label(keys.Interject) + ": Send your message next"
+	case m.streaming:
+		status = m.spinner.View() + " " + m.speaking + " is answering"
+	case m.focus == focusSidebar:
+		status = fmt.Sprintf("↑/↓: Choose agent • %s: Chat with it • %s/%s: Back to the message",
+			keys.Label(keys.Send), keys.Label(keys.SwitchAgent), keys.Label(keys.Cancel))
+	default:
+		help := []string{keys.Label(keys.Send) + ": Send", keys.Label(keys.NewLine) + ": New line"}
+		if !m.splitView() {
+			help = append(help, keys.Label(keys.SelectMessages)+": Select messages")
+		}
+		if m.lastMessage() >= 0 {
+			help = append(help, keys.Label(keys.Regenerate)+": Answer again")
+		}
+		switch {
+		case m.splitView():
+			help = append(help, keys.Label(keys.SplitView)+": One conversation")
+		case m.group != nil:
+			help = append(help, keys.Label(keys.SplitView)+": Column per agent")
+		}
+		help = append(help, keys.Label(keys.SwitchAgent)+": Agents", "PgUp/PgDn: Scroll", keys.Label(keys.Cancel)+": Quit")
+		status = strings.Join(help, " • ")
+	}
+	return palette.Muted + truncate(status, m.width) + palette.Reset
+}
+
+// truncate cuts text to a number of columns
+func truncate(text string, width int) string {
+	if lipgloss.Width(text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && lipgloss.Width(string(runes))+1 > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "…"
+}
+
+// ansiSequence matches the escape sequences of colors and cursor movement
+var ansiSequence = regexp.MustCompile(`\x1b\[[0-9;?]*[A-Za-z]`)
+
+// forwardNotes shows the lines chatty prints while the TUI runs, like warnings, as notes
+func forwardNotes(program *tea.Program, notes io.Reader) {
+	scanner := bufio.NewScanner(notes)
+	for scanner.Scan() {
+		line := strings.TrimSpace(ansiSequence.ReplaceAllString(scanner.Text(), ""))
+		if i := strings.LastIndexByte(line, '\r'); i >= 0 {
+			line = strings.TrimSpace(line[i+1:])
+		}
+		if line != "" {
+			program.Send(noteMsg(line))
+		}
+	}
+}
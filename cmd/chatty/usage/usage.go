@@ -0,0 +1,145 @@
+// Package usage keeps count of how much each agent is used: the replies it gave, the tokens
+// spent on them and when it last answered, so agents that are never used stand out
+package usage
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"chatty/cmd/chatty/appdir"
+	"chatty/cmd/chatty/atomicfile"
+	"chatty/cmd/chatty/filelock"
+)
+
+const (
+	usageFile = "usage.json"
+	lockTries = 20 // Times to try for the lock another chatty holds, a while apart
+	lockWait  = 50 * time.Millisecond
+)
+
+// Stats is how much an agent has been used
+type Stats struct {
+	Messages int       `json:"messages"` // Replies it gave
+	Tokens   int       `json:"tokens"`   // Tokens read and written for them
+	LastUsed time.Time `json:"last_used"`
+}
+
+// mu keeps goroutines of this process, such as server requests, from saving at once
+var mu sync.Mutex
+
+// path returns where the counts are kept
+func path() (string, error) {
+	dataDir, err := appdir.DataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dataDir, usageFile), nil
+}
+
+// key is how an agent is found in the counts, whatever the case of its name
+func key(agent string) string {
+	return strings.ToLower(agent)
+}
+
+// Load returns the counts of every agent used, by lowercased name
+func Load() (map[string]Stats, error) {
+	file, err := path()
+	if err != nil {
+		return nil, err
+	}
+	return read(file)
+}
+
+// Get returns the counts of an agent, zero when it was never used
+func Get(agent string) Stats {
+	all, err := Load()
+	if err != nil {
+		return Stats{}
+	}
+	return all[key(agent)]
+}
+
+// Record counts a reply of an agent and the tokens it took
+func Record(agent string, tokens int) error {
+	return update(func(all map[string]Stats) {
+		stats := all[key(agent)]
+		stats.Messages++
+		stats.Tokens += tokens
+		stats.LastUsed = time.Now()
+		all[key(agent)] = stats
+	})
+}
+
+// Rename moves the counts of an agent to its new name
+func Rename(agent, newName string) error {
+	return update(func(all map[string]Stats) {
+		if stats, ok := all[key(agent)]; ok {
+			delete(all, key(agent))
+			all[key(newName)] = stats
+		}
+	})
+}
+
+// update changes the counts and saves them, holding the file's lock so other chatty processes
+// don't save over the change
+func update(change func(map[string]Stats)) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	file, err := path()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return fmt.Errorf("failed to create usage directory: %v", err)
+	}
+	var lock *filelock.Lock
+	for try := 0; ; try++ {
+		lock, err = filelock.Acquire(file)
+		var inUse *filelock.InUseError
+		if err == nil || !errors.As(err, &inUse) || try == lockTries {
+			break
+		}
+		time.Sleep(lockWait)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to lock usage statistics: %v", err)
+	}
+	defer lock.Release()
+
+	all, err := read(file)
+	if err != nil {
+		return err
+	}
+	change(all)
+	data, err := json.MarshalIndent(all, "", "    ")
+	if err != nil {
+		return fmt.Errorf("failed to encode usage statistics: %v", err)
+	}
+	if err := atomicfile.WriteFile(file, data, 0644); err != nil {
+		return fmt.Errorf("failed to write usage statistics: %v", err)
+	}
+	return nil
+}
+
+// read loads the counts from file, empty when there are none yet
+func read(file string) (map[string]Stats, error) {
+	all := make(map[string]Stats)
+	data, err := os.ReadFile(file)
+	if os.IsNotExist(err) {
+		return all, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read usage statistics: %v", err)
+	}
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, fmt.Errorf("failed to parse usage statistics: %v", err)
+	}
+	return all, nil
+}
@@ -0,0 +1,328 @@
+// Package websocket is a minimal WebSocket (RFC 6455) implementation: text messages, pings and
+// closing, for the group chats of chatty serve and the real-time APIs of the chat services
+// chatty --bridge connects to
+package websocket
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	guid        = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+	dialTimeout = 30 * time.Second
+)
+
+// Opcodes of frames
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// CloseError is returned once the other end closed the connection, with the code it gave
+type CloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *CloseError) Error() string {
+	if e.Reason != "" {
+		return fmt.Sprintf("websocket closed (%d: %s)", e.Code, e.Reason)
+	}
+	return fmt.Sprintf("websocket closed (%d)", e.Code)
+}
+
+// Conn is a WebSocket connection, opened by Dial as a client or by Upgrade as a server
+type Conn struct {
+	conn    net.Conn
+	reader  *bufio.Reader
+	client  bool // Clients mask the frames they send, and servers never do
+	maxSize int  // Largest message read, in bytes
+	writeMu sync.Mutex
+}
+
+// Dial opens a WebSocket to a ws:// or wss:// address, reading messages of up to maxSize bytes
+func Dial(address string, maxSize int) (*Conn, error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("invalid WebSocket address: %v", err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "wss" {
+			host += ":443"
+		} else {
+			host += ":80"
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: dialTimeout}
+	var conn net.Conn
+	switch u.Scheme {
+	case "wss":
+		conn, err = tls.DialWithDialer(dialer, "tcp", host, &tls.Config{ServerName: u.Hostname()})
+	case "ws":
+		conn, err = dialer.Dial("tcp", host)
+	default:
+		return nil, fmt.Errorf("unsupported WebSocket scheme '%s'", u.Scheme)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", u.Host, err)
+	}
+
+	nonce := make([]byte, 16)
+	rand.Read(nonce)
+	key := base64.StdEncoding.EncodeToString(nonce)
+	request := "GET " + u.RequestURI() + " HTTP/1.1\r\n" +
+		"Host: " + u.Host + "\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Key: " + key + "\r\n" +
+		"Sec-WebSocket-Version: 13\r\n\r\n"
+	conn.SetDeadline(time.Now().Add(dialTimeout))
+	if _, err := conn.Write([]byte(request)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open WebSocket: %v", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, &http.Request{Method: http.MethodGet})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open WebSocket: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusSwitchingProtocols || resp.Header.Get("Sec-WebSocket-Accept") != acceptKey(key) {
+		conn.Close()
+		return nil, fmt.Errorf("failed to open WebSocket: %s", resp.Status)
+	}
+	conn.SetDeadline(time.Time{})
+	return &Conn{conn: conn, reader: reader, client: true, maxSize: maxSize}, nil
+}
+
+// Upgrade switches a request to the WebSocket protocol, reading messages of up to maxSize bytes.
+// Browsers let pages of any site open WebSockets, so requests must be checked before they get here
+func Upgrade(w http.ResponseWriter, r *http.Request, maxSize int) (*Conn, error) {
+	if !headerContains(r.Header, "Connection", "upgrade") || !headerContains(r.Header, "Upgrade", "websocket") {
+		return nil, fmt.Errorf("expected a WebSocket upgrade request")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return nil, fmt.Errorf("unsupported WebSocket version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		return nil, fmt.Errorf("missing Sec-WebSocket-Key")
+	}
+
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return nil, fmt.Errorf("the connection can't be upgraded")
+	}
+	conn, rw, err := hijacker.Hijack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to upgrade the connection: %v", err)
+	}
+
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + acceptKey(key) + "\r\n\r\n"
+	if _, err := conn.Write([]byte(response)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Conn{conn: conn, reader: rw.Reader, maxSize: maxSize}, nil
+}
+
+// acceptKey returns the Sec-WebSocket-Accept a server answers a Sec-WebSocket-Key with
+func acceptKey(key string) string {
+	sum := sha1.Sum([]byte(key + guid))
+	return base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// headerContains reports whether a comma-separated header lists a token
+func headerContains(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, part := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// ReadMessage returns the next text or binary message, answering pings on the way. It returns a
+// *CloseError once the other end closes the connection
+func (c *Conn) ReadMessage() ([]byte, error) {
+	var message []byte
+	fragmented := false // The message started with a frame that wasn't its last
+	for {
+		f, err := readFrame(c.reader, !c.client, c.maxSize)
+		if err != nil {
+			return nil, err
+		}
+		switch f.opcode {
+		case opPing:
+			if err := c.send(frame{fin: true, opcode: opPong, payload: f.payload}); err != nil {
+				return nil, err
+			}
+		case opPong:
+		case opClose:
+			c.send(frame{fin: true, opcode: opClose})
+			closed := &CloseError{Code: 1005} // No status code
+			if len(f.payload) >= 2 {
+				closed.Code = int(binary.BigEndian.Uint16(f.payload))
+				closed.Reason = string(f.payload[2:])
+			}
+			return nil, closed
+		case opText, opBinary, opContinuation:
+			if (f.opcode == opContinuation) != fragmented {
+				return nil, fmt.Errorf("unexpected frame in the middle of a message")
+			}
+			message = append(message, f.payload...)
+			if len(message) > c.maxSize {
+				c.Close()
+				return nil, fmt.Errorf("message too large")
+			}
+			if f.fin {
+				return message, nil
+			}
+			fragmented = true
+		default:
+			return nil, fmt.Errorf("unknown opcode %d", f.opcode)
+		}
+	}
+}
+
+// WriteText sends a text message
+func (c *Conn) WriteText(data []byte) error {
+	return c.send(frame{fin: true, opcode: opText, payload: data})
+}
+
+// send writes a frame, masked when this end is the client
+func (c *Conn) send(f frame) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	return writeFrame(c.conn, f, c.client)
+}
+
+// Close tells the other end the connection is closing, and closes it
+func (c *Conn) Close() error {
+	c.send(frame{fin: true, opcode: opClose})
+	return c.conn.Close()
+}
+
+// frame is a WebSocket frame: a message, a part of one or a control frame
+type frame struct {
+	fin     bool // The last frame of its message
+	opcode  byte
+	payload []byte
+}
+
+// readFrame reads a frame of up to maxSize bytes. Clients mask the frames they send and servers
+// never do, so masked says which the other end is
+func readFrame(r io.Reader, masked bool, maxSize int) (frame, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return frame{}, err
+	}
+	f := frame{fin: header[0]&0x80 != 0, opcode: header[0] & 0x0F}
+	length := uint64(header[1] & 0x7F)
+
+	switch length {
+	case 126:
+		var extended [2]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return frame{}, err
+		}
+		length = uint64(binary.BigEndian.Uint16(extended[:]))
+	case 127:
+		var extended [8]byte
+		if _, err := io.ReadFull(r, extended[:]); err != nil {
+			return frame{}, err
+		}
+		length = binary.BigEndian.Uint64(extended[:])
+	}
+	if f.opcode&0x8 != 0 && (!f.fin || length > 125) {
+		return frame{}, fmt.Errorf("control frames can't be fragmented or longer than 125 bytes")
+	}
+	if length > uint64(maxSize) {
+		return frame{}, fmt.Errorf("frame too large")
+	}
+	if isMasked := header[1]&0x80 != 0; isMasked != masked {
+		if masked {
+			return frame{}, fmt.Errorf("client frames must be masked")
+		}
+		return frame{}, fmt.Errorf("server frames must not be masked")
+	}
+
+	var mask [4]byte
+	if masked {
+		if _, err := io.ReadFull(r, mask[:]); err != nil {
+			return frame{}, err
+		}
+	}
+	f.payload = make([]byte, length)
+	if _, err := io.ReadFull(r, f.payload); err != nil {
+		return frame{}, err
+	}
+	if masked {
+		for i := range f.payload {
+			f.payload[i] ^= mask[i%4]
+		}
+	}
+	return f, nil
+}
+
+// writeFrame writes a frame, with a random mask when mask is set as clients must
+func writeFrame(w io.Writer, f frame, mask bool) error {
+	first := f.opcode
+	if f.fin {
+		first |= 0x80
+	}
+	var maskBit byte
+	if mask {
+		maskBit = 0x80
+	}
+
+	header := []byte{first}
+	switch length := len(f.payload); {
+	case length < 126:
+		header = append(header, maskBit|byte(length))
+	case length <= 0xFFFF:
+		header = append(header, maskBit|126, 0, 0)
+		binary.BigEndian.PutUint16(header[2:], uint16(length))
+	default:
+		header = append(header, maskBit|127, 0, 0, 0, 0, 0, 0, 0, 0)
+		binary.BigEndian.PutUint64(header[2:], uint64(length))
+	}
+	payload := f.payload
+	if mask {
+		var key [4]byte
+		rand.Read(key[:])
+		header = append(header, key[:]...)
+		payload = make([]byte, len(f.payload))
+		for i := range f.payload {
+			payload[i] = f.payload[i] ^ key[i%4]
+		}
+	}
+	_, err := w.Write(append(header, payload...))
+	return err
+}
@@ -0,0 +1,219 @@
+package websocket
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestFrameRoundTrip(t *testing.T) {
+	tests := []struct {
+		name       string
+		opcode     byte
+		fin        bool
+		size       int
+		headerSize int // Without the mask
+	}{
+		{"empty", opText, true, 0, 2},
+		{"7-bit length", opText, true, 125, 2},
+		{"16-bit length", opBinary, true, 126, 4},
+		{"largest 16-bit length", opText, true, 0xFFFF, 4},
+		{"64-bit length", opBinary, true, 0x10000, 10},
+		{"first fragment", opText, false, 300, 4},
+		{"continuation", opContinuation, true, 10, 2},
+		{"ping", opPing, true, 125, 2},
+		{"pong", opPong, true, 4, 2},
+		{"close", opClose, true, 2, 2},
+	}
+	for _, tt := range tests {
+		for _, masked := range []bool{false, true} {
+			payload := bytes.Repeat([]byte("abc"), tt.size/3+1)[:tt.size]
+			var buf bytes.Buffer
+			if err := writeFrame(&buf, frame{fin: tt.fin, opcode: tt.opcode, payload: payload}, masked); err != nil {
+				t.Fatalf("%s: writeFrame: %v", tt.name, err)
+			}
+			size := tt.headerSize + tt.size
+			if masked {
+				size += 4
+			}
+			if buf.Len() != size {
+				t.Errorf("%s (masked %v): frame of %d bytes, want %d", tt.name, masked, buf.Len(), size)
+			}
+			f, err := readFrame(&buf, masked, 1<<20)
+			if err != nil {
+				t.Fatalf("%s (masked %v): readFrame: %v", tt.name, masked, err)
+			}
+			if f.fin != tt.fin || f.opcode != tt.opcode || !bytes.Equal(f.payload, payload) {
+				t.Errorf("%s (masked %v): read fin %v, opcode %d and %d bytes, want fin %v, opcode %d and %d bytes",
+					tt.name, masked, f.fin, f.opcode, len(f.payload), tt.fin, tt.opcode, len(payload))
+			}
+		}
+	}
+}
+
+func TestReadFrameErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		frame  frame
+		masked bool // Whether the frame is sent masked
+		err    string
+	}{
+		{"unmasked client frame", frame{fin: true, opcode: opText, payload: []byte("hi")}, false, "must be masked"},
+		{"fragmented ping", frame{opcode: opPing}, true, "control frames"},
+		{"long close", frame{fin: true, opcode: opClose, payload: make([]byte, 126)}, true, "control frames"},
+		{"too large", frame{fin: true, opcode: opText, payload: make([]byte, 101)}, true, "too large"},
+	}
+	for _, tt := range tests {
+		var buf bytes.Buffer
+		writeFrame(&buf, tt.frame, tt.masked)
+		_, err := readFrame(&buf, true, 100)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: readFrame error %v, want one with %q", tt.name, err, tt.err)
+		}
+	}
+
+	var buf bytes.Buffer
+	writeFrame(&buf, frame{fin: true, opcode: opText}, true)
+	if _, err := readFrame(&buf, false, 100); err == nil || !strings.Contains(err.Error(), "must not be masked") {
+		t.Errorf("masked server frame: readFrame error %v, want one about masking", err)
+	}
+}
+
+// recorder is a connection whose writes are kept, for what a Conn answers with
+type recorder struct {
+	net.Conn
+	written bytes.Buffer
+}
+
+func (r *recorder) Write(p []byte) (int, error) { return r.written.Write(p) }
+func (r *recorder) Close() error                { return nil }
+
+// serverConn returns the server end of a connection the client sent frames on
+func serverConn(frames ...frame) (*Conn, *recorder) {
+	var input bytes.Buffer
+	for _, f := range frames {
+		writeFrame(&input, f, true)
+	}
+	conn := &recorder{}
+	return &Conn{conn: conn, reader: bufio.NewReader(&input), maxSize: 1 << 20}, conn
+}
+
+func TestReadMessageFragmented(t *testing.T) {
+	c, conn := serverConn(
+		frame{opcode: opText, payload: []byte("Hello")},
+		frame{fin: true, opcode: opPing, payload: []byte("still there?")},
+		frame{opcode: opContinuation, payload: []byte(", ")},
+		frame{fin: true, opcode: opContinuation, payload: []byte("world")},
+		frame{fin: true, opcode: opText, payload: []byte("again")},
+	)
+	for _, want := range []string{"Hello, world", "again"} {
+		message, err := c.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		if string(message) != want {
+			t.Errorf("ReadMessage = %q, want %q", message, want)
+		}
+	}
+
+	pong, err := readFrame(&conn.written, false, 1<<20)
+	if err != nil {
+		t.Fatalf("reading the answer to the ping: %v", err)
+	}
+	if pong.opcode != opPong || string(pong.payload) != "still there?" {
+		t.Errorf("ping answered with opcode %d and %q, want a pong with the ping's payload", pong.opcode, pong.payload)
+	}
+}
+
+func TestReadMessageErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		frames []frame
+		err    string
+	}{
+		{"continuation first", []frame{{fin: true, opcode: opContinuation, payload: []byte("x")}}, "unexpected frame"},
+		{"new message in a fragmented one", []frame{{opcode: opText, payload: []byte("x")}, {fin: true, opcode: opText}}, "unexpected frame"},
+		{"unknown opcode", []frame{{fin: true, opcode: 0x3}}, "unknown opcode"},
+	}
+	for _, tt := range tests {
+		c, _ := serverConn(tt.frames...)
+		if _, err := c.ReadMessage(); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: ReadMessage error %v, want one with %q", tt.name, err, tt.err)
+		}
+	}
+
+	c, _ := serverConn(frame{opcode: opText, payload: []byte("1234")}, frame{fin: true, opcode: opContinuation, payload: []byte("5")})
+	c.maxSize = 4
+	if _, err := c.ReadMessage(); err == nil || !strings.Contains(err.Error(), "too large") {
+		t.Errorf("ReadMessage of a message over the limit: %v, want an error", err)
+	}
+}
+
+func TestReadMessageClose(t *testing.T) {
+	c, conn := serverConn(frame{fin: true, opcode: opClose, payload: append([]byte{0x03, 0xE8}, "bye"...)})
+	_, err := c.ReadMessage()
+	var closed *CloseError
+	if !errors.As(err, &closed) || closed.Code != 1000 || closed.Reason != "bye" {
+		t.Fatalf("ReadMessage error %v, want a close with 1000 and bye", err)
+	}
+	answer, err := readFrame(&conn.written, false, 1<<20)
+	if err != nil || answer.opcode != opClose {
+		t.Errorf("close answered with opcode %d (%v), want a close", answer.opcode, err)
+	}
+
+	c, _ = serverConn(frame{fin: true, opcode: opClose})
+	if _, err := c.ReadMessage(); !errors.As(err, &closed) || closed.Code != 1005 {
+		t.Errorf("ReadMessage error %v, want a close without a status code", err)
+	}
+}
+
+func TestDialAndUpgrade(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := Upgrade(w, r, 1<<20)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		defer conn.Close()
+		for {
+			message, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			conn.WriteText(append([]byte("echo: "), message...))
+		}
+	}))
+	defer server.Close()
+
+	conn, err := Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/chat?x=1", 1<<20)
+	if err != nil {
+		t.Fatalf("Dial: %v", err)
+	}
+	defer conn.Close()
+	for _, message := range []string{"hi", strings.Repeat("long ", 20000)} {
+		if err := conn.WriteText([]byte(message)); err != nil {
+			t.Fatalf("WriteText: %v", err)
+		}
+		echo, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("ReadMessage: %v", err)
+		}
+		if string(echo) != "echo: "+message {
+			t.Errorf("echo of %d bytes = %d bytes, want %d", len(message), len(echo), len(message)+6)
+		}
+	}
+
+	resp, err := http.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("plain request answered with %d, want %d", resp.StatusCode, http.StatusBadRequest)
+	}
+}